@@ -0,0 +1,119 @@
+package reflex
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// NewAckStreamSpec returns a Spec that consumes events from an ack stream
+// source using Run. Instead of storing a cursor, each event is acked after
+// it was successfully consumed. Consumers therefore need not change to
+// consume events from message queues.
+func NewAckStreamSpec(stream AckStreamFunc, consumer Consumer,
+	opts ...StreamOption) Spec {
+
+	a := &ackAdapter{
+		stream:  stream,
+		pending: make(map[string]pendingAck),
+	}
+	return NewSpec(a.Stream, a, consumer, opts...)
+}
+
+type pendingAck struct {
+	sc AckStreamClient
+	e  *Event
+}
+
+// ackAdapter adapts an AckStreamFunc to a StreamFunc and a CursorStore
+// that acks events when their cursor is set.
+type ackAdapter struct {
+	stream AckStreamFunc
+
+	mu      sync.Mutex
+	pending map[string]pendingAck
+}
+
+// Stream implements StreamFunc. The after cursor is ignored since the
+// source tracks consumption via acks.
+func (a *ackAdapter) Stream(ctx context.Context, _ string,
+	opts ...StreamOption) (StreamClient, error) {
+
+	sc, err := a.stream(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ackStreamClient{sc: sc, adapter: a}, nil
+}
+
+// GetCursor implements CursorStore and always returns an empty cursor.
+func (a *ackAdapter) GetCursor(context.Context, string) (string, error) {
+	return "", nil
+}
+
+// SetCursor implements CursorStore by acking the event with the cursor ID.
+func (a *ackAdapter) SetCursor(ctx context.Context, consumerName string, cursor string) error {
+	a.mu.Lock()
+	p, ok := a.pending[cursor]
+	delete(a.pending, cursor)
+	a.mu.Unlock()
+
+	if !ok {
+		return errors.New("ack of unknown event",
+			j.KS("consumer", consumerName), j.KS("event_id", cursor))
+	}
+
+	return p.sc.Ack(ctx, p.e)
+}
+
+// Flush implements CursorStore and is a noop since acks are not buffered.
+func (a *ackAdapter) Flush(context.Context) error {
+	return nil
+}
+
+func (a *ackAdapter) add(sc AckStreamClient, e *Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pending[e.ID] = pendingAck{sc: sc, e: e}
+}
+
+// forget removes all pending acks of the stream client.
+func (a *ackAdapter) forget(sc AckStreamClient) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for id, p := range a.pending {
+		if p.sc == sc {
+			delete(a.pending, id)
+		}
+	}
+}
+
+type ackStreamClient struct {
+	sc      AckStreamClient
+	adapter *ackAdapter
+}
+
+func (s *ackStreamClient) Recv() (*Event, error) {
+	e, err := s.sc.Recv()
+	if err != nil {
+		return nil, err
+	}
+	s.adapter.add(s.sc, e)
+	return e, nil
+}
+
+// Close forgets unacked events, which the source will redeliver,
+// and closes the underlying stream if it is a closer.
+func (s *ackStreamClient) Close() error {
+	s.adapter.forget(s.sc)
+
+	if closer, ok := s.sc.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
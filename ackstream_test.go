@@ -0,0 +1,53 @@
+package reflex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAckStreamSpec(t *testing.T) {
+	errTest := errors.New("test error")
+
+	sc := &mockackstreamclient{
+		mockstreamclient: mockstreamclient{
+			Events:   []*Event{{ID: "1"}, {ID: "2"}, {ID: "3"}},
+			EndError: errors.New("unexpected end"),
+		},
+	}
+	stream := func(ctx context.Context, opts ...StreamOption) (AckStreamClient, error) {
+		return sc, nil
+	}
+
+	consumer := NewConsumer("test_ack", func(ctx context.Context, f fate.Fate, e *Event) error {
+		if e.ID == "3" {
+			return errTest
+		}
+		return nil
+	})
+
+	err := Run(context.Background(), NewAckStreamSpec(stream, consumer))
+	jtest.Require(t, errTest, err)
+	require.Equal(t, []string{"1", "2"}, sc.acks)
+	require.True(t, sc.closed)
+}
+
+type mockackstreamclient struct {
+	mockstreamclient
+	acks   []string
+	closed bool
+}
+
+func (m *mockackstreamclient) Ack(_ context.Context, e *Event) error {
+	m.acks = append(m.acks, e.ID)
+	return nil
+}
+
+func (m *mockackstreamclient) Close() error {
+	m.closed = true
+	return nil
+}
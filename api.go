@@ -2,10 +2,14 @@ package reflex
 
 import (
 	"context"
+	"encoding/hex"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 )
 
 // Event is the reflex event. It is an immutable notification event that indicates that
@@ -17,6 +21,18 @@ type Event struct {
 	ForeignID string
 	Timestamp time.Time
 	MetaData  []byte
+
+	// ForeignKeys are the values of additional foreign reference columns
+	// keyed by column, e.g. "account_id", if supported by the event source.
+	ForeignKeys map[string]string
+
+	// Headers are optional event attributes separate from the metadata
+	// payload, e.g. trace IDs, tenant IDs or actors, if supported by the
+	// event source.
+	Headers map[string]string
+
+	// TenantID is the tenant of the event in multi-tenant event sources.
+	TenantID string
 }
 
 // IDInt returns the event id as an int64 or 0 if it is not an integer.
@@ -43,6 +59,41 @@ func (e *Event) IsForeignIDInt() bool {
 	return err == nil
 }
 
+// ParseForeignIDInt returns the foreign id as an int64 or
+// ErrInvalidForeignID if it is not an integer.
+func (e *Event) ParseForeignIDInt() (int64, error) {
+	i, err := strconv.ParseInt(e.ForeignID, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(ErrInvalidForeignID, "not an integer",
+			j.KS("foreign_id", e.ForeignID))
+	}
+	return i, nil
+}
+
+// ForeignIDUUID returns the foreign id as the bytes of a UUID in canonical
+// (8-4-4-4-12 hex digits) or 32 hex digit form or ErrInvalidForeignID if it
+// is not a UUID.
+func (e *Event) ForeignIDUUID() ([16]byte, error) {
+	var res [16]byte
+
+	s := e.ForeignID
+	if len(s) == 36 && s[8] == '-' && s[13] == '-' && s[18] == '-' && s[23] == '-' {
+		s = strings.Replace(s, "-", "", 4)
+	}
+
+	if len(s) != 32 {
+		return res, errors.Wrap(ErrInvalidForeignID, "not a uuid",
+			j.KS("foreign_id", e.ForeignID))
+	}
+
+	if _, err := hex.Decode(res[:], []byte(s)); err != nil {
+		return res, errors.Wrap(ErrInvalidForeignID, "not a uuid",
+			j.KS("foreign_id", e.ForeignID))
+	}
+
+	return res, nil
+}
+
 // EventType is an interface for enums that act as reflex event types.
 type EventType interface {
 	// ReflexType returns the type as an int.
@@ -122,6 +173,15 @@ type StreamClient interface {
 	// to this interface rather than current optional checks.
 }
 
+// EventReleaser is an optional interface that stream clients reusing events
+// implement, see rsql.WithEventsPool. Run releases each event to the stream
+// client after consuming it and setting the cursor, so consumers must not
+// retain the event after Consume returns.
+type EventReleaser interface {
+	// Release returns the event to the stream client for reuse.
+	Release(*Event)
+}
+
 // StreamFunc is the main reflex stream interface that all implementations should provide.
 // It returns a long lived StreamClient that will stream events from the source.
 type StreamFunc func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error)
@@ -151,3 +211,92 @@ type CursorStore interface {
 	// Flush writes any buffered cursors to the underlying store.
 	Flush(ctx context.Context) error
 }
+
+// AckStreamClient is a StreamClient of a source that tracks consumption by
+// acknowledging each event individually (e.g. SQS or Pub/Sub) instead of
+// by cursor, see NewAckStreamSpec.
+type AckStreamClient interface {
+	StreamClient
+
+	// Ack acknowledges that the event was successfully consumed.
+	Ack(ctx context.Context, e *Event) error
+}
+
+// AckStreamFunc returns a long lived AckStreamClient that streams
+// unacknowledged events from the source.
+type AckStreamFunc func(ctx context.Context, opts ...StreamOption) (AckStreamClient, error)
+
+// CursorResetter is implemented by cursor stores that support resetting
+// (also decreasing) cursors, see Replay.
+type CursorResetter interface {
+	// ResetCursor sets the consumers cursor to any value even
+	// if it is before the current cursor.
+	ResetCursor(ctx context.Context, consumerName string, cursor string) error
+}
+
+// CursorFencer is implemented by cursor stores that support fencing the
+// cursor writes of consumers accidentally running concurrently, see Run.
+type CursorFencer interface {
+	// Fence acquires a new epoch of the consumers cursor and returns a cursor
+	// store that rejects writes with ErrCursorFenced once a later epoch
+	// is acquired by another Fence call.
+	Fence(ctx context.Context, consumerName string) (CursorStore, error)
+}
+
+// LeaseStore is an interface used to coordinate exclusive ownership of keys
+// between multiple instances, for example the shards of a consumer group.
+type LeaseStore interface {
+	// Acquire acquires or renews the lease of the key for the owner and returns
+	// true if the owner holds the lease for the ttl. It returns false if the
+	// lease is held by another owner and has not expired.
+	Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+
+	// Release releases the lease of the key if held by the owner.
+	Release(ctx context.Context, key, owner string) error
+}
+
+// StateStore is an interface used to persist versioned states of keys with
+// optimistic locking, for example the state machines of rpatterns workflows.
+type StateStore interface {
+	// Load returns the state and version of the key. It returns a nil state
+	// and zero version if the key doesn't exist.
+	Load(ctx context.Context, key string) ([]byte, int64, error)
+
+	// Store stores the state of the key and increments its version if the
+	// current version matches. It returns ErrStateConflict otherwise.
+	Store(ctx context.Context, key string, state []byte, version int64) error
+}
+
+// DeliveryStatus is the status of a delivery, see Delivery.
+type DeliveryStatus int
+
+const (
+	DeliveryUnknown   DeliveryStatus = 0
+	DeliverySucceeded DeliveryStatus = 1
+	DeliveryFailed    DeliveryStatus = 2
+)
+
+// Delivery is the result of delivering an event to an external endpoint,
+// for example by rpatterns webhook consumers.
+type Delivery struct {
+	Endpoint string
+	EventID  string
+	Status   DeliveryStatus
+	Attempts int
+
+	// StatusCode is the last response status code or zero if none.
+	StatusCode int
+
+	// Error is the last error or empty if none.
+	Error string
+
+	UpdatedAt time.Time
+}
+
+// DeliveryStore is an interface used to record the status of deliveries
+// for auditing and redelivering failed deliveries.
+type DeliveryStore interface {
+	// RecordDelivery inserts the delivery or replaces the existing
+	// delivery of the event to the endpoint.
+	RecordDelivery(ctx context.Context, d Delivery) error
+}
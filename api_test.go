@@ -0,0 +1,36 @@
+package reflex
+
+import (
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForeignIDHelpers(t *testing.T) {
+	e := Event{ForeignID: "123"}
+	i, err := e.ParseForeignIDInt()
+	jtest.RequireNil(t, err)
+	require.Equal(t, int64(123), i)
+
+	e = Event{ForeignID: "7d444840-9dc0-11d1-b245-5ffdce74fad2"}
+	_, err = e.ParseForeignIDInt()
+	jtest.Require(t, ErrInvalidForeignID, err)
+
+	b, err := e.ForeignIDUUID()
+	jtest.RequireNil(t, err)
+	require.Equal(t, [16]byte{0x7d, 0x44, 0x48, 0x40, 0x9d, 0xc0, 0x11, 0xd1,
+		0xb2, 0x45, 0x5f, 0xfd, 0xce, 0x74, 0xfa, 0xd2}, b)
+
+	e = Event{ForeignID: "7d4448409dc011d1b2455ffdce74fad2"}
+	b2, err := e.ForeignIDUUID()
+	jtest.RequireNil(t, err)
+	require.Equal(t, b, b2)
+
+	for _, id := range []string{"", "123", "7d444840-9dc0-11d1-b245-5ffdce74fad", "7d444840x9dc0-11d1-b245-5ffdce74fad2",
+		"7d444840-9dc0-11d1-b245-5ffdce74fadz"} {
+		e := Event{ForeignID: id}
+		_, err := e.ForeignIDUUID()
+		jtest.Require(t, ErrInvalidForeignID, err, id)
+	}
+}
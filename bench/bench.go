@@ -0,0 +1,363 @@
+// Package bench provides a load generator for reflex events tables backed by
+// a real MySQL database. It inserts events at a configurable rate and payload
+// size while concurrent consumers stream them, and reports the insert and
+// consume throughput and the insert-to-consume latency. The package
+// benchmarks (go test -bench . ./bench) use it to catch performance
+// regressions in the stream path and to compare rsql tuning options.
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rsql"
+)
+
+const schema = `
+create table %s (
+  id bigint not null auto_increment,
+  foreign_id varchar(255) not null,
+  timestamp datetime(3) not null,
+  type int not null,
+  metadata blob null,
+
+  primary key (id)
+);`
+
+// CreateTable creates an events table compatible with rsql.NewEventsTable's
+// default fields, dropping it first if it exists.
+func CreateTable(ctx context.Context, dbc *sql.DB, name string) error {
+	if err := DropTable(ctx, dbc, name); err != nil {
+		return err
+	}
+
+	_, err := dbc.ExecContext(ctx, fmt.Sprintf(schema, name))
+	if err != nil {
+		return errors.Wrap(err, "create table error", j.KS("table", name))
+	}
+	return nil
+}
+
+// DropTable drops the events table if it exists.
+func DropTable(ctx context.Context, dbc *sql.DB, name string) error {
+	_, err := dbc.ExecContext(ctx, "drop table if exists "+name)
+	if err != nil {
+		return errors.Wrap(err, "drop table error", j.KS("table", name))
+	}
+	return nil
+}
+
+// Option defines a functional option that configures a load run.
+type Option func(*options)
+
+type options struct {
+	rate      int
+	batch     int
+	payload   int
+	consumers int
+	duration  time.Duration
+	drain     time.Duration
+}
+
+// WithInsertRate provides an option to set the number of events inserted
+// per second. Zero inserts as fast as possible. It defaults to 1000.
+func WithInsertRate(perSecond int) Option {
+	return func(o *options) {
+		o.rate = perSecond
+	}
+}
+
+// WithBatchSize provides an option to set the number of events inserted
+// per transaction. It defaults to 1.
+func WithBatchSize(n int) Option {
+	return func(o *options) {
+		o.batch = n
+	}
+}
+
+// WithPayloadSize provides an option to set the size of the event metadata
+// in bytes. It defaults to 0, i.e. no metadata.
+func WithPayloadSize(bytes int) Option {
+	return func(o *options) {
+		o.payload = bytes
+	}
+}
+
+// WithConsumers provides an option to set the number of concurrent
+// consumers streaming the events. It defaults to 1.
+func WithConsumers(n int) Option {
+	return func(o *options) {
+		o.consumers = n
+	}
+}
+
+// WithDuration provides an option to set the duration of inserting events.
+// It defaults to 10s.
+func WithDuration(d time.Duration) Option {
+	return func(o *options) {
+		o.duration = d
+	}
+}
+
+// WithDrainTimeout provides an option to set the maximum duration consumers
+// may take to consume all events after inserting stopped. It defaults to 10s.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.drain = d
+	}
+}
+
+// Result is the result of a load run.
+type Result struct {
+	// Inserted is the number of events inserted.
+	Inserted int
+
+	// Consumed is the number of events consumed by all consumers.
+	Consumed int
+
+	// InsertRate is the number of events inserted per second.
+	InsertRate float64
+
+	// ConsumeRate is the number of events consumed per second per consumer.
+	ConsumeRate float64
+
+	// LatencyP50, LatencyP99 and LatencyMax are the percentiles of the
+	// duration between inserting and consuming events.
+	LatencyP50 time.Duration
+	LatencyP99 time.Duration
+	LatencyMax time.Duration
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("inserted=%d consumed=%d insert_rate=%.0f/s "+
+		"consume_rate=%.0f/s latency_p50=%v latency_p99=%v latency_max=%v",
+		r.Inserted, r.Consumed, r.InsertRate, r.ConsumeRate,
+		r.LatencyP50, r.LatencyP99, r.LatencyMax)
+}
+
+// Run inserts events into the table for the configured duration while the
+// consumers stream them from the current head, and returns the result once
+// all consumers consumed all the events or the drain timeout expired. The
+// foreign IDs of the events are their insert times, so the table's foreign
+// ID field must support numeric strings.
+func Run(ctx context.Context, dbc *sql.DB, table *rsql.EventsTable,
+	opts ...Option) (Result, error) {
+
+	o := options{
+		rate:      1000,
+		batch:     1,
+		consumers: 1,
+		duration:  time.Second * 10,
+		drain:     time.Second * 10,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	head, err := table.ToLatestID(dbc)(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cl := make([]*consumer, o.consumers)
+	var wg sync.WaitGroup
+	for i := range cl {
+		sc, err := table.ToStream(dbc)(streamCtx, strconv.FormatInt(head, 10))
+		if err != nil {
+			return Result{}, err
+		}
+
+		c := new(consumer)
+		cl[i] = c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.consume(streamCtx, sc)
+		}()
+	}
+
+	t0 := time.Now()
+	inserted, err := insert(ctx, dbc, table, o)
+	insertDuration := time.Since(t0)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Wait for consumers to drain.
+	deadline := time.Now().Add(o.drain)
+	for !drained(cl, inserted) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	consumeDuration := time.Since(t0)
+
+	cancel()
+	wg.Wait()
+
+	for _, c := range cl {
+		if c.err != nil {
+			return Result{}, c.err
+		}
+	}
+
+	return makeResult(cl, inserted, insertDuration, consumeDuration), nil
+}
+
+// insert inserts events at the configured rate until the duration elapsed
+// and returns the number of inserted events.
+func insert(ctx context.Context, dbc *sql.DB, table *rsql.EventsTable,
+	o options) (int, error) {
+
+	payload := make([]byte, o.payload)
+	if o.payload == 0 {
+		payload = nil
+	}
+
+	var (
+		n     int
+		start = time.Now()
+		end   = start.Add(o.duration)
+	)
+	for time.Now().Before(end) {
+		if o.rate > 0 {
+			// Pace the inserts by sleeping until the next event is due.
+			due := start.Add(time.Duration(n) * time.Second / time.Duration(o.rate))
+			if d := time.Until(due); d > 0 {
+				select {
+				case <-ctx.Done():
+					return 0, ctx.Err()
+				case <-time.After(d):
+				}
+			}
+		}
+
+		tx, err := dbc.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		events := make([]rsql.EventToInsert, o.batch)
+		for i := range events {
+			events[i] = rsql.EventToInsert{
+				ForeignID: strconv.FormatInt(time.Now().UnixNano(), 10),
+				Type:      eventType(1),
+				MetaData:  payload,
+			}
+		}
+
+		notify, err := table.InsertMany(ctx, tx, events)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+		notify()
+
+		n += o.batch
+	}
+
+	return n, nil
+}
+
+type consumer struct {
+	count     int64
+	latencies []time.Duration
+	err       error
+}
+
+// consume streams events, recording their insert-to-consume latencies,
+// until the context is canceled. It releases events if pooled,
+// see rsql.WithEventsPool.
+func (c *consumer) consume(ctx context.Context, sc reflex.StreamClient) {
+	for {
+		e, err := sc.Recv()
+		if ctx.Err() != nil {
+			return
+		} else if err != nil {
+			c.err = err
+			return
+		}
+
+		nanos, err := strconv.ParseInt(e.ForeignID, 10, 64)
+		if err != nil {
+			c.err = errors.Wrap(err, "invalid foreign id", j.KS("id", e.ID))
+			return
+		}
+
+		c.latencies = append(c.latencies, time.Since(time.Unix(0, nanos)))
+		atomic.AddInt64(&c.count, 1)
+
+		if r, ok := sc.(reflex.EventReleaser); ok {
+			r.Release(e)
+		}
+	}
+}
+
+// drained returns true if all consumers consumed n events.
+func drained(cl []*consumer, n int) bool {
+	for _, c := range cl {
+		if atomic.LoadInt64(&c.count) < int64(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// makeResult returns the result of the consumers that stopped.
+func makeResult(cl []*consumer, inserted int, insertDuration,
+	consumeDuration time.Duration) Result {
+
+	var latencies []time.Duration
+	for _, c := range cl {
+		latencies = append(latencies, c.latencies...)
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	res := Result{
+		Inserted:   inserted,
+		Consumed:   len(latencies),
+		InsertRate: float64(inserted) / insertDuration.Seconds(),
+	}
+	if len(cl) > 0 {
+		res.ConsumeRate = float64(len(latencies)) / float64(len(cl)) /
+			consumeDuration.Seconds()
+	}
+	if len(latencies) > 0 {
+		res.LatencyP50 = percentile(latencies, 0.5)
+		res.LatencyP99 = percentile(latencies, 0.99)
+		res.LatencyMax = latencies[len(latencies)-1]
+	}
+
+	return res
+}
+
+// percentile returns the p percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+type eventType int
+
+func (t eventType) ReflexType() int {
+	return int(t)
+}
@@ -0,0 +1,197 @@
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+var benchDBURI = flag.String("bench_db_uri", getDefaultURI(), "Benchmark database uri")
+
+const (
+	benchTable  = "bench_events"
+	benchEvents = 10000
+)
+
+func getDefaultURI() string {
+	if uri := os.Getenv("DB_TEST_URI"); uri != "" {
+		return uri
+	}
+	return "root@unix(/tmp/mysql.sock)/test?"
+}
+
+// connect returns a connection to the benchmark database with a new
+// events table or skips the benchmark if the database isn't available.
+func connect(b *testing.B) *sql.DB {
+	dbc, err := sql.Open("mysql", *benchDBURI+"parseTime=true")
+	require.NoError(b, err)
+
+	if err := dbc.Ping(); err != nil {
+		b.Skipf("benchmark database not available: %v", err)
+	}
+
+	ctx := context.Background()
+	require.NoError(b, CreateTable(ctx, dbc, benchTable))
+	b.Cleanup(func() {
+		require.NoError(b, DropTable(ctx, dbc, benchTable))
+		require.NoError(b, dbc.Close())
+	})
+
+	return dbc
+}
+
+// seed inserts n events in batches.
+func seed(b *testing.B, dbc *sql.DB, n int) {
+	table := rsql.NewEventsTable(benchTable)
+	for n > 0 {
+		events := make([]rsql.EventToInsert, 1000)
+		if n < len(events) {
+			events = events[:n]
+		}
+		for i := range events {
+			events[i] = rsql.EventToInsert{ForeignID: strconv.Itoa(n - i), Type: eventType(1)}
+		}
+		n -= len(events)
+
+		tx, err := dbc.Begin()
+		require.NoError(b, err)
+		_, err = table.InsertMany(context.Background(), tx, events)
+		require.NoError(b, err)
+		require.NoError(b, tx.Commit())
+	}
+}
+
+var tableOptions = []struct {
+	name string
+	opts []rsql.EventsOption
+}{
+	{
+		name: "default",
+	},
+	{
+		name: "no_cache",
+		opts: []rsql.EventsOption{rsql.WithoutEventsCache()},
+	},
+	{
+		name: "prefetch",
+		opts: []rsql.EventsOption{rsql.WithoutEventsCache(), rsql.WithEventsPrefetch()},
+	},
+	{
+		name: "pool",
+		opts: []rsql.EventsOption{rsql.WithEventsPool()},
+	},
+	{
+		name: "fetch_limit_100",
+		opts: []rsql.EventsOption{rsql.WithoutEventsCache(), rsql.WithEventsFetchLimit(100)},
+	},
+}
+
+func BenchmarkInsert(b *testing.B) {
+	dbc := connect(b)
+	table := rsql.NewEventsTable(benchTable)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tx, err := dbc.Begin()
+		require.NoError(b, err)
+
+		notify, err := table.Insert(ctx, tx, strconv.Itoa(i), eventType(1))
+		require.NoError(b, err)
+		require.NoError(b, tx.Commit())
+		notify()
+	}
+}
+
+// BenchmarkStream streams a table of existing events from the start to
+// the head, i.e. the catch-up path.
+func BenchmarkStream(b *testing.B) {
+	dbc := connect(b)
+	ctx := context.Background()
+
+	seed(b, dbc, benchEvents)
+
+	for _, test := range tableOptions {
+		b.Run(test.name, func(b *testing.B) {
+			t0 := time.Now()
+			for i := 0; i < b.N; i++ {
+				// New tables don't share caches between iterations.
+				table := rsql.NewEventsTable(benchTable, test.opts...)
+				sc, err := table.ToStream(dbc)(ctx, "", reflex.WithStreamToHead())
+				require.NoError(b, err)
+
+				releaser, _ := sc.(reflex.EventReleaser)
+				var n int
+				for {
+					e, err := sc.Recv()
+					if reflex.IsHeadReachedErr(err) {
+						break
+					}
+					require.NoError(b, err)
+					if releaser != nil {
+						releaser.Release(e)
+					}
+					n++
+				}
+				require.Equal(b, benchEvents, n)
+			}
+			b.ReportMetric(float64(b.N*benchEvents)/time.Since(t0).Seconds(), "events/s")
+		})
+	}
+}
+
+// BenchmarkLoad runs the load generator with concurrent consumers streaming
+// from the head, i.e. the live path, and reports the consume latency.
+func BenchmarkLoad(b *testing.B) {
+	dbc := connect(b)
+	ctx := context.Background()
+
+	for _, test := range tableOptions {
+		b.Run(test.name, func(b *testing.B) {
+			table := rsql.NewEventsTable(benchTable,
+				append(test.opts, rsql.WithEventsInMemNotifier())...)
+
+			var res Result
+			for i := 0; i < b.N; i++ {
+				var err error
+				res, err = Run(ctx, dbc, table,
+					WithInsertRate(1000),
+					WithPayloadSize(256),
+					WithConsumers(10),
+					WithDuration(time.Second))
+				require.NoError(b, err)
+				require.Equal(b, res.Inserted*10, res.Consumed)
+			}
+			b.ReportMetric(float64(res.LatencyP50.Microseconds()), "p50-µs")
+			b.ReportMetric(float64(res.LatencyP99.Microseconds()), "p99-µs")
+		})
+	}
+}
+
+func TestMakeResult(t *testing.T) {
+	var c1, c2 consumer
+	for i := 1; i <= 100; i++ {
+		c1.latencies = append(c1.latencies, time.Duration(i)*time.Millisecond)
+	}
+	c2.latencies = append(c2.latencies, c1.latencies...)
+
+	res := makeResult([]*consumer{&c1, &c2}, 100, time.Second, time.Second*2)
+	require.Equal(t, Result{
+		Inserted:    100,
+		Consumed:    200,
+		InsertRate:  100,
+		ConsumeRate: 50,
+		LatencyP50:  50 * time.Millisecond,
+		LatencyP99:  99 * time.Millisecond,
+		LatencyMax:  100 * time.Millisecond,
+	}, res)
+}
@@ -0,0 +1,242 @@
+// Package chaostest provides reflex stream client wrappers that inject
+// latency, duplicate deliveries, bounded reordering and transient errors
+// to test the robustness of consumers in integration tests.
+package chaostest
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+// ErrInjected is the transient error returned by stream clients
+// configured with WithErrors.
+var ErrInjected = errors.New("chaostest injected error", j.C("ERR_e46b9d1a07c35f28"))
+
+// Option defines a functional option that configures the injected faults.
+type Option func(*options)
+
+type options struct {
+	minLatency time.Duration
+	maxLatency time.Duration
+	dupRate    float64
+	errRate    float64
+	window     int
+	seed       int64
+	sleep      func(time.Duration)
+}
+
+// WithLatency provides an option to delay each event by a random
+// duration between min and max.
+func WithLatency(min, max time.Duration) Option {
+	return func(o *options) {
+		o.minLatency = min
+		o.maxLatency = max
+	}
+}
+
+// WithDuplicates provides an option to deliver events twice
+// with the provided probability between 0 and 1.
+func WithDuplicates(probability float64) Option {
+	return func(o *options) {
+		o.dupRate = probability
+	}
+}
+
+// WithReordering provides an option to shuffle events within consecutive
+// windows of the provided number of events. Events of the same foreign ID
+// are never reordered. Note events are delayed until the window is filled
+// or the underlying stream returns an error, so use small windows for live
+// streams.
+func WithReordering(window int) Option {
+	return func(o *options) {
+		o.window = window
+	}
+}
+
+// WithErrors provides an option to return ErrInjected from Recv with the
+// provided probability between 0 and 1. No events are dropped, i.e. the
+// stream client may be used after errors, but reflex.Run returns them,
+// so consumers are restarted from their cursors.
+func WithErrors(probability float64) Option {
+	return func(o *options) {
+		o.errRate = probability
+	}
+}
+
+// WithSeed provides an option to set the random seed for reproducible
+// faults. It defaults to the current time.
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.seed = seed
+	}
+}
+
+// Wrap returns a stream client that injects the configured faults
+// into the events streamed by the provided stream client.
+func Wrap(sc reflex.StreamClient, opts ...Option) reflex.StreamClient {
+	o := options{
+		seed:  time.Now().UnixNano(),
+		sleep: time.Sleep,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &client{
+		sc:  sc,
+		o:   o,
+		rnd: rand.New(rand.NewSource(o.seed)),
+	}
+}
+
+// WrapStream returns a stream function that wraps the stream
+// clients of the provided stream function, see Wrap.
+func WrapStream(stream reflex.StreamFunc, opts ...Option) reflex.StreamFunc {
+	return func(ctx context.Context, after string, sopts ...reflex.StreamOption) (reflex.StreamClient, error) {
+		sc, err := stream(ctx, after, sopts...)
+		if err != nil {
+			return nil, err
+		}
+		return Wrap(sc, opts...), nil
+	}
+}
+
+type client struct {
+	sc  reflex.StreamClient
+	o   options
+	rnd *rand.Rand
+
+	out []*reflex.Event // Pending events to deliver
+	err error           // Underlying error to return once out is empty
+}
+
+func (c *client) Recv() (*reflex.Event, error) {
+	if c.o.errRate > 0 && c.rnd.Float64() < c.o.errRate {
+		return nil, ErrInjected
+	}
+
+	if len(c.out) == 0 {
+		if err := c.fill(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.o.maxLatency > 0 {
+		d := c.o.minLatency
+		if spread := c.o.maxLatency - c.o.minLatency; spread > 0 {
+			d += time.Duration(c.rnd.Int63n(int64(spread)))
+		}
+		c.o.sleep(d)
+	}
+
+	e := c.out[0]
+	c.out = c.out[1:]
+
+	if c.o.dupRate > 0 && c.rnd.Float64() < c.o.dupRate {
+		dup := *e
+		c.out = append([]*reflex.Event{&dup}, c.out...)
+	}
+
+	return e, nil
+}
+
+// fill reads the next window of events from the underlying stream client.
+func (c *client) fill() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	n := c.o.window
+	if n < 1 {
+		n = 1
+	}
+
+	for len(c.out) < n {
+		e, err := c.sc.Recv()
+		if err != nil {
+			c.err = err
+			break
+		}
+		c.out = append(c.out, e)
+	}
+
+	if len(c.out) == 0 {
+		return c.err
+	}
+
+	c.shuffle()
+
+	return nil
+}
+
+// shuffle shuffles the pending events preserving the order
+// of events with the same foreign ID.
+func (c *client) shuffle() {
+	if len(c.out) < 2 {
+		return
+	}
+
+	perm := c.rnd.Perm(len(c.out))
+
+	// Assign the positions of each foreign ID's events in stream order.
+	positions := make(map[string][]int)
+	for i, e := range c.out {
+		positions[e.ForeignID] = append(positions[e.ForeignID], perm[i])
+	}
+	for _, pl := range positions {
+		sort.Ints(pl)
+	}
+
+	res := make([]*reflex.Event, len(c.out))
+	for _, e := range c.out {
+		pl := positions[e.ForeignID]
+		res[pl[0]] = e
+		positions[e.ForeignID] = pl[1:]
+	}
+
+	c.out = res
+}
+
+// WrapCursorStore returns a cursor store that ignores int cursors not greater
+// than the maximum cursor set by a consumer, since duplicates and reordering
+// result in non-increasing cursors that cursor stores like rsql cursors tables
+// reject. Note that reordering may therefore skip events after restarts
+// which is not a fault of the consumer.
+func WrapCursorStore(cs reflex.CursorStore) reflex.CursorStore {
+	return &cursorStore{
+		CursorStore: cs,
+		max:         make(map[string]int64),
+	}
+}
+
+type cursorStore struct {
+	reflex.CursorStore
+
+	mu  sync.Mutex
+	max map[string]int64
+}
+
+func (s *cursorStore) SetCursor(ctx context.Context, consumerName string, cursor string) error {
+	i, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "invalid int cursor", j.KS("cursor", cursor))
+	}
+
+	s.mu.Lock()
+	if max, ok := s.max[consumerName]; ok && i <= max {
+		s.mu.Unlock()
+		return nil
+	}
+	s.max[consumerName] = i
+	s.mu.Unlock()
+
+	return s.CursorStore.SetCursor(ctx, consumerName, cursor)
+}
@@ -0,0 +1,108 @@
+package chaostest_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/chaostest"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+type testEventType int
+
+func (t testEventType) ReflexType() int {
+	return int(t)
+}
+
+func TestChaos(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []chaostest.Option
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "duplicates",
+			opts: []chaostest.Option{chaostest.WithDuplicates(0.5)},
+		},
+		{
+			name: "reordering",
+			opts: []chaostest.Option{chaostest.WithReordering(5)},
+		},
+		{
+			name: "errors",
+			opts: []chaostest.Option{chaostest.WithErrors(0.5)},
+		},
+		{
+			name: "latency",
+			opts: []chaostest.Option{chaostest.WithLatency(0, time.Millisecond)},
+		},
+		{
+			name: "all",
+			opts: []chaostest.Option{
+				chaostest.WithDuplicates(0.2),
+				chaostest.WithReordering(3),
+				chaostest.WithErrors(0.2),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table := rtest.NewEventsTable()
+			for i := 0; i < 20; i++ {
+				table.Insert(strconv.Itoa(i%3), testEventType(1))
+			}
+
+			stream := chaostest.WrapStream(table.Stream, append(test.opts, chaostest.WithSeed(1))...)
+			sc, err := stream(context.Background(), "", reflex.WithStreamToHead())
+			require.NoError(t, err)
+
+			var (
+				ids  = make(map[string]bool)
+				last = make(map[string]int64)
+			)
+			for {
+				e, err := sc.Recv()
+				if reflex.IsHeadReachedErr(err) {
+					break
+				} else if err != nil {
+					jtest.Require(t, chaostest.ErrInjected, err)
+					continue
+				}
+
+				// Events of the same foreign ID are in order.
+				require.True(t, e.IDInt() >= last[e.ForeignID])
+				last[e.ForeignID] = e.IDInt()
+				ids[e.ID] = true
+			}
+
+			// No events are dropped.
+			require.Len(t, ids, 20)
+		})
+	}
+}
+
+func TestWrapCursorStore(t *testing.T) {
+	ctx := context.Background()
+	cs := chaostest.WrapCursorStore(rtest.NewCursorStore())
+
+	require.NoError(t, cs.SetCursor(ctx, "test", "2"))
+	require.NoError(t, cs.SetCursor(ctx, "test", "2"))
+	require.NoError(t, cs.SetCursor(ctx, "test", "1"))
+
+	c, err := cs.GetCursor(ctx, "test")
+	require.NoError(t, err)
+	require.Equal(t, "2", c)
+
+	require.NoError(t, cs.SetCursor(ctx, "test", "3"))
+	c, err = cs.GetCursor(ctx, "test")
+	require.NoError(t, err)
+	require.Equal(t, "3", c)
+}
@@ -2,8 +2,11 @@ package reflex
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/luno/reflex/reflexpb"
+	"google.golang.org/grpc/metadata"
 )
 
 // StreamClientPB defines a common interface for reflex stream gRPC
@@ -12,7 +15,19 @@ type StreamClientPB interface {
 	Recv() (*reflexpb.Event, error)
 }
 
+// headerClientPB is implemented by gRPC generated stream clients.
+type headerClientPB interface {
+	Header() (metadata.MD, error)
+}
+
+// heartbeatTimeoutFactor is the number of heartbeat intervals after which
+// streams return ErrHeartbeatTimeout, see WithStreamHeartbeat.
+const heartbeatTimeoutFactor = 3
+
 // WrapStreamPB wraps a gRPC client's stream method and returns a StreamFunc.
+// The returned stream clients implement ProtocolClient. If the server does
+// not negotiate CapabilityFilters, the stream filters are applied by the
+// client instead. See WithStreamHeartbeat to detect half-open connections.
 func WrapStreamPB(wrap func(context.Context, *reflexpb.StreamRequest) (
 	StreamClientPB, error)) StreamFunc {
 	return func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
@@ -21,14 +36,163 @@ func WrapStreamPB(wrap func(context.Context, *reflexpb.StreamRequest) (
 			return nil, err
 		}
 
-		cspb, err := wrap(ctx, &reflexpb.StreamRequest{
-			After:   after,
-			Options: optionspb,
+		c := &protocolclientpb{}
+		for _, opt := range opts {
+			opt(&c.options)
+		}
+
+		if c.options.StreamHeartbeat > 0 {
+			// Cancel the gRPC stream on heartbeat timeout.
+			ctx, c.cancel = context.WithCancel(ctx)
+		}
+
+		c.StreamClientPB, err = wrap(ctx, &reflexpb.StreamRequest{
+			After:           after,
+			Options:         optionspb,
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    protocolRequest(),
 		})
 		if err != nil {
+			c.stop()
 			return nil, err
 		}
 
-		return streamClientFromProto(cspb), nil
+		if c.options.StreamHeartbeat > 0 {
+			go c.awaitHeartbeats()
+		}
+
+		return c, nil
+	}
+}
+
+// protocolclientpb is a stream client that negotiates the protocol
+// with the server, see ProtocolClient.
+type protocolclientpb struct {
+	StreamClientPB
+	options StreamOptions
+	cancel  context.CancelFunc
+
+	once     sync.Once
+	protocol Protocol
+	err      error
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	last     time.Time
+	timedOut bool
+	stopped  bool
+}
+
+// Protocol returns the protocol negotiated with the server. Stream clients
+// without gRPC response headers are version 0.
+func (c *protocolclientpb) Protocol() (Protocol, error) {
+	c.once.Do(func() {
+		hcpb, ok := c.StreamClientPB.(headerClientPB)
+		if !ok {
+			return
+		}
+
+		md, err := hcpb.Header()
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.protocol, c.err = protocolFromMD(md)
+	})
+	return c.protocol, c.err
+}
+
+func (c *protocolclientpb) Recv() (*Event, error) {
+	for {
+		pb, err := c.StreamClientPB.Recv()
+		if err != nil {
+			if c.stop() {
+				return nil, ErrHeartbeatTimeout
+			}
+			return nil, err
+		}
+
+		c.received()
+		if pb.Heartbeat {
+			continue
+		}
+
+		e, err := eventFromProto(pb)
+		if err != nil {
+			return nil, err
+		}
+
+		// Headers are always received before the first event,
+		// so this doesn't block.
+		p, err := c.Protocol()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.Has(CapabilityFilters) || c.options.Match(e) {
+			return e, nil
+		}
+	}
+}
+
+// awaitHeartbeats starts the heartbeat timer if the server negotiated
+// heartbeats. Servers that negotiate send the protocol immediately.
+func (c *protocolclientpb) awaitHeartbeats() {
+	p, err := c.Protocol()
+	if err != nil || !p.Has(CapabilityHeartbeats) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+
+	c.last = time.Now()
+	c.timer = time.AfterFunc(c.heartbeatTimeout(), c.checkHeartbeats)
+}
+
+// checkHeartbeats cancels the gRPC stream if no events or heartbeats were
+// received within the timeout, otherwise it checks again later.
+func (c *protocolclientpb) checkHeartbeats() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+
+	if d := time.Since(c.last); d < c.heartbeatTimeout() {
+		c.timer.Reset(c.heartbeatTimeout() - d)
+		return
+	}
+
+	c.timedOut = true
+	c.cancel()
+}
+
+func (c *protocolclientpb) heartbeatTimeout() time.Duration {
+	return c.options.StreamHeartbeat * heartbeatTimeoutFactor
+}
+
+// received records receiving an event or heartbeat.
+func (c *protocolclientpb) received() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = time.Now()
+}
+
+// stop stops the heartbeat timer and cancels the gRPC stream when the stream
+// ends. It returns true if the stream ended due to a heartbeat timeout.
+func (c *protocolclientpb) stop() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if c.cancel != nil {
+		c.cancel()
 	}
+	return c.timedOut
 }
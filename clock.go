@@ -0,0 +1,27 @@
+package reflex
+
+import "time"
+
+// Clock provides the current time and timers. It abstracts time for the
+// consumer lag, activity and retry logic and async cursor flushes so tests
+// can verify them deterministically with a fake clock, e.g. rtest.Clock.
+// See WithConsumerClock and rsql.WithCursorClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends
+	// the current time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the default clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
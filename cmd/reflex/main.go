@@ -0,0 +1,283 @@
+// Command reflex is a tool for operational debugging of reflex streams and
+// consumers, see the rcli package. Usage:
+//
+//	reflex tail -db=<dsn> -table=events [-metadata_field=metadata] [-format=json]
+//	reflex tail -grpc=<addr> [-stream=<name>] [-from_head] [-types=1,2]
+//	reflex cursors -db=<dsn> -table=cursors -consumer=<name>[,<name>]
+//	reflex cursors -db=<dsn> -table=cursors -consumer=<name> -reset=<cursor>
+//	reflex bench -db=<dsn> [-rate=1000] [-payload=0] [-consumers=1] [-duration=10s]
+//
+// Tail writes tab separated lines of event ID, timestamp, type, foreign ID
+// and metadata. Metadata is formatted as quoted strings (-format=raw), JSON
+// (-format=json) or protobuf messages defined in a descriptor set
+// (-format=proto -proto_set=<file> -proto_message=<pkg.Message>).
+// The -grpc flag streams from a reflex gRPC server's Stream method, or its
+// Multiplex method if -stream is set. Bench generates load against a new
+// events table (dropped afterwards) and prints the result, see the bench
+// package.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/bench"
+	"github.com/luno/reflex/rcli"
+	"github.com/luno/reflex/reflexpb"
+	"github.com/luno/reflex/rsql"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "tail":
+		err = tail(os.Args[2:])
+	case "cursors":
+		err = cursors(os.Args[2:])
+	case "bench":
+		err = loadBench(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reflex %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: reflex tail|cursors|bench [flags]")
+	os.Exit(2)
+}
+
+func tail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	var (
+		dsn           = fs.String("db", "", "MySQL DSN (with parseTime=true) of the events table")
+		table         = fs.String("table", "events", "events table name")
+		metadataField = fs.String("metadata_field", "", "events table metadata field")
+		addr          = fs.String("grpc", "", "reflex gRPC server address instead of -db")
+		streamName    = fs.String("stream", "", "multiplexed stream name of the gRPC server")
+		after         = fs.String("after", "", "cursor to stream after")
+		fromHead      = fs.Bool("from_head", false, "stream from the current head")
+		toHead        = fs.Bool("to_head", false, "stop at the current head")
+		types         = fs.String("types", "", "comma separated event types to stream")
+		prefix        = fs.String("prefix", "", "foreign ID prefix of events to stream")
+		format        = fs.String("format", "raw", "metadata format: raw, json or proto")
+		protoSet      = fs.String("proto_set", "", "protobuf descriptor set file for -format=proto")
+		protoMessage  = fs.String("proto_message", "", "fully qualified message for -format=proto")
+	)
+	fs.Parse(args)
+
+	ctx := context.Background()
+
+	var stream reflex.StreamFunc
+	if *addr != "" {
+		conn, err := grpc.Dial(*addr, grpc.WithInsecure())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		cl := reflexpb.NewReflexClient(conn)
+		if *streamName != "" {
+			mcpb, err := cl.Multiplex(ctx)
+			if err != nil {
+				return err
+			}
+			stream = reflex.NewMultiplexer(mcpb).StreamFunc(*streamName)
+		} else {
+			stream = reflex.WrapStreamPB(func(ctx context.Context,
+				req *reflexpb.StreamRequest) (reflex.StreamClientPB, error) {
+				return cl.Stream(ctx, req)
+			})
+		}
+	} else {
+		dbc, err := sql.Open("mysql", *dsn)
+		if err != nil {
+			return err
+		}
+		defer dbc.Close()
+
+		stream = rsql.NewEventsTable(*table,
+			rsql.WithEventMetadataField(*metadataField)).ToStream(dbc)
+	}
+
+	var opts []reflex.StreamOption
+	if *fromHead {
+		opts = append(opts, reflex.WithStreamFromHead())
+	}
+	if *toHead {
+		opts = append(opts, reflex.WithStreamToHead())
+	}
+	if *types != "" {
+		tl, err := parseTypes(*types)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, reflex.WithStreamTypes(tl...))
+	}
+	if *prefix != "" {
+		opts = append(opts, reflex.WithStreamForeignIDPrefix(*prefix))
+	}
+
+	formatter, err := makeFormatter(*format, *protoSet, *protoMessage)
+	if err != nil {
+		return err
+	}
+
+	return rcli.Tail(ctx, os.Stdout, stream, *after,
+		rcli.WithTailFormatter(formatter),
+		rcli.WithTailStreamOptions(opts...))
+}
+
+func cursors(args []string) error {
+	fs := flag.NewFlagSet("cursors", flag.ExitOnError)
+	var (
+		dsn       = fs.String("db", "", "MySQL DSN (with parseTime=true) of the cursors table")
+		table     = fs.String("table", "cursors", "cursors table name")
+		consumers = fs.String("consumer", "", "comma separated consumer names")
+		reset     = fs.String("reset", "", "cursor to reset the consumer to")
+	)
+	fs.Parse(args)
+
+	if *consumers == "" {
+		return errors.New("missing -consumer")
+	}
+
+	dbc, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		return err
+	}
+	defer dbc.Close()
+
+	ctx := context.Background()
+	store := rsql.NewCursorsTable(*table, rsql.WithCursorAsyncDisabled()).ToStore(dbc)
+	names := strings.Split(*consumers, ",")
+
+	if *reset != "" {
+		if len(names) != 1 {
+			return errors.New("reset requires a single -consumer")
+		}
+		if err := rcli.ResetCursor(ctx, store, names[0], *reset); err != nil {
+			return err
+		}
+	}
+
+	return rcli.ShowCursors(ctx, os.Stdout, store, names...)
+}
+
+func loadBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	var (
+		dsn       = fs.String("db", "", "MySQL DSN (with parseTime=true) of the benchmark database")
+		table     = fs.String("table", "bench_events", "events table name to create and drop")
+		rate      = fs.Int("rate", 1000, "events inserted per second, 0 for unlimited")
+		batch     = fs.Int("batch", 1, "events inserted per transaction")
+		payload   = fs.Int("payload", 0, "event metadata size in bytes")
+		consumers = fs.Int("consumers", 1, "number of concurrent consumers")
+		duration  = fs.Duration("duration", 10*time.Second, "duration of inserting events")
+		notifier  = fs.Bool("notifier", true, "enable the in-memory events notifier")
+		noCache   = fs.Bool("no_cache", false, "disable the read-through cache")
+		prefetch  = fs.Bool("prefetch", false, "enable stream prefetching")
+		pool      = fs.Bool("pool", false, "enable event pooling")
+	)
+	fs.Parse(args)
+
+	dbc, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		return err
+	}
+	defer dbc.Close()
+
+	ctx := context.Background()
+	if err := bench.CreateTable(ctx, dbc, *table); err != nil {
+		return err
+	}
+	defer bench.DropTable(ctx, dbc, *table)
+
+	var opts []rsql.EventsOption
+	if *notifier {
+		opts = append(opts, rsql.WithEventsInMemNotifier())
+	}
+	if *noCache {
+		opts = append(opts, rsql.WithoutEventsCache())
+	}
+	if *prefetch {
+		opts = append(opts, rsql.WithEventsPrefetch())
+	}
+	if *pool {
+		opts = append(opts, rsql.WithEventsPool())
+	}
+
+	res, err := bench.Run(ctx, dbc, rsql.NewEventsTable(*table, opts...),
+		bench.WithInsertRate(*rate),
+		bench.WithBatchSize(*batch),
+		bench.WithPayloadSize(*payload),
+		bench.WithConsumers(*consumers),
+		bench.WithDuration(*duration))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(res)
+	return nil
+}
+
+func makeFormatter(format, setFile, message string) (rcli.Formatter, error) {
+	switch format {
+	case "raw":
+		return rcli.FormatRaw, nil
+	case "json":
+		return rcli.FormatJSON, nil
+	case "proto":
+		b, err := ioutil.ReadFile(setFile)
+		if err != nil {
+			return nil, err
+		}
+
+		var set descpb.FileDescriptorSet
+		if err := proto.Unmarshal(b, &set); err != nil {
+			return nil, err
+		}
+
+		return rcli.NewProtoFormatter(&set, message)
+	}
+	return nil, errors.New("unknown format", j.KS("format", format))
+}
+
+type eventType int
+
+func (t eventType) ReflexType() int {
+	return int(t)
+}
+
+func parseTypes(s string) ([]reflex.EventType, error) {
+	var res []reflex.EventType
+	for _, t := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(t))
+		if err != nil {
+			return nil, errors.New("invalid type", j.KS("type", t))
+		}
+		res = append(res, eventType(i))
+	}
+	return res, nil
+}
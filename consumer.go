@@ -5,23 +5,61 @@ import (
 	"time"
 
 	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 const defaultLagAlert = 30 * time.Minute
 const defaultActivityTTL = 24 * time.Hour
+const defaultRetryBackoff = 100 * time.Millisecond
+const defaultMaxRetryBackoff = 10 * time.Second
+
+// ErrorAction defines how a consumer handles an error returned by its
+// consume function.
+type ErrorAction int
+
+const (
+	// ErrorActionFail returns the error which stops the stream. This is the
+	// default behaviour.
+	ErrorActionFail ErrorAction = 0
+
+	// ErrorActionRetry consumes the event again after a backoff,
+	// see WithRetryBackoff.
+	ErrorActionRetry ErrorAction = 1
+
+	// ErrorActionSkip logs the error and skips the event, allowing the
+	// stream to continue to the next event.
+	ErrorActionSkip ErrorAction = 2
+)
+
+// ErrorPolicy returns the action to take when the consume function
+// returns err for event e.
+type ErrorPolicy func(err error, e *Event) ErrorAction
 
 type consumer struct {
 	fn          func(context.Context, fate.Fate, *Event) error
 	name        string
 	lagAlert    time.Duration
 	activityTTL time.Duration
+	errPolicy   ErrorPolicy
+	newMetrics  func(consumerName string, types []EventType) Metrics
+	metricTypes []EventType
+	timeout     time.Duration
+
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	clock           Clock
+
+	retries        int
+	retriesBackoff time.Duration
 
-	lagGauge      prometheus.Gauge
 	lagAlertGauge prometheus.Gauge
-	errorCounter  prometheus.Counter
-	latencyHist   prometheus.Observer
-	activityKey   string
+	metrics       Metrics
+
+	slo        *slo
+	sloTracker *sloTracker
 }
 
 type ConsumerOption func(*consumer)
@@ -58,6 +96,15 @@ func WithConsumerActivityTTL(ttl time.Duration) ConsumerOption {
 	}
 }
 
+// WithConsumerClock provides an option to set the clock used for the consumer
+// lag, activity ttl and retry backoff, e.g. a fake clock in tests.
+// It defaults to the real clock.
+func WithConsumerClock(clock Clock) ConsumerOption {
+	return func(c *consumer) {
+		c.clock = clock
+	}
+}
+
 // WithoutConsumerActivityTTL provides an option to disable the consumer activity metric ttl.
 func WithoutConsumerActivityTTL() ConsumerOption {
 	return func(c *consumer) {
@@ -65,6 +112,73 @@ func WithoutConsumerActivityTTL() ConsumerOption {
 	}
 }
 
+// WithErrorPolicy provides an option to configure how the consumer handles
+// errors returned by its consume function. This allows skipping poison
+// events instead of blocking the stream forever. Errors are always returned
+// by default.
+func WithErrorPolicy(p ErrorPolicy) ConsumerOption {
+	return func(c *consumer) {
+		c.errPolicy = p
+	}
+}
+
+// WithConsumeTimeout provides an option to set a deadline on the context of
+// each consume function invocation. This prevents a single hung downstream
+// call from stalling the stream indefinitely. The resulting error is subject
+// to the error policy.
+func WithConsumeTimeout(d time.Duration) ConsumerOption {
+	return func(c *consumer) {
+		c.timeout = d
+	}
+}
+
+// WithRetryBackoff provides an option to set the backoff between retries of
+// events with ErrorActionRetry. The backoff starts at min and doubles
+// after each retry up to max. It defaults to 100ms up to 10s. A non-positive
+// min disables the backoff.
+func WithRetryBackoff(min, max time.Duration) ConsumerOption {
+	return func(c *consumer) {
+		c.retryBackoff = min
+		c.maxRetryBackoff = max
+	}
+}
+
+// WithRetry provides an option to retry events n times if the consume
+// function returns an error before applying the error policy or returning
+// the error. This avoids restarting the stream on transient errors, which
+// re-fetches and re-consumes events after the cursor. The backoff between
+// retries starts at the provided backoff and doubles after each retry up
+// to the max of WithRetryBackoff. Errors are not retried if the context
+// is canceled.
+func WithRetry(n int, backoff time.Duration) ConsumerOption {
+	return func(c *consumer) {
+		c.retries = n
+		c.retriesBackoff = backoff
+	}
+}
+
+// WithConsumerMetrics provides an option to replace the default prometheus
+// consumer metrics with another backend. The function is called once with
+// the consumer name and the event types of WithTypeMetricLabels, which
+// should be labeled using TypeMetricLabel.
+func WithConsumerMetrics(fn func(consumerName string, types []EventType) Metrics) ConsumerOption {
+	return func(c *consumer) {
+		c.newMetrics = fn
+	}
+}
+
+// WithTypeMetricLabels provides an option to also label the consumer latency,
+// error, events and lag metrics by event type. Only the provided event types are
+// labeled individually, all others are labeled as "other", bounding the
+// metric cardinality. The types are labeled by their String value if they
+// implement fmt.Stringer, otherwise by their ReflexType. The types are also
+// provided to custom metrics, see WithConsumerMetrics.
+func WithTypeMetricLabels(types ...EventType) ConsumerOption {
+	return func(c *consumer) {
+		c.metricTypes = types
+	}
+}
+
 // NewConsumer returns a new instrumented consumer of events.
 func NewConsumer(name string, fn func(context.Context, fate.Fate, *Event) error,
 	opts ...ConsumerOption) Consumer {
@@ -72,21 +186,32 @@ func NewConsumer(name string, fn func(context.Context, fate.Fate, *Event) error,
 	labels := prometheus.Labels{consumerLabel: name}
 
 	c := &consumer{
-		fn:            fn,
-		name:          name,
-		lagAlert:      defaultLagAlert,
-		activityTTL:   defaultActivityTTL,
-		lagGauge:      consumerLag.With(labels),
-		lagAlertGauge: consumerLagAlert.With(labels),
-		errorCounter:  consumerErrors.With(labels),
-		latencyHist:   consumerLatency.With(labels),
+		fn:          fn,
+		name:        name,
+		lagAlert:    defaultLagAlert,
+		activityTTL: defaultActivityTTL,
+
+		retryBackoff:    defaultRetryBackoff,
+		maxRetryBackoff: defaultMaxRetryBackoff,
+		clock:           realClock{},
 	}
 
 	for _, o := range opts {
 		o(c)
 	}
 
-	c.activityKey = consumerActivityGauge.Register(labels, c.activityTTL)
+	if c.newMetrics != nil {
+		c.metrics = c.newMetrics(name, c.metricTypes)
+	} else {
+		if c.lagAlertGauge == nil {
+			c.lagAlertGauge = consumerLagAlert.With(labels)
+		}
+		c.metrics = newPromMetrics(labels, c.lagAlertGauge, c.activityTTL, c.clock, c.metricTypes)
+	}
+
+	if c.slo != nil {
+		c.sloTracker = slos.Register(name, *c.slo)
+	}
 
 	return c
 }
@@ -97,26 +222,137 @@ func (c *consumer) Name() string {
 
 func (c *consumer) Consume(ctx context.Context, fate fate.Fate,
 	event *Event) error {
-	t0 := time.Now()
+	return c.consumeEvent(ctx, fate, event, false)
+}
 
-	consumerActivityGauge.SetActive(c.activityKey)
+// consumeEvent consumes the event updating the consumer metrics. If recoverPanics
+// is true, panics in the consume function are returned as ErrPanic errors
+// to which the error policy is applied.
+func (c *consumer) consumeEvent(ctx context.Context, fate fate.Fate,
+	event *Event, recoverPanics bool) error {
+	t0 := c.clock.Now()
 
-	lag := t0.Sub(event.Timestamp)
-	c.lagGauge.Set(lag.Seconds())
+	c.metrics.ActivitySet()
 
-	alert := 0.0
-	if lag > c.lagAlert && c.lagAlert > 0 {
-		alert = 1
-	}
-	c.lagAlertGauge.Set(alert)
+	c.updateLag(event, t0)
 
-	err := c.fn(ctx, fate, event)
-	if err != nil {
-		c.errorCounter.Inc()
+	consumed, err := c.consume(ctx, fate, event, recoverPanics)
+
+	latency := c.clock.Now().Sub(t0)
+	c.metrics.ConsumeObserved(event, latency)
+	if consumed {
+		c.metrics.EventsInced(event)
 	}
 
-	latency := time.Since(t0)
-	c.latencyHist.Observe(latency.Seconds())
+	if c.sloTracker != nil {
+		c.sloTracker.Observe(latency, t0.Sub(event.Timestamp))
+	}
 
 	return err
 }
+
+// updateLag sets the consumer lag metrics for the event at time now.
+func (c *consumer) updateLag(e *Event, now time.Time) {
+	lag := now.Sub(e.Timestamp)
+	c.metrics.LagSet(e, lag, lag > c.lagAlert && c.lagAlert > 0)
+}
+
+// call calls the consume function once with the consume timeout if configured.
+func (c *consumer) call(ctx context.Context, f fate.Fate, e *Event,
+	recoverPanics bool) error {
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	if !recoverPanics {
+		return c.fn(ctx, f, e)
+	}
+
+	return recoverPanic(func() error {
+		return c.fn(ctx, f, e)
+	})
+}
+
+// consume calls the consume function and applies the error policy to any
+// errors. It returns true if the consume function succeeded, i.e. the event
+// was consumed and not skipped.
+func (c *consumer) consume(ctx context.Context, f fate.Fate, e *Event,
+	recoverPanics bool) (bool, error) {
+
+	var (
+		backoff = c.retryBackoff
+		retries int
+		delay   = c.retriesBackoff
+	)
+	for {
+		err := c.call(ctx, f, e, recoverPanics)
+		if err == nil {
+			return true, nil
+		}
+
+		c.metrics.ErrorInced(e)
+
+		if retries < c.retries && ctx.Err() == nil {
+			retries++
+			if !c.wait(ctx, delay) {
+				return false, err
+			}
+			delay = c.nextBackoff(delay)
+			continue
+		}
+
+		if c.errPolicy == nil {
+			return false, err
+		}
+
+		switch c.errPolicy(err, e) {
+		case ErrorActionSkip:
+			log.Error(ctx, errors.Wrap(err, "consumer skipping event"),
+				j.MKS{"consumer": c.name, "event_id": e.ID})
+			return false, nil
+		case ErrorActionRetry:
+			if ctx.Err() != nil {
+				return false, err
+			}
+
+			if backoff <= 0 {
+				continue
+			}
+
+			if !c.wait(ctx, backoff) {
+				return false, err
+			}
+			backoff = c.nextBackoff(backoff)
+			continue
+		default:
+			return false, err
+		}
+	}
+}
+
+// wait blocks for the duration and returns true or
+// false if the context is canceled.
+func (c *consumer) wait(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-c.clock.After(d):
+		return true
+	}
+}
+
+// nextBackoff returns the doubled backoff up to the max retry backoff.
+func (c *consumer) nextBackoff(d time.Duration) time.Duration {
+	d *= 2
+	if d > c.maxRetryBackoff {
+		d = c.maxRetryBackoff
+	}
+	return d
+}
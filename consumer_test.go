@@ -0,0 +1,294 @@
+package reflex
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorPolicy(t *testing.T) {
+	errTest := errors.New("test error")
+
+	tests := []struct {
+		name    string
+		action  ErrorAction
+		fails   int
+		calls   int
+		wantErr error
+	}{
+		{
+			name:    "fail",
+			action:  ErrorActionFail,
+			fails:   1,
+			calls:   1,
+			wantErr: errTest,
+		}, {
+			name:   "skip",
+			action: ErrorActionSkip,
+			fails:  1,
+			calls:  1,
+		}, {
+			name:   "retry",
+			action: ErrorActionRetry,
+			fails:  3,
+			calls:  4,
+		}, {
+			name:   "no error",
+			action: ErrorActionFail,
+			calls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls, policies int
+			fn := func(ctx context.Context, f fate.Fate, e *Event) error {
+				calls++
+				if calls <= tt.fails {
+					return errTest
+				}
+				return nil
+			}
+
+			c := NewConsumer("test_"+tt.name, fn, WithErrorPolicy(
+				func(err error, e *Event) ErrorAction {
+					jtest.Require(t, errTest, err)
+					require.Equal(t, "1", e.ID)
+					policies++
+					return tt.action
+				}), WithRetryBackoff(time.Millisecond, time.Millisecond))
+
+			err := c.Consume(context.Background(), fate.New(), &Event{ID: "1"})
+			jtest.Require(t, tt.wantErr, err)
+			require.Equal(t, tt.calls, calls)
+			require.Equal(t, tt.fails, policies)
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	errTest := errors.New("test error")
+
+	var calls []time.Time
+	c := NewConsumer("test_retry_backoff", func(ctx context.Context, f fate.Fate, e *Event) error {
+		calls = append(calls, time.Now())
+		if len(calls) <= 3 {
+			return errTest
+		}
+		return nil
+	}, WithErrorPolicy(func(err error, e *Event) ErrorAction {
+		return ErrorActionRetry
+	}), WithRetryBackoff(time.Millisecond*10, time.Millisecond*20))
+
+	err := c.Consume(context.Background(), fate.New(), &Event{ID: "1"})
+	jtest.RequireNil(t, err)
+	require.Len(t, calls, 4)
+
+	for i, min := range []time.Duration{10, 20, 20} {
+		require.True(t, calls[i+1].Sub(calls[i]) >= min*time.Millisecond)
+	}
+}
+
+func TestRetryBackoffCancel(t *testing.T) {
+	errTest := errors.New("test error")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*10, cancel)
+
+	var calls int
+	c := NewConsumer("test_retry_cancel", func(ctx context.Context, f fate.Fate, e *Event) error {
+		calls++
+		return errTest
+	}, WithErrorPolicy(func(err error, e *Event) ErrorAction {
+		return ErrorActionRetry
+	}), WithRetryBackoff(time.Hour, time.Hour))
+
+	err := c.Consume(ctx, fate.New(), &Event{ID: "1"})
+	jtest.Require(t, errTest, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestWithRetry(t *testing.T) {
+	errTest := errors.New("test error")
+
+	var calls []time.Time
+	var skipped bool
+	c := NewConsumer("test_with_retry", func(ctx context.Context, f fate.Fate, e *Event) error {
+		calls = append(calls, time.Now())
+		if e.ID == "1" && len(calls) <= 2 {
+			return errTest
+		}
+		if e.ID == "2" {
+			return errTest
+		}
+		return nil
+	}, WithRetry(2, time.Millisecond*10), WithRetryBackoff(0, time.Millisecond*15),
+		WithErrorPolicy(func(err error, e *Event) ErrorAction {
+			skipped = true
+			return ErrorActionSkip
+		}))
+
+	// Succeeds within the retries.
+	err := c.Consume(context.Background(), fate.New(), &Event{ID: "1"})
+	jtest.RequireNil(t, err)
+	require.Len(t, calls, 3)
+	require.False(t, skipped)
+	for i, min := range []time.Duration{10, 15} {
+		require.True(t, calls[i+1].Sub(calls[i]) >= min*time.Millisecond)
+	}
+
+	// The error policy is applied once the retries are exhausted.
+	calls = nil
+	err = c.Consume(context.Background(), fate.New(), &Event{ID: "2"})
+	jtest.RequireNil(t, err)
+	require.Len(t, calls, 3)
+	require.True(t, skipped)
+}
+
+func TestConsumeTimeout(t *testing.T) {
+	var calls int
+	c := NewConsumer("test", func(ctx context.Context, f fate.Fate, e *Event) error {
+		calls++
+		if calls == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		_, ok := ctx.Deadline()
+		require.True(t, ok)
+		return nil
+	}, WithConsumeTimeout(time.Millisecond), WithErrorPolicy(func(err error, e *Event) ErrorAction {
+		jtest.Require(t, context.DeadlineExceeded, err)
+		return ErrorActionRetry
+	}))
+
+	err := c.Consume(context.Background(), fate.New(), &Event{ID: "1"})
+	jtest.RequireNil(t, err)
+	require.Equal(t, 2, calls)
+}
+
+func TestConsumerMetrics(t *testing.T) {
+	errTest := errors.New("test error")
+
+	m := new(mockMetrics)
+	c := NewConsumer("test_metrics", func(ctx context.Context, f fate.Fate, e *Event) error {
+		if e.ID == "2" {
+			return errTest
+		}
+		return nil
+	}, WithConsumerMetrics(func(name string, types []EventType) Metrics {
+		require.Equal(t, "test_metrics", name)
+		require.Equal(t, []EventType{eventType(1)}, types)
+		return m
+	}), WithConsumerLagAlert(time.Hour), WithTypeMetricLabels(eventType(1)))
+
+	t0 := time.Now()
+	err := c.Consume(context.Background(), fate.New(), &Event{ID: "1", Timestamp: t0})
+	jtest.RequireNil(t, err)
+
+	err = c.Consume(context.Background(), fate.New(), &Event{ID: "2", Timestamp: t0.Add(-time.Hour * 2)})
+	jtest.Require(t, errTest, err)
+
+	require.Equal(t, 2, m.observed)
+	require.Equal(t, 1, m.errors)
+	require.Equal(t, 1, m.events)
+	require.Equal(t, []bool{false, true}, m.alerts)
+	require.Equal(t, 2, m.active)
+
+	// The prometheus lag alert gauge is not registered.
+	require.False(t, consumerLagAlert.DeleteLabelValues("test_metrics"))
+}
+
+func TestTypeMetricLabels(t *testing.T) {
+	errTest := errors.New("test error")
+
+	c := NewConsumer("test_type_metrics", func(ctx context.Context, f fate.Fate, e *Event) error {
+		return errTest
+	}, WithTypeMetricLabels(eventType(1)))
+
+	for i := 1; i <= 3; i++ {
+		err := c.Consume(context.Background(), fate.New(), &Event{ID: "1", Type: eventType(i)})
+		jtest.Require(t, errTest, err)
+	}
+
+	require.Equal(t, 1.0, testutil.ToFloat64(consumerTypeErrors.WithLabelValues("test_type_metrics", "1")))
+	require.Equal(t, 2.0, testutil.ToFloat64(consumerTypeErrors.WithLabelValues("test_type_metrics", otherTypeLabel)))
+	require.Equal(t, 3.0, testutil.ToFloat64(consumerErrors.WithLabelValues("test_type_metrics")))
+}
+
+func TestEventsMetric(t *testing.T) {
+	errTest := errors.New("test error")
+
+	errSkip := errors.New("skip error")
+
+	c := NewConsumer("test_events_metric", func(ctx context.Context, f fate.Fate, e *Event) error {
+		switch e.ID {
+		case "4":
+			return errTest
+		case "5":
+			return errSkip
+		}
+		return nil
+	}, WithTypeMetricLabels(eventType(1)), WithErrorPolicy(func(err error, e *Event) ErrorAction {
+		if errors.Is(err, errSkip) {
+			return ErrorActionSkip
+		}
+		return ErrorActionFail
+	}))
+
+	// Failed and skipped events are not counted.
+	for i := 1; i <= 5; i++ {
+		err := c.Consume(context.Background(), fate.New(), &Event{ID: strconv.Itoa(i), Type: eventType(i)})
+		if i == 4 {
+			jtest.Require(t, errTest, err)
+		} else {
+			jtest.RequireNil(t, err)
+		}
+	}
+
+	require.Equal(t, 3.0, testutil.ToFloat64(consumerEvents.WithLabelValues("test_events_metric")))
+	require.Equal(t, 1.0, testutil.ToFloat64(consumerTypeEvents.WithLabelValues("test_events_metric", "1")))
+	require.Equal(t, 2.0, testutil.ToFloat64(consumerTypeEvents.WithLabelValues("test_events_metric", otherTypeLabel)))
+}
+
+func TestTypeMetricLabel(t *testing.T) {
+	types := []EventType{eventType(1), eventType(2)}
+	require.Equal(t, "1", TypeMetricLabel(types, &Event{Type: eventType(1)}))
+	require.Equal(t, "2", TypeMetricLabel(types, &Event{Type: eventType(2)}))
+	require.Equal(t, otherTypeLabel, TypeMetricLabel(types, &Event{Type: eventType(3)}))
+	require.Equal(t, otherTypeLabel, TypeMetricLabel(nil, &Event{Type: eventType(1)}))
+}
+
+type mockMetrics struct {
+	observed int
+	errors   int
+	events   int
+	alerts   []bool
+	active   int
+}
+
+func (m *mockMetrics) ConsumeObserved(_ *Event, _ time.Duration) {
+	m.observed++
+}
+
+func (m *mockMetrics) ErrorInced(_ *Event) {
+	m.errors++
+}
+
+func (m *mockMetrics) EventsInced(_ *Event) {
+	m.events++
+}
+
+func (m *mockMetrics) LagSet(_ *Event, _ time.Duration, alert bool) {
+	m.alerts = append(m.alerts, alert)
+}
+
+func (m *mockMetrics) ActivitySet() {
+	m.active++
+}
@@ -11,6 +11,40 @@ import (
 var (
 	ErrStopped     = errors.New("the event stream has been stopped", j.C("ERR_09290f5944cb8671"))
 	ErrHeadReached = errors.New("the event stream has reached the current head", j.C("ERR_b4b155d2a91cfcd0"))
+
+	// ErrPanic is returned by Run when a consumer panics, see WithoutRunPanicRecovery.
+	ErrPanic = errors.New("consumer panic recovered", j.C("ERR_71c4e8a2d90b3f56"))
+
+	// ErrStateConflict is returned by StateStore when the stored version
+	// doesn't match, i.e. the state was concurrently modified.
+	ErrStateConflict = errors.New("state version conflict", j.C("ERR_5a7d03e9f1b2c684"))
+
+	// ErrConsumerActive is returned by Replay if the consumer is still active.
+	ErrConsumerActive = errors.New("consumer still active", j.C("ERR_3f1a9c0be2d54e87"))
+
+	// ErrConsumerActivityUnknown is returned by Replay if it cannot confirm
+	// that the consumer is stopped, see WithReplayActiveFunc.
+	ErrConsumerActivityUnknown = errors.New("consumer activity unknown", j.C("ERR_6e9b2d47c1a0f835"))
+
+	// ErrResetNotSupported is returned by Replay if the cursor store
+	// doesn't implement CursorResetter.
+	ErrResetNotSupported = errors.New("cursor store does not support reset", j.C("ERR_8d27e6b5a0c14f39"))
+
+	// ErrReplayCursorNotFound is returned by Replay if no event is found
+	// at or after the replay from time.
+	ErrReplayCursorNotFound = errors.New("no event found to replay from", j.C("ERR_c5b04e1d7a92f863"))
+
+	// ErrCursorFenced is returned by fenced cursor stores if the cursor was
+	// fenced by a later epoch, i.e. another Run of the same consumer started.
+	ErrCursorFenced = errors.New("cursor fenced by a later epoch", j.C("ERR_a0f63d8e2b5c1947"))
+
+	// ErrInvalidForeignID is returned when an event's foreign id
+	// cannot be parsed as the required type, e.g. an integer or UUID.
+	ErrInvalidForeignID = errors.New("invalid foreign id", j.C("ERR_7b3e90c4d15fa826"))
+
+	// ErrHeartbeatTimeout is returned by gRPC streams if no events or
+	// heartbeats are received in time, see WithStreamHeartbeat.
+	ErrHeartbeatTimeout = errors.New("stream heartbeat timeout", j.C("ERR_d4a81f6c3e09b275"))
 )
 
 func IsStoppedErr(err error) bool {
@@ -0,0 +1,165 @@
+package reflex
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/log"
+)
+
+const (
+	defaultFailoverAttempts = 3
+	defaultFailoverBackoff  = time.Millisecond * 100
+)
+
+// FailoverOption defines a functional option to configure NewFailoverStream.
+type FailoverOption func(*failoverOptions)
+
+type failoverOptions struct {
+	attempts int
+	backoff  time.Duration
+}
+
+// WithFailoverAttempts provides an option to set the number of consecutive
+// failovers without receiving an event before returning the error, backing
+// off linearly between attempts. It defaults to 3 attempts with a 100ms
+// backoff.
+func WithFailoverAttempts(attempts int, backoff time.Duration) FailoverOption {
+	return func(o *failoverOptions) {
+		o.attempts = attempts
+		o.backoff = backoff
+	}
+}
+
+// NewFailoverStream returns a stream func that balances streams across the
+// stream funcs of multiple servers, e.g. a WrapStreamPB per gRPC server
+// connection. Each stream starts on the next server in round-robin order.
+// If a stream breaks, it fails over to the next server and continues
+// after the last received event, so consumers don't see the failure.
+//
+// Streams fail over on all errors except context errors and ErrHeadReached,
+// see WithFailoverAttempts. Descending streams only fail over before
+// receiving the first event.
+//
+// Note that a single gRPC connection with a resolver and a balancing policy
+// (e.g. "dns:///" with round_robin) also balances streams across servers,
+// wrap it in NewFailoverStream to fail over broken streams.
+func NewFailoverStream(streams []StreamFunc, opts ...FailoverOption) StreamFunc {
+	o := failoverOptions{
+		attempts: defaultFailoverAttempts,
+		backoff:  defaultFailoverBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var next uint64
+	return func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		if len(streams) == 0 {
+			return nil, errors.New("no failover streams")
+		}
+
+		s := &failoverStream{
+			ctx:     ctx,
+			streams: streams,
+			o:       o,
+			idx:     int((atomic.AddUint64(&next, 1) - 1) % uint64(len(streams))),
+			after:   after,
+			opts:    append([]StreamOption(nil), opts...),
+		}
+		for _, opt := range opts {
+			opt(&s.resolved)
+		}
+
+		if err := s.connect(nil); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+}
+
+type failoverStream struct {
+	ctx      context.Context
+	streams  []StreamFunc
+	o        failoverOptions
+	idx      int
+	after    string
+	opts     []StreamOption
+	resolved StreamOptions
+
+	sc       StreamClient
+	received bool
+	attempts int
+}
+
+// Recv returns the next event of the current server's stream, failing over
+// to the next server if it breaks.
+func (s *failoverStream) Recv() (*Event, error) {
+	for {
+		e, err := s.sc.Recv()
+		if err == nil {
+			if !s.received {
+				// Continue after the last event instead of from
+				// the initial position.
+				s.received = true
+				s.opts = append(s.opts, withoutStreamFrom)
+			}
+			s.after = e.ID
+			s.attempts = 0
+			return e, nil
+		}
+
+		if err := s.connect(err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// connect opens a stream on the current server. If the previous stream
+// failed with err, it fails over to the next server first.
+func (s *failoverStream) connect(err error) error {
+	for {
+		if err != nil {
+			if !s.canFailover(err) {
+				return err
+			}
+
+			s.attempts++
+			log.Error(s.ctx, errors.Wrap(err, "stream failover"))
+			streamFailoverCounter.Inc()
+
+			t := time.NewTimer(s.o.backoff * time.Duration(s.attempts))
+			select {
+			case <-s.ctx.Done():
+				t.Stop()
+				return s.ctx.Err()
+			case <-t.C:
+			}
+
+			s.idx = (s.idx + 1) % len(s.streams)
+		}
+
+		s.sc, err = s.streams[s.idx](s.ctx, s.after, s.opts...)
+		if err == nil {
+			return nil
+		}
+	}
+}
+
+func (s *failoverStream) canFailover(err error) bool {
+	if s.ctx.Err() != nil || IsHeadReachedErr(err) {
+		return false
+	} else if s.received && s.resolved.StreamDescending {
+		return false
+	}
+	return s.attempts < s.o.attempts
+}
+
+// withoutStreamFrom clears the initial stream position options
+// when resuming after the last received event.
+func withoutStreamFrom(so *StreamOptions) {
+	so.StreamFromHead = false
+	so.StreamFromTime = time.Time{}
+}
@@ -0,0 +1,103 @@
+package reflex_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+// breakingServer streams the table but breaks each stream after n events.
+type breakingServer struct {
+	table   *rtest.EventsTable
+	n       int
+	streams int
+	afters  []string
+}
+
+func (s *breakingServer) Stream(ctx context.Context, after string,
+	opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+
+	s.streams++
+	s.afters = append(s.afters, after)
+	sc, err := s.table.Stream(ctx, after, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &breakingClient{StreamClient: sc, n: s.n}, nil
+}
+
+type breakingClient struct {
+	reflex.StreamClient
+	n int
+}
+
+func (c *breakingClient) Recv() (*reflex.Event, error) {
+	if c.n == 0 {
+		return nil, errors.New("connection reset")
+	}
+	c.n--
+	return c.StreamClient.Recv()
+}
+
+func TestFailoverStream(t *testing.T) {
+	table := rtest.NewEventsTable()
+	for i := 1; i <= 10; i++ {
+		table.Insert(strconv.Itoa(i), TestEventType(1))
+	}
+
+	s1 := &breakingServer{table: table, n: 3}
+	s2 := &breakingServer{table: table, n: 2}
+	stream := reflex.NewFailoverStream([]reflex.StreamFunc{s1.Stream, s2.Stream},
+		reflex.WithFailoverAttempts(3, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sc, err := stream(ctx, "", reflex.WithStreamToHead())
+	jtest.RequireNil(t, err)
+
+	var ids []string
+	for {
+		e, err := sc.Recv()
+		if reflex.IsHeadReachedErr(err) {
+			break
+		}
+		jtest.RequireNil(t, err)
+		ids = append(ids, e.ID)
+	}
+	require.Equal(t, []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}, ids)
+	require.Equal(t, []string{"", "5", "10"}, s1.afters)
+	require.Equal(t, []string{"3", "8"}, s2.afters)
+
+	// The next stream starts on the second server.
+	_, err = stream(ctx, "10")
+	jtest.RequireNil(t, err)
+	require.Equal(t, 3, s2.streams)
+}
+
+func TestFailoverStreamAttempts(t *testing.T) {
+	table := rtest.NewEventsTable()
+	table.Insert("1", TestEventType(1))
+
+	s1 := &breakingServer{table: table}
+	s2 := &breakingServer{table: table}
+	stream := reflex.NewFailoverStream([]reflex.StreamFunc{s1.Stream, s2.Stream},
+		reflex.WithFailoverAttempts(2, 0))
+
+	sc, err := stream(context.Background(), "")
+	jtest.RequireNil(t, err)
+
+	_, err = sc.Recv()
+	require.EqualError(t, err, "connection reset")
+	require.Equal(t, 2, s1.streams)
+	require.Equal(t, 1, s2.streams)
+
+	_, err = reflex.NewFailoverStream(nil)(context.Background(), "")
+	require.Error(t, err)
+}
@@ -13,5 +13,6 @@ require (
 	github.com/stretchr/testify v1.6.0
 	gocloud.dev v0.18.0
 	golang.org/x/net v0.0.0-20190724013045-ca1201d0de80
+	google.golang.org/genproto v0.0.0-20190620144150-6af8c5fc6601
 	google.golang.org/grpc v1.24.0
 )
@@ -0,0 +1,261 @@
+package reflex
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// NewGroup returns a new empty group of specs run with the run options.
+func NewGroup(opts ...RunOption) *Group {
+	return &Group{opts: opts}
+}
+
+// Group runs multiple specs concurrently and supports dependencies between
+// them. A spec that depends on upstream specs never reads ahead of their
+// cursors, i.e. it only consumes an event once all its upstream specs have
+// consumed it. This ensures derived consumers never read ahead of the
+// materializers they depend on.
+//
+//	g := reflex.NewGroup()
+//	g.Add(materializer)
+//	g.Add(notifier, materializer.Name())
+//	err := g.Run(ctx)
+//
+// Dependencies require specs streaming the same events with int event IDs.
+type Group struct {
+	opts  []RunOption
+	specs []groupSpec
+}
+
+type groupSpec struct {
+	spec     Spec
+	upstream []string
+}
+
+// Add adds the spec to the group which must not pass the cursors of the
+// upstream specs identified by name. It returns the group for chaining.
+func (g *Group) Add(spec Spec, upstream ...string) *Group {
+	g.specs = append(g.specs, groupSpec{spec: spec, upstream: upstream})
+	return g
+}
+
+// Run runs all the specs of the group until one of them errors or the
+// context is canceled, in which case the other specs are stopped. It
+// always returns a non-nil error.
+func (g *Group) Run(ctx context.Context) error {
+	if err := g.validate(); err != nil {
+		return err
+	}
+
+	marks := make(map[string]*watermark)
+	for _, gs := range g.specs {
+		marks[gs.spec.Name()] = newWatermark()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(g.specs))
+	for _, gs := range g.specs {
+		var upstream []*watermark
+		for _, name := range gs.upstream {
+			upstream = append(upstream, marks[name])
+		}
+
+		spec := gs.spec
+		spec.cstore = &watermarkStore{CursorStore: spec.cstore, mark: marks[spec.Name()]}
+		if len(upstream) > 0 {
+			spec.stream = watermarkStream(spec.stream, upstream)
+		}
+
+		go func() {
+			err := Run(ctx, spec, g.opts...)
+			errs <- errors.Wrap(err, "group spec error", j.KS("consumer", spec.Name()))
+		}()
+	}
+
+	err := <-errs
+	cancel()
+	for i := 1; i < len(g.specs); i++ {
+		<-errs
+	}
+
+	return err
+}
+
+// validate returns an error if the spec names are not unique or
+// the dependencies are unknown or cyclic.
+func (g *Group) validate() error {
+	deps := make(map[string][]string)
+	for _, gs := range g.specs {
+		if _, ok := deps[gs.spec.Name()]; ok {
+			return errors.New("duplicate spec in group", j.KS("consumer", gs.spec.Name()))
+		}
+		deps[gs.spec.Name()] = gs.upstream
+	}
+
+	for name, upstream := range deps {
+		for _, u := range upstream {
+			if _, ok := deps[u]; !ok {
+				return errors.New("unknown upstream spec in group",
+					j.MKV{"consumer": name, "upstream": u})
+			}
+		}
+	}
+
+	// Detect cycles with a depth first search.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return errors.New("cyclic spec dependencies in group", j.KS("consumer", name))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, u := range deps[name] {
+			if err := visit(u); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for name := range deps {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newWatermark() *watermark {
+	return &watermark{ch: make(chan struct{})}
+}
+
+// watermark is the latest cursor of a spec in a group.
+type watermark struct {
+	mu     sync.Mutex
+	cursor int64
+	ch     chan struct{} // Closed and replaced on updates.
+}
+
+func (w *watermark) Set(cursor string) {
+	i, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if i <= w.cursor {
+		return
+	}
+	w.cursor = i
+	close(w.ch)
+	w.ch = make(chan struct{})
+}
+
+// Await blocks until the watermark is at least the id or the context is canceled.
+func (w *watermark) Await(ctx context.Context, id int64) error {
+	for {
+		w.mu.Lock()
+		cursor, ch := w.cursor, w.ch
+		w.mu.Unlock()
+
+		if cursor >= id {
+			return nil
+		}
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// watermarkStore updates the watermark with the cursors of the store.
+type watermarkStore struct {
+	CursorStore
+	mark *watermark
+}
+
+func (s *watermarkStore) GetCursor(ctx context.Context, consumerName string) (string, error) {
+	cursor, err := s.CursorStore.GetCursor(ctx, consumerName)
+	if err != nil {
+		return "", err
+	}
+	s.mark.Set(cursor)
+	return cursor, nil
+}
+
+func (s *watermarkStore) SetCursor(ctx context.Context, consumerName string, cursor string) error {
+	if err := s.CursorStore.SetCursor(ctx, consumerName, cursor); err != nil {
+		return err
+	}
+	s.mark.Set(cursor)
+	return nil
+}
+
+// Fence implements CursorFencer by fencing the underlying store if supported.
+func (s *watermarkStore) Fence(ctx context.Context, consumerName string) (CursorStore, error) {
+	fencer, ok := s.CursorStore.(CursorFencer)
+	if !ok {
+		return s, nil
+	}
+
+	cs, err := fencer.Fence(ctx, consumerName)
+	if err != nil {
+		return nil, err
+	}
+	return &watermarkStore{CursorStore: cs, mark: s.mark}, nil
+}
+
+// watermarkStream returns a stream that blocks each event until
+// all the upstream watermarks reached it.
+func watermarkStream(stream StreamFunc, upstream []*watermark) StreamFunc {
+	return func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		sc, err := stream(ctx, after, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &watermarkClient{StreamClient: sc, ctx: ctx, upstream: upstream}, nil
+	}
+}
+
+type watermarkClient struct {
+	StreamClient
+	ctx      context.Context
+	upstream []*watermark
+}
+
+func (c *watermarkClient) Recv() (*Event, error) {
+	e, err := c.StreamClient.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range c.upstream {
+		if err := w.Await(c.ctx, e.IDInt()); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+func (c *watermarkClient) Close() error {
+	return closeStream(c.StreamClient)
+}
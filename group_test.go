@@ -0,0 +1,106 @@
+package reflex_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupDependencies(t *testing.T) {
+	var events []*reflex.Event
+	for i := 1; i <= 5; i++ {
+		events = append(events, &reflex.Event{ID: strconv.Itoa(i), Timestamp: time.Now()})
+	}
+	streamer := newMockStreamer(events, nil)
+	cstore := rtest.NewCursorStore()
+
+	var (
+		mu         sync.Mutex
+		upstream   int64
+		downstream []string
+	)
+
+	slow := reflex.NewConsumer("upstream", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		upstream = e.IDInt()
+		return nil
+	})
+
+	derived := reflex.NewConsumer("downstream", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		require.True(t, e.IDInt() <= upstream, "read ahead of upstream")
+		downstream = append(downstream, e.ID)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	g := reflex.NewGroup().
+		Add(reflex.NewSpec(streamer.Stream, cstore, derived), "upstream").
+		Add(reflex.NewSpec(streamer.Stream, cstore, slow))
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- g.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(downstream) == 5
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	jtest.Require(t, context.Canceled, <-errCh)
+	require.Equal(t, "5", cstore.Cursor("upstream"))
+	require.Equal(t, "5", cstore.Cursor("downstream"))
+}
+
+func TestGroupValidate(t *testing.T) {
+	stream := newMockStreamer(nil, nil).Stream
+	cstore := rtest.NewCursorStore()
+	spec := func(name string) reflex.Spec {
+		return reflex.NewSpec(stream, cstore, reflex.NewConsumer(name,
+			func(context.Context, fate.Fate, *reflex.Event) error { return nil }))
+	}
+
+	tests := []struct {
+		name string
+		g    *reflex.Group
+		err  string
+	}{
+		{
+			name: "duplicate",
+			g:    reflex.NewGroup().Add(spec("a")).Add(spec("a")),
+			err:  "duplicate spec in group",
+		}, {
+			name: "unknown",
+			g:    reflex.NewGroup().Add(spec("a"), "b"),
+			err:  "unknown upstream spec in group",
+		}, {
+			name: "cycle",
+			g:    reflex.NewGroup().Add(spec("a"), "b").Add(spec("b"), "a"),
+			err:  "cyclic spec dependencies in group",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.g.Run(context.Background())
+			require.Error(t, err)
+			require.Contains(t, err.Error(), test.err)
+		})
+	}
+}
@@ -44,3 +44,21 @@ func (cl *Client) StreamEvents(ctx context.Context, after string,
 func (cl *Client) Close() error {
 	return cl.conn.Close()
 }
+
+// Multiplexer returns a new multiplexer over a single gRPC stream
+// that is stopped when the context is cancelled.
+func (cl *Client) Multiplexer(ctx context.Context) (*reflex.Multiplexer, error) {
+	mcpb, err := cl.clpb.Multiplex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return reflex.NewMultiplexer(mcpb), nil
+}
+
+// ListStreams returns the streams of the server's registry.
+func (cl *Client) ListStreams(ctx context.Context) ([]reflex.StreamInfo, error) {
+	return reflex.WrapListStreamsPB(func(ctx context.Context,
+		req *reflexpb.ListStreamsRequest) (*reflexpb.ListStreamsResponse, error) {
+		return cl.clpb.ListStreams(ctx, req)
+	})(ctx)
+}
@@ -1,6 +1,7 @@
 package grpctest
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"testing"
@@ -15,6 +16,10 @@ import (
 	"google.golang.org/grpc"
 )
 
+// DefaultStream is the name of the stream provided to NewServer
+// in the server's registry.
+const DefaultStream = "default"
+
 // NewServer starts and returns a reflex server and its address.
 func NewServer(_ testing.TB, stream reflex.StreamFunc,
 	cstore reflex.CursorStore) (*Server, string) {
@@ -29,12 +34,14 @@ func NewServer(_ testing.TB, stream reflex.StreamFunc,
 
 	srv := &Server{
 		stream:      stream,
+		registry:    reflex.NewStreamRegistry(),
 		cstore:      cstore,
 		grpcServer:  grpcServer,
 		rserver:     reflex.NewServer(),
 		sentCounter: prometheus.NewCounter(prometheus.CounterOpts{Name: "sent_total"}),
 	}
 
+	srv.registry.Register(DefaultStream, stream, nil)
 	reflexpb.RegisterReflexServer(grpcServer, srv)
 
 	go func() {
@@ -52,6 +59,7 @@ var _ reflexpb.ReflexServer = (*Server)(nil)
 type Server struct {
 	grpcServer  *grpc.Server
 	stream      reflex.StreamFunc
+	registry    *reflex.StreamRegistry
 	cstore      reflex.CursorStore
 	rserver     *reflex.Server
 	sentCounter prometheus.Counter
@@ -63,6 +71,22 @@ func (srv *Server) Stream(req *reflexpb.StreamRequest,
 	return srv.rserver.Stream(srv.stream, req, &counter{ss, srv.sentCounter})
 }
 
+func (srv *Server) Multiplex(ms reflexpb.Reflex_MultiplexServer) error {
+	return srv.rserver.Multiplex(srv.registry.Streams(), ms)
+}
+
+func (srv *Server) ListStreams(ctx context.Context,
+	req *reflexpb.ListStreamsRequest) (*reflexpb.ListStreamsResponse, error) {
+
+	return srv.rserver.ListStreams(ctx, srv.registry, req)
+}
+
+// Registry returns the registry of streams served by the
+// multiplex and list streams methods.
+func (srv *Server) Registry() *reflex.StreamRegistry {
+	return srv.registry
+}
+
 func (srv *Server) SentCount() float64 {
 	return testutil.ToFloat64(srv.sentCounter)
 }
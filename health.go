@@ -0,0 +1,242 @@
+package reflex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+)
+
+// HealthStatus is the health of a spec executed by Run.
+type HealthStatus struct {
+	// Name of the spec, ie. the consumer name.
+	Name string `json:"name"`
+
+	// Running is true while Run is executing the spec.
+	Running bool `json:"running"`
+
+	// LagSeconds is the lag of the last consumed event at the time it was
+	// consumed. It is not updated while no events are consumed, so it
+	// doesn't reflect the lag of idle or stuck consumers, see LastConsumed
+	// and the reflex_consumer_lag_events metric via WithRunLagEvents.
+	LagSeconds float64 `json:"lag_seconds"`
+
+	// LastError is the error returned by the last run, empty if none or if
+	// an event was consumed since.
+	LastError string `json:"last_error,omitempty"`
+
+	// LastConsumed is the time the last event was consumed, zero if none.
+	LastConsumed time.Time `json:"last_consumed,omitempty"`
+
+	// FailingSince is the time the spec first stopped without consuming
+	// an event since, zero if it is healthy.
+	FailingSince time.Time `json:"failing_since,omitempty"`
+}
+
+// ConsumerState is a snapshot of the state of a spec executed by Run,
+// see Inspect.
+type ConsumerState struct {
+	// Name of the spec, ie. the consumer name.
+	Name string
+
+	// Running is true while Run is executing the spec.
+	Running bool
+
+	// LastEventID is the ID of the last consumed event, empty if none.
+	LastEventID string
+
+	// LastConsumed is the time the last event was consumed, zero if none.
+	LastConsumed time.Time
+
+	// LastLatency is the duration it took to consume the last event.
+	LastLatency time.Duration
+
+	// ErrorStreak is the number of consecutive errors returned by the
+	// consumer since the last consumed event. Note errors retried or
+	// skipped by the consumer's error policy are not included.
+	ErrorStreak int
+
+	// Lag is the lag of the last consumed event at the time it was consumed,
+	// see HealthStatus.LagSeconds.
+	Lag time.Duration
+}
+
+const defaultHealthGracePeriod = 2 * time.Minute
+
+// HealthOption defines a functional option that configures HealthHandler.
+type HealthOption func(*healthOptions)
+
+type healthOptions struct {
+	grace time.Duration
+}
+
+// WithHealthGracePeriod provides an option to set the period for which a
+// spec may be failing before it is considered unhealthy. It should be longer
+// than the backoff between runs, e.g. rpatterns.RunForever's 1 min.
+// It defaults to 2 minutes.
+func WithHealthGracePeriod(d time.Duration) HealthOption {
+	return func(o *healthOptions) {
+		o.grace = d
+	}
+}
+
+var health = &healthRegistry{
+	states:    make(map[string]*HealthStatus),
+	consumers: make(map[string]*ConsumerState),
+}
+
+// Health returns the health status of all specs executed by Run
+// in this process ordered by name.
+func Health() []HealthStatus {
+	return health.List()
+}
+
+// Inspect returns a snapshot of the state of the spec executed by Run in this
+// process, e.g. for custom dashboards and admin endpoints. It returns false
+// if the spec was not run.
+func Inspect(s Spec) (ConsumerState, bool) {
+	return health.Inspect(s.Name())
+}
+
+// HealthHandler returns a http.Handler that serves the Health statuses
+// as JSON. It responds with status 503 if any spec has been failing, ie.
+// stopped with an error without consuming events since, for longer than the
+// grace period, which is suitable for readiness and liveness probes. Specs
+// are therefore healthy during the normal backoff between runs and after
+// clean stops, e.g. canceled or reaching the head.
+func HealthHandler(opts ...HealthOption) http.Handler {
+	o := healthOptions{grace: defaultHealthGracePeriod}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hl := Health()
+
+		code := http.StatusOK
+		for _, h := range hl {
+			if !h.FailingSince.IsZero() && since(h.FailingSince) > o.grace {
+				code = http.StatusServiceUnavailable
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(hl)
+	})
+}
+
+// healthRegistry tracks the health of specs executed by Run.
+type healthRegistry struct {
+	mu        sync.Mutex
+	states    map[string]*HealthStatus
+	consumers map[string]*ConsumerState
+}
+
+// Started marks the spec as running.
+func (r *healthRegistry) Started(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.states[name]
+	if !ok {
+		s = &HealthStatus{Name: name}
+		r.states[name] = s
+		r.consumers[name] = &ConsumerState{Name: name}
+	}
+	s.Running = true
+	r.consumers[name].Running = true
+}
+
+// Consumed records the event as consumed at time t in the latency.
+func (r *healthRegistry) Consumed(name string, e *Event, t time.Time, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.states[name]
+	if !ok {
+		return
+	}
+	lag := t.Sub(e.Timestamp)
+	s.LastConsumed = t
+	s.LagSeconds = lag.Seconds()
+	s.LastError = ""
+	s.FailingSince = time.Time{}
+
+	c := r.consumers[name]
+	c.LastEventID = e.ID
+	c.LastConsumed = t
+	c.LastLatency = latency
+	c.ErrorStreak = 0
+	c.Lag = lag
+}
+
+// ConsumeFailed records an error returned by the consumer.
+func (r *healthRegistry) ConsumeFailed(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.consumers[name]; ok {
+		c.ErrorStreak++
+	}
+}
+
+// Stopped marks the spec as not running with the error it returned.
+// Clean stops, see isCleanStop, don't mark the spec as failing.
+func (r *healthRegistry) Stopped(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.states[name]
+	if !ok {
+		return
+	}
+	s.Running = false
+	r.consumers[name].Running = false
+	if isCleanStop(err) {
+		return
+	}
+
+	s.LastError = err.Error()
+	if s.FailingSince.IsZero() {
+		s.FailingSince = now()
+	}
+}
+
+// isCleanStop returns true if Run stopped without failing, i.e. it was
+// canceled, stopped, or reached the head of a bounded stream.
+func isCleanStop(err error) bool {
+	return err == nil || errors.IsAny(err, context.Canceled,
+		context.DeadlineExceeded, ErrStopped, ErrHeadReached)
+}
+
+// Inspect returns a copy of the consumer state or false if not found.
+func (r *healthRegistry) Inspect(name string) (ConsumerState, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.consumers[name]
+	if !ok {
+		return ConsumerState{}, false
+	}
+	return *c, true
+}
+
+// List returns copies of all the statuses ordered by name.
+func (r *healthRegistry) List() []HealthStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make([]HealthStatus, 0, len(r.states))
+	for _, s := range r.states {
+		res = append(res, *s)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
@@ -0,0 +1,167 @@
+package reflex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errConsume := errors.New("consume error")
+	var fail bool
+
+	sc := &mockstreamclient{
+		Events:   []*Event{{ID: "1", Timestamp: time.Now()}},
+		EndError: context.Canceled,
+	}
+	consumer := NewConsumer("health_test", func(context.Context, fate.Fate, *Event) error {
+		if fail {
+			return errConsume
+		}
+		return nil
+	})
+	spec := NewSpec(func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		return blockingstreamclient{ctx: ctx, sc: sc}, nil
+	}, mockcursor{}, consumer)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Run(ctx, spec)
+	}()
+
+	getStatus := func() HealthStatus {
+		for _, h := range Health() {
+			if h.Name == "health_test" {
+				return h
+			}
+		}
+		return HealthStatus{}
+	}
+
+	require.Eventually(t, func() bool {
+		h := getStatus()
+		return h.Running && !h.LastConsumed.IsZero()
+	}, time.Second, time.Millisecond)
+
+	// Canceling is a clean stop.
+	cancel()
+	jtest.Require(t, context.Canceled, <-errCh)
+
+	h := getStatus()
+	require.False(t, h.Running)
+	require.Empty(t, h.LastError)
+	require.True(t, h.FailingSince.IsZero())
+
+	// Consume errors fail the spec.
+	fail = true
+	sc.Events = []*Event{{ID: "2", Timestamp: time.Now()}}
+	jtest.Require(t, errConsume, Run(context.Background(), spec))
+
+	h = getStatus()
+	require.False(t, h.Running)
+	require.Contains(t, h.LastError, errConsume.Error())
+	require.False(t, h.FailingSince.IsZero())
+
+	// Healthy during the grace period.
+	rec := httptest.NewRecorder()
+	HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	HealthHandler(WithHealthGracePeriod(0)).ServeHTTP(rec,
+		httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var hl []HealthStatus
+	jtest.RequireNil(t, json.Unmarshal(rec.Body.Bytes(), &hl))
+	var found bool
+	for _, s := range hl {
+		if s.Name == h.Name {
+			found = true
+			require.Equal(t, h.LastError, s.LastError)
+			require.True(t, h.LastConsumed.Equal(s.LastConsumed))
+		}
+	}
+	require.True(t, found)
+
+	// Consuming again clears the error.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	fail = false
+	sc.Events = []*Event{{ID: "3", Timestamp: time.Now()}}
+	go func() {
+		errCh <- Run(ctx, spec)
+	}()
+
+	require.Eventually(t, func() bool {
+		h := getStatus()
+		return h.Running && h.LastError == "" && h.FailingSince.IsZero()
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	jtest.Require(t, context.Canceled, <-errCh)
+}
+
+func TestIsCleanStop(t *testing.T) {
+	require.True(t, isCleanStop(nil))
+	require.True(t, isCleanStop(errors.Wrap(context.Canceled, "recv error")))
+	require.True(t, isCleanStop(context.DeadlineExceeded))
+	require.True(t, isCleanStop(errors.Wrap(ErrHeadReached, "recv error")))
+	require.True(t, isCleanStop(ErrStopped))
+	require.False(t, isCleanStop(errors.New("consume error")))
+}
+
+func TestInspect(t *testing.T) {
+	errConsume := errors.New("consume error")
+	var fail bool
+
+	consumer := NewConsumer("inspect_test", func(ctx context.Context, f fate.Fate, e *Event) error {
+		if fail {
+			return errConsume
+		}
+		return nil
+	})
+	stream := func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		return &mockstreamclient{
+			Events:   []*Event{{ID: "1", Timestamp: time.Now()}, {ID: "2", Timestamp: time.Now()}},
+			EndError: context.Canceled,
+		}, nil
+	}
+	spec := NewSpec(stream, mockcursor{}, consumer)
+
+	_, ok := Inspect(spec)
+	require.False(t, ok)
+
+	jtest.Require(t, context.Canceled, Run(context.Background(), spec))
+
+	s, ok := Inspect(spec)
+	require.True(t, ok)
+	require.Equal(t, "inspect_test", s.Name)
+	require.False(t, s.Running)
+	require.Equal(t, "2", s.LastEventID)
+	require.False(t, s.LastConsumed.IsZero())
+	require.Equal(t, 0, s.ErrorStreak)
+	require.True(t, s.Lag > 0)
+
+	fail = true
+	for i := 0; i < 2; i++ {
+		jtest.Require(t, errConsume, Run(context.Background(), spec))
+	}
+
+	s, ok = Inspect(spec)
+	require.True(t, ok)
+	require.Equal(t, 2, s.ErrorStreak)
+	require.Equal(t, "2", s.LastEventID)
+}
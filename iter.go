@@ -0,0 +1,129 @@
+package reflex
+
+import (
+	"context"
+)
+
+// ChannelOption defines a functional option that configures ToChannel.
+type ChannelOption func(*channelOptions)
+
+type channelOptions struct {
+	buffer int
+}
+
+// WithChannelBuffer provides an option to set the number of events buffered
+// in the events channel. It defaults to 0, i.e. unbuffered.
+func WithChannelBuffer(size int) ChannelOption {
+	return func(o *channelOptions) {
+		o.buffer = size
+	}
+}
+
+// ToChannel receives the events of the stream client in a goroutine and sends
+// them to the returned events channel. When the stream client errors, the
+// error is sent to the error channel and both channels are closed. The
+// goroutine stops when the context is canceled, so the context should also be
+// the stream's context to stop blocked receives.
+//
+// Note that stream errors include ErrHeadReached, see WithStreamToHead.
+func ToChannel(ctx context.Context, sc StreamClient,
+	opts ...ChannelOption) (<-chan *Event, <-chan error) {
+
+	var o channelOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	events := make(chan *Event, o.buffer)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		for {
+			e, err := sc.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+// NewIterator returns an iterator over the events of the stream client.
+func NewIterator(sc StreamClient) *Iterator {
+	return &Iterator{sc: sc}
+}
+
+// Iterator iterates over the events of a stream client in the style of
+// bufio.Scanner:
+//
+//	it := reflex.NewIterator(sc)
+//	for it.Next() {
+//	  e := it.Event()
+//	}
+//	if err := it.Err(); err != nil {
+//	  return err
+//	}
+//
+// With Go 1.23 or later, range over All instead of calling Next.
+type Iterator struct {
+	sc  StreamClient
+	e   *Event
+	err error
+}
+
+// Next receives the next event, blocking until it is received. It returns
+// false once the stream client errors, see Err.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.e, it.err = it.sc.Recv()
+	return it.err == nil
+}
+
+// Event returns the event received by the last call to Next.
+func (it *Iterator) Event() *Event {
+	return it.e
+}
+
+// Err returns the error of the stream client after Next returns false.
+// Like io.EOF for bufio.Scanner, it returns nil if the stream ended
+// with ErrHeadReached, see WithStreamToHead.
+func (it *Iterator) Err() error {
+	if IsHeadReachedErr(it.err) {
+		return nil
+	}
+	return it.err
+}
+
+// All returns a function that yields the events until the stream client
+// errors, for use with Go 1.23 range-over-func:
+//
+//	for e := range it.All() {
+//	  ...
+//	}
+//	if err := it.Err(); err != nil {
+//	  return err
+//	}
+func (it *Iterator) All() func(yield func(*Event) bool) {
+	return func(yield func(*Event) bool) {
+		for it.Next() {
+			if !yield(it.Event()) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package reflex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToChannel(t *testing.T) {
+	errDone := errors.New("no more events")
+	sc := &mockstreamclient{
+		Events:   []*Event{{ID: "1"}, {ID: "2"}, {ID: "3"}},
+		EndError: errDone,
+	}
+
+	events, errs := ToChannel(context.Background(), sc, WithChannelBuffer(2))
+
+	var ids []string
+	for e := range events {
+		ids = append(ids, e.ID)
+	}
+	require.Equal(t, []string{"1", "2", "3"}, ids)
+	jtest.Require(t, errDone, <-errs)
+
+	_, ok := <-errs
+	require.False(t, ok)
+}
+
+func TestToChannelCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sc := &mockstreamclient{Events: []*Event{{ID: "1"}, {ID: "2"}}}
+
+	events, errs := ToChannel(ctx, sc)
+	require.Equal(t, "1", (<-events).ID)
+
+	cancel()
+	jtest.Require(t, context.Canceled, <-errs)
+}
+
+func TestIterator(t *testing.T) {
+	tests := []struct {
+		name   string
+		endErr error
+		expErr error
+	}{
+		{
+			name:   "head reached",
+			endErr: ErrHeadReached,
+		},
+		{
+			name:   "error",
+			endErr: ErrStopped,
+			expErr: ErrStopped,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			it := NewIterator(&mockstreamclient{
+				Events:   []*Event{{ID: "1"}, {ID: "2"}},
+				EndError: test.endErr,
+			})
+
+			var ids []string
+			for it.Next() {
+				ids = append(ids, it.Event().ID)
+			}
+			require.Equal(t, []string{"1", "2"}, ids)
+			jtest.Require(t, test.expErr, it.Err())
+			require.False(t, it.Next())
+		})
+	}
+}
+
+func TestIteratorAll(t *testing.T) {
+	it := NewIterator(&mockstreamclient{
+		Events:   []*Event{{ID: "1"}, {ID: "2"}, {ID: "3"}},
+		EndError: ErrHeadReached,
+	})
+
+	// Equivalent to range-over-func with break after the second event.
+	var ids []string
+	it.All()(func(e *Event) bool {
+		ids = append(ids, e.ID)
+		return e.ID != "2"
+	})
+	require.Equal(t, []string{"1", "2"}, ids)
+	jtest.RequireNil(t, it.Err())
+
+	// Continues after the last yielded event.
+	it.All()(func(e *Event) bool {
+		ids = append(ids, e.ID)
+		return true
+	})
+	require.Equal(t, []string{"1", "2", "3"}, ids)
+	jtest.RequireNil(t, it.Err())
+}
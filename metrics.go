@@ -1,6 +1,8 @@
 package reflex
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -8,7 +10,15 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-const consumerLabel = "consumer_name"
+const (
+	consumerLabel   = "consumer_name"
+	eventTypeLabel  = "event_type"
+	errorClassLabel = "class"
+
+	// otherTypeLabel is the event type label value of event types not in
+	// the consumer's type metric labels allowlist.
+	otherTypeLabel = "other"
+)
 
 var (
 	consumerLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -18,6 +28,20 @@ var (
 		Help:      "Lag between now and the current event timestamp in seconds",
 	}, []string{consumerLabel})
 
+	consumerLagEvents = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "lag_events",
+		Help:      "Lag between the head and the current cursor in number of events",
+	}, []string{consumerLabel})
+
+	consumerCursorDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "cursor_drift_events",
+		Help:      "Drift between the head and the stored cursor in number of events",
+	}, []string{consumerLabel})
+
 	consumerLagAlert = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "reflex",
 		Subsystem: "consumer",
@@ -34,6 +58,20 @@ var (
 				"in the activity ttl period",
 		}, []string{consumerLabel}))
 
+	consumerLastEventTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "last_event_timestamp_seconds",
+		Help:      "Timestamp of the last consumed event in seconds since the epoch",
+	}, []string{consumerLabel})
+
+	consumerLastConsumeTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "last_consume_timestamp_seconds",
+		Help:      "Time the last event was consumed in seconds since the epoch",
+	}, []string{consumerLabel})
+
 	consumerLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: "reflex",
 		Subsystem: "consumer",
@@ -48,14 +86,301 @@ var (
 		Name:      "error_count",
 		Help:      "Number of errors processing events",
 	}, []string{consumerLabel})
+
+	consumerCircuitOpen = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "circuit_open_total",
+		Help:      "Number of times the consumer circuit breaker opened",
+	}, []string{consumerLabel})
+
+	consumerTypeLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "type_lag_seconds",
+		Help:      "Lag between now and the current event timestamp in seconds by event type",
+	}, []string{consumerLabel, eventTypeLabel})
+
+	consumerTypeLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "type_latency_seconds",
+		Help:      "Event loop latency in seconds by event type",
+		Buckets:   []float64{0.001, 0.01, 0.1, 1.0, 2.0, 5.0, 10.0, 30.0, 60.0, 120.0, 300.0},
+	}, []string{consumerLabel, eventTypeLabel})
+
+	consumerTypeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "type_error_count",
+		Help:      "Number of errors processing events by event type",
+	}, []string{consumerLabel, eventTypeLabel})
+
+	consumerEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "events_total",
+		Help:      "Number of events consumed successfully",
+	}, []string{consumerLabel})
+
+	consumerTypeEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "type_events_total",
+		Help:      "Number of events consumed successfully by event type",
+	}, []string{consumerLabel, eventTypeLabel})
+
+	consumerSLOTarget = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "slo_target_seconds",
+		Help:      "Service level objective targets by objective, see WithConsumerSLO",
+	}, []string{consumerLabel, sloLabel})
+
+	consumerSLOEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "slo_events_total",
+		Help:      "Number of events consumed by consumers with service level objectives",
+	}, []string{consumerLabel})
+
+	consumerSLOBreaches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "consumer",
+		Name:      "slo_breach_total",
+		Help:      "Number of consumed events breaching the service level objectives by objective",
+	}, []string{consumerLabel, sloLabel})
+
+	runRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "run",
+		Name:      "restarts_total",
+		Help:      "Number of times Run was restarted per consumer in this process",
+	}, []string{consumerLabel})
+
+	runBackoff = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "reflex",
+		Subsystem: "run",
+		Name:      "backoff_seconds",
+		Help:      "Current backoff before consuming again in seconds, see RunBackoff",
+	}, []string{consumerLabel})
+
+	runLastError = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "reflex",
+		Subsystem: "run",
+		Name:      "last_error",
+		Help:      "Whether or not the last Run error was of the class: canceled, stream, cursor or consume",
+	}, []string{consumerLabel, errorClassLabel})
+
+	streamFailoverCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "stream",
+		Name:      "failover_total",
+		Help:      "Number of stream failovers to the next server, see NewFailoverStream",
+	})
 )
 
 func init() {
 	prometheus.MustRegister(consumerLagAlert)
 	prometheus.MustRegister(consumerLag)
+	prometheus.MustRegister(consumerLagEvents)
+	prometheus.MustRegister(consumerCursorDrift)
 	prometheus.MustRegister(consumerLatency)
 	prometheus.MustRegister(consumerErrors)
 	prometheus.MustRegister(consumerActivityGauge)
+	prometheus.MustRegister(consumerLastEventTimestamp)
+	prometheus.MustRegister(consumerLastConsumeTimestamp)
+	prometheus.MustRegister(consumerCircuitOpen)
+	prometheus.MustRegister(consumerTypeLag)
+	prometheus.MustRegister(consumerTypeLatency)
+	prometheus.MustRegister(consumerTypeErrors)
+	prometheus.MustRegister(consumerEvents)
+	prometheus.MustRegister(consumerTypeEvents)
+	prometheus.MustRegister(consumerSLOTarget)
+	prometheus.MustRegister(consumerSLOEvents)
+	prometheus.MustRegister(consumerSLOBreaches)
+	prometheus.MustRegister(runRestarts)
+	prometheus.MustRegister(runBackoff)
+	prometheus.MustRegister(runLastError)
+	prometheus.MustRegister(streamFailoverCounter)
+}
+
+// Metrics abstracts the backend of the metrics of a single consumer. The
+// default implementation exports prometheus metrics. See WithConsumerMetrics.
+type Metrics interface {
+	// ConsumeObserved observes the latency of consuming the event.
+	ConsumeObserved(e *Event, latency time.Duration)
+
+	// ErrorInced increments the number of errors consuming the event.
+	ErrorInced(e *Event)
+
+	// EventsInced increments the number of events consumed successfully.
+	EventsInced(e *Event)
+
+	// LagSet sets the lag of the event and whether it crosses the
+	// consumer's lag alert threshold.
+	LagSet(e *Event, lag time.Duration, alert bool)
+
+	// ActivitySet marks the consumer as active (consumed an event).
+	ActivitySet()
+}
+
+// newPromMetrics returns the default prometheus consumer metrics. If types
+// is not empty, the latency, error and lag metrics are also labeled by event
+// type, with types not in the allowlist labeled as "other".
+func newPromMetrics(labels prometheus.Labels, lagAlert prometheus.Gauge,
+	activityTTL time.Duration, clock Clock, types []EventType) *promMetrics {
+
+	m := &promMetrics{
+		lag:         consumerLag.With(labels),
+		lagAlert:    lagAlert,
+		errors:      consumerErrors.With(labels),
+		events:      consumerEvents.With(labels),
+		latency:     consumerLatency.With(labels),
+		activityKey: consumerActivityGauge.Register(labels, activityTTL, clock),
+		lastEvent:   consumerLastEventTimestamp.With(labels),
+		lastConsume: consumerLastConsumeTimestamp.With(labels),
+		clock:       clock,
+	}
+
+	if len(types) > 0 {
+		m.typeLabels = make(map[int]string)
+		for _, typ := range types {
+			m.typeLabels[typ.ReflexType()] = typeLabel(typ)
+		}
+		m.typeLag = consumerTypeLag.MustCurryWith(labels)
+		m.typeErrors = consumerTypeErrors.MustCurryWith(labels)
+		m.typeEvents = consumerTypeEvents.MustCurryWith(labels)
+		m.typeLatency = consumerTypeLatency.MustCurryWith(labels)
+	}
+
+	return m
+}
+
+type promMetrics struct {
+	lag         prometheus.Gauge
+	lagAlert    prometheus.Gauge
+	errors      prometheus.Counter
+	events      prometheus.Counter
+	latency     prometheus.Observer
+	activityKey string
+	lastEvent   prometheus.Gauge
+	lastConsume prometheus.Gauge
+	clock       Clock
+
+	// typeLabels is the allowlist of event types (ReflexType to label value)
+	// and is nil if type metric labels are disabled.
+	typeLabels  map[int]string
+	typeLag     *prometheus.GaugeVec
+	typeErrors  *prometheus.CounterVec
+	typeEvents  *prometheus.CounterVec
+	typeLatency prometheus.ObserverVec
+}
+
+// typeLabel returns the event type label value of the event or
+// false if type metric labels are disabled.
+func (m *promMetrics) typeLabel(e *Event) (string, bool) {
+	if m.typeLabels == nil {
+		return "", false
+	}
+
+	if l, ok := m.typeLabels[e.Type.ReflexType()]; ok {
+		return l, true
+	}
+
+	return otherTypeLabel, true
+}
+
+func (m *promMetrics) ConsumeObserved(e *Event, latency time.Duration) {
+	m.latency.Observe(latency.Seconds())
+	m.lastEvent.Set(unixSeconds(e.Timestamp))
+	m.lastConsume.Set(unixSeconds(m.clock.Now()))
+
+	if l, ok := m.typeLabel(e); ok {
+		m.typeLatency.WithLabelValues(l).Observe(latency.Seconds())
+	}
+}
+
+func (m *promMetrics) ErrorInced(e *Event) {
+	m.errors.Inc()
+
+	if l, ok := m.typeLabel(e); ok {
+		m.typeErrors.WithLabelValues(l).Inc()
+	}
+}
+
+func (m *promMetrics) EventsInced(e *Event) {
+	m.events.Inc()
+
+	if l, ok := m.typeLabel(e); ok {
+		m.typeEvents.WithLabelValues(l).Inc()
+	}
+}
+
+func (m *promMetrics) LagSet(e *Event, lag time.Duration, alert bool) {
+	m.lag.Set(lag.Seconds())
+
+	if l, ok := m.typeLabel(e); ok {
+		m.typeLag.WithLabelValues(l).Set(lag.Seconds())
+	}
+
+	v := 0.0
+	if alert {
+		v = 1
+	}
+	m.lagAlert.Set(v)
+}
+
+func (m *promMetrics) ActivitySet() {
+	consumerActivityGauge.SetActive(m.activityKey)
+}
+
+// unixSeconds returns the time in seconds since the epoch.
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// newPromErrorMetrics returns metrics that only export the prometheus
+// consumer error metric, see WithRunMetrics.
+func newPromErrorMetrics(consumerName string) promErrorMetrics {
+	return promErrorMetrics{errors: consumerErrors.WithLabelValues(consumerName)}
+}
+
+type promErrorMetrics struct {
+	errors prometheus.Counter
+}
+
+func (m promErrorMetrics) ConsumeObserved(*Event, time.Duration) {}
+
+func (m promErrorMetrics) ErrorInced(*Event) {
+	m.errors.Inc()
+}
+
+func (m promErrorMetrics) EventsInced(*Event) {}
+
+func (m promErrorMetrics) LagSet(*Event, time.Duration, bool) {}
+
+func (m promErrorMetrics) ActivitySet() {}
+
+// TypeMetricLabel returns the event type metric label value of the event given
+// the allowlist of types, see WithTypeMetricLabels. Events with types not in
+// the allowlist are labeled as "other". It is intended for custom metrics.
+func TypeMetricLabel(types []EventType, e *Event) string {
+	for _, typ := range types {
+		if typ.ReflexType() == e.Type.ReflexType() {
+			return typeLabel(typ)
+		}
+	}
+	return otherTypeLabel
+}
+
+// typeLabel returns the metric label value of the event type; either its
+// String value if it implements fmt.Stringer or its ReflexType.
+func typeLabel(typ EventType) string {
+	if s, ok := typ.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return strconv.Itoa(typ.ReflexType())
 }
 
 func newActivityGauge(g *prometheus.GaugeVec) *activityGauge {
@@ -77,10 +402,11 @@ type state struct {
 	labels prometheus.Labels
 	tick   time.Time
 	ttl    time.Duration
+	clock  Clock
 }
 
-// Register registers the consumer labels with its ttl and ticks it as active and returns a consumer key.
-func (g *activityGauge) Register(labels prometheus.Labels, ttl time.Duration) string {
+// Register registers the consumer labels with its ttl and clock and ticks it as active and returns a consumer key.
+func (g *activityGauge) Register(labels prometheus.Labels, ttl time.Duration, clock Clock) string {
 	key := labelsToKey(labels)
 
 	g.mu.Lock()
@@ -89,7 +415,8 @@ func (g *activityGauge) Register(labels prometheus.Labels, ttl time.Duration) st
 	g.states[key] = state{
 		labels: labels,
 		ttl:    ttl,
-		tick:   time.Now(),
+		tick:   clock.Now(),
+		clock:  clock,
 	}
 	return key
 }
@@ -99,11 +426,24 @@ func (g *activityGauge) SetActive(key string) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	s := g.states[key]
-	s.tick = time.Now()
+	s, ok := g.states[key]
+	if !ok {
+		return
+	}
+	s.tick = s.clock.Now()
 	g.states[key] = s
 }
 
+// LastActive returns the time the consumer labels were last ticked as
+// active and true, or false if the labels are not registered.
+func (g *activityGauge) LastActive(labels prometheus.Labels) (time.Time, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s, ok := g.states[labelsToKey(labels)]
+	return s.tick, ok
+}
+
 func (g *activityGauge) Describe(ch chan<- *prometheus.Desc) {
 	g.gv.Describe(ch)
 }
@@ -119,7 +459,7 @@ func (g *activityGauge) Collect(ch chan<- prometheus.Metric) {
 			continue
 		}
 		v := 0.0
-		if time.Since(s.tick) < s.ttl {
+		if s.clock.Now().Sub(s.tick) < s.ttl {
 			v = 1
 		}
 		g.gv.With(s.labels).Set(v)
@@ -1,10 +1,13 @@
 package reflex
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/luno/fate"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/require"
 )
@@ -33,9 +36,9 @@ func TestActivityGauge(t *testing.T) {
 		}
 	}
 
-	k1 := g.Register(label1, time.Nanosecond) // will always be inactive
-	k2 := g.Register(label2, time.Minute)     // will always be active
-	k3 := g.Register(label3, -1)              // disabled
+	k1 := g.Register(label1, time.Nanosecond, realClock{}) // will always be inactive
+	k2 := g.Register(label2, time.Minute, realClock{})     // will always be active
+	k3 := g.Register(label3, -1, realClock{})              // disabled
 
 	ch := make(chan prometheus.Metric, 5)
 	g.Collect(ch)
@@ -49,3 +52,59 @@ func TestActivityGauge(t *testing.T) {
 	g.Collect(ch)
 	assertMetric(ch)
 }
+
+func TestActivityGaugeClock(t *testing.T) {
+	g := newActivityGauge(prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{}, []string{consumerLabel}))
+
+	clock := &fakeClock{now: time.Now()}
+	key := g.Register(prometheus.Labels{consumerLabel: "label"}, time.Hour, clock)
+
+	assertActive := func(active float64) {
+		ch := make(chan prometheus.Metric, 1)
+		g.Collect(ch)
+		dm := new(dto.Metric)
+		require.NoError(t, (<-ch).Write(dm))
+		require.Equal(t, active, dm.Gauge.GetValue())
+	}
+
+	assertActive(1)
+
+	clock.now = clock.now.Add(time.Hour)
+	assertActive(0)
+
+	g.SetActive(key)
+	assertActive(1)
+}
+
+// fakeClock is a clock that only changes when now is set.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	panic("not implemented")
+}
+
+func TestLastConsumedTimestamps(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	c := NewConsumer("last_consumed_test", func(context.Context, fate.Fate, *Event) error {
+		clock.now = clock.now.Add(time.Second)
+		return nil
+	}, WithConsumerClock(clock))
+
+	err := c.Consume(context.Background(), fate.New(), &Event{
+		ID:        "1",
+		Timestamp: time.Unix(1500000000, 500000000),
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, 1500000000.5, testutil.ToFloat64(
+		consumerLastEventTimestamp.WithLabelValues("last_consumed_test")))
+	require.Equal(t, 1600000001.0, testutil.ToFloat64(
+		consumerLastConsumeTimestamp.WithLabelValues("last_consumed_test")))
+}
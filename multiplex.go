@@ -0,0 +1,362 @@
+package reflex
+
+import (
+	"context"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex/reflexpb"
+)
+
+// multiplexBuffer is the number of events buffered per multiplexed stream.
+const multiplexBuffer = 100
+
+type multiplexServerPB interface {
+	Context() context.Context
+	Send(*reflexpb.MultiplexEvent) error
+	Recv() (*reflexpb.MultiplexRequest, error)
+}
+
+// Multiplex serves the named streams for a gRPC bidirectional multiplex
+// method. Clients subscribe to multiple streams over a single gRPC stream,
+// see NewMultiplexer. It always returns a non-nil error.
+// It returns ErrStopped if the server is stopped.
+func (s *Server) Multiplex(streams map[string]StreamFunc, mspb multiplexServerPB) error {
+	if err := s.maybeErrStopped(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(mspb.Context())
+	defer cancel()
+
+	m := &muxServer{
+		ctx:     ctx,
+		mspb:    mspb,
+		streams: streams,
+		cancels: make(map[int64]context.CancelFunc),
+		errCh:   make(chan error, 1),
+	}
+	defer m.wg.Wait()
+
+	stopper := func() error {
+		return awaitStop(ctx, s.stop)
+	}
+
+	var err error
+	select {
+	case err = <-goChan(stopper):
+	case err = <-goChan(m.serveRequests):
+	case err = <-m.errCh:
+	}
+	return err
+}
+
+type muxServer struct {
+	ctx     context.Context
+	mspb    multiplexServerPB
+	streams map[string]StreamFunc
+	wg      sync.WaitGroup
+	errCh   chan error
+
+	mu      sync.Mutex
+	cancels map[int64]context.CancelFunc
+	sendMu  sync.Mutex
+}
+
+// serveRequests receives and serves subscribe and cancel requests
+// until the client closes the stream.
+func (m *muxServer) serveRequests() error {
+	for {
+		req, err := m.mspb.Recv()
+		if err != nil {
+			return errors.Wrap(err, "recv multiplex request error")
+		}
+
+		m.mu.Lock()
+		cancel, ok := m.cancels[req.Id]
+		m.mu.Unlock()
+
+		if req.Cancel {
+			if ok {
+				cancel()
+			}
+			continue
+		} else if ok {
+			return errors.New("duplicate multiplex id", j.KV("id", req.Id))
+		}
+
+		sFn, ok := m.streams[req.Stream]
+		if !ok {
+			err := errors.New("unknown stream", j.KS("stream", req.Stream))
+			if err := m.sendErr(req.Id, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(m.ctx)
+		m.mu.Lock()
+		m.cancels[req.Id] = cancel
+		m.mu.Unlock()
+
+		m.wg.Add(1)
+		go m.serve(ctx, req, sFn)
+	}
+}
+
+// serve streams the events of the subscription until it errors or is cancelled.
+func (m *muxServer) serve(ctx context.Context, req *reflexpb.MultiplexRequest, sFn StreamFunc) {
+	defer m.wg.Done()
+	defer func() {
+		m.mu.Lock()
+		m.cancels[req.Id]()
+		delete(m.cancels, req.Id)
+		m.mu.Unlock()
+	}()
+
+	var (
+		after string
+		opts  []StreamOption
+	)
+	if req.Request != nil {
+		after = req.Request.After
+		opts = optsFromProto(req.Request.Options)
+	}
+
+	err := func() error {
+		sc, err := sFn(ctx, after, opts...)
+		if err != nil {
+			return err
+		}
+		return serveStream(&muxStreamServer{ctx: ctx, id: req.Id, m: m}, sc, 0, opts...)
+	}()
+
+	if m.ctx.Err() != nil {
+		// Multiplex stream done.
+		return
+	}
+
+	if err := m.sendErr(req.Id, err); err != nil {
+		select {
+		case m.errCh <- err:
+		default:
+		}
+	}
+}
+
+func (m *muxServer) send(e *reflexpb.MultiplexEvent) error {
+	m.sendMu.Lock()
+	defer m.sendMu.Unlock()
+	return m.mspb.Send(e)
+}
+
+// sendErr sends the subscription error to the client
+// including the error codes of jettison errors.
+func (m *muxServer) sendErr(id int64, err error) error {
+	return m.send(&reflexpb.MultiplexEvent{
+		Id:    id,
+		Error: err.Error(),
+		Codes: errors.GetCodes(err),
+	})
+}
+
+// muxStreamServer implements streamServerPB for a subscription.
+type muxStreamServer struct {
+	ctx context.Context
+	id  int64
+	m   *muxServer
+}
+
+func (s *muxStreamServer) Context() context.Context {
+	return s.ctx
+}
+
+func (s *muxStreamServer) Send(e *reflexpb.Event) error {
+	return s.m.send(&reflexpb.MultiplexEvent{Id: s.id, Event: e})
+}
+
+// MultiplexClientPB defines a common interface for reflex multiplex gRPC
+// generated bidirectional stream clients.
+type MultiplexClientPB interface {
+	Send(*reflexpb.MultiplexRequest) error
+	Recv() (*reflexpb.MultiplexEvent, error)
+}
+
+// NewMultiplexer returns a multiplexer that subscribes to multiple named
+// streams over the single gRPC stream and demultiplexes the received events.
+// Cancel the context of the gRPC stream to stop the multiplexer.
+//
+// Note that each stream buffers up to 100 events after which slow consumers
+// block the other streams of the multiplexer.
+func NewMultiplexer(mcpb MultiplexClientPB) *Multiplexer {
+	m := &Multiplexer{
+		mcpb: mcpb,
+		subs: make(map[int64]*muxClient),
+		done: make(chan struct{}),
+	}
+
+	go m.demux()
+
+	return m
+}
+
+// Multiplexer subscribes to named streams over a single gRPC stream.
+type Multiplexer struct {
+	mcpb   MultiplexClientPB
+	sendMu sync.Mutex
+	done   chan struct{}
+	err    error
+
+	mu     sync.Mutex
+	nextID int64
+	subs   map[int64]*muxClient
+}
+
+// StreamFunc returns a StreamFunc of the named stream. The returned
+// stream clients implement io.Closer which cancels the subscription.
+func (m *Multiplexer) StreamFunc(name string) StreamFunc {
+	return func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		optionspb, err := optsToProto(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		m.mu.Lock()
+		m.nextID++
+		sub := &muxClient{
+			m:      m,
+			id:     m.nextID,
+			ctx:    ctx,
+			ch:     make(chan *reflexpb.MultiplexEvent, multiplexBuffer),
+			closed: make(chan struct{}),
+		}
+		m.subs[sub.id] = sub
+		m.mu.Unlock()
+
+		err = m.send(&reflexpb.MultiplexRequest{
+			Id:     sub.id,
+			Stream: name,
+			Request: &reflexpb.StreamRequest{
+				After:   after,
+				Options: optionspb,
+			},
+		})
+		if err != nil {
+			m.remove(sub.id)
+			return nil, err
+		}
+
+		return sub, nil
+	}
+}
+
+func (m *Multiplexer) send(req *reflexpb.MultiplexRequest) error {
+	m.sendMu.Lock()
+	defer m.sendMu.Unlock()
+
+	select {
+	case <-m.done:
+		return m.err
+	default:
+	}
+
+	if err := m.mcpb.Send(req); err != nil {
+		return errors.Wrap(err, "send multiplex request error")
+	}
+
+	return nil
+}
+
+func (m *Multiplexer) remove(id int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.subs, id)
+}
+
+// demux receives events and routes them to the subscriptions
+// until the gRPC stream errors.
+func (m *Multiplexer) demux() {
+	for {
+		e, err := m.mcpb.Recv()
+		if err != nil {
+			m.err = errors.Wrap(err, "recv multiplex event error")
+			close(m.done)
+			return
+		}
+
+		m.mu.Lock()
+		sub, ok := m.subs[e.Id]
+		m.mu.Unlock()
+		if !ok {
+			// Subscription closed.
+			continue
+		}
+
+		select {
+		case sub.ch <- e:
+		case <-sub.closed:
+		}
+	}
+}
+
+// muxClient is a multiplexed stream client.
+type muxClient struct {
+	m      *Multiplexer
+	id     int64
+	ctx    context.Context
+	ch     chan *reflexpb.MultiplexEvent
+	err    error
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (c *muxClient) Recv() (*Event, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	select {
+	case <-c.ctx.Done():
+		c.err = c.ctx.Err()
+		_ = c.Close()
+		return nil, c.err
+	case <-c.m.done:
+		c.err = c.m.err
+		return nil, c.err
+	case e := <-c.ch:
+		if e.Error != "" {
+			c.err = errFromMultiplex(e)
+			c.m.remove(c.id)
+			return nil, c.err
+		}
+		return eventFromProto(e.Event)
+	}
+}
+
+// Close cancels the subscription.
+func (c *muxClient) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.closed)
+		c.m.remove(c.id)
+		err = c.m.send(&reflexpb.MultiplexRequest{Id: c.id, Cancel: true})
+	})
+	return err
+}
+
+// errFromMultiplex returns the subscription error with the jettison
+// error codes so that errors.Is works for errors like ErrHeadReached.
+func errFromMultiplex(e *reflexpb.MultiplexEvent) error {
+	if len(e.Codes) == 0 {
+		return errors.New(e.Error)
+	}
+
+	// Codes are ordered from the latest wrapped error.
+	err := errors.New(e.Error, j.C(e.Codes[len(e.Codes)-1]))
+	for i := len(e.Codes) - 2; i >= 0; i-- {
+		err = errors.Wrap(err, "", j.C(e.Codes[i]))
+	}
+
+	return err
+}
@@ -0,0 +1,70 @@
+package reflex_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/grpctest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiplex(t *testing.T) {
+	users := newMockStreamer(nil, reflex.ErrHeadReached)
+	orders := newMockStreamer(nil, nil)
+	for _, id := range []string{"1", "2", "3"} {
+		users.AddEvents(&reflex.Event{ID: id, ForeignID: "user" + id, Type: TestEventType(1), Timestamp: time.Now()})
+		orders.AddEvents(&reflex.Event{ID: id, ForeignID: "order" + id, Type: TestEventType(2), Timestamp: time.Now()})
+	}
+
+	srv, url := grpctest.NewServer(t, users.Stream, nil)
+	defer srv.Stop()
+	srv.Registry().Register("orders", orders.Stream, nil)
+
+	cl := grpctest.NewClient(t, url)
+	defer cl.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m, err := cl.Multiplexer(ctx)
+	jtest.RequireNil(t, err)
+
+	usc, err := m.StreamFunc(grpctest.DefaultStream)(ctx, "1")
+	jtest.RequireNil(t, err)
+	osc, err := m.StreamFunc("orders")(ctx, "")
+	jtest.RequireNil(t, err)
+
+	for _, id := range []string{"1", "2", "3"} {
+		e, err := osc.Recv()
+		jtest.RequireNil(t, err)
+		require.Equal(t, "order"+id, e.ForeignID)
+	}
+
+	for _, id := range []string{"2", "3"} {
+		e, err := usc.Recv()
+		jtest.RequireNil(t, err)
+		require.Equal(t, "user"+id, e.ForeignID)
+	}
+	_, err = usc.Recv()
+	jtest.Require(t, reflex.ErrHeadReached, err)
+
+	// Close the blocking orders stream.
+	jtest.RequireNil(t, osc.(io.Closer).Close())
+
+	// Unknown stream.
+	sc, err := m.StreamFunc("unknown")(ctx, "")
+	jtest.RequireNil(t, err)
+	_, err = sc.Recv()
+	require.Error(t, err)
+
+	// New subscriptions on the same multiplexer.
+	usc, err = m.StreamFunc(grpctest.DefaultStream)(ctx, "2")
+	jtest.RequireNil(t, err)
+	e, err := usc.Recv()
+	jtest.RequireNil(t, err)
+	require.Equal(t, "user3", e.ForeignID)
+}
@@ -1,6 +1,7 @@
 package reflex
 
 import (
+	"strings"
 	"time"
 )
 
@@ -15,8 +16,82 @@ type StreamOptions struct {
 	StreamFromHead bool
 
 	// StreamToHead defines that ErrHeadReached be returned as soon
-	// as no more events are available.
+	// as no more events are available or once the head at the start
+	// of the stream is reached.
 	StreamToHead bool
+
+	// StreamFromTime defines that the initial event be the first event
+	// at or after the time.
+	StreamFromTime time.Time
+
+	// StreamDescending defines that events be streamed newest-first.
+	StreamDescending bool
+
+	// StreamUntilCursor defines that ErrHeadReached be returned after
+	// the event with this cursor.
+	StreamUntilCursor string
+
+	// StreamUntilTime defines that ErrHeadReached be returned instead
+	// of the first event at or after the time.
+	StreamUntilTime time.Time
+
+	// StreamTypes defines that only events of these types be streamed.
+	StreamTypes []EventType
+
+	// StreamForeignIDPrefix defines that only events with foreign IDs
+	// starting with this prefix be streamed.
+	StreamForeignIDPrefix string
+
+	// StreamForeignKeys defines that only events with these foreign key
+	// values be streamed.
+	StreamForeignKeys map[string]string
+
+	// StreamHeaders defines that only events with these header
+	// values be streamed.
+	StreamHeaders map[string]string
+
+	// StreamTenant defines that only events of this tenant be streamed.
+	StreamTenant string
+
+	// StreamHeartbeat defines the interval of heartbeats sent by gRPC
+	// servers when no events are sent.
+	StreamHeartbeat time.Duration
+}
+
+// Match returns true if the event matches the stream filters, see
+// WithStreamTypes, WithStreamForeignIDPrefix, WithStreamForeignKey,
+// WithStreamHeader and WithTenant.
+func (o StreamOptions) Match(e *Event) bool {
+	if len(o.StreamTypes) > 0 && !IsAnyType(e.Type, o.StreamTypes...) {
+		return false
+	}
+	if o.StreamTenant != "" && e.TenantID != o.StreamTenant {
+		return false
+	}
+	if !containsAll(e.ForeignKeys, o.StreamForeignKeys) || !containsAll(e.Headers, o.StreamHeaders) {
+		return false
+	}
+	return strings.HasPrefix(e.ForeignID, o.StreamForeignIDPrefix)
+}
+
+// containsAll returns true if m contains all the key values of sub.
+func containsAll(m, sub map[string]string) bool {
+	for key, val := range sub {
+		if v, ok := m[key]; !ok || v != val {
+			return false
+		}
+	}
+	return true
+}
+
+// withKey returns a copy of m with the key value added.
+func withKey(m map[string]string, key, val string) map[string]string {
+	res := make(map[string]string, len(m)+1)
+	for k, v := range m {
+		res[k] = v
+	}
+	res[key] = val
+	return res
 }
 
 // StreamOption defines a functional option that configures StreamOptions.
@@ -31,13 +106,112 @@ func WithStreamFromHead() StreamOption {
 }
 
 // WithStreamToHead provides an option to return ErrHeadReached as soon
-// as no more events are available. This is useful for testing or back-fills.
+// as no more events are available. The head is captured when the stream
+// starts, so events inserted afterwards are not streamed. This is useful
+// for testing or back-fills.
 func WithStreamToHead() StreamOption {
 	return func(sc *StreamOptions) {
 		sc.StreamToHead = true
 	}
 }
 
+// WithStreamFromTime provides an option to stream events starting from the
+// first event at or after the provided time. This is useful for back-fills
+// that need to start at a specific time rather than a specific event.
+// Note this overrides the "after" parameter.
+func WithStreamFromTime(t time.Time) StreamOption {
+	return func(sc *StreamOptions) {
+		sc.StreamFromTime = t
+	}
+}
+
+// WithStreamDescending provides an option to stream events newest-first
+// starting at the current head. The "after" parameter defines the optional
+// floor cursor; only events after it are streamed. ErrHeadReached is returned
+// once the floor (or the first event) is reached. Note that new events are not
+// streamed and that descending streams are not suitable for reflex.Run since
+// cursors must increase.
+func WithStreamDescending() StreamOption {
+	return func(sc *StreamOptions) {
+		sc.StreamDescending = true
+	}
+}
+
+// WithStreamUntil provides an option to return ErrHeadReached after the
+// event with the provided cursor has been streamed. Unlike WithStreamToHead
+// it blocks waiting for events until the cursor is reached. This is useful
+// for deterministic batch jobs and migrations.
+func WithStreamUntil(cursor string) StreamOption {
+	return func(sc *StreamOptions) {
+		sc.StreamUntilCursor = cursor
+	}
+}
+
+// WithStreamUntilTime provides an option to return ErrHeadReached instead
+// of streaming the first event at or after the provided time.
+func WithStreamUntilTime(t time.Time) StreamOption {
+	return func(sc *StreamOptions) {
+		sc.StreamUntilTime = t
+	}
+}
+
+// WithStreamTypes provides an option to only stream events of the provided
+// types. Filtering is done by the stream source, so remote (gRPC) consumers
+// do not receive the other events over the network.
+func WithStreamTypes(types ...EventType) StreamOption {
+	return func(sc *StreamOptions) {
+		sc.StreamTypes = types
+	}
+}
+
+// WithStreamForeignIDPrefix provides an option to only stream events with
+// foreign IDs starting with the prefix. See WithStreamTypes for details.
+func WithStreamForeignIDPrefix(prefix string) StreamOption {
+	return func(sc *StreamOptions) {
+		sc.StreamForeignIDPrefix = prefix
+	}
+}
+
+// WithStreamForeignKey provides an option to only stream events with the
+// foreign key value, e.g. WithStreamForeignKey("account_id", "123"). Multiple
+// options must all match. See WithStreamTypes for details.
+func WithStreamForeignKey(key, value string) StreamOption {
+	return func(sc *StreamOptions) {
+		sc.StreamForeignKeys = withKey(sc.StreamForeignKeys, key, value)
+	}
+}
+
+// WithStreamHeader provides an option to only stream events with the header
+// value, e.g. WithStreamHeader("tenant_id", "123"). Multiple options must all
+// match. Unlike the other filters, header filters are applied after loading
+// events, but remote (gRPC) consumers still do not receive the other events.
+func WithStreamHeader(key, value string) StreamOption {
+	return func(sc *StreamOptions) {
+		sc.StreamHeaders = withKey(sc.StreamHeaders, key, value)
+	}
+}
+
+// WithTenant provides an option to only stream events of the tenant from
+// multi-tenant event sources. Like WithStreamTypes, the stream source scopes
+// its queries to the tenant, so other tenants' events are never sent.
+func WithTenant(id string) StreamOption {
+	return func(sc *StreamOptions) {
+		sc.StreamTenant = id
+	}
+}
+
+// WithStreamHeartbeat provides an option for gRPC streams (see WrapStreamPB)
+// to request heartbeats from the server at the interval when no events are
+// sent. The stream returns ErrHeartbeatTimeout if no events or heartbeats are
+// received for three intervals, so half-open connections fail the stream
+// instead of looking like no events. Servers that do not negotiate
+// CapabilityHeartbeats and other stream sources ignore it.
+func WithStreamHeartbeat(d time.Duration) StreamOption {
+	return func(sc *StreamOptions) {
+		sc.StreamHeartbeat = d
+	}
+}
+
 // WithStreamLag provides an option to stream events only after they are older than a duration.
 func WithStreamLag(d time.Duration) StreamOption {
 	return func(sc *StreamOptions) {
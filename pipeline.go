@@ -0,0 +1,349 @@
+package reflex
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/luno/fate"
+)
+
+// NewPipeline returns a new pipeline of the stream without any stages.
+func NewPipeline(stream StreamFunc) *Pipeline {
+	return &Pipeline{stream: stream}
+}
+
+// Pipeline composes stages that transform the events of a stream before they
+// are consumed, so consumers need not embed filtering, decoding, batching or
+// rate limiting. Stages are applied in the order they are added.
+//
+//	p := reflex.NewPipeline(table.ToStream(dbc)).
+//		FilterTypes(TypeCreated).
+//		Map(decode).
+//		Batch(100, time.Second)
+//	spec := p.Spec(cstore, "batch_consumer", fn)
+//
+// Note that filtered events are not consumed, so the cursor only
+// advances on the next consumed event.
+type Pipeline struct {
+	stream StreamFunc
+	stages []stage
+
+	batchSize int
+	batchWait time.Duration
+}
+
+// stage wraps a stream client.
+type stage func(ctx context.Context, sc StreamClient) StreamClient
+
+// Filter adds a stage that only streams events for which fn returns true.
+func (p *Pipeline) Filter(fn func(*Event) bool) *Pipeline {
+	p.stages = append(p.stages, func(_ context.Context, sc StreamClient) StreamClient {
+		return &filterStream{StreamClient: sc, fn: fn}
+	})
+	return p
+}
+
+// FilterTypes adds a stage that only streams events of the types.
+func (p *Pipeline) FilterTypes(types ...EventType) *Pipeline {
+	return p.Filter(func(e *Event) bool {
+		return IsAnyType(e.Type, types...)
+	})
+}
+
+// Map adds a stage that streams the events returned by fn, e.g. with decoded
+// metadata. Errors returned by fn are returned by Recv. Note the ID of the
+// returned event should not be modified since it is used as the cursor.
+func (p *Pipeline) Map(fn func(*Event) (*Event, error)) *Pipeline {
+	p.stages = append(p.stages, func(_ context.Context, sc StreamClient) StreamClient {
+		return &mapStream{StreamClient: sc, fn: fn}
+	})
+	return p
+}
+
+// Throttle adds a stage that limits the rate of events by streaming at
+// most one event per period.
+func (p *Pipeline) Throttle(period time.Duration) *Pipeline {
+	p.stages = append(p.stages, func(ctx context.Context, sc StreamClient) StreamClient {
+		return &throttleStream{StreamClient: sc, ctx: ctx, period: period}
+	})
+	return p
+}
+
+// Batch configures batches of up to size events of the spec returned by Spec.
+// A batch is consumed when it is full or wait elapsed since its first event.
+// Batching is the last stage and does not apply to Stream.
+func (p *Pipeline) Batch(size int, wait time.Duration) *Pipeline {
+	p.batchSize = size
+	p.batchWait = wait
+	return p
+}
+
+// Stream implements StreamFunc and returns a StreamClient of the
+// events after the cursor with all the stages applied except batching.
+func (p *Pipeline) Stream(ctx context.Context, after string,
+	opts ...StreamOption) (StreamClient, error) {
+
+	sc, err := p.stream(ctx, after, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range p.stages {
+		sc = s(ctx, sc)
+	}
+
+	return sc, nil
+}
+
+// Spec returns a spec for Run that consumes batches of the pipeline events
+// with fn. Batches contain a single event if Batch is not configured. The
+// cursor is set to the last event of a batch after fn returns successfully.
+func (p *Pipeline) Spec(cstore CursorStore, name string,
+	fn func(ctx context.Context, f fate.Fate, batch []*Event) error,
+	opts ...StreamOption) Spec {
+
+	b := &batcher{pending: make(map[*Event][]*Event)}
+
+	stream := func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		sc, err := p.Stream(ctx, after, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Reset()
+		if p.batchSize <= 1 {
+			return sc, nil
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		bs := &batchStream{
+			sc:      sc,
+			ctx:     ctx,
+			cancel:  cancel,
+			size:    p.batchSize,
+			wait:    p.batchWait,
+			batcher: b,
+			ch:      make(chan recvResult),
+		}
+		go bs.recvForever()
+
+		return bs, nil
+	}
+
+	consumer := NewConsumer(name, func(ctx context.Context, f fate.Fate, e *Event) error {
+		if err := fn(ctx, f, b.Get(e)); err != nil {
+			// Keep the batch since the consumer may retry the event.
+			return err
+		}
+		b.Delete(e)
+		return nil
+	})
+
+	return NewSpec(stream, cstore, consumer, opts...)
+}
+
+type filterStream struct {
+	StreamClient
+	fn func(*Event) bool
+}
+
+func (s *filterStream) Recv() (*Event, error) {
+	for {
+		e, err := s.StreamClient.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if s.fn(e) {
+			return e, nil
+		}
+	}
+}
+
+func (s *filterStream) Close() error {
+	return closeStream(s.StreamClient)
+}
+
+type mapStream struct {
+	StreamClient
+	fn func(*Event) (*Event, error)
+}
+
+func (s *mapStream) Recv() (*Event, error) {
+	e, err := s.StreamClient.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return s.fn(e)
+}
+
+func (s *mapStream) Close() error {
+	return closeStream(s.StreamClient)
+}
+
+type throttleStream struct {
+	StreamClient
+	ctx    context.Context
+	period time.Duration
+	last   time.Time
+}
+
+func (s *throttleStream) Recv() (*Event, error) {
+	if d := s.period - time.Since(s.last); !s.last.IsZero() && d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-s.ctx.Done():
+			t.Stop()
+			return nil, s.ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	e, err := s.StreamClient.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	s.last = time.Now()
+	return e, nil
+}
+
+func (s *throttleStream) Close() error {
+	return closeStream(s.StreamClient)
+}
+
+type recvResult struct {
+	e   *Event
+	err error
+}
+
+// batchStream streams the last event of each batch of events received
+// from the underlying stream by a background goroutine.
+type batchStream struct {
+	sc      StreamClient
+	ctx     context.Context
+	cancel  context.CancelFunc
+	size    int
+	wait    time.Duration
+	batcher *batcher
+	ch      chan recvResult
+	err     error
+}
+
+func (s *batchStream) recvForever() {
+	for {
+		e, err := s.sc.Recv()
+		select {
+		case s.ch <- recvResult{e: e, err: err}:
+		case <-s.ctx.Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *batchStream) Recv() (*Event, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var batch []*Event
+	res, err := s.recv(nil)
+	if err != nil {
+		return nil, err
+	} else if res.err != nil {
+		return nil, res.err
+	}
+	batch = append(batch, res.e)
+
+	timer := time.NewTimer(s.wait)
+	defer timer.Stop()
+
+	for len(batch) < s.size {
+		res, err := s.recv(timer.C)
+		if err != nil {
+			return nil, err
+		} else if res == nil {
+			// Wait elapsed.
+			break
+		} else if res.err != nil {
+			// Return the error after the batch.
+			s.err = res.err
+			break
+		}
+		batch = append(batch, res.e)
+	}
+
+	return s.batcher.Push(batch), nil
+}
+
+// recv returns the next result or nil if the timeout channel fires.
+func (s *batchStream) recv(timeout <-chan time.Time) (*recvResult, error) {
+	select {
+	case res := <-s.ch:
+		return &res, nil
+	case <-timeout:
+		return nil, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func (s *batchStream) Close() error {
+	s.cancel()
+	return closeStream(s.sc)
+}
+
+// batcher tracks the pending batches of consumed events.
+type batcher struct {
+	mu      sync.Mutex
+	pending map[*Event][]*Event
+}
+
+// Push returns a copy of the last event of the batch which
+// identifies the batch.
+func (b *batcher) Push(batch []*Event) *Event {
+	e := *batch[len(batch)-1]
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[&e] = batch
+	return &e
+}
+
+// Get returns the batch identified by the event or a batch
+// of the event itself.
+func (b *batcher) Get(e *Event) []*Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	batch, ok := b.pending[e]
+	if !ok {
+		return []*Event{e}
+	}
+	return batch
+}
+
+// Delete forgets the batch identified by the event.
+func (b *batcher) Delete(e *Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.pending, e)
+}
+
+// Reset forgets all pending batches, e.g. of failed streams.
+func (b *batcher) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = make(map[*Event][]*Event)
+}
+
+func closeStream(sc StreamClient) error {
+	if closer, ok := sc.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package reflex
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineStream(t *testing.T) {
+	errDone := errors.New("no more events")
+	stream := func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		var el []*Event
+		for i := 1; i <= 6; i++ {
+			el = append(el, &Event{ID: strconv.Itoa(i), Type: eventType(i % 2)})
+		}
+		return &mockstreamclient{Events: el, EndError: errDone}, nil
+	}
+
+	p := NewPipeline(stream).
+		FilterTypes(eventType(1)).
+		Map(func(e *Event) (*Event, error) {
+			res := *e
+			res.MetaData = []byte("mapped")
+			return &res, nil
+		}).
+		Throttle(time.Millisecond * 10)
+
+	sc, err := p.Stream(context.Background(), "")
+	jtest.RequireNil(t, err)
+
+	t0 := time.Now()
+	var ids []string
+	for {
+		e, err := sc.Recv()
+		if errors.Is(err, errDone) {
+			break
+		}
+		jtest.RequireNil(t, err)
+		require.Equal(t, []byte("mapped"), e.MetaData)
+		ids = append(ids, e.ID)
+	}
+	require.Equal(t, []string{"1", "3", "5"}, ids)
+	require.True(t, time.Since(t0) >= time.Millisecond*20)
+}
+
+func TestPipelineBatch(t *testing.T) {
+	errDone := errors.New("no more events")
+	stream := func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		var el []*Event
+		for i := 1; i <= 5; i++ {
+			el = append(el, &Event{ID: strconv.Itoa(i), Type: eventType(1)})
+		}
+		return &mockstreamclient{Events: el, EndError: errDone}, nil
+	}
+
+	var batches [][]string
+	cstore := new(memcursor)
+	spec := NewPipeline(stream).Batch(2, time.Minute).Spec(cstore, "batch_test",
+		func(ctx context.Context, f fate.Fate, batch []*Event) error {
+			var ids []string
+			for _, e := range batch {
+				ids = append(ids, e.ID)
+			}
+			batches = append(batches, ids)
+			return nil
+		})
+
+	err := Run(context.Background(), spec)
+	jtest.Require(t, errDone, err)
+	require.Equal(t, [][]string{{"1", "2"}, {"3", "4"}, {"5"}}, batches)
+	require.Equal(t, "5", cstore.cursor)
+}
+
+type memcursor struct {
+	cursor string
+}
+
+func (m *memcursor) GetCursor(ctx context.Context, consumerName string) (string, error) {
+	return m.cursor, nil
+}
+
+func (m *memcursor) SetCursor(ctx context.Context, consumerName string, cursor string) error {
+	m.cursor = cursor
+	return nil
+}
+
+func (m *memcursor) Flush(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,144 @@
+package reflex
+
+import (
+	"context"
+	"sync"
+)
+
+// WithRunPrefetch provides an option to decouple receiving events from
+// consuming them. A background goroutine keeps a buffer of up to size
+// events full while the consumer consumes the previous events. This improves
+// throughput of slow consumers on high latency streams without changing
+// semantics since events are still consumed in order and cursors are only
+// set after consuming them.
+func WithRunPrefetch(size int) RunOption {
+	return func(o *runOptions) {
+		o.prefetch = size
+	}
+}
+
+// WithRunPrefetchBytes provides an option to limit the prefetch buffer by
+// the total size of the buffered event metadata in bytes, see WithRunPrefetch.
+// A single event is always buffered even if it is larger than the limit.
+func WithRunPrefetchBytes(n int) RunOption {
+	return func(o *runOptions) {
+		o.prefetchBytes = n
+	}
+}
+
+// newPrefetchStream returns a stream client that receives events from the
+// underlying stream client in a background goroutine until the context
+// is canceled.
+func newPrefetchStream(ctx context.Context, sc StreamClient, size, maxBytes int) *prefetchStream {
+	s := &prefetchStream{
+		sc:       sc,
+		ctx:      ctx,
+		size:     size,
+		maxBytes: maxBytes,
+		pushed:   make(chan struct{}, 1),
+		popped:   make(chan struct{}, 1),
+	}
+	go s.recvForever()
+	return s
+}
+
+type prefetchStream struct {
+	sc       StreamClient
+	ctx      context.Context
+	size     int
+	maxBytes int
+
+	pushed chan struct{}
+	popped chan struct{}
+
+	mu    sync.Mutex
+	buf   []*Event
+	bytes int
+	err   error
+}
+
+// full returns true if the buffer is full. It must be called with the mutex held.
+func (s *prefetchStream) full() bool {
+	if len(s.buf) == 0 {
+		return false
+	}
+	if s.size > 0 && len(s.buf) >= s.size {
+		return true
+	}
+	return s.maxBytes > 0 && s.bytes >= s.maxBytes
+}
+
+func (s *prefetchStream) recvForever() {
+	for {
+		for {
+			s.mu.Lock()
+			full := s.full()
+			s.mu.Unlock()
+			if !full {
+				break
+			}
+
+			select {
+			case <-s.popped:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+
+		e, err := s.sc.Recv()
+
+		s.mu.Lock()
+		if err != nil {
+			s.err = err
+		} else {
+			s.buf = append(s.buf, e)
+			s.bytes += len(e.MetaData)
+		}
+		s.mu.Unlock()
+
+		signal(s.pushed)
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *prefetchStream) Recv() (*Event, error) {
+	for {
+		s.mu.Lock()
+		if len(s.buf) > 0 {
+			e := s.buf[0]
+			s.buf[0] = nil
+			s.buf = s.buf[1:]
+			s.bytes -= len(e.MetaData)
+			s.mu.Unlock()
+
+			signal(s.popped)
+			return e, nil
+		} else if s.err != nil {
+			err := s.err
+			s.mu.Unlock()
+			return nil, err
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.pushed:
+		case <-s.ctx.Done():
+			return nil, s.ctx.Err()
+		}
+	}
+}
+
+func (s *prefetchStream) Close() error {
+	return closeStream(s.sc)
+}
+
+// signal notifies the channel without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,91 @@
+package reflex
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPrefetch(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []RunOption
+		recv int64 // Expected received events while consuming the first.
+	}{
+		{
+			name: "size",
+			opts: []RunOption{WithRunPrefetch(3)},
+			recv: 4,
+		}, {
+			name: "bytes",
+			opts: []RunOption{WithRunPrefetchBytes(15)},
+			recv: 3,
+		}, {
+			name: "size and bytes",
+			opts: []RunOption{WithRunPrefetch(1), WithRunPrefetchBytes(100)},
+			recv: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errDone := errors.New("no more events")
+			var el []*Event
+			for i := 1; i <= 10; i++ {
+				el = append(el, &Event{ID: strconv.Itoa(i), MetaData: make([]byte, 10)})
+			}
+			sc := &countingstreamclient{sc: &mockstreamclient{Events: el, EndError: errDone}}
+
+			unblock := make(chan struct{})
+			var ids []string
+			consumer := NewConsumer("prefetch", func(ctx context.Context, f fate.Fate, e *Event) error {
+				if e.ID == "1" {
+					<-unblock
+				}
+				ids = append(ids, e.ID)
+				return nil
+			})
+
+			spec := NewSpec(func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+				return sc, nil
+			}, new(memcursor), consumer)
+
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- Run(context.Background(), spec, test.opts...)
+			}()
+
+			require.Eventually(t, func() bool {
+				return atomic.LoadInt64(&sc.count) == test.recv
+			}, time.Second, time.Millisecond)
+
+			time.Sleep(time.Millisecond * 10)
+			require.Equal(t, test.recv, atomic.LoadInt64(&sc.count))
+
+			close(unblock)
+			jtest.Require(t, errDone, <-errCh)
+			require.Len(t, ids, 10)
+			require.Equal(t, "10", ids[9])
+		})
+	}
+}
+
+type countingstreamclient struct {
+	sc    StreamClient
+	count int64
+}
+
+func (c *countingstreamclient) Recv() (*Event, error) {
+	e, err := c.sc.Recv()
+	if err == nil {
+		atomic.AddInt64(&c.count, 1)
+	}
+	return e, err
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/protoc-gen-go/generator"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+const enumSuffix = "EventType"
+
+// generate returns the response with a reflex file per proto file
+// to generate that contains event type enums.
+func generate(req *plugin.CodeGeneratorRequest) (*plugin.CodeGeneratorResponse, error) {
+	files := make(map[string]*descpb.FileDescriptorProto)
+	for _, f := range req.ProtoFile {
+		files[f.GetName()] = f
+	}
+
+	var res plugin.CodeGeneratorResponse
+	for _, name := range req.FileToGenerate {
+		f, ok := files[name]
+		if !ok {
+			return nil, errors.New("file to generate not found", j.KS("file", name))
+		}
+
+		content, ok, err := generateFile(f)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KS("file", name))
+		} else if !ok {
+			continue
+		}
+
+		res.File = append(res.File, &plugin.CodeGeneratorResponse_File{
+			Name:    proto.String(strings.TrimSuffix(name, ".proto") + ".reflex.go"),
+			Content: proto.String(content),
+		})
+	}
+
+	return &res, nil
+}
+
+type fileData struct {
+	Source  string
+	Package string
+	Enums   []enumData
+	Payload bool // Whether any event has a payload.
+}
+
+type enumData struct {
+	Name   string
+	Events []eventData
+}
+
+type eventData struct {
+	Name    string // Helper name, e.g. UserCreated.
+	Value   string // Go enum value, e.g. UserEventType_USER_CREATED.
+	Payload string // Go payload message type, empty if none.
+}
+
+// generateFile returns the generated file content or false
+// if the file doesn't contain event type enums.
+func generateFile(f *descpb.FileDescriptorProto) (string, bool, error) {
+	messages := make(map[string]bool)
+	for _, m := range f.MessageType {
+		messages[generator.CamelCase(m.GetName())] = true
+	}
+
+	data := fileData{
+		Source:  f.GetName(),
+		Package: goPackage(f),
+	}
+
+	names := make(map[string]string)
+	for _, e := range f.EnumType {
+		if !strings.HasSuffix(e.GetName(), enumSuffix) {
+			continue
+		}
+
+		enum := enumData{Name: generator.CamelCase(e.GetName())}
+		prefix := upperSnake(e.GetName()) + "_"
+		for _, v := range e.Value {
+			if v.GetNumber() == 0 {
+				continue
+			}
+
+			name := camel(strings.TrimPrefix(v.GetName(), prefix))
+			if other, ok := names[name]; ok {
+				return "", false, errors.New("duplicate event name",
+					j.MKV{"name": name, "enum": enum.Name, "other": other})
+			}
+			names[name] = enum.Name
+
+			event := eventData{
+				Name:  name,
+				Value: enum.Name + "_" + v.GetName(),
+			}
+			if messages[name] {
+				event.Payload = name
+				data.Payload = true
+			}
+
+			enum.Events = append(enum.Events, event)
+		}
+
+		if len(enum.Events) > 0 {
+			data.Enums = append(data.Enums, enum)
+		}
+	}
+
+	if len(data.Enums) == 0 {
+		return "", false, nil
+	}
+
+	var buf bytes.Buffer
+	if err := fileTmpl.Execute(&buf, data); err != nil {
+		return "", false, err
+	}
+
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return "", false, errors.Wrap(err, "format error")
+	}
+
+	return string(b), true, nil
+}
+
+// goPackage returns the go package name of the file.
+func goPackage(f *descpb.FileDescriptorProto) string {
+	if pkg := f.GetOptions().GetGoPackage(); pkg != "" {
+		if i := strings.LastIndex(pkg, ";"); i >= 0 {
+			return pkg[i+1:]
+		}
+		return strings.Replace(path.Base(pkg), "-", "_", -1)
+	}
+	if f.GetPackage() != "" {
+		return strings.Replace(f.GetPackage(), ".", "_", -1)
+	}
+	return strings.TrimSuffix(path.Base(f.GetName()), ".proto")
+}
+
+// upperSnake returns the UPPER_SNAKE case of the CamelCase name,
+// e.g. UserEventType returns USER_EVENT_TYPE.
+func upperSnake(name string) string {
+	var res []rune
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			res = append(res, '_')
+		}
+		res = append(res, r)
+	}
+	return strings.ToUpper(string(res))
+}
+
+// camel returns the CamelCase of the UPPER_SNAKE name,
+// e.g. USER_CREATED returns UserCreated.
+func camel(name string) string {
+	var res string
+	for _, part := range strings.Split(strings.ToLower(name), "_") {
+		if part == "" {
+			continue
+		}
+		res += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return res
+}
+
+var fileTmpl = template.Must(template.New("file").Parse(`// Code generated by protoc-gen-reflex. DO NOT EDIT.
+// source: {{.Source}}
+
+package {{.Package}}
+
+import (
+	"context"
+	"database/sql"
+
+	{{if .Payload}}"github.com/golang/protobuf/proto"
+	{{end}}"github.com/luno/fate"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rsql"
+)
+{{range $enum := .Enums}}
+// ReflexType implements reflex.EventType.
+func (x {{.Name}}) ReflexType() int {
+	return int(x)
+}
+{{range .Events}}
+{{if .Payload}}// Insert{{.Name}} inserts a {{.Value}} event with the payload as metadata.
+func Insert{{.Name}}(ctx context.Context, tx *sql.Tx, table *rsql.EventsTable,
+	foreignID string, payload *{{.Payload}}) (rsql.NotifyFunc, error) {
+	return table.InsertProto(ctx, tx, foreignID, {{.Value}}, payload)
+}
+{{else}}// Insert{{.Name}} inserts a {{.Value}} event.
+func Insert{{.Name}}(ctx context.Context, tx *sql.Tx, table *rsql.EventsTable,
+	foreignID string) (rsql.NotifyFunc, error) {
+	return table.Insert(ctx, tx, foreignID, {{.Value}})
+}
+{{end}}{{end}}
+// {{.Name}}Handlers define the handlers of {{.Name}} events by type.
+// Events without a handler are ignored.
+type {{.Name}}Handlers struct {
+{{range .Events}}{{if .Payload}}	{{.Name}} func(ctx context.Context, f fate.Fate, e *reflex.Event, payload *{{.Payload}}) error
+{{else}}	{{.Name}} func(ctx context.Context, f fate.Fate, e *reflex.Event) error
+{{end}}{{end}}}
+
+// New{{.Name}}Consumer returns a reflex consumer that calls the handler
+// of each event by type with the unmarshalled payload.
+func New{{.Name}}Consumer(name string, h {{.Name}}Handlers,
+	opts ...reflex.ConsumerOption) reflex.Consumer {
+	return reflex.NewConsumer(name, func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+		switch e.Type.ReflexType() {
+{{range .Events}}		case int({{.Value}}):
+			if h.{{.Name}} == nil {
+				return nil
+			}
+{{if .Payload}}			var payload {{.Payload}}
+			if err := proto.Unmarshal(e.MetaData, &payload); err != nil {
+				return err
+			}
+			return h.{{.Name}}(ctx, f, e, &payload)
+{{else}}			return h.{{.Name}}(ctx, f, e)
+{{end}}{{end}}		}
+		return nil
+	}, opts...)
+}
+{{end}}`))
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	req := &plugin.CodeGeneratorRequest{
+		FileToGenerate: []string{"users/users.proto"},
+		ProtoFile: []*descpb.FileDescriptorProto{
+			{
+				Name:    proto.String("users/users.proto"),
+				Package: proto.String("users"),
+				Options: &descpb.FileOptions{GoPackage: proto.String("example.com/users/userspb")},
+				EnumType: []*descpb.EnumDescriptorProto{
+					{
+						Name: proto.String("UserEventType"),
+						Value: []*descpb.EnumValueDescriptorProto{
+							{Name: proto.String("USER_EVENT_TYPE_UNKNOWN"), Number: proto.Int32(0)},
+							{Name: proto.String("USER_EVENT_TYPE_USER_CREATED"), Number: proto.Int32(1)},
+							{Name: proto.String("USER_EVENT_TYPE_USER_DELETED"), Number: proto.Int32(2)},
+						},
+					}, {
+						Name: proto.String("Status"),
+						Value: []*descpb.EnumValueDescriptorProto{
+							{Name: proto.String("ACTIVE"), Number: proto.Int32(1)},
+						},
+					},
+				},
+				MessageType: []*descpb.DescriptorProto{
+					{Name: proto.String("UserCreated")},
+				},
+			},
+		},
+	}
+
+	res, err := generate(req)
+	jtest.RequireNil(t, err)
+	require.Len(t, res.File, 1)
+	require.Equal(t, "users/users.reflex.go", res.File[0].GetName())
+
+	content := res.File[0].GetContent()
+	_, err = parser.ParseFile(token.NewFileSet(), "", content, 0)
+	jtest.RequireNil(t, err)
+
+	for _, s := range []string{
+		"package userspb",
+		"func (x UserEventType) ReflexType() int",
+		"func InsertUserCreated(ctx context.Context, tx *sql.Tx, table *rsql.EventsTable,\n\tforeignID string, payload *UserCreated) (rsql.NotifyFunc, error)",
+		"table.InsertProto(ctx, tx, foreignID, UserEventType_USER_EVENT_TYPE_USER_CREATED, payload)",
+		"func InsertUserDeleted(ctx context.Context, tx *sql.Tx, table *rsql.EventsTable,\n\tforeignID string) (rsql.NotifyFunc, error)",
+		"UserCreated func(ctx context.Context, f fate.Fate, e *reflex.Event, payload *UserCreated) error",
+		"UserDeleted func(ctx context.Context, f fate.Fate, e *reflex.Event) error",
+		"func NewUserEventTypeConsumer(name string, h UserEventTypeHandlers,",
+		"case int(UserEventType_USER_EVENT_TYPE_USER_DELETED):",
+	} {
+		require.Contains(t, content, s)
+	}
+	require.NotContains(t, content, "Unknown")
+	require.NotContains(t, content, "Status")
+}
+
+func TestGenerateNoEvents(t *testing.T) {
+	res, err := generate(&plugin.CodeGeneratorRequest{
+		FileToGenerate: []string{"a.proto"},
+		ProtoFile:      []*descpb.FileDescriptorProto{{Name: proto.String("a.proto")}},
+	})
+	jtest.RequireNil(t, err)
+	require.Empty(t, res.File)
+}
+
+func TestNames(t *testing.T) {
+	require.Equal(t, "USER_EVENT_TYPE", upperSnake("UserEventType"))
+	require.Equal(t, "UserCreated", camel("USER_CREATED"))
+	require.Equal(t, "UserCreated", camel("user__created"))
+}
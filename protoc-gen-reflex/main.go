@@ -0,0 +1,56 @@
+// Command protoc-gen-reflex is a protoc plugin that generates strongly typed
+// reflex helpers from proto event definitions, replacing hand-maintained
+// event type int constants. Usage:
+//
+//	protoc --go_out=. --reflex_out=. events.proto
+//
+// Enums with names ending in "EventType" define event types. An event type
+// value is bound to the payload message with the CamelCase name of the value
+// (without the enum prefix), e.g. the USER_CREATED value of UserEventType is
+// bound to the UserCreated message. Zero (unknown) values are ignored.
+//
+// For each event type enum it generates a ReflexType method implementing
+// reflex.EventType, Insert<Value> functions inserting events (with
+// proto payloads as metadata) into an rsql.EventsTable and a
+// New<Enum>Consumer function returning a reflex consumer that calls
+// handlers by event type with the unmarshalled payloads.
+//
+// The generated files are written next to the proto files with a
+// ".reflex.go" suffix, i.e. source relative like protoc-gen-go's
+// paths=source_relative option.
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+)
+
+func main() {
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		log.Fatalf("read request error: %v", err)
+	}
+
+	var req plugin.CodeGeneratorRequest
+	if err := proto.Unmarshal(b, &req); err != nil {
+		log.Fatalf("unmarshal request error: %v", err)
+	}
+
+	res, err := generate(&req)
+	if err != nil {
+		res = &plugin.CodeGeneratorResponse{Error: proto.String(err.Error())}
+	}
+
+	b, err = proto.Marshal(res)
+	if err != nil {
+		log.Fatalf("marshal response error: %v", err)
+	}
+
+	if _, err := os.Stdout.Write(b); err != nil {
+		log.Fatalf("write response error: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package reflex
+
+import (
+	"strconv"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex/reflexpb"
+	"google.golang.org/grpc/metadata"
+)
+
+// ProtocolVersion is the version of the gRPC stream protocol implemented
+// by WrapStreamPB and Server.Stream. Version 0 is the protocol of clients and
+// servers that do not negotiate.
+const ProtocolVersion = 1
+
+// Capability is an optional feature of the gRPC stream protocol. New
+// features that change the wire format must only be used if negotiated.
+type Capability string
+
+const (
+	// CapabilityFilters defines that the server applies the stream filters,
+	// see WithStreamTypes, WithStreamForeignIDPrefix, WithStreamForeignKey,
+	// WithStreamHeader and WithTenant.
+	CapabilityFilters Capability = "filters"
+
+	// CapabilityFromTime defines support for WithStreamFromTime.
+	CapabilityFromTime Capability = "from_time"
+
+	// CapabilityDescending defines support for WithStreamDescending.
+	CapabilityDescending Capability = "descending"
+
+	// CapabilityUntil defines support for WithStreamUntil and
+	// WithStreamUntilTime.
+	CapabilityUntil Capability = "until"
+
+	// CapabilityHeartbeats defines support for WithStreamHeartbeat.
+	CapabilityHeartbeats Capability = "heartbeats"
+)
+
+// capabilities are the capabilities supported by this version.
+var capabilities = []Capability{
+	CapabilityFilters,
+	CapabilityFromTime,
+	CapabilityDescending,
+	CapabilityUntil,
+	CapabilityHeartbeats,
+}
+
+// gRPC response header keys of the negotiated protocol.
+const (
+	protocolVersionHeader = "reflex-protocol-version"
+	capabilitiesHeader    = "reflex-capabilities"
+)
+
+// Protocol is the gRPC stream protocol negotiated by the client and server.
+// The version is the lower of the client and server versions and the
+// capabilities are those supported by both.
+type Protocol struct {
+	Version      int
+	Capabilities []Capability
+}
+
+// Has returns true if the capability was negotiated.
+func (p Protocol) Has(c Capability) bool {
+	for _, pc := range p.Capabilities {
+		if pc == c {
+			return true
+		}
+	}
+	return false
+}
+
+// ProtocolClient is implemented by stream clients returned by WrapStreamPB.
+type ProtocolClient interface {
+	// Protocol returns the protocol negotiated with the server. It blocks
+	// until the server sends the gRPC response headers. Servers that
+	// negotiate send them immediately, older servers with the first event.
+	Protocol() (Protocol, error)
+}
+
+// negotiate returns the protocol negotiated for the client request.
+func negotiate(req *reflexpb.StreamRequest) Protocol {
+	p := Protocol{Version: int(req.ProtocolVersion)}
+	if p.Version > ProtocolVersion {
+		p.Version = ProtocolVersion
+	}
+
+	for _, c := range req.Capabilities {
+		for _, sc := range capabilities {
+			if Capability(c) == sc {
+				p.Capabilities = append(p.Capabilities, sc)
+			}
+		}
+	}
+
+	return p
+}
+
+// protocolToMD returns the gRPC response headers of the protocol.
+func protocolToMD(p Protocol) metadata.MD {
+	md := metadata.Pairs(protocolVersionHeader, strconv.Itoa(p.Version))
+	for _, c := range p.Capabilities {
+		md.Append(capabilitiesHeader, string(c))
+	}
+	return md
+}
+
+// protocolFromMD returns the protocol of the gRPC response headers.
+// Headers without a protocol version are from servers that do not negotiate.
+func protocolFromMD(md metadata.MD) (Protocol, error) {
+	var p Protocol
+	vals := md.Get(protocolVersionHeader)
+	if len(vals) == 0 {
+		return p, nil
+	}
+
+	v, err := strconv.Atoi(vals[0])
+	if err != nil {
+		return p, errors.Wrap(err, "invalid protocol version")
+	}
+	p.Version = v
+
+	for _, c := range md.Get(capabilitiesHeader) {
+		p.Capabilities = append(p.Capabilities, Capability(c))
+	}
+
+	return p, nil
+}
+
+// protocolRequest returns the capabilities advertised in stream requests.
+func protocolRequest() []string {
+	res := make([]string, 0, len(capabilities))
+	for _, c := range capabilities {
+		res = append(res, string(c))
+	}
+	return res
+}
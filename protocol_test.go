@@ -0,0 +1,263 @@
+package reflex
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/reflexpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *reflexpb.StreamRequest
+		exp  Protocol
+	}{
+		{
+			name: "old client",
+			req:  &reflexpb.StreamRequest{},
+			exp:  Protocol{},
+		},
+		{
+			name: "current client",
+			req: &reflexpb.StreamRequest{
+				ProtocolVersion: ProtocolVersion,
+				Capabilities:    protocolRequest(),
+			},
+			exp: Protocol{Version: ProtocolVersion, Capabilities: capabilities},
+		},
+		{
+			name: "newer client",
+			req: &reflexpb.StreamRequest{
+				ProtocolVersion: ProtocolVersion + 1,
+				Capabilities:    []string{"compression", string(CapabilityUntil)},
+			},
+			exp: Protocol{Version: ProtocolVersion, Capabilities: []Capability{CapabilityUntil}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := negotiate(test.req)
+			require.Equal(t, test.exp, p)
+
+			res, err := protocolFromMD(protocolToMD(p))
+			jtest.RequireNil(t, err)
+			require.Equal(t, test.exp, res)
+		})
+	}
+}
+
+func TestServerStreamProtocol(t *testing.T) {
+	errDone := errors.New("no more events")
+	sFn := func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		return &mockstreamclient{EndError: errDone}, nil
+	}
+
+	ss := &mockheaderserverpb{mockserverpb: mockserverpb{ctx: context.Background()}}
+	err := NewServer().Stream(sFn, &reflexpb.StreamRequest{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    []string{string(CapabilityFilters)},
+	}, ss)
+	jtest.Require(t, errDone, err)
+
+	p, err := protocolFromMD(ss.header)
+	jtest.RequireNil(t, err)
+	require.Equal(t, Protocol{Version: 1, Capabilities: []Capability{CapabilityFilters}}, p)
+}
+
+func TestWrapStreamPBProtocol(t *testing.T) {
+	ts, err := ptypes.TimestampProto(time.Now())
+	jtest.RequireNil(t, err)
+
+	events := []*reflexpb.Event{
+		{Id: "1", ForeignId: "user:1", Timestamp: ts},
+		{Id: "2", ForeignId: "order:1", Timestamp: ts},
+		{Id: "3", ForeignId: "user:2", Timestamp: ts},
+	}
+
+	tests := []struct {
+		name     string
+		header   metadata.MD
+		protocol Protocol
+		ids      []string
+	}{
+		{
+			name:     "old server",
+			header:   metadata.MD{},
+			protocol: Protocol{},
+			ids:      []string{"1", "3"},
+		},
+		{
+			name:     "filtering server",
+			header:   protocolToMD(Protocol{Version: 1, Capabilities: []Capability{CapabilityFilters}}),
+			protocol: Protocol{Version: 1, Capabilities: []Capability{CapabilityFilters}},
+			ids:      []string{"1", "2", "3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var req *reflexpb.StreamRequest
+			stream := WrapStreamPB(func(ctx context.Context,
+				r *reflexpb.StreamRequest) (StreamClientPB, error) {
+				req = r
+				return &mockheaderclientpb{events: events, header: test.header}, nil
+			})
+
+			sc, err := stream(context.Background(), "", WithStreamForeignIDPrefix("user:"))
+			jtest.RequireNil(t, err)
+			require.Equal(t, int32(ProtocolVersion), req.ProtocolVersion)
+			require.Equal(t, protocolRequest(), req.Capabilities)
+
+			var ids []string
+			for {
+				e, err := sc.Recv()
+				if errors.Is(err, errDoneClientPB) {
+					break
+				}
+				jtest.RequireNil(t, err)
+				ids = append(ids, e.ID)
+			}
+			require.Equal(t, test.ids, ids)
+
+			p, err := sc.(ProtocolClient).Protocol()
+			jtest.RequireNil(t, err)
+			require.Equal(t, test.protocol, p)
+		})
+	}
+}
+
+func TestServerStreamHeartbeats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sFn := func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		return blockingstreamclient{ctx: ctx, sc: &mockstreamclient{}}, nil
+	}
+
+	pb, err := optsToProto([]StreamOption{WithStreamHeartbeat(time.Millisecond)})
+	jtest.RequireNil(t, err)
+
+	ss := &mockheaderserverpb{mockserverpb: mockserverpb{ctx: ctx}}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- NewServer().Stream(sFn, &reflexpb.StreamRequest{
+			Options:         pb,
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    protocolRequest(),
+		}, ss)
+	}()
+
+	require.Eventually(t, func() bool {
+		sent := ss.Sent()
+		return len(sent) >= 3 && sent[0].Heartbeat
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	jtest.Require(t, context.Canceled, <-errCh)
+}
+
+func TestWrapStreamPBHeartbeats(t *testing.T) {
+	ts, err := ptypes.TimestampProto(time.Now())
+	jtest.RequireNil(t, err)
+
+	newStream := func(header metadata.MD) StreamFunc {
+		return WrapStreamPB(func(ctx context.Context,
+			r *reflexpb.StreamRequest) (StreamClientPB, error) {
+			return &mockheaderclientpb{
+				ctx:    ctx,
+				header: header,
+				events: []*reflexpb.Event{
+					{Heartbeat: true},
+					{Id: "1", Timestamp: ts},
+					{Heartbeat: true},
+				},
+			}, nil
+		})
+	}
+
+	sc, err := newStream(protocolToMD(negotiate(&reflexpb.StreamRequest{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    protocolRequest(),
+	})))(context.Background(), "", WithStreamHeartbeat(time.Millisecond))
+	jtest.RequireNil(t, err)
+
+	e, err := sc.Recv()
+	jtest.RequireNil(t, err)
+	require.Equal(t, "1", e.ID)
+
+	_, err = sc.Recv()
+	jtest.Require(t, ErrHeartbeatTimeout, err)
+
+	// Heartbeats are not awaited if the server doesn't negotiate them.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	sc, err = newStream(metadata.MD{})(ctx, "", WithStreamHeartbeat(time.Millisecond))
+	jtest.RequireNil(t, err)
+
+	e, err = sc.Recv()
+	jtest.RequireNil(t, err)
+	require.Equal(t, "1", e.ID)
+
+	_, err = sc.Recv()
+	jtest.Require(t, context.DeadlineExceeded, err)
+}
+
+type mockheaderserverpb struct {
+	mockserverpb
+	header metadata.MD
+
+	mu sync.Mutex
+}
+
+func (m *mockheaderserverpb) Send(e *reflexpb.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mockserverpb.Send(e)
+}
+
+func (m *mockheaderserverpb) Sent() []*reflexpb.Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*reflexpb.Event(nil), m.sent...)
+}
+
+func (m *mockheaderserverpb) SendHeader(md metadata.MD) error {
+	m.header = md
+	return nil
+}
+
+var errDoneClientPB = errors.New("no more events")
+
+// mockheaderclientpb returns the events and then blocks until the context
+// is canceled or returns errDoneClientPB if it has no context.
+type mockheaderclientpb struct {
+	ctx    context.Context
+	events []*reflexpb.Event
+	header metadata.MD
+}
+
+func (m *mockheaderclientpb) Recv() (*reflexpb.Event, error) {
+	if len(m.events) == 0 && m.ctx != nil {
+		<-m.ctx.Done()
+		return nil, m.ctx.Err()
+	} else if len(m.events) == 0 {
+		return nil, errDoneClientPB
+	}
+	e := m.events[0]
+	m.events = m.events[1:]
+	return e, nil
+}
+
+func (m *mockheaderclientpb) Header() (metadata.MD, error) {
+	return m.header, nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/luno/reflex/reflexpb"
 )
 
@@ -15,11 +16,14 @@ func eventToProto(e *Event) (*reflexpb.Event, error) {
 	}
 
 	return &reflexpb.Event{
-		Id:        e.ID,
-		ForeignId: e.ForeignID,
-		Type:      int32(e.Type.ReflexType()),
-		Timestamp: ts,
-		Metadata:  e.MetaData,
+		Id:          e.ID,
+		ForeignId:   e.ForeignID,
+		Type:        int32(e.Type.ReflexType()),
+		Timestamp:   ts,
+		Metadata:    e.MetaData,
+		ForeignKeys: e.ForeignKeys,
+		Headers:     e.Headers,
+		TenantId:    e.TenantID,
 	}, nil
 }
 
@@ -30,30 +34,17 @@ func eventFromProto(e *reflexpb.Event) (*Event, error) {
 	}
 
 	return &Event{
-		ID:        e.Id,
-		ForeignID: e.ForeignId,
-		Type:      eventType(e.Type),
-		Timestamp: ts,
-		MetaData:  e.Metadata,
+		ID:          e.Id,
+		ForeignID:   e.ForeignId,
+		Type:        eventType(e.Type),
+		Timestamp:   ts,
+		MetaData:    e.Metadata,
+		ForeignKeys: e.ForeignKeys,
+		Headers:     e.Headers,
+		TenantID:    e.TenantId,
 	}, nil
 }
 
-type streamclientpb struct {
-	StreamClientPB
-}
-
-func (c streamclientpb) Recv() (*Event, error) {
-	e, err := c.StreamClientPB.Recv()
-	if err != nil {
-		return nil, err
-	}
-	return eventFromProto(e)
-}
-
-func streamClientFromProto(sc StreamClientPB) StreamClient {
-	return &streamclientpb{sc}
-}
-
 // optsFromProto returns a slice of StreamOptions converted from the proto
 // message options. Conversion errors are unexpected, so only logged.
 func optsFromProto(options *reflexpb.StreamOptions) []StreamOption {
@@ -79,6 +70,65 @@ func optsFromProto(options *reflexpb.StreamOptions) []StreamOption {
 		opts = append(opts, WithStreamToHead())
 	}
 
+	if options.Descending {
+		opts = append(opts, WithStreamDescending())
+	}
+
+	if options.FromTime != nil {
+		t, err := ptypes.Timestamp(options.FromTime)
+		if err != nil {
+			log.Printf("reflex: Error parsing request option from time: %v", err)
+		} else {
+			opts = append(opts, WithStreamFromTime(t))
+		}
+	}
+
+	if options.UntilCursor != "" {
+		opts = append(opts, WithStreamUntil(options.UntilCursor))
+	}
+
+	if options.UntilTime != nil {
+		t, err := ptypes.Timestamp(options.UntilTime)
+		if err != nil {
+			log.Printf("reflex: Error parsing request option until time: %v", err)
+		} else {
+			opts = append(opts, WithStreamUntilTime(t))
+		}
+	}
+
+	if len(options.Types) > 0 {
+		var types []EventType
+		for _, t := range options.Types {
+			types = append(types, eventType(t))
+		}
+		opts = append(opts, WithStreamTypes(types...))
+	}
+
+	if options.ForeignIDPrefix != "" {
+		opts = append(opts, WithStreamForeignIDPrefix(options.ForeignIDPrefix))
+	}
+
+	for key, val := range options.ForeignKeys {
+		opts = append(opts, WithStreamForeignKey(key, val))
+	}
+
+	for key, val := range options.Headers {
+		opts = append(opts, WithStreamHeader(key, val))
+	}
+
+	if options.Tenant != "" {
+		opts = append(opts, WithTenant(options.Tenant))
+	}
+
+	if options.Heartbeat != nil {
+		d, err := ptypes.Duration(options.Heartbeat)
+		if err != nil {
+			log.Printf("reflex: Error parsing request option heartbeat: %v", err)
+		} else if d > 0 {
+			opts = append(opts, WithStreamHeartbeat(d))
+		}
+	}
+
 	return opts
 }
 
@@ -93,9 +143,47 @@ func optsToProto(opts []StreamOption) (*reflexpb.StreamOptions, error) {
 		lag = ptypes.DurationProto(options.Lag)
 	}
 
+	var fromTime *timestamp.Timestamp
+	if !options.StreamFromTime.IsZero() {
+		var err error
+		fromTime, err = ptypes.TimestampProto(options.StreamFromTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var untilTime *timestamp.Timestamp
+	if !options.StreamUntilTime.IsZero() {
+		var err error
+		untilTime, err = ptypes.TimestampProto(options.StreamUntilTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var heartbeat *duration.Duration
+	if options.StreamHeartbeat > 0 {
+		heartbeat = ptypes.DurationProto(options.StreamHeartbeat)
+	}
+
+	var types []int32
+	for _, t := range options.StreamTypes {
+		types = append(types, int32(t.ReflexType()))
+	}
+
 	return &reflexpb.StreamOptions{
-		Lag:      lag,
-		FromHead: options.StreamFromHead,
-		ToHead:   options.StreamToHead,
+		Lag:             lag,
+		FromHead:        options.StreamFromHead,
+		ToHead:          options.StreamToHead,
+		FromTime:        fromTime,
+		Descending:      options.StreamDescending,
+		UntilCursor:     options.StreamUntilCursor,
+		UntilTime:       untilTime,
+		Types:           types,
+		ForeignIDPrefix: options.StreamForeignIDPrefix,
+		ForeignKeys:     options.StreamForeignKeys,
+		Headers:         options.StreamHeaders,
+		Tenant:          options.StreamTenant,
+		Heartbeat:       heartbeat,
 	}, nil
 }
@@ -45,6 +45,68 @@ func Test_optsToProto(t *testing.T) {
 			Output: StreamOptions{StreamToHead: true},
 			Count:  1,
 		},
+		{
+			Name:   "from time",
+			Input:  []StreamOption{WithStreamFromTime(time.Unix(1577836800, 5).UTC())},
+			Output: StreamOptions{StreamFromTime: time.Unix(1577836800, 5).UTC()},
+			Count:  1,
+		},
+		{
+			Name:   "descending",
+			Input:  []StreamOption{WithStreamDescending()},
+			Output: StreamOptions{StreamDescending: true},
+			Count:  1,
+		},
+		{
+			Name:   "until cursor",
+			Input:  []StreamOption{WithStreamUntil("10")},
+			Output: StreamOptions{StreamUntilCursor: "10"},
+			Count:  1,
+		},
+		{
+			Name:   "until time",
+			Input:  []StreamOption{WithStreamUntilTime(time.Unix(1577836800, 5).UTC())},
+			Output: StreamOptions{StreamUntilTime: time.Unix(1577836800, 5).UTC()},
+			Count:  1,
+		},
+		{
+			Name:   "types",
+			Input:  []StreamOption{WithStreamTypes(eventType(1), eventType(3))},
+			Output: StreamOptions{StreamTypes: []EventType{eventType(1), eventType(3)}},
+			Count:  1,
+		},
+		{
+			Name:   "foreign id prefix",
+			Input:  []StreamOption{WithStreamForeignIDPrefix("user:")},
+			Output: StreamOptions{StreamForeignIDPrefix: "user:"},
+			Count:  1,
+		},
+		{
+			Name: "foreign keys",
+			Input: []StreamOption{WithStreamForeignKey("account_id", "1"),
+				WithStreamForeignKey("entity_id", "2")},
+			Output: StreamOptions{StreamForeignKeys: map[string]string{
+				"account_id": "1", "entity_id": "2"}},
+			Count: 2,
+		},
+		{
+			Name:   "headers",
+			Input:  []StreamOption{WithStreamHeader("tenant_id", "1")},
+			Output: StreamOptions{StreamHeaders: map[string]string{"tenant_id": "1"}},
+			Count:  1,
+		},
+		{
+			Name:   "tenant",
+			Input:  []StreamOption{WithTenant("t1")},
+			Output: StreamOptions{StreamTenant: "t1"},
+			Count:  1,
+		},
+		{
+			Name:   "heartbeat",
+			Input:  []StreamOption{WithStreamHeartbeat(time.Second)},
+			Output: StreamOptions{StreamHeartbeat: time.Second},
+			Count:  1,
+		},
 	}
 
 	for _, test := range tests {
@@ -67,3 +129,23 @@ func Test_optsToProto(t *testing.T) {
 	}
 
 }
+
+func TestEventProto(t *testing.T) {
+	e := &Event{
+		ID:          "1",
+		Type:        eventType(2),
+		ForeignID:   "3",
+		Timestamp:   time.Unix(1577836800, 5).UTC(),
+		MetaData:    []byte("metadata"),
+		ForeignKeys: map[string]string{"account_id": "4"},
+		Headers:     map[string]string{"trace_id": "5"},
+		TenantID:    "t1",
+	}
+
+	pb, err := eventToProto(e)
+	require.NoError(t, err)
+
+	res, err := eventFromProto(pb)
+	require.NoError(t, err)
+	require.Equal(t, e, res)
+}
@@ -0,0 +1,49 @@
+package rcli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+// ShowCursors writes a tab separated line with the name and cursor of
+// each consumer to w. Consumers without a cursor have an empty cursor.
+func ShowCursors(ctx context.Context, w io.Writer, store reflex.CursorStore,
+	consumerNames ...string) error {
+
+	for _, name := range consumerNames {
+		cursor, err := store.GetCursor(ctx, name)
+		if err != nil {
+			return errors.Wrap(err, "get cursor error", j.KS("consumer", name))
+		}
+
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", name, cursor); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResetCursor sets the consumer's cursor to any value, also before the
+// current cursor, and flushes the store. It returns reflex.ErrResetNotSupported
+// if the store doesn't implement reflex.CursorResetter. Note the consumer
+// should be stopped, see reflex.Replay for resetting running consumers.
+func ResetCursor(ctx context.Context, store reflex.CursorStore,
+	consumerName, cursor string) error {
+
+	resetter, ok := store.(reflex.CursorResetter)
+	if !ok {
+		return reflex.ErrResetNotSupported
+	}
+
+	if err := resetter.ResetCursor(ctx, consumerName, cursor); err != nil {
+		return errors.Wrap(err, "reset cursor error", j.KS("consumer", consumerName))
+	}
+
+	return store.Flush(ctx)
+}
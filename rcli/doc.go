@@ -0,0 +1,7 @@
+// Package rcli provides the library behind the reflex command line tool
+// (cmd/reflex) for operational debugging: tailing event streams with
+// formatted metadata and showing and resetting consumer cursors.
+//
+// The functions are decoupled from the sources, so they work with any
+// reflex.StreamFunc and reflex.CursorStore, e.g. rsql tables or gRPC streams.
+package rcli
@@ -0,0 +1,10 @@
+package rcli
+
+import (
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// ErrInvalidProto is returned by proto formatters if the metadata
+// is not valid protobuf wire format.
+var ErrInvalidProto = errors.New("invalid protobuf", j.C("ERR_4c1e9a7d20b5f386"))
@@ -0,0 +1,272 @@
+package rcli
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// Formatter returns the printable representation of event metadata.
+type Formatter func(metadata []byte) (string, error)
+
+// FormatRaw returns the metadata as a quoted Go string.
+func FormatRaw(metadata []byte) (string, error) {
+	return strconv.Quote(string(metadata)), nil
+}
+
+// FormatJSON returns the JSON metadata compacted to a single line.
+// Empty metadata is formatted as an empty string.
+func FormatJSON(metadata []byte) (string, error) {
+	if len(metadata) == 0 {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, metadata); err != nil {
+		return "", errors.Wrap(err, "invalid json")
+	}
+	return buf.String(), nil
+}
+
+// NewProtoFormatter returns a formatter that decodes protobuf metadata as
+// the fully qualified message (e.g. "mypkg.UserCreated") defined in the
+// descriptor set and formats it as a JSON object keyed by field names.
+// The set should include imports, see protoc's --include_imports flag.
+// Unknown fields are keyed by field number.
+func NewProtoFormatter(set *descpb.FileDescriptorSet, message string) (Formatter, error) {
+	p := &protoDecoder{
+		msgs:  make(map[string]*descpb.DescriptorProto),
+		enums: make(map[string]*descpb.EnumDescriptorProto),
+	}
+	for _, f := range set.File {
+		prefix := ""
+		if f.GetPackage() != "" {
+			prefix = f.GetPackage() + "."
+		}
+		p.addMessages(prefix, f.MessageType)
+		for _, e := range f.EnumType {
+			p.enums[prefix+e.GetName()] = e
+		}
+	}
+
+	msg, ok := p.msgs[strings.TrimPrefix(message, ".")]
+	if !ok {
+		return nil, errors.New("message not found", j.KS("message", message))
+	}
+
+	return func(metadata []byte) (string, error) {
+		if len(metadata) == 0 {
+			return "", nil
+		}
+
+		v, err := p.decode(msg, metadata)
+		if err != nil {
+			return "", err
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}, nil
+}
+
+// protoDecoder decodes protobuf wire format using messages and enums
+// indexed by fully qualified name (without leading dot).
+type protoDecoder struct {
+	msgs  map[string]*descpb.DescriptorProto
+	enums map[string]*descpb.EnumDescriptorProto
+}
+
+func (p *protoDecoder) addMessages(prefix string, msgs []*descpb.DescriptorProto) {
+	for _, m := range msgs {
+		name := prefix + m.GetName()
+		p.msgs[name] = m
+		for _, e := range m.EnumType {
+			p.enums[name+"."+e.GetName()] = e
+		}
+		p.addMessages(name+".", m.NestedType)
+	}
+}
+
+// decode returns the message as a map of field names to values.
+func (p *protoDecoder) decode(msg *descpb.DescriptorProto, b []byte) (map[string]interface{}, error) {
+	fields := make(map[int32]*descpb.FieldDescriptorProto)
+	for _, fd := range msg.Field {
+		fields[fd.GetNumber()] = fd
+	}
+
+	res := make(map[string]interface{})
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, ErrInvalidProto
+		}
+		b = b[n:]
+
+		var (
+			num  = int32(key >> 3)
+			wire = key & 7
+			raw  uint64
+			data []byte
+		)
+		switch wire {
+		case 0:
+			raw, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, ErrInvalidProto
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, ErrInvalidProto
+			}
+			raw = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, ErrInvalidProto
+			}
+			data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case 5:
+			if len(b) < 4 {
+				return nil, ErrInvalidProto
+			}
+			raw = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			return nil, errors.Wrap(ErrInvalidProto, "unsupported wire type",
+				j.MKV{"field": num, "wire_type": wire})
+		}
+
+		fd, ok := fields[num]
+		if !ok {
+			name := strconv.Itoa(int(num))
+			if data != nil {
+				res[name] = data
+			} else {
+				res[name] = raw
+			}
+			continue
+		}
+
+		vals, err := p.values(fd, wire, raw, data)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KS("field", fd.GetName()))
+		}
+
+		if fd.GetLabel() != descpb.FieldDescriptorProto_LABEL_REPEATED {
+			res[fd.GetName()] = vals[len(vals)-1]
+			continue
+		}
+
+		l, _ := res[fd.GetName()].([]interface{})
+		res[fd.GetName()] = append(l, vals...)
+	}
+
+	return res, nil
+}
+
+// values returns the decoded values of the field. It returns multiple
+// values for packed repeated fields.
+func (p *protoDecoder) values(fd *descpb.FieldDescriptorProto, wire uint64,
+	raw uint64, data []byte) ([]interface{}, error) {
+
+	switch fd.GetType() {
+	case descpb.FieldDescriptorProto_TYPE_STRING:
+		return []interface{}{string(data)}, nil
+	case descpb.FieldDescriptorProto_TYPE_BYTES:
+		return []interface{}{data}, nil
+	case descpb.FieldDescriptorProto_TYPE_MESSAGE:
+		msg, ok := p.msgs[strings.TrimPrefix(fd.GetTypeName(), ".")]
+		if !ok {
+			return nil, errors.New("message not found", j.KS("message", fd.GetTypeName()))
+		}
+		v, err := p.decode(msg, data)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{v}, nil
+	}
+
+	if wire != 2 {
+		return []interface{}{p.scalar(fd, raw)}, nil
+	}
+
+	// Packed repeated scalars.
+	var res []interface{}
+	for len(data) > 0 {
+		switch fd.GetType() {
+		case descpb.FieldDescriptorProto_TYPE_DOUBLE,
+			descpb.FieldDescriptorProto_TYPE_FIXED64,
+			descpb.FieldDescriptorProto_TYPE_SFIXED64:
+			if len(data) < 8 {
+				return nil, ErrInvalidProto
+			}
+			raw = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case descpb.FieldDescriptorProto_TYPE_FLOAT,
+			descpb.FieldDescriptorProto_TYPE_FIXED32,
+			descpb.FieldDescriptorProto_TYPE_SFIXED32:
+			if len(data) < 4 {
+				return nil, ErrInvalidProto
+			}
+			raw = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			var n int
+			raw, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, ErrInvalidProto
+			}
+			data = data[n:]
+		}
+		res = append(res, p.scalar(fd, raw))
+	}
+	return res, nil
+}
+
+// scalar returns the typed value of the raw varint or fixed value.
+func (p *protoDecoder) scalar(fd *descpb.FieldDescriptorProto, raw uint64) interface{} {
+	switch fd.GetType() {
+	case descpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return math.Float64frombits(raw)
+	case descpb.FieldDescriptorProto_TYPE_FLOAT:
+		return math.Float32frombits(uint32(raw))
+	case descpb.FieldDescriptorProto_TYPE_INT64,
+		descpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return int64(raw)
+	case descpb.FieldDescriptorProto_TYPE_INT32,
+		descpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return int32(raw)
+	case descpb.FieldDescriptorProto_TYPE_UINT32,
+		descpb.FieldDescriptorProto_TYPE_FIXED32:
+		return uint32(raw)
+	case descpb.FieldDescriptorProto_TYPE_SINT32:
+		return int32(uint32(raw)>>1) ^ -int32(raw&1)
+	case descpb.FieldDescriptorProto_TYPE_SINT64:
+		return int64(raw>>1) ^ -int64(raw&1)
+	case descpb.FieldDescriptorProto_TYPE_BOOL:
+		return raw != 0
+	case descpb.FieldDescriptorProto_TYPE_ENUM:
+		if e, ok := p.enums[strings.TrimPrefix(fd.GetTypeName(), ".")]; ok {
+			for _, v := range e.Value {
+				if int64(v.GetNumber()) == int64(int32(raw)) {
+					return v.GetName()
+				}
+			}
+		}
+		return int32(raw)
+	}
+	return raw
+}
@@ -0,0 +1,56 @@
+package rcli_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/descriptor"
+	"github.com/golang/protobuf/proto"
+	descpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/rcli"
+	"github.com/luno/reflex/reflexpb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatJSON(t *testing.T) {
+	res, err := rcli.FormatJSON([]byte("{\n  \"a\": 1\n}"))
+	jtest.RequireNil(t, err)
+	require.Equal(t, `{"a":1}`, res)
+
+	res, err = rcli.FormatJSON(nil)
+	jtest.RequireNil(t, err)
+	require.Empty(t, res)
+
+	_, err = rcli.FormatJSON([]byte("not json"))
+	require.Error(t, err)
+}
+
+func TestProtoFormatter(t *testing.T) {
+	fd, _ := descriptor.ForMessage(&reflexpb.StreamOptions{})
+	dd, _ := descriptor.ForMessage(&duration.Duration{})
+	set := &descpb.FileDescriptorSet{File: []*descpb.FileDescriptorProto{fd, dd}}
+
+	f, err := rcli.NewProtoFormatter(set, "reflexpb.StreamOptions")
+	jtest.RequireNil(t, err)
+
+	b, err := proto.Marshal(&reflexpb.StreamOptions{
+		Lag:             ptypes.DurationProto(5 * time.Second),
+		ToHead:          true,
+		Types:           []int32{1, 2},
+		ForeignIDPrefix: "user:",
+	})
+	jtest.RequireNil(t, err)
+
+	res, err := f(b)
+	jtest.RequireNil(t, err)
+	require.Equal(t, `{"foreignIDPrefix":"user:","lag":{"seconds":5},"toHead":true,"types":[1,2]}`, res)
+
+	_, err = f([]byte{0x0a, 0x05})
+	jtest.Require(t, rcli.ErrInvalidProto, err)
+
+	_, err = rcli.NewProtoFormatter(set, "reflexpb.Unknown")
+	require.Error(t, err)
+}
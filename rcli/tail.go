@@ -0,0 +1,83 @@
+package rcli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+)
+
+type tailOptions struct {
+	format     Formatter
+	streamOpts []reflex.StreamOption
+}
+
+// TailOption defines a functional option that configures Tail.
+type TailOption func(*tailOptions)
+
+// WithTailFormatter provides an option to set the metadata formatter.
+// It defaults to FormatRaw.
+func WithTailFormatter(f Formatter) TailOption {
+	return func(o *tailOptions) {
+		o.format = f
+	}
+}
+
+// WithTailStreamOptions provides an option to set the stream options,
+// e.g. reflex.WithStreamToHead to stop at the current head.
+func WithTailStreamOptions(opts ...reflex.StreamOption) TailOption {
+	return func(o *tailOptions) {
+		o.streamOpts = append(o.streamOpts, opts...)
+	}
+}
+
+// Tail streams events after the cursor and writes a line per event to w
+// until the context is canceled or the stream errors. It returns nil if the
+// stream returns reflex.ErrHeadReached. Lines are tab separated and contain
+// the event ID, timestamp, type, foreign ID and formatted metadata. Metadata
+// that cannot be formatted is written as FormatRaw with the error.
+func Tail(ctx context.Context, w io.Writer, stream reflex.StreamFunc,
+	after string, opts ...TailOption) error {
+
+	o := tailOptions{format: FormatRaw}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	sc, err := stream(ctx, after, o.streamOpts...)
+	if err != nil {
+		return err
+	}
+	if c, ok := sc.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	for {
+		e, err := sc.Recv()
+		if reflex.IsHeadReachedErr(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := writeEvent(w, e, o.format); err != nil {
+			return errors.Wrap(err, "write event error")
+		}
+	}
+}
+
+func writeEvent(w io.Writer, e *reflex.Event, format Formatter) error {
+	metadata, err := format(e.MetaData)
+	if err != nil {
+		raw, _ := FormatRaw(e.MetaData)
+		metadata = raw + " (format error: " + err.Error() + ")"
+	}
+
+	_, err = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", e.ID,
+		e.Timestamp.UTC().Format(time.RFC3339Nano), e.Type.ReflexType(),
+		e.ForeignID, metadata)
+	return err
+}
@@ -0,0 +1,61 @@
+package rcli_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rcli"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+type testEventType int
+
+func (t testEventType) ReflexType() int {
+	return int(t)
+}
+
+func TestTail(t *testing.T) {
+	t0 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	table := rtest.NewEventsTable(rtest.WithClock(func() time.Time { return t0 }))
+	table.InsertWithMetadata("a", testEventType(1), []byte(`{"x": 1}`))
+	table.InsertWithMetadata("b", testEventType(2), []byte("not json"))
+	table.Insert("c", testEventType(1))
+
+	var buf bytes.Buffer
+	err := rcli.Tail(context.Background(), &buf, table.Stream, "1",
+		rcli.WithTailFormatter(rcli.FormatJSON),
+		rcli.WithTailStreamOptions(reflex.WithStreamToHead()))
+	jtest.RequireNil(t, err)
+
+	lines := strings.Split(buf.String(), "\n")
+	require.Len(t, lines, 3)
+	require.True(t, strings.HasPrefix(lines[0],
+		"2\t2020-01-02T03:04:05Z\t2\tb\t\"not json\" (format error: invalid json"), lines[0])
+	require.Equal(t, "3\t2020-01-02T03:04:05Z\t1\tc\t", lines[1])
+}
+
+func TestCursors(t *testing.T) {
+	ctx := context.Background()
+	store := rtest.NewCursorStore()
+	jtest.RequireNil(t, store.SetCursor(ctx, "c1", "10"))
+
+	var buf bytes.Buffer
+	jtest.RequireNil(t, rcli.ShowCursors(ctx, &buf, store, "c1", "c2"))
+	require.Equal(t, "c1\t10\nc2\t\n", buf.String())
+
+	jtest.RequireNil(t, rcli.ResetCursor(ctx, store, "c1", "5"))
+	require.Equal(t, "5", store.Cursor("c1"))
+
+	err := rcli.ResetCursor(ctx, noResetStore{store}, "c1", "1")
+	jtest.Require(t, reflex.ErrResetNotSupported, err)
+}
+
+type noResetStore struct {
+	reflex.CursorStore
+}
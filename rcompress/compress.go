@@ -0,0 +1,63 @@
+package rcompress
+
+import (
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/luno/reflex/rsql"
+)
+
+var (
+	// Snappy is a snappy block compression with ID 2.
+	Snappy rsql.Compression = snappyCompression{}
+
+	// Zstd is a zstd compression with ID 3.
+	Zstd rsql.Compression = newZstd()
+)
+
+type snappyCompression struct{}
+
+func (snappyCompression) ID() byte {
+	return 2
+}
+
+func (snappyCompression) Compress(metadata []byte) ([]byte, error) {
+	return s2.EncodeSnappy(nil, metadata), nil
+}
+
+func (snappyCompression) Decompress(data []byte) ([]byte, error) {
+	return s2.Decode(nil, data)
+}
+
+// zstdCompression uses a shared encoder and decoder that
+// are safe for concurrent use via EncodeAll and DecodeAll.
+type zstdCompression struct {
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+func newZstd() zstdCompression {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		// Only returns errors for invalid options.
+		panic(err)
+	}
+
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return zstdCompression{enc: enc, dec: dec}
+}
+
+func (zstdCompression) ID() byte {
+	return 3
+}
+
+func (z zstdCompression) Compress(metadata []byte) ([]byte, error) {
+	return z.enc.EncodeAll(metadata, nil), nil
+}
+
+func (z zstdCompression) Decompress(data []byte) ([]byte, error) {
+	return z.dec.DecodeAll(data, nil)
+}
@@ -0,0 +1,30 @@
+package rcompress_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/luno/reflex/rcompress"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressions(t *testing.T) {
+	metadata := bytes.Repeat([]byte(`{"key":"value"}`), 100)
+
+	for _, c := range []rsql.Compression{rsql.CompressionGzip, rcompress.Snappy, rcompress.Zstd} {
+		b, err := c.Compress(metadata)
+		require.NoError(t, err)
+		require.Less(t, len(b), len(metadata))
+
+		res, err := c.Decompress(b)
+		require.NoError(t, err)
+		require.Equal(t, metadata, res)
+
+		_, err = c.Decompress([]byte("invalid"))
+		require.Error(t, err)
+	}
+
+	require.NotEqual(t, rcompress.Snappy.ID(), rcompress.Zstd.ID())
+	require.NotEqual(t, rsql.CompressionGzip.ID(), rcompress.Zstd.ID())
+}
@@ -0,0 +1,4 @@
+// Package rcompress provides snappy and zstd compressions of event metadata,
+// see rsql.WithMetadataCompression. It is a separate module to avoid the
+// compression dependencies in the reflex module.
+package rcompress
@@ -0,0 +1,234 @@
+package rconsul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/luno/jettison"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+const (
+	defaultPrefix = "reflex/cursors/"
+
+	// maxCASRetries is the maximum number of concurrent modification retries.
+	maxCASRetries = 5
+)
+
+// ErrCursorNotIncreased is returned by SetCursor if the cursor is not
+// greater than the stored cursor.
+var ErrCursorNotIncreased = errors.New("cursor not greater than stored cursor",
+	j.C("ERR_3b5f08c1d7e92a46"))
+
+var (
+	_ reflex.CursorStore    = (*CursorStore)(nil)
+	_ reflex.CursorResetter = (*CursorStore)(nil)
+)
+
+// Option is a functional option that configures a cursor store.
+type Option func(*CursorStore)
+
+// WithPrefix returns an option to configure the prefix of cursor keys.
+// It defaults to "reflex/cursors/".
+func WithPrefix(prefix string) Option {
+	return func(s *CursorStore) {
+		s.prefix = prefix
+	}
+}
+
+// WithToken returns an option to configure the ACL token of requests.
+func WithToken(token string) Option {
+	return func(s *CursorStore) {
+		s.token = token
+	}
+}
+
+// WithHTTPClient returns an option to configure the HTTP client.
+// It defaults to http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(s *CursorStore) {
+		s.client = c
+	}
+}
+
+// NewCursorStore returns a new cursor store of the Consul agent
+// address, e.g. "http://localhost:8500".
+func NewCursorStore(addr string, opts ...Option) *CursorStore {
+	s := &CursorStore{
+		addr:   strings.TrimSuffix(addr, "/"),
+		prefix: defaultPrefix,
+		client: http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// CursorStore is a reflex cursor store backed by the Consul KV store.
+// Cursors are written synchronously so Flush is a noop.
+type CursorStore struct {
+	addr   string
+	prefix string
+	token  string
+	client *http.Client
+}
+
+// GetCursor returns the consumer's cursor or an empty string if not found.
+func (s *CursorStore) GetCursor(ctx context.Context, consumerName string) (string, error) {
+	cursor, _, err := s.get(ctx, consumerName)
+	return cursor, err
+}
+
+// SetCursor sets the consumer's cursor if it is greater than the stored
+// cursor. It returns ErrCursorNotIncreased otherwise.
+func (s *CursorStore) SetCursor(ctx context.Context, consumerName string, cursor string) error {
+	opts := []jettison.Option{j.KS("consumer", consumerName), j.KS("cursor", cursor)}
+
+	c, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil {
+		return errors.New("invalid int cursor", opts...)
+	}
+
+	for i := 0; i < maxCASRetries; i++ {
+		prev, index, err := s.get(ctx, consumerName)
+		if err != nil {
+			return err
+		}
+
+		if prev != "" {
+			p, err := strconv.ParseInt(prev, 10, 64)
+			if err != nil {
+				return errors.Wrap(err, "invalid stored cursor", opts...)
+			} else if p >= c {
+				return errors.Wrap(ErrCursorNotIncreased, "", opts...)
+			}
+		}
+
+		// Note a zero index only sets the key if it doesn't exist.
+		ok, err := s.put(ctx, consumerName, cursor, strconv.FormatUint(index, 10))
+		if err != nil {
+			return errors.Wrap(err, "", opts...)
+		} else if ok {
+			return nil
+		}
+	}
+
+	return errors.New("cursor concurrently modified", opts...)
+}
+
+// ResetCursor sets the consumer's cursor even if it is before
+// the stored cursor, see reflex.Replay.
+func (s *CursorStore) ResetCursor(ctx context.Context, consumerName string, cursor string) error {
+	if _, err := strconv.ParseInt(cursor, 10, 64); err != nil {
+		return errors.New("invalid int cursor", j.KS("consumer", consumerName),
+			j.KS("cursor", cursor))
+	}
+
+	_, err := s.put(ctx, consumerName, cursor, "")
+	return err
+}
+
+// Flush is a noop since cursors are written synchronously.
+func (s *CursorStore) Flush(context.Context) error {
+	return nil
+}
+
+// kvPair is a key value pair returned by the Consul KV API.
+type kvPair struct {
+	Key         string
+	Value       []byte // Base64 decoded by encoding/json.
+	ModifyIndex uint64
+}
+
+// get returns the consumer's cursor and its modify index.
+func (s *CursorStore) get(ctx context.Context, consumerName string) (string, uint64, error) {
+	res, err := s.do(ctx, http.MethodGet, consumerName, nil, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return "", 0, nil
+	} else if res.StatusCode != http.StatusOK {
+		return "", 0, statusError(res, consumerName)
+	}
+
+	var pairs []kvPair
+	if err := json.NewDecoder(res.Body).Decode(&pairs); err != nil {
+		return "", 0, errors.Wrap(err, "decode kv error", j.KS("consumer", consumerName))
+	} else if len(pairs) == 0 {
+		return "", 0, nil
+	}
+
+	return string(pairs[0].Value), pairs[0].ModifyIndex, nil
+}
+
+// put sets the consumer's cursor and returns true if it was set. If cas is
+// not empty, the cursor is only set if the modify index matches.
+func (s *CursorStore) put(ctx context.Context, consumerName, cursor, cas string) (bool, error) {
+	q := url.Values{}
+	if cas != "" {
+		q.Set("cas", cas)
+	}
+
+	res, err := s.do(ctx, http.MethodPut, consumerName, q, []byte(cursor))
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return false, statusError(res, consumerName)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return false, errors.Wrap(err, "read kv response error")
+	}
+
+	return strings.TrimSpace(string(b)) == "true", nil
+}
+
+func (s *CursorStore) do(ctx context.Context, method, consumerName string,
+	q url.Values, body []byte) (*http.Response, error) {
+
+	u := s.addr + "/v1/kv/" + s.prefix + url.PathEscape(consumerName)
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "consul request error", j.KS("consumer", consumerName))
+	}
+
+	return res, nil
+}
+
+func statusError(res *http.Response, consumerName string) error {
+	b, _ := ioutil.ReadAll(res.Body)
+	return errors.New("unexpected consul response", j.KS("consumer", consumerName),
+		j.KV("status", res.StatusCode), j.KS("body", string(b)))
+}
@@ -0,0 +1,127 @@
+package rconsul_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/rconsul"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorStore(t *testing.T) {
+	kv := newFakeKV()
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	s := rconsul.NewCursorStore(srv.URL, rconsul.WithToken("secret"))
+	ctx := context.Background()
+
+	cursor, err := s.GetCursor(ctx, "c1")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "", cursor)
+
+	jtest.RequireNil(t, s.SetCursor(ctx, "c1", "10"))
+	jtest.Require(t, rconsul.ErrCursorNotIncreased, s.SetCursor(ctx, "c1", "10"))
+	jtest.Require(t, rconsul.ErrCursorNotIncreased, s.SetCursor(ctx, "c1", "9"))
+	jtest.RequireNil(t, s.SetCursor(ctx, "c1", "11"))
+
+	cursor, err = s.GetCursor(ctx, "c1")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "11", cursor)
+
+	jtest.RequireNil(t, s.ResetCursor(ctx, "c1", "5"))
+	cursor, err = s.GetCursor(ctx, "c1")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "5", cursor)
+
+	require.Error(t, s.SetCursor(ctx, "c1", "abc"))
+	require.Equal(t, "secret", kv.token)
+	require.Contains(t, kv.values, "reflex/cursors/c1")
+}
+
+func TestCursorStoreConcurrent(t *testing.T) {
+	kv := newFakeKV()
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	// Concurrently modify the cursor before the first check-and-set.
+	kv.beforeCAS = func() {
+		kv.beforeCAS = nil
+		kv.set("reflex/cursors/c1", "3")
+	}
+
+	s := rconsul.NewCursorStore(srv.URL)
+	jtest.RequireNil(t, s.SetCursor(context.Background(), "c1", "5"))
+
+	cursor, err := s.GetCursor(context.Background(), "c1")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "5", cursor)
+}
+
+func newFakeKV() *fakeKV {
+	return &fakeKV{
+		values:  make(map[string]string),
+		indexes: make(map[string]uint64),
+	}
+}
+
+// fakeKV is a fake Consul KV HTTP API that supports check-and-set writes.
+type fakeKV struct {
+	mu        sync.Mutex
+	token     string
+	index     uint64
+	values    map[string]string
+	indexes   map[string]uint64
+	beforeCAS func()
+}
+
+func (kv *fakeKV) set(key, value string) {
+	kv.index++
+	kv.values[key] = value
+	kv.indexes[key] = kv.index
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.token = r.Header.Get("X-Consul-Token")
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+
+	switch r.Method {
+	case http.MethodGet:
+		value, ok := kv.values[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{{
+			"Key":         key,
+			"Value":       []byte(value),
+			"ModifyIndex": kv.indexes[key],
+		}})
+
+	case http.MethodPut:
+		b, _ := ioutil.ReadAll(r.Body)
+		if cas := r.URL.Query().Get("cas"); cas != "" {
+			if kv.beforeCAS != nil {
+				kv.beforeCAS()
+			}
+			index, _ := strconv.ParseUint(cas, 10, 64)
+			if kv.indexes[key] != index {
+				_, _ = w.Write([]byte("false"))
+				return
+			}
+		}
+		kv.set(key, string(b))
+		_, _ = w.Write([]byte("true"))
+	}
+}
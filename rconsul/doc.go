@@ -0,0 +1,8 @@
+// Package rconsul provides a reflex cursor store backed by the Consul KV
+// store, so stateless consumers (e.g. in Kubernetes) can keep cursors without
+// a SQL database. It uses the Consul HTTP API directly.
+//
+// Cursors are stored as values of keys of consumer names with a prefix.
+// Only int cursors are supported and cursors are only updated if they
+// increase, which is enforced via check-and-set writes.
+package rconsul
@@ -0,0 +1,178 @@
+package rdynamo
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/luno/jettison"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+const (
+	defaultKeyAttr       = "id"
+	defaultCursorAttr    = "cursor"
+	defaultUpdatedAtAttr = "updated_at"
+)
+
+// ErrCursorNotIncreased is returned by SetCursor if the cursor is not
+// greater than the stored cursor.
+var ErrCursorNotIncreased = errors.New("cursor not greater than stored cursor",
+	j.C("ERR_d86a1f4e2c9b7035"))
+
+var (
+	_ reflex.CursorStore    = (*CursorStore)(nil)
+	_ reflex.CursorResetter = (*CursorStore)(nil)
+)
+
+// Option is a functional option that configures a cursor store.
+type Option func(*CursorStore)
+
+// WithKeyAttribute returns an option to configure the partition key
+// attribute (string) of the consumer name. It defaults to "id".
+func WithKeyAttribute(name string) Option {
+	return func(s *CursorStore) {
+		s.keyAttr = name
+	}
+}
+
+// WithCursorAttribute returns an option to configure the cursor attribute
+// (number). It defaults to "cursor".
+func WithCursorAttribute(name string) Option {
+	return func(s *CursorStore) {
+		s.cursorAttr = name
+	}
+}
+
+// WithUpdatedAtAttribute returns an option to configure the attribute
+// (string) of the time the cursor was last updated in RFC3339 format.
+// It defaults to "updated_at".
+func WithUpdatedAtAttribute(name string) Option {
+	return func(s *CursorStore) {
+		s.updatedAtAttr = name
+	}
+}
+
+// NewCursorStore returns a new cursor store of the DynamoDB table.
+func NewCursorStore(api dynamodbiface.DynamoDBAPI, table string, opts ...Option) *CursorStore {
+	s := &CursorStore{
+		api:           api,
+		table:         table,
+		keyAttr:       defaultKeyAttr,
+		cursorAttr:    defaultCursorAttr,
+		updatedAtAttr: defaultUpdatedAtAttr,
+		now:           time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// CursorStore is a reflex cursor store backed by a DynamoDB table. Cursors
+// are written synchronously so Flush is a noop.
+type CursorStore struct {
+	api           dynamodbiface.DynamoDBAPI
+	table         string
+	keyAttr       string
+	cursorAttr    string
+	updatedAtAttr string
+	now           func() time.Time
+}
+
+// GetCursor returns the consumer's cursor or an empty string if not found.
+// It uses strongly consistent reads.
+func (s *CursorStore) GetCursor(ctx context.Context, consumerName string) (string, error) {
+	res, err := s.api.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(s.table),
+		Key:                  s.key(consumerName),
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: aws.String("#c"),
+		ExpressionAttributeNames: map[string]*string{
+			"#c": aws.String(s.cursorAttr),
+		},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "get cursor error", j.KS("consumer", consumerName))
+	}
+
+	attr, ok := res.Item[s.cursorAttr]
+	if !ok {
+		return "", nil
+	}
+
+	return aws.StringValue(attr.N), nil
+}
+
+// SetCursor sets the consumer's cursor if it is greater than the stored
+// cursor. It returns ErrCursorNotIncreased otherwise.
+func (s *CursorStore) SetCursor(ctx context.Context, consumerName string, cursor string) error {
+	return s.update(ctx, consumerName, cursor, true)
+}
+
+// ResetCursor sets the consumer's cursor even if it is before
+// the stored cursor, see reflex.Replay.
+func (s *CursorStore) ResetCursor(ctx context.Context, consumerName string, cursor string) error {
+	return s.update(ctx, consumerName, cursor, false)
+}
+
+// Flush is a noop since cursors are written synchronously.
+func (s *CursorStore) Flush(context.Context) error {
+	return nil
+}
+
+func (s *CursorStore) update(ctx context.Context, consumerName, cursor string,
+	monotonic bool) error {
+
+	opts := []jettison.Option{j.KS("consumer", consumerName), j.KS("cursor", cursor)}
+
+	if _, err := strconv.ParseInt(cursor, 10, 64); err != nil {
+		return errors.New("invalid int cursor", opts...)
+	}
+
+	in := &dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.table),
+		Key:              s.key(consumerName),
+		UpdateExpression: aws.String("SET #c = :c, #u = :u"),
+		ExpressionAttributeNames: map[string]*string{
+			"#c": aws.String(s.cursorAttr),
+			"#u": aws.String(s.updatedAtAttr),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":c": {N: aws.String(cursor)},
+			":u": {S: aws.String(s.now().UTC().Format(time.RFC3339Nano))},
+		},
+	}
+	if monotonic {
+		in.ConditionExpression = aws.String("attribute_not_exists(#c) OR #c < :c")
+	}
+
+	_, err := s.api.UpdateItemWithContext(ctx, in)
+	if isConditionalCheckFailed(err) {
+		return errors.Wrap(ErrCursorNotIncreased, "", opts...)
+	} else if err != nil {
+		return errors.Wrap(err, "update cursor error", opts...)
+	}
+
+	return nil
+}
+
+func (s *CursorStore) key(consumerName string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		s.keyAttr: {S: aws.String(consumerName)},
+	}
+}
+
+func isConditionalCheckFailed(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) &&
+		aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
@@ -0,0 +1,83 @@
+package rdynamo_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/rdynamo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorStore(t *testing.T) {
+	api := &mockDynamo{items: make(map[string]int64)}
+	s := rdynamo.NewCursorStore(api, "cursors")
+	ctx := context.Background()
+
+	cursor, err := s.GetCursor(ctx, "c1")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "", cursor)
+
+	jtest.RequireNil(t, s.SetCursor(ctx, "c1", "10"))
+	jtest.Require(t, rdynamo.ErrCursorNotIncreased, s.SetCursor(ctx, "c1", "10"))
+	jtest.Require(t, rdynamo.ErrCursorNotIncreased, s.SetCursor(ctx, "c1", "9"))
+	jtest.RequireNil(t, s.SetCursor(ctx, "c1", "11"))
+
+	cursor, err = s.GetCursor(ctx, "c1")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "11", cursor)
+
+	jtest.RequireNil(t, s.ResetCursor(ctx, "c1", "5"))
+	cursor, err = s.GetCursor(ctx, "c1")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "5", cursor)
+
+	require.Error(t, s.SetCursor(ctx, "c1", "abc"))
+	require.Equal(t, "cursors", api.table)
+}
+
+// mockDynamo is a DynamoDB API of int cursors that supports the
+// monotonic update condition.
+type mockDynamo struct {
+	dynamodbiface.DynamoDBAPI
+	table string
+	items map[string]int64
+}
+
+func (m *mockDynamo) GetItemWithContext(_ aws.Context, in *dynamodb.GetItemInput,
+	_ ...request.Option) (*dynamodb.GetItemOutput, error) {
+
+	m.table = aws.StringValue(in.TableName)
+	c, ok := m.items[aws.StringValue(in.Key["id"].S)]
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+
+	return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+		"cursor": {N: aws.String(strconv.FormatInt(c, 10))},
+	}}, nil
+}
+
+func (m *mockDynamo) UpdateItemWithContext(_ aws.Context, in *dynamodb.UpdateItemInput,
+	_ ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+
+	key := aws.StringValue(in.Key["id"].S)
+	c, err := strconv.ParseInt(aws.StringValue(in.ExpressionAttributeValues[":c"].N), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	if prev, ok := m.items[key]; ok && in.ConditionExpression != nil && prev >= c {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException,
+			"the conditional request failed", nil)
+	}
+
+	m.items[key] = c
+	return &dynamodb.UpdateItemOutput{}, nil
+}
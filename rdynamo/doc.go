@@ -0,0 +1,8 @@
+// Package rdynamo provides a reflex cursor store backed by an AWS DynamoDB
+// table, for services with DynamoDB as primary datastore that consume reflex
+// streams, e.g. over gRPC.
+//
+// Cursors are stored as number attributes of items keyed by consumer name,
+// so only int cursors are supported. Cursors are only updated if they
+// increase, which is enforced via conditional updates.
+package rdynamo
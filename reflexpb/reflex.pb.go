@@ -29,6 +29,8 @@ const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 type StreamRequest struct {
 	Options              *StreamOptions `protobuf:"bytes,2,opt,name=options,proto3" json:"options,omitempty"`
 	After                string         `protobuf:"bytes,3,opt,name=after,proto3" json:"after,omitempty"`
+	ProtocolVersion      int32          `protobuf:"varint,4,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"`
+	Capabilities         []string       `protobuf:"bytes,5,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
 	XXX_unrecognized     []byte         `json:"-"`
 	XXX_sizecache        int32          `json:"-"`
@@ -73,12 +75,30 @@ func (m *StreamRequest) GetAfter() string {
 	return ""
 }
 
+func (m *StreamRequest) GetProtocolVersion() int32 {
+	if m != nil {
+		return m.ProtocolVersion
+	}
+	return 0
+}
+
+func (m *StreamRequest) GetCapabilities() []string {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
 type Event struct {
 	Type                 int32                `protobuf:"varint,3,opt,name=type,proto3" json:"type,omitempty"`
 	Timestamp            *timestamp.Timestamp `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
 	ForeignId            string               `protobuf:"bytes,5,opt,name=foreign_id,json=foreignId,proto3" json:"foreign_id,omitempty"`
 	Id                   string               `protobuf:"bytes,6,opt,name=id,proto3" json:"id,omitempty"`
 	Metadata             []byte               `protobuf:"bytes,7,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	ForeignKeys          map[string]string    `protobuf:"bytes,8,rep,name=foreign_keys,json=foreignKeys,proto3" json:"foreign_keys,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Headers              map[string]string    `protobuf:"bytes,9,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	TenantId             string               `protobuf:"bytes,10,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	Heartbeat            bool                 `protobuf:"varint,11,opt,name=heartbeat,proto3" json:"heartbeat,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
 	XXX_unrecognized     []byte               `json:"-"`
 	XXX_sizecache        int32                `json:"-"`
@@ -144,13 +164,51 @@ func (m *Event) GetMetadata() []byte {
 	return nil
 }
 
+func (m *Event) GetForeignKeys() map[string]string {
+	if m != nil {
+		return m.ForeignKeys
+	}
+	return nil
+}
+
+func (m *Event) GetHeaders() map[string]string {
+	if m != nil {
+		return m.Headers
+	}
+	return nil
+}
+
+func (m *Event) GetTenantId() string {
+	if m != nil {
+		return m.TenantId
+	}
+	return ""
+}
+
+func (m *Event) GetHeartbeat() bool {
+	if m != nil {
+		return m.Heartbeat
+	}
+	return false
+}
+
 type StreamOptions struct {
-	Lag                  *duration.Duration `protobuf:"bytes,1,opt,name=lag,proto3" json:"lag,omitempty"`
-	FromHead             bool               `protobuf:"varint,2,opt,name=fromHead,proto3" json:"fromHead,omitempty"`
-	ToHead               bool               `protobuf:"varint,4,opt,name=toHead,proto3" json:"toHead,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
-	XXX_unrecognized     []byte             `json:"-"`
-	XXX_sizecache        int32              `json:"-"`
+	Lag                  *duration.Duration   `protobuf:"bytes,1,opt,name=lag,proto3" json:"lag,omitempty"`
+	FromHead             bool                 `protobuf:"varint,2,opt,name=fromHead,proto3" json:"fromHead,omitempty"`
+	ToHead               bool                 `protobuf:"varint,4,opt,name=toHead,proto3" json:"toHead,omitempty"`
+	FromTime             *timestamp.Timestamp `protobuf:"bytes,5,opt,name=fromTime,proto3" json:"fromTime,omitempty"`
+	Descending           bool                 `protobuf:"varint,6,opt,name=descending,proto3" json:"descending,omitempty"`
+	UntilCursor          string               `protobuf:"bytes,7,opt,name=untilCursor,proto3" json:"untilCursor,omitempty"`
+	UntilTime            *timestamp.Timestamp `protobuf:"bytes,8,opt,name=untilTime,proto3" json:"untilTime,omitempty"`
+	Types                []int32              `protobuf:"varint,9,rep,packed,name=types,proto3" json:"types,omitempty"`
+	ForeignIDPrefix      string               `protobuf:"bytes,10,opt,name=foreignIDPrefix,proto3" json:"foreignIDPrefix,omitempty"`
+	ForeignKeys          map[string]string    `protobuf:"bytes,11,rep,name=foreignKeys,proto3" json:"foreignKeys,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Headers              map[string]string    `protobuf:"bytes,12,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Tenant               string               `protobuf:"bytes,13,opt,name=tenant,proto3" json:"tenant,omitempty"`
+	Heartbeat            *duration.Duration   `protobuf:"bytes,14,opt,name=heartbeat,proto3" json:"heartbeat,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
 }
 
 func (m *StreamOptions) Reset()         { *m = StreamOptions{} }
@@ -199,38 +257,391 @@ func (m *StreamOptions) GetToHead() bool {
 	return false
 }
 
+func (m *StreamOptions) GetFromTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.FromTime
+	}
+	return nil
+}
+
+func (m *StreamOptions) GetDescending() bool {
+	if m != nil {
+		return m.Descending
+	}
+	return false
+}
+
+func (m *StreamOptions) GetUntilCursor() string {
+	if m != nil {
+		return m.UntilCursor
+	}
+	return ""
+}
+
+func (m *StreamOptions) GetUntilTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.UntilTime
+	}
+	return nil
+}
+
+func (m *StreamOptions) GetTypes() []int32 {
+	if m != nil {
+		return m.Types
+	}
+	return nil
+}
+
+func (m *StreamOptions) GetForeignIDPrefix() string {
+	if m != nil {
+		return m.ForeignIDPrefix
+	}
+	return ""
+}
+
+func (m *StreamOptions) GetForeignKeys() map[string]string {
+	if m != nil {
+		return m.ForeignKeys
+	}
+	return nil
+}
+
+func (m *StreamOptions) GetHeaders() map[string]string {
+	if m != nil {
+		return m.Headers
+	}
+	return nil
+}
+
+func (m *StreamOptions) GetTenant() string {
+	if m != nil {
+		return m.Tenant
+	}
+	return ""
+}
+
+func (m *StreamOptions) GetHeartbeat() *duration.Duration {
+	if m != nil {
+		return m.Heartbeat
+	}
+	return nil
+}
+
+type MultiplexRequest struct {
+	Id                   int64          `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Stream               string         `protobuf:"bytes,2,opt,name=stream,proto3" json:"stream,omitempty"`
+	Request              *StreamRequest `protobuf:"bytes,3,opt,name=request,proto3" json:"request,omitempty"`
+	Cancel               bool           `protobuf:"varint,4,opt,name=cancel,proto3" json:"cancel,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *MultiplexRequest) Reset()         { *m = MultiplexRequest{} }
+func (m *MultiplexRequest) String() string { return proto.CompactTextString(m) }
+func (*MultiplexRequest) ProtoMessage()    {}
+func (*MultiplexRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a570507208cc2a2f, []int{3}
+}
+
+func (m *MultiplexRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MultiplexRequest.Unmarshal(m, b)
+}
+func (m *MultiplexRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MultiplexRequest.Marshal(b, m, deterministic)
+}
+func (m *MultiplexRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MultiplexRequest.Merge(m, src)
+}
+func (m *MultiplexRequest) XXX_Size() int {
+	return xxx_messageInfo_MultiplexRequest.Size(m)
+}
+func (m *MultiplexRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_MultiplexRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MultiplexRequest proto.InternalMessageInfo
+
+func (m *MultiplexRequest) GetId() int64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *MultiplexRequest) GetStream() string {
+	if m != nil {
+		return m.Stream
+	}
+	return ""
+}
+
+func (m *MultiplexRequest) GetRequest() *StreamRequest {
+	if m != nil {
+		return m.Request
+	}
+	return nil
+}
+
+func (m *MultiplexRequest) GetCancel() bool {
+	if m != nil {
+		return m.Cancel
+	}
+	return false
+}
+
+type MultiplexEvent struct {
+	Id                   int64    `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Event                *Event   `protobuf:"bytes,2,opt,name=event,proto3" json:"event,omitempty"`
+	Error                string   `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	Codes                []string `protobuf:"bytes,4,rep,name=codes,proto3" json:"codes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MultiplexEvent) Reset()         { *m = MultiplexEvent{} }
+func (m *MultiplexEvent) String() string { return proto.CompactTextString(m) }
+func (*MultiplexEvent) ProtoMessage()    {}
+func (*MultiplexEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a570507208cc2a2f, []int{4}
+}
+
+func (m *MultiplexEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MultiplexEvent.Unmarshal(m, b)
+}
+func (m *MultiplexEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MultiplexEvent.Marshal(b, m, deterministic)
+}
+func (m *MultiplexEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MultiplexEvent.Merge(m, src)
+}
+func (m *MultiplexEvent) XXX_Size() int {
+	return xxx_messageInfo_MultiplexEvent.Size(m)
+}
+func (m *MultiplexEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_MultiplexEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MultiplexEvent proto.InternalMessageInfo
+
+func (m *MultiplexEvent) GetId() int64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *MultiplexEvent) GetEvent() *Event {
+	if m != nil {
+		return m.Event
+	}
+	return nil
+}
+
+func (m *MultiplexEvent) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *MultiplexEvent) GetCodes() []string {
+	if m != nil {
+		return m.Codes
+	}
+	return nil
+}
+
+type ListStreamsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListStreamsRequest) Reset()         { *m = ListStreamsRequest{} }
+func (m *ListStreamsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListStreamsRequest) ProtoMessage()    {}
+func (*ListStreamsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a570507208cc2a2f, []int{5}
+}
+
+func (m *ListStreamsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListStreamsRequest.Unmarshal(m, b)
+}
+func (m *ListStreamsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListStreamsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListStreamsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListStreamsRequest.Merge(m, src)
+}
+func (m *ListStreamsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListStreamsRequest.Size(m)
+}
+func (m *ListStreamsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListStreamsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListStreamsRequest proto.InternalMessageInfo
+
+type ListStreamsResponse struct {
+	Streams              []*StreamInfo `protobuf:"bytes,1,rep,name=streams,proto3" json:"streams,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *ListStreamsResponse) Reset()         { *m = ListStreamsResponse{} }
+func (m *ListStreamsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListStreamsResponse) ProtoMessage()    {}
+func (*ListStreamsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a570507208cc2a2f, []int{6}
+}
+
+func (m *ListStreamsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListStreamsResponse.Unmarshal(m, b)
+}
+func (m *ListStreamsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListStreamsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListStreamsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListStreamsResponse.Merge(m, src)
+}
+func (m *ListStreamsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListStreamsResponse.Size(m)
+}
+func (m *ListStreamsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListStreamsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListStreamsResponse proto.InternalMessageInfo
+
+func (m *ListStreamsResponse) GetStreams() []*StreamInfo {
+	if m != nil {
+		return m.Streams
+	}
+	return nil
+}
+
+type StreamInfo struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Head                 string   `protobuf:"bytes,2,opt,name=head,proto3" json:"head,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StreamInfo) Reset()         { *m = StreamInfo{} }
+func (m *StreamInfo) String() string { return proto.CompactTextString(m) }
+func (*StreamInfo) ProtoMessage()    {}
+func (*StreamInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a570507208cc2a2f, []int{7}
+}
+
+func (m *StreamInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StreamInfo.Unmarshal(m, b)
+}
+func (m *StreamInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StreamInfo.Marshal(b, m, deterministic)
+}
+func (m *StreamInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StreamInfo.Merge(m, src)
+}
+func (m *StreamInfo) XXX_Size() int {
+	return xxx_messageInfo_StreamInfo.Size(m)
+}
+func (m *StreamInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_StreamInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StreamInfo proto.InternalMessageInfo
+
+func (m *StreamInfo) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *StreamInfo) GetHead() string {
+	if m != nil {
+		return m.Head
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*StreamRequest)(nil), "reflexpb.StreamRequest")
 	proto.RegisterType((*Event)(nil), "reflexpb.Event")
+	proto.RegisterMapType((map[string]string)(nil), "reflexpb.Event.ForeignKeysEntry")
+	proto.RegisterMapType((map[string]string)(nil), "reflexpb.Event.HeadersEntry")
 	proto.RegisterType((*StreamOptions)(nil), "reflexpb.StreamOptions")
+	proto.RegisterMapType((map[string]string)(nil), "reflexpb.StreamOptions.ForeignKeysEntry")
+	proto.RegisterMapType((map[string]string)(nil), "reflexpb.StreamOptions.HeadersEntry")
+	proto.RegisterType((*MultiplexRequest)(nil), "reflexpb.MultiplexRequest")
+	proto.RegisterType((*MultiplexEvent)(nil), "reflexpb.MultiplexEvent")
+	proto.RegisterType((*ListStreamsRequest)(nil), "reflexpb.ListStreamsRequest")
+	proto.RegisterType((*ListStreamsResponse)(nil), "reflexpb.ListStreamsResponse")
+	proto.RegisterType((*StreamInfo)(nil), "reflexpb.StreamInfo")
 }
 
 func init() { proto.RegisterFile("reflex.proto", fileDescriptor_a570507208cc2a2f) }
 
 var fileDescriptor_a570507208cc2a2f = []byte{
-	// 337 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x91, 0xc1, 0x4b, 0xc3, 0x30,
-	0x18, 0xc5, 0x6d, 0x9b, 0x76, 0xdd, 0xe7, 0xd4, 0x11, 0x44, 0x63, 0x41, 0x1d, 0x3d, 0x0d, 0x84,
-	0x4e, 0x27, 0x88, 0x47, 0x0f, 0x0a, 0xba, 0x8b, 0x10, 0x3d, 0x2b, 0x19, 0x49, 0x4b, 0x61, 0x5d,
-	0x6a, 0x96, 0x0d, 0xfd, 0x9f, 0xfc, 0x23, 0x65, 0x5f, 0xda, 0x0d, 0xdc, 0xad, 0xef, 0x7b, 0x3f,
-	0x78, 0xaf, 0x2f, 0xd0, 0x33, 0x2a, 0x9f, 0xa9, 0xef, 0xac, 0x36, 0xda, 0x6a, 0x1a, 0x3b, 0x55,
-	0x4f, 0x93, 0xcb, 0x42, 0xeb, 0x62, 0xa6, 0x46, 0x78, 0x9f, 0x2e, 0xf3, 0x91, 0x2d, 0x2b, 0xb5,
-	0xb0, 0xa2, 0xaa, 0x1d, 0x9a, 0x5c, 0xfc, 0x07, 0xe4, 0xd2, 0x08, 0x5b, 0xea, 0xb9, 0xf3, 0xd3,
-	0x0f, 0x38, 0x78, 0xb3, 0x46, 0x89, 0x8a, 0xab, 0xaf, 0xa5, 0x5a, 0x58, 0x7a, 0x03, 0x1d, 0x5d,
-	0xaf, 0x81, 0x05, 0xf3, 0x07, 0xde, 0x70, 0x7f, 0x7c, 0x9a, 0xb5, 0x69, 0x99, 0x23, 0x5f, 0x9d,
-	0xcd, 0x5b, 0x8e, 0x1e, 0x43, 0x28, 0x72, 0xab, 0x0c, 0x0b, 0x06, 0xde, 0xb0, 0xcb, 0x9d, 0x98,
-	0x90, 0xd8, 0xeb, 0xfb, 0xe9, 0xaf, 0x07, 0xe1, 0xd3, 0x4a, 0xcd, 0x2d, 0xa5, 0x40, 0xec, 0x4f,
-	0xad, 0x10, 0x0a, 0x39, 0x7e, 0xd3, 0x7b, 0xe8, 0x6e, 0x0a, 0x33, 0x82, 0x71, 0x49, 0xe6, 0x1a,
-	0x67, 0x6d, 0xe3, 0xec, 0xbd, 0x25, 0xf8, 0x16, 0xa6, 0xe7, 0x00, 0xb9, 0x36, 0xaa, 0x2c, 0xe6,
-	0x9f, 0xa5, 0x64, 0x21, 0x06, 0x77, 0x9b, 0xcb, 0x8b, 0xa4, 0x87, 0xe0, 0x97, 0x92, 0x45, 0x78,
-	0xf6, 0x4b, 0x49, 0x13, 0x88, 0x2b, 0x65, 0x85, 0x14, 0x56, 0xb0, 0xce, 0xc0, 0x1b, 0xf6, 0xf8,
-	0x46, 0xbb, 0xa2, 0x13, 0x12, 0xfb, 0xfd, 0x20, 0x5d, 0xb5, 0x73, 0x34, 0x3f, 0x49, 0xaf, 0x20,
-	0x98, 0x89, 0x82, 0x79, 0xd8, 0xed, 0x6c, 0xa7, 0xdb, 0x63, 0xb3, 0x26, 0x5f, 0x53, 0xeb, 0x94,
-	0xdc, 0xe8, 0xea, 0x59, 0x09, 0x89, 0xe3, 0xc5, 0x7c, 0xa3, 0xe9, 0x09, 0x44, 0x56, 0xa3, 0x43,
-	0xd0, 0x69, 0xd4, 0x84, 0xc4, 0x41, 0x9f, 0x8c, 0x1f, 0x20, 0xe2, 0xb8, 0x32, 0xbd, 0x83, 0xc8,
-	0x35, 0xa0, 0x3b, 0xc3, 0x37, 0x4f, 0x94, 0x1c, 0x6d, 0x0d, 0x9c, 0x36, 0xdd, 0xbb, 0xf6, 0xa6,
-	0x11, 0x76, 0xba, 0xfd, 0x0b, 0x00, 0x00, 0xff, 0xff, 0x38, 0xa0, 0x3f, 0x7d, 0x2a, 0x02, 0x00,
-	0x00,
+	// 840 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xcc, 0x55, 0x51, 0x8f, 0xdb, 0x44,
+	0x10, 0xae, 0xe3, 0x38, 0x67, 0x8f, 0x73, 0x77, 0xd1, 0x72, 0x2a, 0x8b, 0x69, 0x8b, 0x65, 0x81,
+	0x64, 0x84, 0x94, 0x96, 0x80, 0x8e, 0xaa, 0x0f, 0x7d, 0x69, 0x0f, 0xb8, 0xa3, 0x08, 0xb4, 0x20,
+	0x5e, 0x2b, 0x27, 0x9e, 0xe4, 0xac, 0x3a, 0x76, 0xd8, 0xdd, 0x9c, 0x2e, 0x3f, 0x80, 0x9f, 0xc3,
+	0xaf, 0xe0, 0x47, 0xf0, 0xca, 0x4f, 0x41, 0x3b, 0x6b, 0x27, 0x39, 0xf7, 0x4e, 0x27, 0xde, 0x78,
+	0xdb, 0xf9, 0xe6, 0xdb, 0x99, 0xd9, 0x99, 0xcf, 0x63, 0x18, 0x4a, 0x9c, 0x97, 0x78, 0x3d, 0x5e,
+	0xc9, 0x5a, 0xd7, 0xcc, 0xb7, 0xd6, 0x6a, 0x1a, 0x7d, 0xb2, 0xa8, 0xeb, 0x45, 0x89, 0x4f, 0x09,
+	0x9f, 0xae, 0xe7, 0x4f, 0x75, 0xb1, 0x44, 0xa5, 0xb3, 0xe5, 0xca, 0x52, 0xa3, 0x27, 0x5d, 0x42,
+	0xbe, 0x96, 0x99, 0x2e, 0xea, 0xca, 0xfa, 0x93, 0x3f, 0x1d, 0x38, 0xfc, 0x45, 0x4b, 0xcc, 0x96,
+	0x02, 0x7f, 0x5f, 0xa3, 0xd2, 0xec, 0x4b, 0x38, 0xa8, 0x57, 0x86, 0xa1, 0x78, 0x2f, 0x76, 0xd2,
+	0x70, 0xf2, 0xe1, 0xb8, 0x4d, 0x37, 0xb6, 0xcc, 0x9f, 0xac, 0x5b, 0xb4, 0x3c, 0x76, 0x02, 0x5e,
+	0x36, 0xd7, 0x28, 0xb9, 0x1b, 0x3b, 0x69, 0x20, 0xac, 0xc1, 0x3e, 0x87, 0x11, 0xe5, 0x98, 0xd5,
+	0xe5, 0xdb, 0x2b, 0x94, 0xaa, 0xa8, 0x2b, 0xde, 0x8f, 0x9d, 0xd4, 0x13, 0xc7, 0x2d, 0xfe, 0x9b,
+	0x85, 0x59, 0x02, 0xc3, 0x59, 0xb6, 0xca, 0xa6, 0x45, 0x59, 0xe8, 0x02, 0x15, 0xf7, 0x62, 0x37,
+	0x0d, 0xc4, 0x0d, 0xec, 0xa2, 0xef, 0x3b, 0xa3, 0x5e, 0xf2, 0x8f, 0x0b, 0xde, 0xd9, 0x15, 0x56,
+	0x9a, 0x31, 0xe8, 0xeb, 0xcd, 0x0a, 0x29, 0xa7, 0x27, 0xe8, 0xcc, 0x9e, 0x43, 0xb0, 0x6d, 0x00,
+	0xe5, 0x0a, 0x27, 0xd1, 0xd8, 0x76, 0x60, 0xdc, 0x76, 0x60, 0xfc, 0x6b, 0xcb, 0x10, 0x3b, 0x32,
+	0x7b, 0x0c, 0x30, 0xaf, 0x25, 0x16, 0x8b, 0xea, 0x6d, 0x91, 0x73, 0x8f, 0xde, 0x11, 0x34, 0xc8,
+	0x79, 0xce, 0x8e, 0xa0, 0x57, 0xe4, 0x7c, 0x40, 0x70, 0xaf, 0xc8, 0x59, 0x04, 0xfe, 0x12, 0x75,
+	0x96, 0x67, 0x3a, 0xe3, 0x07, 0xb1, 0x93, 0x0e, 0xc5, 0xd6, 0x66, 0xaf, 0x60, 0xd8, 0x86, 0x7a,
+	0x87, 0x1b, 0xc5, 0xfd, 0xd8, 0x4d, 0xc3, 0x49, 0xbc, 0xeb, 0x22, 0xd5, 0x3f, 0xfe, 0xd6, 0x72,
+	0x7e, 0xc0, 0x8d, 0x3a, 0xab, 0xb4, 0xdc, 0x88, 0x70, 0xbe, 0x43, 0xd8, 0x29, 0x1c, 0x5c, 0x62,
+	0x96, 0xa3, 0x54, 0x3c, 0xa0, 0xfb, 0x8f, 0xba, 0xf7, 0xbf, 0xb7, 0x6e, 0x7b, 0xb7, 0x25, 0xb3,
+	0x8f, 0x21, 0xd0, 0x58, 0x65, 0x95, 0x36, 0xcf, 0x00, 0xaa, 0xd7, 0xb7, 0xc0, 0x79, 0xce, 0x1e,
+	0x41, 0x70, 0x89, 0x99, 0xd4, 0x53, 0xcc, 0x34, 0x0f, 0x63, 0x27, 0xf5, 0xc5, 0x0e, 0x88, 0x5e,
+	0xc2, 0xa8, 0x5b, 0x13, 0x1b, 0x81, 0xfb, 0x0e, 0x37, 0xdc, 0xa1, 0x40, 0xe6, 0x68, 0x66, 0x7d,
+	0x95, 0x95, 0x6b, 0x24, 0x71, 0x04, 0xc2, 0x1a, 0x2f, 0x7a, 0xcf, 0x9d, 0xe8, 0x05, 0x0c, 0xf7,
+	0x6b, 0xfa, 0x2f, 0x77, 0xed, 0x70, 0x2f, 0xfa, 0x7e, 0x6f, 0xe4, 0x26, 0x7f, 0x79, 0x70, 0x78,
+	0x43, 0x68, 0xec, 0x0b, 0x70, 0xcb, 0x6c, 0x41, 0x91, 0xc2, 0xc9, 0x47, 0xef, 0x0d, 0xf4, 0x75,
+	0x23, 0x69, 0x61, 0x58, 0x66, 0x34, 0x73, 0x59, 0x2f, 0x4d, 0x29, 0x94, 0xc7, 0x17, 0x5b, 0x9b,
+	0x3d, 0x84, 0x81, 0xae, 0xc9, 0xd3, 0x27, 0x4f, 0x63, 0xb1, 0x53, 0x7b, 0xc7, 0x28, 0x83, 0x7b,
+	0xf7, 0xca, 0x66, 0xcb, 0x65, 0x4f, 0x00, 0x72, 0x54, 0x33, 0xac, 0xf2, 0xa2, 0x5a, 0x90, 0x3c,
+	0x7c, 0xb1, 0x87, 0xb0, 0x18, 0xc2, 0x75, 0xa5, 0x8b, 0xf2, 0xd5, 0x5a, 0xaa, 0x5a, 0x92, 0x52,
+	0x02, 0xb1, 0x0f, 0x19, 0xc5, 0x92, 0x49, 0xa9, 0xfd, 0xfb, 0x15, 0xbb, 0x25, 0x9b, 0x66, 0x1a,
+	0xcd, 0x5b, 0x7d, 0x78, 0xc2, 0x1a, 0x2c, 0x85, 0xe3, 0x56, 0xb5, 0xaf, 0x7f, 0x96, 0x38, 0x2f,
+	0xae, 0x1b, 0x15, 0x74, 0x61, 0x76, 0x01, 0xfb, 0x82, 0xe3, 0x21, 0xa9, 0x2c, 0xbd, 0xe3, 0x5b,
+	0xbf, 0x47, 0xad, 0x2f, 0x77, 0x6a, 0x1d, 0x52, 0x9c, 0x4f, 0xef, 0x8a, 0x73, 0xbb, 0x6a, 0xcd,
+	0x5c, 0x48, 0xa4, 0xfc, 0x90, 0x8a, 0x6d, 0x2c, 0xf6, 0xcd, 0xbe, 0x60, 0x8f, 0xee, 0x1b, 0xff,
+	0xff, 0x46, 0xcb, 0xee, 0xa8, 0x9f, 0xfc, 0xe1, 0xc0, 0xe8, 0xc7, 0x75, 0xa9, 0x8b, 0x55, 0x89,
+	0xd7, 0xed, 0x6e, 0xb5, 0x6b, 0xc4, 0x44, 0x71, 0x69, 0x8d, 0x3c, 0x84, 0x81, 0xa2, 0xf6, 0x34,
+	0x51, 0x1a, 0xcb, 0xec, 0x60, 0x69, 0xaf, 0x70, 0xf7, 0xf6, 0x1d, 0xdc, 0x44, 0x14, 0x2d, 0xcf,
+	0x84, 0x9a, 0x65, 0xd5, 0x0c, 0xcb, 0x56, 0xda, 0xd6, 0x4a, 0x14, 0x1c, 0x6d, 0xcb, 0xb0, 0x8b,
+	0xb3, 0x5b, 0xc4, 0x67, 0xe0, 0xa1, 0x71, 0x34, 0xeb, 0xfe, 0xb8, 0xb3, 0x68, 0x84, 0xf5, 0x9a,
+	0x07, 0xa3, 0x94, 0xf5, 0x76, 0xc9, 0x93, 0x61, 0xd0, 0x59, 0x9d, 0xa3, 0xe2, 0x7d, 0x5a, 0xd9,
+	0xd6, 0x48, 0x4e, 0x80, 0xbd, 0x29, 0x94, 0xb6, 0xa5, 0xaa, 0xa6, 0xd6, 0xe4, 0x0c, 0x3e, 0xb8,
+	0x81, 0xaa, 0x55, 0x5d, 0x29, 0x64, 0x63, 0x38, 0xb0, 0xcf, 0x56, 0xdc, 0x21, 0xf1, 0x9c, 0x74,
+	0x1f, 0x7b, 0x5e, 0xcd, 0x6b, 0xd1, 0x92, 0x92, 0xaf, 0x01, 0x76, 0xb0, 0xf9, 0x0d, 0x54, 0xd9,
+	0x12, 0x9b, 0xd1, 0xd0, 0xd9, 0x60, 0x97, 0xed, 0xe7, 0x1f, 0x08, 0x3a, 0x4f, 0xfe, 0x76, 0x60,
+	0x20, 0x28, 0x2c, 0x3b, 0x85, 0x81, 0x0d, 0xc0, 0xee, 0x6a, 0x6b, 0xd4, 0x6d, 0x42, 0xf2, 0xe0,
+	0x99, 0xc3, 0xbe, 0x83, 0x60, 0xdb, 0x4a, 0x16, 0xed, 0x18, 0xdd, 0x31, 0x47, 0xfc, 0x16, 0x5f,
+	0x13, 0x26, 0x75, 0x9e, 0x39, 0xec, 0x0d, 0x84, 0x7b, 0x8d, 0x60, 0x7b, 0xab, 0xfd, 0xfd, 0xae,
+	0x45, 0x8f, 0xef, 0xf0, 0xda, 0xee, 0x25, 0x0f, 0xa6, 0x03, 0xfa, 0x12, 0xbe, 0xfa, 0x77, 0x00,
+	0xa2, 0x54, 0x0a, 0x47, 0x24, 0x08, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -246,6 +657,8 @@ const _ = grpc.SupportPackageIsVersion4
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type ReflexClient interface {
 	Stream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (Reflex_StreamClient, error)
+	Multiplex(ctx context.Context, opts ...grpc.CallOption) (Reflex_MultiplexClient, error)
+	ListStreams(ctx context.Context, in *ListStreamsRequest, opts ...grpc.CallOption) (*ListStreamsResponse, error)
 }
 
 type reflexClient struct {
@@ -288,9 +701,51 @@ func (x *reflexStreamClient) Recv() (*Event, error) {
 	return m, nil
 }
 
+func (c *reflexClient) Multiplex(ctx context.Context, opts ...grpc.CallOption) (Reflex_MultiplexClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Reflex_serviceDesc.Streams[1], "/reflexpb.Reflex/Multiplex", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &reflexMultiplexClient{stream}
+	return x, nil
+}
+
+type Reflex_MultiplexClient interface {
+	Send(*MultiplexRequest) error
+	Recv() (*MultiplexEvent, error)
+	grpc.ClientStream
+}
+
+type reflexMultiplexClient struct {
+	grpc.ClientStream
+}
+
+func (x *reflexMultiplexClient) Send(m *MultiplexRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *reflexMultiplexClient) Recv() (*MultiplexEvent, error) {
+	m := new(MultiplexEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *reflexClient) ListStreams(ctx context.Context, in *ListStreamsRequest, opts ...grpc.CallOption) (*ListStreamsResponse, error) {
+	out := new(ListStreamsResponse)
+	err := c.cc.Invoke(ctx, "/reflexpb.Reflex/ListStreams", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ReflexServer is the server API for Reflex service.
 type ReflexServer interface {
 	Stream(*StreamRequest, Reflex_StreamServer) error
+	Multiplex(Reflex_MultiplexServer) error
+	ListStreams(context.Context, *ListStreamsRequest) (*ListStreamsResponse, error)
 }
 
 // UnimplementedReflexServer can be embedded to have forward compatible implementations.
@@ -300,6 +755,12 @@ type UnimplementedReflexServer struct {
 func (*UnimplementedReflexServer) Stream(req *StreamRequest, srv Reflex_StreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
 }
+func (*UnimplementedReflexServer) Multiplex(srv Reflex_MultiplexServer) error {
+	return status.Errorf(codes.Unimplemented, "method Multiplex not implemented")
+}
+func (*UnimplementedReflexServer) ListStreams(ctx context.Context, req *ListStreamsRequest) (*ListStreamsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListStreams not implemented")
+}
 
 func RegisterReflexServer(s *grpc.Server, srv ReflexServer) {
 	s.RegisterService(&_Reflex_serviceDesc, srv)
@@ -326,16 +787,71 @@ func (x *reflexStreamServer) Send(m *Event) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Reflex_Multiplex_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ReflexServer).Multiplex(&reflexMultiplexServer{stream})
+}
+
+type Reflex_MultiplexServer interface {
+	Send(*MultiplexEvent) error
+	Recv() (*MultiplexRequest, error)
+	grpc.ServerStream
+}
+
+type reflexMultiplexServer struct {
+	grpc.ServerStream
+}
+
+func (x *reflexMultiplexServer) Send(m *MultiplexEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *reflexMultiplexServer) Recv() (*MultiplexRequest, error) {
+	m := new(MultiplexRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Reflex_ListStreams_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListStreamsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReflexServer).ListStreams(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/reflexpb.Reflex/ListStreams",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReflexServer).ListStreams(ctx, req.(*ListStreamsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Reflex_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "reflexpb.Reflex",
 	HandlerType: (*ReflexServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListStreams",
+			Handler:    _Reflex_ListStreams_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "Stream",
 			Handler:       _Reflex_Stream_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Multiplex",
+			Handler:       _Reflex_Multiplex_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "reflex.proto",
 }
@@ -0,0 +1,148 @@
+package reflex
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex/reflexpb"
+)
+
+// HeadFunc returns the head (latest event ID) of a stream,
+// see rsql.EventsTable.ToLatestID.
+type HeadFunc func(ctx context.Context) (int64, error)
+
+// StreamInfo describes a registered stream.
+type StreamInfo struct {
+	Name string
+
+	// Head is the cursor of the latest event or empty if unknown.
+	Head string
+}
+
+// NewStreamRegistry returns a new empty stream registry.
+func NewStreamRegistry() *StreamRegistry {
+	return &StreamRegistry{
+		streams: make(map[string]registeredStream),
+	}
+}
+
+// StreamRegistry contains the named streams of a server. It enables
+// generic tooling (e.g. tailing or lag dashboards) to discover streams
+// via the gRPC ListStreams method and to stream them by name via the
+// gRPC Multiplex method. It is safe for concurrent use.
+type StreamRegistry struct {
+	mu      sync.Mutex
+	streams map[string]registeredStream
+}
+
+type registeredStream struct {
+	stream StreamFunc
+	head   HeadFunc
+}
+
+// Register adds the named stream with its optional head function
+// to the registry. It replaces any existing stream with the name.
+func (r *StreamRegistry) Register(name string, stream StreamFunc, head HeadFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.streams[name] = registeredStream{stream: stream, head: head}
+}
+
+// Lookup returns the named stream or false if not registered.
+func (r *StreamRegistry) Lookup(name string) (StreamFunc, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.streams[name]
+	return s.stream, ok
+}
+
+// Streams returns a snapshot of the registered streams by name,
+// see Server.Multiplex.
+func (r *StreamRegistry) Streams() map[string]StreamFunc {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make(map[string]StreamFunc)
+	for name, s := range r.streams {
+		res[name] = s.stream
+	}
+	return res
+}
+
+// List returns the registered streams ordered by name with their heads.
+func (r *StreamRegistry) List(ctx context.Context) ([]StreamInfo, error) {
+	r.mu.Lock()
+	streams := make(map[string]registeredStream)
+	for name, s := range r.streams {
+		streams[name] = s
+	}
+	r.mu.Unlock()
+
+	var res []StreamInfo
+	for name, s := range streams {
+		info := StreamInfo{Name: name}
+		if s.head != nil {
+			head, err := s.head(ctx)
+			if err != nil {
+				return nil, errors.Wrap(err, "head error", j.KS("stream", name))
+			}
+			info.Head = strconv.FormatInt(head, 10)
+		}
+		res = append(res, info)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	return res, nil
+}
+
+// ListStreams returns the registered streams for a gRPC list streams method.
+func (s *Server) ListStreams(ctx context.Context, r *StreamRegistry,
+	_ *reflexpb.ListStreamsRequest) (*reflexpb.ListStreamsResponse, error) {
+
+	if err := s.maybeErrStopped(); err != nil {
+		return nil, err
+	}
+
+	infos, err := r.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res reflexpb.ListStreamsResponse
+	for _, info := range infos {
+		res.Streams = append(res.Streams, &reflexpb.StreamInfo{
+			Name: info.Name,
+			Head: info.Head,
+		})
+	}
+
+	return &res, nil
+}
+
+// WrapListStreamsPB wraps a gRPC client's list streams method and returns
+// a function listing the streams of the server.
+func WrapListStreamsPB(list func(context.Context, *reflexpb.ListStreamsRequest) (
+	*reflexpb.ListStreamsResponse, error)) func(context.Context) ([]StreamInfo, error) {
+
+	return func(ctx context.Context) ([]StreamInfo, error) {
+		res, err := list(ctx, new(reflexpb.ListStreamsRequest))
+		if err != nil {
+			return nil, err
+		}
+
+		var infos []StreamInfo
+		for _, s := range res.Streams {
+			infos = append(infos, StreamInfo{Name: s.Name, Head: s.Head})
+		}
+		return infos, nil
+	}
+}
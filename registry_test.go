@@ -0,0 +1,61 @@
+package reflex_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/grpctest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamRegistry(t *testing.T) {
+	r := reflex.NewStreamRegistry()
+
+	_, ok := r.Lookup("users")
+	require.False(t, ok)
+
+	r.Register("users", newMockStreamer(nil, nil).Stream, func(context.Context) (int64, error) {
+		return 5, nil
+	})
+	r.Register("orders", newMockStreamer(nil, nil).Stream, nil)
+
+	_, ok = r.Lookup("users")
+	require.True(t, ok)
+	require.Len(t, r.Streams(), 2)
+
+	infos, err := r.List(context.Background())
+	jtest.RequireNil(t, err)
+	require.Equal(t, []reflex.StreamInfo{
+		{Name: "orders"},
+		{Name: "users", Head: "5"},
+	}, infos)
+
+	errHead := errors.New("head error")
+	r.Register("users", newMockStreamer(nil, nil).Stream, func(context.Context) (int64, error) {
+		return 0, errHead
+	})
+	_, err = r.List(context.Background())
+	jtest.Require(t, errHead, err)
+}
+
+func TestListStreams(t *testing.T) {
+	srv, url := grpctest.NewServer(t, newMockStreamer(nil, nil).Stream, nil)
+	defer srv.Stop()
+	srv.Registry().Register("orders", newMockStreamer(nil, nil).Stream,
+		func(context.Context) (int64, error) {
+			return 10, nil
+		})
+
+	cl := grpctest.NewClient(t, url)
+	defer cl.Close()
+
+	infos, err := cl.ListStreams(context.Background())
+	jtest.RequireNil(t, err)
+	require.Equal(t, []reflex.StreamInfo{
+		{Name: grpctest.DefaultStream},
+		{Name: "orders", Head: "10"},
+	}, infos)
+}
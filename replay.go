@@ -0,0 +1,214 @@
+package reflex
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultReplayQuietPeriod = time.Minute
+
+type replayOptions struct {
+	fromTime    time.Time
+	until       []StreamOption
+	shadow      Consumer
+	dryRun      bool
+	quietPeriod time.Duration
+	isActive    func(ctx context.Context, consumerName string) (bool, error)
+}
+
+// ReplayOption defines a functional option that configures Replay.
+type ReplayOption func(*replayOptions)
+
+// WithReplayFromTime provides an option to reset the cursor to just before
+// the first event at or after the time instead of to the provided cursor.
+// It requires int event IDs.
+func WithReplayFromTime(t time.Time) ReplayOption {
+	return func(o *replayOptions) {
+		o.fromTime = t
+	}
+}
+
+// WithReplayShadow provides an option to replay the events from the new cursor
+// into the shadow consumer before resetting the cursor. The reset is aborted if
+// the shadow consumer returns an error. The shadow consumer should not have
+// side effects since it is only used for verification. Events are replayed
+// up to the current head or up to the bound configured via WithReplayUntil.
+func WithReplayShadow(c Consumer) ReplayOption {
+	return func(o *replayOptions) {
+		o.shadow = c
+	}
+}
+
+// WithReplayUntil provides an option to bound the shadow replay to events up
+// to and including the cursor.
+func WithReplayUntil(cursor string) ReplayOption {
+	return func(o *replayOptions) {
+		o.until = append(o.until, WithStreamUntil(cursor))
+	}
+}
+
+// WithReplayUntilTime provides an option to bound the shadow replay to events
+// before the time.
+func WithReplayUntilTime(t time.Time) ReplayOption {
+	return func(o *replayOptions) {
+		o.until = append(o.until, WithStreamUntilTime(t))
+	}
+}
+
+// WithReplayDryRun provides an option to only verify (and shadow replay)
+// without resetting the cursor.
+func WithReplayDryRun() ReplayOption {
+	return func(o *replayOptions) {
+		o.dryRun = true
+	}
+}
+
+// WithReplayQuietPeriod provides an option to set the duration for which the
+// consumer must have been inactive according to the consumer activity gauge
+// before resetting the cursor. It defaults to 1 minute.
+func WithReplayQuietPeriod(d time.Duration) ReplayOption {
+	return func(o *replayOptions) {
+		o.quietPeriod = d
+	}
+}
+
+// WithReplayActiveFunc provides an option to override how it is confirmed
+// that the consumer is stopped. This is required if the consumer is not
+// registered in this process, e.g. by querying the "reflex_consumer_active" metric of
+// the consumer's deployment.
+func WithReplayActiveFunc(fn func(ctx context.Context, consumerName string) (bool, error)) ReplayOption {
+	return func(o *replayOptions) {
+		o.isActive = fn
+	}
+}
+
+// Replay safely resets the cursor of the consumer so that it replays events after the
+// cursor when it is restarted. The consumer must be stopped, which by default is confirmed
+// via the in-process consumer activity gauge. It returns ErrConsumerActivityUnknown
+// if the consumer is not registered in this process, see WithReplayActiveFunc. The cursor store must implement CursorResetter.
+// The events can optionally be replayed into a shadow consumer for verification first.
+func Replay(ctx context.Context, stream StreamFunc, cstore CursorStore,
+	consumerName string, cursor string, opts ...ReplayOption) error {
+
+	o := replayOptions{quietPeriod: defaultReplayQuietPeriod}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.isActive == nil {
+		o.isActive = makeActivityCheck(o.quietPeriod)
+	}
+
+	resetter, ok := cstore.(CursorResetter)
+	if !ok && !o.dryRun {
+		return ErrResetNotSupported
+	}
+
+	if active, err := o.isActive(ctx, consumerName); err != nil {
+		return errors.Wrap(err, "activity check error")
+	} else if active {
+		return errors.Wrap(ErrConsumerActive, "", j.KS("consumer", consumerName))
+	}
+
+	if !o.fromTime.IsZero() {
+		var err error
+		cursor, err = cursorAtTime(ctx, stream, o.fromTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.shadow != nil {
+		if err := replayShadow(ctx, stream, cursor, o.shadow, o.until); err != nil {
+			return errors.Wrap(err, "shadow replay error")
+		}
+	}
+
+	if o.dryRun {
+		return nil
+	}
+
+	if err := resetter.ResetCursor(ctx, consumerName, cursor); err != nil {
+		return errors.Wrap(err, "reset cursor error")
+	}
+
+	return cstore.Flush(ctx)
+}
+
+// makeActivityCheck returns a function that returns true if the consumer
+// was active in the quiet period according to the consumer activity gauge.
+// It returns ErrConsumerActivityUnknown if the consumer is not registered
+// in this process since it may be running elsewhere.
+func makeActivityCheck(quiet time.Duration) func(context.Context, string) (bool, error) {
+	return func(_ context.Context, consumerName string) (bool, error) {
+		t, ok := consumerActivityGauge.LastActive(prometheus.Labels{consumerLabel: consumerName})
+		if !ok {
+			return false, errors.Wrap(ErrConsumerActivityUnknown, "",
+				j.KS("consumer", consumerName))
+		}
+		return since(t) < quiet, nil
+	}
+}
+
+// cursorAtTime returns the cursor just before the first event at or after t.
+func cursorAtTime(ctx context.Context, stream StreamFunc, t time.Time) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sc, err := stream(ctx, "", WithStreamFromTime(t), WithStreamToHead())
+	if err != nil {
+		return "", err
+	}
+	if closer, ok := sc.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	e, err := sc.Recv()
+	if IsHeadReachedErr(err) {
+		return "", ErrReplayCursorNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	if !e.IsIDInt() {
+		return "", errors.New("replay from time requires int event ids")
+	}
+
+	return strconv.FormatInt(e.IDInt()-1, 10), nil
+}
+
+// replayShadow consumes events after the cursor with the shadow
+// consumer until the head or bound is reached.
+func replayShadow(ctx context.Context, stream StreamFunc, cursor string,
+	shadow Consumer, until []StreamOption) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sc, err := stream(ctx, cursor, append([]StreamOption{WithStreamToHead()}, until...)...)
+	if err != nil {
+		return err
+	}
+	if closer, ok := sc.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	for {
+		e, err := sc.Recv()
+		if IsHeadReachedErr(err) {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "recv error")
+		}
+
+		if err := shadow.Consume(ctx, fate.New(), e); err != nil {
+			return errors.Wrap(err, "consume error", j.KS("event_id", e.ID))
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package reflex_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := t0
+	table := rtest.NewEventsTable(rtest.WithClock(func() time.Time {
+		clock = clock.Add(time.Hour)
+		return clock
+	}))
+	for i := 1; i <= 10; i++ {
+		table.Insert(strconv.Itoa(i), TestEventType(1))
+	}
+
+	inactive := reflex.WithReplayActiveFunc(func(context.Context, string) (bool, error) {
+		return false, nil
+	})
+
+	var shadowed []string
+	shadow := reflex.NewConsumer("shadow", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+		shadowed = append(shadowed, e.ID)
+		if e.ID == "9" {
+			return errors.New("shadow error")
+		}
+		return nil
+	})
+
+	ctx := context.Background()
+	cstore := rtest.NewCursorStore()
+	jtest.RequireNil(t, cstore.SetCursor(ctx, "test", "10"))
+
+	// Reset cursor
+	err := reflex.Replay(ctx, table.Stream, cstore, "test", "5", inactive)
+	jtest.RequireNil(t, err)
+	require.Equal(t, "5", cstore.Cursor("test"))
+
+	// Reset from time
+	err = reflex.Replay(ctx, table.Stream, cstore, "test", "",
+		reflex.WithReplayFromTime(t0.Add(time.Hour*3)), inactive)
+	jtest.RequireNil(t, err)
+	require.Equal(t, "2", cstore.Cursor("test"))
+
+	// Dry run shadow replay until cursor
+	err = reflex.Replay(ctx, table.Stream, cstore, "test", "5", inactive,
+		reflex.WithReplayShadow(shadow), reflex.WithReplayUntil("7"), reflex.WithReplayDryRun())
+	jtest.RequireNil(t, err)
+	require.Equal(t, []string{"6", "7"}, shadowed)
+	require.Equal(t, "2", cstore.Cursor("test"))
+
+	// Shadow error aborts reset
+	shadowed = nil
+	err = reflex.Replay(ctx, table.Stream, cstore, "test", "7", inactive,
+		reflex.WithReplayShadow(shadow))
+	require.Error(t, err)
+	require.Equal(t, []string{"8", "9"}, shadowed)
+	require.Equal(t, "2", cstore.Cursor("test"))
+
+	// Consumers not registered in this process are not reset
+	err = reflex.Replay(ctx, table.Stream, cstore, "test_unknown", "1")
+	jtest.Require(t, reflex.ErrConsumerActivityUnknown, err)
+	require.Equal(t, "", cstore.Cursor("test_unknown"))
+
+	// Active consumers are not reset
+	reflex.NewConsumer("test", nil) // Registers activity
+	err = reflex.Replay(ctx, table.Stream, cstore, "test", "1")
+	jtest.Require(t, reflex.ErrConsumerActive, err)
+	require.Equal(t, "2", cstore.Cursor("test"))
+
+	// Cursor store must support reset
+	err = reflex.Replay(ctx, table.Stream, noResetStore{cstore}, "test", "1", inactive)
+	jtest.Require(t, reflex.ErrResetNotSupported, err)
+}
+
+type noResetStore struct {
+	reflex.CursorStore
+}
@@ -0,0 +1,9 @@
+// Package rexport provides an exporter that streams reflex events into
+// rotating JSON Lines or Parquet files, e.g. to land events in a data lake.
+//
+// Files are written atomically by a Writer, either to a local directory or
+// to a gocloud.dev/blob bucket (e.g. S3). The cursor is only updated after a
+// file is written, so events are exported at-least-once. Files are named by
+// the ID of their first event, so a file re-exported after a failure replaces
+// the previous attempt if the rotation limits are unchanged.
+package rexport
@@ -0,0 +1,219 @@
+package rexport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+const (
+	defaultMaxEvents = 10000
+	defaultMaxAge    = time.Minute
+)
+
+// Option is a functional option that configures an exporter.
+type Option func(*Exporter)
+
+// WithFormat returns an option to configure the file format.
+// It defaults to JSONL.
+func WithFormat(f Format) Option {
+	return func(e *Exporter) {
+		e.format = f
+	}
+}
+
+// WithPrefix returns an option to configure the file name prefix,
+// e.g. "events/". It defaults to the exporter name followed by "/".
+func WithPrefix(prefix string) Option {
+	return func(e *Exporter) {
+		e.prefix = prefix
+	}
+}
+
+// WithMaxEvents returns an option to configure the maximum number of
+// events per file. It defaults to 10000.
+func WithMaxEvents(n int) Option {
+	return func(e *Exporter) {
+		e.maxEvents = n
+	}
+}
+
+// WithMaxAge returns an option to configure the maximum duration after the
+// first event of a file before the file is written. It defaults to one minute.
+func WithMaxAge(d time.Duration) Option {
+	return func(e *Exporter) {
+		e.maxAge = d
+	}
+}
+
+// WithStreamOpts returns an option to configure the stream options,
+// e.g. reflex.WithStreamTypes to only export some events.
+func WithStreamOpts(opts ...reflex.StreamOption) Option {
+	return func(e *Exporter) {
+		e.streamOpts = opts
+	}
+}
+
+// NewExporter returns an exporter that exports the events of the stream to
+// files written by the writer. The name is used as the cursor name.
+func NewExporter(name string, stream reflex.StreamFunc, cstore reflex.CursorStore,
+	w Writer, opts ...Option) *Exporter {
+
+	e := &Exporter{
+		name:      name,
+		stream:    stream,
+		cstore:    cstore,
+		w:         w,
+		format:    JSONL,
+		prefix:    name + "/",
+		maxEvents: defaultMaxEvents,
+		maxAge:    defaultMaxAge,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Exporter exports events into rotating files, see NewExporter.
+type Exporter struct {
+	name       string
+	stream     reflex.StreamFunc
+	cstore     reflex.CursorStore
+	w          Writer
+	format     Format
+	prefix     string
+	maxEvents  int
+	maxAge     time.Duration
+	streamOpts []reflex.StreamOption
+}
+
+type recvResult struct {
+	e   *reflex.Event
+	err error
+}
+
+// Run streams the events after the exporter's cursor and writes them to
+// files of up to the maximum number of events or maximum age, updating the
+// cursor after each file. It blocks until the stream or writer errors or
+// until the context is canceled. It always returns a non-nil error.
+func (e *Exporter) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer e.cstore.Flush(context.Background()) // best effort flush with new context
+
+	cursor, err := e.cstore.GetCursor(ctx, e.name)
+	if err != nil {
+		return errors.Wrap(err, "get cursor error")
+	}
+
+	sc, err := e.stream(ctx, cursor, e.streamOpts...)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan recvResult)
+	go func() {
+		for {
+			event, err := sc.Recv()
+			select {
+			case ch <- recvResult{e: event, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		// Wait for the first event of the next file.
+		var res recvResult
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case res = <-ch:
+		}
+		if res.err != nil {
+			return res.err
+		}
+
+		if err := e.exportFile(ctx, ch, res.e); err != nil {
+			return err
+		}
+	}
+}
+
+// exportFile writes a file starting with the first event and updates the
+// cursor. The file is written when it is full or when the maximum age is
+// reached. Stream errors are returned after writing the file.
+func (e *Exporter) exportFile(ctx context.Context, ch <-chan recvResult,
+	first *reflex.Event) error {
+
+	var (
+		buf     bytes.Buffer
+		enc     = e.format.NewEncoder(&buf)
+		last    = first
+		n       = 1
+		recvErr error
+	)
+	if err := enc.Encode(first); err != nil {
+		return err
+	}
+
+	t := time.NewTimer(e.maxAge)
+	defer t.Stop()
+
+loop:
+	for n < e.maxEvents {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			break loop
+		case res := <-ch:
+			if res.err != nil {
+				recvErr = res.err
+				break loop
+			}
+
+			if err := enc.Encode(res.e); err != nil {
+				return err
+			}
+			last = res.e
+			n++
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return errors.Wrap(err, "encode file error")
+	}
+
+	name := e.fileName(first)
+	if err := e.w.WriteFile(ctx, name, buf.Bytes()); err != nil {
+		return errors.Wrap(err, "write file error", j.KS("name", name))
+	}
+	exportedFilesCounter.WithLabelValues(e.name).Inc()
+	exportedEventsCounter.WithLabelValues(e.name).Add(float64(n))
+
+	if err := e.cstore.SetCursor(ctx, e.name, last.ID); err != nil {
+		return errors.Wrap(err, "set cursor error")
+	}
+
+	return recvErr
+}
+
+// fileName returns the name of the file starting with the event.
+// Int IDs are zero padded so names sort in event order.
+func (e *Exporter) fileName(first *reflex.Event) string {
+	if first.IsIDInt() {
+		return fmt.Sprintf("%s%020d%s", e.prefix, first.IDInt(), e.format.Ext())
+	}
+	return e.prefix + first.ID + e.format.Ext()
+}
@@ -0,0 +1,104 @@
+package rexport_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rexport"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+type testEventType int
+
+func (t testEventType) ReflexType() int {
+	return int(t)
+}
+
+func TestExporterJSONL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rexport")
+	jtest.RequireNil(t, err)
+	defer os.RemoveAll(dir)
+
+	table := rtest.NewEventsTable()
+	for i := 0; i < 5; i++ {
+		table.InsertWithMetadata("f", testEventType(1), []byte("meta"))
+	}
+
+	cstore := rtest.NewCursorStore()
+	exporter := rexport.NewExporter("export", table.Stream, cstore,
+		rexport.NewDirWriter(dir), rexport.WithMaxEvents(2),
+		rexport.WithMaxAge(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exporter.Run(ctx)
+
+	// The last file is written when the maximum age is reached.
+	require.Eventually(t, func() bool {
+		return cstore.Cursor("export") == "5"
+	}, time.Second, time.Millisecond)
+
+	files, err := filepath.Glob(filepath.Join(dir, "export", "*"))
+	jtest.RequireNil(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "export", "00000000000000000001.jsonl"),
+		filepath.Join(dir, "export", "00000000000000000003.jsonl"),
+		filepath.Join(dir, "export", "00000000000000000005.jsonl"),
+	}, files)
+
+	var ids []string
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		jtest.RequireNil(t, err)
+
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for s.Scan() {
+			var r rexport.Record
+			jtest.RequireNil(t, json.Unmarshal(s.Bytes(), &r))
+			require.Equal(t, []byte("meta"), r.MetaData)
+			ids = append(ids, r.ID)
+		}
+	}
+	require.Equal(t, []string{"1", "2", "3", "4", "5"}, ids)
+}
+
+func TestExporterParquet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rexport")
+	jtest.RequireNil(t, err)
+	defer os.RemoveAll(dir)
+
+	table := rtest.NewEventsTable()
+	for i := 0; i < 3; i++ {
+		table.Insert("f", testEventType(1))
+	}
+
+	cstore := rtest.NewCursorStore()
+	exporter := rexport.NewExporter("export", table.Stream, cstore,
+		rexport.NewDirWriter(dir), rexport.WithFormat(rexport.Parquet),
+		rexport.WithPrefix("lake/"), rexport.WithMaxEvents(3),
+		rexport.WithStreamOpts(reflex.WithStreamToHead()))
+
+	err = exporter.Run(context.Background())
+	jtest.Require(t, reflex.ErrHeadReached, err)
+	require.Equal(t, "3", cstore.Cursor("export"))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "lake", "00000000000000000001.parquet"))
+	jtest.RequireNil(t, err)
+
+	// Parquet files start and end with the magic preceded by the footer length.
+	require.Equal(t, "PAR1", string(b[:4]))
+	require.Equal(t, "PAR1", string(b[len(b)-4:]))
+	footer := binary.LittleEndian.Uint32(b[len(b)-8:])
+	require.True(t, int(footer) < len(b)-12)
+}
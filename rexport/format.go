@@ -0,0 +1,79 @@
+package rexport
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/luno/reflex"
+)
+
+// Format defines the file format of exported events.
+type Format interface {
+	// Ext returns the file name extension, e.g. ".jsonl".
+	Ext() string
+
+	// NewEncoder returns an encoder that writes a file to w.
+	NewEncoder(w io.Writer) Encoder
+}
+
+// Encoder encodes the events of a file.
+type Encoder interface {
+	// Encode encodes the next event of the file.
+	Encode(e *reflex.Event) error
+
+	// Close completes the file. The encoder may not be used afterwards.
+	Close() error
+}
+
+// Record is the exported representation of an event.
+type Record struct {
+	ID          string            `json:"id"`
+	ForeignID   string            `json:"foreign_id"`
+	Type        int               `json:"type"`
+	Timestamp   time.Time         `json:"timestamp"`
+	MetaData    []byte            `json:"metadata,omitempty"`
+	TenantID    string            `json:"tenant_id,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ForeignKeys map[string]string `json:"foreign_keys,omitempty"`
+}
+
+// makeRecord returns the record of the event.
+func makeRecord(e *reflex.Event) Record {
+	return Record{
+		ID:          e.ID,
+		ForeignID:   e.ForeignID,
+		Type:        e.Type.ReflexType(),
+		Timestamp:   e.Timestamp,
+		MetaData:    e.MetaData,
+		TenantID:    e.TenantID,
+		Headers:     e.Headers,
+		ForeignKeys: e.ForeignKeys,
+	}
+}
+
+// JSONL is the JSON Lines format with a JSON encoded Record per line.
+// Metadata is base64 encoded. JSONL files can be streamed with rblob.
+var JSONL Format = jsonlFormat{}
+
+type jsonlFormat struct{}
+
+func (jsonlFormat) Ext() string {
+	return ".jsonl"
+}
+
+func (jsonlFormat) NewEncoder(w io.Writer) Encoder {
+	return &jsonlEncoder{enc: json.NewEncoder(w)}
+}
+
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) Encode(event *reflex.Event) error {
+	return e.enc.Encode(makeRecord(event))
+}
+
+func (e *jsonlEncoder) Close() error {
+	return nil
+}
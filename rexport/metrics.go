@@ -0,0 +1,26 @@
+package rexport
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	exportedFilesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "rexport",
+		Name:      "files_total",
+		Help:      "Number of files written per exporter",
+	}, []string{"exporter"})
+
+	exportedEventsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "rexport",
+		Name:      "events_total",
+		Help:      "Number of events exported per exporter",
+	}, []string{"exporter"})
+)
+
+func init() {
+	prometheus.MustRegister(exportedFilesCounter)
+	prometheus.MustRegister(exportedEventsCounter)
+}
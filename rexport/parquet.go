@@ -0,0 +1,295 @@
+package rexport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/luno/reflex"
+)
+
+// Parquet is the Apache Parquet format with a flat schema of the Record
+// fields. Files have a single row group of uncompressed PLAIN encoded
+// required columns. The timestamp is a TIMESTAMP_MICROS int64 and headers
+// and foreign keys are JSON encoded strings. Missing values are empty.
+var Parquet Format = parquetFormat{}
+
+type parquetFormat struct{}
+
+func (parquetFormat) Ext() string {
+	return ".parquet"
+}
+
+func (parquetFormat) NewEncoder(w io.Writer) Encoder {
+	return &parquetEncoder{w: w}
+}
+
+// Parquet physical types, repetition types, converted types and
+// encodings, see parquet.thrift.
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+	parquetJSON            = 19
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+var parquetMagic = []byte("PAR1")
+
+// parquetColumn defines a column of the parquet schema.
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // Negative if none.
+	value     func(r Record) interface{}
+}
+
+var parquetColumns = []parquetColumn{
+	{name: "id", typ: parquetByteArray, converted: parquetUTF8,
+		value: func(r Record) interface{} { return []byte(r.ID) }},
+	{name: "foreign_id", typ: parquetByteArray, converted: parquetUTF8,
+		value: func(r Record) interface{} { return []byte(r.ForeignID) }},
+	{name: "type", typ: parquetInt64, converted: -1,
+		value: func(r Record) interface{} { return int64(r.Type) }},
+	{name: "timestamp", typ: parquetInt64, converted: parquetTimestampMicros,
+		value: func(r Record) interface{} { return r.Timestamp.UnixNano() / 1e3 }},
+	{name: "metadata", typ: parquetByteArray, converted: -1,
+		value: func(r Record) interface{} { return r.MetaData }},
+	{name: "tenant_id", typ: parquetByteArray, converted: parquetUTF8,
+		value: func(r Record) interface{} { return []byte(r.TenantID) }},
+	{name: "headers", typ: parquetByteArray, converted: parquetJSON,
+		value: func(r Record) interface{} { return jsonMap(r.Headers) }},
+	{name: "foreign_keys", typ: parquetByteArray, converted: parquetJSON,
+		value: func(r Record) interface{} { return jsonMap(r.ForeignKeys) }},
+}
+
+// jsonMap returns the JSON encoded map or empty if the map is empty.
+func jsonMap(m map[string]string) []byte {
+	if len(m) == 0 {
+		return nil
+	}
+	b, _ := json.Marshal(m) // String maps always marshal.
+	return b
+}
+
+// parquetEncoder buffers the records and writes the file on Close since
+// parquet files are column oriented.
+type parquetEncoder struct {
+	w       io.Writer
+	records []Record
+}
+
+func (e *parquetEncoder) Encode(event *reflex.Event) error {
+	e.records = append(e.records, makeRecord(event))
+	return nil
+}
+
+func (e *parquetEncoder) Close() error {
+	var buf bytes.Buffer
+	buf.Write(parquetMagic)
+
+	var chunks []parquetChunk
+	for _, col := range parquetColumns {
+		var page bytes.Buffer
+		for _, r := range e.records {
+			switch v := col.value(r).(type) {
+			case int64:
+				binary.Write(&page, binary.LittleEndian, v)
+			case []byte:
+				binary.Write(&page, binary.LittleEndian, uint32(len(v)))
+				page.Write(v)
+			}
+		}
+
+		var header thriftWriter
+		header.begin()
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(page.Len()))
+		header.structBegin(5)
+		header.i32(1, int32(len(e.records)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.end()
+		header.end()
+
+		chunks = append(chunks, parquetChunk{
+			col:    col,
+			offset: int64(buf.Len()),
+			size:   int64(header.buf.Len() + page.Len()),
+		})
+		buf.Write(header.buf.Bytes())
+		buf.Write(page.Bytes())
+	}
+
+	footer := parquetFooter(chunks, int64(len(e.records)))
+	buf.Write(footer)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(footer)))
+	buf.Write(parquetMagic)
+
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+// parquetChunk defines the column chunk of a column in the file.
+type parquetChunk struct {
+	col    parquetColumn
+	offset int64
+	size   int64
+}
+
+// parquetFooter returns the thrift encoded FileMetaData of the single
+// row group of the chunks.
+func parquetFooter(chunks []parquetChunk, rows int64) []byte {
+	var t thriftWriter
+	t.begin()
+	t.i32(1, 1) // Version
+
+	t.list(2, thriftStruct, len(chunks)+1)
+	t.begin()
+	t.str(4, "schema")
+	t.i32(5, int32(len(chunks)))
+	t.end()
+	for _, c := range chunks {
+		t.begin()
+		t.i32(1, c.col.typ)
+		t.i32(3, parquetRequired)
+		t.str(4, c.col.name)
+		if c.col.converted >= 0 {
+			t.i32(6, c.col.converted)
+		}
+		t.end()
+	}
+
+	t.i64(3, rows)
+
+	var total int64
+	for _, c := range chunks {
+		total += c.size
+	}
+
+	t.list(4, thriftStruct, 1)
+	t.begin()
+	t.list(1, thriftStruct, len(chunks))
+	for _, c := range chunks {
+		t.begin()
+		t.i64(2, c.offset)
+		t.structBegin(3)
+		t.i32(1, c.col.typ)
+		t.list(2, thriftI32, 1)
+		t.listI32(parquetPlain)
+		t.list(3, thriftBinary, 1)
+		t.listStr(c.col.name)
+		t.i32(4, 0) // UNCOMPRESSED
+		t.i64(5, rows)
+		t.i64(6, c.size)
+		t.i64(7, c.size)
+		t.i64(9, c.offset)
+		t.end()
+		t.end()
+	}
+	t.i64(2, total)
+	t.i64(3, rows)
+	t.end()
+
+	t.str(6, "github.com/luno/reflex/rexport")
+	t.end()
+
+	return t.buf.Bytes()
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes thrift compact protocol structs.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // Last field ID of each nested struct.
+}
+
+// begin begins a struct, e.g. a list element.
+func (t *thriftWriter) begin() {
+	t.last = append(t.last, 0)
+}
+
+// end ends the current struct.
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+// structBegin begins a struct field of the current struct.
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.listStr(s)
+}
+
+// list writes the header of a list field with n elements of the type.
+func (t *thriftWriter) list(id int16, typ byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | typ)
+	} else {
+		t.buf.WriteByte(0xf0 | typ)
+		t.varint(uint64(n))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) listStr(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	t.buf.Write(b[:n])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
@@ -0,0 +1,66 @@
+package rexport
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"gocloud.dev/blob"
+)
+
+// Writer writes export files.
+type Writer interface {
+	// WriteFile writes the file atomically, replacing any existing
+	// file with the same name.
+	WriteFile(ctx context.Context, name string, data []byte) error
+}
+
+// NewDirWriter returns a writer that writes files to the local directory.
+// Files are written to temporary files first and then renamed.
+func NewDirWriter(dir string) Writer {
+	return &dirWriter{dir: dir}
+}
+
+type dirWriter struct {
+	dir string
+}
+
+func (w *dirWriter) WriteFile(_ context.Context, name string, data []byte) error {
+	path := filepath.Join(w.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "write file error", j.KS("name", name))
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// NewBucketWriter returns a writer that writes files to the bucket, e.g.
+// an S3 bucket opened with the gocloud.dev/blob/s3blob driver.
+func NewBucketWriter(bucket *blob.Bucket) Writer {
+	return &bucketWriter{bucket: bucket}
+}
+
+type bucketWriter struct {
+	bucket *blob.Bucket
+}
+
+func (w *bucketWriter) WriteFile(ctx context.Context, name string, data []byte) error {
+	return w.bucket.WriteAll(ctx, name, data, nil)
+}
@@ -0,0 +1,200 @@
+package rgrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+	"google.golang.org/grpc/credentials"
+)
+
+// Certs defines the PEM encoded certificate files for mutual TLS.
+type Certs struct {
+	// CertFile and KeyFile are the certificate and private key
+	// presented to peers.
+	CertFile string
+	KeyFile  string
+
+	// CAFile is the certificate authority bundle that peer
+	// certificates are verified with.
+	CAFile string
+}
+
+// ServerCredentials returns transport credentials that require and verify
+// client certificates. The certificates are reloaded when the files change.
+func ServerCredentials(certs Certs) (credentials.TransportCredentials, error) {
+	return newCredentials(certs, true, "")
+}
+
+// ClientCredentials returns transport credentials that present the client
+// certificate and verify the server certificate. The server name overrides
+// the name verified in the server certificate if not empty, otherwise the
+// host of the dialed target is verified. The certificates are reloaded when
+// the files change.
+func ClientCredentials(certs Certs, serverName string) (credentials.TransportCredentials, error) {
+	return newCredentials(certs, false, serverName)
+}
+
+func newCredentials(certs Certs, server bool, serverName string) (*reloadingCreds, error) {
+	r := &certReloader{certs: certs}
+
+	// Fail fast on invalid certificates.
+	if _, _, err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return &reloadingCreds{
+		r:          r,
+		server:     server,
+		serverName: serverName,
+	}, nil
+}
+
+// reloadingCreds are TLS transport credentials that build the TLS
+// config with the current certificates on each handshake.
+type reloadingCreds struct {
+	r          *certReloader
+	server     bool
+	serverName string
+}
+
+func (c *reloadingCreds) current() (credentials.TransportCredentials, error) {
+	cert, pool, err := c.r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.server {
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		config.RootCAs = pool
+		config.ServerName = c.serverName
+	}
+
+	return credentials.NewTLS(config), nil
+}
+
+func (c *reloadingCreds) ClientHandshake(ctx context.Context, authority string,
+	conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+
+	creds, err := c.current()
+	if err != nil {
+		return nil, nil, err
+	}
+	return creds.ClientHandshake(ctx, authority, conn)
+}
+
+func (c *reloadingCreds) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	creds, err := c.current()
+	if err != nil {
+		return nil, nil, err
+	}
+	return creds.ServerHandshake(conn)
+}
+
+func (c *reloadingCreds) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{
+		SecurityProtocol: "tls",
+		SecurityVersion:  "1.2",
+		ServerName:       c.serverName,
+	}
+}
+
+func (c *reloadingCreds) Clone() credentials.TransportCredentials {
+	clone := *c
+	return &clone
+}
+
+func (c *reloadingCreds) OverrideServerName(name string) error {
+	c.serverName = name
+	return nil
+}
+
+// certReloader loads the certificate files and reloads them
+// when their modification times change.
+type certReloader struct {
+	certs Certs
+
+	mu       sync.Mutex
+	modTimes [3]time.Time
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+}
+
+// load returns the current certificate and CA pool. If reloading rotated
+// files fails, e.g. since only some of the files have been replaced, the
+// error is logged and the previous certificates are returned.
+func (r *certReloader) load() (*tls.Certificate, *x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes, err := r.statModTimes()
+	if err == nil && r.cert != nil && modTimes == r.modTimes {
+		return r.cert, r.pool, nil
+	}
+
+	if err == nil {
+		err = r.reload(modTimes)
+	}
+
+	if err != nil && r.cert != nil {
+		log.Error(nil, errors.Wrap(err, "reload certs error"))
+		return r.cert, r.pool, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	return r.cert, r.pool, nil
+}
+
+// reload reads and parses the certificate files. It must be
+// called with the mutex held.
+func (r *certReloader) reload(modTimes [3]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certs.CertFile, r.certs.KeyFile)
+	if err != nil {
+		return errors.Wrap(err, "load key pair error",
+			j.MKS{"cert_file": r.certs.CertFile, "key_file": r.certs.KeyFile})
+	}
+
+	ca, err := ioutil.ReadFile(r.certs.CAFile)
+	if err != nil {
+		return errors.Wrap(err, "read ca file error", j.KS("ca_file", r.certs.CAFile))
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return errors.New("no ca certificates found", j.KS("ca_file", r.certs.CAFile))
+	}
+
+	r.modTimes = modTimes
+	r.cert = &cert
+	r.pool = pool
+	return nil
+}
+
+// statModTimes returns the modification times of the files. Files are
+// followed if they are symlinks, e.g. mounted Kubernetes secrets.
+func (r *certReloader) statModTimes() ([3]time.Time, error) {
+	var res [3]time.Time
+	for i, name := range []string{r.certs.CertFile, r.certs.KeyFile, r.certs.CAFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return res, errors.Wrap(err, "stat cert file error", j.KS("file", name))
+		}
+		res[i] = fi.ModTime()
+	}
+	return res, nil
+}
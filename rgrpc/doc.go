@@ -0,0 +1,10 @@
+// Package rgrpc provides constructors of gRPC servers and client connections
+// for serving and consuming reflex streams over mutual TLS.
+//
+// Certificates are reloaded from their files when the files are rotated, so
+// long-running servers and clients don't need to be restarted. Keepalives are
+// tuned for long-lived streams: both sides ping idle connections so broken
+// connections fail streams instead of stalling them silently, and the server
+// permits the client's pings so clients are not disconnected with
+// "too_many_pings".
+package rgrpc
@@ -0,0 +1,129 @@
+package rgrpc
+
+import (
+	"time"
+
+	"github.com/luno/jettison/interceptors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	defaultKeepaliveTime    = 30 * time.Second
+	defaultKeepaliveTimeout = 10 * time.Second
+)
+
+// Option is a functional option that configures NewServer and Dial.
+type Option func(*options)
+
+type options struct {
+	keepaliveTime    time.Duration
+	keepaliveTimeout time.Duration
+	serverName       string
+	serverOpts       []grpc.ServerOption
+	dialOpts         []grpc.DialOption
+}
+
+func defaultOptions() options {
+	return options{
+		keepaliveTime:    defaultKeepaliveTime,
+		keepaliveTimeout: defaultKeepaliveTimeout,
+	}
+}
+
+// WithKeepalive returns an option to configure the duration of inactivity
+// after which connections are pinged and the timeout waiting for the ping
+// acknowledgement before the connection is closed. Servers permit client
+// pings every half the duration, so use the same option for servers and
+// clients. It defaults to 30s and 10s.
+func WithKeepalive(d, timeout time.Duration) Option {
+	return func(o *options) {
+		o.keepaliveTime = d
+		o.keepaliveTimeout = timeout
+	}
+}
+
+// WithServerName returns an option to configure the name verified in the
+// server certificate by Dial. It defaults to the host of the target.
+func WithServerName(name string) Option {
+	return func(o *options) {
+		o.serverName = name
+	}
+}
+
+// WithServerOptions returns an option to add gRPC server options to NewServer.
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(o *options) {
+		o.serverOpts = append(o.serverOpts, opts...)
+	}
+}
+
+// WithDialOptions returns an option to add gRPC dial options to Dial.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOpts = append(o.dialOpts, opts...)
+	}
+}
+
+// NewServer returns a gRPC server that requires mutual TLS with the
+// certificates, see ServerCredentials. Register the reflex service on it and
+// serve it as usual. The server keeps idle connections alive (see
+// WithKeepalive) and includes the jettison interceptors so reflex errors
+// like reflex.ErrStopped keep their error codes over the wire.
+func NewServer(certs Certs, opts ...Option) (*grpc.Server, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	creds, err := ServerCredentials(certs)
+	if err != nil {
+		return nil, err
+	}
+
+	serverOpts := append([]grpc.ServerOption{
+		grpc.Creds(creds),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    o.keepaliveTime,
+			Timeout: o.keepaliveTimeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             o.keepaliveTime / 2,
+			PermitWithoutStream: true,
+		}),
+		grpc.UnaryInterceptor(interceptors.UnaryServerInterceptor),
+		grpc.StreamInterceptor(interceptors.StreamServerInterceptor),
+	}, o.serverOpts...)
+
+	return grpc.NewServer(serverOpts...), nil
+}
+
+// Dial returns a gRPC client connection to the target that uses mutual TLS
+// with the certificates, see ClientCredentials. The connection keeps idle
+// streams alive (see WithKeepalive) so broken connections fail streams
+// instead of stalling them, and includes the jettison interceptors. Wrap
+// the stream method of the reflex service client with reflex.WrapStreamPB.
+func Dial(target string, certs Certs, opts ...Option) (*grpc.ClientConn, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	creds, err := ClientCredentials(certs, o.serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                o.keepaliveTime,
+			Timeout:             o.keepaliveTimeout,
+			PermitWithoutStream: true,
+		}),
+		grpc.WithUnaryInterceptor(interceptors.UnaryClientInterceptor),
+		grpc.WithStreamInterceptor(interceptors.StreamClientInterceptor),
+	}, o.dialOpts...)
+
+	return grpc.Dial(target, dialOpts...)
+}
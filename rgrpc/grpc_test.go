@@ -0,0 +1,179 @@
+package rgrpc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/reflexpb"
+	"github.com/luno/reflex/rgrpc"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rgrpc")
+	jtest.RequireNil(t, err)
+	defer os.RemoveAll(dir)
+
+	serverCerts := rgrpc.Certs{
+		CertFile: filepath.Join(dir, "server.pem"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+	clientCerts := rgrpc.Certs{
+		CertFile: filepath.Join(dir, "client.pem"),
+		KeyFile:  filepath.Join(dir, "client.key"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+	t0 := time.Now()
+	writeCerts(t, dir, t0)
+
+	table := rtest.NewEventsTable()
+	table.Insert("1", testEventType(1))
+
+	srv, err := rgrpc.NewServer(serverCerts)
+	jtest.RequireNil(t, err)
+	reflexpb.RegisterReflexServer(srv, &server{rserver: reflex.NewServer(), stream: table.Stream})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	jtest.RequireNil(t, err)
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	stream := func(t *testing.T, certs rgrpc.Certs) error {
+		conn, err := rgrpc.Dial(l.Addr().String(), certs, rgrpc.WithServerName("localhost"))
+		jtest.RequireNil(t, err)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		cl := reflexpb.NewReflexClient(conn)
+		sc, err := reflex.WrapStreamPB(func(ctx context.Context,
+			req *reflexpb.StreamRequest) (reflex.StreamClientPB, error) {
+			return cl.Stream(ctx, req)
+		})(ctx, "")
+		if err != nil {
+			return err
+		}
+
+		e, err := sc.Recv()
+		if err != nil {
+			return err
+		}
+		require.Equal(t, "1", e.ID)
+		return nil
+	}
+
+	jtest.RequireNil(t, stream(t, clientCerts))
+
+	// Certs from another CA are rejected.
+	otherDir, err := ioutil.TempDir("", "rgrpc")
+	jtest.RequireNil(t, err)
+	defer os.RemoveAll(otherDir)
+	writeCerts(t, otherDir, t0)
+	require.Error(t, stream(t, rgrpc.Certs{
+		CertFile: filepath.Join(otherDir, "client.pem"),
+		KeyFile:  filepath.Join(otherDir, "client.key"),
+		CAFile:   clientCerts.CAFile,
+	}))
+
+	// Rotated certs of a new CA are reloaded by both the server and client.
+	writeCerts(t, dir, t0.Add(time.Hour))
+	jtest.RequireNil(t, stream(t, clientCerts))
+}
+
+func TestInvalidCerts(t *testing.T) {
+	_, err := rgrpc.NewServer(rgrpc.Certs{CertFile: "missing.pem"})
+	require.Error(t, err)
+
+	_, err = rgrpc.Dial("localhost:0", rgrpc.Certs{CertFile: "missing.pem"})
+	require.Error(t, err)
+}
+
+// writeCerts writes a new CA and server and client certificates
+// signed by it to the directory with the modification time.
+func writeCerts(t *testing.T, dir string, modTime time.Time) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jtest.RequireNil(t, err)
+
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	jtest.RequireNil(t, err)
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", caDER, modTime)
+
+	for i, name := range []string{"server", "client"} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		jtest.RequireNil(t, err)
+
+		cert := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{"localhost"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+		jtest.RequireNil(t, err)
+		writePEM(t, filepath.Join(dir, name+".pem"), "CERTIFICATE", der, modTime)
+
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		jtest.RequireNil(t, err)
+		writePEM(t, filepath.Join(dir, name+".key"), "EC PRIVATE KEY", keyDER, modTime)
+	}
+}
+
+func writePEM(t *testing.T, name, typ string, der []byte, modTime time.Time) {
+	b := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	jtest.RequireNil(t, ioutil.WriteFile(name, b, 0600))
+	jtest.RequireNil(t, os.Chtimes(name, modTime, modTime))
+}
+
+type testEventType int
+
+func (t testEventType) ReflexType() int {
+	return int(t)
+}
+
+type server struct {
+	rserver *reflex.Server
+	stream  reflex.StreamFunc
+}
+
+func (s *server) Stream(req *reflexpb.StreamRequest, ss reflexpb.Reflex_StreamServer) error {
+	return s.rserver.Stream(s.stream, req, ss)
+}
+
+func (s *server) Multiplex(ms reflexpb.Reflex_MultiplexServer) error {
+	return s.rserver.Multiplex(map[string]reflex.StreamFunc{"default": s.stream}, ms)
+}
+
+func (s *server) ListStreams(ctx context.Context,
+	req *reflexpb.ListStreamsRequest) (*reflexpb.ListStreamsResponse, error) {
+
+	return s.rserver.ListStreams(ctx, reflex.NewStreamRegistry(), req)
+}
@@ -0,0 +1,14 @@
+// Package rkinesis provides reflex streams of events from an AWS Kinesis
+// data stream and a publisher that mirrors reflex events to it.
+//
+// A stream can be consumed either per shard (one Spec per shard) with
+// sequence number cursors, or as a single merged stream of all shards
+// with a composite cursor containing the sequence number of each shard.
+//
+// Resharding is handled by only streaming child shards once their parent
+// shards have been fully streamed. Per shard streams return ErrShardClosed
+// once a closed shard has been fully streamed, after which the child shards
+// (see Shards) should be streamed.
+//
+// Records are JSON encoded events by default, see Publisher and WithRawRecords.
+package rkinesis
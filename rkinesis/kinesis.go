@@ -0,0 +1,531 @@
+package rkinesis
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+// ErrShardClosed is returned by a per shard stream once the shard
+// was closed by resharding and all its records have been streamed.
+var ErrShardClosed = errors.New("kinesis shard closed", j.C("ERR_5a1e0c93b7f42d68"))
+
+// closedSeq is the composite cursor sequence of fully streamed closed shards.
+const closedSeq = "closed"
+
+// Option is a functional option that configures a stream.
+type Option func(*Stream)
+
+// WithBackoff returns an option to configure the backoff duration
+// before polling shards again once no new records are available.
+// It defaults to one second.
+func WithBackoff(d time.Duration) Option {
+	return func(s *Stream) {
+		s.backoff = d
+	}
+}
+
+// WithLimit returns an option to configure the maximum number of records
+// fetched per shard in a single request. It defaults to 1000.
+func WithLimit(n int64) Option {
+	return func(s *Stream) {
+		s.limit = n
+	}
+}
+
+// WithRawRecords returns an option to stream records not published by a
+// Publisher. The record data is streamed as event metadata, the partition
+// key as foreign ID and the event type is zero.
+func WithRawRecords() Option {
+	return func(s *Stream) {
+		s.raw = true
+	}
+}
+
+// NewStream returns a stream for the provided kinesis stream name.
+func NewStream(api kinesisiface.KinesisAPI, name string, opts ...Option) *Stream {
+	s := &Stream{
+		api:     api,
+		name:    name,
+		backoff: time.Second,
+		limit:   1000,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Stream defines a kinesis data stream from which to stream records as events.
+type Stream struct {
+	api     kinesisiface.KinesisAPI
+	name    string
+	backoff time.Duration
+	limit   int64
+	raw     bool
+}
+
+// Shards returns the ids of the open shards of the stream.
+func (s *Stream) Shards(ctx context.Context) ([]string, error) {
+	shards, err := s.listShards(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for _, sh := range shards {
+		if sh.SequenceNumberRange.EndingSequenceNumber == nil {
+			res = append(res, aws.StringValue(sh.ShardId))
+		}
+	}
+	return res, nil
+}
+
+// ShardStream returns a reflex.StreamFunc that streams the records of a single
+// shard after the provided sequence number cursor. It supports the StreamFromHead,
+// StreamFromTime and StreamToHead options.
+func (s *Stream) ShardStream(shardID string) reflex.StreamFunc {
+	return func(ctx context.Context, after string,
+		opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+
+		sc := s.newClient(ctx, opts)
+		sc.single = shardID
+		if sc.o.StreamFromHead {
+			after = ""
+		}
+		if err := sc.startShard(shardID, after, sc.o.StreamFromHead); err != nil {
+			return nil, err
+		}
+		return sc, nil
+	}
+}
+
+// Stream implements reflex.StreamFunc and returns a StreamClient that streams the
+// records of all shards after the provided composite cursor. Records of a shard are
+// streamed in order, but records of different shards are interleaved. It supports
+// the StreamFromHead, StreamFromTime and StreamToHead options.
+func (s *Stream) Stream(ctx context.Context, after string,
+	opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+
+	positions, err := parseCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := s.newClient(ctx, opts)
+	sc.positions = positions
+
+	shards, err := s.listShards(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if sc.o.StreamFromHead {
+		// Skip closed shards and ignore the cursor when streaming from head.
+		sc.positions = make(map[string]string)
+		for _, sh := range shards {
+			if sh.SequenceNumberRange.EndingSequenceNumber != nil {
+				sc.positions[aws.StringValue(sh.ShardId)] = closedSeq
+			}
+		}
+	}
+
+	if err := sc.startShards(shards, sc.o.StreamFromHead); err != nil {
+		return nil, err
+	}
+
+	return sc, nil
+}
+
+func (s *Stream) newClient(ctx context.Context, opts []reflex.StreamOption) *streamclient {
+	var o reflex.StreamOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &streamclient{
+		ctx:       ctx,
+		stream:    s,
+		o:         o,
+		positions: make(map[string]string),
+		iterators: make(map[string]string),
+	}
+}
+
+func (s *Stream) listShards(ctx context.Context) ([]*kinesis.Shard, error) {
+	var (
+		res []*kinesis.Shard
+		in  = &kinesis.ListShardsInput{StreamName: aws.String(s.name)}
+	)
+	for {
+		out, err := s.api.ListShardsWithContext(ctx, in)
+		if err != nil {
+			return nil, errors.Wrap(err, "list shards error", j.KS("stream", s.name))
+		}
+		res = append(res, out.Shards...)
+
+		if out.NextToken == nil {
+			return res, nil
+		}
+		in = &kinesis.ListShardsInput{NextToken: out.NextToken}
+	}
+}
+
+type record struct {
+	shardID string
+	rec     *kinesis.Record
+	last    bool // Last record of a closed shard.
+}
+
+type streamclient struct {
+	ctx    context.Context
+	stream *Stream
+	o      reflex.StreamOptions
+	single string // Shard ID if streaming a single shard.
+
+	positions map[string]string // Shard ID to last sequence number or closedSeq.
+	iterators map[string]string // Shard ID to next shard iterator of open shards.
+	order     []string          // Round robin order of iterators.
+	next      int
+	buf       []record
+	behind    map[string]bool // Shards not caught up, if streaming to head.
+}
+
+// startShards starts iterators of all shards that are readable; i.e. not closed
+// and all parents are fully streamed or not available anymore.
+func (s *streamclient) startShards(shards []*kinesis.Shard, fromHead bool) error {
+	listed := make(map[string]bool)
+	for _, sh := range shards {
+		listed[aws.StringValue(sh.ShardId)] = true
+	}
+
+	// Prune positions of shards that expired.
+	for id := range s.positions {
+		if !listed[id] {
+			delete(s.positions, id)
+		}
+	}
+
+	done := func(id string) bool {
+		return id == "" || !listed[id] || s.positions[id] == closedSeq
+	}
+
+	for _, sh := range shards {
+		id := aws.StringValue(sh.ShardId)
+		if _, ok := s.iterators[id]; ok || s.positions[id] == closedSeq {
+			continue
+		}
+		if !done(aws.StringValue(sh.ParentShardId)) ||
+			!done(aws.StringValue(sh.AdjacentParentShardId)) {
+			continue
+		}
+
+		if err := s.startShard(id, s.positions[id], fromHead); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startShard starts the shard iterator after the sequence number. If the
+// sequence number is empty it starts at the latest record if fromHead, at
+// the StreamFromTime option if set, otherwise at the oldest record.
+func (s *streamclient) startShard(id string, after string, fromHead bool) error {
+	in := &kinesis.GetShardIteratorInput{
+		StreamName:        aws.String(s.stream.name),
+		ShardId:           aws.String(id),
+		ShardIteratorType: aws.String(kinesis.ShardIteratorTypeTrimHorizon),
+	}
+
+	if after != "" {
+		in.ShardIteratorType = aws.String(kinesis.ShardIteratorTypeAfterSequenceNumber)
+		in.StartingSequenceNumber = aws.String(after)
+	} else if fromHead {
+		in.ShardIteratorType = aws.String(kinesis.ShardIteratorTypeLatest)
+	} else if !s.o.StreamFromTime.IsZero() {
+		in.ShardIteratorType = aws.String(kinesis.ShardIteratorTypeAtTimestamp)
+		in.Timestamp = aws.Time(s.o.StreamFromTime)
+	}
+
+	out, err := s.stream.api.GetShardIteratorWithContext(s.ctx, in)
+	if err != nil {
+		return errors.Wrap(err, "get shard iterator error", j.KS("shard", id))
+	}
+
+	if after != "" {
+		s.positions[id] = after
+	}
+	s.iterators[id] = aws.StringValue(out.ShardIterator)
+	s.order = append(s.order, id)
+	sort.Strings(s.order)
+
+	if s.o.StreamToHead {
+		if s.behind == nil {
+			s.behind = make(map[string]bool)
+		}
+		s.behind[id] = true
+	}
+
+	return nil
+}
+
+func (s *streamclient) Recv() (*reflex.Event, error) {
+	for len(s.buf) == 0 {
+		if err := s.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if s.single != "" && s.positions[s.single] == closedSeq {
+			return nil, ErrShardClosed
+		} else if s.o.StreamToHead && len(s.behind) == 0 {
+			return nil, reflex.ErrHeadReached
+		}
+
+		polled, err := s.poll()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(s.buf) == 0 && polled {
+			// All shards polled without new records.
+			t := time.NewTimer(s.stream.backoff)
+			select {
+			case <-s.ctx.Done():
+				t.Stop()
+				return nil, s.ctx.Err()
+			case <-t.C:
+			}
+		}
+	}
+
+	r := s.buf[0]
+	s.buf = s.buf[1:]
+
+	s.positions[r.shardID] = aws.StringValue(r.rec.SequenceNumber)
+	if r.last {
+		s.positions[r.shardID] = closedSeq
+	}
+
+	cursor := s.positions[r.shardID]
+	if s.single == "" {
+		cursor = formatCursor(s.positions)
+	} else if r.last {
+		cursor = aws.StringValue(r.rec.SequenceNumber)
+	}
+
+	return s.stream.toEvent(cursor, r.rec)
+}
+
+// poll gets the records of the next shard in round robin order. It returns
+// true if all shards were polled since the last record was received.
+func (s *streamclient) poll() (bool, error) {
+	if len(s.order) == 0 {
+		return true, nil
+	}
+	if s.next >= len(s.order) {
+		s.next = 0
+	}
+
+	id := s.order[s.next]
+	s.next++
+
+	out, err := s.stream.api.GetRecordsWithContext(s.ctx, &kinesis.GetRecordsInput{
+		ShardIterator: aws.String(s.iterators[id]),
+		Limit:         aws.Int64(s.stream.limit),
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "get records error", j.KS("shard", id))
+	}
+
+	for _, rec := range out.Records {
+		s.buf = append(s.buf, record{shardID: id, rec: rec})
+	}
+
+	if aws.Int64Value(out.MillisBehindLatest) == 0 {
+		delete(s.behind, id)
+	}
+
+	if out.NextShardIterator != nil {
+		s.iterators[id] = aws.StringValue(out.NextShardIterator)
+		return s.next >= len(s.order), nil
+	}
+
+	// The shard is closed.
+	if err := s.closeShard(id); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// closeShard removes the iterator of the closed shard and starts its
+// child shards when streaming all shards.
+func (s *streamclient) closeShard(id string) error {
+	delete(s.iterators, id)
+	delete(s.behind, id)
+	for i, o := range s.order {
+		if o == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+
+	if len(s.buf) > 0 && s.buf[len(s.buf)-1].shardID == id {
+		s.buf[len(s.buf)-1].last = true
+	} else {
+		s.positions[id] = closedSeq
+	}
+
+	if s.single != "" {
+		return nil
+	}
+
+	shards, err := s.stream.listShards(s.ctx)
+	if err != nil {
+		return err
+	}
+
+	// Consider the closed shard done when starting children since its
+	// remaining records are already buffered.
+	prev := s.positions[id]
+	s.positions[id] = closedSeq
+	err = s.startShards(shards, false)
+	s.positions[id] = prev
+	return err
+}
+
+// parseCursor parses a composite cursor of "shard=sequence" pairs.
+func parseCursor(cursor string) (map[string]string, error) {
+	res := make(map[string]string)
+	if cursor == "" {
+		return res, nil
+	}
+
+	for _, pair := range strings.Split(cursor, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, errors.New("invalid cursor", j.KS("cursor", cursor))
+		}
+		res[kv[0]] = kv[1]
+	}
+	return res, nil
+}
+
+// formatCursor returns the composite cursor of the positions ordered by shard.
+func formatCursor(positions map[string]string) string {
+	var pairs []string
+	for id, seq := range positions {
+		pairs = append(pairs, id+"="+seq)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// envelope is the JSON encoding of events published to kinesis.
+type envelope struct {
+	ID          string            `json:"id"`
+	Type        int               `json:"type"`
+	ForeignID   string            `json:"foreign_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	MetaData    []byte            `json:"metadata,omitempty"`
+	ForeignKeys map[string]string `json:"foreign_keys,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	TenantID    string            `json:"tenant_id,omitempty"`
+}
+
+func (s *Stream) toEvent(cursor string, rec *kinesis.Record) (*reflex.Event, error) {
+	if s.raw {
+		return &reflex.Event{
+			ID:        cursor,
+			ForeignID: aws.StringValue(rec.PartitionKey),
+			Timestamp: aws.TimeValue(rec.ApproximateArrivalTimestamp),
+			MetaData:  rec.Data,
+			Type:      eventType(0),
+		}, nil
+	}
+
+	var e envelope
+	if err := json.Unmarshal(rec.Data, &e); err != nil {
+		return nil, errors.Wrap(err, "unmarshal record error",
+			j.KS("sequence", aws.StringValue(rec.SequenceNumber)))
+	}
+
+	return &reflex.Event{
+		ID:          cursor,
+		Type:        eventType(e.Type),
+		ForeignID:   e.ForeignID,
+		Timestamp:   e.Timestamp,
+		MetaData:    e.MetaData,
+		ForeignKeys: e.ForeignKeys,
+		Headers:     e.Headers,
+		TenantID:    e.TenantID,
+	}, nil
+}
+
+// NewPublisher returns a publisher of events to the kinesis stream.
+func NewPublisher(api kinesisiface.KinesisAPI, name string) *Publisher {
+	return &Publisher{api: api, name: name}
+}
+
+// Publisher publishes JSON encoded reflex events to a kinesis stream
+// using the event foreign ID as partition key, so events of the same
+// entity are ordered.
+type Publisher struct {
+	api  kinesisiface.KinesisAPI
+	name string
+}
+
+// Publish publishes the event to the stream.
+func (p *Publisher) Publish(ctx context.Context, e *reflex.Event) error {
+	data, err := json.Marshal(envelope{
+		ID:          e.ID,
+		Type:        e.Type.ReflexType(),
+		ForeignID:   e.ForeignID,
+		Timestamp:   e.Timestamp,
+		MetaData:    e.MetaData,
+		ForeignKeys: e.ForeignKeys,
+		Headers:     e.Headers,
+		TenantID:    e.TenantID,
+	})
+	if err != nil {
+		return err
+	}
+
+	key := e.ForeignID
+	if key == "" {
+		key = e.ID
+	}
+
+	_, err = p.api.PutRecordWithContext(ctx, &kinesis.PutRecordInput{
+		StreamName:   aws.String(p.name),
+		PartitionKey: aws.String(key),
+		Data:         data,
+	})
+	return errors.Wrap(err, "put record error", j.KS("event_id", e.ID))
+}
+
+// Consumer returns a reflex consumer that publishes events,
+// e.g. to mirror the events of an events table.
+func (p *Publisher) Consumer(name string, opts ...reflex.ConsumerOption) reflex.Consumer {
+	return reflex.NewConsumer(name, func(ctx context.Context, _ fate.Fate, e *reflex.Event) error {
+		return p.Publish(ctx, e)
+	}, opts...)
+}
+
+// eventType is the rkinesis internal implementation of EventType interface.
+type eventType int
+
+func (t eventType) ReflexType() int {
+	return int(t)
+}
@@ -0,0 +1,186 @@
+package rkinesis_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rkinesis"
+	"github.com/stretchr/testify/require"
+)
+
+type testEventType int
+
+func (t testEventType) ReflexType() int {
+	return int(t)
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+
+	// Shard "a" was split into "b", "c" is unrelated.
+	api := newMockKinesis(
+		&kinesis.Shard{ShardId: aws.String("a")},
+		&kinesis.Shard{ShardId: aws.String("b"), ParentShardId: aws.String("a")},
+		&kinesis.Shard{ShardId: aws.String("c")},
+	)
+
+	// Publish events to the shard of their foreign ID.
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := rkinesis.NewPublisher(api, "test")
+	for i, shard := range []string{"a", "a", "b", "c"} {
+		err := p.Publish(ctx, &reflex.Event{
+			ID:        strconv.Itoa(i + 1),
+			Type:      testEventType(i + 1),
+			ForeignID: shard,
+			Timestamp: t0,
+		})
+		jtest.RequireNil(t, err)
+	}
+	api.close("a")
+
+	s := rkinesis.NewStream(api, "test", rkinesis.WithBackoff(time.Millisecond))
+
+	shards, err := s.Shards(ctx)
+	jtest.RequireNil(t, err)
+	require.Equal(t, []string{"b", "c"}, shards)
+
+	streamAll := func(t *testing.T, stream reflex.StreamFunc,
+		after string, endErr error) ([]int, string) {
+
+		sc, err := stream(ctx, after, reflex.WithStreamToHead())
+		jtest.RequireNil(t, err)
+
+		var types []int
+		for {
+			e, err := sc.Recv()
+			if errors.Is(err, endErr) {
+				return types, after
+			}
+			jtest.RequireNil(t, err)
+			require.True(t, t0.Equal(e.Timestamp))
+			types = append(types, e.Type.ReflexType())
+			after = e.ID
+		}
+	}
+
+	// Merged stream streams child shards after parents.
+	types, cursor := streamAll(t, s.Stream, "", reflex.ErrHeadReached)
+	require.Equal(t, []int{1, 4, 2, 3}, types)
+	require.Equal(t, "a=closed,b=0,c=0", cursor)
+
+	types, _ = streamAll(t, s.Stream, cursor, reflex.ErrHeadReached)
+	require.Empty(t, types)
+
+	types, _ = streamAll(t, s.Stream, "a=0,c=0", reflex.ErrHeadReached)
+	require.Equal(t, []int{2, 3}, types)
+
+	// Shard streams return ErrShardClosed once closed shards are streamed.
+	types, cursor = streamAll(t, s.ShardStream("a"), "", rkinesis.ErrShardClosed)
+	require.Equal(t, []int{1, 2}, types)
+	require.Equal(t, "1", cursor)
+
+	types, _ = streamAll(t, s.ShardStream("b"), "", reflex.ErrHeadReached)
+	require.Equal(t, []int{3}, types)
+}
+
+// mockKinesis is an in-memory kinesis stream with a batch limit of one
+// record. Sequence numbers are record indexes in the shard.
+type mockKinesis struct {
+	kinesisiface.KinesisAPI
+	shards  []*kinesis.Shard
+	records map[string][]*kinesis.Record
+	closed  map[string]bool
+}
+
+func newMockKinesis(shards ...*kinesis.Shard) *mockKinesis {
+	for _, sh := range shards {
+		sh.SequenceNumberRange = &kinesis.SequenceNumberRange{}
+	}
+	return &mockKinesis{
+		shards:  shards,
+		records: make(map[string][]*kinesis.Record),
+		closed:  make(map[string]bool),
+	}
+}
+
+func (m *mockKinesis) close(shard string) {
+	m.closed[shard] = true
+	for _, sh := range m.shards {
+		if aws.StringValue(sh.ShardId) == shard {
+			sh.SequenceNumberRange.EndingSequenceNumber = aws.String("end")
+		}
+	}
+}
+
+func (m *mockKinesis) ListShardsWithContext(aws.Context, *kinesis.ListShardsInput,
+	...request.Option) (*kinesis.ListShardsOutput, error) {
+	return &kinesis.ListShardsOutput{Shards: m.shards}, nil
+}
+
+func (m *mockKinesis) GetShardIteratorWithContext(_ aws.Context, in *kinesis.GetShardIteratorInput,
+	_ ...request.Option) (*kinesis.GetShardIteratorOutput, error) {
+
+	shard := aws.StringValue(in.ShardId)
+	var i int
+	switch aws.StringValue(in.ShardIteratorType) {
+	case kinesis.ShardIteratorTypeAfterSequenceNumber:
+		seq, err := strconv.Atoi(aws.StringValue(in.StartingSequenceNumber))
+		if err != nil {
+			return nil, err
+		}
+		i = seq + 1
+	case kinesis.ShardIteratorTypeLatest:
+		i = len(m.records[shard])
+	}
+	return &kinesis.GetShardIteratorOutput{ShardIterator: aws.String(shard + ":" + strconv.Itoa(i))}, nil
+}
+
+func (m *mockKinesis) GetRecordsWithContext(_ aws.Context, in *kinesis.GetRecordsInput,
+	_ ...request.Option) (*kinesis.GetRecordsOutput, error) {
+
+	parts := strings.Split(aws.StringValue(in.ShardIterator), ":")
+	shard := parts[0]
+	i, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	recs := m.records[shard]
+	var res []*kinesis.Record
+	if i < len(recs) {
+		res = recs[i : i+1]
+		i++
+	}
+
+	out := &kinesis.GetRecordsOutput{
+		Records:            res,
+		MillisBehindLatest: aws.Int64(int64(len(recs) - i)),
+	}
+	if !m.closed[shard] || i < len(recs) {
+		out.NextShardIterator = aws.String(shard + ":" + strconv.Itoa(i))
+	}
+	return out, nil
+}
+
+func (m *mockKinesis) PutRecordWithContext(_ aws.Context, in *kinesis.PutRecordInput,
+	_ ...request.Option) (*kinesis.PutRecordOutput, error) {
+
+	shard := aws.StringValue(in.PartitionKey)
+	seq := strconv.Itoa(len(m.records[shard]))
+	m.records[shard] = append(m.records[shard], &kinesis.Record{
+		SequenceNumber: aws.String(seq),
+		PartitionKey:   in.PartitionKey,
+		Data:           in.Data,
+	})
+	return &kinesis.PutRecordOutput{SequenceNumber: aws.String(seq)}, nil
+}
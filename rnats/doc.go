@@ -0,0 +1,7 @@
+// Package rnats provides a reflex stream of events from a NATS JetStream
+// stream and a publisher that writes reflex events to it.
+//
+// Cursors are stream sequence numbers. Events are published to the subject
+// hierarchy "<prefix>.<event type>" with the foreign ID and source event
+// ID in message headers, see the Header constants.
+package rnats
@@ -0,0 +1,224 @@
+package rnats
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Message headers of event fields.
+const (
+	HeaderForeignID = "Reflex-Foreign-Id"
+	HeaderTimestamp = "Reflex-Timestamp"
+)
+
+// NewStream returns a stream of the events published to the JetStream stream
+// under the subject prefix.
+func NewStream(js jetstream.JetStream, stream, prefix string) *Stream {
+	return &Stream{js: js, stream: stream, prefix: prefix}
+}
+
+// Stream defines a JetStream stream from which to stream messages as events.
+type Stream struct {
+	js     jetstream.JetStream
+	stream string
+	prefix string
+}
+
+// Stream implements reflex.StreamFunc and returns a StreamClient that
+// streams messages after the provided stream sequence cursor. It supports
+// the StreamFromHead, StreamFromTime and StreamToHead options.
+//
+// Note: The returned StreamClient implementation also exposes a Close
+// method which stops the underlying ordered consumer.
+func (s *Stream) Stream(ctx context.Context, after string,
+	opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+
+	var o reflex.StreamOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cfg := jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{s.prefix + ".>"},
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+	}
+
+	if o.StreamFromHead {
+		cfg.DeliverPolicy = jetstream.DeliverNewPolicy
+	} else if !o.StreamFromTime.IsZero() {
+		cfg.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+		cfg.OptStartTime = &o.StreamFromTime
+	} else if after != "" {
+		seq, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid cursor", j.KS("cursor", after))
+		}
+		cfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		cfg.OptStartSeq = seq + 1
+	}
+
+	cons, err := s.js.OrderedConsumer(ctx, s.stream, cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "create consumer error")
+	}
+
+	var head uint64
+	if o.StreamToHead {
+		js, err := s.js.Stream(ctx, s.stream)
+		if err != nil {
+			return nil, errors.Wrap(err, "get stream error")
+		}
+		info, err := js.Info(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "stream info error")
+		}
+		head = info.State.LastSeq
+
+		cinfo, err := cons.Info(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "consumer info error")
+		}
+		if cinfo.NumPending == 0 || o.StreamFromHead {
+			return &stream{done: true}, nil
+		}
+	}
+
+	msgs, err := cons.Messages()
+	if err != nil {
+		return nil, errors.Wrap(err, "messages error")
+	}
+
+	sc := &stream{
+		msgs:   msgs,
+		prefix: s.prefix,
+		toHead: o.StreamToHead,
+		head:   head,
+	}
+
+	// Stop the consumer when the context is canceled.
+	sc.stop = context.AfterFunc(ctx, msgs.Stop)
+	sc.ctx = ctx
+
+	return sc, nil
+}
+
+type stream struct {
+	ctx    context.Context
+	msgs   jetstream.MessagesContext
+	stop   func() bool
+	prefix string
+	toHead bool
+	head   uint64
+	done   bool
+}
+
+func (s *stream) Recv() (*reflex.Event, error) {
+	if s.done {
+		return nil, reflex.ErrHeadReached
+	}
+
+	m, err := s.msgs.Next()
+	if errors.Is(err, jetstream.ErrMsgIteratorClosed) && s.ctx.Err() != nil {
+		return nil, s.ctx.Err()
+	} else if err != nil {
+		return nil, errors.Wrap(err, "next message error")
+	}
+
+	meta, err := m.Metadata()
+	if err != nil {
+		return nil, errors.Wrap(err, "message metadata error")
+	}
+
+	typ, err := parseType(s.prefix, m.Subject())
+	if err != nil {
+		return nil, err
+	}
+
+	ts := meta.Timestamp
+	if v := m.Headers().Get(HeaderTimestamp); v != "" {
+		ts, err = time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid timestamp header")
+		}
+	}
+
+	// Done if no more messages or the head at the start of the stream is reached.
+	if s.toHead && (meta.NumPending == 0 || meta.Sequence.Stream >= s.head) {
+		s.done = true
+	}
+
+	return &reflex.Event{
+		ID:        strconv.FormatUint(meta.Sequence.Stream, 10),
+		Type:      typ,
+		ForeignID: m.Headers().Get(HeaderForeignID),
+		Timestamp: ts,
+		MetaData:  m.Data(),
+	}, nil
+}
+
+// Close stops the underlying consumer.
+func (s *stream) Close() error {
+	if s.msgs != nil {
+		s.stop()
+		s.msgs.Stop()
+	}
+	return nil
+}
+
+// parseType returns the event type from the last subject token.
+func parseType(prefix, subject string) (eventType, error) {
+	v := strings.TrimPrefix(subject, prefix+".")
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid event type subject", j.KS("subject", subject))
+	}
+	return eventType(i), nil
+}
+
+// NewPublisher returns a publisher of events to subjects under the prefix.
+func NewPublisher(js jetstream.JetStream, prefix string) *Publisher {
+	return &Publisher{js: js, prefix: prefix}
+}
+
+// Publisher publishes reflex events to a JetStream subject hierarchy.
+type Publisher struct {
+	js     jetstream.JetStream
+	prefix string
+}
+
+// Publish publishes the event to the subject "<prefix>.<event type>". The
+// event ID is used as message ID, deduplicating republished events
+// within the stream's duplicate window.
+func (p *Publisher) Publish(ctx context.Context, e *reflex.Event) error {
+	m := nats.NewMsg(p.prefix + "." + strconv.Itoa(e.Type.ReflexType()))
+	m.Data = e.MetaData
+	m.Header.Set(HeaderForeignID, e.ForeignID)
+	m.Header.Set(HeaderTimestamp, e.Timestamp.Format(time.RFC3339Nano))
+
+	_, err := p.js.PublishMsg(ctx, m, jetstream.WithMsgID(e.ID))
+	return errors.Wrap(err, "publish error", j.KS("event_id", e.ID))
+}
+
+// Consumer returns a reflex consumer that publishes events,
+// e.g. to forward the events of an events table.
+func (p *Publisher) Consumer(name string, opts ...reflex.ConsumerOption) reflex.Consumer {
+	return reflex.NewConsumer(name, func(ctx context.Context, _ fate.Fate, e *reflex.Event) error {
+		return p.Publish(ctx, e)
+	}, opts...)
+}
+
+// eventType is the rnats internal implementation of EventType interface.
+type eventType int
+
+func (t eventType) ReflexType() int {
+	return int(t)
+}
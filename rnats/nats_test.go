@@ -0,0 +1,95 @@
+package rnats_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rnats"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/require"
+)
+
+type testEventType int
+
+func (t testEventType) ReflexType() int {
+	return int(t)
+}
+
+func TestPublishAndStream(t *testing.T) {
+	ctx := context.Background()
+	js := setup(t)
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := rnats.NewPublisher(js, "events")
+	for i := 1; i <= 3; i++ {
+		e := &reflex.Event{
+			ID:        "src" + strconv.Itoa(i),
+			Type:      testEventType(i),
+			ForeignID: "f1",
+			Timestamp: t0,
+			MetaData:  []byte("meta"),
+		}
+		jtest.RequireNil(t, p.Publish(ctx, e))
+		// Duplicates are ignored.
+		jtest.RequireNil(t, p.Publish(ctx, e))
+	}
+
+	s := rnats.NewStream(js, "test", "events")
+
+	assertStream := func(t *testing.T, after string, expect []string) {
+		sc, err := s.Stream(ctx, after, reflex.WithStreamToHead())
+		jtest.RequireNil(t, err)
+
+		var ids []string
+		for {
+			e, err := sc.Recv()
+			if reflex.IsHeadReachedErr(err) {
+				break
+			}
+			jtest.RequireNil(t, err)
+			require.Equal(t, "f1", e.ForeignID)
+			require.True(t, t0.Equal(e.Timestamp))
+			require.Equal(t, []byte("meta"), e.MetaData)
+			require.Equal(t, e.IDInt(), int64(e.Type.ReflexType()))
+			ids = append(ids, e.ID)
+		}
+		require.Equal(t, expect, ids)
+	}
+
+	assertStream(t, "", []string{"1", "2", "3"})
+	assertStream(t, "1", []string{"2", "3"})
+	assertStream(t, "3", nil)
+}
+
+func setup(t *testing.T) jetstream.JetStream {
+	srv, err := server.NewServer(&server.Options{
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	jtest.RequireNil(t, err)
+	srv.Start()
+	t.Cleanup(srv.Shutdown)
+	require.True(t, srv.ReadyForConnections(5*time.Second))
+
+	nc, err := nats.Connect(srv.ClientURL())
+	jtest.RequireNil(t, err)
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	jtest.RequireNil(t, err)
+
+	_, err = js.CreateStream(context.Background(), jetstream.StreamConfig{
+		Name:     "test",
+		Subjects: []string{"events.>"},
+	})
+	jtest.RequireNil(t, err)
+
+	return js
+}
@@ -0,0 +1,3 @@
+// Package rotel provides an OpenTelemetry implementation of reflex consumer
+// metrics. It is a separate module so that reflex does not depend on OpenTelemetry.
+package rotel
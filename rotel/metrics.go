@@ -0,0 +1,122 @@
+package rotel
+
+import (
+	"context"
+	"time"
+
+	"github.com/luno/reflex"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	consumerKey  = "consumer_name"
+	eventTypeKey = "event_type"
+)
+
+// NewMetrics returns a function that creates OpenTelemetry consumer metrics
+// using the meter. It is intended to be used with reflex.WithConsumerMetrics.
+// Instruments are created once and shared by all consumers. Measurements
+// are also labeled by event type if reflex.WithTypeMetricLabels is provided.
+func NewMetrics(meter metric.Meter) (func(consumerName string,
+	types []reflex.EventType) reflex.Metrics, error) {
+	latency, err := meter.Float64Histogram("reflex.consumer.latency",
+		metric.WithDescription("Event loop latency"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	errs, err := meter.Int64Counter("reflex.consumer.errors",
+		metric.WithDescription("Number of errors processing events"))
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := meter.Int64Counter("reflex.consumer.events",
+		metric.WithDescription("Number of events consumed successfully"))
+	if err != nil {
+		return nil, err
+	}
+
+	lag, err := meter.Float64Gauge("reflex.consumer.lag",
+		metric.WithDescription("Lag between now and the current event timestamp"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	lagAlert, err := meter.Int64Gauge("reflex.consumer.lag_alert",
+		metric.WithDescription("Whether or not the consumer lag crosses its alert threshold"))
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := meter.Int64Counter("reflex.consumer.active",
+		metric.WithDescription("Number of times the consumer was active (consumed an event)"))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(consumerName string, types []reflex.EventType) reflex.Metrics {
+		return &consumerMetrics{
+			name:     consumerName,
+			types:    types,
+			attrs:    metric.WithAttributes(attribute.String(consumerKey, consumerName)),
+			latency:  latency,
+			errors:   errs,
+			events:   events,
+			lag:      lag,
+			lagAlert: lagAlert,
+			active:   active,
+		}
+	}, nil
+}
+
+type consumerMetrics struct {
+	name     string
+	types    []reflex.EventType
+	attrs    metric.MeasurementOption
+	latency  metric.Float64Histogram
+	errors   metric.Int64Counter
+	events   metric.Int64Counter
+	lag      metric.Float64Gauge
+	lagAlert metric.Int64Gauge
+	active   metric.Int64Counter
+}
+
+// eventAttrs returns the measurement attributes of the event which
+// include its type label if type labels are enabled.
+func (m *consumerMetrics) eventAttrs(e *reflex.Event) metric.MeasurementOption {
+	if len(m.types) == 0 {
+		return m.attrs
+	}
+
+	return metric.WithAttributes(attribute.String(consumerKey, m.name),
+		attribute.String(eventTypeKey, reflex.TypeMetricLabel(m.types, e)))
+}
+
+func (m *consumerMetrics) ConsumeObserved(e *reflex.Event, latency time.Duration) {
+	m.latency.Record(context.Background(), latency.Seconds(), m.eventAttrs(e))
+}
+
+func (m *consumerMetrics) ErrorInced(e *reflex.Event) {
+	m.errors.Add(context.Background(), 1, m.eventAttrs(e))
+}
+
+func (m *consumerMetrics) EventsInced(e *reflex.Event) {
+	m.events.Add(context.Background(), 1, m.eventAttrs(e))
+}
+
+func (m *consumerMetrics) LagSet(e *reflex.Event, lag time.Duration, alert bool) {
+	m.lag.Record(context.Background(), lag.Seconds(), m.eventAttrs(e))
+
+	var v int64
+	if alert {
+		v = 1
+	}
+	m.lagAlert.Record(context.Background(), v, m.attrs)
+}
+
+func (m *consumerMetrics) ActivitySet() {
+	m.active.Add(context.Background(), 1, m.attrs)
+}
@@ -0,0 +1,34 @@
+package rotel_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rotel"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestNewMetrics(t *testing.T) {
+	fn, err := rotel.NewMetrics(noop.NewMeterProvider().Meter("test"))
+	require.NoError(t, err)
+
+	errTest := errors.New("test error")
+	c := reflex.NewConsumer("test", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+		return errTest
+	}, reflex.WithConsumerMetrics(fn), reflex.WithTypeMetricLabels(testEventType(1)))
+
+	for i := 1; i <= 2; i++ {
+		err = c.Consume(context.Background(), fate.New(), &reflex.Event{ID: "1", Type: testEventType(i)})
+		require.Equal(t, errTest, err)
+	}
+}
+
+type testEventType int
+
+func (t testEventType) ReflexType() int {
+	return int(t)
+}
@@ -56,7 +56,7 @@ func NewAckConsumer(name string, cstore reflex.CursorStore,
 	opts ...reflex.ConsumerOption) *AckConsumer {
 	return &AckConsumer{
 		name:    name,
-		cstore:  cstore,
+		cstore:  newRunStore(cstore),
 		consume: consume,
 		opts:    opts,
 	}
@@ -86,3 +86,12 @@ func (s *noSetStore) SetCursor(ctx context.Context, consumerName string, cursor
 func (s *noSetStore) Flush(ctx context.Context) error {
 	return s.cstore.Flush(ctx)
 }
+
+// Fence implements reflex.CursorFencer by fencing the underlying store.
+func (s *noSetStore) Fence(ctx context.Context, consumerName string) (reflex.CursorStore, error) {
+	cs, err := fence(ctx, s.cstore, consumerName)
+	if err != nil {
+		return nil, err
+	}
+	return &noSetStore{cs}, nil
+}
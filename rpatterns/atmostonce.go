@@ -0,0 +1,50 @@
+package rpatterns
+
+import (
+	"context"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+)
+
+// NewAtMostOnceSpec returns a reflex spec that provides at-most-once event
+// delivery. The cursor is set and flushed before each event is consumed,
+// so an event is never consumed twice, but it may be dropped if the consumer
+// errors or the process crashes. This is useful for consumers where duplicates
+// are worse than drops, e.g. sending SMS.
+func NewAtMostOnceSpec(stream reflex.StreamFunc, cstore reflex.CursorStore,
+	consumer reflex.Consumer, opts ...reflex.StreamOption) reflex.Spec {
+
+	c := &atMostOnce{
+		Consumer: consumer,
+		cstore:   newRunStore(cstore),
+	}
+	return reflex.NewSpec(stream, &noSetStore{c.cstore}, c, opts...)
+}
+
+type atMostOnce struct {
+	reflex.Consumer
+	cstore reflex.CursorStore
+}
+
+// Consume sets and flushes the cursor before consuming the event.
+func (c *atMostOnce) Consume(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+	if err := c.cstore.SetCursor(ctx, c.Name(), e.ID); err != nil {
+		return errors.Wrap(err, "set cursor error")
+	}
+
+	if err := c.cstore.Flush(ctx); err != nil {
+		return errors.Wrap(err, "flush cursor error")
+	}
+
+	return c.Consumer.Consume(ctx, f, e)
+}
+
+// Reset resets the underlying consumer if it is stateful.
+func (c *atMostOnce) Reset() error {
+	if r, ok := c.Consumer.(interface{ Reset() error }); ok {
+		return r.Reset()
+	}
+	return nil
+}
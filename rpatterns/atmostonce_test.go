@@ -0,0 +1,68 @@
+package rpatterns_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtMostOnce(t *testing.T) {
+	errConsume := errors.New("consume error")
+
+	cases := []struct {
+		name     string
+		inEvents []int
+		failOn   string
+		sets     []string
+		consumed []string
+		err      string
+	}{
+		{
+			name:     "all events",
+			inEvents: []int{1, 2, 3},
+			sets:     []string{"1", "2", "3"},
+			consumed: []string{"1", "2", "3"},
+			err:      "recv error: no more events",
+		}, {
+			name:     "consume error drops event",
+			inEvents: []int{1, 2, 3},
+			failOn:   "2",
+			sets:     []string{"1", "2"},
+			consumed: []string{"1", "2"},
+			err:      "consume error: consume error",
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			b := new(bootstrapMock)
+			b.gets = []string{""}
+			b.events = ItoEList(test.inEvents...)
+
+			var consumed []string
+			consumer := reflex.NewConsumer("test",
+				func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+					// Cursor must already be set.
+					assert.Equal(t, e.ID, b.sets[len(b.sets)-1])
+					consumed = append(consumed, e.ID)
+					if e.ID == test.failOn {
+						return errConsume
+					}
+					return nil
+				})
+
+			spec := rpatterns.NewAtMostOnceSpec(b.Stream, b, consumer)
+			err := reflex.Run(context.Background(), spec)
+			assert.EqualError(t, err, test.err)
+
+			assert.EqualValues(t, test.sets, b.sets)
+			assert.EqualValues(t, test.consumed, consumed)
+			assert.Equal(t, len(test.sets)+1, b.flushes)
+		})
+	}
+}
@@ -2,6 +2,8 @@ package rpatterns
 
 import (
 	"context"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/luno/reflex"
@@ -50,18 +52,7 @@ func Await(in context.Context, stream reflex.StreamFunc, pollFn func() (bool, er
 
 	// Poll external state periodically
 	poller := func() error {
-		for {
-			if ctx.Err() != nil {
-				return ctx.Err()
-			}
-			found, err := pollFn()
-			if err != nil {
-				return err
-			} else if found {
-				return nil
-			}
-			time.Sleep(time.Second)
-		}
+		return pollUntil(ctx, pollFn)
 	}
 
 	// Wait for either poller or listener
@@ -78,6 +69,161 @@ func Await(in context.Context, stream reflex.StreamFunc, pollFn func() (bool, er
 	return err
 }
 
+// pollUntil blocks until pollFn returns true or an error or until
+// the context is canceled. It calls pollFn every second.
+func pollUntil(ctx context.Context, pollFn func() (bool, error)) error {
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		found, err := pollFn()
+		if err != nil {
+			return err
+		} else if found {
+			return nil
+		}
+
+		t := time.NewTimer(time.Second)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// NewAwaitRegistry returns a new AwaitRegistry for the event stream.
+func NewAwaitRegistry(stream reflex.StreamFunc) *AwaitRegistry {
+	return &AwaitRegistry{
+		stream:  stream,
+		waiters: make(map[awaitKey]map[chan struct{}]bool),
+	}
+}
+
+// AwaitRegistry multiplexes a single event stream across many concurrent
+// waiters keyed by event type and foreign ID. Unlike Await, which streams
+// from head per call, the registry only requires one stream which should be
+// run via Run.
+type AwaitRegistry struct {
+	stream reflex.StreamFunc
+
+	mu      sync.Mutex
+	waiters map[awaitKey]map[chan struct{}]bool
+}
+
+type awaitKey struct {
+	typ       int
+	foreignID string
+}
+
+// Run streams new events from head and notifies any matching waiters.
+// It blocks until the stream errors or the context is canceled. It always
+// returns a non-nil error. The stream client is closed on exit
+// if it implements io.Closer.
+func (r *AwaitRegistry) Run(ctx context.Context) error {
+	sc, err := r.stream(ctx, "", reflex.WithStreamFromHead())
+	if err != nil {
+		return err
+	}
+
+	if closer, ok := sc.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		e, err := sc.Recv()
+		if err != nil {
+			return err
+		}
+		r.notify(awaitKey{typ: e.Type.ReflexType(), foreignID: e.ForeignID})
+	}
+}
+
+// Await returns nil when a new event with foreignID and one of the eventTypes is
+// received by the registry. It also returns nil if the optional pollFn
+// returns true when it is periodically called. It returns context.DeadlineExceeded
+// if a non-zero timeout elapses. Cancel the input context to return early.
+func (r *AwaitRegistry) Await(in context.Context, timeout time.Duration,
+	pollFn func() (bool, error), foreignID string, eventTypes ...reflex.EventType) error {
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(in, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(in)
+	}
+	defer cancel()
+
+	var keys []awaitKey
+	for _, et := range eventTypes {
+		keys = append(keys, awaitKey{typ: et.ReflexType(), foreignID: foreignID})
+	}
+
+	ch := r.register(keys)
+	defer r.unregister(keys, ch)
+
+	var pollCh <-chan error
+	if pollFn != nil {
+		pollCh = goChan(func() error {
+			return pollUntil(ctx, pollFn)
+		})
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case err := <-pollCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *AwaitRegistry) register(keys []awaitKey) chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	for _, key := range keys {
+		if r.waiters[key] == nil {
+			r.waiters[key] = make(map[chan struct{}]bool)
+		}
+		r.waiters[key][ch] = true
+	}
+	return ch
+}
+
+func (r *AwaitRegistry) unregister(keys []awaitKey, ch chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range keys {
+		delete(r.waiters[key], ch)
+		if len(r.waiters[key]) == 0 {
+			delete(r.waiters, key)
+		}
+	}
+}
+
+func (r *AwaitRegistry) notify(key awaitKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ch := range r.waiters[key] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
 func goChan(f func() error) <-chan error {
 	ch := make(chan error, 1)
 	go func() {
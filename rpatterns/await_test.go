@@ -152,3 +152,85 @@ func (s *streamer) Stream(ctx context.Context, after string,
 func (s *streamer) Stop() {
 	panic("implement me")
 }
+
+func TestAwaitRegistry(t *testing.T) {
+	s := &chanStreamer{ch: make(chan *reflex.Event)}
+	r := rpatterns.NewAwaitRegistry(s.Stream)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- r.Run(ctx)
+	}()
+
+	const n = 10
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			errs <- r.Await(ctx, time.Minute, nil, strconv.Itoa(i%2),
+				testEventType(1), testEventType(2))
+		}()
+	}
+
+	// Timeout waiter
+	err := r.Await(ctx, time.Millisecond, nil, "0", testEventType(3))
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// Poll waiter
+	err = r.Await(ctx, time.Minute, func() (bool, error) {
+		return true, nil
+	}, "0", testEventType(3))
+	assert.NoError(t, err)
+
+	// Unrelated events don't trigger waiters.
+	s.ch <- &reflex.Event{ID: "1", ForeignID: "0", Type: testEventType(3)}
+	s.ch <- &reflex.Event{ID: "2", ForeignID: "2", Type: testEventType(1)}
+	assert.Len(t, errs, 0)
+
+	// Wait for all waiters to register before sending matching events.
+	time.Sleep(time.Millisecond * 100)
+	s.ch <- &reflex.Event{ID: "3", ForeignID: "0", Type: testEventType(1)}
+	s.ch <- &reflex.Event{ID: "4", ForeignID: "1", Type: testEventType(2)}
+
+	for i := 0; i < n; i++ {
+		assert.NoError(t, <-errs)
+	}
+
+	// Cancelled waiter
+	cancel()
+	err = r.Await(ctx, 0, nil, "0", testEventType(1))
+	assert.Equal(t, context.Canceled, err)
+
+	// Run closes the stream client on exit.
+	assert.Equal(t, context.Canceled, <-runErr)
+	assert.True(t, s.closed)
+}
+
+type chanStreamer struct {
+	ch     chan *reflex.Event
+	ctx    context.Context
+	closed bool
+}
+
+func (s *chanStreamer) Recv() (*reflex.Event, error) {
+	select {
+	case e := <-s.ch:
+		return e, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func (s *chanStreamer) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *chanStreamer) Stream(ctx context.Context, after string,
+	options ...reflex.StreamOption) (reflex.StreamClient, error) {
+	s.ctx = ctx
+	return s, nil
+}
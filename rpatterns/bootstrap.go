@@ -15,7 +15,13 @@ type bootstrapper struct {
 }
 
 func (b *bootstrapper) GetCursor(ctx context.Context, consumerName string) (string, error) {
-	cursor, err := b.cstore.GetCursor(ctx, consumerName)
+	return b.getCursor(ctx, b.cstore, consumerName)
+}
+
+func (b *bootstrapper) getCursor(ctx context.Context, cstore reflex.CursorStore,
+	consumerName string) (string, error) {
+
+	cursor, err := cstore.GetCursor(ctx, consumerName)
 	if err != nil {
 		return "", err
 	}
@@ -23,6 +29,25 @@ func (b *bootstrapper) GetCursor(ctx context.Context, consumerName string) (stri
 	return cursor, nil
 }
 
+// Fence implements reflex.CursorFencer by fencing the underlying store.
+func (b *bootstrapper) Fence(ctx context.Context, consumerName string) (reflex.CursorStore, error) {
+	cs, err := fence(ctx, b.cstore, consumerName)
+	if err != nil {
+		return nil, err
+	}
+	return &bootstrapStore{CursorStore: cs, b: b}, nil
+}
+
+// bootstrapStore is the fenced cursor store of a bootstrapper.
+type bootstrapStore struct {
+	reflex.CursorStore
+	b *bootstrapper
+}
+
+func (s *bootstrapStore) GetCursor(ctx context.Context, consumerName string) (string, error) {
+	return s.b.getCursor(ctx, s.CursorStore, consumerName)
+}
+
 func (b *bootstrapper) SetCursor(ctx context.Context, consumerName string, cursor string) error {
 	return b.cstore.SetCursor(ctx, consumerName, cursor)
 }
@@ -0,0 +1,242 @@
+package rpatterns
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+// CronInsertFunc inserts an event with the foreign id and type, for
+// example via rsql.EventsTable.Insert in a new transaction.
+type CronInsertFunc func(ctx context.Context, foreignID string, typ reflex.EventType) error
+
+// NewCronEmitter returns a new cron emitter that inserts events of the type on
+// the schedule. The schedule is either a standard five field cron expression
+// "minute hour day-of-month month day-of-week" (supporting *, lists, ranges
+// and steps) evaluated in UTC, or "@every <duration>", e.g. "@every 5m".
+func NewCronEmitter(name, schedule string, typ reflex.EventType,
+	insert CronInsertFunc) (*CronEmitter, error) {
+
+	s, err := parseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CronEmitter{
+		name:     name,
+		schedule: s,
+		typ:      typ,
+		insert:   insert,
+		now:      time.Now,
+	}, nil
+}
+
+// CronEmitter inserts events into an events table on a cron schedule, so
+// downstream consumers can implement periodic work. The foreign id of each
+// event is the unix timestamp (in milliseconds) of the scheduled time, use it
+// as dedup key (see rsql.WithEventsDedupField) to ensure at most one event
+// per scheduled time. Scheduled times passed while not running are skipped.
+type CronEmitter struct {
+	name     string
+	schedule schedule
+	typ      reflex.EventType
+	insert   CronInsertFunc
+	now      func() time.Time
+}
+
+// Name returns the name of the cron emitter.
+func (e *CronEmitter) Name() string {
+	return e.name
+}
+
+// Run blocks, inserting events on the schedule. It returns when the context
+// is canceled or if an insert fails. Use RunCronLeader or RunCronLeaderLease
+// to ensure only one replica of a deployment inserts the events.
+func (e *CronEmitter) Run(ctx context.Context) error {
+	for {
+		next := e.schedule.next(e.now())
+		if next.IsZero() {
+			return errors.New("cron schedule has no next time", j.KS("name", e.name))
+		}
+
+		t := time.NewTimer(next.Sub(e.now()))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		foreignID := strconv.FormatInt(next.UnixNano()/int64(time.Millisecond), 10)
+		if err := e.insert(ctx, foreignID, e.typ); err != nil {
+			return errors.Wrap(err, "cron insert error", j.KS("name", e.name))
+		}
+	}
+}
+
+// RunCronLeader blocks, running the cron emitter only while this instance holds
+// the MySQL advisory lock named after the emitter, see RunLeader.
+func RunCronLeader(ctx context.Context, dbc *sql.DB, e *CronEmitter,
+	opts ...LeaderOption) error {
+
+	conf := newLeaderConfig(opts)
+	return runLeader(ctx, &mysqlLock{dbc: dbc, name: e.name}, e.name, e.Run, conf)
+}
+
+// RunCronLeaderLease works as RunCronLeader except that leadership is
+// coordinated via a lease of the emitter name in the lease store.
+func RunCronLeaderLease(ctx context.Context, leases reflex.LeaseStore, e *CronEmitter,
+	opts ...LeaderOption) error {
+
+	conf := newLeaderConfig(opts)
+	lock := &leaseLock{
+		leases: leases,
+		key:    e.name,
+		owner:  conf.owner,
+		ttl:    conf.period * 3,
+	}
+	return runLeader(ctx, lock, e.name, e.Run, conf)
+}
+
+// schedule returns the next scheduled time after t or zero if none.
+type schedule interface {
+	next(t time.Time) time.Time
+}
+
+func parseSchedule(spec string) (schedule, error) {
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimPrefix(spec, "@every "))
+		if err != nil || d <= 0 {
+			return nil, errors.New("invalid cron duration", j.KS("schedule", spec))
+		}
+		return every(d), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New("invalid cron expression, expected five fields",
+			j.KS("schedule", spec))
+	}
+
+	var (
+		c      cronSchedule
+		ranges = [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+		sets   = []*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	)
+	for i, f := range fields {
+		set, err := parseCronField(f, ranges[i][0], ranges[i][1])
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KS("schedule", spec))
+		}
+		*sets[i] = set
+	}
+	c.domStar = fields[2] == "*"
+	c.dowStar = fields[4] == "*"
+
+	return c, nil
+}
+
+// parseCronField returns the bitset of the comma separated list of values,
+// ranges ("a-b") and steps ("*/n" or "a-b/n") of the cron field.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, errors.New("invalid cron step", j.KS("field", field))
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, errors.New("invalid cron value", j.KS("field", field))
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, errors.New("invalid cron range", j.KS("field", field))
+				}
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, errors.New("cron value out of range", j.KS("field", field))
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// every is a schedule of fixed intervals since the unix epoch.
+type every time.Duration
+
+func (d every) next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(d)).Add(time.Duration(d))
+}
+
+// cronSchedule is a cron expression schedule in UTC.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+func (c cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+
+	// Give up after five years, e.g. for "0 0 31 2 *".
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if !has(c.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !has(c.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !has(c.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// matchDay returns true if the day matches the day-of-month and day-of-week
+// fields. As per cron, either needs to match if both are restricted.
+func (c cronSchedule) matchDay(t time.Time) bool {
+	dom := has(c.dom, t.Day())
+	dow := has(c.dow, int(t.Weekday()))
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
@@ -0,0 +1,146 @@
+package rpatterns
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronSchedule(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 10, 30, 15, 0, time.UTC) // Wednesday
+
+	tests := []struct {
+		schedule string
+		next     []time.Time
+	}{
+		{
+			schedule: "* * * * *",
+			next: []time.Time{
+				time.Date(2020, 1, 1, 10, 31, 0, 0, time.UTC),
+				time.Date(2020, 1, 1, 10, 32, 0, 0, time.UTC),
+			},
+		}, {
+			schedule: "*/20 * * * *",
+			next: []time.Time{
+				time.Date(2020, 1, 1, 10, 40, 0, 0, time.UTC),
+				time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC),
+			},
+		}, {
+			schedule: "0 9-10,22 * * *",
+			next: []time.Time{
+				time.Date(2020, 1, 1, 22, 0, 0, 0, time.UTC),
+				time.Date(2020, 1, 2, 9, 0, 0, 0, time.UTC),
+				time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC),
+			},
+		}, {
+			schedule: "0 0 * * 1",
+			next: []time.Time{
+				time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, 1, 13, 0, 0, 0, 0, time.UTC),
+			},
+		}, {
+			schedule: "0 0 29 2 *",
+			next: []time.Time{
+				time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+			},
+		}, {
+			schedule: "0 0 15 * 1", // Either 15th or Monday.
+			next: []time.Time{
+				time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, 1, 13, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+			},
+		}, {
+			schedule: "@every 1h",
+			next: []time.Time{
+				time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC),
+				time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.schedule, func(t *testing.T) {
+			s, err := parseSchedule(test.schedule)
+			jtest.RequireNil(t, err)
+
+			next := t0
+			for _, exp := range test.next {
+				next = s.next(next)
+				require.Equal(t, exp, next)
+			}
+		})
+	}
+
+	s, err := parseSchedule("0 0 31 2 *")
+	jtest.RequireNil(t, err)
+	require.True(t, s.next(t0).IsZero())
+
+	for _, invalid := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *",
+		"5-1 * * * *", "a * * * *", "@every -1m"} {
+		_, err := parseSchedule(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestRunCronLeaderLease(t *testing.T) {
+	table := rtest.NewEventsTable()
+	leases := rtest.NewLeaseStore()
+
+	var (
+		mu  sync.Mutex
+		ids = make(map[string]bool)
+	)
+	e, err := NewCronEmitter("cron_test", "@every 10ms", testEventType(1),
+		func(ctx context.Context, foreignID string, typ reflex.EventType) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ids[foreignID] = true
+			table.Insert(foreignID, typ)
+			return nil
+		})
+	jtest.RequireNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error, 2)
+	for _, owner := range []string{"a", "b"} {
+		owner := owner
+		go func() {
+			errCh <- RunCronLeaderLease(ctx, leases, e, WithLeaderOwner(owner),
+				WithLeaderPeriod(time.Millisecond*5))
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return len(table.Events()) >= 5
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.Equal(t, context.Canceled, <-errCh)
+	require.Equal(t, context.Canceled, <-errCh)
+
+	// Only the leader inserts events, so foreign ids are unique.
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, ids, len(table.Events()))
+	for id := range ids {
+		_, err := strconv.ParseInt(id, 10, 64)
+		jtest.RequireNil(t, err)
+	}
+}
+
+type testEventType int
+
+func (t testEventType) ReflexType() int {
+	return int(t)
+}
@@ -2,8 +2,15 @@ package rpatterns
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
+	"sync"
 
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 	"github.com/luno/reflex"
 )
 
@@ -42,6 +49,17 @@ func (c *readThroughCursorStore) GetCursor(ctx context.Context, consumerName str
 	return c.fallback.GetCursor(ctx, consumerName)
 }
 
+// Fence implements reflex.CursorFencer by fencing the primary.
+func (c *readThroughCursorStore) Fence(ctx context.Context, consumerName string,
+) (reflex.CursorStore, error) {
+
+	cs, err := fence(ctx, c.CursorStore, consumerName)
+	if err != nil {
+		return nil, err
+	}
+	return &readThroughCursorStore{CursorStore: cs, fallback: c.fallback}, nil
+}
+
 // MemCursorStore returns an in-memory cursor store. Note that it obviously
 // does not provide any persistence guarantees.
 //
@@ -91,3 +109,118 @@ func WithMemCursorInt(name string, cursor int64) memOpt {
 		_ = m.SetCursor(nil, name, strconv.FormatInt(cursor, 10))
 	}
 }
+
+// NewFileCursorStore returns a cursor store that persists cursors as a JSON
+// object of consumer names to cursors in the file at path. Writes are atomic
+// since the file is replaced by renaming a temporary file. The file is
+// created on the first write if it doesn't exist.
+//
+// Use cases:
+//  - One-off tools and local development without a database.
+//
+// Note that the file should not be shared by multiple processes.
+func NewFileCursorStore(path string) reflex.CursorStore {
+	return &fileCursorStore{path: path}
+}
+
+type fileCursorStore struct {
+	path string
+
+	mu      sync.Mutex
+	cursors map[string]string // Nil if not loaded.
+}
+
+// load reads the cursors from the file if not loaded yet. It must be
+// called with the mutex held.
+func (f *fileCursorStore) load() error {
+	if f.cursors != nil {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		f.cursors = make(map[string]string)
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "read cursor file error", j.KS("path", f.path))
+	}
+
+	cursors := make(map[string]string)
+	if err := json.Unmarshal(b, &cursors); err != nil {
+		return errors.Wrap(err, "invalid cursor file", j.KS("path", f.path))
+	}
+	f.cursors = cursors
+	return nil
+}
+
+func (f *fileCursorStore) GetCursor(_ context.Context, consumerName string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return "", err
+	}
+	return f.cursors[consumerName], nil
+}
+
+func (f *fileCursorStore) SetCursor(_ context.Context, consumerName string, cursor string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	prev, ok := f.cursors[consumerName]
+	f.cursors[consumerName] = cursor
+	if err := f.write(); err != nil {
+		// Revert the cursor since it wasn't persisted.
+		if ok {
+			f.cursors[consumerName] = prev
+		} else {
+			delete(f.cursors, consumerName)
+		}
+		return err
+	}
+	return nil
+}
+
+// ResetCursor is equivalent to SetCursor since cursors are not
+// required to increase, see reflex.Replay.
+func (f *fileCursorStore) ResetCursor(ctx context.Context, consumerName string, cursor string) error {
+	return f.SetCursor(ctx, consumerName, cursor)
+}
+
+func (f *fileCursorStore) Flush(_ context.Context) error { return nil }
+
+// write atomically replaces the file with the cursors. It must be
+// called with the mutex held.
+func (f *fileCursorStore) write() error {
+	b, err := json.MarshalIndent(f.cursors, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "create temp cursor file error", j.KS("path", f.path))
+	}
+	defer os.Remove(tmp.Name()) // Noop after rename.
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "write cursor file error", j.KS("path", f.path))
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "sync cursor file error", j.KS("path", f.path))
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "close cursor file error", j.KS("path", f.path))
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return errors.Wrap(err, "rename cursor file error", j.KS("path", f.path))
+	}
+	return nil
+}
@@ -3,7 +3,10 @@ package rpatterns_test
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/luno/jettison/jtest"
@@ -158,3 +161,38 @@ func TestMemoryCStore(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, c2, actual)
 }
+
+func TestFileCursorStore(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "reflex")
+	jtest.RequireNil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cursors.json")
+
+	cs := rpatterns.NewFileCursorStore(path)
+	cursor, err := cs.GetCursor(ctx, "a")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "", cursor)
+
+	jtest.RequireNil(t, cs.SetCursor(ctx, "a", "1"))
+	jtest.RequireNil(t, cs.SetCursor(ctx, "b", "2"))
+	jtest.RequireNil(t, cs.SetCursor(ctx, "a", "3"))
+	jtest.RequireNil(t, cs.Flush(ctx))
+
+	// Load from file.
+	cs = rpatterns.NewFileCursorStore(path)
+	for name, expect := range map[string]string{"a": "3", "b": "2"} {
+		cursor, err := cs.GetCursor(ctx, name)
+		jtest.RequireNil(t, err)
+		require.Equal(t, expect, cursor)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	jtest.RequireNil(t, err)
+	require.JSONEq(t, `{"a":"3","b":"2"}`, string(b))
+
+	// Invalid file.
+	jtest.RequireNil(t, ioutil.WriteFile(path, []byte("invalid"), 0644))
+	_, err = rpatterns.NewFileCursorStore(path).GetCursor(ctx, "a")
+	require.Error(t, err)
+}
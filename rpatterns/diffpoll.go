@@ -0,0 +1,202 @@
+package rpatterns
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+	"github.com/luno/reflex"
+)
+
+const (
+	defaultDiffPeriod     = time.Minute
+	defaultDiffBackoff    = time.Second
+	defaultDiffMaxBackoff = time.Minute
+)
+
+// SnapshotFunc returns the current state of an external API or table as a map
+// of foreign ids to versions. A version is any value that changes when the
+// resource changes, e.g. an updated at timestamp or a hash of the resource.
+type SnapshotFunc func(ctx context.Context) (map[string]string, error)
+
+// DiffInsertFunc inserts a synthetic change event with the foreign id and type,
+// for example via rsql.EventsTable.Insert in a new transaction.
+type DiffInsertFunc func(ctx context.Context, foreignID string, typ reflex.EventType) error
+
+// DiffTypes define the event types inserted for changes of resources.
+type DiffTypes struct {
+	Created reflex.EventType
+	Updated reflex.EventType
+	Deleted reflex.EventType
+}
+
+// NewDiffPoller returns a new diff poller that periodically calls the snapshot
+// function, diffs it against the previous snapshot and inserts events for
+// changed resources. The previous snapshot is stored as the state of the
+// name in the state store, e.g. rsql.StatesTable.ToStore.
+func NewDiffPoller(name string, snapshot SnapshotFunc, insert DiffInsertFunc,
+	states reflex.StateStore, types DiffTypes, opts ...DiffPollerOption) *DiffPoller {
+
+	p := &DiffPoller{
+		name:       name,
+		snapshot:   snapshot,
+		insert:     insert,
+		states:     states,
+		types:      types,
+		period:     defaultDiffPeriod,
+		backoff:    defaultDiffBackoff,
+		maxBackoff: defaultDiffMaxBackoff,
+		sleep:      time.After,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// DiffPoller is a change data ingestion helper that converts a polling API
+// without change events into events in an events table. Events are inserted
+// before the snapshot is stored, so changes are inserted at-least-once.
+// Concurrent pollers of the same name fail with reflex.ErrStateConflict.
+//
+// The first snapshot is stored without inserting events unless the
+// WithDiffInitialCreates option is provided.
+type DiffPoller struct {
+	name       string
+	snapshot   SnapshotFunc
+	insert     DiffInsertFunc
+	states     reflex.StateStore
+	types      DiffTypes
+	period     time.Duration
+	backoff    time.Duration
+	maxBackoff time.Duration
+	creates    bool
+	sleep      func(d time.Duration) <-chan time.Time
+}
+
+// DiffPollerOption defines a functional option to configure diff pollers.
+type DiffPollerOption func(*DiffPoller)
+
+// WithDiffPeriod returns an option to configure the period between
+// polls. It defaults to 1 minute.
+func WithDiffPeriod(d time.Duration) DiffPollerOption {
+	return func(p *DiffPoller) {
+		p.period = d
+	}
+}
+
+// WithDiffBackoff returns an option to configure the backoff after failed
+// polls, which doubles after each consecutive failure from min up to max.
+// It defaults to 1s and 1 minute.
+func WithDiffBackoff(min, max time.Duration) DiffPollerOption {
+	return func(p *DiffPoller) {
+		p.backoff = min
+		p.maxBackoff = max
+	}
+}
+
+// WithDiffInitialCreates returns an option to insert created events
+// for all resources of the first snapshot.
+func WithDiffInitialCreates() DiffPollerOption {
+	return func(p *DiffPoller) {
+		p.creates = true
+	}
+}
+
+// Run blocks, polling the snapshot function on the period until the context
+// is canceled. Failed polls are logged and retried with backoff,
+// see WithDiffBackoff.
+func (p *DiffPoller) Run(ctx context.Context) error {
+	backoff := p.backoff
+	for {
+		wait := p.period
+		if err := p.PollOnce(ctx); ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			log.Error(ctx, errors.Wrap(err, "diff poll error", j.KS("name", p.name)))
+			wait = backoff
+			backoff *= 2
+			if backoff > p.maxBackoff {
+				backoff = p.maxBackoff
+			}
+		} else {
+			backoff = p.backoff
+		}
+
+		select {
+		case <-p.sleep(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// PollOnce calls the snapshot function once, inserts events for changes since
+// the previous snapshot and stores the new snapshot.
+func (p *DiffPoller) PollOnce(ctx context.Context) error {
+	state, version, err := p.states.Load(ctx, p.name)
+	if err != nil {
+		return err
+	}
+
+	prev := make(map[string]string)
+	if state != nil {
+		if err := json.Unmarshal(state, &prev); err != nil {
+			return errors.Wrap(err, "invalid diff poller state", j.KS("name", p.name))
+		}
+	}
+
+	next, err := p.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	if state != nil || p.creates {
+		for _, c := range diff(prev, next, p.types) {
+			if err := p.insert(ctx, c.foreignID, c.typ); err != nil {
+				return errors.Wrap(err, "diff insert error", j.KS("name", p.name))
+			}
+		}
+	}
+
+	b, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+
+	return p.states.Store(ctx, p.name, b, version)
+}
+
+type change struct {
+	foreignID string
+	typ       reflex.EventType
+}
+
+// diff returns the changes from prev to next ordered by foreign id.
+func diff(prev, next map[string]string, types DiffTypes) []change {
+	var res []change
+	for id, version := range next {
+		if pv, ok := prev[id]; !ok {
+			res = append(res, change{foreignID: id, typ: types.Created})
+		} else if pv != version {
+			res = append(res, change{foreignID: id, typ: types.Updated})
+		}
+	}
+	for id := range prev {
+		if _, ok := next[id]; !ok {
+			res = append(res, change{foreignID: id, typ: types.Deleted})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].foreignID < res[j].foreignID
+	})
+
+	return res
+}
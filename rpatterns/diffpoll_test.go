@@ -0,0 +1,116 @@
+package rpatterns_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffPoller(t *testing.T) {
+	table := rtest.NewEventsTable()
+	states := rtest.NewStateStore()
+	ctx := context.Background()
+
+	var state map[string]string
+	snapshot := func(ctx context.Context) (map[string]string, error) {
+		return state, nil
+	}
+	insert := func(ctx context.Context, foreignID string, typ reflex.EventType) error {
+		table.Insert(foreignID, typ)
+		return nil
+	}
+	types := rpatterns.DiffTypes{
+		Created: testEventType(1),
+		Updated: testEventType(2),
+		Deleted: testEventType(3),
+	}
+
+	p := rpatterns.NewDiffPoller("diff_test", snapshot, insert, states, types)
+
+	// Initial snapshot doesn't insert events.
+	state = map[string]string{"a": "1", "b": "1"}
+	jtest.RequireNil(t, p.PollOnce(ctx))
+	require.Empty(t, table.Events())
+
+	state = map[string]string{"a": "2", "b": "1", "c": "1"}
+	jtest.RequireNil(t, p.PollOnce(ctx))
+
+	state = map[string]string{"c": "1"}
+	jtest.RequireNil(t, p.PollOnce(ctx))
+
+	// Snapshots aren't ordered, unlike cursors.
+	state = map[string]string{"a": "1"}
+	jtest.RequireNil(t, p.PollOnce(ctx))
+
+	rtest.RequireEvents(t, table,
+		rtest.Expected{ForeignID: "a", Type: testEventType(2)},
+		rtest.Expected{ForeignID: "c", Type: testEventType(1)},
+		rtest.Expected{ForeignID: "a", Type: testEventType(3)},
+		rtest.Expected{ForeignID: "b", Type: testEventType(3)},
+		rtest.Expected{ForeignID: "a", Type: testEventType(1)},
+		rtest.Expected{ForeignID: "c", Type: testEventType(3)},
+	)
+
+	b, version, err := states.Load(ctx, "diff_test")
+	jtest.RequireNil(t, err)
+	require.Equal(t, `{"a":"1"}`, string(b))
+	require.Equal(t, int64(4), version)
+
+	// Concurrent polls conflict.
+	state = map[string]string{"a": "2"}
+	p2 := rpatterns.NewDiffPoller("diff_test", snapshot, func(ctx context.Context,
+		foreignID string, typ reflex.EventType) error {
+		return states.Store(ctx, "diff_test", []byte(`{"a":"2"}`), version)
+	}, states, types)
+	jtest.Require(t, reflex.ErrStateConflict, p2.PollOnce(ctx))
+
+	// Initial creates.
+	table = rtest.NewEventsTable()
+	p = rpatterns.NewDiffPoller("diff_test_creates", snapshot, insert, states, types,
+		rpatterns.WithDiffInitialCreates())
+	jtest.RequireNil(t, p.PollOnce(ctx))
+	rtest.RequireEvents(t, table, rtest.Expected{ForeignID: "a", Type: testEventType(1)})
+}
+
+func TestDiffPollerRunRetries(t *testing.T) {
+	table := rtest.NewEventsTable()
+	states := rtest.NewStateStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errSnapshot := errors.New("snapshot error")
+	var calls int
+	snapshot := func(ctx context.Context) (map[string]string, error) {
+		calls++
+		switch calls {
+		case 1, 2:
+			return nil, errSnapshot
+		case 3:
+			return map[string]string{"a": "1"}, nil
+		}
+		cancel()
+		return nil, errSnapshot
+	}
+	insert := func(ctx context.Context, foreignID string, typ reflex.EventType) error {
+		table.Insert(foreignID, typ)
+		return nil
+	}
+
+	p := rpatterns.NewDiffPoller("diff_test_retries", snapshot, insert, states,
+		rpatterns.DiffTypes{Created: testEventType(1)},
+		rpatterns.WithDiffInitialCreates(),
+		rpatterns.WithDiffPeriod(time.Millisecond),
+		rpatterns.WithDiffBackoff(time.Millisecond, 2*time.Millisecond))
+
+	// Failed polls are retried until canceled.
+	jtest.Require(t, context.Canceled, p.Run(ctx))
+	require.Equal(t, 4, calls)
+	rtest.RequireEvents(t, table, rtest.Expected{ForeignID: "a", Type: testEventType(1)})
+}
@@ -0,0 +1,167 @@
+package rpatterns
+
+import (
+	"context"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+)
+
+const defaultFairQuota = 1
+
+// FairOption defines a functional option to configure RunFair.
+type FairOption func(*fairOptions)
+
+type fairOptions struct {
+	quota      int
+	streamOpts []reflex.StreamOption
+}
+
+// WithFairQuota provides an option to set the maximum number of pending
+// events of a tenant consumed before moving on to the next tenant with
+// pending events. It defaults to 1.
+func WithFairQuota(n int) FairOption {
+	return func(o *fairOptions) {
+		o.quota = n
+	}
+}
+
+// WithFairStreamOpts provides an option to set the stream options
+// of all tenants' streams.
+func WithFairStreamOpts(opts ...reflex.StreamOption) FairOption {
+	return func(o *fairOptions) {
+		o.streamOpts = opts
+	}
+}
+
+// RunFair consumes the events of the tenants with a single consumer,
+// round-robining between tenants with pending events, so a noisy tenant's
+// backlog cannot starve the others. Each tenant is streamed with
+// reflex.WithTenant and has its own cursor named "<consumer>_<tenant>".
+// At most quota events of a tenant are consumed per turn, see WithFairQuota.
+//
+// RunFair blocks until any stream or the consumer errors, or until the
+// context is canceled. It always returns a non-nil error.
+func RunFair(ctx context.Context, stream reflex.StreamFunc, cstore reflex.CursorStore,
+	consumer reflex.Consumer, tenants []string, opts ...FairOption) error {
+
+	if len(tenants) == 0 {
+		return errors.New("no tenants")
+	}
+
+	o := fairOptions{quota: defaultFairQuota}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer cstore.Flush(context.Background()) // best effort flush with new context
+
+	var (
+		ready = make(chan struct{}, 1)
+		chans []<-chan recvResult
+		names []string
+	)
+	for _, tenant := range tenants {
+		name := consumer.Name() + "_" + tenant
+
+		cursor, err := cstore.GetCursor(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		sopts := append([]reflex.StreamOption{reflex.WithTenant(tenant)}, o.streamOpts...)
+		sc, err := stream(ctx, cursor, sopts...)
+		if err != nil {
+			return err
+		}
+
+		chans = append(chans, fairChan(ctx, sc, ready))
+		names = append(names, name)
+	}
+
+	var next int
+	for {
+		var consumed bool
+		for i := range chans {
+			t := (next + i) % len(chans)
+
+			n, err := consumeTurn(ctx, chans[t], cstore, consumer, names[t], o.quota)
+			if err != nil {
+				return err
+			} else if n > 0 {
+				next, consumed = t+1, true
+				break
+			}
+		}
+		if consumed {
+			continue
+		}
+
+		// No pending events, wait for any.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ready:
+		}
+	}
+}
+
+// consumeTurn consumes up to quota pending events of the channel and
+// returns the number of events consumed.
+func consumeTurn(ctx context.Context, ch <-chan recvResult, cstore reflex.CursorStore,
+	consumer reflex.Consumer, name string, quota int) (int, error) {
+
+	var n int
+	for n < quota {
+		var res recvResult
+		select {
+		case res = <-ch:
+		default:
+			return n, nil
+		}
+
+		if res.err != nil {
+			return n, res.err
+		}
+
+		if err := consumer.Consume(ctx, fate.New(), res.e); err != nil {
+			return n, err
+		}
+
+		if err := cstore.SetCursor(ctx, name, res.e.ID); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// fairChan returns a channel buffering the next result received from the
+// stream. It signals ready after each result, see recvChan.
+func fairChan(ctx context.Context, sc reflex.StreamClient, ready chan<- struct{}) <-chan recvResult {
+	ch := make(chan recvResult, 1)
+	go func() {
+		for {
+			e, err := sc.Recv()
+			select {
+			case ch <- recvResult{e: e, err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case ready <- struct{}{}:
+			default:
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ch
+}
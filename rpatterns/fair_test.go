@@ -0,0 +1,80 @@
+package rpatterns_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunFair(t *testing.T) {
+	tables := map[string]*rtest.EventsTable{
+		"noisy": rtest.NewEventsTable(),
+		"quiet": rtest.NewEventsTable(),
+	}
+	for i := 0; i < 10; i++ {
+		tables["noisy"].Insert("noisy", testEventType(1))
+	}
+	for i := 0; i < 2; i++ {
+		tables["quiet"].Insert("quiet", testEventType(1))
+	}
+
+	// Tenant streams of separate in-memory tables.
+	stream := func(ctx context.Context, after string,
+		opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+
+		var o reflex.StreamOptions
+		for _, opt := range opts {
+			opt(&o)
+		}
+		return tables[o.StreamTenant].Stream(ctx, after, opts...)
+	}
+
+	cstore := rtest.NewCursorStore()
+
+	var consumed []string
+	run := func(n int) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		consumer := reflex.NewConsumer("fair", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+			consumed = append(consumed, e.ForeignID+e.ID)
+			if len(consumed) == n {
+				cancel()
+			}
+			time.Sleep(time.Millisecond) // Let the other tenant's stream catch up.
+			return nil
+		})
+
+		err := rpatterns.RunFair(ctx, stream, cstore, consumer, []string{"noisy", "quiet"})
+		jtest.Require(t, context.Canceled, err)
+	}
+
+	run(12)
+	require.Len(t, consumed, 12)
+
+	// The quiet tenant isn't starved by the noisy tenant's backlog.
+	require.Subset(t, consumed[:4], []string{"quiet1", "quiet2"})
+
+	for name, exp := range map[string]string{"fair_noisy": "10", "fair_quiet": "2"} {
+		c, err := cstore.GetCursor(context.Background(), name)
+		require.NoError(t, err)
+		require.Equal(t, exp, c)
+	}
+
+	// Restarts from the cursors.
+	tables["quiet"].Insert("quiet", testEventType(1))
+	consumed = nil
+	run(1)
+	require.Equal(t, []string{"quiet3"}, consumed)
+
+	err := rpatterns.RunFair(context.Background(), stream, cstore,
+		reflex.NewConsumer("fair", nil), nil)
+	require.Error(t, err)
+}
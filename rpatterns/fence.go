@@ -0,0 +1,67 @@
+package rpatterns
+
+import (
+	"context"
+	"sync"
+
+	"github.com/luno/reflex"
+)
+
+// fence returns the cursor store fenced for the consumer if the store
+// implements reflex.CursorFencer, otherwise it returns the store itself.
+// Cursor store wrappers use it to forward fencing, see reflex.Run.
+func fence(ctx context.Context, cstore reflex.CursorStore,
+	consumerName string) (reflex.CursorStore, error) {
+
+	fencer, ok := cstore.(reflex.CursorFencer)
+	if !ok {
+		return cstore, nil
+	}
+	return fencer.Fence(ctx, consumerName)
+}
+
+// newRunStore returns a cursor store for consumers that set their own
+// cursors, e.g. acks. It delegates to the cursor store fenced by the
+// current run, so the consumer's cursor writes are also fenced.
+func newRunStore(cstore reflex.CursorStore) *runStore {
+	return &runStore{base: cstore, current: cstore}
+}
+
+type runStore struct {
+	base reflex.CursorStore
+
+	mu      sync.Mutex
+	current reflex.CursorStore
+}
+
+func (s *runStore) store() reflex.CursorStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+func (s *runStore) GetCursor(ctx context.Context, consumerName string) (string, error) {
+	return s.store().GetCursor(ctx, consumerName)
+}
+
+func (s *runStore) SetCursor(ctx context.Context, consumerName string, cursor string) error {
+	return s.store().SetCursor(ctx, consumerName, cursor)
+}
+
+func (s *runStore) Flush(ctx context.Context) error {
+	return s.store().Flush(ctx)
+}
+
+// Fence implements reflex.CursorFencer by fencing the underlying store and
+// delegating to the fenced store until the next run fences it again.
+func (s *runStore) Fence(ctx context.Context, consumerName string) (reflex.CursorStore, error) {
+	cs, err := fence(ctx, s.base, consumerName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = cs
+	return s, nil
+}
@@ -0,0 +1,98 @@
+package rpatterns_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFencedSpecs(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   func(reflex.StreamFunc, reflex.CursorStore, func()) reflex.Spec
+		cursor string
+	}{
+		{
+			name: "at most once",
+			spec: func(stream reflex.StreamFunc, cstore reflex.CursorStore, fenceFn func()) reflex.Spec {
+				return rpatterns.NewAtMostOnceSpec(stream, cstore,
+					reflex.NewConsumer("fence_test", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+						if e.ID == "2" {
+							fenceFn()
+						}
+						return nil
+					}))
+			},
+			cursor: "2",
+		}, {
+			name: "ack",
+			spec: func(stream reflex.StreamFunc, cstore reflex.CursorStore, fenceFn func()) reflex.Spec {
+				return rpatterns.NewAckSpec(stream, rpatterns.NewAckConsumer("fence_test", cstore,
+					func(ctx context.Context, f fate.Fate, e *rpatterns.AckEvent) error {
+						if e.ID == "2" {
+							fenceFn()
+						}
+						return e.Ack(ctx)
+					}))
+			},
+			cursor: "1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table := rtest.NewEventsTable()
+			for i := 0; i < 3; i++ {
+				table.Insert("1", testEventType(1))
+			}
+
+			cstore := &fencingStore{CursorStore: rtest.NewCursorStore()}
+			fenceFn := func() {
+				// Another run fences the cursor.
+				_, err := cstore.Fence(context.Background(), "fence_test")
+				jtest.RequireNil(t, err)
+			}
+
+			err := reflex.Run(context.Background(), test.spec(table.Stream, cstore, fenceFn))
+			jtest.Require(t, reflex.ErrCursorFenced, err)
+			require.Equal(t, test.cursor, cstore.CursorStore.(*rtest.CursorStore).Cursor("fence_test"))
+		})
+	}
+}
+
+// fencingStore is a cursor store that rejects cursor writes of stale epochs.
+type fencingStore struct {
+	reflex.CursorStore
+
+	mu    sync.Mutex
+	epoch int
+}
+
+func (s *fencingStore) Fence(_ context.Context, _ string) (reflex.CursorStore, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.epoch++
+	return &fencedStore{CursorStore: s.CursorStore, s: s, epoch: s.epoch}, nil
+}
+
+type fencedStore struct {
+	reflex.CursorStore
+	s     *fencingStore
+	epoch int
+}
+
+func (f *fencedStore) SetCursor(ctx context.Context, consumerName string, cursor string) error {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	if f.epoch != f.s.epoch {
+		return reflex.ErrCursorFenced
+	}
+	return f.CursorStore.SetCursor(ctx, consumerName, cursor)
+}
@@ -0,0 +1,296 @@
+package rpatterns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+	"github.com/luno/reflex"
+)
+
+const defaultGroupLeaseTTL = time.Second * 30
+
+// GroupOption defines a functional option to configure consumer groups.
+type GroupOption func(*ConsumerGroup)
+
+// WithGroupOwner provides an option to set the unique owner ID of this
+// instance of the group. It defaults to a random ID.
+func WithGroupOwner(owner string) GroupOption {
+	return func(g *ConsumerGroup) {
+		g.owner = owner
+	}
+}
+
+// WithGroupMaxShards provides an option to limit the number of shards this
+// instance of the group consumes. It defaults to all shards. Note that
+// instances also rebalance shards, each consuming at most
+// ceil(shards/instances).
+func WithGroupMaxShards(n int) GroupOption {
+	return func(g *ConsumerGroup) {
+		g.maxShards = n
+	}
+}
+
+// WithGroupLeaseTTL provides an option to set the shard lease ttl. Leases
+// are renewed every ttl/3. It defaults to 30s.
+func WithGroupLeaseTTL(ttl time.Duration) GroupOption {
+	return func(g *ConsumerGroup) {
+		g.ttl = ttl
+	}
+}
+
+// WithGroupStreamOpts provides an option to set the stream options of shards.
+func WithGroupStreamOpts(opts ...reflex.StreamOption) GroupOption {
+	return func(g *ConsumerGroup) {
+		g.streamOpts = append(g.streamOpts, opts...)
+	}
+}
+
+// WithGroupHashOption provides an option to set the field events are hashed
+// by to shards. It defaults to HashOptionEventForeignID.
+func WithGroupHashOption(hash HashOption) GroupOption {
+	return func(g *ConsumerGroup) {
+		g.hash = hash
+	}
+}
+
+// NewConsumerGroup returns a consumer group that splits the stream into n
+// shards. Multiple instances of the same group coordinate ownership of shards
+// via the lease store, so a single logical consumer can be scaled horizontally.
+// Each event is consistently hashed to a shard and each shard has its own cursor
+// named "<consumer>_<m>_of_<n>".
+//
+// Each instance also holds one of n member leases, so instances know how
+// many instances the group has and rebalance shards by releasing shards
+// in excess of ceil(n/instances). Instances in excess of n consume no shards.
+//
+// NOTE: Modifying n will reset the cursors. Since a shard may briefly be
+//       consumed by two instances when its lease is lost, consumers
+//       should be idempotent.
+func NewConsumerGroup(stream reflex.StreamFunc, cstore reflex.CursorStore,
+	leases reflex.LeaseStore, consumer reflex.Consumer, n int,
+	opts ...GroupOption) *ConsumerGroup {
+
+	g := &ConsumerGroup{
+		stream:    stream,
+		cstore:    cstore,
+		leases:    leases,
+		consumer:  consumer,
+		n:         n,
+		maxShards: n,
+		ttl:       defaultGroupLeaseTTL,
+		hash:      HashOptionEventForeignID,
+		member:    -1,
+	}
+	for _, o := range opts {
+		o(g)
+	}
+
+	if g.owner == "" {
+		g.owner = randomOwner()
+	}
+
+	return g
+}
+
+// ConsumerGroup consumes the shards of a stream that it holds leases for.
+type ConsumerGroup struct {
+	stream     reflex.StreamFunc
+	cstore     reflex.CursorStore
+	leases     reflex.LeaseStore
+	consumer   reflex.Consumer
+	n          int
+	maxShards  int
+	owner      string
+	ttl        time.Duration
+	hash       HashOption
+	streamOpts []reflex.StreamOption
+
+	// member is the member lease held by this instance or -1.
+	member int
+}
+
+// Run blocks acquiring and renewing shard leases and consuming the acquired
+// shards until the context is canceled. Leases are released on return.
+func (g *ConsumerGroup) Run(ctx context.Context) error {
+	running := make(map[int]context.CancelFunc)
+	defer func() {
+		for m, cancel := range running {
+			cancel()
+			err := g.leases.Release(context.Background(), g.leaseKey(m), g.owner)
+			if err != nil {
+				log.Error(ctx, errors.Wrap(err, "release shard lease error"))
+			}
+		}
+		if g.member >= 0 {
+			err := g.leases.Release(context.Background(), g.memberKey(g.member), g.owner)
+			if err != nil {
+				log.Error(ctx, errors.Wrap(err, "release member lease error"))
+			}
+		}
+	}()
+
+	for {
+		limit, err := g.shardLimit(ctx)
+		if err != nil {
+			// Group membership unknown, so keep the current shards.
+			log.Error(ctx, errors.Wrap(err, "group membership error",
+				j.KS("consumer", g.consumer.Name())))
+			limit = len(running)
+		}
+
+		g.releaseShards(ctx, running, limit)
+		g.acquireShards(ctx, running, limit)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(g.ttl / 3):
+		}
+	}
+}
+
+// shardLimit acquires or renews the member lease of this instance and
+// returns the maximum number of shards it should consume,
+// ie. ceil(n/instances) limited by the max shards.
+func (g *ConsumerGroup) shardLimit(ctx context.Context) (int, error) {
+	var instances int
+	for i := 0; i < g.n; i++ {
+		ok, err := g.leases.Acquire(ctx, g.memberKey(i), g.owner, g.ttl)
+		if err != nil {
+			return 0, err
+		}
+
+		if !ok {
+			// Held by another instance.
+			if g.member == i {
+				g.member = -1
+			}
+			instances++
+			continue
+		}
+
+		if g.member < 0 || g.member == i {
+			g.member = i
+			instances++
+			continue
+		}
+
+		// Unused member lease, give it back.
+		if err := g.leases.Release(ctx, g.memberKey(i), g.owner); err != nil {
+			return 0, err
+		}
+	}
+
+	if g.member < 0 {
+		// More instances than shards.
+		return 0, nil
+	}
+
+	limit := (g.n + instances - 1) / instances
+	if limit > g.maxShards {
+		limit = g.maxShards
+	}
+
+	return limit, nil
+}
+
+// releaseShards stops and releases the highest running shards in excess of
+// the limit so that other instances can acquire them.
+func (g *ConsumerGroup) releaseShards(ctx context.Context, running map[int]context.CancelFunc,
+	limit int) {
+
+	for m := g.n - 1; m >= 0 && len(running) > limit; m-- {
+		cancel, ok := running[m]
+		if !ok {
+			continue
+		}
+
+		cancel()
+		delete(running, m)
+
+		if err := g.leases.Release(ctx, g.leaseKey(m), g.owner); err != nil {
+			log.Error(ctx, errors.Wrap(err, "release shard lease error",
+				j.MKV{"consumer": g.consumer.Name(), "shard": m}))
+		}
+	}
+}
+
+// acquireShards acquires or renews shard leases, starting newly
+// acquired shards up to the limit and stopping shards that were lost.
+func (g *ConsumerGroup) acquireShards(ctx context.Context, running map[int]context.CancelFunc,
+	limit int) {
+
+	for m := 0; m < g.n; m++ {
+		cancel, isRunning := running[m]
+		if !isRunning && len(running) >= limit {
+			continue
+		}
+
+		ok, err := g.leases.Acquire(ctx, g.leaseKey(m), g.owner, g.ttl)
+		if err != nil {
+			// Lease state unknown, so stop the shard to be safe.
+			log.Error(ctx, errors.Wrap(err, "acquire shard lease error",
+				j.MKV{"consumer": g.consumer.Name(), "shard": m}))
+			ok = false
+		}
+
+		if ok && !isRunning {
+			shardCtx, cancel := context.WithCancel(ctx)
+			running[m] = cancel
+			spec := reflex.NewSpec(g.stream, g.cstore, g.shardConsumer(m), g.streamOpts...)
+			go runShard(shardCtx, spec)
+		} else if !ok && isRunning {
+			cancel()
+			delete(running, m)
+		}
+	}
+}
+
+func (g *ConsumerGroup) shardName(m int) string {
+	return fmt.Sprintf("%s_%d_of_%d", g.consumer.Name(), m+1, g.n)
+}
+
+func (g *ConsumerGroup) leaseKey(m int) string {
+	return "group_" + g.shardName(m)
+}
+
+func (g *ConsumerGroup) memberKey(i int) string {
+	return fmt.Sprintf("group_%s_member_%d_of_%d", g.consumer.Name(), i+1, g.n)
+}
+
+func (g *ConsumerGroup) shardConsumer(m int) reflex.Consumer {
+	c := makeConsumer(g.hash, m, g.n, g.consumer).(simpleConsumer)
+	c.name = g.shardName(m)
+	return c
+}
+
+// runShard runs the shard spec until the context is canceled, backing off
+// and logging on unexpected errors.
+func runShard(ctx context.Context, spec reflex.Spec) {
+	for ctx.Err() == nil {
+		backoff := time.Millisecond * 100 // Don't spin
+		err := reflex.Run(ctx, spec)
+		if !isExpected(err) {
+			log.Error(ctx, errors.Wrap(err, "run shard error"),
+				j.KS("consumer", spec.Name()))
+			backoff = time.Minute
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func randomOwner() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,147 @@
+package rpatterns_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerGroup(t *testing.T) {
+	const (
+		shards = 4
+		total  = 100
+	)
+
+	table := rtest.NewEventsTable()
+	for i := 0; i < total; i++ {
+		table.Insert(strconv.Itoa(i), testEventType(1))
+	}
+
+	var (
+		mu       sync.Mutex
+		consumed = make(map[string]int)
+	)
+	consumer := reflex.NewConsumer("group_test",
+		func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			consumed[e.ID]++
+			return nil
+		})
+
+	cstore := rtest.NewCursorStore()
+	leases := rtest.NewLeaseStore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, owner := range []string{"a", "b"} {
+		g := rpatterns.NewConsumerGroup(table.Stream, cstore, leases, consumer, shards,
+			rpatterns.WithGroupOwner(owner),
+			rpatterns.WithGroupMaxShards(shards/2),
+			rpatterns.WithGroupLeaseTTL(time.Millisecond*30))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = g.Run(ctx)
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(consumed) == total
+	}, time.Second*5, time.Millisecond*10)
+
+	// Shards are spread between owners.
+	owners := make(map[string]int)
+	for m := 1; m <= shards; m++ {
+		owners[leases.Owner("group_group_test_"+strconv.Itoa(m)+"_of_4")]++
+	}
+	require.Equal(t, map[string]int{"a": 2, "b": 2}, owners)
+
+	cancel()
+	wg.Wait()
+
+	for id, n := range consumed {
+		require.Equal(t, 1, n, id)
+	}
+
+	// Leases released on stop.
+	require.Equal(t, "", leases.Owner("group_group_test_1_of_4"))
+}
+
+func TestConsumerGroupRebalance(t *testing.T) {
+	const shards = 4
+
+	consumer := reflex.NewConsumer("rebalance_test",
+		func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+			return nil
+		})
+
+	table := rtest.NewEventsTable()
+	cstore := rtest.NewCursorStore()
+	leases := rtest.NewLeaseStore()
+
+	owners := func() map[string]int {
+		res := make(map[string]int)
+		for m := 1; m <= shards; m++ {
+			res[leases.Owner("group_rebalance_test_"+strconv.Itoa(m)+"_of_4")]++
+		}
+		return res
+	}
+
+	run := func(ctx context.Context, owner string) *sync.WaitGroup {
+		g := rpatterns.NewConsumerGroup(table.Stream, cstore, leases, consumer, shards,
+			rpatterns.WithGroupOwner(owner),
+			rpatterns.WithGroupLeaseTTL(time.Millisecond*30))
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = g.Run(ctx)
+		}()
+		return &wg
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	wgA := run(ctxA, "a")
+
+	// A single instance consumes all shards.
+	require.Eventually(t, func() bool {
+		return owners()["a"] == shards
+	}, time.Second*5, time.Millisecond*10)
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	wgB := run(ctxB, "b")
+
+	// Shards are rebalanced when another instance joins.
+	require.Eventually(t, func() bool {
+		o := owners()
+		return o["a"] == 2 && o["b"] == 2
+	}, time.Second*5, time.Millisecond*10)
+
+	cancelA()
+	wgA.Wait()
+
+	// And when it leaves.
+	require.Eventually(t, func() bool {
+		return owners()["b"] == shards
+	}, time.Second*5, time.Millisecond*10)
+
+	cancelB()
+	wgB.Wait()
+}
@@ -0,0 +1,233 @@
+package rpatterns
+
+import (
+	"context"
+	"time"
+
+	"github.com/luno/reflex"
+)
+
+const (
+	defaultJoinBuffer  = 10000
+	defaultJoinTimeout = time.Hour
+)
+
+// JoinKey returns the key by which events of joined streams are correlated.
+type JoinKey func(*reflex.Event) string
+
+// ForeignIDKey is a JoinKey that correlates events by foreign ID.
+func ForeignIDKey(e *reflex.Event) string {
+	return e.ForeignID
+}
+
+// JoinFunc is called with the correlated pair of events of stream A and B.
+type JoinFunc func(ctx context.Context, a, b *reflex.Event) error
+
+// JoinOption defines a functional option to configure Join.
+type JoinOption func(*joinOptions)
+
+type joinOptions struct {
+	buffer  int
+	timeout time.Duration
+	filterA func(*reflex.Event) bool
+	filterB func(*reflex.Event) bool
+}
+
+// cutoff returns the time before which unmatched events are expired.
+func (o joinOptions) cutoff() time.Time {
+	if o.timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-o.timeout)
+}
+
+// WithJoinBuffer provides an option to set the maximum number of unmatched
+// events buffered per stream. The oldest unmatched event is dropped when
+// the buffer is full. It defaults to 10000.
+func WithJoinBuffer(n int) JoinOption {
+	return func(o *joinOptions) {
+		o.buffer = n
+	}
+}
+
+// WithJoinTimeout provides an option to set the duration after which
+// unmatched events are dropped. Zero disables the timeout. It defaults to 1h.
+func WithJoinTimeout(d time.Duration) JoinOption {
+	return func(o *joinOptions) {
+		o.timeout = d
+	}
+}
+
+// WithJoinTypes provides an option to only join events of stream A of
+// typeA with events of stream B of typeB, e.g. "payment created" with
+// "kyc approved". Other events are ignored.
+func WithJoinTypes(typeA, typeB reflex.EventType) JoinOption {
+	return func(o *joinOptions) {
+		o.filterA = func(e *reflex.Event) bool {
+			return reflex.IsType(e.Type, typeA)
+		}
+		o.filterB = func(e *reflex.Event) bool {
+			return reflex.IsType(e.Type, typeB)
+		}
+	}
+}
+
+// Join correlates the events of stream A and B by key and calls fn with
+// each pair of matching events. Unmatched events are buffered until a
+// matching event of the other stream is received, or until they are dropped
+// due to the timeout or buffer size. Matching events of the same stream are
+// paired in order.
+//
+// This can be used for workflows that must wait for two events,
+// e.g. both "payment created" and "kyc approved" of a user.
+//
+//	err := rpatterns.Join(ctx, payments, kyc, rpatterns.ForeignIDKey, fn,
+//		rpatterns.WithJoinTypes(PaymentCreated, KYCApproved))
+//
+// Join blocks until either stream or fn errors, or until the context is
+// canceled. It always returns a non-nil error. Note that the state is not
+// persisted, so stream clients should start from the oldest event that
+// may still be unmatched on restart. The stream clients should be
+// created with the context so that they return when it is canceled.
+func Join(ctx context.Context, a, b reflex.StreamClient, key JoinKey,
+	fn JoinFunc, opts ...JoinOption) error {
+
+	o := joinOptions{
+		buffer:  defaultJoinBuffer,
+		timeout: defaultJoinTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chA := recvChan(ctx, a)
+	chB := recvChan(ctx, b)
+
+	bufA := &joinBuffer{size: o.buffer}
+	bufB := &joinBuffer{size: o.buffer}
+
+	var tickC <-chan time.Time
+	if o.timeout > 0 {
+		ticker := time.NewTicker(o.timeout)
+		defer ticker.Stop()
+		tickC = ticker.C
+	}
+
+	for {
+		var (
+			res        recvResult
+			buf, other *joinBuffer
+			filter     func(*reflex.Event) bool
+			isA        bool
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tickC:
+			bufA.Expire(o.cutoff())
+			bufB.Expire(o.cutoff())
+			continue
+		case res = <-chA:
+			buf, other, filter, isA = bufA, bufB, o.filterA, true
+		case res = <-chB:
+			buf, other, filter, isA = bufB, bufA, o.filterB, false
+		}
+
+		if res.err != nil {
+			return res.err
+		}
+
+		if filter != nil && !filter(res.e) {
+			continue
+		}
+
+		k := key(res.e)
+		match, ok := other.Pop(k, o.cutoff())
+		if !ok {
+			buf.Push(k, res.e)
+			continue
+		}
+
+		var err error
+		if isA {
+			err = fn(ctx, res.e, match)
+		} else {
+			err = fn(ctx, match, res.e)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// recvChan returns a channel of results received from the stream client
+// by a background goroutine until it errors or the context is canceled.
+func recvChan(ctx context.Context, sc reflex.StreamClient) <-chan recvResult {
+	ch := make(chan recvResult)
+	go func() {
+		for {
+			e, err := sc.Recv()
+			select {
+			case ch <- recvResult{e: e, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+type recvResult struct {
+	e   *reflex.Event
+	err error
+}
+
+// joinBuffer is a bounded buffer of unmatched events in stream order.
+type joinBuffer struct {
+	size    int
+	entries []joinEntry
+}
+
+type joinEntry struct {
+	key  string
+	e    *reflex.Event
+	recv time.Time
+}
+
+// Push adds the event to the buffer, dropping the oldest event if full.
+func (b *joinBuffer) Push(key string, e *reflex.Event) {
+	if b.size > 0 && len(b.entries) >= b.size {
+		b.entries = b.entries[1:]
+	}
+	b.entries = append(b.entries, joinEntry{key: key, e: e, recv: time.Now()})
+}
+
+// Pop removes and returns the oldest event with the key received
+// after the cutoff.
+func (b *joinBuffer) Pop(key string, cutoff time.Time) (*reflex.Event, bool) {
+	b.Expire(cutoff)
+	for i, entry := range b.entries {
+		if entry.key != key {
+			continue
+		}
+		b.entries = append(b.entries[:i], b.entries[i+1:]...)
+		return entry.e, true
+	}
+	return nil, false
+}
+
+// Expire drops events received before the cutoff.
+func (b *joinBuffer) Expire(cutoff time.Time) {
+	var i int
+	for i < len(b.entries) && b.entries[i].recv.Before(cutoff) {
+		i++
+	}
+	b.entries = b.entries[i:]
+}
@@ -0,0 +1,105 @@
+package rpatterns_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoin(t *testing.T) {
+	payments := rtest.NewEventsTable()
+	kyc := rtest.NewEventsTable()
+
+	payments.Insert("u1", testEventType(1))
+	payments.Insert("u2", testEventType(1))
+	payments.Insert("u3", testEventType(2)) // Ignored type
+	kyc.Insert("u3", testEventType(3))
+	kyc.Insert("u2", testEventType(3))
+	kyc.Insert("u4", testEventType(3))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := payments.Stream(ctx, "")
+	jtest.RequireNil(t, err)
+	b, err := kyc.Stream(ctx, "")
+	jtest.RequireNil(t, err)
+
+	var (
+		mu    sync.Mutex
+		pairs [][2]string
+	)
+	fn := func(ctx context.Context, a, b *reflex.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, a.ForeignID, b.ForeignID)
+		pairs = append(pairs, [2]string{a.ForeignID, b.ID})
+		return nil
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- rpatterns.Join(ctx, a, b, rpatterns.ForeignIDKey, fn,
+			rpatterns.WithJoinTypes(testEventType(1), testEventType(3)))
+	}()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(pairs) == 1
+	}, time.Second, time.Millisecond)
+
+	// Late matching event.
+	kyc.Insert("u1", testEventType(3))
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(pairs) == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	jtest.Require(t, context.Canceled, <-errCh)
+	require.Equal(t, [][2]string{{"u2", "2"}, {"u1", "4"}}, pairs)
+}
+
+func TestJoinBuffer(t *testing.T) {
+	left := rtest.NewEventsTable()
+	right := rtest.NewEventsTable()
+
+	left.Insert("u1", testEventType(1))
+	left.Insert("u2", testEventType(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := left.Stream(ctx, "")
+	jtest.RequireNil(t, err)
+	b, err := right.Stream(ctx, "")
+	jtest.RequireNil(t, err)
+
+	ch := make(chan string)
+	fn := func(ctx context.Context, a, b *reflex.Event) error {
+		ch <- a.ForeignID
+		return nil
+	}
+
+	go func() {
+		_ = rpatterns.Join(ctx, a, b, rpatterns.ForeignIDKey, fn,
+			rpatterns.WithJoinBuffer(1))
+	}()
+
+	// Wait for both left events to be buffered, dropping u1.
+	time.Sleep(time.Millisecond * 10)
+	right.Insert("u1", testEventType(1))
+	right.Insert("u2", testEventType(1))
+
+	require.Equal(t, "u2", <-ch)
+}
@@ -0,0 +1,248 @@
+package rpatterns
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+	"github.com/luno/reflex"
+)
+
+const defaultLeaderPeriod = time.Second * 10
+
+type leaderConfig struct {
+	period  time.Duration
+	owner   string
+	runOpts []reflex.RunOption
+}
+
+// LeaderOption defines a functional option to configure leader election.
+type LeaderOption func(*leaderConfig)
+
+// WithLeaderPeriod provides an option to set the period at which leadership
+// is acquired or checked. Leases expire after three periods. It defaults to 10s.
+func WithLeaderPeriod(d time.Duration) LeaderOption {
+	return func(c *leaderConfig) {
+		c.period = d
+	}
+}
+
+// WithLeaderOwner provides an option to set the unique owner ID used for
+// lease based leader election. It defaults to a random ID.
+func WithLeaderOwner(owner string) LeaderOption {
+	return func(c *leaderConfig) {
+		c.owner = owner
+	}
+}
+
+// WithLeaderRunOpts provides an option to set the reflex.Run options
+// used when running the spec.
+func WithLeaderRunOpts(opts ...reflex.RunOption) LeaderOption {
+	return func(c *leaderConfig) {
+		c.runOpts = append(c.runOpts, opts...)
+	}
+}
+
+// RunLeader blocks, running the spec only while this instance holds the MySQL
+// advisory lock (see GET_LOCK) with the provided name, so only one replica of
+// a deployment runs the spec at a time. The lock is held by a dedicated
+// connection, so if the leader dies the lock is released and another replica
+// takes over within a period. It returns when the context is canceled.
+func RunLeader(ctx context.Context, lockName string, dbc *sql.DB,
+	spec reflex.Spec, opts ...LeaderOption) error {
+
+	conf := newLeaderConfig(opts)
+	return runLeader(ctx, &mysqlLock{dbc: dbc, name: lockName}, spec.Name(),
+		runSpec(spec, conf), conf)
+}
+
+// RunLeaderLease works as RunLeader except that leadership is coordinated
+// via a lease of the lock name in the lease store.
+func RunLeaderLease(ctx context.Context, lockName string, leases reflex.LeaseStore,
+	spec reflex.Spec, opts ...LeaderOption) error {
+
+	conf := newLeaderConfig(opts)
+	lock := &leaseLock{
+		leases: leases,
+		key:    lockName,
+		owner:  conf.owner,
+		ttl:    conf.period * 3,
+	}
+	return runLeader(ctx, lock, spec.Name(), runSpec(spec, conf), conf)
+}
+
+// runSpec returns a function that runs the spec with the configured run options.
+func runSpec(spec reflex.Spec, conf leaderConfig) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return reflex.Run(ctx, spec, conf.runOpts...)
+	}
+}
+
+// leaderLock abstracts the lock used for leader election.
+type leaderLock interface {
+	// acquire acquires or renews the lock and returns true if held.
+	acquire(ctx context.Context) (bool, error)
+
+	// release releases the lock if held.
+	release()
+}
+
+func newLeaderConfig(opts []LeaderOption) leaderConfig {
+	conf := leaderConfig{period: defaultLeaderPeriod}
+	for _, o := range opts {
+		o(&conf)
+	}
+	if conf.owner == "" {
+		conf.owner = randomOwner()
+	}
+	return conf
+}
+
+// runLeader blocks, calling run only while holding the lock.
+func runLeader(ctx context.Context, lock leaderLock, name string,
+	run func(ctx context.Context) error, conf leaderConfig) error {
+
+	defer lock.release()
+
+	for {
+		ok, err := lock.acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error(ctx, errors.Wrap(err, "acquire leader lock error"),
+				j.KS("consumer", name))
+		}
+
+		if ok {
+			err := runAsLeader(ctx, lock, conf, run)
+			if !isExpected(err) {
+				log.Error(ctx, errors.Wrap(err, "run leader error"),
+					j.KS("consumer", name))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(conf.period):
+		}
+	}
+}
+
+// runAsLeader calls run until it errors or leadership is lost.
+func runAsLeader(ctx context.Context, lock leaderLock, conf leaderConfig,
+	run func(ctx context.Context) error) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- run(ctx)
+	}()
+
+	t := time.NewTicker(conf.period)
+	defer t.Stop()
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-t.C:
+		}
+
+		ok, err := lock.acquire(ctx)
+		if err != nil || !ok {
+			// Leadership lost or unknown, stop.
+			cancel()
+			<-errCh
+			return err
+		}
+	}
+}
+
+// mysqlLock is a leader lock backed by a MySQL advisory lock
+// held by a dedicated connection.
+type mysqlLock struct {
+	dbc  *sql.DB
+	name string
+	conn *sql.Conn
+	held bool
+}
+
+func (l *mysqlLock) acquire(ctx context.Context) (bool, error) {
+	if l.conn == nil {
+		conn, err := l.dbc.Conn(ctx)
+		if err != nil {
+			return false, err
+		}
+		l.conn = conn
+		l.held = false
+	}
+
+	if l.held {
+		// Note that get_lock is re-entrant, so just check the lock.
+		var ok sql.NullBool
+		err := l.conn.QueryRowContext(ctx, "select is_used_lock(?) = connection_id()",
+			l.name).Scan(&ok)
+		if err != nil {
+			l.reset()
+			return false, err
+		}
+		l.held = ok.Bool
+		return l.held, nil
+	}
+
+	var res sql.NullInt64
+	err := l.conn.QueryRowContext(ctx, "select get_lock(?, 0)", l.name).Scan(&res)
+	if err != nil {
+		l.reset()
+		return false, err
+	}
+
+	l.held = res.Int64 == 1
+	return l.held, nil
+}
+
+func (l *mysqlLock) release() {
+	if l.conn == nil {
+		return
+	}
+	if l.held {
+		_, _ = l.conn.ExecContext(context.Background(), "select release_lock(?)", l.name)
+	}
+	l.reset()
+}
+
+func (l *mysqlLock) reset() {
+	_ = l.conn.Close()
+	l.conn = nil
+	l.held = false
+}
+
+// leaseLock is a leader lock backed by a lease store.
+type leaseLock struct {
+	leases reflex.LeaseStore
+	key    string
+	owner  string
+	ttl    time.Duration
+	held   bool
+}
+
+func (l *leaseLock) acquire(ctx context.Context) (bool, error) {
+	ok, err := l.leases.Acquire(ctx, l.key, l.owner, l.ttl)
+	l.held = ok && err == nil
+	return l.held, err
+}
+
+func (l *leaseLock) release() {
+	if !l.held {
+		return
+	}
+	err := l.leases.Release(context.Background(), l.key, l.owner)
+	if err != nil {
+		log.Error(context.Background(), errors.Wrap(err, "release leader lease error"))
+	}
+	l.held = false
+}
@@ -0,0 +1,83 @@
+package rpatterns_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunLeaderLease(t *testing.T) {
+	table := rtest.NewEventsTable()
+	leases := rtest.NewLeaseStore()
+	cstore := rtest.NewCursorStore()
+
+	var (
+		mu       sync.Mutex
+		consumed = make(map[string]int)
+	)
+	makeSpec := func(owner string) reflex.Spec {
+		consumer := reflex.NewConsumer("leader_test",
+			func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+				mu.Lock()
+				defer mu.Unlock()
+				consumed[owner]++
+				return nil
+			})
+		return reflex.NewSpec(table.Stream, cstore, consumer)
+	}
+
+	run := func(ctx context.Context, owner string) chan error {
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- rpatterns.RunLeaderLease(ctx, "leader", leases, makeSpec(owner),
+				rpatterns.WithLeaderOwner(owner),
+				rpatterns.WithLeaderPeriod(time.Millisecond*10))
+		}()
+		return errCh
+	}
+
+	count := func(owner string) func() bool {
+		return func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return consumed[owner] > 0
+		}
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	errA := run(ctxA, "a")
+
+	require.Eventually(t, func() bool {
+		return leases.Owner("leader") == "a"
+	}, time.Second, time.Millisecond)
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	errB := run(ctxB, "b")
+
+	table.Insert("1", testEventType(1))
+	require.Eventually(t, count("a"), time.Second, time.Millisecond)
+
+	// Leader a stops, b takes over.
+	cancelA()
+	require.Equal(t, context.Canceled, <-errA)
+
+	table.Insert("2", testEventType(1))
+	require.Eventually(t, count("b"), time.Second, time.Millisecond)
+	require.Equal(t, "b", leases.Owner("leader"))
+
+	cancelB()
+	require.Equal(t, context.Canceled, <-errB)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, map[string]int{"a": 1, "b": 1}, consumed)
+}
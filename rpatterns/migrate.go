@@ -0,0 +1,217 @@
+package rpatterns
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+	"github.com/luno/reflex"
+)
+
+const defaultShadowPollPeriod = time.Second
+
+// ErrShadowMismatch should be wrapped by CompareFuncs if the side effects of
+// the shadow consumer differ from the side effects of the current consumer.
+var ErrShadowMismatch = errors.New("shadow side effects mismatch", j.C("ERR_e61b4d07a93c582f"))
+
+// ShadowFunc consumes the event like the new consumer, but returns the side
+// effects instead of applying them.
+type ShadowFunc func(ctx context.Context, f fate.Fate, e *reflex.Event) (interface{}, error)
+
+// CompareFunc compares the side effects of the shadow consumer with the side
+// effects applied by the current consumer for the event. It should return an
+// error wrapping ErrShadowMismatch if they differ. Other errors are retried.
+type CompareFunc func(ctx context.Context, e *reflex.Event, effects interface{}) error
+
+// ShadowOption defines a functional option to configure NewShadowSpec.
+type ShadowOption func(*shadowOptions)
+
+type shadowOptions struct {
+	pollPeriod time.Duration
+	mismatchFn func(context.Context, *reflex.Event, error)
+	streamOpts []reflex.StreamOption
+}
+
+// WithShadowPollPeriod provides an option to set the period of polling the
+// current consumer's cursor while the shadow consumer waits for it to
+// consume an event. It defaults to 1s.
+func WithShadowPollPeriod(d time.Duration) ShadowOption {
+	return func(o *shadowOptions) {
+		o.pollPeriod = d
+	}
+}
+
+// WithShadowMismatchFunc provides an option to call the function for each
+// mismatch instead of logging it, e.g. to increment a metric.
+func WithShadowMismatchFunc(fn func(context.Context, *reflex.Event, error)) ShadowOption {
+	return func(o *shadowOptions) {
+		o.mismatchFn = fn
+	}
+}
+
+// WithShadowStreamOpts provides an option to set the stream options
+// of the shadow consumer's stream.
+func WithShadowStreamOpts(opts ...reflex.StreamOption) ShadowOption {
+	return func(o *shadowOptions) {
+		o.streamOpts = opts
+	}
+}
+
+// NewShadowSpec returns a spec that runs the new consumer in shadow mode for a
+// blue/green migration of the current consumer. Each event is consumed with
+// the shadow func and its side effects are compared with the current
+// consumer's via the compare func. Mismatches are logged (see
+// WithShadowMismatchFunc) and do not block the shadow consumer.
+//
+// The shadow consumer's cursor is named "<next>_shadow" and starts from the
+// current consumer's cursor. For int event IDs the shadow consumer never
+// passes the current consumer, so its side effects are always applied before
+// comparing. Use Handover to cut over once there are no mismatches.
+func NewShadowSpec(stream reflex.StreamFunc, cstore reflex.CursorStore, current, next string,
+	fn ShadowFunc, cmp CompareFunc, opts ...ShadowOption) reflex.Spec {
+
+	o := shadowOptions{
+		pollPeriod: defaultShadowPollPeriod,
+		mismatchFn: func(ctx context.Context, e *reflex.Event, err error) {
+			log.Error(ctx, errors.Wrap(err, "shadow consumer mismatch",
+				j.MKS{"consumer": next, "event_id": e.ID}))
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := &shadow{
+		cstore:  cstore,
+		current: current,
+		fn:      fn,
+		cmp:     cmp,
+		o:       o,
+	}
+
+	consumer := reflex.NewConsumer(next+"_shadow", s.consume)
+	store := &shadowCursorStore{CursorStore: cstore, current: current}
+
+	return reflex.NewSpec(stream, store, consumer, o.streamOpts...)
+}
+
+type shadow struct {
+	cstore  reflex.CursorStore
+	current string
+	fn      ShadowFunc
+	cmp     CompareFunc
+	o       shadowOptions
+}
+
+func (s *shadow) consume(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+	if err := s.awaitCurrent(ctx, e); err != nil {
+		return err
+	}
+
+	effects, err := s.fn(ctx, f, e)
+	if err != nil {
+		return err
+	}
+
+	err = s.cmp(ctx, e, effects)
+	if errors.Is(err, ErrShadowMismatch) {
+		s.o.mismatchFn(ctx, e, err)
+		return nil
+	}
+	return err
+}
+
+// awaitCurrent blocks until the current consumer's cursor is at or after
+// the event. It returns immediately for non-int event IDs.
+func (s *shadow) awaitCurrent(ctx context.Context, e *reflex.Event) error {
+	if !e.IsIDInt() {
+		return nil
+	}
+
+	for {
+		cursor, err := s.cstore.GetCursor(ctx, s.current)
+		if err != nil {
+			return err
+		}
+
+		if c, err := strconv.ParseInt(cursor, 10, 64); err == nil && c >= e.IDInt() {
+			return nil
+		}
+
+		t := time.NewTimer(s.o.pollPeriod)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// shadowCursorStore is a cursor store that returns the current consumer's
+// cursor if the shadow consumer has no cursor yet.
+type shadowCursorStore struct {
+	reflex.CursorStore
+	current string
+}
+
+func (s *shadowCursorStore) GetCursor(ctx context.Context, consumerName string) (string, error) {
+	cursor, err := s.CursorStore.GetCursor(ctx, consumerName)
+	if err != nil {
+		return "", err
+	} else if cursor != "" {
+		return cursor, nil
+	}
+
+	return s.CursorStore.GetCursor(ctx, s.current)
+}
+
+// Fence implements reflex.CursorFencer by fencing the underlying store.
+func (s *shadowCursorStore) Fence(ctx context.Context, consumerName string) (reflex.CursorStore, error) {
+	cs, err := fence(ctx, s.CursorStore, consumerName)
+	if err != nil {
+		return nil, err
+	}
+	return &shadowCursorStore{CursorStore: cs, current: s.current}, nil
+}
+
+// Handover cuts over from the current consumer to the next consumer by
+// resetting the next consumer's cursor to the current consumer's cursor.
+// If the cursor store implements reflex.CursorFencer, the current consumer's
+// cursor is fenced first, so any still running instances of it fail with
+// reflex.ErrCursorFenced instead of advancing its cursor after the handover.
+// The current consumer should be stopped before and the next consumer
+// started after the handover. The cursor store must implement
+// reflex.CursorResetter. It returns the handed over cursor.
+func Handover(ctx context.Context, cstore reflex.CursorStore, current, next string) (string, error) {
+	resetter, ok := cstore.(reflex.CursorResetter)
+	if !ok {
+		return "", reflex.ErrResetNotSupported
+	}
+
+	if fencer, ok := cstore.(reflex.CursorFencer); ok {
+		if _, err := fencer.Fence(ctx, current); err != nil {
+			return "", errors.Wrap(err, "fence cursor error")
+		}
+	}
+
+	// Flush any buffered cursors of the current consumer.
+	if err := cstore.Flush(ctx); err != nil {
+		return "", err
+	}
+
+	cursor, err := cstore.GetCursor(ctx, current)
+	if err != nil {
+		return "", errors.Wrap(err, "get cursor error")
+	}
+
+	if err := resetter.ResetCursor(ctx, next, cursor); err != nil {
+		return "", errors.Wrap(err, "reset cursor error")
+	}
+
+	return cursor, cstore.Flush(ctx)
+}
@@ -0,0 +1,90 @@
+package rpatterns_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowSpec(t *testing.T) {
+	table := rtest.NewEventsTable()
+	for i := 0; i < 4; i++ {
+		table.Insert(strconv.Itoa(i+1), testEventType(1))
+	}
+
+	cstore := rtest.NewCursorStore()
+	ctx := context.Background()
+
+	// The current consumer applied the side effects of the first event.
+	var (
+		mu         sync.Mutex
+		applied    = map[string]string{"1": "1"}
+		mismatches []string
+	)
+	jtest.RequireNil(t, cstore.SetCursor(ctx, "blue", "1"))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fn := func(ctx context.Context, f fate.Fate, e *reflex.Event) (interface{}, error) {
+		if e.ID == "3" {
+			return "bug", nil
+		}
+		return e.ForeignID, nil
+	}
+	cmp := func(ctx context.Context, e *reflex.Event, effects interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if applied[e.ID] != effects {
+			return errors.Wrap(rpatterns.ErrShadowMismatch, "")
+		}
+		return nil
+	}
+	onMismatch := func(ctx context.Context, e *reflex.Event, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		mismatches = append(mismatches, e.ID)
+	}
+
+	spec := rpatterns.NewShadowSpec(table.Stream, cstore, "blue", "green", fn, cmp,
+		rpatterns.WithShadowPollPeriod(time.Millisecond),
+		rpatterns.WithShadowMismatchFunc(onMismatch))
+	go reflex.Run(ctx, spec)
+
+	// The shadow consumer starts from the current consumer's cursor
+	// and doesn't pass it.
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, "", cstore.Cursor("green_shadow"))
+
+	for _, id := range []string{"2", "3", "4"} {
+		mu.Lock()
+		applied[id] = id
+		mu.Unlock()
+		jtest.RequireNil(t, cstore.SetCursor(ctx, "blue", id))
+	}
+
+	require.Eventually(t, func() bool {
+		return cstore.Cursor("green_shadow") == "4"
+	}, time.Second, time.Millisecond)
+	mu.Lock()
+	require.Equal(t, []string{"3"}, mismatches)
+	mu.Unlock()
+
+	cursor, err := rpatterns.Handover(ctx, cstore, "blue", "green")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "4", cursor)
+	require.Equal(t, "4", cstore.Cursor("green"))
+
+	_, err = rpatterns.Handover(ctx, rpatterns.MemCursorStore(), "blue", "green")
+	jtest.Require(t, reflex.ErrResetNotSupported, err)
+}
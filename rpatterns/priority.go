@@ -0,0 +1,245 @@
+package rpatterns
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+const defaultPriorityRatio = 10
+
+// PriorityOption defines a functional option to configure RunPriority.
+type PriorityOption func(*priorityOptions)
+
+type priorityOptions struct {
+	ratio      int
+	streamOpts []reflex.StreamOption
+}
+
+// WithPriorityRatio provides an option to set the maximum number of high
+// priority events consumed before a pending low priority event is consumed,
+// guaranteeing some low priority throughput. It defaults to 10.
+func WithPriorityRatio(n int) PriorityOption {
+	return func(o *priorityOptions) {
+		o.ratio = n
+	}
+}
+
+// WithPriorityStreamOpts provides an option to set the stream options
+// of both streams.
+func WithPriorityStreamOpts(opts ...reflex.StreamOption) PriorityOption {
+	return func(o *priorityOptions) {
+		o.streamOpts = opts
+	}
+}
+
+// RunPriority consumes the events of the high and low priority streams with
+// the consumer, e.g. user-facing and backfill events. Pending high priority
+// events are always consumed first, but a pending low priority event is
+// consumed after every ratio high priority events, see WithPriorityRatio.
+// Each stream has its own cursor named "<consumer>_high" and "<consumer>_low".
+//
+// The merged streams are consumed with reflex.Run, so the consumer is
+// registered for health checks and metrics like any other spec.
+//
+// RunPriority blocks until either stream or the consumer errors, or until the
+// context is canceled. It always returns a non-nil error.
+func RunPriority(ctx context.Context, high, low reflex.StreamFunc, cstore reflex.CursorStore,
+	consumer reflex.Consumer, opts ...PriorityOption) error {
+
+	o := priorityOptions{ratio: defaultPriorityRatio}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	p := &priorityAdapter{
+		high:     high,
+		low:      low,
+		cstore:   cstore,
+		highName: consumer.Name() + "_high",
+		lowName:  consumer.Name() + "_low",
+		ratio:    o.ratio,
+	}
+
+	return reflex.Run(ctx, reflex.NewSpec(p.Stream, p, consumer, o.streamOpts...))
+}
+
+// priorityAdapter adapts the high and low priority streams and their cursors
+// to a single StreamFunc and CursorStore.
+type priorityAdapter struct {
+	high, low         reflex.StreamFunc
+	cstore            reflex.CursorStore
+	highName, lowName string
+	ratio             int
+
+	mu      sync.Mutex
+	pending []priorityCursor // Cursors of received events in order.
+}
+
+type priorityCursor struct {
+	name string
+	id   string
+}
+
+// Stream implements StreamFunc by streaming both streams from their stored
+// cursors. The after cursor is ignored, see GetCursor.
+func (p *priorityAdapter) Stream(ctx context.Context, _ string,
+	opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+
+	p.mu.Lock()
+	p.pending = nil
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	c := &priorityClient{ctx: ctx, cancel: cancel, adapter: p}
+
+	var err error
+	c.chHigh, err = c.open(p.high, p.highName, opts)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.chLow, err = c.open(p.low, p.lowName, opts)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetCursor implements CursorStore and always returns an empty cursor since
+// the streams are started from their own cursors.
+func (p *priorityAdapter) GetCursor(context.Context, string) (string, error) {
+	return "", nil
+}
+
+// SetCursor implements CursorStore by setting the cursor of the stream
+// the event was received from.
+func (p *priorityAdapter) SetCursor(ctx context.Context, _ string, cursor string) error {
+	p.mu.Lock()
+	if len(p.pending) == 0 || p.pending[0].id != cursor {
+		p.mu.Unlock()
+		return errors.New("cursor of unknown event", j.KS("event_id", cursor))
+	}
+	c := p.pending[0]
+	p.pending = p.pending[1:]
+	p.mu.Unlock()
+
+	return p.cstore.SetCursor(ctx, c.name, c.id)
+}
+
+func (p *priorityAdapter) Flush(ctx context.Context) error {
+	return p.cstore.Flush(ctx)
+}
+
+func (p *priorityAdapter) add(name string, e *reflex.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending = append(p.pending, priorityCursor{name: name, id: e.ID})
+}
+
+type priorityClient struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	adapter *priorityAdapter
+	closers []io.Closer
+	chHigh  <-chan recvResult
+	chLow   <-chan recvResult
+	highs   int
+}
+
+// open returns a channel of results received from the stream after
+// the stored cursor, see recvChan.
+func (c *priorityClient) open(stream reflex.StreamFunc, name string,
+	opts []reflex.StreamOption) (<-chan recvResult, error) {
+
+	cursor, err := c.adapter.cstore.GetCursor(c.ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := stream(c.ctx, cursor, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := sc.(io.Closer); ok {
+		c.closers = append(c.closers, closer)
+	}
+
+	return recvChan(c.ctx, sc), nil
+}
+
+func (c *priorityClient) Recv() (*reflex.Event, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var (
+		res    recvResult
+		isHigh bool
+		ok     bool
+	)
+
+	// Consume a pending low event if the ratio is reached.
+	if c.highs >= c.adapter.ratio {
+		select {
+		case res = <-c.chLow:
+			ok = true
+		default:
+		}
+	}
+
+	// Otherwise prefer pending high events.
+	if !ok {
+		select {
+		case res = <-c.chHigh:
+			ok, isHigh = true, true
+		default:
+		}
+	}
+
+	// Otherwise wait for either.
+	if !ok {
+		select {
+		case <-c.ctx.Done():
+			return nil, c.ctx.Err()
+		case res = <-c.chHigh:
+			isHigh = true
+		case res = <-c.chLow:
+		}
+	}
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	name := c.adapter.lowName
+	if isHigh {
+		name = c.adapter.highName
+		c.highs++
+	} else {
+		c.highs = 0
+	}
+
+	c.adapter.add(name, res.e)
+	return res.e, nil
+}
+
+// Close stops both streams and closes them if they are closers.
+func (c *priorityClient) Close() error {
+	c.cancel()
+
+	var err error
+	for _, closer := range c.closers {
+		if cerr := closer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
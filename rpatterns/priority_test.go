@@ -0,0 +1,102 @@
+package rpatterns_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPriority(t *testing.T) {
+	high := rtest.NewEventsTable()
+	low := rtest.NewEventsTable()
+	for i := 0; i < 5; i++ {
+		high.Insert("high", testEventType(1))
+	}
+	for i := 0; i < 3; i++ {
+		low.Insert("low", testEventType(2))
+	}
+
+	cstore := rtest.NewCursorStore()
+
+	var (
+		mu       sync.Mutex
+		consumed []string
+		closed   int
+	)
+	closing := func(stream reflex.StreamFunc) reflex.StreamFunc {
+		return func(ctx context.Context, after string, opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+			sc, err := stream(ctx, after, opts...)
+			if err != nil {
+				return nil, err
+			}
+			return &closingClient{StreamClient: sc, close: func() {
+				mu.Lock()
+				defer mu.Unlock()
+				closed++
+			}}, nil
+		}
+	}
+	run := func(n int) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		consumer := reflex.NewConsumer("priority", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			consumed = append(consumed, e.ForeignID+e.ID)
+			if len(consumed) == n {
+				cancel()
+			}
+			return nil
+		})
+
+		err := rpatterns.RunPriority(ctx, closing(high.Stream), closing(low.Stream), cstore, consumer,
+			rpatterns.WithPriorityRatio(2))
+		jtest.Require(t, context.Canceled, err)
+	}
+
+	run(8)
+	require.Equal(t, 2, closed)
+	require.Len(t, consumed, 8)
+	require.ElementsMatch(t, []string{"high1", "high2", "high3", "high4", "high5",
+		"low1", "low2", "low3"}, consumed)
+
+	for name, exp := range map[string]string{"priority_high": "5", "priority_low": "3"} {
+		c, err := cstore.GetCursor(context.Background(), name)
+		require.NoError(t, err)
+		require.Equal(t, exp, c)
+	}
+
+	// Restarts from the cursors.
+	high.Insert("high", testEventType(1))
+	consumed = nil
+	run(1)
+	require.Equal(t, []string{"high6"}, consumed)
+
+	// Runs are registered for health checks.
+	var found bool
+	for _, h := range reflex.Health() {
+		if h.Name == "priority" {
+			found = true
+			require.False(t, h.LastConsumed.IsZero())
+		}
+	}
+	require.True(t, found)
+}
+
+type closingClient struct {
+	reflex.StreamClient
+	close func()
+}
+
+func (c *closingClient) Close() error {
+	c.close()
+	return nil
+}
@@ -15,20 +15,20 @@ import (
 
 // RunForever continuously calls the run function, backing off
 // and logging on unexpected errors.
-func RunForever(getCtx func() context.Context, req reflex.Spec) {
+func RunForever(getCtx func() context.Context, req reflex.Spec, opts ...reflex.RunOption) {
 	for {
 		ctx := getCtx()
 
-		err := reflex.Run(ctx, req)
+		err := reflex.Run(ctx, req, opts...)
 		if isExpected(err) {
 			// Just retry on expected errors.
-			time.Sleep(time.Millisecond * 100) // Don't spin
+			_ = reflex.RunBackoff(ctx, req, time.Millisecond*100) // Don't spin
 			continue
 		}
 
 		log.Error(ctx, errors.Wrap(err, "run forever error"),
 			j.KS("consumer", req.Name()))
-		time.Sleep(time.Minute) // 1 min backoff on errors
+		_ = reflex.RunBackoff(ctx, req, time.Minute) // 1 min backoff on errors
 	}
 }
 
@@ -0,0 +1,139 @@
+package rpatterns
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+var (
+	// ErrUnknownVersion is returned when decoding a payload with a
+	// version greater than the latest version, e.g. if producers are
+	// deployed before consumers.
+	ErrUnknownVersion = errors.New("unknown payload version", j.C("ERR_4c8e21b7f09a6d53"))
+
+	// ErrMissingUpgrade is returned when decoding a payload that cannot
+	// be upgraded to the latest version.
+	ErrMissingUpgrade = errors.New("missing payload upgrade", j.C("ERR_b39f0d6a15e7c248"))
+)
+
+// versionMagic prefixes versioned payloads followed by the uvarint version.
+// Payloads without it are version 1, so versioning can be introduced
+// without migrating existing events.
+var versionMagic = []byte{0x00, 0x76}
+
+// UpgradeFunc upgrades a payload from one version to the next.
+type UpgradeFunc func(payload []byte) ([]byte, error)
+
+// NewVersions returns a new versioned payload codec with the latest
+// version. Register upgrade functions from each previous version with
+// Upgrade so old events can still be decoded after payload schema changes.
+//
+//	v := rpatterns.NewVersions(3).
+//		Upgrade(1, upgradeV1ToV2).
+//		Upgrade(2, upgradeV2ToV3)
+func NewVersions(latest int) *Versions {
+	return &Versions{
+		latest:   latest,
+		upgrades: make(map[int]UpgradeFunc),
+	}
+}
+
+// Versions encodes payloads with the latest version and decodes
+// payloads of any version by upgrading them to the latest version.
+type Versions struct {
+	latest   int
+	upgrades map[int]UpgradeFunc
+}
+
+// Upgrade adds the function upgrading payloads from the version to the
+// next version. It returns the versions to allow chaining.
+func (v *Versions) Upgrade(from int, fn UpgradeFunc) *Versions {
+	v.upgrades[from] = fn
+	return v
+}
+
+// Latest returns the latest version.
+func (v *Versions) Latest() int {
+	return v.latest
+}
+
+// Encode returns the payload encoded with the latest version
+// for inserting as event metadata.
+func (v *Versions) Encode(payload []byte) []byte {
+	return EncodeVersion(v.latest, payload)
+}
+
+// Decode returns the payload of the event metadata upgraded to the latest version.
+func (v *Versions) Decode(metadata []byte) ([]byte, error) {
+	version, payload, err := DecodeVersion(metadata)
+	if err != nil {
+		return nil, err
+	} else if version > v.latest {
+		return nil, errors.Wrap(ErrUnknownVersion, "",
+			j.MKV{"version": version, "latest": v.latest})
+	}
+
+	for ; version < v.latest; version++ {
+		fn, ok := v.upgrades[version]
+		if !ok {
+			return nil, errors.Wrap(ErrMissingUpgrade, "", j.KV("from", version))
+		}
+
+		payload, err = fn(payload)
+		if err != nil {
+			return nil, errors.Wrap(err, "upgrade error", j.KV("from", version))
+		}
+	}
+
+	return payload, nil
+}
+
+// EncodeVersion returns the payload prefixed with the version header.
+func EncodeVersion(version int, payload []byte) []byte {
+	res := make([]byte, len(versionMagic)+binary.MaxVarintLen64, len(versionMagic)+
+		binary.MaxVarintLen64+len(payload))
+	copy(res, versionMagic)
+	n := binary.PutUvarint(res[len(versionMagic):], uint64(version))
+	return append(res[:len(versionMagic)+n], payload...)
+}
+
+// DecodeVersion returns the version and the payload of the metadata.
+// Metadata without the version header is version 1.
+func DecodeVersion(metadata []byte) (int, []byte, error) {
+	if !bytes.HasPrefix(metadata, versionMagic) {
+		return 1, metadata, nil
+	}
+
+	version, n := binary.Uvarint(metadata[len(versionMagic):])
+	if n <= 0 {
+		return 0, nil, errors.New("invalid payload version header")
+	}
+
+	return int(version), metadata[len(versionMagic)+n:], nil
+}
+
+// VersionedConsumeFunc is called with the event and its payload
+// upgraded to the latest version.
+type VersionedConsumeFunc func(ctx context.Context, f fate.Fate, e *reflex.Event,
+	payload []byte) error
+
+// NewVersionedConsumer returns a reflex consumer that decodes event metadata
+// with the versions and calls fn with the payload upgraded to the latest version.
+func NewVersionedConsumer(name string, v *Versions, fn VersionedConsumeFunc,
+	opts ...reflex.ConsumerOption) reflex.Consumer {
+
+	return reflex.NewConsumer(name, func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+		payload, err := v.Decode(e.MetaData)
+		if err != nil {
+			return errors.Wrap(err, "decode payload error", j.KS("event_id", e.ID))
+		}
+
+		return fn(ctx, f, e, payload)
+	}, opts...)
+}
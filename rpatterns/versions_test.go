@@ -0,0 +1,87 @@
+package rpatterns_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/stretchr/testify/require"
+)
+
+type userV3 struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+func TestVersions(t *testing.T) {
+	v := rpatterns.NewVersions(3).
+		Upgrade(1, func(payload []byte) ([]byte, error) {
+			// v1 -> v2: split name.
+			var v1 struct{ Name string }
+			if err := json.Unmarshal(payload, &v1); err != nil {
+				return nil, err
+			}
+			return json.Marshal(map[string]string{"first_name": v1.Name, "last_name": ""})
+		}).
+		Upgrade(2, func(payload []byte) ([]byte, error) {
+			// v2 -> v3: add email.
+			var u userV3
+			if err := json.Unmarshal(payload, &u); err != nil {
+				return nil, err
+			}
+			u.Email = "unknown"
+			return json.Marshal(u)
+		})
+
+	events := []*reflex.Event{
+		{ID: "1", MetaData: []byte(`{"Name":"john"}`)}, // Unversioned is v1.
+		{ID: "2", MetaData: rpatterns.EncodeVersion(2, []byte(`{"first_name":"jane","last_name":"doe"}`))},
+		{ID: "3", MetaData: v.Encode([]byte(`{"first_name":"joe","last_name":"soap","email":"joe@soap"}`))},
+	}
+
+	var res []userV3
+	c := rpatterns.NewVersionedConsumer("test", v,
+		func(ctx context.Context, f fate.Fate, e *reflex.Event, payload []byte) error {
+			var u userV3
+			if err := json.Unmarshal(payload, &u); err != nil {
+				return err
+			}
+			res = append(res, u)
+			return nil
+		})
+
+	for _, e := range events {
+		jtest.RequireNil(t, c.Consume(context.Background(), fate.New(), e))
+	}
+
+	require.Equal(t, []userV3{
+		{FirstName: "john", Email: "unknown"},
+		{FirstName: "jane", LastName: "doe", Email: "unknown"},
+		{FirstName: "joe", LastName: "soap", Email: "joe@soap"},
+	}, res)
+
+	_, err := v.Decode(rpatterns.EncodeVersion(4, nil))
+	jtest.Require(t, rpatterns.ErrUnknownVersion, err)
+
+	_, err = rpatterns.NewVersions(3).Upgrade(2, nil).Decode(nil)
+	jtest.Require(t, rpatterns.ErrMissingUpgrade, err)
+}
+
+func TestEncodeVersion(t *testing.T) {
+	for _, v := range []int{1, 2, 127, 128, 1 << 20} {
+		version, payload, err := rpatterns.DecodeVersion(rpatterns.EncodeVersion(v, []byte("payload")))
+		jtest.RequireNil(t, err)
+		require.Equal(t, v, version)
+		require.Equal(t, "payload", string(payload))
+	}
+
+	version, payload, err := rpatterns.DecodeVersion([]byte("payload"))
+	jtest.RequireNil(t, err)
+	require.Equal(t, 1, version)
+	require.Equal(t, "payload", string(payload))
+}
@@ -0,0 +1,160 @@
+package rpatterns
+
+import (
+	"context"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+const (
+	defaultWarehouseBatchPeriod = time.Second
+	defaultWarehouseBatchLen    = 500
+)
+
+// WarehouseRow is a row of a warehouse table.
+type WarehouseRow struct {
+	// InsertID uniquely identifies the row for deduplication of retried
+	// inserts, e.g. as BigQuery insertId. It is "<sink>-<event ID>".
+	InsertID string
+
+	// Values are the row values by column.
+	Values map[string]interface{}
+}
+
+// WarehouseInserter inserts rows into warehouse tables, e.g. using the
+// BigQuery streaming insert API with bigquery.Uploader. Inserts are retried
+// with the same insert IDs on error, so inserters should deduplicate rows
+// by insert ID, e.g. by passing it as the BigQuery insertId.
+type WarehouseInserter interface {
+	Insert(ctx context.Context, table string, rows []WarehouseRow) error
+}
+
+// WarehouseRowFunc maps an event to the row values of a warehouse table,
+// e.g. by unmarshalling the typed proto payload of the event type.
+type WarehouseRowFunc func(e *reflex.Event) (map[string]interface{}, error)
+
+// DefaultWarehouseRow maps events to rows of the event fields: id, foreign_id,
+// type, timestamp and metadata.
+func DefaultWarehouseRow(e *reflex.Event) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"id":         e.ID,
+		"foreign_id": e.ForeignID,
+		"type":       e.Type.ReflexType(),
+		"timestamp":  e.Timestamp,
+		"metadata":   e.MetaData,
+	}, nil
+}
+
+// WarehouseOption defines a functional option to configure NewWarehouseSink.
+type WarehouseOption func(*warehouseSink)
+
+// WithWarehouseType provides an option to map events of the type to rows of
+// the table with the function. Events of types without mappings are skipped.
+// If no types are mapped, all events are mapped with DefaultWarehouseRow
+// into a table named after the sink.
+func WithWarehouseType(typ reflex.EventType, table string, fn WarehouseRowFunc) WarehouseOption {
+	return func(s *warehouseSink) {
+		s.types[typ.ReflexType()] = warehouseMapping{table: table, fn: fn}
+	}
+}
+
+// WithWarehouseBatch provides an option to set the micro-batching of inserts.
+// Batches are inserted when either the period since the first event or the
+// number of events is reached. It defaults to 1s and 500 events.
+func WithWarehouseBatch(period time.Duration, n int) WarehouseOption {
+	return func(s *warehouseSink) {
+		s.batchPeriod = period
+		s.batchLen = n
+	}
+}
+
+// WithWarehouseStreamOpts provides an option to set the stream options
+// of the sink.
+func WithWarehouseStreamOpts(opts ...reflex.StreamOption) WarehouseOption {
+	return func(s *warehouseSink) {
+		s.streamOpts = opts
+	}
+}
+
+type warehouseMapping struct {
+	table string
+	fn    WarehouseRowFunc
+}
+
+type warehouseSink struct {
+	name        string
+	inserter    WarehouseInserter
+	types       map[int]warehouseMapping
+	batchPeriod time.Duration
+	batchLen    int
+	streamOpts  []reflex.StreamOption
+}
+
+// NewWarehouseSink returns a reflex spec that inserts the events of the stream
+// into warehouse tables, e.g. BigQuery, in micro-batches, see
+// WithWarehouseBatch. Events are mapped to rows by type, see
+// WithWarehouseType. The cursor is updated after all rows of a batch are
+// inserted. If an insert fails, the stream is restarted from the cursor and
+// the events are inserted again with the same insert IDs, so retries are
+// safe if the inserter deduplicates rows by insert ID.
+func NewWarehouseSink(stream reflex.StreamFunc, cstore reflex.CursorStore, name string,
+	inserter WarehouseInserter, opts ...WarehouseOption) reflex.Spec {
+
+	s := &warehouseSink{
+		name:        name,
+		inserter:    inserter,
+		types:       make(map[int]warehouseMapping),
+		batchPeriod: defaultWarehouseBatchPeriod,
+		batchLen:    defaultWarehouseBatchLen,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	bc := NewBatchConsumer(name, cstore, s.insert, s.batchPeriod, s.batchLen)
+	return NewBatchSpec(stream, bc, s.streamOpts...)
+}
+
+// insert maps the events of the batch to rows and inserts the rows
+// of each table.
+func (s *warehouseSink) insert(ctx context.Context, f fate.Fate, batch Batch) error {
+	var (
+		tables []string
+		rows   = make(map[string][]WarehouseRow)
+	)
+	for _, e := range batch {
+		m, ok := s.types[e.Type.ReflexType()]
+		if len(s.types) == 0 {
+			m, ok = warehouseMapping{table: s.name, fn: DefaultWarehouseRow}, true
+		}
+		if !ok {
+			continue
+		}
+
+		values, err := m.fn(e)
+		if err != nil {
+			return errors.Wrap(err, "map row error", j.KS("event_id", e.ID))
+		}
+
+		if _, ok := rows[m.table]; !ok {
+			tables = append(tables, m.table)
+		}
+		rows[m.table] = append(rows[m.table], WarehouseRow{
+			InsertID: s.name + "-" + e.ID,
+			Values:   values,
+		})
+	}
+
+	for _, table := range tables {
+		if err := s.inserter.Insert(ctx, table, rows[table]); err != nil {
+			return errors.Wrap(err, "insert rows error",
+				j.MKV{"table": table, "rows": len(rows[table])})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package rpatterns_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+type warehouse struct {
+	mu   sync.Mutex
+	fail int
+	rows map[string]rpatterns.WarehouseRow
+}
+
+func (w *warehouse) Insert(ctx context.Context, table string, rows []rpatterns.WarehouseRow) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, r := range rows {
+		w.rows[table+"/"+r.InsertID] = r
+	}
+	if w.fail > 0 {
+		w.fail--
+		return errors.New("load error")
+	}
+	return nil
+}
+
+func (w *warehouse) snapshot() map[string]rpatterns.WarehouseRow {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	res := make(map[string]rpatterns.WarehouseRow)
+	for k, v := range w.rows {
+		res[k] = v
+	}
+	return res
+}
+
+func TestWarehouseSink(t *testing.T) {
+	table := rtest.NewEventsTable()
+	for i := 0; i < 5; i++ {
+		table.Insert("user", testEventType(1))
+	}
+	table.Insert("other", testEventType(2))
+
+	cstore := rtest.NewCursorStore()
+	w := &warehouse{fail: 1, rows: make(map[string]rpatterns.WarehouseRow)}
+
+	spec := rpatterns.NewWarehouseSink(table.Stream, cstore, "sink", w,
+		rpatterns.WithWarehouseBatch(time.Millisecond, 2),
+		rpatterns.WithWarehouseType(testEventType(1), "users",
+			func(e *reflex.Event) (map[string]interface{}, error) {
+				return map[string]interface{}{"user": e.ForeignID + e.ID}, nil
+			}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The first run fails on the first batch, the second run retries it.
+	require.Error(t, reflex.Run(ctx, spec))
+	go reflex.Run(ctx, spec)
+
+	require.Eventually(t, func() bool {
+		return cstore.Cursor("sink") == "6"
+	}, 5*time.Second, time.Millisecond)
+
+	// Retried rows have the same insert IDs, other types are skipped.
+	rows := w.snapshot()
+	require.Len(t, rows, 5)
+	require.Equal(t, map[string]interface{}{"user": "user3"}, rows["users/sink-3"].Values)
+}
@@ -0,0 +1,270 @@
+package rpatterns
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+	"github.com/luno/reflex"
+)
+
+const (
+	defaultWebhookRetries    = 5
+	defaultWebhookBackoff    = time.Second
+	defaultWebhookMaxBackoff = time.Minute
+	defaultWebhookTimeout    = 10 * time.Second
+
+	// maxDeliveryError is the maximum length of recorded delivery errors.
+	maxDeliveryError = 255
+
+	// maxWebhookDrain is the maximum number of response body bytes read
+	// to allow connection reuse.
+	maxWebhookDrain = 4 << 10
+)
+
+// Webhook request headers.
+const (
+	WebhookEventIDHeader   = "X-Reflex-Event-Id"
+	WebhookTimestampHeader = "X-Reflex-Timestamp"
+	WebhookSignatureHeader = "X-Reflex-Signature"
+)
+
+// WebhookEndpoint defines an endpoint that events are delivered to.
+type WebhookEndpoint struct {
+	// Name identifies the endpoint. The endpoint's cursor is
+	// named "webhook_<name>".
+	Name string
+
+	URL string
+
+	// Secret is the HMAC signing key of the endpoint.
+	Secret []byte
+}
+
+// WebhookPayload is the JSON request body of a webhook delivery.
+type WebhookPayload struct {
+	ID          string            `json:"id"`
+	ForeignID   string            `json:"foreign_id"`
+	Type        int               `json:"type"`
+	Timestamp   time.Time         `json:"timestamp"`
+	MetaData    []byte            `json:"metadata,omitempty"`
+	TenantID    string            `json:"tenant_id,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ForeignKeys map[string]string `json:"foreign_keys,omitempty"`
+}
+
+// WebhookSignature returns the signature of the webhook request body with
+// the timestamp header value. It is the hex encoded HMAC-SHA256 of
+// "<timestamp>.<body>" prefixed with "sha256=". Receivers should compare it
+// with the signature header using hmac.Equal and reject old timestamps.
+func WebhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookOption defines a functional option to configure NewWebhookSpec.
+type WebhookOption func(*webhookOptions)
+
+type webhookOptions struct {
+	client     *http.Client
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	deliveries reflex.DeliveryStore
+	skipFailed bool
+	streamOpts []reflex.StreamOption
+}
+
+// WithWebhookClient provides an option to set the HTTP client.
+// It defaults to a client with a 10s timeout.
+func WithWebhookClient(c *http.Client) WebhookOption {
+	return func(o *webhookOptions) {
+		o.client = c
+	}
+}
+
+// WithWebhookRetries provides an option to set the number of retries of
+// failed deliveries and the initial backoff which doubles after each retry
+// up to one minute. It defaults to 5 retries and 1s.
+func WithWebhookRetries(n int, backoff time.Duration) WebhookOption {
+	return func(o *webhookOptions) {
+		o.retries = n
+		o.backoff = backoff
+	}
+}
+
+// WithWebhookDeliveries provides an option to record the status of each
+// delivery in the store, e.g. an rsql.DeliveriesTable.
+func WithWebhookDeliveries(store reflex.DeliveryStore) WebhookOption {
+	return func(o *webhookOptions) {
+		o.deliveries = store
+	}
+}
+
+// WithWebhookSkipFailed provides an option to record deliveries that failed
+// after all retries or with a non-retryable response (e.g. 400) as failed
+// and skip them, instead of returning the error, so a broken endpoint
+// doesn't block delivery of later events. Skipped events are not redelivered,
+// so use it with WithWebhookDeliveries to track them.
+func WithWebhookSkipFailed() WebhookOption {
+	return func(o *webhookOptions) {
+		o.skipFailed = true
+	}
+}
+
+// WithWebhookStreamOpts provides an option to set the stream options,
+// e.g. reflex.WithStreamTypes to only deliver some events.
+func WithWebhookStreamOpts(opts ...reflex.StreamOption) WebhookOption {
+	return func(o *webhookOptions) {
+		o.streamOpts = opts
+	}
+}
+
+// NewWebhookSpec returns a reflex spec that POSTs each event as a JSON
+// WebhookPayload to the endpoint. Requests are signed with the endpoint
+// secret, see WebhookSignature. Each endpoint has its own cursor, so run a
+// spec per endpoint to deliver to multiple endpoints independently.
+//
+// Deliveries are retried with backoff on errors, 429 and 5xx responses. Other
+// responses (e.g. 400) and deliveries that fail after all retries are
+// recorded as failed and returned as errors, so reflex.Run backs off and
+// the event is retried, see WithWebhookSkipFailed to skip them instead.
+// Delivery is at-least-once, so receivers should deduplicate events by the
+// event ID header.
+func NewWebhookSpec(stream reflex.StreamFunc, cstore reflex.CursorStore,
+	ep WebhookEndpoint, opts ...WebhookOption) reflex.Spec {
+
+	o := webhookOptions{
+		client:     &http.Client{Timeout: defaultWebhookTimeout},
+		retries:    defaultWebhookRetries,
+		backoff:    defaultWebhookBackoff,
+		maxBackoff: defaultWebhookMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	w := &webhook{ep: ep, o: o}
+	consumer := reflex.NewConsumer("webhook_"+ep.Name, w.consume)
+
+	return reflex.NewSpec(stream, cstore, consumer, o.streamOpts...)
+}
+
+type webhook struct {
+	ep WebhookEndpoint
+	o  webhookOptions
+}
+
+func (w *webhook) consume(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+	body, err := json.Marshal(WebhookPayload{
+		ID:          e.ID,
+		ForeignID:   e.ForeignID,
+		Type:        e.Type.ReflexType(),
+		Timestamp:   e.Timestamp,
+		MetaData:    e.MetaData,
+		TenantID:    e.TenantID,
+		Headers:     e.Headers,
+		ForeignKeys: e.ForeignKeys,
+	})
+	if err != nil {
+		return err
+	}
+
+	d := reflex.Delivery{Endpoint: w.ep.Name, EventID: e.ID}
+	backoff := w.o.backoff
+	for {
+		d.Attempts++
+
+		var retry bool
+		d.StatusCode, retry, err = w.post(ctx, e, body)
+		if err == nil {
+			d.Status = reflex.DeliverySucceeded
+			break
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		} else if !retry || d.Attempts > w.o.retries {
+			err = errors.Wrap(err, "webhook delivery failed",
+				j.MKS{"endpoint": w.ep.Name, "event_id": e.ID})
+			d.Status = reflex.DeliveryFailed
+			d.Error = err.Error()
+			if len(d.Error) > maxDeliveryError {
+				d.Error = d.Error[:maxDeliveryError]
+			}
+			break
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		backoff *= 2
+		if backoff > w.o.maxBackoff {
+			backoff = w.o.maxBackoff
+		}
+	}
+
+	if w.o.deliveries != nil {
+		d.UpdatedAt = time.Now()
+		if err := w.o.deliveries.RecordDelivery(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	if d.Status != reflex.DeliveryFailed {
+		return nil
+	} else if w.o.skipFailed {
+		log.Error(ctx, err)
+		return nil
+	}
+
+	return err
+}
+
+// post posts the signed body to the endpoint and returns the response
+// status code and whether the request should be retried on error.
+func (w *webhook) post(ctx context.Context, e *reflex.Event, body []byte) (int, bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventIDHeader, e.ID)
+	req.Header.Set(WebhookTimestampHeader, ts)
+	req.Header.Set(WebhookSignatureHeader, WebhookSignature(w.ep.Secret, ts, body))
+
+	resp, err := w.o.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, true, errors.Wrap(err, "webhook request error")
+	}
+	defer resp.Body.Close()
+	io.CopyN(ioutil.Discard, resp.Body, maxWebhookDrain) // Allow connection reuse.
+
+	code := resp.StatusCode
+	if code >= 200 && code < 300 {
+		return code, false, nil
+	}
+
+	retry := code == http.StatusTooManyRequests || code >= 500
+	return code, retry, errors.New("webhook response error", j.KV("status", code))
+}
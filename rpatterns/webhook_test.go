@@ -0,0 +1,105 @@
+package rpatterns_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSpec(t *testing.T) {
+	secret := []byte("secret")
+
+	var (
+		mu       sync.Mutex
+		received []string
+		calls    int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		sig := rpatterns.WebhookSignature(secret, r.Header.Get(rpatterns.WebhookTimestampHeader), body)
+		if !hmac.Equal([]byte(sig), []byte(r.Header.Get(rpatterns.WebhookSignatureHeader))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var p rpatterns.WebhookPayload
+		require.NoError(t, json.Unmarshal(body, &p))
+		require.Equal(t, p.ID, r.Header.Get(rpatterns.WebhookEventIDHeader))
+
+		calls++
+		switch {
+		case p.ForeignID == "bad":
+			w.WriteHeader(http.StatusBadRequest)
+		case calls == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			received = append(received, p.ID)
+		}
+	}))
+	defer srv.Close()
+
+	table := rtest.NewEventsTable()
+	table.Insert("a", testEventType(1))
+	table.Insert("bad", testEventType(1))
+	table.Insert("c", testEventType(1))
+
+	cstore := rtest.NewCursorStore()
+	deliveries := rtest.NewDeliveryStore()
+
+	newSpec := func(opts ...rpatterns.WebhookOption) reflex.Spec {
+		return rpatterns.NewWebhookSpec(table.Stream, cstore,
+			rpatterns.WebhookEndpoint{Name: "hook", URL: srv.URL, Secret: secret},
+			append([]rpatterns.WebhookOption{
+				rpatterns.WithWebhookRetries(3, time.Millisecond),
+				rpatterns.WithWebhookDeliveries(deliveries),
+				rpatterns.WithWebhookStreamOpts(reflex.WithStreamToHead()),
+			}, opts...)...)
+	}
+
+	// The first event is retried and the bad event fails closed.
+	err := reflex.Run(context.Background(), newSpec())
+	require.Error(t, err)
+	require.False(t, reflex.IsHeadReachedErr(err))
+	require.Equal(t, "1", cstore.Cursor("webhook_hook"))
+	require.Equal(t, []string{"1"}, received)
+
+	d, ok := deliveries.Delivery("hook", "1")
+	require.True(t, ok)
+	require.Equal(t, reflex.DeliverySucceeded, d.Status)
+	require.Equal(t, 2, d.Attempts)
+	require.Equal(t, http.StatusOK, d.StatusCode)
+
+	d, ok = deliveries.Delivery("hook", "2")
+	require.True(t, ok)
+	require.Equal(t, reflex.DeliveryFailed, d.Status)
+	require.Equal(t, 1, d.Attempts)
+	require.Equal(t, http.StatusBadRequest, d.StatusCode)
+	require.NotEmpty(t, d.Error)
+
+	// The bad event is skipped if enabled.
+	err = reflex.Run(context.Background(), newSpec(rpatterns.WithWebhookSkipFailed()))
+	jtest.Require(t, reflex.ErrHeadReached, err)
+	require.Equal(t, "3", cstore.Cursor("webhook_hook"))
+	require.Equal(t, []string{"1", "3"}, received)
+
+	d, ok = deliveries.Delivery("hook", "2")
+	require.True(t, ok)
+	require.Equal(t, reflex.DeliveryFailed, d.Status)
+}
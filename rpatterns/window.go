@@ -0,0 +1,326 @@
+package rpatterns
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+)
+
+const defaultWindowIdle = time.Second * 10
+
+// Window is a time window of events by event timestamp.
+type Window struct {
+	// Start is the inclusive start of the window.
+	Start time.Time
+
+	// End is the exclusive end of the window.
+	End time.Time
+
+	// Events of the window in stream order.
+	Events []*reflex.Event
+}
+
+// WindowOption defines a functional option to configure windowed consumers.
+type WindowOption func(*WindowedConsumer)
+
+// WithWindowSlide provides an option to configure sliding windows that start
+// every slide duration, so events belong to multiple overlapping windows.
+// It defaults to the window size; ie. tumbling windows.
+func WithWindowSlide(d time.Duration) WindowOption {
+	return func(c *WindowedConsumer) {
+		c.slide = d
+	}
+}
+
+// WithWindowLateness provides an option to set the allowed lateness of events.
+// Windows are only closed once the watermark (the latest event timestamp
+// minus the lateness) passes their end. Events of closed windows are dropped.
+// It defaults to zero.
+func WithWindowLateness(d time.Duration) WindowOption {
+	return func(c *WindowedConsumer) {
+		c.lateness = d
+	}
+}
+
+// WithWindowIdle provides an option to set the duration after which an idle
+// stream is assumed to be at the head and the watermark is advanced to
+// the current time (minus the lateness). Zero disables advancing the
+// watermark at the head. It defaults to 10s.
+func WithWindowIdle(d time.Duration) WindowOption {
+	return func(c *WindowedConsumer) {
+		c.idle = d
+	}
+}
+
+// WithWindowConsumerOpts provides an option to set the reflex consumer options.
+func WithWindowConsumerOpts(opts ...reflex.ConsumerOption) WindowOption {
+	return func(c *WindowedConsumer) {
+		c.opts = append(c.opts, opts...)
+	}
+}
+
+// NewWindowedConsumer returns a new consumer that groups events into time
+// windows of the size by event timestamp and calls flush with each window
+// when it closes, e.g. to compute rolling aggregates. Empty windows are not
+// flushed. Use NewWindowedSpec to run it.
+func NewWindowedConsumer(name string, cstore reflex.CursorStore, size time.Duration,
+	flush func(context.Context, fate.Fate, Window) error, opts ...WindowOption) *WindowedConsumer {
+
+	c := &WindowedConsumer{
+		name:    name,
+		cstore:  newRunStore(cstore),
+		size:    size,
+		slide:   size,
+		idle:    defaultWindowIdle,
+		flush:   flush,
+		windows: make(map[int64]*Window),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// WindowedConsumer groups events into tumbling or sliding time windows. The
+// cursor is only updated once all the windows of an event have been flushed,
+// so windows are flushed at-least-once.
+//
+// This consumer is stateful and implements the resetter interface to clear
+// its state when the stream is restarted from the cursor.
+type WindowedConsumer struct {
+	name     string
+	cstore   reflex.CursorStore
+	size     time.Duration
+	slide    time.Duration
+	lateness time.Duration
+	idle     time.Duration
+	flush    func(context.Context, fate.Fate, Window) error
+	opts     []reflex.ConsumerOption
+
+	mu        sync.Mutex
+	windows   map[int64]*Window // Keyed by start unix nanos.
+	watermark time.Time
+	pending   []pendingEvent
+}
+
+// pendingEvent is an event with not yet flushed windows.
+type pendingEvent struct {
+	id  string
+	end time.Time // End of the event's last window.
+}
+
+// Name returns the consumer name.
+func (c *WindowedConsumer) Name() string {
+	return c.name
+}
+
+// Reset clears the windows and watermark.
+func (c *WindowedConsumer) Reset() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.windows = make(map[int64]*Window)
+	c.watermark = time.Time{}
+	c.pending = nil
+	return nil
+}
+
+// Consume adds the event to its windows and flushes all the closed windows.
+func (c *WindowedConsumer) Consume(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+	if c.size <= 0 || c.slide <= 0 || c.slide > c.size {
+		return errors.New("invalid window size or slide")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if isWatermarkTick(e) {
+		c.advance(e.Timestamp.Add(-c.lateness))
+	} else {
+		c.add(e)
+		c.advance(e.Timestamp.Add(-c.lateness))
+	}
+
+	return c.closeWindows(ctx, f)
+}
+
+// add adds the event to all its windows that are not closed.
+func (c *WindowedConsumer) add(e *reflex.Event) {
+	ts := e.Timestamp.UnixNano()
+	last := ts - mod(ts, int64(c.slide))
+	end := time.Unix(0, last+int64(c.size))
+
+	if !end.After(c.watermark) {
+		// All windows closed, drop late event.
+		return
+	}
+
+	for start := last; start+int64(c.size) > ts; start -= int64(c.slide) {
+		end := time.Unix(0, start+int64(c.size))
+		if !end.After(c.watermark) {
+			// Window already closed.
+			continue
+		}
+
+		w, ok := c.windows[start]
+		if !ok {
+			w = &Window{Start: time.Unix(0, start), End: end}
+			c.windows[start] = w
+		}
+		w.Events = append(w.Events, e)
+	}
+
+	c.pending = append(c.pending, pendingEvent{id: e.ID, end: end})
+}
+
+func (c *WindowedConsumer) advance(watermark time.Time) {
+	if watermark.After(c.watermark) {
+		c.watermark = watermark
+	}
+}
+
+// closeWindows flushes the windows ending before the watermark in order
+// and acks the last event of which all windows are flushed.
+func (c *WindowedConsumer) closeWindows(ctx context.Context, f fate.Fate) error {
+	var starts []int64
+	for start, w := range c.windows {
+		if !w.End.After(c.watermark) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i] < starts[j]
+	})
+
+	for _, start := range starts {
+		w := c.windows[start]
+		if len(w.Events) > 0 {
+			if err := c.flush(ctx, f, *w); err != nil {
+				return err
+			}
+		}
+		delete(c.windows, start)
+	}
+
+	var ack string
+	for len(c.pending) > 0 && !c.pending[0].end.After(c.watermark) {
+		ack = c.pending[0].id
+		c.pending = c.pending[1:]
+	}
+	if ack == "" {
+		return nil
+	}
+
+	if err := c.cstore.SetCursor(ctx, c.name, ack); err != nil {
+		return err
+	}
+	return c.cstore.Flush(ctx)
+}
+
+// NewWindowedSpec returns a reflex spec for the WindowedConsumer.
+func NewWindowedSpec(stream reflex.StreamFunc, wc *WindowedConsumer,
+	opts ...reflex.StreamOption) reflex.Spec {
+
+	c := &windowConsumer{
+		Consumer: reflex.NewConsumer(wc.name, wc.Consume, wc.opts...),
+		wc:       wc,
+	}
+
+	if wc.idle > 0 {
+		stream = idleStream(stream, wc.idle)
+	}
+
+	return reflex.NewSpec(stream, &noSetStore{wc.cstore}, c, opts...)
+}
+
+// windowConsumer resets the windowed consumer at the start of each run and
+// consumes watermark ticks directly, bypassing the consumer metrics and
+// options, since ticks aren't events.
+type windowConsumer struct {
+	reflex.Consumer
+	wc *WindowedConsumer
+}
+
+func (c *windowConsumer) Consume(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+	if isWatermarkTick(e) {
+		return c.wc.Consume(ctx, f, e)
+	}
+	return c.Consumer.Consume(ctx, f, e)
+}
+
+func (c *windowConsumer) Reset() error {
+	return c.wc.Reset()
+}
+
+// isWatermarkTick returns true if the event is a synthetic watermark tick
+// streamed by idleStream. Note that ticks don't have IDs.
+func isWatermarkTick(e *reflex.Event) bool {
+	return e.ID == ""
+}
+
+// idleStream returns a stream that streams watermark ticks with
+// the current time if the stream is idle (at the head).
+func idleStream(stream reflex.StreamFunc, idle time.Duration) reflex.StreamFunc {
+	return func(ctx context.Context, after string,
+		opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+
+		sc, err := stream(ctx, after, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		return &tickStream{
+			sc:     sc,
+			ctx:    ctx,
+			cancel: cancel,
+			idle:   idle,
+			ch:     recvChan(ctx, sc),
+		}, nil
+	}
+}
+
+type tickStream struct {
+	sc     reflex.StreamClient
+	ctx    context.Context
+	cancel context.CancelFunc
+	idle   time.Duration
+	ch     <-chan recvResult
+}
+
+func (s *tickStream) Recv() (*reflex.Event, error) {
+	t := time.NewTimer(s.idle)
+	defer t.Stop()
+
+	select {
+	case res := <-s.ch:
+		return res.e, res.err
+	case <-t.C:
+		return &reflex.Event{Timestamp: time.Now()}, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func (s *tickStream) Close() error {
+	s.cancel()
+	if closer, ok := s.sc.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// mod returns the non-negative modulus.
+func mod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
@@ -0,0 +1,110 @@
+package rpatterns_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowedConsumer(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		offsets []time.Duration
+		opts    []rpatterns.WindowOption
+		windows [][]string
+		cursor  string
+	}{
+		{
+			name:    "tumbling",
+			offsets: []time.Duration{0, 30 * time.Second, 70 * time.Second, 130 * time.Second},
+			windows: [][]string{{"1", "2"}, {"3"}, {"4"}},
+			cursor:  "4",
+		}, {
+			name:    "sliding",
+			offsets: []time.Duration{10 * time.Second, 40 * time.Second},
+			opts:    []rpatterns.WindowOption{rpatterns.WithWindowSlide(30 * time.Second)},
+			windows: [][]string{{"1"}, {"1", "2"}, {"2"}},
+			cursor:  "2",
+		}, {
+			name:    "late event dropped",
+			offsets: []time.Duration{0, 70 * time.Second, 30 * time.Second},
+			windows: [][]string{{"1"}, {"2"}},
+			cursor:  "2",
+		}, {
+			name:    "late event allowed",
+			offsets: []time.Duration{0, 70 * time.Second, 30 * time.Second},
+			opts:    []rpatterns.WindowOption{rpatterns.WithWindowLateness(20 * time.Second)},
+			windows: [][]string{{"1", "3"}, {"2"}},
+			cursor:  "3",
+		}, {
+			name:    "type metric labels",
+			offsets: []time.Duration{0, 70 * time.Second},
+			opts: []rpatterns.WindowOption{rpatterns.WithWindowConsumerOpts(
+				reflex.WithTypeMetricLabels(testEventType(1)))},
+			windows: [][]string{{"1"}, {"2"}},
+			cursor:  "2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				offset time.Duration
+				mu     sync.Mutex
+				res    [][]string
+			)
+			table := rtest.NewEventsTable(rtest.WithClock(func() time.Time {
+				return t0.Add(offset)
+			}))
+			for _, o := range test.offsets {
+				offset = o
+				table.Insert("1", testEventType(1))
+			}
+
+			cstore := rtest.NewCursorStore()
+			flush := func(ctx context.Context, f fate.Fate, w rpatterns.Window) error {
+				mu.Lock()
+				defer mu.Unlock()
+				require.Equal(t, w.Start.Add(time.Minute), w.End)
+				var ids []string
+				for _, e := range w.Events {
+					ids = append(ids, e.ID)
+				}
+				res = append(res, ids)
+				return nil
+			}
+
+			opts := append([]rpatterns.WindowOption{rpatterns.WithWindowIdle(time.Millisecond)}, test.opts...)
+			wc := rpatterns.NewWindowedConsumer("window_test", cstore, time.Minute, flush, opts...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- reflex.Run(ctx, rpatterns.NewWindowedSpec(table.Stream, wc))
+			}()
+
+			require.Eventually(t, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(res) == len(test.windows)
+			}, time.Second, time.Millisecond)
+
+			cancel()
+			<-errCh
+
+			require.Equal(t, test.windows, res)
+			require.Equal(t, test.cursor, cstore.Cursor("window_test"))
+		})
+	}
+}
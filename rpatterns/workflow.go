@@ -0,0 +1,150 @@
+package rpatterns
+
+import (
+	"context"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+// maxWorkflowRetries is the maximum number of times a transition is
+// retried due to concurrent state modifications.
+const maxWorkflowRetries = 3
+
+// TransitionFunc is called with the event that triggers a workflow
+// transition before the next state is stored.
+type TransitionFunc func(ctx context.Context, f fate.Fate, e *reflex.Event) error
+
+// WorkflowOption defines a functional option to configure workflows.
+type WorkflowOption func(*Workflow)
+
+// WithWorkflowConsumerOpts provides an option to set the reflex consumer options.
+func WithWorkflowConsumerOpts(opts ...reflex.ConsumerOption) WorkflowOption {
+	return func(w *Workflow) {
+		w.opts = append(w.opts, opts...)
+	}
+}
+
+// NewWorkflow returns a new workflow (or saga) with a state machine per
+// foreign ID starting in the initial state. Add transitions with On and use
+// NewWorkflowSpec to run it. The states are persisted in the state store
+// keyed by the workflow name and foreign ID, so a store can be shared by
+// multiple workflows.
+//
+//	w := rpatterns.NewWorkflow("onboarding", store, "pending").
+//		On("pending", PaymentCreated, "paid", nil).
+//		On("paid", KYCApproved, "active", activateUser)
+func NewWorkflow(name string, store reflex.StateStore, initial string,
+	opts ...WorkflowOption) *Workflow {
+
+	w := &Workflow{
+		name:        name,
+		store:       store,
+		initial:     initial,
+		transitions: make(map[transitionKey]transition),
+	}
+	for _, o := range opts {
+		o(w)
+	}
+	return w
+}
+
+// Workflow drives state machines per foreign ID by consumed events. Events
+// without a transition from the current state of its foreign ID are ignored.
+//
+// The state is stored after the transition function returns, so transition
+// functions are called at-least-once and should be idempotent. Concurrent
+// modifications of the state are detected via optimistic locking, in which
+// case the transition is retried with the current state.
+type Workflow struct {
+	name        string
+	store       reflex.StateStore
+	initial     string
+	transitions map[transitionKey]transition
+	opts        []reflex.ConsumerOption
+}
+
+type transitionKey struct {
+	from string
+	typ  int
+}
+
+type transition struct {
+	to string
+	fn TransitionFunc
+}
+
+// On adds a transition from the state to the next state triggered by events
+// of the type. The optional fn is called before the next state is stored.
+// It returns the workflow for chaining.
+func (w *Workflow) On(from string, typ reflex.EventType, to string, fn TransitionFunc) *Workflow {
+	w.transitions[transitionKey{from: from, typ: typ.ReflexType()}] = transition{to: to, fn: fn}
+	return w
+}
+
+// Name returns the workflow name.
+func (w *Workflow) Name() string {
+	return w.name
+}
+
+// State returns the current state of the foreign ID's state machine.
+func (w *Workflow) State(ctx context.Context, foreignID string) (string, error) {
+	state, _, err := w.load(ctx, foreignID)
+	return state, err
+}
+
+// Consume transitions the state machine of the event's foreign ID.
+func (w *Workflow) Consume(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+	for i := 0; ; i++ {
+		err := w.transition(ctx, f, e)
+		if i < maxWorkflowRetries && errors.Is(err, reflex.ErrStateConflict) {
+			continue
+		}
+		return err
+	}
+}
+
+func (w *Workflow) transition(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+	state, version, err := w.load(ctx, e.ForeignID)
+	if err != nil {
+		return err
+	}
+
+	t, ok := w.transitions[transitionKey{from: state, typ: e.Type.ReflexType()}]
+	if !ok {
+		return nil
+	}
+
+	if t.fn != nil {
+		if err := t.fn(ctx, f, e); err != nil {
+			return errors.Wrap(err, "workflow transition error",
+				j.MKV{"from": state, "to": t.to})
+		}
+	}
+
+	return w.store.Store(ctx, w.key(e.ForeignID), []byte(t.to), version)
+}
+
+// load returns the state and version of the foreign ID's state machine.
+func (w *Workflow) load(ctx context.Context, foreignID string) (string, int64, error) {
+	state, version, err := w.store.Load(ctx, w.key(foreignID))
+	if err != nil {
+		return "", 0, err
+	} else if version == 0 {
+		return w.initial, 0, nil
+	}
+	return string(state), version, nil
+}
+
+func (w *Workflow) key(foreignID string) string {
+	return w.name + "/" + foreignID
+}
+
+// NewWorkflowSpec returns a reflex spec for the workflow.
+func NewWorkflowSpec(stream reflex.StreamFunc, cstore reflex.CursorStore,
+	w *Workflow, opts ...reflex.StreamOption) reflex.Spec {
+
+	return reflex.NewSpec(stream, cstore, reflex.NewConsumer(w.name, w.Consume, w.opts...), opts...)
+}
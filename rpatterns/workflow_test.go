@@ -0,0 +1,70 @@
+package rpatterns_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkflow(t *testing.T) {
+	table := rtest.NewEventsTable()
+	cstore := rtest.NewCursorStore()
+	store := rtest.NewStateStore()
+	ctx := context.Background()
+
+	var activated []string
+	w := rpatterns.NewWorkflow("onboarding", store, "pending").
+		On("pending", testEventType(1), "paid", nil).
+		On("paid", testEventType(2), "active",
+			func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+				activated = append(activated, e.ForeignID)
+				return nil
+			})
+
+	table.Insert("u1", testEventType(2)) // Ignored since pending
+	table.Insert("u1", testEventType(1))
+	table.Insert("u2", testEventType(1))
+	table.Insert("u1", testEventType(2))
+
+	spec := rpatterns.NewWorkflowSpec(table.Stream, cstore, w, reflex.WithStreamToHead())
+	err := reflex.Run(ctx, spec)
+	jtest.Require(t, reflex.ErrHeadReached, err)
+
+	require.Equal(t, []string{"u1"}, activated)
+	require.Equal(t, "4", cstore.Cursor("onboarding"))
+
+	for foreignID, state := range map[string]string{
+		"u1": "active",
+		"u2": "paid",
+		"u3": "pending",
+	} {
+		actual, err := w.State(ctx, foreignID)
+		jtest.RequireNil(t, err)
+		require.Equal(t, state, actual)
+	}
+}
+
+func TestWorkflowConflict(t *testing.T) {
+	store := rtest.NewStateStore()
+	ctx := context.Background()
+
+	// Concurrently transition the state within the transition function.
+	w := rpatterns.NewWorkflow("test", store, "a")
+	w.On("a", testEventType(1), "b", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+		return store.Store(ctx, "test/"+e.ForeignID, []byte("c"), 0)
+	})
+	w.On("c", testEventType(1), "d", nil)
+
+	e := &reflex.Event{ID: "1", ForeignID: "f1", Type: testEventType(1)}
+	jtest.RequireNil(t, w.Consume(ctx, fate.New(), e))
+
+	state, err := w.State(ctx, "f1")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "d", state)
+}
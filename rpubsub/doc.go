@@ -0,0 +1,14 @@
+// Package rpubsub leverages the gocloud.dev/pubsub package and provides
+// a reflex ack stream of events received from a subscription (usually a
+// Google Cloud Pub/Sub subscription) and a sink that publishes reflex
+// events to a topic.
+//
+// Events are mapped to messages as follows:
+//   - MetaData is the message body.
+//   - ID, Type, ForeignID and Timestamp are message metadata attributes,
+//     see the Attr constants.
+//
+// Received messages without an ID attribute are identified by the Pub/Sub
+// message ID (or a sequence if not supported by the driver) and messages
+// without a timestamp attribute by their publish time.
+package rpubsub
@@ -0,0 +1,223 @@
+package rpubsub
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+	"gocloud.dev/pubsub"
+	pb "google.golang.org/genproto/googleapis/pubsub/v1"
+)
+
+// Message metadata attributes of event fields.
+const (
+	AttrID        = "event_id"
+	AttrType      = "event_type"
+	AttrForeignID = "foreign_id"
+	AttrTimestamp = "timestamp"
+)
+
+// NewSubscription returns a subscription using the provided underlying subscription.
+func NewSubscription(sub *pubsub.Subscription) *Subscription {
+	return &Subscription{sub: sub}
+}
+
+// OpenSubscription opens and returns a subscription for the provided url.
+// See the gocloud URLOpener documentation in driver subpackages for details
+// on supported URL formats. Also see https://gocloud.dev/howto/pubsub/.
+func OpenSubscription(ctx context.Context, urlstr string) (*Subscription, error) {
+	sub, err := pubsub.OpenSubscription(ctx, urlstr)
+	if err != nil {
+		return nil, err
+	}
+	return NewSubscription(sub), nil
+}
+
+// Subscription defines a subscription from which to stream messages as events.
+type Subscription struct {
+	sub *pubsub.Subscription
+}
+
+// Shutdown flushes pending acks and releases resources of the underlying subscription.
+func (s *Subscription) Shutdown(ctx context.Context) error {
+	return s.sub.Shutdown(ctx)
+}
+
+// Stream implements reflex.AckStreamFunc and returns an AckStreamClient that
+// streams messages from the subscription. Stream options are not supported.
+func (s *Subscription) Stream(ctx context.Context,
+	opts ...reflex.StreamOption) (reflex.AckStreamClient, error) {
+
+	if len(opts) > 0 {
+		return nil, errors.New("options not supported")
+	}
+
+	return &stream{
+		ctx:     ctx,
+		sub:     s.sub,
+		pending: make(map[string]*pubsub.Message),
+	}, nil
+}
+
+type stream struct {
+	ctx context.Context
+	sub *pubsub.Subscription
+	seq int64
+
+	mu      sync.Mutex
+	pending map[string]*pubsub.Message
+}
+
+func (s *stream) Recv() (*reflex.Event, error) {
+	m, err := s.sub.Receive(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.seq++
+	id := strconv.FormatInt(s.seq, 10)
+	ts := time.Now()
+
+	var pm *pb.PubsubMessage
+	if m.As(&pm) {
+		id = pm.MessageId
+		if pm.PublishTime != nil {
+			ts = time.Unix(pm.PublishTime.Seconds, int64(pm.PublishTime.Nanos))
+		}
+	}
+
+	e, err := toEvent(id, ts, m)
+	if err != nil {
+		return nil, err
+	}
+
+	// Key pending messages by the event ID, not the transport ID, since
+	// the event ID attribute replaces it and Ack looks up by event ID.
+	s.mu.Lock()
+	s.pending[e.ID] = m
+	s.mu.Unlock()
+
+	return e, nil
+}
+
+// Ack acks the event's message. Note that acks are sent in the background.
+func (s *stream) Ack(_ context.Context, e *reflex.Event) error {
+	s.mu.Lock()
+	m, ok := s.pending[e.ID]
+	delete(s.pending, e.ID)
+	s.mu.Unlock()
+
+	if !ok {
+		return errors.New("unknown message", j.KS("message_id", e.ID))
+	}
+
+	m.Ack()
+	return nil
+}
+
+// toEvent maps the message to an event using the id and timestamp attributes
+// if present.
+func toEvent(id string, ts time.Time, m *pubsub.Message) (*reflex.Event, error) {
+	var typ int
+	if v := m.Metadata[AttrType]; v != "" {
+		var err error
+		typ, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid event type attribute", j.KS("message_id", id))
+		}
+	}
+
+	if v := m.Metadata[AttrTimestamp]; v != "" {
+		var err error
+		ts, err = time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid timestamp attribute", j.KS("message_id", id))
+		}
+	}
+
+	if v := m.Metadata[AttrID]; v != "" {
+		id = v
+	}
+
+	return &reflex.Event{
+		ID:        id,
+		Type:      eventType(typ),
+		ForeignID: m.Metadata[AttrForeignID],
+		Timestamp: ts,
+		MetaData:  m.Body,
+	}, nil
+}
+
+// SinkOption is a functional option that configures a sink.
+type SinkOption func(*Sink)
+
+// WithOrderingKey returns an option to publish messages with the event
+// foreign ID as ordering key, so events of the same entity are delivered
+// in order. It is only supported by the gcppubsub driver and requires
+// message ordering to be enabled on the subscription.
+func WithOrderingKey() SinkOption {
+	return func(s *Sink) {
+		s.ordering = true
+	}
+}
+
+// NewSink returns a sink that publishes events to the provided topic.
+func NewSink(topic *pubsub.Topic, opts ...SinkOption) *Sink {
+	s := &Sink{topic: topic}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Sink publishes reflex events to a topic.
+type Sink struct {
+	topic    *pubsub.Topic
+	ordering bool
+}
+
+// Send publishes the event to the topic. It blocks until the message
+// has been sent.
+func (s *Sink) Send(ctx context.Context, e *reflex.Event) error {
+	m := &pubsub.Message{
+		Body: e.MetaData,
+		Metadata: map[string]string{
+			AttrID:        e.ID,
+			AttrType:      strconv.Itoa(e.Type.ReflexType()),
+			AttrForeignID: e.ForeignID,
+			AttrTimestamp: e.Timestamp.Format(time.RFC3339Nano),
+		},
+	}
+
+	if s.ordering {
+		m.BeforeSend = func(asFunc func(interface{}) bool) error {
+			var pm *pb.PubsubMessage
+			if asFunc(&pm) {
+				pm.OrderingKey = e.ForeignID
+			}
+			return nil
+		}
+	}
+
+	return errors.Wrap(s.topic.Send(ctx, m), "send error", j.KS("event_id", e.ID))
+}
+
+// Consumer returns a reflex consumer that forwards events to the topic,
+// e.g. to publish the events of an outbox events table.
+func (s *Sink) Consumer(name string, opts ...reflex.ConsumerOption) reflex.Consumer {
+	return reflex.NewConsumer(name, func(ctx context.Context, _ fate.Fate, e *reflex.Event) error {
+		return s.Send(ctx, e)
+	}, opts...)
+}
+
+// eventType is the rpubsub internal implementation of EventType interface.
+type eventType int
+
+func (t eventType) ReflexType() int {
+	return int(t)
+}
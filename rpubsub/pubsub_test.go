@@ -0,0 +1,100 @@
+package rpubsub_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpubsub"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub/mempubsub"
+)
+
+type testEventType int
+
+func (t testEventType) ReflexType() int {
+	return int(t)
+}
+
+func TestSinkAndStream(t *testing.T) {
+	ctx := context.Background()
+	topic := mempubsub.NewTopic()
+	defer topic.Shutdown(ctx)
+	sub := mempubsub.NewSubscription(topic, time.Minute)
+
+	// Forward events from a table to the topic.
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	table := rtest.NewEventsTable(rtest.WithClock(func() time.Time {
+		return t0
+	}))
+	table.InsertWithMetadata("f1", testEventType(1), []byte("meta1"))
+	table.Insert("f2", testEventType(2))
+
+	sink := rpubsub.NewSink(topic, rpubsub.WithOrderingKey())
+	spec := reflex.NewSpec(table.Stream, rtest.NewCursorStore(),
+		sink.Consumer("forwarder"), reflex.WithStreamToHead())
+	jtest.Require(t, reflex.ErrHeadReached, reflex.Run(ctx, spec))
+
+	// Consume events from the subscription.
+	var events []*reflex.Event
+	consumer := reflex.NewConsumer("subscriber", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+		events = append(events, e)
+		if len(events) == 2 {
+			return context.Canceled
+		}
+		return nil
+	})
+
+	s := rpubsub.NewSubscription(sub)
+	defer s.Shutdown(ctx)
+
+	err := reflex.Run(ctx, reflex.NewAckStreamSpec(s.Stream, consumer))
+	jtest.Require(t, context.Canceled, err)
+
+	// mempubsub doesn't guarantee delivery order.
+	require.Len(t, events, 2)
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	require.Equal(t, "1", events[0].ID)
+	require.Equal(t, 1, events[0].Type.ReflexType())
+	require.Equal(t, "f1", events[0].ForeignID)
+	require.Equal(t, []byte("meta1"), events[0].MetaData)
+	require.True(t, t0.Equal(events[0].Timestamp))
+	require.Equal(t, "2", events[1].ID)
+}
+
+func TestStreamAckEventID(t *testing.T) {
+	ctx := context.Background()
+	topic := mempubsub.NewTopic()
+	defer topic.Shutdown(ctx)
+	sub := mempubsub.NewSubscription(topic, time.Minute)
+
+	// Send an event with an ID different from the transport ID.
+	sink := rpubsub.NewSink(topic)
+	err := sink.Send(ctx, &reflex.Event{
+		ID:        "100",
+		Type:      testEventType(1),
+		ForeignID: "f1",
+		Timestamp: time.Now(),
+	})
+	jtest.RequireNil(t, err)
+
+	s := rpubsub.NewSubscription(sub)
+	defer s.Shutdown(ctx)
+
+	sc, err := s.Stream(ctx)
+	jtest.RequireNil(t, err)
+
+	e, err := sc.Recv()
+	jtest.RequireNil(t, err)
+	require.Equal(t, "100", e.ID)
+
+	jtest.RequireNil(t, sc.Ack(ctx, e))
+	require.Error(t, sc.Ack(ctx, e))
+}
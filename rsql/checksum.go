@@ -0,0 +1,92 @@
+package rsql
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"sort"
+	"strconv"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+// bindChecksum returns the checksum of the event content to insert with the
+// bound foreign ID and the metadata as stored, see checksum.
+func (s etableSchema) bindChecksum(foreignID interface{}, typ int, tenantID string,
+	headers, foreignKeys map[string]string, metadata []byte) string {
+
+	var fid string
+	switch v := foreignID.(type) {
+	case int64:
+		fid = strconv.FormatInt(v, 10)
+	case []byte:
+		fid = s.formatForeignID(string(v))
+	case string:
+		fid = v
+	}
+
+	return checksum(fid, typ, tenantID, headers, foreignKeys, metadata)
+}
+
+// verifyChecksum returns ErrChecksumMismatch if the checksum of the scanned
+// event doesn't match the stored checksum. Events without checksums, e.g.
+// noops or events inserted before checksums were enabled, are not verified.
+func (s etableSchema) verifyChecksum(e *reflex.Event, sum sql.NullString) error {
+	if !sum.Valid {
+		return nil
+	}
+
+	actual := checksum(s.formatForeignID(e.ForeignID), e.Type.ReflexType(),
+		e.TenantID, e.Headers, e.ForeignKeys, e.MetaData)
+	if actual != sum.String {
+		return errors.Wrap(ErrChecksumMismatch, "", j.KS("id", e.ID))
+	}
+
+	return nil
+}
+
+// checksum returns the hex encoded SHA-256 hash of the event content. It
+// covers the foreign ID, type, tenant, headers, foreign keys and the metadata
+// as stored (ie. encrypted and compressed). It doesn't cover the ID and
+// timestamp since they are only known after inserting.
+func checksum(foreignID string, typ int, tenantID string,
+	headers, foreignKeys map[string]string, metadata []byte) string {
+
+	h := sha256.New()
+	writeBytes(h, []byte(foreignID))
+	writeBytes(h, []byte(strconv.Itoa(typ)))
+	writeBytes(h, []byte(tenantID))
+	writeMap(h, headers)
+	writeMap(h, foreignKeys)
+	writeBytes(h, metadata)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeBytes writes the length prefixed bytes to the hash.
+func writeBytes(h hash.Hash, b []byte) {
+	var l [8]byte
+	binary.BigEndian.PutUint64(l[:], uint64(len(b)))
+	h.Write(l[:])
+	h.Write(b)
+}
+
+// writeMap writes the number of entries followed by the entries
+// sorted by key to the hash.
+func writeMap(h hash.Hash, m map[string]string) {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	writeBytes(h, []byte(strconv.Itoa(len(keys))))
+	for _, k := range keys {
+		writeBytes(h, []byte(k))
+		writeBytes(h, []byte(m[k]))
+	}
+}
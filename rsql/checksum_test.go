@@ -0,0 +1,26 @@
+package rsql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksum(t *testing.T) {
+	sum := checksum("1", 1, "t1", map[string]string{"a": "1", "b": "2"}, nil, []byte("meta"))
+	require.Len(t, sum, 64)
+
+	// Maps are hashed in key order.
+	require.Equal(t, sum, checksum("1", 1, "t1", map[string]string{"b": "2", "a": "1"}, nil, []byte("meta")))
+
+	// Fields are length prefixed.
+	require.NotEqual(t, checksum("12", 1, "", nil, nil, nil), checksum("1", 21, "", nil, nil, nil))
+	require.NotEqual(t, checksum("1", 1, "t", nil, nil, []byte("1")), checksum("1", 1, "t1", nil, nil, nil))
+
+	// Empty and nil maps are equal.
+	require.Equal(t, checksum("1", 1, "", map[string]string{}, nil, nil), checksum("1", 1, "", nil, nil, nil))
+
+	// Foreign IDs are hashed as streamed.
+	s := etableSchema{foreignIDType: ForeignIDInt64}
+	require.Equal(t, checksum("12", 1, "", nil, nil, nil), s.bindChecksum(int64(12), 1, "", nil, nil, nil))
+}
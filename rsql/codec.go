@@ -0,0 +1,174 @@
+package rsql
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+// cipherMagic prefixes encrypted metadata, see compressionMagic. Metadata
+// without it is not decrypted, so tables can contain events inserted
+// before the cipher was enabled.
+var cipherMagic = []byte{0x00, 0xae}
+
+// Codec transforms event metadata before it is inserted into and after
+// it is scanned from an events table, see WithMetadataCipher.
+type Codec interface {
+	Encode(metadata []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// NewAESCipher returns a codec that encrypts metadata using AES-GCM with
+// the current key and decrypts metadata using any of the keys. Keys must be
+// 16, 24 or 32 bytes long. The key ID is prefixed to the ciphertext which
+// supports key rotation: add a new current key while keeping the old keys
+// until all events encrypted with them have been consumed or re-encrypted.
+// Metadata without the encryption header is decoded unchanged which
+// supports enabling encryption for existing tables.
+func NewAESCipher(currentKeyID string, keys map[string][]byte) (Codec, error) {
+	if len(currentKeyID) == 0 || len(currentKeyID) > 255 {
+		return nil, errors.New("invalid key id length", j.KS("key_id", currentKeyID))
+	} else if _, ok := keys[currentKeyID]; !ok {
+		return nil, errors.Wrap(ErrUnknownCipherKey, "", j.KS("key_id", currentKeyID))
+	}
+
+	aeads := make(map[string]cipher.AEAD)
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid key", j.KS("key_id", id))
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		aeads[id] = aead
+	}
+
+	return &aesCipher{
+		current: currentKeyID,
+		aeads:   aeads,
+	}, nil
+}
+
+// aesCipher encodes metadata as: magic (2 bytes), key ID length (1 byte),
+// key ID, nonce, ciphertext.
+type aesCipher struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+func (c *aesCipher) Encode(metadata []byte) ([]byte, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+
+	aead := c.aeads[c.current]
+
+	n := len(cipherMagic) + 1 + len(c.current)
+	res := make([]byte, n+aead.NonceSize(), n+aead.NonceSize()+len(metadata)+aead.Overhead())
+	copy(res, cipherMagic)
+	res[len(cipherMagic)] = byte(len(c.current))
+	copy(res[len(cipherMagic)+1:], c.current)
+
+	nonce := res[n:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "generate nonce error")
+	}
+
+	return aead.Seal(res, nonce, metadata, nil), nil
+}
+
+func (c *aesCipher) Decode(data []byte) ([]byte, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	n := len(cipherMagic)
+	if len(data) <= n || !bytes.Equal(data[:n], cipherMagic) {
+		// Not encrypted.
+		return data, nil
+	}
+
+	data = data[n:]
+	if len(data) < 1+int(data[0]) {
+		return nil, errors.New("invalid ciphertext")
+	}
+
+	id := string(data[1 : 1+data[0]])
+	aead, ok := c.aeads[id]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownCipherKey, "", j.KS("key_id", id))
+	}
+
+	data = data[1+len(id):]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("invalid ciphertext", j.KS("key_id", id))
+	}
+
+	res, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypt error", j.KS("key_id", id))
+	}
+
+	return res, nil
+}
+
+// encodeMetadata returns the metadata as stored in the table.
+// It compresses before encrypting the metadata.
+func (s etableSchema) encodeMetadata(metadata []byte) ([]byte, error) {
+	var err error
+	if s.compressor != nil {
+		metadata, err = s.compressor.compress(metadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.cipher != nil {
+		metadata, err = s.cipher.Encode(metadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// decodeMetadata returns the metadata stored in the table as inserted.
+func (s etableSchema) decodeMetadata(data []byte) ([]byte, error) {
+	var err error
+	if s.cipher != nil {
+		data, err = s.cipher.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.compressor != nil {
+		data, err = s.compressor.decompress(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// decodeEvents decodes the foreign IDs and metadata of the events in place.
+func decodeEvents(schema etableSchema, el []*reflex.Event) error {
+	for _, e := range el {
+		e.ForeignID = schema.formatForeignID(e.ForeignID)
+
+		var err error
+		e.MetaData, err = schema.decodeMetadata(e.MetaData)
+		if err != nil {
+			return errors.Wrap(err, "decode metadata error", j.KS("id", e.ID))
+		}
+	}
+	return nil
+}
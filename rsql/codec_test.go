@@ -0,0 +1,62 @@
+package rsql_test
+
+import (
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAESCipher(t *testing.T) {
+	key1, key2 := make([]byte, 16), make([]byte, 32)
+	key2[0] = 1
+
+	c1, err := rsql.NewAESCipher("k1", map[string][]byte{"k1": key1})
+	jtest.RequireNil(t, err)
+	c2, err := rsql.NewAESCipher("k2", map[string][]byte{"k1": key1, "k2": key2})
+	jtest.RequireNil(t, err)
+
+	b1, err := c1.Encode([]byte("hello"))
+	jtest.RequireNil(t, err)
+	require.Equal(t, []byte{0x00, 0xae}, b1[:2])
+	require.Equal(t, "k1", string(b1[3:3+b1[2]]))
+
+	b2, err := c2.Encode([]byte("hello"))
+	jtest.RequireNil(t, err)
+	require.Equal(t, "k2", string(b2[3:3+b2[2]]))
+
+	// Rotated codec decodes both keys.
+	for _, b := range [][]byte{b1, b2} {
+		res, err := c2.Decode(b)
+		jtest.RequireNil(t, err)
+		require.Equal(t, "hello", string(res))
+	}
+
+	_, err = c1.Decode(b2)
+	jtest.Require(t, rsql.ErrUnknownCipherKey, err)
+
+	b1[len(b1)-1] ^= 1
+	_, err = c1.Decode(b1)
+	require.Error(t, err)
+
+	_, err = c1.Decode([]byte{0x00, 0xae, 5, 'k'})
+	require.Error(t, err)
+
+	// Unencrypted metadata is decoded unchanged.
+	for _, b := range [][]byte{[]byte(`{"a":1}`), {0x00, 0xc5, 1, 2}, {0x00}} {
+		res, err := c1.Decode(b)
+		jtest.RequireNil(t, err)
+		require.Equal(t, b, res)
+	}
+
+	res, err := c1.Encode(nil)
+	jtest.RequireNil(t, err)
+	require.Nil(t, res)
+
+	_, err = rsql.NewAESCipher("k3", map[string][]byte{"k1": key1})
+	jtest.Require(t, rsql.ErrUnknownCipherKey, err)
+
+	_, err = rsql.NewAESCipher("k1", map[string][]byte{"k1": make([]byte, 10)})
+	require.Error(t, err)
+}
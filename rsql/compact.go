@@ -0,0 +1,131 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+// WithEventsCompacted provides an option to stream a compacted events table
+// written by Compact. Since compacted tables preserve the source event IDs,
+// gaps are expected and permanent, so gap detection and the cache are disabled.
+// Do not insert events into compacted tables.
+func WithEventsCompacted() EventsOption {
+	return func(table *EventsTable) {
+		table.schema.compacted = true
+		table.disableCache = true
+	}
+}
+
+// Compact copies the events of the source table that are not yet in the
+// destination table into it and deletes all but the latest keep events per
+// foreign ID from the destination table, e.g. for "latest state" streams that
+// only require the latest event of each foreign ID. It returns once the
+// source's head at the time of the call is compacted, so call it periodically
+// to compact new events.
+//
+// Both tables must be in the same database, the destination table must have
+// the same schema and be streamed with the WithEventsCompacted option. Copied events preserve
+// their IDs and timestamps, so cursors of the source table are also cursors
+// of the destination table, i.e. consumers can switch to the compacted table
+// without resetting their cursors. Compact is not safe to call concurrently
+// for the same destination table.
+func Compact(ctx context.Context, dbc *sql.DB, src, dst *EventsTable, keep int) error {
+	if keep < 1 {
+		return errors.New("keep must be positive", j.KV("keep", keep))
+	} else if !dst.schema.compacted {
+		return errors.New("destination table not compacted")
+	}
+
+	after, err := getLatestID(ctx, dbc, dst.schema)
+	if err != nil {
+		return err
+	}
+
+	sc := src.Stream(ctx, dbc, strconv.FormatInt(after, 10), reflex.WithStreamToHead())
+
+	var batch []*reflex.Event
+	for {
+		e, err := sc.Recv()
+		if err != nil && !reflex.IsHeadReachedErr(err) {
+			return err
+		}
+
+		if err == nil {
+			batch = append(batch, e)
+			if len(batch) < defaultFetchLimit {
+				continue
+			}
+		}
+
+		if len(batch) > 0 {
+			if err := compactBatch(ctx, dbc, dst.schema, batch, keep); err != nil {
+				return err
+			}
+			dst.notifier.Notify()
+			batch = nil
+		}
+
+		if err != nil {
+			// Head reached.
+			return nil
+		}
+	}
+}
+
+// compactBatch inserts the events into the compacted table and deletes
+// the older events of their foreign IDs in a single transaction.
+func compactBatch(ctx context.Context, dbc *sql.DB, schema etableSchema,
+	batch []*reflex.Event, keep int) error {
+
+	tx, err := dbc.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertEventsWithIDs(ctx, tx, schema, batch); err != nil {
+		return err
+	}
+
+	var (
+		foreignIDs []string
+		seen       = make(map[string]bool)
+	)
+	for _, e := range batch {
+		if !seen[e.ForeignID] {
+			seen[e.ForeignID] = true
+			foreignIDs = append(foreignIDs, e.ForeignID)
+		}
+	}
+
+	for _, foreignID := range foreignIDs {
+		arg, err := schema.bindForeignID(foreignID)
+		if err != nil {
+			return err
+		}
+
+		// Find the oldest event to keep.
+		var oldest int64
+		err = tx.QueryRowContext(ctx, schema.dialect.rebind("select id from "+schema.name+
+			" where "+schema.foreignIDField+"=? order by id desc limit 1 offset ?"),
+			arg, keep-1).Scan(&oldest)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			return errors.Wrap(err, "select compacted events error", j.KS("foreign_id", foreignID))
+		}
+
+		_, err = tx.ExecContext(ctx, schema.dialect.rebind("delete from "+schema.name+
+			" where "+schema.foreignIDField+"=? and id<?"), arg, oldest)
+		if err != nil {
+			return errors.Wrap(err, "delete compacted events error", j.KS("foreign_id", foreignID))
+		}
+	}
+
+	return tx.Commit()
+}
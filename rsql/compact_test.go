@@ -0,0 +1,59 @@
+package rsql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompact(t *testing.T) {
+	const compactedTable = "compacted"
+	dbc := ConnectTestDB(t, eventsTable, "")
+	defer dbc.Close()
+	createEventsTable(t, dbc, compactedTable, true)
+
+	ctx := context.Background()
+	src := rsql.NewEventsTable(eventsTable)
+	dst := rsql.NewEventsTable(compactedTable, rsql.WithEventsCompacted())
+
+	for i, fid := range []string{"a", "b", "a", "a", "b"} {
+		err := insertTestEvent(dbc, src, fid, testEventType(i+1))
+		jtest.RequireNil(t, err)
+	}
+
+	assertStream := func(t *testing.T, after string, ids ...string) {
+		t.Helper()
+		sc := dst.Stream(ctx, dbc, after, reflex.WithStreamToHead())
+
+		var res []string
+		for {
+			e, err := sc.Recv()
+			if reflex.IsHeadReachedErr(err) {
+				break
+			}
+			jtest.RequireNil(t, err)
+			res = append(res, e.ID)
+		}
+		require.Equal(t, ids, res)
+	}
+
+	jtest.RequireNil(t, rsql.Compact(ctx, dbc, src, dst, 2))
+	assertStream(t, "", "2", "3", "4", "5")
+
+	// Compacting again is a noop.
+	jtest.RequireNil(t, rsql.Compact(ctx, dbc, src, dst, 2))
+	assertStream(t, "", "2", "3", "4", "5")
+
+	// New events compact older events, source cursors remain valid.
+	jtest.RequireNil(t, insertTestEvent(dbc, src, "a", testEventType(6)))
+	jtest.RequireNil(t, rsql.Compact(ctx, dbc, src, dst, 2))
+	assertStream(t, "", "2", "4", "5", "6")
+	assertStream(t, "3", "4", "5", "6")
+
+	err := rsql.Compact(ctx, dbc, src, src, 2)
+	require.Error(t, err)
+}
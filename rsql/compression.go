@@ -0,0 +1,110 @@
+package rsql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// compressionMagic prefixes compressed metadata followed by the compression
+// ID. Uncompressed JSON or protobuf metadata never starts with a zero byte,
+// so tables can contain both compressed and uncompressed metadata.
+var compressionMagic = []byte{0x00, 0xc5}
+
+// Compression compresses and decompresses event metadata,
+// see WithMetadataCompression. See the rcompress package for
+// snappy and zstd compressions.
+type Compression interface {
+	// ID returns the unique compression ID stored in the metadata header.
+	ID() byte
+	Compress(metadata []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// CompressionGzip is a gzip compression with ID 1.
+var CompressionGzip Compression = gzipCompression{}
+
+type gzipCompression struct{}
+
+func (gzipCompression) ID() byte {
+	return 1
+}
+
+func (gzipCompression) Compress(metadata []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(metadata); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompression) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// compressor compresses metadata with the current compression and
+// decompresses metadata of any of the compressions.
+type compressor struct {
+	current Compression
+	all     map[byte]Compression
+}
+
+func newCompressor(current Compression, others ...Compression) *compressor {
+	all := map[byte]Compression{current.ID(): current}
+	for _, c := range others {
+		all[c.ID()] = c
+	}
+
+	return &compressor{
+		current: current,
+		all:     all,
+	}
+}
+
+func (c *compressor) compress(metadata []byte) ([]byte, error) {
+	if len(metadata) == 0 {
+		return metadata, nil
+	}
+
+	b, err := c.current.Compress(metadata)
+	if err != nil {
+		return nil, errors.Wrap(err, "compress error", j.KV("compression", c.current.ID()))
+	}
+
+	header := append(append([]byte(nil), compressionMagic...), c.current.ID())
+
+	return append(header, b...), nil
+}
+
+func (c *compressor) decompress(data []byte) ([]byte, error) {
+	n := len(compressionMagic)
+	if len(data) <= n || !bytes.Equal(data[:n], compressionMagic) {
+		// Not compressed.
+		return data, nil
+	}
+
+	comp, ok := c.all[data[n]]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownCompression, "", j.KV("compression", data[n]))
+	}
+
+	res, err := comp.Decompress(data[n+1:])
+	if err != nil {
+		return nil, errors.Wrap(err, "decompress error", j.KV("compression", data[n]))
+	}
+
+	return res, nil
+}
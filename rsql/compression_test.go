@@ -0,0 +1,73 @@
+package rsql
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressor(t *testing.T) {
+	md := bytes.Repeat([]byte(`{"key":"value"}`), 10)
+
+	c := newCompressor(CompressionGzip)
+	b, err := c.compress(md)
+	jtest.RequireNil(t, err)
+	require.Equal(t, []byte{0x00, 0xc5, 1}, b[:3])
+	require.Less(t, len(b), len(md))
+
+	res, err := c.decompress(b)
+	jtest.RequireNil(t, err)
+	require.Equal(t, md, res)
+
+	// Uncompressed metadata is returned as is.
+	res, err = c.decompress(md)
+	jtest.RequireNil(t, err)
+	require.Equal(t, md, res)
+
+	res, err = c.compress(nil)
+	jtest.RequireNil(t, err)
+	require.Nil(t, res)
+
+	// Unknown compression.
+	_, err = c.decompress([]byte{0x00, 0xc5, 9, 1})
+	jtest.Require(t, ErrUnknownCompression, err)
+
+	// Migrating compression.
+	c2 := newCompressor(testCompression{}, CompressionGzip)
+	res, err = c2.decompress(b)
+	jtest.RequireNil(t, err)
+	require.Equal(t, md, res)
+
+	b, err = c2.compress(md)
+	jtest.RequireNil(t, err)
+	require.Equal(t, byte(9), b[2])
+
+	res, err = c2.decompress(b)
+	jtest.RequireNil(t, err)
+	require.Equal(t, md, res)
+}
+
+// testCompression reverses the metadata.
+type testCompression struct{}
+
+func (testCompression) ID() byte {
+	return 9
+}
+
+func (testCompression) Compress(metadata []byte) ([]byte, error) {
+	return reverse(metadata), nil
+}
+
+func (testCompression) Decompress(data []byte) ([]byte, error) {
+	return reverse(data), nil
+}
+
+func reverse(b []byte) []byte {
+	res := make([]byte, len(b))
+	for i := range b {
+		res[len(b)-1-i] = b[i]
+	}
+	return res
+}
@@ -3,12 +3,14 @@ package rsql
 import (
 	"context"
 	"database/sql"
+	"os"
 	"strconv"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 	"github.com/luno/jettison/log"
 	"github.com/luno/reflex"
 )
@@ -38,18 +40,40 @@ const (
 	defaultCursorCursorField = "last_event_id"
 	defaultCursorIDField     = "id"
 	defaultCursorTimeField   = "updated_at"
+	defaultCursorEpochField  = "epoch"
+	defaultCursorTenantField = "tenant_id"
 	defaultAsyncPeriod       = time.Second * 5
+
+	defaultCursorHolderHostField      = "holder_host"
+	defaultCursorHolderPIDField       = "holder_pid"
+	defaultCursorHolderHeartbeatField = "heartbeat_at"
 )
 
 // CursorsTable provides an interface to an event consumer cursors db table.
 type CursorsTable interface {
 	GetCursor(ctx context.Context, dbc *sql.DB, consumerID string) (string, error)
 	SetCursor(ctx context.Context, dbc *sql.DB, consumerID string, cursor string) error
+	ResetCursor(ctx context.Context, dbc *sql.DB, consumerID string, cursor string) error
+	ListCursors(ctx context.Context, dbc *sql.DB) ([]Cursor, error)
+	DeleteCursor(ctx context.Context, dbc *sql.DB, consumerID string) error
+	CloneCursor(ctx context.Context, dbc *sql.DB, fromID, toID string) error
 	Flush(ctx context.Context) error
 	Clone(ol ...CursorsOption) CursorsTable
 	ToStore(dbc *sql.DB, ol ...CursorsOption) reflex.CursorStore
 }
 
+// Cursor is a consumer cursor stored in a cursors table.
+type Cursor struct {
+	ConsumerID string
+	Cursor     string
+	UpdatedAt  time.Time
+
+	// Holder fields are only populated if enabled, see WithCursorHolder.
+	HolderHost  string
+	HolderPID   int
+	HeartbeatAt time.Time
+}
+
 // NewCursorsTable returns a new CursorsTable implementation.
 func NewCursorsTable(name string, options ...CursorsOption) CursorsTable {
 	table := &ctable{
@@ -59,10 +83,14 @@ func NewCursorsTable(name string, options ...CursorsOption) CursorsTable {
 			idField:     defaultCursorIDField,
 			timefield:   defaultCursorTimeField,
 			cursorType:  cursorTypeInt,
+			epochField:  defaultCursorEpochField,
+			tenantField: defaultCursorTenantField,
+			holder:      makeCursorHolder(),
 		},
-		sleep:       time.Sleep,
-		setCounter:  makeCursorSetCounter(name),
-		asyncPeriod: defaultAsyncPeriod,
+		sleep:      time.Sleep,
+		setCounter: makeCursorSetCounter(name),
+		async:      true,
+		policy:     FlushPolicy{Period: defaultAsyncPeriod},
 	}
 	for _, o := range options {
 		o(table)
@@ -97,11 +125,29 @@ func WithCursorTimeField(field string) CursorsOption {
 	}
 }
 
+// WithCursorDialect provides an option to set the SQL dialect of the
+// database. It defaults to DialectMySQL.
+func WithCursorDialect(d Dialect) CursorsOption {
+	return func(table *ctable) {
+		table.schema.dialect = d
+	}
+}
+
 // WithCursorAsyncPeriod provides an option to configure the async write period.
-// It defaults to 5 seconds.
+// It defaults to 5 seconds. A zero period disables async writes.
 func WithCursorAsyncPeriod(d time.Duration) CursorsOption {
 	return func(table *ctable) {
-		table.asyncPeriod = d
+		table.async = d > 0
+		table.policy = FlushPolicy{Period: d}
+	}
+}
+
+// WithCursorFlushPolicy provides an option to enable async (write-behind)
+// cursor writes with the provided flush policy. See FlushPolicy for details.
+func WithCursorFlushPolicy(p FlushPolicy) CursorsOption {
+	return func(table *ctable) {
+		table.async = true
+		table.policy = p
 	}
 }
 
@@ -110,6 +156,78 @@ func WithCursorAsyncDisabled() CursorsOption {
 	return WithCursorAsyncPeriod(0)
 }
 
+// WithCursorFencing provides an option to fence the cursor writes of
+// consumers accidentally running concurrently. Each reflex.Run acquires a new
+// epoch via the store's Fence method and cursor writes of stale epochs are
+// rejected with reflex.ErrCursorFenced. It requires a bigint 'epoch' field,
+// not null with default 0, see WithCursorEpochField.
+func WithCursorFencing() CursorsOption {
+	return func(table *ctable) {
+		table.schema.fencing = true
+	}
+}
+
+// WithCursorEpochField provides an option to configure the fencing epoch
+// field, see WithCursorFencing. It defaults to 'epoch'.
+func WithCursorEpochField(field string) CursorsOption {
+	return func(table *ctable) {
+		table.schema.epochField = field
+	}
+}
+
+// WithCursorHolder provides an option to store the hostname and pid of the
+// instance (holder) writing each cursor and a heartbeat timestamp in the
+// 'holder_host', 'holder_pid' and 'heartbeat_at' fields. This allows operators
+// to see which instance processes a consumer (see ListCursors) and to detect
+// split-brain, i.e. two instances writing the same cursor.
+//
+// Heartbeats are written with each cursor write and, with async writes, every
+// async period for all cursors previously written by the instance. Writing a
+// cursor with a heartbeat from another holder within the timeout logs
+// ErrCursorHolderConflict and increments the holder conflict metric. Note that
+// this adds a query per cursor write and that the fields must be nullable.
+func WithCursorHolder(timeout time.Duration) CursorsOption {
+	return func(table *ctable) {
+		h := &table.schema.holder
+		if h.hostField == "" {
+			h.hostField = defaultCursorHolderHostField
+			h.pidField = defaultCursorHolderPIDField
+			h.heartbeatField = defaultCursorHolderHeartbeatField
+		}
+		h.timeout = timeout
+	}
+}
+
+// WithCursorHolderFields provides an option to configure the holder fields,
+// see WithCursorHolder. It doesn't enable holder tracking by itself.
+func WithCursorHolderFields(hostField, pidField, heartbeatField string) CursorsOption {
+	return func(table *ctable) {
+		table.schema.holder.hostField = hostField
+		table.schema.holder.pidField = pidField
+		table.schema.holder.heartbeatField = heartbeatField
+	}
+}
+
+// WithCursorTenant provides an option to scope the cursors table to the tenant,
+// e.g. via ToStore(dbc, WithCursorTenant(id)) for consumers of
+// reflex.WithTenant streams. Cursors are keyed by tenant and consumer,
+// i.e. "<tenant>/<consumer>", so the same consumer has a cursor per tenant.
+// The tenant is also written to the tenant field (see WithCursorTenantField)
+// and ListCursors only lists the tenant's cursors by consumer.
+func WithCursorTenant(tenantID string) CursorsOption {
+	return func(table *ctable) {
+		table.schema.tenant = tenantID
+	}
+}
+
+// WithCursorTenantField provides an option to configure the tenant field
+// of tenant scoped cursors tables, see WithCursorTenant. It defaults to 'tenant_id'.
+func WithCursorTenantField(field string) CursorsOption {
+	return func(table *ctable) {
+		table.schema.tenantField = field
+	}
+}
+
 // WithCursorSetCounter provides an option to set the cursor DB set cursor metric.
 // It defaults to prometheus metrics.
 func WithCursorSetCounter(f func()) CursorsOption {
@@ -132,6 +250,41 @@ func WithTestCursorSleep(_ testing.TB, f func(time.Duration)) CursorsOption {
 	}
 }
 
+// WithCursorClock provides an option to set the clock used for the async
+// flush period, e.g. a fake clock in tests. It defaults to the real clock.
+func WithCursorClock(clock reflex.Clock) CursorsOption {
+	return func(table *ctable) {
+		table.sleep = func(d time.Duration) {
+			<-clock.After(d)
+		}
+	}
+}
+
+// WithTestCursorHolder provides an option to override the hostname and pid
+// of the holder, see WithCursorHolder.
+func WithTestCursorHolder(_ testing.TB, host string, pid int) CursorsOption {
+	return func(table *ctable) {
+		table.schema.holder.host = host
+		table.schema.holder.pid = pid
+	}
+}
+
+// FlushPolicy defines when async (write-behind) cursors are written to the DB.
+// Buffered cursors are always written on explicit calls to Flush, which
+// reflex.Run does on shutdown. The zero value therefore only flushes on shutdown.
+//
+// For fast consumers, the policy bounds the number of events replayed after
+// a crash while reducing cursor write amplification.
+type FlushPolicy struct {
+	// Period defines the period of background flushes. Zero disables
+	// background flushes.
+	Period time.Duration
+
+	// Sets defines the number of cursor sets after which buffered cursors
+	// are flushed inline by SetCursor. Zero disables inline flushes.
+	Sets int
+}
+
 var _ CursorsTable = (*ctable)(nil)
 
 type ctable struct {
@@ -144,8 +297,12 @@ type ctable struct {
 	cursorMu     sync.Mutex // Required for asyncCursors
 	cursorOnce   sync.Once
 	asyncCursors map[string]string
+	asyncFences  map[string]*cursorFence
+	asyncSets    int
 	asyncDBC     *sql.DB
-	asyncPeriod  time.Duration
+	async        bool
+	policy       FlushPolicy
+	held         map[string]bool // Cursors written by this holder
 }
 
 // ctableSchema defines the mysql schema of a cursors table.
@@ -155,40 +312,164 @@ type ctableSchema struct {
 	idField     string
 	timefield   string
 	cursorType  CursorType
+	dialect     Dialect
+	holder      cursorHolder
+	fencing     bool
+	epochField  string
+	tenantField string
+	tenant      string
+}
+
+// cursorFence is the epoch of a fenced cursor store, see cursorStore.Fence.
+type cursorFence struct {
+	mu     sync.Mutex
+	epoch  int64
+	insert bool // Insert the cursor since it didn't exist when fenced.
+	fenced bool
+}
+
+// cursorHolder defines the optional holder fields of a cursors table
+// and the holder (instance) writing the cursors, see WithCursorHolder.
+type cursorHolder struct {
+	hostField      string
+	pidField       string
+	heartbeatField string
+	timeout        time.Duration
+
+	host string
+	pid  int
+}
+
+func makeCursorHolder() cursorHolder {
+	host, _ := os.Hostname()
+	return cursorHolder{
+		host: host,
+		pid:  os.Getpid(),
+	}
+}
+
+// enabled returns true if holder tracking is enabled.
+func (h cursorHolder) enabled() bool {
+	return h.hostField != "" && h.timeout > 0
+}
+
+// writes returns the holder columns, values and update assignments to write
+// with a cursor and the holder args for both the values and updates.
+func (h cursorHolder) writes(d Dialect) (cols, vals, updates []string, args []interface{}) {
+	if !h.enabled() {
+		return nil, nil, nil, nil
+	}
+	cols = []string{h.hostField, h.pidField, h.heartbeatField}
+	vals = []string{"?", "?", d.now()}
+	updates = []string{h.hostField + "=?", h.pidField + "=?", h.heartbeatField + "=" + d.now()}
+	return cols, vals, updates, []interface{}{h.host, h.pid}
 }
 
 func (t *ctable) GetCursor(ctx context.Context, dbc *sql.DB, consumerID string) (string, error) {
-	return getCursor(ctx, dbc, t.schema, consumerID)
+	return getCursor(ctx, dbc, t.schema, t.schema.key(consumerID))
 }
 
 func (t *ctable) SetCursor(ctx context.Context, dbc *sql.DB, consumerID string, cursor string) error {
+	return t.setCursor(ctx, dbc, consumerID, cursor, nil)
+}
+
+// setCursor sets the cursor with the optional fence.
+func (t *ctable) setCursor(ctx context.Context, dbc *sql.DB, consumerID string,
+	cursor string, f *cursorFence) error {
+
 	_, err := t.schema.cursorType.Cast(cursor)
 	if err != nil {
 		return err
 	}
+	consumerID = t.schema.key(consumerID)
 	if !t.isAsyncEnabled() {
 		t.setCounter()
-		return setCursor(ctx, dbc, t.schema, consumerID, cursor)
+		t.checkHolder(ctx, dbc, consumerID)
+		return t.writeCursor(ctx, dbc, consumerID, cursor, f)
+	}
+
+	if f != nil && f.isFenced() {
+		return errors.Wrap(reflex.ErrCursorFenced, "", j.KS("consumer", consumerID))
 	}
 
 	t.cursorOnce.Do(func() {
-		go t.flushForever()
+		if t.policy.Period > 0 {
+			go t.flushForever()
+		}
 	})
 
 	t.cursorMu.Lock()
-	defer t.cursorMu.Unlock()
-
 	if t.asyncCursors == nil {
 		t.asyncCursors = make(map[string]string)
+		t.asyncFences = make(map[string]*cursorFence)
 		t.asyncDBC = dbc
 	}
 
 	t.asyncCursors[consumerID] = cursor
+	t.asyncFences[consumerID] = f
+	t.asyncSets++
+	flush := t.policy.Sets > 0 && t.asyncSets >= t.policy.Sets
+	t.cursorMu.Unlock()
+
+	if flush {
+		return t.Flush(ctx)
+	}
+
 	return nil
 }
 
+// ResetCursor sets the consumer's cursor even if it is before the current
+// cursor. Any pending async cursor of the consumer is discarded.
+func (t *ctable) ResetCursor(ctx context.Context, dbc *sql.DB, consumerID string, cursor string) error {
+	_, err := t.schema.cursorType.Cast(cursor)
+	if err != nil {
+		return err
+	}
+	consumerID = t.schema.key(consumerID)
+
+	t.cursorMu.Lock()
+	delete(t.asyncCursors, consumerID)
+	t.cursorMu.Unlock()
+
+	t.setCounter()
+	t.checkHolder(ctx, dbc, consumerID)
+	return resetCursor(ctx, dbc, t.schema, consumerID, cursor)
+}
+
+// ListCursors returns all cursors stored in the table ordered by consumer id.
+// Note that pending async cursors are not included.
+func (t *ctable) ListCursors(ctx context.Context, dbc *sql.DB) ([]Cursor, error) {
+	return listCursors(ctx, dbc, t.schema)
+}
+
+// DeleteCursor deletes the consumer's cursor or returns ErrCursorNotFound.
+// Any pending async cursor of the consumer is discarded.
+func (t *ctable) DeleteCursor(ctx context.Context, dbc *sql.DB, consumerID string) error {
+	consumerID = t.schema.key(consumerID)
+
+	t.cursorMu.Lock()
+	delete(t.asyncCursors, consumerID)
+	delete(t.held, consumerID)
+	t.cursorMu.Unlock()
+
+	return deleteCursor(ctx, dbc, t.schema, consumerID)
+}
+
+// CloneCursor sets (or resets) the cursor of the "to" consumer to the
+// stored cursor of the "from" consumer or returns ErrCursorNotFound.
+func (t *ctable) CloneCursor(ctx context.Context, dbc *sql.DB, fromID, toID string) error {
+	cursor, err := t.GetCursor(ctx, dbc, fromID)
+	if err != nil {
+		return err
+	} else if cursor == "" {
+		return errors.Wrap(ErrCursorNotFound, "", j.KS("consumer", fromID))
+	}
+
+	return t.ResetCursor(ctx, dbc, toID, cursor)
+}
+
 func (t *ctable) isAsyncEnabled() bool {
-	return t.asyncPeriod > 0
+	return t.async
 }
 
 func (t *ctable) Flush(ctx context.Context) error {
@@ -199,7 +480,10 @@ func (t *ctable) Flush(ctx context.Context) error {
 	t.cursorMu.Lock()
 	dbc := t.asyncDBC
 	m := t.asyncCursors
+	fences := t.asyncFences
 	t.asyncCursors = nil
+	t.asyncFences = nil
+	t.asyncSets = 0
 
 	if len(m) == 0 {
 		// Nothing to flush
@@ -213,11 +497,95 @@ func (t *ctable) Flush(ctx context.Context) error {
 	defer t.flushMu.Unlock()
 
 	// TODO(corver): Write all at once.
+	var fenced error
 	for id, cursor := range m {
 		t.setCounter()
-		err := setCursor(ctx, dbc, t.schema, id, cursor)
+		t.checkHolder(ctx, dbc, id)
+		err := t.writeCursor(ctx, dbc, id, cursor, fences[id])
+		if errors.Is(err, reflex.ErrCursorFenced) {
+			// Don't drop the cursors of other consumers.
+			fenced = err
+			continue
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return fenced
+}
+
+// writeCursor writes the cursor to the DB, rejecting it if the fence is fenced.
+func (t *ctable) writeCursor(ctx context.Context, dbc *sql.DB, consumerID string,
+	cursor string, f *cursorFence) error {
+
+	if f == nil {
+		return setCursor(ctx, dbc, t.schema, consumerID, cursor, nil)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.fenced {
+		return errors.Wrap(reflex.ErrCursorFenced, "", j.KS("consumer", consumerID))
+	}
+
+	err := setCursor(ctx, dbc, t.schema, consumerID, cursor, f)
+	if errors.Is(err, reflex.ErrCursorFenced) {
+		f.fenced = true
+	}
+	return err
+}
+
+func (f *cursorFence) isFenced() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fenced
+}
+
+// checkHolder logs ErrCursorHolderConflict if another holder wrote the
+// consumer's cursor within the holder timeout and marks the cursor as held.
+func (t *ctable) checkHolder(ctx context.Context, dbc *sql.DB, consumerID string) {
+	if !t.schema.holder.enabled() {
+		return
+	}
+
+	t.cursorMu.Lock()
+	if t.held == nil {
+		t.held = make(map[string]bool)
+	}
+	t.held[consumerID] = true
+	t.cursorMu.Unlock()
+
+	err := checkCursorHolder(ctx, dbc, t.schema, consumerID)
+	if errors.Is(err, ErrCursorHolderConflict) {
+		cursorHolderConflictCounter.WithLabelValues(t.schema.name).Inc()
+		log.Error(ctx, err)
+	} else if err != nil {
+		log.Error(ctx, errors.Wrap(err, "reflex: error checking cursor holder"))
+	}
+}
+
+// heartbeat writes the heartbeats of the cursors held by this holder.
+func (t *ctable) heartbeat(ctx context.Context) error {
+	if !t.schema.holder.enabled() {
+		return nil
+	}
+
+	t.cursorMu.Lock()
+	dbc := t.asyncDBC
+	var ids []string
+	for id := range t.held {
+		ids = append(ids, id)
+	}
+	t.cursorMu.Unlock()
+
+	for _, id := range ids {
+		ok, err := heartbeatCursor(ctx, dbc, t.schema, id)
 		if err != nil {
 			return err
+		} else if !ok {
+			// Another holder took over.
+			t.checkHolder(ctx, dbc, id)
 		}
 	}
 
@@ -234,18 +602,25 @@ func (t *ctable) Clone(ol ...CursorsOption) CursorsTable {
 			idField:     t.schema.idField,
 			timefield:   t.schema.timefield,
 			cursorType:  t.schema.cursorType,
+			dialect:     t.schema.dialect,
+			holder:      t.schema.holder,
+			fencing:     t.schema.fencing,
+			epochField:  t.schema.epochField,
+			tenantField: t.schema.tenantField,
+			tenant:      t.schema.tenant,
 		},
-		sleep:       t.sleep,
-		asyncDBC:    t.asyncDBC,
-		asyncPeriod: t.asyncPeriod,
-		setCounter:  t.setCounter,
+		sleep:      t.sleep,
+		asyncDBC:   t.asyncDBC,
+		async:      t.async,
+		policy:     t.policy,
+		setCounter: t.setCounter,
 	}
 
 	for _, o := range ol {
 		o(table)
 	}
 
-	if table.isAsyncEnabled() {
+	if table.isAsyncEnabled() && table.policy.Period > 0 {
 		go table.flushForever()
 	}
 
@@ -265,12 +640,15 @@ func (t *ctable) ToStore(dbc *sql.DB, ol ...CursorsOption) reflex.CursorStore {
 
 func (t *ctable) flushForever() {
 	for {
-		t.sleep(t.asyncPeriod)
+		t.sleep(t.policy.Period)
 
 		ctx := context.Background()
 		if err := t.Flush(ctx); err != nil {
 			log.Error(ctx, errors.Wrap(err, "reflex: error flushing cursor"))
 		}
+		if err := t.heartbeat(ctx); err != nil {
+			log.Error(ctx, errors.Wrap(err, "reflex: error writing cursor heartbeat"))
+		}
 	}
 }
 
@@ -287,6 +665,60 @@ func (cs *cursorStore) SetCursor(ctx context.Context, consumerName string, curso
 	return cs.t.SetCursor(ctx, cs.dbc, consumerName, cursor)
 }
 
+func (cs *cursorStore) ResetCursor(ctx context.Context, consumerName string, cursor string) error {
+	return cs.t.ResetCursor(ctx, cs.dbc, consumerName, cursor)
+}
+
 func (cs *cursorStore) Flush(ctx context.Context) error {
 	return cs.t.Flush(ctx)
 }
+
+// Fence implements reflex.CursorFencer by acquiring the next epoch of the
+// consumer's cursor if fencing is enabled, see WithCursorFencing. Otherwise
+// it returns the store itself. Consumers without a cursor are fenced by
+// their first cursor write.
+func (cs *cursorStore) Fence(ctx context.Context, consumerName string) (reflex.CursorStore, error) {
+	if !cs.t.schema.fencing {
+		return cs, nil
+	}
+
+	epoch, err := acquireEpoch(ctx, cs.dbc, cs.t.schema, cs.t.schema.key(consumerName))
+	if err != nil {
+		return nil, err
+	}
+
+	f := &cursorFence{epoch: epoch}
+	if epoch == 0 {
+		f.epoch = 1
+		f.insert = true
+	}
+
+	return &fencedStore{cs: cs, f: f}, nil
+}
+
+// fencedStore is a cursor store that rejects cursor writes of stale epochs.
+type fencedStore struct {
+	cs *cursorStore
+	f  *cursorFence
+}
+
+func (fs *fencedStore) GetCursor(ctx context.Context, consumerName string) (string, error) {
+	return fs.cs.GetCursor(ctx, consumerName)
+}
+
+func (fs *fencedStore) SetCursor(ctx context.Context, consumerName string, cursor string) error {
+	return fs.cs.t.setCursor(ctx, fs.cs.dbc, consumerName, cursor, fs.f)
+}
+
+func (fs *fencedStore) Flush(ctx context.Context) error {
+	return fs.cs.Flush(ctx)
+}
+
+// ResetCursor implements reflex.CursorResetter, see Replay. It returns
+// ErrCursorFenced if a later epoch was acquired.
+func (fs *fencedStore) ResetCursor(ctx context.Context, consumerName string, cursor string) error {
+	if fs.f.isFenced() {
+		return errors.Wrap(reflex.ErrCursorFenced, "", j.KS("consumer", consumerName))
+	}
+	return fs.cs.ResetCursor(ctx, consumerName, cursor)
+}
@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
 	"github.com/luno/reflex/rsql"
 	"github.com/stretchr/testify/require"
 )
@@ -144,6 +146,228 @@ func TestSyncSetCursor(t *testing.T) {
 	require.Equal(t, 0, s.Count())
 }
 
+func TestFlushPolicySets(t *testing.T) {
+	dbc := ConnectTestDB(t, "", "cursors")
+	defer dbc.Close()
+
+	var sets int
+	ct := rsql.NewCursorsTable(
+		"cursors",
+		rsql.WithCursorFlushPolicy(rsql.FlushPolicy{Sets: 3}),
+		rsql.WithCursorSetCounter(func() { sets++ }),
+	)
+
+	ctx := context.Background()
+	for i := 1; i <= 7; i++ {
+		err := ct.SetCursor(ctx, dbc, "test", strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+
+	// Only flushed after 3rd and 6th sets.
+	c, err := ct.GetCursor(ctx, dbc, "test")
+	require.NoError(t, err)
+	require.Equal(t, "6", c)
+	require.Equal(t, 2, sets)
+
+	err = ct.Flush(ctx)
+	require.NoError(t, err)
+
+	c, err = ct.GetCursor(ctx, dbc, "test")
+	require.NoError(t, err)
+	require.Equal(t, "7", c)
+	require.Equal(t, 3, sets)
+}
+
+func TestFlushPolicyShutdown(t *testing.T) {
+	dbc := ConnectTestDB(t, "", "cursors")
+	defer dbc.Close()
+
+	s := new(testSleep)
+	ct := rsql.NewCursorsTable(
+		"cursors",
+		rsql.WithCursorFlushPolicy(rsql.FlushPolicy{}),
+		rsql.WithTestCursorSleep(t, s.Block),
+	)
+
+	ctx := context.Background()
+	for i := 1; i <= 10; i++ {
+		err := ct.SetCursor(ctx, dbc, "test", strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+
+	c, err := ct.GetCursor(ctx, dbc, "test")
+	require.NoError(t, err)
+	require.Equal(t, "", c)
+
+	err = ct.Flush(ctx)
+	require.NoError(t, err)
+
+	c, err = ct.GetCursor(ctx, dbc, "test")
+	require.NoError(t, err)
+	require.Equal(t, "10", c)
+
+	// No background flushing.
+	require.Equal(t, 0, s.Count())
+}
+
+func TestResetCursor(t *testing.T) {
+	dbc := ConnectTestDB(t, "", "cursors")
+	defer dbc.Close()
+
+	ct := rsql.NewCursorsTable("cursors", rsql.WithCursorFlushPolicy(rsql.FlushPolicy{}))
+
+	ctx := context.Background()
+	err := ct.SetCursor(ctx, dbc, "test", "10")
+	require.NoError(t, err)
+	require.NoError(t, ct.Flush(ctx))
+
+	// Pending cursor discarded
+	err = ct.SetCursor(ctx, dbc, "test", "20")
+	require.NoError(t, err)
+
+	err = ct.ResetCursor(ctx, dbc, "test", "5")
+	require.NoError(t, err)
+	require.NoError(t, ct.Flush(ctx))
+
+	c, err := ct.GetCursor(ctx, dbc, "test")
+	require.NoError(t, err)
+	require.Equal(t, "5", c)
+
+	// Reset inserts new cursors
+	err = ct.ResetCursor(ctx, dbc, "new", "3")
+	require.NoError(t, err)
+
+	c, err = ct.GetCursor(ctx, dbc, "new")
+	require.NoError(t, err)
+	require.Equal(t, "3", c)
+}
+
+func TestCursorAdmin(t *testing.T) {
+	dbc := ConnectTestDB(t, "", "cursors")
+	defer dbc.Close()
+
+	ct := rsql.NewCursorsTable("cursors", rsql.WithCursorAsyncDisabled())
+
+	ctx := context.Background()
+	require.NoError(t, ct.SetCursor(ctx, dbc, "b", "20"))
+	require.NoError(t, ct.SetCursor(ctx, dbc, "a", "10"))
+
+	cl, err := ct.ListCursors(ctx, dbc)
+	require.NoError(t, err)
+	require.Len(t, cl, 2)
+	require.Equal(t, "a", cl[0].ConsumerID)
+	require.Equal(t, "10", cl[0].Cursor)
+	require.Equal(t, "b", cl[1].ConsumerID)
+	require.Equal(t, "20", cl[1].Cursor)
+
+	require.NoError(t, ct.CloneCursor(ctx, dbc, "b", "a"))
+	require.NoError(t, ct.CloneCursor(ctx, dbc, "a", "c"))
+
+	c, err := ct.GetCursor(ctx, dbc, "c")
+	require.NoError(t, err)
+	require.Equal(t, "20", c)
+
+	err = ct.CloneCursor(ctx, dbc, "unknown", "d")
+	jtest.Require(t, rsql.ErrCursorNotFound, err)
+
+	require.NoError(t, ct.DeleteCursor(ctx, dbc, "b"))
+	err = ct.DeleteCursor(ctx, dbc, "b")
+	jtest.Require(t, rsql.ErrCursorNotFound, err)
+
+	cl, err = ct.ListCursors(ctx, dbc)
+	require.NoError(t, err)
+	require.Len(t, cl, 2)
+}
+
+func TestCursorHolder(t *testing.T) {
+	dbc := ConnectTestDB(t, "", "cursors")
+	defer dbc.Close()
+
+	_, err := dbc.Exec("alter table cursors add holder_host varchar(255) null, " +
+		"add holder_pid int null, add heartbeat_at datetime null")
+	require.NoError(t, err)
+
+	opts := []rsql.CursorsOption{rsql.WithCursorAsyncDisabled(), rsql.WithCursorHolder(time.Minute)}
+	ct1 := rsql.NewCursorsTable("cursors", append(opts, rsql.WithTestCursorHolder(t, "host1", 1))...)
+	ct2 := rsql.NewCursorsTable("cursors", append(opts, rsql.WithTestCursorHolder(t, "host2", 2))...)
+
+	assertHolder := func(host string, pid int) {
+		cl, err := ct1.ListCursors(context.Background(), dbc)
+		require.NoError(t, err)
+		require.Len(t, cl, 1)
+		require.Equal(t, host, cl[0].HolderHost)
+		require.Equal(t, pid, cl[0].HolderPID)
+		require.False(t, cl[0].HeartbeatAt.IsZero())
+	}
+
+	ctx := context.Background()
+	require.NoError(t, ct1.SetCursor(ctx, dbc, "a", "10"))
+	assertHolder("host1", 1)
+
+	require.NoError(t, ct1.SetCursor(ctx, dbc, "a", "11"))
+	assertHolder("host1", 1)
+
+	// Split-brain writes are logged, not failed.
+	require.NoError(t, ct2.SetCursor(ctx, dbc, "a", "12"))
+	assertHolder("host2", 2)
+
+	require.NoError(t, ct1.ResetCursor(ctx, dbc, "a", "5"))
+	assertHolder("host1", 1)
+
+	c, err := ct2.GetCursor(ctx, dbc, "a")
+	require.NoError(t, err)
+	require.Equal(t, "5", c)
+}
+
+func TestCursorFencing(t *testing.T) {
+	dbc := ConnectTestDB(t, "", "cursors")
+	defer dbc.Close()
+
+	_, err := dbc.Exec("alter table cursors add epoch bigint not null default 0")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	fence := func(ct rsql.CursorsTable) reflex.CursorStore {
+		cs, err := ct.ToStore(dbc).(reflex.CursorFencer).Fence(ctx, "a")
+		require.NoError(t, err)
+		return cs
+	}
+
+	syncTable := rsql.NewCursorsTable("cursors", rsql.WithCursorAsyncDisabled(), rsql.WithCursorFencing())
+	asyncTable := rsql.NewCursorsTable("cursors", rsql.WithCursorAsyncPeriod(time.Hour), rsql.WithCursorFencing())
+
+	// The first write wins if the cursor doesn't exist.
+	cs1 := fence(syncTable)
+	cs2 := fence(syncTable)
+	require.NoError(t, cs1.SetCursor(ctx, "a", "1"))
+	err = cs2.SetCursor(ctx, "a", "2")
+	jtest.Require(t, reflex.ErrCursorFenced, err)
+
+	require.NoError(t, cs1.SetCursor(ctx, "a", "2"))
+
+	// Later epochs fence earlier ones.
+	cs3 := fence(syncTable)
+	err = cs1.SetCursor(ctx, "a", "3")
+	jtest.Require(t, reflex.ErrCursorFenced, err)
+	require.NoError(t, cs3.SetCursor(ctx, "a", "3"))
+
+	// Async writes are fenced on flush.
+	cs4 := fence(asyncTable)
+	jtest.Require(t, reflex.ErrCursorFenced, cs3.SetCursor(ctx, "a", "4"))
+	require.NoError(t, cs4.SetCursor(ctx, "a", "5"))
+	require.NoError(t, cs4.Flush(ctx))
+
+	cs5 := fence(syncTable)
+	require.NoError(t, cs4.SetCursor(ctx, "a", "6"))
+	jtest.Require(t, reflex.ErrCursorFenced, cs4.Flush(ctx))
+	jtest.Require(t, reflex.ErrCursorFenced, cs4.SetCursor(ctx, "a", "7"))
+	require.NoError(t, cs5.SetCursor(ctx, "a", "6"))
+
+	c, err := syncTable.GetCursor(ctx, dbc, "a")
+	require.NoError(t, err)
+	require.Equal(t, "6", c)
+}
+
 func newTestSleep() *testSleep {
 	return &testSleep{
 		block: true,
@@ -204,3 +428,50 @@ func waitForResult(t *testing.T, expect interface{}, f func() interface{}) {
 		time.Sleep(time.Millisecond) // don't spin
 	}
 }
+
+func TestCursorTenant(t *testing.T) {
+	dbc := ConnectTestDB(t, "", "cursors")
+	defer dbc.Close()
+
+	_, err := dbc.Exec("alter table cursors add tenant_id varchar(255) null")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	ct := rsql.NewCursorsTable("cursors", rsql.WithCursorAsyncDisabled())
+	cs1 := ct.ToStore(dbc, rsql.WithCursorTenant("t1"))
+	cs2 := ct.ToStore(dbc, rsql.WithCursorTenant("t2"))
+
+	require.NoError(t, cs1.SetCursor(ctx, "a", "10"))
+	require.NoError(t, cs2.SetCursor(ctx, "a", "20"))
+	require.NoError(t, cs2.SetCursor(ctx, "b", "30"))
+
+	// Tenants have separate cursors of the same consumer.
+	c, err := cs1.GetCursor(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, "10", c)
+
+	c, err = cs2.GetCursor(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, "20", c)
+
+	c, err = cs1.GetCursor(ctx, "b")
+	require.NoError(t, err)
+	require.Empty(t, c)
+
+	cl, err := ct.Clone(rsql.WithCursorTenant("t2")).ListCursors(ctx, dbc)
+	require.NoError(t, err)
+	require.Len(t, cl, 2)
+	require.Equal(t, "a", cl[0].ConsumerID)
+	require.Equal(t, "b", cl[1].ConsumerID)
+
+	var tenant string
+	err = dbc.QueryRow("select tenant_id from cursors where id='t1/a'").Scan(&tenant)
+	require.NoError(t, err)
+	require.Equal(t, "t1", tenant)
+
+	// Unscoped tables list all cursors by key.
+	cl, err = ct.ListCursors(ctx, dbc)
+	require.NoError(t, err)
+	require.Len(t, cl, 3)
+	require.Equal(t, "t1/a", cl[0].ConsumerID)
+}
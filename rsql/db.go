@@ -3,9 +3,13 @@ package rsql
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/luno/jettison"
@@ -28,44 +32,195 @@ func (t eventType) ReflexType() int {
 	return int(t)
 }
 
-// makeDefaultInserter returns the default sql inserter configured via WithEventsXField options.
-func makeDefaultInserter(schema etableSchema) inserter {
-	return func(ctx context.Context, tx *sql.Tx,
-		foreignID string, typ reflex.EventType, metadata []byte) error {
+// insertEvents inserts the events using a single insert statement
+// and returns their ids if known, see Dialect.insertedIDs.
+func insertEvents(ctx context.Context, tx *sql.Tx, schema etableSchema,
+	events []EventToInsert) ([]string, error) {
 
-		q := "insert into " + schema.name +
-			" set " + schema.foreignIDField + "=?, " + schema.timeField + "=now(6), " + schema.typeField + "=?"
-		args := []interface{}{foreignID, typ.ReflexType()}
+	cols := []string{schema.foreignIDField, schema.timeField, schema.typeField}
+	if schema.metadataField != "" {
+		cols = append(cols, schema.metadataField)
+	}
+	if schema.dedupField != "" {
+		cols = append(cols, schema.dedupField)
+	}
+	if schema.headersField != "" {
+		cols = append(cols, schema.headersField)
+	}
+	if schema.tenantField != "" {
+		cols = append(cols, schema.tenantField)
+	}
+	if schema.checksumField != "" {
+		cols = append(cols, schema.checksumField)
+	}
+	cols = append(cols, schema.foreignKeyFields...)
+
+	var (
+		rows [][]string
+		args []interface{}
+	)
+	for _, e := range events {
+		foreignID, err := schema.bindForeignID(e.ForeignID)
+		if err != nil {
+			return nil, err
+		}
+
+		vals := []string{"?", schema.dialect.nowMicros(), "?"}
+		args = append(args, foreignID, e.Type.ReflexType())
 
 		if schema.metadataField != "" {
-			q += ", " + schema.metadataField + "=?"
-			args = append(args, metadata)
-		} else if metadata != nil {
-			return errors.New("metadata not enabled")
+			vals = append(vals, "?")
+			args = append(args, e.MetaData)
+		} else if e.MetaData != nil {
+			return nil, errors.New("metadata not enabled")
+		}
+
+		if schema.dedupField != "" {
+			vals = append(vals, "?")
+			args = append(args, sql.NullString{String: e.DedupKey, Valid: e.DedupKey != ""})
+		} else if e.DedupKey != "" {
+			return nil, errors.New("dedup key not enabled")
 		}
 
-		_, err := tx.ExecContext(ctx, q, args...)
-		return errors.Wrap(err, "insert error")
+		headers, err := schema.bindHeaders(e.Headers)
+		if err != nil {
+			return nil, err
+		} else if schema.headersField != "" {
+			vals = append(vals, "?")
+			args = append(args, headers)
+		}
+
+		tenant, err := schema.bindTenant(e.TenantID)
+		if err != nil {
+			return nil, err
+		} else if schema.tenantField != "" {
+			vals = append(vals, "?")
+			args = append(args, tenant)
+		}
+
+		if schema.checksumField != "" {
+			vals = append(vals, "?")
+			args = append(args, schema.bindChecksum(foreignID, e.Type.ReflexType(),
+				e.TenantID, e.Headers, e.ForeignKeys, e.MetaData))
+		}
+
+		keys, err := schema.bindForeignKeys(e.ForeignKeys)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			vals = append(vals, "?")
+			args = append(args, key)
+		}
+
+		rows = append(rows, vals)
+	}
+
+	var q string
+	if len(rows) == 1 {
+		q = schema.dialect.insert(schema.name, cols, rows[0])
+	} else {
+		q = schema.dialect.insertRows(schema.name, cols, rows)
+	}
+	if schema.dedupField != "" {
+		q += schema.dialect.ignoreConflict(schema.dedupKeyFields...)
+	}
+
+	res, err := tx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "insert error", j.KV("count", len(events)))
 	}
+
+	return schema.dialect.insertedIDs(res, len(events)), nil
 }
 
 type row interface {
 	Scan(dest ...interface{}) error
 }
 
-func scan(row row) (*reflex.Event, error) {
-	var (
-		e  reflex.Event
-		id int64
-		t  eventType
-	)
-	err := row.Scan(&id, &e.ForeignID, &e.Timestamp, &t, &e.MetaData)
+// scan returns the scanned event. It verifies the event checksum if enabled
+// and the metadata is not lazy loaded, see WithEventChecksumField.
+func scan(row row, s *eventScanner) (*reflex.Event, error) {
+	e, sum, err := s.Scan(row)
 	if err != nil {
 		return nil, err
 	}
-	e.ID = strconv.FormatInt(id, 10)
-	e.Type = t
-	return &e, err
+	if s.schema.checksumField != "" && !s.schema.lazyMetadata {
+		if err := s.schema.verifyChecksum(e, sum); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// scanEvent returns the scanned event and its stored checksum if enabled.
+func scanEvent(row row, schema etableSchema) (*reflex.Event, sql.NullString, error) {
+	return newEventScanner(schema).Scan(row)
+}
+
+// eventScanner scans rows into events, reusing the scan destinations
+// between rows to reduce per-row allocations.
+type eventScanner struct {
+	schema etableSchema
+
+	id      int64
+	t       eventType
+	headers []byte
+	tenant  sql.NullString
+	sum     sql.NullString
+	keys    []sql.NullString
+	dest    []interface{}
+}
+
+func newEventScanner(schema etableSchema) *eventScanner {
+	s := &eventScanner{
+		schema: schema,
+		keys:   make([]sql.NullString, len(schema.foreignKeyFields)),
+	}
+	// Event field destinations are set per row.
+	s.dest = []interface{}{&s.id, nil, nil, &s.t, nil}
+	if schema.headersField != "" {
+		s.dest = append(s.dest, &s.headers)
+	}
+	if schema.tenantField != "" {
+		s.dest = append(s.dest, &s.tenant)
+	}
+	if schema.checksumField != "" {
+		s.dest = append(s.dest, &s.sum)
+	}
+	for i := range s.keys {
+		s.dest = append(s.dest, &s.keys[i])
+	}
+	return s
+}
+
+// Scan returns the event scanned from the row, reusing a released
+// event if pooled (see WithEventsPool), and its stored checksum if enabled.
+func (s *eventScanner) Scan(row row) (*reflex.Event, sql.NullString, error) {
+	e := s.schema.newEvent()
+	s.dest[1], s.dest[2], s.dest[4] = &e.ForeignID, &e.Timestamp, &e.MetaData
+
+	err := row.Scan(s.dest...)
+	if err != nil {
+		return nil, s.sum, err
+	}
+	e.ID = strconv.FormatInt(s.id, 10)
+	e.Type = s.t
+	e.TenantID = s.tenant.String
+	e.Headers, err = decodeHeaders(s.headers)
+	if err != nil {
+		return nil, s.sum, errors.Wrap(err, "decode headers error", j.KS("id", e.ID))
+	}
+	for i, key := range s.keys {
+		if !key.Valid {
+			continue
+		}
+		if e.ForeignKeys == nil {
+			e.ForeignKeys = make(map[string]string)
+		}
+		e.ForeignKeys[s.schema.foreignKeyFields[i]] = key.String
+	}
+	return e, s.sum, nil
 }
 
 func getLatestID(ctx context.Context, dbc *sql.DB, schema etableSchema) (int64, error) {
@@ -77,31 +232,351 @@ func getLatestID(ctx context.Context, dbc *sql.DB, schema etableSchema) (int64,
 	return id.Int64, nil
 }
 
-func getNextEvents(ctx context.Context, dbc *sql.DB, schema etableSchema,
-	after int64, lag time.Duration) ([]*reflex.Event, error) {
+// getCursorAtTime returns the cursor (previous event ID) from which to stream
+// the first event at or after t. It binary searches the table by id which
+// assumes that event timestamps increase with event ids.
+func getCursorAtTime(ctx context.Context, dbc *sql.DB, schema etableSchema,
+	t time.Time) (int64, error) {
+
+	hi, err := getLatestID(ctx, dbc, schema)
+	if err != nil {
+		return 0, err
+	}
+
+	var lo int64
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+
+		var (
+			id int64
+			ts time.Time
+		)
+		err := dbc.QueryRowContext(ctx, schema.dialect.rebind("select id, "+schema.timeField+
+			" from "+schema.name+" where id>=? order by id asc limit 1"), mid).Scan(&id, &ts)
+		if err != nil {
+			return 0, errors.Wrap(err, "query event time error")
+		}
+
+		if ts.Before(t) {
+			// All events up to id are before t.
+			lo = id
+			if lo > hi {
+				lo = hi
+			}
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	return lo, nil
+}
+
+// insertEventsWithIDs inserts the events preserving their IDs and timestamps.
+// The metadata is encoded, see encodeMetadata.
+func insertEventsWithIDs(ctx context.Context, tx *sql.Tx, schema etableSchema,
+	events []*reflex.Event) error {
+
+	cols := []string{"id", schema.foreignIDField, schema.timeField, schema.typeField}
+	if schema.metadataField != "" {
+		cols = append(cols, schema.metadataField)
+	}
+	if schema.headersField != "" {
+		cols = append(cols, schema.headersField)
+	}
+	if schema.tenantField != "" {
+		cols = append(cols, schema.tenantField)
+	}
+	if schema.checksumField != "" {
+		cols = append(cols, schema.checksumField)
+	}
+	cols = append(cols, schema.foreignKeyFields...)
 
 	var (
-		q    string
+		rows [][]string
 		args []interface{}
 	)
+	for _, e := range events {
+		if !e.IsIDInt() {
+			return ErrInvalidIntID
+		}
 
-	q += "select id, " + schema.foreignIDField + ", " + schema.timeField + ", " + schema.typeField
-	if schema.metadataField != "" {
-		q += " , " + schema.metadataField
-	} else {
-		q += ", null"
+		foreignID, err := schema.bindForeignID(e.ForeignID)
+		if err != nil {
+			return err
+		}
+
+		vals := []string{"?", "?", "?", "?"}
+		args = append(args, e.IDInt(), foreignID, e.Timestamp, e.Type.ReflexType())
+
+		var metadata []byte
+		if schema.metadataField != "" {
+			metadata, err = schema.encodeMetadata(e.MetaData)
+			if err != nil {
+				return err
+			}
+			vals = append(vals, "?")
+			args = append(args, metadata)
+		} else if e.MetaData != nil {
+			return errors.New("metadata not enabled")
+		}
+
+		headers, err := schema.bindHeaders(e.Headers)
+		if err != nil {
+			return err
+		} else if schema.headersField != "" {
+			vals = append(vals, "?")
+			args = append(args, headers)
+		}
+
+		tenant, err := schema.bindTenant(e.TenantID)
+		if err != nil {
+			return err
+		} else if schema.tenantField != "" {
+			vals = append(vals, "?")
+			args = append(args, tenant)
+		}
+
+		if schema.checksumField != "" {
+			vals = append(vals, "?")
+			args = append(args, schema.bindChecksum(foreignID, e.Type.ReflexType(),
+				e.TenantID, e.Headers, e.ForeignKeys, metadata))
+		}
+
+		keys, err := schema.bindForeignKeys(e.ForeignKeys)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			vals = append(vals, "?")
+			args = append(args, key)
+		}
+
+		rows = append(rows, vals)
+	}
+
+	_, err := tx.ExecContext(ctx, schema.dialect.insertRows(schema.name, cols, rows), args...)
+	if err != nil {
+		return errors.Wrap(err, "insert events error", j.KV("count", len(events)))
 	}
 
-	q += " from " + schema.name + " where id>?"
+	return nil
+}
+
+func getNextEvents(ctx context.Context, dbc *sql.DB, schema etableSchema,
+	after int64, lag time.Duration, limit int) ([]*reflex.Event, error) {
+
+	var args []interface{}
+
+	q := selectEventsQuery(schema) + queryHint(schema) + " where id>?"
 	args = append(args, after)
 
 	// TODO(corver): Remove support for lag since we now do this at destination.
 	if lag > 0 {
-		q += " and " + schema.timeField + "<timestamp(now()-interval ? second) "
-		args = append(args, lag.Seconds())
+		cond, arg := schema.dialect.before(schema.timeField, lag)
+		q += " and " + cond
+		args = append(args, arg)
+	}
+
+	q += " order by id asc limit ?"
+	args = append(args, limit)
+
+	el, err := queryEvents(ctx, dbc, schema, schema.dialect.rebind(q), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return el, decodeEvents(schema, el)
+}
+
+// getNextIDs returns the ids and timestamps of the events after
+// the provided id, see makeFilterLoader.
+func getNextIDs(ctx context.Context, dbc *sql.DB, schema etableSchema,
+	after int64, lag time.Duration, limit int) ([]*reflex.Event, error) {
+
+	var args []interface{}
+
+	q := "select id, " + schema.timeField + " from " + schema.name + queryHint(schema) + " where id>?"
+	args = append(args, after)
+
+	if lag > 0 {
+		cond, arg := schema.dialect.before(schema.timeField, lag)
+		q += " and " + cond
+		args = append(args, arg)
+	}
+
+	q += " order by id asc limit ?"
+	args = append(args, limit)
+
+	rows, err := dbc.QueryContext(ctx, schema.dialect.rebind(q), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var el []*reflex.Event
+	for rows.Next() {
+		var (
+			e  reflex.Event
+			id int64
+		)
+		if err := rows.Scan(&id, &e.Timestamp); err != nil {
+			return nil, err
+		}
+		e.ID = strconv.FormatInt(id, 10)
+		el = append(el, &e)
+	}
+
+	return el, rows.Err()
+}
+
+// getFilteredEvents returns the events after floor up to and including
+// the provided id that match the types (if any), the foreign ID prefix,
+// the foreign keys and the tenant of the filter. Note the prefix comparison
+// depends on the column collation, so events should also be matched by
+// the caller.
+func getFilteredEvents(ctx context.Context, dbc *sql.DB, schema etableSchema,
+	floor, to int64, filter reflex.StreamOptions) ([]*reflex.Event, error) {
+
+	q := selectEventsQuery(schema) + " where id>? and id<=?"
+	args := []interface{}{floor, to}
+
+	if types := filter.StreamTypes; len(types) > 0 {
+		var vals []string
+		for _, typ := range types {
+			vals = append(vals, "?")
+			args = append(args, typ.ReflexType())
+		}
+		q += " and " + schema.typeField + " in (" + strings.Join(vals, ", ") + ")"
+	}
+
+	if prefix := filter.StreamForeignIDPrefix; prefix != "" {
+		q += " and substr(" + schema.foreignIDField + ", 1, ?)=?"
+		args = append(args, utf8.RuneCountInString(prefix), prefix)
+	}
+
+	foreignKeys := filter.StreamForeignKeys
+	var fields []string
+	for field := range foreignKeys {
+		if !schema.isForeignKeyField(field) {
+			return nil, errors.New("foreign key not enabled", j.KS("key", field))
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		q += " and " + field + "=?"
+		args = append(args, foreignKeys[field])
+	}
+
+	if filter.StreamTenant != "" {
+		if schema.tenantField == "" {
+			return nil, errors.New("tenancy not enabled")
+		}
+		q += " and " + schema.tenantField + "=?"
+		args = append(args, filter.StreamTenant)
+	}
+
+	q += " order by id asc"
+
+	el, err := queryEvents(ctx, dbc, schema, schema.dialect.rebind(q), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return el, decodeEvents(schema, el)
+}
+
+// getPrevEvents returns the events after floor and before the
+// provided id in descending order.
+func getPrevEvents(ctx context.Context, dbc *sql.DB, schema etableSchema,
+	floor, before int64) ([]*reflex.Event, error) {
+
+	q := selectEventsQuery(schema) + " where id>? and id<? order by id desc limit ?"
+
+	el, err := queryEvents(ctx, dbc, schema, schema.dialect.rebind(q), floor, before, defaultFetchLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return el, decodeEvents(schema, el)
+}
+
+// selectEventsQuery returns the select query prefix of events
+// which can be scanned by scan.
+func selectEventsQuery(schema etableSchema) string {
+	q := "select id, " + schema.foreignIDField + ", " + schema.timeField + ", " + schema.typeField
+	if schema.metadataField != "" && !schema.lazyMetadata {
+		q += " , " + schema.metadataField
+	} else {
+		q += ", null"
+	}
+	if schema.headersField != "" {
+		q += ", " + schema.headersField
+	}
+	if schema.tenantField != "" {
+		q += ", " + schema.tenantField
+	}
+	if schema.checksumField != "" {
+		q += ", " + schema.checksumField
+	}
+	for _, field := range schema.foreignKeyFields {
+		q += ", " + field
+	}
+	return q + " from " + schema.name
+}
+
+// queryHint returns the schema's query hint prefixed with a space or
+// an empty string, see WithEventsQueryHint.
+func queryHint(schema etableSchema) string {
+	if schema.queryHint == "" {
+		return ""
+	}
+	return " " + schema.queryHint
+}
+
+// getMetadata returns the metadata of the events with the provided ids.
+func getMetadata(ctx context.Context, dbc *sql.DB, schema etableSchema,
+	ids []int64) (map[int64][]byte, error) {
+
+	res := make(map[int64][]byte)
+	if len(ids) == 0 {
+		return res, nil
 	}
 
-	q += " order by id asc limit 1000"
+	q := "select id, " + schema.metadataField + " from " + schema.name +
+		" where id in (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+
+	var args []interface{}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := dbc.QueryContext(ctx, schema.dialect.rebind(q), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id       int64
+			metadata []byte
+		)
+		if err := rows.Scan(&id, &metadata); err != nil {
+			return nil, err
+		}
+		metadata, err := schema.decodeMetadata(metadata)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode metadata error", j.KV("id", id))
+		}
+		res[id] = metadata
+	}
+
+	return res, rows.Err()
+}
+
+func queryEvents(ctx context.Context, dbc *sql.DB, schema etableSchema, q string,
+	args ...interface{}) ([]*reflex.Event, error) {
 
 	rows, err := dbc.QueryContext(ctx, q, args...)
 	if err != nil {
@@ -110,8 +585,9 @@ func getNextEvents(ctx context.Context, dbc *sql.DB, schema etableSchema,
 	defer rows.Close()
 
 	var el []*reflex.Event
+	s := newEventScanner(schema)
 	for rows.Next() {
-		batch, err := scan(rows)
+		batch, err := scan(rows, s)
 		if err != nil {
 			return nil, err
 		}
@@ -124,7 +600,7 @@ func getNextEvents(ctx context.Context, dbc *sql.DB, schema etableSchema,
 
 func GetNextEventsForTesting(t *testing.T, ctx context.Context, dbc *sql.DB,
 	table *EventsTable, after int64, lag time.Duration) ([]*reflex.Event, error) {
-	return getNextEvents(ctx, dbc, table.schema, after, lag)
+	return getNextEvents(ctx, dbc, table.schema, after, lag, defaultFetchLimit)
 }
 
 func GetLatestIDForTesting(t *testing.T, ctx context.Context, dbc *sql.DB, eventTable string) (int64, error) {
@@ -137,6 +613,16 @@ func isMySQLErrCantWrite(err error) bool {
 	return isMySQLErrReadOnly(err) || isMySQLErrNoAccess(err)
 }
 
+// isErrConn returns true if the error is due to a bad or closed connection
+// which the pool replaces, so the query can be retried.
+func isErrConn(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, mysql.ErrInvalidConn)
+}
+
 func isMySQLErrDupEntry(err error) bool {
 	return isMySQLErr(err, 1062)
 }
@@ -176,8 +662,8 @@ func isMySQLErr(err error, nums ...uint16) bool {
 
 func getCursor(ctx context.Context, dbc *sql.DB, schema ctableSchema, id string) (string, error) {
 	var cursor string
-	err := dbc.QueryRowContext(ctx, "select "+schema.cursorField+
-		" from "+schema.name+" where "+schema.idField+"=?", id).Scan(&cursor)
+	err := dbc.QueryRowContext(ctx, schema.dialect.rebind("select "+schema.cursorField+
+		" from "+schema.name+" where "+schema.idField+"=?"), id).Scan(&cursor)
 	if errors.Is(err, sql.ErrNoRows) {
 		return "", nil
 	} else if err != nil {
@@ -186,10 +672,121 @@ func getCursor(ctx context.Context, dbc *sql.DB, schema ctableSchema, id string)
 	return cursor, nil
 }
 
+// listCursors returns all cursors in the table ordered by consumer id.
+func listCursors(ctx context.Context, dbc *sql.DB, schema ctableSchema) ([]Cursor, error) {
+	h := schema.holder
+	var holderCols string
+	if h.enabled() {
+		holderCols = ", " + h.hostField + ", " + h.pidField + ", " + h.heartbeatField
+	}
+
+	var (
+		where string
+		args  []interface{}
+	)
+	if schema.tenant != "" {
+		where = " where " + schema.tenantField + "=?"
+		args = append(args, schema.tenant)
+	}
+
+	rows, err := dbc.QueryContext(ctx, schema.dialect.rebind("select "+schema.idField+", "+
+		schema.cursorField+", "+schema.timefield+holderCols+" from "+schema.name+where+
+		" order by "+schema.idField), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "list cursors error")
+	}
+	defer rows.Close()
+
+	var res []Cursor
+	for rows.Next() {
+		var (
+			c         Cursor
+			host      sql.NullString
+			pid       sql.NullInt64
+			heartbeat sql.NullTime
+		)
+		dest := []interface{}{&c.ConsumerID, &c.Cursor, &c.UpdatedAt}
+		if h.enabled() {
+			dest = append(dest, &host, &pid, &heartbeat)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.Wrap(err, "scan cursor error")
+		}
+		c.ConsumerID = schema.consumerID(c.ConsumerID)
+		c.HolderHost = host.String
+		c.HolderPID = int(pid.Int64)
+		c.HeartbeatAt = heartbeat.Time
+		res = append(res, c)
+	}
+
+	return res, rows.Err()
+}
+
+// deleteCursor deletes the processor's cursor and returns ErrCursorNotFound
+// if it doesn't exist.
+func deleteCursor(ctx context.Context, dbc *sql.DB, schema ctableSchema, id string) error {
+	return schema.dialect.retry(ctx, func() error {
+		return deleteCursorOnce(ctx, dbc, schema, id)
+	})
+}
+
+func deleteCursorOnce(ctx context.Context, dbc *sql.DB, schema ctableSchema, id string) error {
+	res, err := dbc.ExecContext(ctx, schema.dialect.rebind("delete from "+schema.name+
+		" where "+schema.idField+"=?"), id)
+	if err != nil {
+		return errors.Wrap(err, "delete cursor error", j.KS("consumer", id))
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected error", j.KS("consumer", id))
+	} else if n == 0 {
+		return errors.Wrap(ErrCursorNotFound, "", j.KS("consumer", id))
+	}
+
+	return nil
+}
+
+// resetCursor sets the processor's cursor to `cursor` even if
+// it is less than the existing cursor.
+func resetCursor(ctx context.Context, dbc *sql.DB, schema ctableSchema,
+	id string, cursor string) error {
+
+	c, err := schema.cursorType.Cast(cursor)
+	if err != nil {
+		return err
+	}
+
+	d := schema.dialect
+	hcols, hvals, hupdates, hargs := schema.writes(d)
+	args := append(append([]interface{}{id, c}, hargs...), c)
+	args = append(args, hargs...)
+
+	err = d.retry(ctx, func() error {
+		_, err := dbc.ExecContext(ctx, d.upsert(schema.name, schema.idField,
+			append([]string{schema.idField, schema.cursorField, schema.timefield}, hcols...),
+			append([]string{"?", "?", d.now()}, hvals...),
+			append([]string{schema.cursorField + "=?", schema.timefield + "=" + d.now()},
+				hupdates...)), args...)
+		return err
+	})
+	return errors.Wrap(err, "reset cursor error",
+		j.KS("consumer", id), j.KS("cursor", cursor))
+}
+
 // setCursor sets the processor's last successfully processed event ID to
 // `id`.
 func setCursor(ctx context.Context, dbc *sql.DB, schema ctableSchema,
-	id string, cursor string) error {
+	id string, cursor string, f *cursorFence) error {
+	return schema.dialect.retry(ctx, func() error {
+		return setCursorOnce(ctx, dbc, schema, id, cursor, f)
+	})
+}
+
+// setCursorOnce sets the cursor. If the fence is not nil, the cursor is only
+// set if the stored epoch matches, otherwise reflex.ErrCursorFenced is returned.
+func setCursorOnce(ctx context.Context, dbc *sql.DB, schema ctableSchema,
+	id string, cursor string, f *cursorFence) error {
 	opts := []jettison.Option{j.KS("consumer", id), j.KS("cursor", cursor)}
 
 	// 😱: mysql uses "numerical" comparison if you compare a db string to an int.
@@ -198,31 +795,171 @@ func setCursor(ctx context.Context, dbc *sql.DB, schema ctableSchema,
 		return err
 	}
 
-	res, err := dbc.ExecContext(ctx, "update "+schema.name+
-		" set "+schema.cursorField+"=?, "+schema.timefield+"=now() where "+schema.idField+"=?"+
-		" and "+schema.cursorField+"<?",
-		c, id, c)
-	if err != nil {
-		return errors.Wrap(err, "set cursor error", opts...)
+	hcols, hvals, hupdates, hargs := schema.writes(schema.dialect)
+	var holderSets string
+	for _, u := range hupdates {
+		holderSets += ", " + u
 	}
-	rows, err := res.RowsAffected()
-	if err != nil {
-		return errors.Wrap(err, "rows affected error", opts...)
-	} else if rows > 1 {
-		return errors.New("invalid rows affected error", opts...)
-	} else if rows == 1 {
-		// done
-		return nil
+
+	if f == nil || !f.insert {
+		args := append(append([]interface{}{c}, hargs...), id, c)
+		var fenceCond string
+		if f != nil {
+			fenceCond = " and " + schema.epochField + "=?"
+			args = append(args, f.epoch)
+		}
+
+		res, err := dbc.ExecContext(ctx, schema.dialect.rebind("update "+schema.name+
+			" set "+schema.cursorField+"=?, "+schema.timefield+"="+schema.dialect.now()+
+			holderSets+
+			" where "+schema.idField+"=?"+
+			" and "+schema.cursorField+"<?"+fenceCond),
+			args...)
+		if err != nil {
+			return errors.Wrap(err, "set cursor error", opts...)
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err, "rows affected error", opts...)
+		} else if rows > 1 {
+			return errors.New("invalid rows affected error", opts...)
+		} else if rows == 1 {
+			// done
+			return nil
+		}
+
+		if f != nil {
+			if err := checkEpoch(ctx, dbc, schema, id, f.epoch); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Insert since rows == 0
-	_, err = dbc.ExecContext(ctx, "insert into "+schema.name+" set "+schema.idField+"=?, "+
-		schema.cursorField+"=?, "+schema.timefield+"=now()", id, c)
-	if isMySQLErrDupEntry(err) {
+	cols := append([]string{schema.idField, schema.cursorField, schema.timefield}, hcols...)
+	vals := append([]string{"?", "?", schema.dialect.now()}, hvals...)
+	args := append([]interface{}{id, c}, hargs...)
+	if f != nil {
+		cols = append(cols, schema.epochField)
+		vals = append(vals, "?")
+		args = append(args, f.epoch)
+	}
+
+	_, err = dbc.ExecContext(ctx, schema.dialect.insert(schema.name, cols, vals), args...)
+	if schema.dialect.isErrDupEntry(err) && f != nil && f.insert {
+		// Another store inserted the cursor after this store was fenced.
+		return errors.Wrap(reflex.ErrCursorFenced, "", j.MKV{"consumer": id, "epoch": f.epoch})
+	} else if schema.dialect.isErrDupEntry(err) {
 		return errors.Wrap(err, "attempted to set cursor <= existing cursor", opts...)
 	} else if err != nil {
 		return errors.Wrap(err, "insert cursor error", opts...)
 	}
 
+	if f != nil {
+		f.insert = false
+	}
+
+	return nil
+}
+
+// acquireEpoch increments and returns the fencing epoch of the cursor.
+// It returns zero if the cursor doesn't exist.
+func acquireEpoch(ctx context.Context, dbc *sql.DB, schema ctableSchema, id string) (int64, error) {
+	for {
+		var epoch int64
+		err := dbc.QueryRowContext(ctx, schema.dialect.rebind("select "+schema.epochField+
+			" from "+schema.name+" where "+schema.idField+"=?"), id).Scan(&epoch)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		} else if err != nil {
+			return 0, errors.Wrap(err, "query epoch error", j.KS("consumer", id))
+		}
+
+		res, err := dbc.ExecContext(ctx, schema.dialect.rebind("update "+schema.name+
+			" set "+schema.epochField+"=? where "+schema.idField+"=? and "+
+			schema.epochField+"=?"), epoch+1, id, epoch)
+		if err != nil {
+			return 0, errors.Wrap(err, "update epoch error", j.KS("consumer", id))
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, errors.Wrap(err, "rows affected error", j.KS("consumer", id))
+		} else if n == 1 {
+			return epoch + 1, nil
+		}
+
+		// Concurrently acquired, try again.
+	}
+}
+
+// checkEpoch returns reflex.ErrCursorFenced if the cursor's epoch
+// doesn't match or the cursor doesn't exist.
+func checkEpoch(ctx context.Context, dbc *sql.DB, schema ctableSchema, id string, epoch int64) error {
+	var current int64
+	err := dbc.QueryRowContext(ctx, schema.dialect.rebind("select "+schema.epochField+
+		" from "+schema.name+" where "+schema.idField+"=?"), id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrap(reflex.ErrCursorFenced, "cursor deleted", j.KS("consumer", id))
+	} else if err != nil {
+		return errors.Wrap(err, "query epoch error", j.KS("consumer", id))
+	} else if current != epoch {
+		return errors.Wrap(reflex.ErrCursorFenced, "", j.MKV{
+			"consumer": id,
+			"epoch":    epoch,
+			"current":  current,
+		})
+	}
 	return nil
 }
+
+// checkCursorHolder returns ErrCursorHolderConflict if another holder
+// wrote the cursor's heartbeat within the holder timeout.
+func checkCursorHolder(ctx context.Context, dbc *sql.DB, schema ctableSchema, id string) error {
+	h := schema.holder
+	before, arg := schema.dialect.before(h.heartbeatField, h.timeout)
+
+	var (
+		host sql.NullString
+		pid  sql.NullInt64
+	)
+	err := dbc.QueryRowContext(ctx, schema.dialect.rebind("select "+h.hostField+", "+
+		h.pidField+" from "+schema.name+" where "+schema.idField+"=? and not ("+
+		before+")"), id, arg).Scan(&host, &pid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "query cursor holder error", j.KS("consumer", id))
+	}
+
+	if !host.Valid || (host.String == h.host && pid.Int64 == int64(h.pid)) {
+		return nil
+	}
+
+	return errors.Wrap(ErrCursorHolderConflict, "", j.MKV{
+		"consumer": id,
+		"holder":   host.String + ":" + strconv.FormatInt(pid.Int64, 10),
+		"self":     h.host + ":" + strconv.Itoa(h.pid),
+	})
+}
+
+// heartbeatCursor writes the cursor's heartbeat and returns false
+// if the cursor is not held by the holder.
+func heartbeatCursor(ctx context.Context, dbc *sql.DB, schema ctableSchema, id string) (bool, error) {
+	h := schema.holder
+	res, err := dbc.ExecContext(ctx, schema.dialect.rebind("update "+schema.name+
+		" set "+h.heartbeatField+"="+schema.dialect.now()+" where "+schema.idField+"=?"+
+		" and "+h.hostField+"=? and "+h.pidField+"=?"), id, h.host, h.pid)
+	if err != nil {
+		return false, errors.Wrap(err, "heartbeat cursor error", j.KS("consumer", id))
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "rows affected error", j.KS("consumer", id))
+	}
+
+	// Note MySQL also returns 0 if the heartbeat didn't change within the
+	// same second, which the caller resolves by checking the holder.
+	return n > 0, nil
+}
@@ -0,0 +1,110 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+// NewDeliveriesTable returns a new deliveries table used to record the status
+// of deliveries to external endpoints, for example rpatterns webhooks.
+// The table requires a varchar "endpoint" and varchar "event_id" composite
+// primary key, int "status", "attempts" and "status_code" columns, a varchar
+// "error" and a datetime "updated_at" column.
+func NewDeliveriesTable(name string, opts ...DeliveriesOption) *DeliveriesTable {
+	table := &DeliveriesTable{
+		schema: dtableSchema{name: name},
+	}
+	for _, o := range opts {
+		o(table)
+	}
+	return table
+}
+
+// DeliveriesOption defines a functional option to configure new deliveries tables.
+type DeliveriesOption func(*DeliveriesTable)
+
+// WithDeliveryDialect provides an option to set the SQL dialect of the
+// database. It defaults to DialectMySQL.
+func WithDeliveryDialect(d Dialect) DeliveriesOption {
+	return func(table *DeliveriesTable) {
+		table.schema.dialect = d
+	}
+}
+
+// DeliveriesTable provides delivery statuses stored in a sql db table.
+type DeliveriesTable struct {
+	schema dtableSchema
+}
+
+type dtableSchema struct {
+	name    string
+	dialect Dialect
+}
+
+var deliveryCols = []string{"endpoint", "event_id", "status", "attempts",
+	"status_code", "error", "updated_at"}
+
+// Record inserts the delivery or replaces the existing delivery
+// of the event to the endpoint.
+func (t *DeliveriesTable) Record(ctx context.Context, dbc *sql.DB, d reflex.Delivery) error {
+	s := t.schema
+
+	var updates []string
+	for _, col := range deliveryCols[2:] {
+		if s.dialect == DialectMySQL {
+			updates = append(updates, col+"=values("+col+")")
+		} else {
+			updates = append(updates, col+"=excluded."+col)
+		}
+	}
+
+	q := s.dialect.upsert(s.name, "endpoint, event_id", deliveryCols,
+		[]string{"?", "?", "?", "?", "?", "?", "?"}, updates)
+
+	_, err := dbc.ExecContext(ctx, q, d.Endpoint, d.EventID, int(d.Status), d.Attempts,
+		d.StatusCode, d.Error, d.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(err, "record delivery error",
+			j.MKS{"endpoint": d.Endpoint, "event_id": d.EventID})
+	}
+
+	return nil
+}
+
+// Get returns the delivery of the event to the endpoint.
+// It returns ErrDeliveryNotFound if no delivery was recorded.
+func (t *DeliveriesTable) Get(ctx context.Context, dbc *sql.DB, endpoint,
+	eventID string) (*reflex.Delivery, error) {
+
+	s := t.schema
+	d := reflex.Delivery{Endpoint: endpoint, EventID: eventID}
+	err := dbc.QueryRowContext(ctx, s.dialect.rebind("select status, attempts, "+
+		"status_code, error, updated_at from "+s.name+" where endpoint=? and event_id=?"),
+		endpoint, eventID).Scan(&d.Status, &d.Attempts, &d.StatusCode, &d.Error, &d.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Wrap(ErrDeliveryNotFound, "",
+			j.MKS{"endpoint": endpoint, "event_id": eventID})
+	} else if err != nil {
+		return nil, errors.Wrap(err, "get delivery error")
+	}
+
+	return &d, nil
+}
+
+// ToStore returns a reflex DeliveryStore interface of this DeliveriesTable.
+func (t *DeliveriesTable) ToStore(dbc *sql.DB) reflex.DeliveryStore {
+	return &deliveryStore{t: t, dbc: dbc}
+}
+
+type deliveryStore struct {
+	t   *DeliveriesTable
+	dbc *sql.DB
+}
+
+func (s *deliveryStore) RecordDelivery(ctx context.Context, d reflex.Delivery) error {
+	return s.t.Record(ctx, s.dbc, d)
+}
@@ -0,0 +1,63 @@
+package rsql_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+const deliveriesSchema = `
+create temporary table %s (
+  endpoint varchar(255) not null,
+  event_id varchar(255) not null,
+  status int not null,
+  attempts int not null,
+  status_code int not null,
+  error varchar(255) not null,
+  updated_at datetime not null,
+
+  primary key (endpoint, event_id)
+);
+`
+
+func TestDeliveriesTable(t *testing.T) {
+	dbc := ConnectTestDB(t, "", "")
+	defer dbc.Close()
+
+	_, err := dbc.Exec(fmt.Sprintf(deliveriesSchema, "deliveries"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	table := rsql.NewDeliveriesTable("deliveries")
+
+	_, err = table.Get(ctx, dbc, "hook", "1")
+	jtest.Require(t, rsql.ErrDeliveryNotFound, err)
+
+	d := reflex.Delivery{
+		Endpoint:   "hook",
+		EventID:    "1",
+		Status:     reflex.DeliveryFailed,
+		Attempts:   1,
+		StatusCode: 500,
+		Error:      "webhook response error",
+		UpdatedAt:  time.Now().Truncate(time.Second),
+	}
+	jtest.RequireNil(t, table.ToStore(dbc).RecordDelivery(ctx, d))
+
+	// Replaces the existing delivery.
+	d.Status, d.Attempts, d.StatusCode, d.Error = reflex.DeliverySucceeded, 2, 200, ""
+	jtest.RequireNil(t, table.Record(ctx, dbc, d))
+
+	res, err := table.Get(ctx, dbc, "hook", "1")
+	jtest.RequireNil(t, err)
+	require.Equal(t, d.Status, res.Status)
+	require.Equal(t, d.Attempts, res.Attempts)
+	require.Equal(t, d.StatusCode, res.StatusCode)
+	require.Empty(t, res.Error)
+}
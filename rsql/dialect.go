@@ -0,0 +1,233 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luno/jettison/errors"
+)
+
+// Dialect defines the SQL dialect of the database backing a table.
+type Dialect int
+
+const (
+	// DialectMySQL is the default MySQL dialect.
+	DialectMySQL Dialect = 0
+
+	// DialectSQLite is the SQLite dialect. It requires a driver that parses
+	// datetime columns as time.Time (e.g. github.com/mattn/go-sqlite3) and
+	// an "integer primary key autoincrement" events id column.
+	DialectSQLite Dialect = 1
+
+	// DialectCockroach is the CockroachDB dialect. It requires a postgres
+	// driver (e.g. github.com/lib/pq) and an events id column defaulting to
+	// a sequence (not unique_rowid) since rsql requires consecutive ids.
+	// Statements failing with serialization errors are retried, see
+	// also ExecTx for inserting events.
+	DialectCockroach Dialect = 2
+)
+
+// maxRetries is the maximum number of times statements are retried.
+const maxRetries = 10
+
+// ExecTx calls fn with a new transaction and commits it. Transactions
+// that fail with retryable errors of the dialect (e.g. CockroachDB
+// serialization failures) are retried. Use it to insert events with
+// CockroachDB since inserters cannot retry the caller's transaction.
+func ExecTx(ctx context.Context, dbc *sql.DB, d Dialect, fn func(tx *sql.Tx) error) error {
+	return d.retry(ctx, func() error {
+		tx, err := dbc.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+// retry calls fn until it doesn't return a retryable error up to maxRetries times.
+func (d Dialect) retry(ctx context.Context, fn func() error) error {
+	for i := 0; ; i++ {
+		err := fn()
+		if i >= maxRetries || !d.isErrRetryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond * time.Duration(10*(i+1))):
+		}
+	}
+}
+
+// rebind returns the query with the dialect's placeholders.
+func (d Dialect) rebind(q string) string {
+	if d != DialectCockroach {
+		return q
+	}
+
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range q {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// now returns the current timestamp expression with second precision.
+func (d Dialect) now() string {
+	if d == DialectSQLite {
+		return "datetime('now')"
+	}
+	// Note CockroachDB's now() has microsecond precision.
+	return "now()"
+}
+
+// nowMicros returns the current timestamp expression with microsecond precision.
+func (d Dialect) nowMicros() string {
+	if d == DialectSQLite {
+		return "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+	} else if d == DialectCockroach {
+		return "now()"
+	}
+	return "now(6)"
+}
+
+// before returns the condition and its argument that the field
+// is before now minus the lag.
+func (d Dialect) before(field string, lag time.Duration) (string, interface{}) {
+	if d == DialectSQLite {
+		return field + "<datetime('now', ?) ",
+			"-" + strconv.FormatFloat(lag.Seconds(), 'f', -1, 64) + " seconds"
+	} else if d == DialectCockroach {
+		return field + "<now()-?*interval '1 second' ", lag.Seconds()
+	}
+	return field + "<timestamp(now()-interval ? second) ", lag.Seconds()
+}
+
+// insert returns an insert query of the column values.
+func (d Dialect) insert(table string, cols, vals []string) string {
+	if d != DialectMySQL {
+		return d.rebind("insert into " + table + " (" + strings.Join(cols, ", ") +
+			") values (" + strings.Join(vals, ", ") + ")")
+	}
+
+	var set []string
+	for i, col := range cols {
+		set = append(set, col+"="+vals[i])
+	}
+	return "insert into " + table + " set " + strings.Join(set, ", ")
+}
+
+// upsert returns an insert query of the column values that applies
+// the updates if a row with the same primary key exists.
+func (d Dialect) upsert(table, key string, cols, vals, updates []string) string {
+	if d == DialectMySQL {
+		return d.insert(table, cols, vals) + " on duplicate key update " +
+			strings.Join(updates, ", ")
+	}
+
+	// Note both the insert and update placeholders are rebound.
+	q := "insert into " + table + " (" + strings.Join(cols, ", ") +
+		") values (" + strings.Join(vals, ", ") + ")"
+	return d.rebind(q + " on conflict(" + key + ") do update set " + strings.Join(updates, ", "))
+}
+
+// insertRows returns a multi-row insert query of the rows' column values.
+func (d Dialect) insertRows(table string, cols []string, rows [][]string) string {
+	var values []string
+	for _, vals := range rows {
+		values = append(values, "("+strings.Join(vals, ", ")+")")
+	}
+	return d.rebind("insert into " + table + " (" + strings.Join(cols, ", ") +
+		") values " + strings.Join(values, ", "))
+}
+
+// ignoreConflict returns the insert query suffix that ignores rows
+// with the same unique key fields as existing rows.
+func (d Dialect) ignoreConflict(keyFields ...string) string {
+	if d == DialectMySQL {
+		// Note "insert ignore" would also ignore other errors.
+		return " on duplicate key update id=id"
+	}
+	return " on conflict(" + strings.Join(keyFields, ", ") + ") do nothing"
+}
+
+// insertedIDs returns the ids of the n rows inserted by a single insert
+// statement. It returns nil if the ids are unknown, e.g. if some rows
+// were ignored as duplicates or the driver doesn't support LastInsertId
+// like postgres drivers for CockroachDB.
+func (d Dialect) insertedIDs(res sql.Result, n int) []string {
+	if d == DialectCockroach {
+		return nil
+	}
+
+	last, err := res.LastInsertId()
+	if err != nil {
+		return nil
+	}
+	affected, err := res.RowsAffected()
+	if err != nil || affected != int64(n) {
+		return nil
+	}
+
+	// MySQL returns the first id of multi-row inserts while SQLite
+	// returns the last id.
+	first := last
+	if d == DialectSQLite {
+		first = last - int64(n) + 1
+	}
+
+	var ids []string
+	for i := int64(0); i < int64(n); i++ {
+		ids = append(ids, strconv.FormatInt(first+i, 10))
+	}
+	return ids
+}
+
+// isErrDupEntry returns true if the error is due to a duplicate primary key.
+func (d Dialect) isErrDupEntry(err error) bool {
+	if d == DialectSQLite {
+		return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+	} else if d == DialectCockroach {
+		return sqlState(err) == "23505" // unique_violation
+	}
+	return isMySQLErrDupEntry(err)
+}
+
+// isErrRetryable returns true if the statement or transaction can be retried.
+func (d Dialect) isErrRetryable(err error) bool {
+	if d == DialectCockroach {
+		return sqlState(err) == "40001" // serialization_failure
+	}
+	return false
+}
+
+// sqlState returns the postgres SQLSTATE error code of errors returned
+// by drivers that expose it (e.g. lib/pq and pgx) or an empty string.
+func sqlState(err error) string {
+	var e interface {
+		error
+		SQLState() string
+	}
+	if err == nil || !errors.As(err, &e) {
+		return ""
+	}
+	return e.SQLState()
+}
@@ -0,0 +1,123 @@
+package rsql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialectInsert(t *testing.T) {
+	cols := []string{"id", "updated_at"}
+	vals := []string{"?", "now()"}
+
+	require.Equal(t, "insert into t set id=?, updated_at=now()",
+		DialectMySQL.insert("t", cols, vals))
+	require.Equal(t, "insert into t (id, updated_at) values (?, now())",
+		DialectSQLite.insert("t", cols, vals))
+
+	updates := []string{"updated_at=now()"}
+	require.Equal(t, "insert into t set id=?, updated_at=now() on duplicate key update updated_at=now()",
+		DialectMySQL.upsert("t", "id", cols, vals, updates))
+	require.Equal(t, "insert into t (id, updated_at) values (?, now()) on conflict(id) do update set updated_at=now()",
+		DialectSQLite.upsert("t", "id", cols, vals, updates))
+
+	require.Equal(t, "insert into t (id, updated_at) values ($1, now()) on conflict(id) do update set updated_at=$2",
+		DialectCockroach.upsert("t", "id", cols, vals, []string{"updated_at=?"}))
+}
+
+func TestDialectIgnoreConflict(t *testing.T) {
+	cols := []string{"foreign_id", "type", "dedup_key"}
+	vals := []string{"?", "?", "?"}
+
+	require.Equal(t, "insert into t set foreign_id=?, type=?, dedup_key=? on duplicate key update id=id",
+		DialectMySQL.insert("t", cols, vals)+DialectMySQL.ignoreConflict("dedup_key"))
+	require.Equal(t, "insert into t (foreign_id, type, dedup_key) values (?, ?, ?) on conflict(dedup_key) do nothing",
+		DialectSQLite.insert("t", cols, vals)+DialectSQLite.ignoreConflict("dedup_key"))
+	require.Equal(t, "insert into t (foreign_id, type, dedup_key) values ($1, $2, $3) on conflict(dedup_key) do nothing",
+		DialectCockroach.insert("t", cols, vals)+DialectCockroach.ignoreConflict("dedup_key"))
+
+	require.Equal(t, " on duplicate key update id=id",
+		DialectMySQL.ignoreConflict("type", "foreign_id", "dedup_key"))
+	require.Equal(t, " on conflict(type, foreign_id, dedup_key) do nothing",
+		DialectSQLite.ignoreConflict("type", "foreign_id", "dedup_key"))
+}
+
+func TestDialectInsertRows(t *testing.T) {
+	cols := []string{"foreign_id", "type"}
+	rows := [][]string{{"?", "?"}, {"?", "?"}}
+
+	require.Equal(t, "insert into t (foreign_id, type) values (?, ?), (?, ?)",
+		DialectMySQL.insertRows("t", cols, rows))
+	require.Equal(t, "insert into t (foreign_id, type) values ($1, $2), ($3, $4)",
+		DialectCockroach.insertRows("t", cols, rows))
+}
+
+type result struct {
+	last     int64
+	affected int64
+}
+
+func (r result) LastInsertId() (int64, error) { return r.last, nil }
+func (r result) RowsAffected() (int64, error) { return r.affected, nil }
+
+func TestDialectInsertedIDs(t *testing.T) {
+	require.Equal(t, []string{"5", "6", "7"}, DialectMySQL.insertedIDs(result{5, 3}, 3))
+	require.Equal(t, []string{"3", "4", "5"}, DialectSQLite.insertedIDs(result{5, 3}, 3))
+	require.Nil(t, DialectMySQL.insertedIDs(result{5, 0}, 1))
+	require.Nil(t, DialectCockroach.insertedIDs(result{5, 1}, 1))
+}
+
+func TestDialectRebind(t *testing.T) {
+	q := "select id from t where id>? and id<=? limit ?"
+	require.Equal(t, q, DialectMySQL.rebind(q))
+	require.Equal(t, q, DialectSQLite.rebind(q))
+	require.Equal(t, "select id from t where id>$1 and id<=$2 limit $3",
+		DialectCockroach.rebind(q))
+}
+
+func TestDialectDupEntry(t *testing.T) {
+	require.True(t, DialectMySQL.isErrDupEntry(&mysql.MySQLError{Number: 1062}))
+	require.False(t, DialectMySQL.isErrDupEntry(errors.New("UNIQUE constraint failed: t.id")))
+	require.True(t, DialectSQLite.isErrDupEntry(errors.New("UNIQUE constraint failed: t.id")))
+	require.False(t, DialectSQLite.isErrDupEntry(nil))
+}
+
+type pqError string
+
+func (e pqError) Error() string    { return "pq error " + string(e) }
+func (e pqError) SQLState() string { return string(e) }
+
+func TestDialectCockroachErrors(t *testing.T) {
+	require.True(t, DialectCockroach.isErrDupEntry(errors.Wrap(pqError("23505"), "insert")))
+	require.False(t, DialectCockroach.isErrDupEntry(pqError("40001")))
+	require.False(t, DialectMySQL.isErrRetryable(pqError("40001")))
+	require.True(t, DialectCockroach.isErrRetryable(errors.Wrap(pqError("40001"), "insert")))
+	require.False(t, DialectCockroach.isErrRetryable(nil))
+}
+
+func TestDialectRetry(t *testing.T) {
+	ctx := context.Background()
+
+	var n int
+	err := DialectCockroach.retry(ctx, func() error {
+		n++
+		if n < 3 {
+			return pqError("40001")
+		}
+		return nil
+	})
+	jtest.RequireNil(t, err)
+	require.Equal(t, 3, n)
+
+	n = 0
+	err = DialectMySQL.retry(ctx, func() error {
+		n++
+		return pqError("40001")
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, n)
+}
@@ -6,7 +6,16 @@ import (
 )
 
 var (
-	ErrConsecEvent        = errors.New("non-consecutive event ids", j.C("ERR_bc3dcacb92b9761f"))
-	ErrInvalidIntID       = errors.New("invalid id, only int supported", j.C("ERR_82d0368b5478d378"))
-	ErrNextCursorMismatch = errors.New("next cursor and last event id mismatch", j.C("ERR_f647fa25c00140d2"))
+	ErrConsecEvent          = errors.New("non-consecutive event ids", j.C("ERR_bc3dcacb92b9761f"))
+	ErrInvalidIntID         = errors.New("invalid id, only int supported", j.C("ERR_82d0368b5478d378"))
+	ErrNextCursorMismatch   = errors.New("next cursor and last event id mismatch", j.C("ERR_f647fa25c00140d2"))
+	ErrCursorNotFound       = errors.New("cursor not found", j.C("ERR_4e0b7d29c3a6f158"))
+	ErrMetadataTooLarge     = errors.New("metadata exceeds max size", j.C("ERR_9c1f5e7a3b60d284"))
+	ErrUnknownCipherKey     = errors.New("unknown cipher key id", j.C("ERR_e1a84c06b5d3f297"))
+	ErrUnknownCompression   = errors.New("unknown metadata compression", j.C("ERR_7f2c95d0a4e8b163"))
+	ErrReplicaConflict      = errors.New("replica event conflict", j.C("ERR_3b9d04e6f7a1c258"))
+	ErrCursorHolderConflict = errors.New("cursor written by multiple holders", j.C("ERR_5d8e21b4a09c7f36"))
+	ErrSnapshotBehind       = errors.New("events table behind snapshot head", j.C("ERR_c28f6a91d4e05b73"))
+	ErrChecksumMismatch     = errors.New("event checksum mismatch", j.C("ERR_49d7c3e0b86a15f2"))
+	ErrDeliveryNotFound     = errors.New("delivery not found", j.C("ERR_0e5b9a73c2d14f68"))
 )
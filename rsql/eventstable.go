@@ -3,17 +3,21 @@ package rsql
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/j"
 	"github.com/luno/reflex"
 )
 
 const (
-	defaultStreamBackoff = time.Second * 10
+	defaultStreamBackoff     = time.Second * 10
+	defaultReconnectAttempts = 3
+	defaultReconnectBackoff  = time.Millisecond * 100
 )
 
 // NewEventsTable returns a new events table.
@@ -27,20 +31,17 @@ func NewEventsTable(name string, opts ...EventsOption) *EventsTable {
 			metadataField:  defaultMetadataField,
 		},
 		options: options{
-			notifier: &stubNotifier{},
-			backoff:  defaultStreamBackoff,
+			notifier:          &stubNotifier{},
+			backoff:           defaultStreamBackoff,
+			reconnectAttempts: defaultReconnectAttempts,
+			reconnectBackoff:  defaultReconnectBackoff,
 		},
 	}
 	for _, o := range opts {
 		o(table)
 	}
 
-	if table.inserter == nil {
-		table.inserter = makeDefaultInserter(table.schema)
-	}
-
-	table.gapCh = make(chan Gap)
-	table.currentLoader = buildLoader(table.baseLoader, table.gapCh, table.disableCache, table.schema)
+	table.initLoader()
 
 	return table
 }
@@ -72,6 +73,88 @@ func WithEventForeignIDField(field string) EventsOption {
 	}
 }
 
+// WithEventForeignKeyFields provides an option to set additional foreign
+// reference fields of the events table, e.g. "account_id" and "entity_id".
+// The fields must be nullable strings (or types that scan into strings). Their
+// values are inserted from EventToInsert.ForeignKeys (see
+// InsertWithForeignKeys), with null for missing keys, and streamed as
+// reflex.Event.ForeignKeys keyed by field. reflex.WithStreamForeignKey
+// filters are pushed into the events query, so the fields should be indexed.
+// It is disabled by default.
+func WithEventForeignKeyFields(fields ...string) EventsOption {
+	return func(table *EventsTable) {
+		table.schema.foreignKeyFields = fields
+	}
+}
+
+// WithEventHeadersField provides an option to set the event DB headers field.
+// Headers are stored as JSON objects of strings, inserted from
+// EventToInsert.Headers (see InsertWithHeaders) and streamed as
+// reflex.Event.Headers. Unlike metadata, headers are not transformed by the
+// metadata codec or compression. Events without headers are inserted with
+// null. It is disabled by default; ie. no field.
+func WithEventHeadersField(field string) EventsOption {
+	return func(table *EventsTable) {
+		table.schema.headersField = field
+	}
+}
+
+// WithEventTenantField provides an option to enable tenancy with the event DB
+// tenant field, e.g. 'tenant_id'. Events are inserted with the tenant of
+// EventToInsert.TenantID (see InsertWithTenant) which is required and
+// streamed as reflex.Event.TenantID. Streams with reflex.WithTenant are
+// scoped to the tenant by the events query, so the field should be indexed.
+// The field must be nullable since noops (see FillGaps) have no tenant.
+// Consumers of scoped streams should use tenant scoped cursors, see
+// WithCursorTenant. It is disabled by default.
+func WithEventTenantField(field string) EventsOption {
+	return func(table *EventsTable) {
+		table.schema.tenantField = field
+	}
+}
+
+// WithEventChecksumField provides an option to enable event checksums with the
+// event DB checksum field, e.g. a 'checksum' char(64) column. The SHA-256
+// checksum of the event content (excluding the ID and timestamp) is computed
+// on insert and verified on scan, so streams fail with ErrChecksumMismatch if
+// an event was corrupted or tampered with. Checksums are not verified on scan
+// with lazy metadata, see NewVerifier to verify all events periodically. The
+// field must be nullable since noops and existing events have no checksum.
+// It is disabled by default.
+func WithEventChecksumField(field string) EventsOption {
+	return func(table *EventsTable) {
+		table.schema.checksumField = field
+	}
+}
+
+// ForeignIDType defines the DB column type of the event foreignID field,
+// see WithEventForeignIDType.
+type ForeignIDType int
+
+const (
+	// ForeignIDString binds foreign IDs as strings, e.g. for varchar columns.
+	ForeignIDString ForeignIDType = 0
+
+	// ForeignIDInt64 binds foreign IDs as integers, e.g. for bigint columns.
+	ForeignIDInt64 ForeignIDType = 1
+
+	// ForeignIDUUID binds foreign IDs as the 16 bytes of UUIDs, e.g. for
+	// binary(16) columns. Streamed foreign IDs are canonical UUID strings.
+	ForeignIDUUID ForeignIDType = 2
+)
+
+// WithEventForeignIDType provides an option to set the DB column type of the
+// event foreignID field. Inserting events with foreign IDs that cannot be
+// parsed as the type returns reflex.ErrInvalidForeignID, see
+// reflex.Event.ParseForeignIDInt and reflex.Event.ForeignIDUUID. Note that
+// reflex.WithStreamForeignIDPrefix filters are only supported for string
+// foreign IDs. It defaults to ForeignIDString.
+func WithEventForeignIDType(typ ForeignIDType) EventsOption {
+	return func(table *EventsTable) {
+		table.schema.foreignIDType = typ
+	}
+}
+
 // WithEventMetadataField provides an option to set the event DB metadata field.
 // It is disabled by default; ie. ''.
 func WithEventMetadataField(field string) EventsOption {
@@ -80,8 +163,118 @@ func WithEventMetadataField(field string) EventsOption {
 	}
 }
 
+// WithEventsMaxMetadataSize provides an option to set the maximum size in
+// bytes of inserted event metadata. Inserts with larger metadata fail with
+// ErrMetadataTooLarge. It defaults to 0; ie. no limit.
+func WithEventsMaxMetadataSize(n int) EventsOption {
+	return func(table *EventsTable) {
+		table.maxMetadata = n
+	}
+}
+
+// WithMetadataCipher provides an option to transparently encrypt event
+// metadata on insert and decrypt it when streamed or loaded, see NewAESCipher.
+// Note that the metadata size limit applies to the unencrypted metadata.
+func WithMetadataCipher(cipher Codec) EventsOption {
+	return func(table *EventsTable) {
+		table.schema.cipher = cipher
+	}
+}
+
+// WithMetadataCompression provides an option to compress event metadata on
+// insert and decompress it when streamed or loaded. The compressed metadata
+// is prefixed with a header identifying the compression, metadata without
+// the header is not decompressed. The other compressions are only used to
+// decompress which supports migrating existing tables between compressions.
+// Metadata is compressed before it is encrypted, see WithMetadataCipher.
+func WithMetadataCompression(c Compression, others ...Compression) EventsOption {
+	return func(table *EventsTable) {
+		table.schema.compressor = newCompressor(c, others...)
+	}
+}
+
+// WithEventsScheduledTable provides an option to set the DB table of
+// scheduled events which enables InsertAt. Scheduled events are inserted
+// into the scheduled table and only inserted into the events table once
+// they are due by ForwardScheduled, so they never delay other events.
+// The scheduled table requires an auto increment id, the foreign id, type
+// and metadata (if enabled) fields of the events table and an
+// "available_at" datetime field. It is disabled by default; ie. ''.
+func WithEventsScheduledTable(name string) EventsOption {
+	return func(table *EventsTable) {
+		table.schema.scheduledTable = name
+	}
+}
+
+// WithEventsLazyMetadata provides an option to exclude the metadata field from
+// the queries streaming events. This reduces IO for tables with large metadata
+// blobs if consumers filter by type. Metadata of streamed events is then nil
+// and must be loaded explicitly via LoadMetadata when required.
+func WithEventsLazyMetadata() EventsOption {
+	return func(table *EventsTable) {
+		table.schema.lazyMetadata = true
+	}
+}
+
+// WithEventsDialect provides an option to set the SQL dialect of the
+// database. It defaults to DialectMySQL. Note that custom inserters
+// should match the dialect.
+func WithEventsDialect(d Dialect) EventsOption {
+	return func(table *EventsTable) {
+		table.schema.dialect = d
+	}
+}
+
+// WithEventsQueryHint provides an option to set an index hint applied to the
+// queries streaming events after the cursor, e.g. "force index (primary)",
+// for when the MySQL optimizer picks a bad plan for the id range scan on very
+// large tables. The hint must be valid for the dialect.
+func WithEventsQueryHint(hint string) EventsOption {
+	return func(table *EventsTable) {
+		table.schema.queryHint = hint
+	}
+}
+
+// WithEventsDedupField provides an option to set the event DB dedup key field
+// which enables ignoring inserts of duplicate events, ie. events with the same
+// EventToInsert.DedupKey, so idempotent producers can safely retry. Events
+// with empty dedup keys are inserted with null keys and are therefore never
+// deduplicated. It is disabled by default; ie. ''.
+//
+// The table requires a unique key on the uniqueKeyFields and the nullable
+// dedup key field, in that order, e.g. the type and foreign id fields to
+// deduplicate events with the same type, foreign id and dedup key:
+//
+//   WithEventsDedupField("dedup_key", "type", "foreign_id")
+//   unique index by_dedup_key (type, foreign_id, dedup_key)
+//
+// Without uniqueKeyFields the unique key is only the dedup key field, so
+// dedup keys must be unique across all types and foreign ids.
+//
+// Note that MySQL may allocate (and skip) auto increment ids for ignored
+// inserts, these gaps are filled with noops, see FillGaps.
+func WithEventsDedupField(field string, uniqueKeyFields ...string) EventsOption {
+	return func(table *EventsTable) {
+		table.schema.dedupField = field
+		table.schema.dedupKeyFields = append(append([]string(nil), uniqueKeyFields...), field)
+	}
+}
+
+// WithEventsPostCommitHook provides an option to set a hook that is called
+// with the ids of the inserted events when the NotifyFunc returned by the
+// insert methods is called, which should be after the transaction commits.
+// The ids are empty if unknown, e.g. for custom inserters, CockroachDB,
+// or for duplicate inserts ignored by WithEventsDedupField.
+func WithEventsPostCommitHook(hook func(ctx context.Context, ids []string)) EventsOption {
+	return func(table *EventsTable) {
+		table.postCommit = hook
+	}
+}
+
 // WithEventsNotifier provides an option to receive event notifications
-// and trigger StreamClients when new events are available.
+// and trigger StreamClients when new events are available. Use
+// NewPubSubNotifier to trigger StreamClients of other app instances, or
+// NewInMemNotifier to trigger StreamClients from custom wake-up sources.
 func WithEventsNotifier(notifier EventsNotifier) EventsOption {
 	return func(table *EventsTable) {
 		table.notifier = notifier
@@ -118,11 +311,107 @@ func WithoutEventsCache() EventsOption {
 	}
 }
 
+// WithEventsPool provides an option to reuse the events streamed by this
+// table's stream clients once released (see reflex.EventReleaser) instead
+// of allocating new events, reducing GC pressure of high-throughput
+// consumers. Run releases events after consuming them, so consumers must
+// not retain events after Consume returns. It disables the read-through
+// and page caches since pooled events can't be shared between consumers.
+func WithEventsPool() EventsOption {
+	return func(table *EventsTable) {
+		table.schema.pool = &sync.Pool{
+			New: func() interface{} {
+				return new(reflex.Event)
+			},
+		}
+	}
+}
+
+// WithEventsPageCache provides an option to share the event pages loaded
+// by streams with other events tables in the process via the page cache,
+// see NewPageCache. Unlike the read-through cache, which is not shared
+// between tables (including clones), the page cache only shares recently
+// loaded pages.
+func WithEventsPageCache(c *PageCache) EventsOption {
+	return func(table *EventsTable) {
+		table.pageCache = c
+	}
+}
+
 // WithEventsBackoff provides an option to set the backoff period between polling
 // the DB for new events. It defaults to 10s.
 func WithEventsBackoff(d time.Duration) EventsOption {
 	return func(table *EventsTable) {
 		table.backoff = d
+		table.maxBackoff = 0
+	}
+}
+
+// WithEventsPollPeriod provides an option to adapt the backoff period between
+// polling the DB for new events to the event rate: streams poll after the min
+// period when no new events are found, doubling the period after each poll
+// without new events up to the max period, and resetting it to the min period
+// when new events are found. So streams poll fast while events are flowing
+// and back off when idle. It overrides WithEventsBackoff.
+func WithEventsPollPeriod(min, max time.Duration) EventsOption {
+	return func(table *EventsTable) {
+		table.backoff = min
+		table.maxBackoff = max
+	}
+}
+
+// WithEventsPrefetch provides an option to enable prefetching the next
+// page of events in the background while the current page is consumed, so
+// the DB query latency doesn't add to the consume latency when catching up.
+// It doubles the memory of buffered events per stream.
+func WithEventsPrefetch() EventsOption {
+	return func(table *EventsTable) {
+		table.prefetchEnabled = true
+	}
+}
+
+// WithEventsReconnect provides an option to set the number of times streams
+// retry queries failing with connection errors (e.g. "bad connection" or
+// "connection is already closed") before returning the error, backing off
+// linearly between attempts. The DB pool replaces bad connections, so
+// transient pool errors don't stop consumers. Zero attempts disables retries.
+// It defaults to 3 attempts with a 100ms backoff.
+func WithEventsReconnect(attempts int, backoff time.Duration) EventsOption {
+	return func(table *EventsTable) {
+		table.reconnectAttempts = attempts
+		table.reconnectBackoff = backoff
+	}
+}
+
+// WithEventsFetchLimit provides an option to set the maximum number
+// of events queried per page by the default loader. It defaults to 1000.
+func WithEventsFetchLimit(n int) EventsOption {
+	return func(table *EventsTable) {
+		table.fetch.limit = n
+	}
+}
+
+// WithEventsAdaptiveFetch provides an option to adapt the number of events
+// queried per page by the default loader. The page size starts at min and
+// doubles up to max while full pages are returned (catching up). It halves
+// down to min if the size of a page's events exceeds maxBytes, which limits
+// memory usage for wide rows. A zero maxBytes disables shrinking.
+func WithEventsAdaptiveFetch(min, max, maxBytes int) EventsOption {
+	return func(table *EventsTable) {
+		table.fetch = fetchConfig{
+			adaptive: true,
+			min:      min,
+			max:      max,
+			maxBytes: maxBytes,
+		}
+	}
+}
+
+// WithEventsGapPolicy provides an option to configure how gaps in the
+// events table are handled by streams and by FillGaps.
+func WithEventsGapPolicy(policy GapPolicy) EventsOption {
+	return func(table *EventsTable) {
+		table.gapPolicy = policy
 	}
 }
 
@@ -149,14 +438,47 @@ func WithEventsInserter(inserter inserter) EventsOption {
 type inserter func(ctx context.Context, tx *sql.Tx,
 	foreignID string, typ reflex.EventType, metadata []byte) error
 
+// EventToInsert defines an event inserted by EventsTable.InsertMany.
+type EventToInsert struct {
+	ForeignID string
+	Type      reflex.EventType
+	MetaData  []byte
+
+	// AvailableAt is the time the event is available to be streamed
+	// if not zero. It requires the WithEventsScheduledTable option.
+	AvailableAt time.Time
+
+	// DedupKey is the unique key of the event if not empty. Inserts of
+	// events with existing keys are ignored. It requires the
+	// WithEventsDedupField option.
+	DedupKey string
+
+	// ForeignKeys are the values of the additional foreign reference fields
+	// keyed by field. It requires the WithEventForeignKeyFields option.
+	ForeignKeys map[string]string
+
+	// Headers are the attributes of the event separate from the metadata,
+	// e.g. trace IDs. It requires the WithEventHeadersField option.
+	Headers map[string]string
+
+	// TenantID is the tenant of the event. It is required by and
+	// requires the WithEventTenantField option.
+	TenantID string
+}
+
 // EventsTable provides reflex event insertion and streaming
 // for a sql db table.
 type EventsTable struct {
 	options
 	schema       etableSchema
 	disableCache bool
+	pageCache    *PageCache
+	fetch        fetchConfig
+	gapPolicy    GapPolicy
 	baseLoader   loader
 	inserter     inserter
+	maxMetadata  int
+	postCommit   func(ctx context.Context, ids []string)
 
 	// Stateful fields not cloned
 	currentLoader filterLoader
@@ -184,15 +506,218 @@ func (t *EventsTable) Insert(ctx context.Context, tx *sql.Tx, foreignID string,
 // Note metadata is disabled by default, enable with WithEventMetadataField option.
 func (t *EventsTable) InsertWithMetadata(ctx context.Context, tx *sql.Tx, foreignID string,
 	typ reflex.EventType, metadata []byte) (NotifyFunc, error) {
-	if isNoop(foreignID, typ) {
-		return nil, errors.New("inserting invalid noop event")
+	return t.InsertMany(ctx, tx, []EventToInsert{{
+		ForeignID: foreignID,
+		Type:      typ,
+		MetaData:  metadata,
+	}})
+}
+
+// InsertAt inserts a scheduled event that is only inserted into the
+// EventsTable by ForwardScheduled once the available time passes.
+// It requires the WithEventsScheduledTable option. See Insert for details.
+func (t *EventsTable) InsertAt(ctx context.Context, tx *sql.Tx, foreignID string,
+	typ reflex.EventType, availableAt time.Time) (NotifyFunc, error) {
+	return t.InsertMany(ctx, tx, []EventToInsert{{
+		ForeignID:   foreignID,
+		Type:        typ,
+		AvailableAt: availableAt,
+	}})
+}
+
+// InsertWithDedupKey inserts an event with the unique dedup key into the
+// EventsTable. The insert is ignored if an event with the key already exists.
+// It requires the WithEventsDedupField option. See Insert for details.
+func (t *EventsTable) InsertWithDedupKey(ctx context.Context, tx *sql.Tx, foreignID string,
+	typ reflex.EventType, dedupKey string) (NotifyFunc, error) {
+	return t.InsertMany(ctx, tx, []EventToInsert{{
+		ForeignID: foreignID,
+		Type:      typ,
+		DedupKey:  dedupKey,
+	}})
+}
+
+// InsertWithForeignKeys inserts an event with the values of the additional
+// foreign reference fields into the EventsTable. It requires the
+// WithEventForeignKeyFields option. See Insert for details.
+func (t *EventsTable) InsertWithForeignKeys(ctx context.Context, tx *sql.Tx, foreignID string,
+	typ reflex.EventType, foreignKeys map[string]string) (NotifyFunc, error) {
+	return t.InsertMany(ctx, tx, []EventToInsert{{
+		ForeignID:   foreignID,
+		Type:        typ,
+		ForeignKeys: foreignKeys,
+	}})
+}
+
+// InsertWithHeaders inserts an event with headers into the EventsTable.
+// It requires the WithEventHeadersField option. See Insert for details.
+func (t *EventsTable) InsertWithHeaders(ctx context.Context, tx *sql.Tx, foreignID string,
+	typ reflex.EventType, headers map[string]string) (NotifyFunc, error) {
+	return t.InsertMany(ctx, tx, []EventToInsert{{
+		ForeignID: foreignID,
+		Type:      typ,
+		Headers:   headers,
+	}})
+}
+
+// InsertWithTenant inserts an event of the tenant into the EventsTable.
+// It requires the WithEventTenantField option. See Insert for details.
+func (t *EventsTable) InsertWithTenant(ctx context.Context, tx *sql.Tx, tenantID, foreignID string,
+	typ reflex.EventType) (NotifyFunc, error) {
+	return t.InsertMany(ctx, tx, []EventToInsert{{
+		ForeignID: foreignID,
+		Type:      typ,
+		TenantID:  tenantID,
+	}})
+}
+
+// InsertMany inserts the events into the EventsTable using a single
+// multi-row insert statement. It returns a function that can be optionally
+// called to notify the table's EventNotifier of the change, see Insert.
+// Note that the events are inserted one by one if a custom inserter is
+// configured via WithEventsInserter.
+func (t *EventsTable) InsertMany(ctx context.Context, tx *sql.Tx,
+	events []EventToInsert) (NotifyFunc, error) {
+	if len(events) == 0 {
+		return noopFunc, nil
+	}
+
+	for _, e := range events {
+		if isNoop(e.ForeignID, e.Type) {
+			return nil, errors.New("inserting invalid noop event")
+		} else if t.schema.tenantField != "" && e.TenantID == "" {
+			return nil, errors.New("tenant required")
+		}
+		if t.maxMetadata > 0 && len(e.MetaData) > t.maxMetadata {
+			return nil, errors.Wrap(ErrMetadataTooLarge, "",
+				j.MKV{"size": len(e.MetaData), "max": t.maxMetadata})
+		}
+	}
+
+	if t.schema.cipher != nil || t.schema.compressor != nil {
+		encoded := make([]EventToInsert, 0, len(events))
+		for _, e := range events {
+			var err error
+			e.MetaData, err = t.schema.encodeMetadata(e.MetaData)
+			if err != nil {
+				return nil, errors.Wrap(err, "encode metadata error")
+			}
+			encoded = append(encoded, e)
+		}
+		events = encoded
+	}
+
+	var immediate, scheduled []EventToInsert
+	for _, e := range events {
+		if e.AvailableAt.IsZero() {
+			immediate = append(immediate, e)
+		} else {
+			scheduled = append(scheduled, e)
+		}
+	}
+
+	if len(scheduled) > 0 {
+		if t.schema.scheduledTable == "" {
+			return noopFunc, errors.New("scheduled table not enabled")
+		} else if t.inserter != nil {
+			return noopFunc, errors.New("scheduled events not supported by custom inserter")
+		}
+		if err := insertScheduled(ctx, tx, t.schema, scheduled); err != nil {
+			return noopFunc, err
+		}
+	}
+
+	var ids []string
+	if len(immediate) == 0 {
+		// Only scheduled events, nothing to notify.
+		return noopFunc, nil
+	} else if t.inserter != nil {
+		for _, e := range immediate {
+			if e.DedupKey != "" {
+				return noopFunc, errors.New("dedup key not supported by custom inserter")
+			} else if len(e.ForeignKeys) > 0 {
+				return noopFunc, errors.New("foreign keys not supported by custom inserter")
+			} else if len(e.Headers) > 0 {
+				return noopFunc, errors.New("headers not supported by custom inserter")
+			} else if e.TenantID != "" {
+				return noopFunc, errors.New("tenancy not supported by custom inserter")
+			} else if t.schema.checksumField != "" {
+				return noopFunc, errors.New("checksums not supported by custom inserter")
+			}
+			err := t.inserter(ctx, tx, e.ForeignID, e.Type, e.MetaData)
+			if err != nil {
+				return noopFunc, err
+			}
+		}
+	} else {
+		var err error
+		ids, err = insertEvents(ctx, tx, t.schema, immediate)
+		if err != nil {
+			return noopFunc, err
+		}
+	}
+
+	if t.postCommit == nil {
+		return t.notifier.Notify, nil
+	}
+
+	return func() {
+		t.notifier.Notify()
+		t.postCommit(ctx, ids)
+	}, nil
+}
+
+// InsertProto inserts an event with the marshalled proto message as metadata
+// into the EventsTable. See InsertWithMetadata for details.
+func (t *EventsTable) InsertProto(ctx context.Context, tx *sql.Tx, foreignID string,
+	typ reflex.EventType, msg proto.Message) (NotifyFunc, error) {
+	metadata, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal proto metadata")
+	}
+	return t.InsertWithMetadata(ctx, tx, foreignID, typ, metadata)
+}
+
+// InsertJSON inserts an event with the JSON encoding of v as metadata
+// into the EventsTable. See InsertWithMetadata for details.
+func (t *EventsTable) InsertJSON(ctx context.Context, tx *sql.Tx, foreignID string,
+	typ reflex.EventType, v interface{}) (NotifyFunc, error) {
+	metadata, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal json metadata")
+	}
+	return t.InsertWithMetadata(ctx, tx, foreignID, typ, metadata)
+}
+
+// LoadMetadata queries and returns the metadata of the provided events by
+// event ID in a single query. It is intended to be used with the
+// WithEventsLazyMetadata option. Note that streamed events may be shared
+// between consumers via the cache, so they should not be modified.
+func (t *EventsTable) LoadMetadata(ctx context.Context, dbc *sql.DB,
+	events ...*reflex.Event) (map[string][]byte, error) {
+	if t.schema.metadataField == "" {
+		return nil, errors.New("metadata not enabled")
+	}
+
+	var ids []int64
+	for _, e := range events {
+		if !e.IsIDInt() {
+			return nil, ErrInvalidIntID
+		}
+		ids = append(ids, e.IDInt())
 	}
-	err := t.inserter(ctx, tx, foreignID, typ, metadata)
+
+	mm, err := getMetadata(ctx, dbc, t.schema, ids)
 	if err != nil {
-		return noopFunc, err
+		return nil, err
+	}
+
+	res := make(map[string][]byte)
+	for id, metadata := range mm {
+		res[strconv.FormatInt(id, 10)] = metadata
 	}
 
-	return t.notifier.Notify, nil
+	return res, nil
 }
 
 // Clone returns a new etable cloned from the config of t with the new options applied.
@@ -202,19 +727,18 @@ func (t *EventsTable) Clone(opts ...EventsOption) *EventsTable {
 		options:      t.options,
 		schema:       t.schema,
 		disableCache: t.disableCache,
+		pageCache:    t.pageCache,
+		fetch:        t.fetch,
+		gapPolicy:    t.gapPolicy,
 		baseLoader:   nil,
+		maxMetadata:  t.maxMetadata,
+		postCommit:   t.postCommit,
 	}
 	for _, opt := range opts {
 		opt(table)
 	}
 
-	if table.inserter == nil {
-		table.inserter = makeDefaultInserter(table.schema)
-	}
-
-	table.gapCh = make(chan Gap)
-	table.currentLoader = buildLoader(table.baseLoader, table.gapCh,
-		table.disableCache, table.schema)
+	table.initLoader()
 
 	return table
 }
@@ -237,6 +761,13 @@ func (t *EventsTable) Stream(ctx context.Context, dbc *sql.DB, after string,
 		o(&sc.StreamOptions)
 	}
 
+	filtered := len(sc.StreamTypes) > 0 || sc.StreamForeignIDPrefix != "" ||
+		len(sc.StreamForeignKeys) > 0 || sc.StreamTenant != ""
+	if filtered && t.baseLoader == nil {
+		sc.loader = makeFilterLoader(t.schema, t.fetch, t.gapCh, t.gapPolicy,
+			sc.StreamOptions)
+	}
+
 	eventsGapListenGauge.WithLabelValues(t.schema.name) // Init zero gap filling gauge.
 
 	return sc
@@ -250,6 +781,14 @@ func (t *EventsTable) ToStream(dbc *sql.DB, opts1 ...reflex.StreamOption) reflex
 	}
 }
 
+// ToLatestID returns a function that returns the latest event ID (the head)
+// of this EventsTable, see reflex.WithRunLagEvents.
+func (t *EventsTable) ToLatestID(dbc *sql.DB) func(ctx context.Context) (int64, error) {
+	return func(ctx context.Context) (int64, error) {
+		return getLatestID(ctx, dbc, t.schema)
+	}
+}
+
 // ListenGaps adds f to a slice of functions that are called when a gap is detected.
 // One first call, it starts a goroutine that serves these functions.
 func (t *EventsTable) ListenGaps(f func(Gap)) {
@@ -276,12 +815,37 @@ func (t *EventsTable) getSchema() etableSchema {
 	return t.schema
 }
 
+// getGapPolicy returns the gap policy and implements the gapTable interface for FillGaps.
+func (t *EventsTable) getGapPolicy() GapPolicy {
+	return t.gapPolicy
+}
+
+// initLoader initialises the stateful gap channel and layered event loader.
+// Pooled events are not cached since they are reused after being released.
+func (t *EventsTable) initLoader() {
+	disableCache, pageCache := t.disableCache, t.pageCache
+	if t.schema.pool != nil {
+		disableCache, pageCache = true, nil
+	}
+
+	t.gapCh = make(chan Gap)
+	t.currentLoader = buildLoader(t.baseLoader, t.gapCh,
+		disableCache, pageCache, t.schema, t.fetch, t.gapPolicy)
+}
+
 // buildLoader returns a new layered event loader.
-func buildLoader(baseLoader loader, ch chan<- Gap, disableCache bool, schema etableSchema) filterLoader {
+func buildLoader(baseLoader loader, ch chan<- Gap, disableCache bool, pageCache *PageCache,
+	schema etableSchema, fetch fetchConfig, policy GapPolicy) filterLoader {
 	if baseLoader == nil {
-		baseLoader = makeBaseLoader(schema)
+		baseLoader = makeBaseLoader(schema, fetch)
+	}
+	loader := baseLoader
+	if !schema.compacted {
+		loader = wrapGapDetector(baseLoader, ch, schema.name, policy)
+	}
+	if pageCache != nil {
+		loader = pageCache.wrap(loader, schema.name)
 	}
-	loader := wrapGapDetector(baseLoader, ch, schema.name)
 	if !disableCache /* ie. enableCache */ {
 		loader = newRCache(loader, schema.name).Load
 	}
@@ -292,17 +856,37 @@ func buildLoader(baseLoader loader, ch chan<- Gap, disableCache bool, schema eta
 type options struct {
 	reflex.StreamOptions
 
-	notifier EventsNotifier
-	backoff  time.Duration
+	notifier          EventsNotifier
+	backoff           time.Duration
+	maxBackoff        time.Duration
+	prefetchEnabled   bool
+	replicas          *replicaSet
+	reconnectAttempts int
+	reconnectBackoff  time.Duration
 }
 
 // etableSchema defines the mysql schema of an events table.
 type etableSchema struct {
-	name           string
-	timeField      string
-	typeField      string
-	foreignIDField string
-	metadataField  string
+	name             string
+	timeField        string
+	typeField        string
+	foreignIDField   string
+	foreignIDType    ForeignIDType
+	foreignKeyFields []string
+	headersField     string
+	tenantField      string
+	checksumField    string
+	metadataField    string
+	lazyMetadata     bool
+	dialect          Dialect
+	dedupField       string
+	dedupKeyFields   []string // Unique key fields including the dedup field.
+	cipher           Codec
+	compressor       *compressor
+	scheduledTable   string
+	compacted        bool
+	queryHint        string
+	pool             *sync.Pool
 }
 
 type streamclient struct {
@@ -315,8 +899,24 @@ type streamclient struct {
 	dbc    *sql.DB
 	ctx    context.Context
 
+	// until is the inclusive upper bound cursor if bounded.
+	until   int64
+	bounded bool
+	initEnd bool
+
+	// floor and before define the remaining range of descending streams.
+	floor  int64
+	before int64
+
 	// loader queries next events from the DB.
 	loader filterLoader
+
+	// pollPeriod is the current adaptive backoff, see WithEventsPollPeriod.
+	pollPeriod time.Duration
+
+	// prefetched receives the events prefetched in the background,
+	// see WithEventsPrefetch.
+	prefetched chan prefetchResult
 }
 
 // Recv blocks and returns the next event in the stream. It queries the db
@@ -324,11 +924,45 @@ type streamclient struct {
 // event and returns it. When querying and no new events are found it backs off
 // before retrying. It blocks until it can return a non-nil event or an error.
 // It is only safe for a single goroutine to call Recv.
+//
+// Queries failing with connection errors are retried, see WithEventsReconnect.
+//
+// Events not matching the stream filters (see reflex.WithStreamTypes) are
+// skipped. The filters are applied in the query unless a custom loader is
+// configured, but are also applied to the loaded events since the query's
+// foreign ID comparison depends on the column collation.
 func (s *streamclient) Recv() (*reflex.Event, error) {
+	var attempts int
+	for {
+		e, err := s.recv()
+		if isErrConn(err) && attempts < s.reconnectAttempts {
+			attempts++
+			eventsReconnectCounter.WithLabelValues(s.schema.name).Inc()
+			if err := s.sleep(s.reconnectBackoff * time.Duration(attempts)); err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if s.Match(e) {
+			return e, nil
+		}
+		s.Release(e)
+	}
+}
+
+// recv returns the next event in the stream, see Recv.
+func (s *streamclient) recv() (*reflex.Event, error) {
 	if err := s.ctx.Err(); err != nil {
 		return nil, err
 	}
 
+	if s.StreamDescending {
+		return s.recvDescending()
+	}
+
 	// Initialise cursor s.prev once.
 	var err error
 	if s.StreamFromHead {
@@ -338,6 +972,13 @@ func (s *streamclient) Recv() (*reflex.Event, error) {
 		}
 		s.StreamFromHead = false
 		s.after = "" // StreamFromHead overrides after.
+	} else if !s.StreamFromTime.IsZero() {
+		s.prev, err = getCursorAtTime(s.ctx, s.dbc, s.schema, s.StreamFromTime)
+		if err != nil {
+			return nil, err
+		}
+		s.StreamFromTime = time.Time{}
+		s.after = "" // StreamFromTime overrides after.
 	} else if s.after != "" {
 		s.prev, err = strconv.ParseInt(s.after, 10, 64)
 		if err != nil {
@@ -346,9 +987,21 @@ func (s *streamclient) Recv() (*reflex.Event, error) {
 		s.after = ""
 	}
 
+	// Initialise upper bound s.until once.
+	if !s.initEnd {
+		if err := s.initUntil(); err != nil {
+			return nil, err
+		}
+		s.initEnd = true
+	}
+
 	for len(s.buf) == 0 {
+		if s.bounded && s.prev >= s.until {
+			return nil, reflex.ErrHeadReached
+		}
+
 		eventsPollCounter.WithLabelValues(s.schema.name).Inc()
-		el, override, err := s.loader(s.ctx, s.dbc, s.prev, s.Lag)
+		el, override, err := s.load()
 		if err != nil {
 			return nil, err
 		}
@@ -365,6 +1018,10 @@ func (s *streamclient) Recv() (*reflex.Event, error) {
 		s.buf = el
 
 		if len(el) > 0 {
+			s.pollPeriod = 0
+			if last := el[len(el)-1].IDInt(); s.prefetchEnabled && (!s.bounded || last < s.until) {
+				s.prefetch(last)
+			}
 			break
 		}
 
@@ -380,16 +1037,24 @@ func (s *streamclient) Recv() (*reflex.Event, error) {
 			return nil, reflex.ErrHeadReached
 		}
 
-		if err := s.wait(s.backoff); err != nil {
+		s.pollPeriod = nextPollPeriod(s.pollPeriod, s.backoff, s.maxBackoff)
+		if err := s.wait(s.pollPeriod); err != nil {
 			return nil, err
 		}
 	}
 
 	// Pop next event from buffer.
 	e := s.buf[0]
-	s.buf = s.buf[1:]
 	next := e.IDInt()
 
+	if s.bounded && next > s.until {
+		return nil, reflex.ErrHeadReached
+	} else if !s.StreamUntilTime.IsZero() && !e.Timestamp.Before(s.StreamUntilTime) {
+		return nil, reflex.ErrHeadReached
+	}
+
+	s.buf = s.buf[1:]
+
 	// Sanity check: next cursor must be greater than prev
 	if s.prev >= next {
 		return nil, errors.Wrap(ErrConsecEvent, "pop error",
@@ -401,6 +1066,154 @@ func (s *streamclient) Recv() (*reflex.Event, error) {
 	return e, nil
 }
 
+// load returns the next events after the cursor, either the prefetched
+// events if prefetched after the cursor or the queried events.
+func (s *streamclient) load() ([]*reflex.Event, int64, error) {
+	if s.prefetched != nil {
+		// Always wait for the prefetch to not load concurrently.
+		var res prefetchResult
+		select {
+		case <-s.ctx.Done():
+			return nil, 0, s.ctx.Err()
+		case res = <-s.prefetched:
+		}
+		s.prefetched = nil
+
+		if res.prev == s.prev {
+			return res.events, res.override, res.err
+		}
+	}
+
+	return s.query(s.prev)
+}
+
+// prefetch starts querying the next events after the cursor in
+// the background, see WithEventsPrefetch.
+func (s *streamclient) prefetch(prev int64) {
+	ch := make(chan prefetchResult, 1)
+	go func() {
+		el, override, err := s.query(prev)
+		ch <- prefetchResult{
+			prev:     prev,
+			events:   el,
+			override: override,
+			err:      err,
+		}
+	}()
+	s.prefetched = ch
+}
+
+type prefetchResult struct {
+	prev     int64
+	events   []*reflex.Event
+	override int64
+	err      error
+}
+
+// query returns the next events from a read replica if configured
+// (failing over to the primary on errors) or the primary.
+func (s *streamclient) query(prev int64) ([]*reflex.Event, int64, error) {
+	if s.replicas == nil {
+		return s.loader(s.ctx, s.dbc, prev, s.Lag)
+	}
+
+	dbc := s.replicas.pick(s.ctx, s.dbc, s.schema)
+	el, override, err := s.loader(s.ctx, dbc, prev, s.Lag)
+	if err == nil || dbc == s.dbc || s.ctx.Err() != nil {
+		return el, override, err
+	}
+
+	s.replicas.fail(s.ctx, dbc, s.schema, err)
+	return s.loader(s.ctx, s.dbc, prev, s.Lag)
+}
+
+// initUntil initialises the upper bound cursor from the until cursor
+// and/or the current head if streaming to head.
+func (s *streamclient) initUntil() error {
+	if s.StreamUntilCursor != "" {
+		until, err := strconv.ParseInt(s.StreamUntilCursor, 10, 64)
+		if err != nil {
+			return ErrInvalidIntID
+		}
+		s.until = until
+		s.bounded = true
+	}
+
+	if s.StreamToHead {
+		head, err := getLatestID(s.ctx, s.dbc, s.schema)
+		if err != nil {
+			return err
+		}
+		if !s.bounded || head < s.until {
+			s.until = head
+		}
+		s.bounded = true
+	}
+
+	return nil
+}
+
+// recvDescending returns the next older event after the floor cursor
+// or ErrHeadReached once the floor is reached.
+func (s *streamclient) recvDescending() (*reflex.Event, error) {
+	// Initialise range once.
+	if s.before == 0 {
+		if s.after != "" {
+			var err error
+			s.floor, err = strconv.ParseInt(s.after, 10, 64)
+			if err != nil {
+				return nil, ErrInvalidIntID
+			}
+			s.after = ""
+		}
+
+		latest, err := getLatestID(s.ctx, s.dbc, s.schema)
+		if err != nil {
+			return nil, err
+		}
+		s.before = latest + 1
+	}
+
+	for len(s.buf) == 0 {
+		if s.before-1 <= s.floor {
+			return nil, reflex.ErrHeadReached
+		}
+
+		eventsPollCounter.WithLabelValues(s.schema.name).Inc()
+		el, err := getPrevEvents(s.ctx, s.dbc, s.schema, s.floor, s.before)
+		if err != nil {
+			return nil, err
+		} else if len(el) == 0 {
+			return nil, reflex.ErrHeadReached
+		}
+
+		s.before = el[len(el)-1].IDInt()
+		for _, e := range el {
+			if isNoopEvent(e) {
+				continue
+			}
+			s.buf = append(s.buf, e)
+		}
+	}
+
+	e := s.buf[0]
+	s.buf = s.buf[1:]
+	return e, nil
+}
+
+// sleep blocks for the duration or until the context is canceled.
+func (s *streamclient) sleep(d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
 func (s *streamclient) wait(d time.Duration) error {
 	if d == 0 {
 		return nil
@@ -416,6 +1229,21 @@ func (s *streamclient) wait(d time.Duration) error {
 	}
 }
 
+// nextPollPeriod returns the backoff period after a poll without new events
+// given the previous period, see WithEventsPollPeriod. The period is fixed
+// if max is not greater than min.
+func nextPollPeriod(prev, min, max time.Duration) time.Duration {
+	if max <= min || prev < min {
+		return min
+	}
+
+	next := prev * 2
+	if next > max {
+		return max
+	}
+	return next
+}
+
 // isNoopEvent returns true if an event has "0" foreignID and 0 type.
 func isNoopEvent(e *reflex.Event) bool {
 	return isNoop(e.ForeignID, e.Type)
@@ -9,7 +9,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/luno/jettison/jtest"
 	"github.com/luno/reflex"
+	"github.com/luno/reflex/reflexpb"
 	"github.com/luno/reflex/rsql"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -101,6 +103,46 @@ func TestGapCommitDetection(t *testing.T) {
 	assert.True(t, time.Since(t0) >= delay, "duration %v", time.Since(t0))
 }
 
+func TestGapFilteredDetection(t *testing.T) {
+	table := rsql.NewEventsTable(eventsTable, rsql.WithEventsBackoff(time.Millisecond))
+
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	// Insert 1
+	err := insertTestEvent(dbc, table, i2s(1), testEventType(1))
+	require.NoError(t, err)
+
+	tx, err := dbc.Begin()
+	require.NoError(t, err)
+
+	// Gap at 2
+	_, err = table.Insert(context.Background(), tx, "2", testEventType(2))
+	require.NoError(t, err)
+
+	// Insert 3
+	err = insertTestEvent(dbc, table, i2s(3), testEventType(3))
+	require.NoError(t, err)
+
+	// Commit gap after delay.
+	t0 := time.Now()
+	delay := 100 * time.Millisecond
+	go func() {
+		time.Sleep(delay)
+		err = tx.Commit()
+		require.NoError(t, err)
+	}()
+
+	sc, err := table.ToStream(dbc)(context.Background(), "",
+		reflex.WithStreamTypes(testEventType(2), testEventType(3)))
+	assert.NoError(t, err)
+
+	// This should block until delay, then return 2 and 3 even though
+	// 3 matches the filter before the gap is committed.
+	assertEvent(t, sc, 2, 3)
+	assert.True(t, time.Since(t0) >= delay, "duration %v", time.Since(t0))
+}
+
 func TestNoDeadlockGap(t *testing.T) {
 	table := rsql.NewEventsTable(eventsTable, rsql.WithEventsBackoff(time.Millisecond))
 
@@ -489,3 +531,699 @@ func TestInMemNotifier(t *testing.T) {
 	require.True(t, time.Since(t0) > lag, "want: %s\ngot: %s", lag, time.Since(t0))
 	require.True(t, time.Since(t0) < 5*time.Second, time.Since(t0))
 }
+
+func TestFetchLimit(t *testing.T) {
+	cases := []struct {
+		name string
+		opt  rsql.EventsOption
+	}{
+		{
+			name: "fixed",
+			opt:  rsql.WithEventsFetchLimit(3),
+		}, {
+			name: "adaptive",
+			opt:  rsql.WithEventsAdaptiveFetch(1, 8, 0),
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			dbc := ConnectTestDB(t, eventsTable, "")
+			defer dbc.Close()
+
+			table := rsql.NewEventsTable(eventsTable, test.opt, rsql.WithoutEventsCache())
+
+			total := 25
+			for i := 0; i < total; i++ {
+				err := insertTestEvent(dbc, table, i2s(i), testEventType(1))
+				require.NoError(t, err)
+			}
+
+			sc, err := table.ToStream(dbc)(context.Background(), "", reflex.WithStreamToHead())
+			require.NoError(t, err)
+
+			for i := 1; i <= total; i++ {
+				e, err := sc.Recv()
+				require.NoError(t, err)
+				require.Equal(t, int64(i), e.IDInt())
+			}
+
+			_, err = sc.Recv()
+			require.True(t, reflex.IsHeadReachedErr(err))
+		})
+	}
+}
+
+func TestEventsQueryHint(t *testing.T) {
+	dbc := ConnectTestDB(t, eventsTable, "")
+	defer dbc.Close()
+
+	table := rsql.NewEventsTable(eventsTable, rsql.WithoutEventsCache(),
+		rsql.WithEventsQueryHint("force index (primary)"))
+
+	total := 5
+	for i := 0; i < total; i++ {
+		err := insertTestEvent(dbc, table, i2s(i), testEventType(1))
+		require.NoError(t, err)
+	}
+
+	sc, err := table.ToStream(dbc)(context.Background(), "", reflex.WithStreamToHead())
+	require.NoError(t, err)
+
+	for i := 1; i <= total; i++ {
+		e, err := sc.Recv()
+		require.NoError(t, err)
+		require.Equal(t, int64(i), e.IDInt())
+	}
+
+	_, err = sc.Recv()
+	require.True(t, reflex.IsHeadReachedErr(err))
+}
+
+func TestLazyMetadata(t *testing.T) {
+	cache := eventsMetadataField
+	defer func() {
+		eventsMetadataField = cache
+	}()
+	eventsMetadataField = "metadata"
+
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	table := rsql.NewEventsTable(eventsTable,
+		rsql.WithEventMetadataField(eventsMetadataField),
+		rsql.WithEventsLazyMetadata())
+
+	for i := 1; i <= 3; i++ {
+		err := insertTestEventMeta(dbc, table, i2s(i), testEventType(i), []byte{byte(i)})
+		require.NoError(t, err)
+	}
+
+	sc, err := table.ToStream(dbc)(context.Background(), "", reflex.WithStreamToHead())
+	require.NoError(t, err)
+
+	var el []*reflex.Event
+	for i := 1; i <= 3; i++ {
+		e, err := sc.Recv()
+		require.NoError(t, err)
+		require.Nil(t, e.MetaData)
+		el = append(el, e)
+	}
+
+	mm, err := table.LoadMetadata(context.Background(), dbc, el...)
+	require.NoError(t, err)
+	require.Len(t, mm, 3)
+	for i, e := range el {
+		require.Equal(t, []byte{byte(i + 1)}, mm[e.ID])
+	}
+}
+
+func TestMetadataCipher(t *testing.T) {
+	cache := eventsMetadataField
+	defer func() {
+		eventsMetadataField = cache
+	}()
+	eventsMetadataField = "metadata"
+
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	key1, key2 := make([]byte, 16), make([]byte, 32)
+	key2[0] = 1
+
+	cipher1, err := rsql.NewAESCipher("k1", map[string][]byte{"k1": key1})
+	jtest.RequireNil(t, err)
+	cipher2, err := rsql.NewAESCipher("k2", map[string][]byte{"k1": key1, "k2": key2})
+	jtest.RequireNil(t, err)
+
+	table1 := rsql.NewEventsTable(eventsTable,
+		rsql.WithEventMetadataField(eventsMetadataField),
+		rsql.WithMetadataCipher(cipher1))
+	table2 := table1.Clone(rsql.WithMetadataCipher(cipher2))
+
+	md := []byte("secret")
+	require.NoError(t, insertTestEventMeta(dbc, table1, "1", testEventType(1), md))
+	require.NoError(t, insertTestEventMeta(dbc, table2, "2", testEventType(2), md))
+	require.NoError(t, insertTestEventMeta(dbc, table2, "3", testEventType(3), nil))
+
+	// Metadata is encrypted at rest.
+	var raw []byte
+	err = dbc.QueryRow("select metadata from " + eventsTable + " where id=1").Scan(&raw)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), string(md))
+
+	sc := table2.Stream(context.Background(), dbc, "", reflex.WithStreamToHead())
+	var el []*reflex.Event
+	for i := 0; i < 3; i++ {
+		e, err := sc.Recv()
+		require.NoError(t, err)
+		el = append(el, e)
+	}
+	require.Equal(t, md, el[0].MetaData)
+	require.Equal(t, md, el[1].MetaData)
+	require.Nil(t, el[2].MetaData)
+
+	mm, err := table2.LoadMetadata(context.Background(), dbc, el[:2]...)
+	require.NoError(t, err)
+	require.Equal(t, md, mm["1"])
+	require.Equal(t, md, mm["2"])
+
+	// Old key is unknown after rotation.
+	sc = table1.Stream(context.Background(), dbc, "1", reflex.WithStreamToHead())
+	_, err = sc.Recv()
+	jtest.Require(t, rsql.ErrUnknownCipherKey, err)
+}
+
+func TestMetadataCompression(t *testing.T) {
+	cache := eventsMetadataField
+	defer func() {
+		eventsMetadataField = cache
+	}()
+	eventsMetadataField = "metadata"
+
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	key := make([]byte, 16)
+	cipher, err := rsql.NewAESCipher("k1", map[string][]byte{"k1": key})
+	jtest.RequireNil(t, err)
+
+	plain := rsql.NewEventsTable(eventsTable, rsql.WithEventMetadataField(eventsMetadataField))
+	table := plain.Clone(rsql.WithMetadataCompression(rsql.CompressionGzip))
+	encrypted := plain.Clone(rsql.WithMetadataCompression(rsql.CompressionGzip),
+		rsql.WithMetadataCipher(cipher))
+
+	md := []byte(`{"key":"value","other":"value","another":"value"}`)
+	require.NoError(t, insertTestEventMeta(dbc, plain, "1", testEventType(1), md))
+	require.NoError(t, insertTestEventMeta(dbc, table, "2", testEventType(2), md))
+
+	// Metadata is compressed at rest.
+	var raw []byte
+	err = dbc.QueryRow("select metadata from " + eventsTable + " where id=2").Scan(&raw)
+	require.NoError(t, err)
+	require.NotEqual(t, md, raw)
+
+	// Mixed uncompressed and compressed metadata.
+	sc := table.Stream(context.Background(), dbc, "", reflex.WithStreamToHead())
+	for i := 0; i < 2; i++ {
+		e, err := sc.Recv()
+		require.NoError(t, err)
+		require.Equal(t, md, e.MetaData)
+	}
+
+	require.NoError(t, insertTestEventMeta(dbc, encrypted, "3", testEventType(3), md))
+
+	el, err := rsql.GetNextEventsForTesting(t, context.Background(), dbc, encrypted, 2, 0)
+	require.NoError(t, err)
+	require.Len(t, el, 1)
+	require.Equal(t, md, el[0].MetaData)
+}
+
+func TestInsertMetadataTooLarge(t *testing.T) {
+	table := rsql.NewEventsTable(eventsTable, rsql.WithEventMetadataField(eventsMetadataField),
+		rsql.WithEventsMaxMetadataSize(8))
+	ctx := context.Background()
+
+	_, err := table.InsertWithMetadata(ctx, nil, "1", testEventType(1), make([]byte, 9))
+	jtest.Require(t, rsql.ErrMetadataTooLarge, err)
+
+	_, err = table.InsertJSON(ctx, nil, "1", testEventType(1), map[string]string{"key": "value"})
+	jtest.Require(t, rsql.ErrMetadataTooLarge, err)
+
+	_, err = table.InsertProto(ctx, nil, "1", testEventType(1), &reflexpb.Event{Id: "123456789"})
+	jtest.Require(t, rsql.ErrMetadataTooLarge, err)
+
+	_, err = table.Clone().InsertWithMetadata(ctx, nil, "1", testEventType(1), make([]byte, 9))
+	jtest.Require(t, rsql.ErrMetadataTooLarge, err)
+}
+
+func TestInsertMany(t *testing.T) {
+	table := rsql.NewEventsTable(eventsTable, rsql.WithEventMetadataField(eventsMetadataField))
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	var events []rsql.EventToInsert
+	for i := 1; i <= 100; i++ {
+		events = append(events, rsql.EventToInsert{
+			ForeignID: i2s(i),
+			Type:      testEventType(i),
+			MetaData:  []byte{byte(i)},
+		})
+	}
+
+	tx, err := dbc.Begin()
+	jtest.RequireNil(t, err)
+	notify, err := table.InsertMany(context.Background(), tx, events)
+	jtest.RequireNil(t, err)
+	jtest.RequireNil(t, tx.Commit())
+	notify()
+
+	sc, err := table.ToStream(dbc, reflex.WithStreamToHead())(context.Background(), "")
+	jtest.RequireNil(t, err)
+	for i := 1; i <= 100; i++ {
+		e, err := sc.Recv()
+		jtest.RequireNil(t, err)
+		require.Equal(t, i2s(i), e.ID)
+		require.Equal(t, i2s(i), e.ForeignID)
+		require.Equal(t, i, e.Type.ReflexType())
+		require.Equal(t, []byte{byte(i)}, e.MetaData)
+	}
+	_, err = sc.Recv()
+	jtest.Require(t, reflex.ErrHeadReached, err)
+}
+
+func TestPostCommitHook(t *testing.T) {
+	var ids []string
+	table := rsql.NewEventsTable(eventsTable, rsql.WithEventsPostCommitHook(
+		func(ctx context.Context, l []string) {
+			ids = append(ids, l...)
+		}))
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	err := insertTestEvent(dbc, table, "1", testEventType(1))
+	jtest.RequireNil(t, err)
+	require.Equal(t, []string{"1"}, ids)
+
+	tx, err := dbc.Begin()
+	jtest.RequireNil(t, err)
+	notify, err := table.InsertMany(context.Background(), tx, []rsql.EventToInsert{
+		{ForeignID: "2", Type: testEventType(1)},
+		{ForeignID: "3", Type: testEventType(1)},
+	})
+	jtest.RequireNil(t, err)
+	jtest.RequireNil(t, tx.Commit())
+	notify()
+
+	require.Equal(t, []string{"1", "2", "3"}, ids)
+}
+
+func TestEventsDedup(t *testing.T) {
+	table := rsql.NewEventsTable(eventsTable, rsql.WithEventsDedupField("dedup_key"),
+		rsql.WithEventsBackoff(time.Millisecond), rsql.WithoutEventsCache())
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	_, err := dbc.Exec("alter table " + eventsTable + " add column dedup_key varchar(255) null, " +
+		"add unique index by_dedup_key (dedup_key)")
+	jtest.RequireNil(t, err)
+
+	insert := func(foreignID string, typ int, key string) {
+		tx, err := dbc.Begin()
+		jtest.RequireNil(t, err)
+		_, err = table.InsertWithDedupKey(context.Background(), tx, foreignID, testEventType(typ), key)
+		jtest.RequireNil(t, err)
+		jtest.RequireNil(t, tx.Commit())
+	}
+
+	insert("1", 1, "a")
+	insert("1", 1, "a") // Duplicate ignored
+	insert("1", 1, "b") // Same type and foreign id with another key
+	insert("1", 1, "")  // Empty keys are never deduplicated
+	insert("1", 1, "")
+
+	var n int
+	jtest.RequireNil(t, dbc.QueryRow("select count(*) from "+eventsTable).Scan(&n))
+	require.Equal(t, 4, n)
+}
+
+func TestEventsDedupUniqueKey(t *testing.T) {
+	table := rsql.NewEventsTable(eventsTable, rsql.WithEventsDedupField("dedup_key", "type", "foreign_id"),
+		rsql.WithEventsBackoff(time.Millisecond), rsql.WithoutEventsCache())
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	_, err := dbc.Exec("alter table " + eventsTable + " add column dedup_key varchar(255) null, " +
+		"add unique index by_dedup_key (type, foreign_id, dedup_key)")
+	jtest.RequireNil(t, err)
+
+	insert := func(foreignID string, typ int, key string) {
+		tx, err := dbc.Begin()
+		jtest.RequireNil(t, err)
+		_, err = table.InsertWithDedupKey(context.Background(), tx, foreignID, testEventType(typ), key)
+		jtest.RequireNil(t, err)
+		jtest.RequireNil(t, tx.Commit())
+	}
+
+	insert("1", 1, "a")
+	insert("1", 1, "a") // Duplicate ignored
+	insert("2", 1, "a") // Same key of another foreign id
+	insert("1", 2, "a") // Same key of another type
+
+	var n int
+	jtest.RequireNil(t, dbc.QueryRow("select count(*) from "+eventsTable).Scan(&n))
+	require.Equal(t, 3, n)
+}
+
+func TestInsertAt(t *testing.T) {
+	const scheduledTable = "scheduled_events"
+
+	table := rsql.NewEventsTable(eventsTable, rsql.WithEventsScheduledTable(scheduledTable),
+		rsql.WithEventsBackoff(time.Millisecond), rsql.WithoutEventsCache())
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	_, err := dbc.Exec("create table " + scheduledTable + " (" +
+		"id bigint not null auto_increment, foreign_id varchar(255) not null, " +
+		"type int not null, available_at datetime(6) not null, primary key (id))")
+	jtest.RequireNil(t, err)
+	defer dbc.Exec("drop table " + scheduledTable)
+
+	insertAt := func(id int, at time.Time) {
+		tx, err := dbc.Begin()
+		jtest.RequireNil(t, err)
+		_, err = table.InsertAt(context.Background(), tx, i2s(id), testEventType(id), at)
+		jtest.RequireNil(t, err)
+		jtest.RequireNil(t, tx.Commit())
+	}
+
+	t0 := time.Now()
+	insertAt(1, time.Time{})
+	insertAt(2, t0.Add(time.Millisecond*200))
+	insertAt(3, time.Time{})
+
+	// Scheduled events don't delay other events.
+	sc, err := table.ToStream(dbc)(context.Background(), "")
+	jtest.RequireNil(t, err)
+
+	assertNext := func(id int64, foreignID string) {
+		e, err := sc.Recv()
+		jtest.RequireNil(t, err)
+		require.Equal(t, id, e.IDInt())
+		require.Equal(t, foreignID, e.ForeignID)
+	}
+	assertNext(1, "1")
+	assertNext(2, "3")
+
+	// Nothing due yet.
+	n, err := table.ForwardScheduled(context.Background(), dbc)
+	jtest.RequireNil(t, err)
+	require.Equal(t, 0, n)
+
+	time.Sleep(time.Until(t0.Add(time.Millisecond * 200)))
+
+	n, err = table.ForwardScheduled(context.Background(), dbc)
+	jtest.RequireNil(t, err)
+	require.Equal(t, 1, n)
+	assertNext(3, "2")
+
+	// Forwarded only once.
+	n, err = table.ForwardScheduled(context.Background(), dbc)
+	jtest.RequireNil(t, err)
+	require.Equal(t, 0, n)
+}
+
+func TestEventsForeignIDType(t *testing.T) {
+	const uuid = "7d444840-9dc0-11d1-b245-5ffdce74fad2"
+
+	tests := []struct {
+		name    string
+		typ     rsql.ForeignIDType
+		column  string
+		valid   string
+		invalid string
+	}{
+		{
+			name:    "int64",
+			typ:     rsql.ForeignIDInt64,
+			column:  "bigint not null",
+			valid:   "1234",
+			invalid: "abc",
+		}, {
+			name:    "uuid",
+			typ:     rsql.ForeignIDUUID,
+			column:  "binary(16) not null",
+			valid:   uuid,
+			invalid: "1234",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table := rsql.NewEventsTable(eventsTable, rsql.WithEventForeignIDType(test.typ),
+				rsql.WithEventsBackoff(time.Millisecond), rsql.WithoutEventsCache())
+			dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+			defer close()
+
+			_, err := dbc.Exec("alter table " + eventsTable + " modify foreign_id " + test.column)
+			jtest.RequireNil(t, err)
+
+			insert := func(foreignID string) error {
+				tx, err := dbc.Begin()
+				jtest.RequireNil(t, err)
+				defer tx.Rollback()
+
+				if _, err := table.Insert(context.Background(), tx, foreignID, testEventType(1)); err != nil {
+					return err
+				}
+				return tx.Commit()
+			}
+
+			jtest.RequireNil(t, insert(test.valid))
+			jtest.Require(t, reflex.ErrInvalidForeignID, insert(test.invalid))
+
+			sc, err := table.ToStream(dbc)(context.Background(), "")
+			jtest.RequireNil(t, err)
+
+			e, err := sc.Recv()
+			jtest.RequireNil(t, err)
+			require.Equal(t, test.valid, e.ForeignID)
+		})
+	}
+}
+
+func TestEventsForeignKeys(t *testing.T) {
+	table := rsql.NewEventsTable(eventsTable,
+		rsql.WithEventForeignKeyFields("account_id", "entity_id"),
+		rsql.WithEventsBackoff(time.Millisecond), rsql.WithoutEventsCache())
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	_, err := dbc.Exec("alter table " + eventsTable + " add column account_id varchar(255) null, " +
+		"add column entity_id varchar(255) null, add index by_account_entity (account_id, entity_id)")
+	jtest.RequireNil(t, err)
+
+	insert := func(foreignID string, keys map[string]string) error {
+		tx, err := dbc.Begin()
+		jtest.RequireNil(t, err)
+		defer tx.Rollback()
+
+		if _, err := table.InsertWithForeignKeys(context.Background(), tx, foreignID,
+			testEventType(1), keys); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	jtest.RequireNil(t, insert("1", map[string]string{"account_id": "a", "entity_id": "x"}))
+	jtest.RequireNil(t, insert("2", map[string]string{"account_id": "b", "entity_id": "x"}))
+	jtest.RequireNil(t, insert("3", map[string]string{"account_id": "a"}))
+	jtest.RequireNil(t, insert("4", nil))
+	require.Error(t, insert("5", map[string]string{"unknown": "a"}))
+
+	stream := func(opts ...reflex.StreamOption) []*reflex.Event {
+		sc, err := table.ToStream(dbc)(context.Background(), "",
+			append(opts, reflex.WithStreamToHead())...)
+		jtest.RequireNil(t, err)
+
+		var res []*reflex.Event
+		for {
+			e, err := sc.Recv()
+			if reflex.IsHeadReachedErr(err) {
+				return res
+			}
+			jtest.RequireNil(t, err)
+			res = append(res, e)
+		}
+	}
+
+	el := stream()
+	require.Len(t, el, 4)
+	require.Equal(t, map[string]string{"account_id": "a", "entity_id": "x"}, el[0].ForeignKeys)
+	require.Equal(t, map[string]string{"account_id": "a"}, el[2].ForeignKeys)
+	require.Nil(t, el[3].ForeignKeys)
+
+	ids := func(el []*reflex.Event) []string {
+		var res []string
+		for _, e := range el {
+			res = append(res, e.ForeignID)
+		}
+		return res
+	}
+
+	require.Equal(t, []string{"1", "3"}, ids(stream(reflex.WithStreamForeignKey("account_id", "a"))))
+	require.Equal(t, []string{"1"}, ids(stream(reflex.WithStreamForeignKey("account_id", "a"),
+		reflex.WithStreamForeignKey("entity_id", "x"))))
+	require.Empty(t, stream(reflex.WithStreamForeignKey("account_id", "c")))
+}
+
+func TestEventsHeaders(t *testing.T) {
+	table := rsql.NewEventsTable(eventsTable, rsql.WithEventHeadersField("headers"),
+		rsql.WithEventsBackoff(time.Millisecond), rsql.WithoutEventsCache())
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	_, err := dbc.Exec("alter table " + eventsTable + " add column headers json null")
+	jtest.RequireNil(t, err)
+
+	insert := func(foreignID string, headers map[string]string) {
+		tx, err := dbc.Begin()
+		jtest.RequireNil(t, err)
+		_, err = table.InsertWithHeaders(context.Background(), tx, foreignID, testEventType(1), headers)
+		jtest.RequireNil(t, err)
+		jtest.RequireNil(t, tx.Commit())
+	}
+
+	insert("1", map[string]string{"tenant_id": "a", "trace_id": "t1"})
+	insert("2", map[string]string{"tenant_id": "b"})
+	insert("3", nil)
+	insert("4", map[string]string{"tenant_id": "a"})
+
+	sc, err := table.ToStream(dbc)(context.Background(), "", reflex.WithStreamToHead())
+	jtest.RequireNil(t, err)
+
+	var headers []map[string]string
+	for {
+		e, err := sc.Recv()
+		if reflex.IsHeadReachedErr(err) {
+			break
+		}
+		jtest.RequireNil(t, err)
+		headers = append(headers, e.Headers)
+	}
+	require.Equal(t, []map[string]string{
+		{"tenant_id": "a", "trace_id": "t1"},
+		{"tenant_id": "b"},
+		nil,
+		{"tenant_id": "a"},
+	}, headers)
+
+	sc, err = table.ToStream(dbc)(context.Background(), "", reflex.WithStreamToHead(),
+		reflex.WithStreamHeader("tenant_id", "a"))
+	jtest.RequireNil(t, err)
+
+	var ids []string
+	for {
+		e, err := sc.Recv()
+		if reflex.IsHeadReachedErr(err) {
+			break
+		}
+		jtest.RequireNil(t, err)
+		ids = append(ids, e.ForeignID)
+	}
+	require.Equal(t, []string{"1", "4"}, ids)
+
+	// Headers require the field.
+	plain := rsql.NewEventsTable(eventsTable)
+	tx, err := dbc.Begin()
+	jtest.RequireNil(t, err)
+	defer tx.Rollback()
+	_, err = plain.InsertWithHeaders(context.Background(), tx, "5", testEventType(1),
+		map[string]string{"tenant_id": "a"})
+	require.Error(t, err)
+}
+
+func TestEventsTenancy(t *testing.T) {
+	table := rsql.NewEventsTable(eventsTable, rsql.WithEventTenantField("tenant_id"),
+		rsql.WithEventsBackoff(time.Millisecond), rsql.WithoutEventsCache())
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	_, err := dbc.Exec("alter table " + eventsTable + " add column tenant_id varchar(255) null, " +
+		"add index by_tenant (tenant_id, id)")
+	jtest.RequireNil(t, err)
+
+	insert := func(tenant, foreignID string) error {
+		tx, err := dbc.Begin()
+		jtest.RequireNil(t, err)
+		defer tx.Rollback()
+
+		if _, err := table.InsertWithTenant(context.Background(), tx, tenant, foreignID,
+			testEventType(1)); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	jtest.RequireNil(t, insert("t1", "1"))
+	jtest.RequireNil(t, insert("t2", "2"))
+	jtest.RequireNil(t, insert("t1", "3"))
+	require.Error(t, insert("", "4"))
+
+	stream := func(opts ...reflex.StreamOption) []*reflex.Event {
+		sc, err := table.ToStream(dbc)(context.Background(), "",
+			append(opts, reflex.WithStreamToHead())...)
+		jtest.RequireNil(t, err)
+
+		var res []*reflex.Event
+		for {
+			e, err := sc.Recv()
+			if reflex.IsHeadReachedErr(err) {
+				return res
+			}
+			jtest.RequireNil(t, err)
+			res = append(res, e)
+		}
+	}
+
+	var tenants []string
+	for _, e := range stream() {
+		tenants = append(tenants, e.TenantID)
+	}
+	require.Equal(t, []string{"t1", "t2", "t1"}, tenants)
+
+	var ids []string
+	for _, e := range stream(reflex.WithTenant("t1")) {
+		ids = append(ids, e.ForeignID)
+	}
+	require.Equal(t, []string{"1", "3"}, ids)
+
+	// Tenant streams require tenancy.
+	sc, err := rsql.NewEventsTable(eventsTable).ToStream(dbc)(context.Background(), "",
+		reflex.WithTenant("t1"))
+	jtest.RequireNil(t, err)
+	_, err = sc.Recv()
+	require.Error(t, err)
+}
+
+func TestEventsChecksum(t *testing.T) {
+	table := rsql.NewEventsTable(eventsTable, rsql.WithEventChecksumField("checksum"),
+		rsql.WithEventMetadataField("meta"), rsql.WithoutEventsCache())
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	_, err := dbc.Exec("alter table " + eventsTable + " add column checksum char(64) null, add column meta blob null")
+	jtest.RequireNil(t, err)
+
+	ctx := context.Background()
+	for i := 1; i <= 3; i++ {
+		tx, err := dbc.Begin()
+		jtest.RequireNil(t, err)
+		_, err = table.InsertWithMetadata(ctx, tx, fmt.Sprint(i), testEventType(1), []byte("meta"))
+		jtest.RequireNil(t, err)
+		jtest.RequireNil(t, tx.Commit())
+	}
+
+	// Events without checksums are not verified.
+	_, err = dbc.Exec("insert into " + eventsTable +
+		" set foreign_id='4', timestamp=now(), type=1")
+	jtest.RequireNil(t, err)
+
+	v := rsql.NewVerifier(table)
+	ids, err := v.VerifyOnce(ctx, dbc)
+	jtest.RequireNil(t, err)
+	require.Empty(t, ids)
+
+	// Tampered events fail the stream and the verifier.
+	_, err = dbc.Exec("update " + eventsTable + " set meta='evil' where id=2")
+	jtest.RequireNil(t, err)
+
+	sc, err := table.ToStream(dbc)(ctx, "", reflex.WithStreamToHead())
+	jtest.RequireNil(t, err)
+	_, err = sc.Recv()
+	jtest.Require(t, rsql.ErrChecksumMismatch, err)
+
+	ids, err = v.VerifyOnce(ctx, dbc)
+	jtest.RequireNil(t, err)
+	require.Equal(t, []int64{2}, ids)
+}
@@ -0,0 +1,83 @@
+package rsql
+
+import (
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+// noopUUID is the binary foreign ID of noops in ForeignIDUUID tables.
+var noopUUID [16]byte
+
+// bindForeignID returns the foreign ID as a query argument of the
+// schema's foreign ID type.
+func (s etableSchema) bindForeignID(foreignID string) (interface{}, error) {
+	e := reflex.Event{ForeignID: foreignID}
+
+	switch s.foreignIDType {
+	case ForeignIDInt64:
+		return e.ParseForeignIDInt()
+	case ForeignIDUUID:
+		if foreignID == "0" {
+			return noopUUID[:], nil
+		}
+		b, err := e.ForeignIDUUID()
+		if err != nil {
+			return nil, err
+		}
+		return b[:], nil
+	default:
+		return foreignID, nil
+	}
+}
+
+// formatForeignID returns the foreign ID scanned from the schema's
+// foreign ID field as a reflex event foreign ID.
+func (s etableSchema) formatForeignID(foreignID string) string {
+	if s.foreignIDType != ForeignIDUUID || len(foreignID) != 16 {
+		return foreignID
+	} else if foreignID == string(noopUUID[:]) {
+		return "0"
+	}
+
+	b := make([]byte, 36)
+	hex.Encode(b[0:8], []byte(foreignID[0:4]))
+	hex.Encode(b[9:13], []byte(foreignID[4:6]))
+	hex.Encode(b[14:18], []byte(foreignID[6:8]))
+	hex.Encode(b[19:23], []byte(foreignID[8:10]))
+	hex.Encode(b[24:], []byte(foreignID[10:]))
+	b[8], b[13], b[18], b[23] = '-', '-', '-', '-'
+
+	return string(b)
+}
+
+// bindForeignKeys returns the foreign key values as query arguments in the
+// order of the schema's foreign key fields. Missing keys are bound as null.
+func (s etableSchema) bindForeignKeys(keys map[string]string) ([]interface{}, error) {
+	for key := range keys {
+		if !s.isForeignKeyField(key) {
+			return nil, errors.New("foreign key not enabled", j.KS("key", key))
+		}
+	}
+
+	var args []interface{}
+	for _, field := range s.foreignKeyFields {
+		val, ok := keys[field]
+		args = append(args, sql.NullString{String: val, Valid: ok})
+	}
+	return args, nil
+}
+
+// isForeignKeyField returns true if the field is one of the schema's
+// foreign key fields.
+func (s etableSchema) isForeignKeyField(field string) bool {
+	for _, f := range s.foreignKeyFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package rsql
+
+import (
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForeignIDType(t *testing.T) {
+	tests := []struct {
+		name      string
+		typ       ForeignIDType
+		foreignID string
+		bound     interface{}
+		formatted string
+		err       error
+	}{
+		{
+			name:      "string",
+			typ:       ForeignIDString,
+			foreignID: "abc",
+			bound:     "abc",
+			formatted: "abc",
+		}, {
+			name:      "int64",
+			typ:       ForeignIDInt64,
+			foreignID: "123",
+			bound:     int64(123),
+			formatted: "123",
+		}, {
+			name:      "int64 invalid",
+			typ:       ForeignIDInt64,
+			foreignID: "abc",
+			err:       reflex.ErrInvalidForeignID,
+		}, {
+			name:      "uuid",
+			typ:       ForeignIDUUID,
+			foreignID: "7d444840-9dc0-11d1-b245-5ffdce74fad2",
+			bound: []byte{0x7d, 0x44, 0x48, 0x40, 0x9d, 0xc0, 0x11, 0xd1,
+				0xb2, 0x45, 0x5f, 0xfd, 0xce, 0x74, 0xfa, 0xd2},
+			formatted: "7d444840-9dc0-11d1-b245-5ffdce74fad2",
+		}, {
+			name:      "uuid hex",
+			typ:       ForeignIDUUID,
+			foreignID: "7D4448409DC011D1B2455FFDCE74FAD2",
+			bound: []byte{0x7d, 0x44, 0x48, 0x40, 0x9d, 0xc0, 0x11, 0xd1,
+				0xb2, 0x45, 0x5f, 0xfd, 0xce, 0x74, 0xfa, 0xd2},
+			formatted: "7d444840-9dc0-11d1-b245-5ffdce74fad2",
+		}, {
+			name:      "uuid noop",
+			typ:       ForeignIDUUID,
+			foreignID: "0",
+			bound:     make([]byte, 16),
+			formatted: "0",
+		}, {
+			name:      "uuid invalid",
+			typ:       ForeignIDUUID,
+			foreignID: "7d444840-9dc0-11d1-b245-5ffdce74fadz",
+			err:       reflex.ErrInvalidForeignID,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema := etableSchema{foreignIDType: test.typ}
+
+			arg, err := schema.bindForeignID(test.foreignID)
+			if test.err != nil {
+				jtest.Require(t, test.err, err)
+				return
+			}
+			jtest.RequireNil(t, err)
+			require.Equal(t, test.bound, arg)
+
+			// Drivers scan bound values into strings.
+			var scanned string
+			switch v := arg.(type) {
+			case string:
+				scanned = v
+			case int64:
+				scanned = test.foreignID
+			case []byte:
+				scanned = string(v)
+			}
+			require.Equal(t, test.formatted, schema.formatForeignID(scanned))
+		})
+	}
+}
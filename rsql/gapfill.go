@@ -21,6 +21,25 @@ type Gap struct {
 	Next int64
 }
 
+// GapPolicy defines how gaps in the events table are handled by streams
+// and gap fillers. The zero value blocks streams until gaps are filled and
+// waits indefinitely for uncommitted events when filling gaps.
+type GapPolicy struct {
+	// FillTimeout defines the maximum duration the gap filler waits for
+	// uncommitted events before giving up. The gap is retried the next time
+	// it is detected. Zero waits indefinitely.
+	FillTimeout time.Duration
+
+	// SkipAfter defines the duration after which streams skip a detected gap
+	// that is still not filled. Skipped events are treated as noops, so any
+	// event committed in the gap afterwards is never streamed. Zero never skips.
+	SkipAfter time.Duration
+
+	// OnGap is called synchronously by streams when a gap is detected.
+	// It should not block.
+	OnGap func(Gap)
+}
+
 // FillGaps registers the default gap filler with the events table. It
 // inserts noops into the events table when gaps are detected. Both
 // EventsTable and EventsTableInt satisfy the gapTable internal interface.
@@ -29,7 +48,7 @@ type Gap struct {
 //   ...
 //   rsql.FillGaps(dbc, events)
 func FillGaps(dbc *sql.DB, gapTable gapTable) {
-	gapTable.ListenGaps(makeFill(dbc, gapTable.getSchema()))
+	gapTable.ListenGaps(makeFill(dbc, gapTable.getSchema(), gapTable.getGapPolicy()))
 }
 
 // gapTable is a common interface between EventsTable and EventsTableInt
@@ -37,14 +56,21 @@ func FillGaps(dbc *sql.DB, gapTable gapTable) {
 type gapTable interface {
 	ListenGaps(f func(Gap))
 	getSchema() etableSchema
+	getGapPolicy() GapPolicy
 }
 
 // makeFill returns a fill function that ensures that rows exist
 // with the ids indicated by the Gap. It does so by either detecting
 // existing rows or by inserting noop events. It is idempotent.
-func makeFill(dbc *sql.DB, schema etableSchema) func(Gap) {
+func makeFill(dbc *sql.DB, schema etableSchema, policy GapPolicy) func(Gap) {
 	return func(gap Gap) {
 		ctx := context.Background()
+		if policy.FillTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, policy.FillTimeout)
+			defer cancel()
+		}
+
 		for i := gap.Prev + 1; i < gap.Next; i++ {
 			err := fillGap(ctx, dbc, schema, i)
 			if err != nil {
@@ -68,11 +94,19 @@ func fillGap(ctx context.Context, dbc *sql.DB, schema etableSchema, id int64) er
 		return nil // Gap already filled
 	}
 
+	noopID, err := schema.bindForeignID("0")
+	if err != nil {
+		return err
+	}
+
 	// It does not exists at all, so insert noop.
-	_, err = dbc.ExecContext(ctx, "insert into "+schema.name+
-		" set id=?, "+schema.foreignIDField+"=0, "+schema.timeField+"=now(), "+
-		schema.typeField+"=0", id)
-	if isMySQLErrDupEntry(err) {
+	err = schema.dialect.retry(ctx, func() error {
+		_, err := dbc.ExecContext(ctx, schema.dialect.insert(schema.name,
+			[]string{"id", schema.foreignIDField, schema.timeField, schema.typeField},
+			[]string{"?", "?", schema.dialect.now(), "0"}), id, noopID)
+		return err
+	})
+	if schema.dialect.isErrDupEntry(err) {
 		// Someone got there first, but that's ok.
 		return nil
 	} else if err != nil {
@@ -93,13 +127,13 @@ func exists(ctx context.Context, dbc *sql.DB, schema etableSchema, id int64,
 	}
 	defer tx.Rollback()
 
-	var exists int
-	err = tx.QueryRow("select exists(select 1 from "+schema.name+
-		" where id=?)", id).Scan(&exists)
+	var exists bool
+	err = tx.QueryRow(schema.dialect.rebind("select exists(select 1 from "+schema.name+
+		" where id=?)"), id).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
-	return exists == 1, tx.Commit()
+	return exists, tx.Commit()
 }
 
 // waitCommitted blocks while an uncommitted event with id exists and returns true once
@@ -124,6 +158,10 @@ func waitCommitted(ctx context.Context, dbc *sql.DB, schema etableSchema, id int
 			return true, nil
 		}
 
-		time.Sleep(time.Millisecond * 100) // Don't spin
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(time.Millisecond * 100): // Don't spin
+		}
 	}
 }
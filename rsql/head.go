@@ -0,0 +1,74 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+)
+
+// SubscribeHead returns a channel that receives the latest event ID (the
+// head) of the table when it changes, starting with the current head. The
+// head is queried when the table's notifier is notified (see
+// WithEventsInMemNotifier) or after the stream backoff (see
+// WithEventsBackoff), so applications can trigger work on "any new event"
+// without streaming the events. Slow receivers only receive the latest head.
+// Query errors are logged and retried. The channel is closed when the
+// context is canceled.
+func (t *EventsTable) SubscribeHead(ctx context.Context, dbc *sql.DB) <-chan int64 {
+	ch := make(chan int64, 1)
+	go func() {
+		defer close(ch)
+		t.subscribeHead(ctx, dbc, ch)
+	}()
+	return ch
+}
+
+func (t *EventsTable) subscribeHead(ctx context.Context, dbc *sql.DB, ch chan int64) {
+	head := int64(-1)
+	for {
+		// Listen before querying to not miss notifications.
+		notified := t.notifier.C()
+
+		latest, err := getLatestID(ctx, dbc, t.schema)
+		if ctx.Err() != nil {
+			return
+		} else if err != nil {
+			log.Error(ctx, errors.Wrap(err, "subscribe head error",
+				j.KS("table", t.schema.name)))
+		} else if latest != head {
+			head = latest
+			sendLatest(ch, head)
+		}
+
+		timer := time.NewTimer(t.backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-notified:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// sendLatest sends the head to the buffered channel, replacing
+// the previous head if it has not been received yet.
+func sendLatest(ch chan int64, head int64) {
+	for {
+		select {
+		case ch <- head:
+			return
+		default:
+		}
+
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
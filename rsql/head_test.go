@@ -0,0 +1,36 @@
+package rsql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribeHead(t *testing.T) {
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	table := rsql.NewEventsTable(eventsTable,
+		rsql.WithEventsInMemNotifier(),
+		rsql.WithEventsBackoff(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	heads := table.SubscribeHead(ctx, dbc)
+
+	// Starts with the current head.
+	require.Equal(t, int64(0), <-heads)
+
+	for i := 1; i <= 3; i++ {
+		jtest.RequireNil(t, insertTestEvent(dbc, table, i2s(i), testEventType(1)))
+		require.Equal(t, int64(i), <-heads)
+	}
+
+	cancel()
+	for range heads {
+		// Drain until closed.
+	}
+}
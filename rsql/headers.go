@@ -0,0 +1,43 @@
+package rsql
+
+import (
+	"encoding/json"
+
+	"github.com/luno/jettison/errors"
+)
+
+// bindHeaders returns the headers as a JSON object query argument
+// or null if there are no headers.
+func (s etableSchema) bindHeaders(headers map[string]string) (interface{}, error) {
+	if s.headersField == "" {
+		if len(headers) > 0 {
+			return nil, errors.New("headers not enabled")
+		}
+		return nil, nil
+	} else if len(headers) == 0 {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// decodeHeaders returns the headers decoded from the JSON object
+// or nil if there are no headers.
+func decodeHeaders(b []byte) (map[string]string, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	var headers map[string]string
+	if err := json.Unmarshal(b, &headers); err != nil {
+		return nil, err
+	}
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	return headers, nil
+}
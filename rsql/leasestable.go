@@ -0,0 +1,122 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+const (
+	defaultLeaseOwnerField   = "owner"
+	defaultLeaseExpiresField = "expires_at"
+)
+
+// NewLeasesTable returns a new leases table used to coordinate exclusive
+// ownership of keys, for example rpatterns consumer group shards.
+// The table requires a varchar primary key "id", a varchar "owner" and a
+// datetime(6) "expires_at" column. Only MySQL is supported.
+func NewLeasesTable(name string, opts ...LeasesOption) *LeasesTable {
+	table := &LeasesTable{
+		schema: ltableSchema{
+			name:         name,
+			idField:      "id",
+			ownerField:   defaultLeaseOwnerField,
+			expiresField: defaultLeaseExpiresField,
+		},
+	}
+	for _, o := range opts {
+		o(table)
+	}
+	return table
+}
+
+// LeasesOption defines a functional option to configure new leases tables.
+type LeasesOption func(*LeasesTable)
+
+// WithLeaseOwnerField provides an option to set the lease DB owner field.
+// It defaults to 'owner'.
+func WithLeaseOwnerField(field string) LeasesOption {
+	return func(table *LeasesTable) {
+		table.schema.ownerField = field
+	}
+}
+
+// WithLeaseExpiresField provides an option to set the lease DB expiry field.
+// It defaults to 'expires_at'.
+func WithLeaseExpiresField(field string) LeasesOption {
+	return func(table *LeasesTable) {
+		table.schema.expiresField = field
+	}
+}
+
+// LeasesTable provides leases stored in a sql db table.
+type LeasesTable struct {
+	schema ltableSchema
+}
+
+type ltableSchema struct {
+	name         string
+	idField      string
+	ownerField   string
+	expiresField string
+}
+
+// Acquire acquires or renews the lease of the key for the owner and returns
+// true if the owner holds the lease for the ttl.
+func (t *LeasesTable) Acquire(ctx context.Context, dbc *sql.DB, key, owner string,
+	ttl time.Duration) (bool, error) {
+
+	s := t.schema
+	_, err := dbc.ExecContext(ctx, "insert into "+s.name+" set "+s.idField+"=?, "+
+		s.ownerField+"=?, "+s.expiresField+"=now(6) + interval ? microsecond"+
+		" on duplicate key update "+
+		s.ownerField+"=if("+s.ownerField+"=values("+s.ownerField+") or "+
+		s.expiresField+"<now(6), values("+s.ownerField+"), "+s.ownerField+"), "+
+		// Note owner is already updated above.
+		s.expiresField+"=if("+s.ownerField+"=values("+s.ownerField+"), values("+
+		s.expiresField+"), "+s.expiresField+")",
+		key, owner, int64(ttl/time.Microsecond))
+	if err != nil {
+		return false, errors.Wrap(err, "acquire lease error", j.KS("key", key))
+	}
+
+	var current string
+	err = dbc.QueryRowContext(ctx, "select "+s.ownerField+" from "+s.name+
+		" where "+s.idField+"=?", key).Scan(&current)
+	if err != nil {
+		return false, errors.Wrap(err, "query lease error", j.KS("key", key))
+	}
+
+	return current == owner, nil
+}
+
+// Release releases the lease of the key if held by the owner.
+func (t *LeasesTable) Release(ctx context.Context, dbc *sql.DB, key, owner string) error {
+	s := t.schema
+	_, err := dbc.ExecContext(ctx, "delete from "+s.name+" where "+s.idField+"=? and "+
+		s.ownerField+"=?", key, owner)
+	return errors.Wrap(err, "release lease error", j.KS("key", key))
+}
+
+// ToStore returns a reflex LeaseStore interface of this LeasesTable.
+func (t *LeasesTable) ToStore(dbc *sql.DB) reflex.LeaseStore {
+	return &leaseStore{t: t, dbc: dbc}
+}
+
+type leaseStore struct {
+	t   *LeasesTable
+	dbc *sql.DB
+}
+
+func (s *leaseStore) Acquire(ctx context.Context, key, owner string,
+	ttl time.Duration) (bool, error) {
+	return s.t.Acquire(ctx, s.dbc, key, owner, ttl)
+}
+
+func (s *leaseStore) Release(ctx context.Context, key, owner string) error {
+	return s.t.Release(ctx, s.dbc, key, owner)
+}
@@ -0,0 +1,63 @@
+package rsql_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+const leasesSchema = `
+create temporary table %s (
+  id varchar(255) not null,
+  owner varchar(255) not null,
+  expires_at datetime(6) not null,
+
+  primary key (id)
+);
+`
+
+func TestLeasesTable(t *testing.T) {
+	dbc := ConnectTestDB(t, "", "")
+	defer dbc.Close()
+
+	_, err := dbc.Exec(fmt.Sprintf(leasesSchema, "leases"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	ls := rsql.NewLeasesTable("leases").ToStore(dbc)
+
+	ok, err := ls.Acquire(ctx, "key", "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Held by a
+	ok, err = ls.Acquire(ctx, "key", "b", time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Renew
+	ok, err = ls.Acquire(ctx, "key", "a", time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Expired
+	time.Sleep(time.Millisecond * 10)
+	ok, err = ls.Acquire(ctx, "key", "b", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Release by non-owner is ignored
+	require.NoError(t, ls.Release(ctx, "key", "a"))
+	ok, err = ls.Acquire(ctx, "key", "a", time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, ls.Release(ctx, "key", "b"))
+	ok, err = ls.Acquire(ctx, "key", "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
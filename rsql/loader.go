@@ -3,6 +3,8 @@ package rsql
 import (
 	"context"
 	"database/sql"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/luno/reflex"
@@ -25,20 +27,88 @@ type loader func(ctx context.Context, dbc *sql.DB, prevCursor int64,
 // Loaders are layered as follows in streamclient.Recv (from outer to inner):
 //   noopFilter         (filterLoader)
 //   rCache (if enable) (loader)
+//   pageCache (if set) (loader)
 //   gapDetector        (loader)
 //   baseLoader         (loader)
 //
+// Streams with type or foreign ID prefix filters use makeFilterLoader instead.
+//
 // TODO(corver): Remove lag since we now do this at destination.
 type filterLoader func(ctx context.Context, dbc *sql.DB, prevCursor int64,
 	lag time.Duration) (events []*reflex.Event, cursorOverride int64, err error)
 
-// makeBaseLoader returns the default base loader that queries the sql for next events.
-// This loader can be replaced with the WithBaseLoader option.
-func makeBaseLoader(schema etableSchema) loader {
+// makeBaseLoader returns the default base loader that queries the sql for next events
+// in pages sized by the fetch config. This loader can be replaced with the WithBaseLoader option.
+func makeBaseLoader(schema etableSchema, fetch fetchConfig) loader {
+	p := newPager(fetch)
 	return func(ctx context.Context, dbc *sql.DB,
 		prevCursor int64, lag time.Duration) ([]*reflex.Event, error) {
 
-		return getNextEvents(ctx, dbc, schema, prevCursor, lag)
+		limit := p.Limit()
+		el, err := getNextEvents(ctx, dbc, schema, prevCursor, lag, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Update(el, limit)
+		return el, nil
+	}
+}
+
+// makeFilterLoader returns a filter loader that only queries the events
+// matching the filter, see getFilteredEvents. Gaps are detected
+// by first querying the ids of the next events, the matching events are
+// then queried up to the last consecutive id which is returned as the cursor
+// override if no events match. It bypasses the cache.
+func makeFilterLoader(schema etableSchema, fetch fetchConfig, ch chan<- Gap,
+	policy GapPolicy, filter reflex.StreamOptions) filterLoader {
+
+	p := newPager(fetch)
+	ids := loader(func(ctx context.Context, dbc *sql.DB,
+		prev int64, lag time.Duration) ([]*reflex.Event, error) {
+
+		limit := p.Limit()
+		el, err := getNextIDs(ctx, dbc, schema, prev, lag, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Update(el, limit)
+		return el, nil
+	})
+	if !schema.compacted {
+		ids = wrapGapDetector(ids, ch, schema.name, policy)
+	}
+
+	return func(ctx context.Context, dbc *sql.DB,
+		prev int64, lag time.Duration) ([]*reflex.Event, int64, error) {
+
+		il, err := ids(ctx, dbc, prev, lag)
+		if err != nil {
+			return nil, 0, err
+		} else if len(il) == 0 {
+			// No new events
+			return nil, prev, nil
+		}
+
+		last := il[len(il)-1].IDInt()
+		el, err := getFilteredEvents(ctx, dbc, schema, prev, last, filter)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var res []*reflex.Event
+		for _, e := range el {
+			if isNoopEvent(e) {
+				continue
+			}
+			res = append(res, e)
+		}
+		if len(res) == 0 {
+			// No matching events, override cursor.
+			return nil, last, nil
+		}
+		return res, 0, nil
 	}
 }
 
@@ -77,8 +147,35 @@ func wrapNoopFilter(loader loader) filterLoader {
 // wrapGapDetector returns a loader that loads monotonically incremental
 // events (backed by auto increment int column). All events after `prev` cursor and before any
 // gap is returned. Gaps may be permanent, due to rollbacks, or temporary due to uncommitted
-// transactions. Detected gaps are sent on the channel.
-func wrapGapDetector(loader loader, ch chan<- Gap, name string) loader {
+// transactions. Detected gaps are sent on the channel. Gaps are skipped according to the policy.
+func wrapGapDetector(loader loader, ch chan<- Gap, name string, policy GapPolicy) loader {
+	var (
+		mu    sync.Mutex
+		first = make(map[Gap]time.Time) // Time each gap was first detected.
+	)
+
+	// maybeSkip returns true if the gap should be skipped.
+	maybeSkip := func(gap Gap) bool {
+		if policy.SkipAfter <= 0 {
+			return false
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		t0, ok := first[gap]
+		if !ok {
+			first[gap] = time.Now()
+			return false
+		}
+		if time.Since(t0) < policy.SkipAfter {
+			return false
+		}
+
+		delete(first, gap)
+		return true
+	}
+
 	return func(ctx context.Context, dbc *sql.DB, prev int64,
 		lag time.Duration) ([]*reflex.Event, error) {
 
@@ -89,27 +186,57 @@ func wrapGapDetector(loader loader, ch chan<- Gap, name string) loader {
 			return nil, nil
 		}
 
-		for i, e := range el {
+		var res []*reflex.Event
+		for _, e := range el {
 			if !e.IsIDInt() {
 				return nil, ErrInvalidIntID
 			}
 
 			next := e.IDInt()
 			if prev != 0 && next != prev+1 {
-				eventsBlockingGapGauge.WithLabelValues(name).Set(1)
-				// Gap detected, return everything before it.
-				eventsGapDetectCounter.WithLabelValues(name).Inc()
-				select {
-				case ch <- Gap{Prev: prev, Next: next}:
-				default:
+				gap := Gap{Prev: prev, Next: next}
+				if !maybeSkip(gap) {
+					eventsBlockingGapGauge.WithLabelValues(name).Set(1)
+					// Gap detected, return everything before it.
+					eventsGapDetectCounter.WithLabelValues(name).Inc()
+					if policy.OnGap != nil {
+						policy.OnGap(gap)
+					}
+					select {
+					case ch <- gap:
+					default:
+					}
+					return res, nil
+				}
+
+				// Skip gap by replacing it with noops.
+				eventsGapSkippedCounter.WithLabelValues(name).Inc()
+				for i := prev + 1; i < next; i++ {
+					res = append(res, &reflex.Event{
+						ID:        strconv.FormatInt(i, 10),
+						ForeignID: "0",
+						Type:      eventType(0),
+						Timestamp: e.Timestamp,
+					})
 				}
-				return el[:i], nil
 			}
 			eventsBlockingGapGauge.WithLabelValues(name).Set(0)
 
+			res = append(res, e)
 			prev = next
 		}
 
-		return el, nil
+		if policy.SkipAfter > 0 {
+			// Forget gaps that have since been filled.
+			mu.Lock()
+			for gap := range first {
+				if gap.Next <= prev {
+					delete(first, gap)
+				}
+			}
+			mu.Unlock()
+		}
+
+		return res, nil
 	}
 }
@@ -0,0 +1,210 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGapPolicy(t *testing.T) {
+	base := func(ctx context.Context, dbc *sql.DB, prev int64,
+		lag time.Duration) ([]*reflex.Event, error) {
+		var res []*reflex.Event
+		for _, id := range []int64{1, 2, 4, 5} {
+			if id <= prev {
+				continue
+			}
+			res = append(res, &reflex.Event{
+				ID:        strconv.FormatInt(id, 10),
+				ForeignID: "foreign",
+				Type:      eventType(1),
+			})
+		}
+		return res, nil
+	}
+
+	ids := func(el []*reflex.Event) []int64 {
+		var res []int64
+		for _, e := range el {
+			res = append(res, e.IDInt())
+		}
+		return res
+	}
+
+	var gaps []Gap
+	policy := GapPolicy{
+		SkipAfter: time.Millisecond * 10,
+		OnGap: func(gap Gap) {
+			gaps = append(gaps, gap)
+		},
+	}
+
+	l := wrapGapDetector(base, make(chan Gap), "test", policy)
+
+	el, err := l(context.Background(), nil, 1, 0)
+	require.NoError(t, err)
+	require.Equal(t, []int64{2}, ids(el))
+	require.Equal(t, []Gap{{Prev: 2, Next: 4}}, gaps)
+
+	// Still blocked on gap before deadline.
+	el, err = l(context.Background(), nil, 2, 0)
+	require.NoError(t, err)
+	require.Empty(t, el)
+	require.Len(t, gaps, 2)
+
+	time.Sleep(policy.SkipAfter)
+
+	// Gap skipped with noop after deadline.
+	el, err = l(context.Background(), nil, 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, []int64{3, 4, 5}, ids(el))
+	require.True(t, isNoopEvent(el[0]))
+	require.Len(t, gaps, 2)
+}
+
+func TestStreamReconnect(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []EventsOption
+		failures int
+		expErr   error
+	}{
+		{
+			name:     "retry",
+			failures: 2,
+		},
+		{
+			name:     "bad_conn_exhausted",
+			failures: 4,
+			expErr:   driver.ErrBadConn,
+		},
+		{
+			name:     "disabled",
+			opts:     []EventsOption{WithEventsReconnect(0, 0)},
+			failures: 1,
+			expErr:   driver.ErrBadConn,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls int
+			loader := func(ctx context.Context, dbc *sql.DB, prev int64,
+				lag time.Duration) ([]*reflex.Event, error) {
+				calls++
+				if calls <= test.failures {
+					return nil, driver.ErrBadConn
+				}
+				return []*reflex.Event{{ID: strconv.FormatInt(prev+1, 10)}}, nil
+			}
+
+			opts := append([]EventsOption{
+				WithEventsLoader(loader),
+				WithEventsReconnect(3, time.Millisecond),
+			}, test.opts...)
+			table := NewEventsTable("events", opts...)
+
+			sc, err := table.ToStream(nil)(context.Background(), "")
+			require.NoError(t, err)
+
+			e, err := sc.Recv()
+			if test.expErr != nil {
+				require.True(t, errors.Is(err, test.expErr))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "1", e.ID)
+			require.Equal(t, test.failures+1, calls)
+		})
+	}
+}
+
+func TestNextPollPeriod(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max time.Duration
+		exp      []time.Duration
+	}{
+		{
+			name: "fixed",
+			min:  time.Second,
+			exp:  []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			name: "adaptive",
+			min:  time.Second,
+			max:  5 * time.Second,
+			exp: []time.Duration{time.Second, 2 * time.Second,
+				4 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var prev time.Duration
+			for _, exp := range test.exp {
+				prev = nextPollPeriod(prev, test.min, test.max)
+				require.Equal(t, exp, prev)
+			}
+		})
+	}
+}
+
+func TestStreamPrefetch(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []int64
+	)
+	loader := func(ctx context.Context, dbc *sql.DB, prev int64,
+		lag time.Duration) ([]*reflex.Event, error) {
+		mu.Lock()
+		calls = append(calls, prev)
+		mu.Unlock()
+		if prev >= 6 {
+			return nil, nil
+		}
+		return []*reflex.Event{
+			{ID: strconv.FormatInt(prev+1, 10)},
+			{ID: strconv.FormatInt(prev+2, 10)},
+		}, nil
+	}
+	getCalls := func() []int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int64(nil), calls...)
+	}
+
+	table := NewEventsTable("events", WithEventsLoader(loader),
+		WithoutEventsCache(), WithEventsPrefetch(), WithEventsBackoff(time.Hour))
+
+	sc, err := table.ToStream(nil)(context.Background(), "")
+	require.NoError(t, err)
+
+	e, err := sc.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "1", e.ID)
+
+	// The next page is prefetched while the first is consumed.
+	require.Eventually(t, func() bool {
+		return len(getCalls()) == 2
+	}, time.Second, time.Millisecond)
+
+	for i := 2; i <= 6; i++ {
+		e, err := sc.Recv()
+		require.NoError(t, err)
+		require.Equal(t, strconv.Itoa(i), e.ID)
+	}
+
+	require.Eventually(t, func() bool {
+		return len(getCalls()) == 4
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []int64{0, 2, 4, 6}, getCalls())
+}
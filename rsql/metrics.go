@@ -10,6 +10,13 @@ var (
 		Help:      "Total number of set cursor queries performed per table",
 	}, []string{"table"})
 
+	cursorHolderConflictCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "cursors_table",
+		Name:      "holder_conflict_total",
+		Help:      "Total number of cursor writes conflicting with another active holder per table",
+	}, []string{"table"})
+
 	eventsPollCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "reflex",
 		Subsystem: "events_table",
@@ -38,6 +45,13 @@ var (
 		Help:      "Total number of gaps filled",
 	}, []string{"table"})
 
+	eventsGapSkippedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "events_table",
+		Name:      "gap_skipped_total",
+		Help:      "Total number of gaps skipped by streams due to the gap policy",
+	}, []string{"table"})
+
 	eventsGapListenGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "reflex",
 		Subsystem: "events_table",
@@ -45,6 +59,48 @@ var (
 		Help:      "Wether or not any gap listeners have been registered.",
 	}, []string{"table"})
 
+	purgedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "events_table",
+		Name:      "purged_total",
+		Help:      "Total number of events purged per table",
+	}, []string{"table"})
+
+	purgeBlockedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "events_table",
+		Name:      "purge_blocked_total",
+		Help:      "Total number of purges limited by consumer cursors per table",
+	}, []string{"table"})
+
+	checksumMismatchCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "events_table",
+		Name:      "checksum_mismatch_total",
+		Help:      "Total number of events with mismatching checksums found by verifiers per table",
+	}, []string{"table"})
+
+	eventsReplicaLagGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "reflex",
+		Subsystem: "events_table",
+		Name:      "replica_lag_seconds",
+		Help:      "Maximum lag of the read replicas at the last check per table",
+	}, []string{"table"})
+
+	eventsReplicaFailoverCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "events_table",
+		Name:      "replica_failover_total",
+		Help:      "Total number of event queries failed over to the primary per table",
+	}, []string{"table"})
+
+	eventsReconnectCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "events_table",
+		Name:      "reconnect_total",
+		Help:      "Total number of stream queries retried due to connection errors per table",
+	}, []string{"table"})
+
 	rcacheHitsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "reflex",
 		Subsystem: "events_table",
@@ -58,6 +114,20 @@ var (
 		Name:      "rcache_misses_total",
 		Help:      "Total number of read-through cache misses per table",
 	}, []string{"table"})
+
+	pageCacheHitsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "events_table",
+		Name:      "page_cache_hits_total",
+		Help:      "Total number of shared page cache hits per table",
+	}, []string{"table"})
+
+	pageCacheMissCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "reflex",
+		Subsystem: "events_table",
+		Name:      "page_cache_misses_total",
+		Help:      "Total number of shared page cache misses per table",
+	}, []string{"table"})
 )
 
 func makeCursorSetCounter(table string) func() {
@@ -69,8 +139,18 @@ func init() {
 	prometheus.MustRegister(eventsPollCounter)
 	prometheus.MustRegister(rcacheHitsCounter)
 	prometheus.MustRegister(rcacheMissCounter)
+	prometheus.MustRegister(pageCacheHitsCounter)
+	prometheus.MustRegister(pageCacheMissCounter)
 	prometheus.MustRegister(eventsGapDetectCounter)
 	prometheus.MustRegister(eventsGapFilledCounter)
+	prometheus.MustRegister(eventsGapSkippedCounter)
 	prometheus.MustRegister(eventsGapListenGauge)
 	prometheus.MustRegister(eventsBlockingGapGauge)
+	prometheus.MustRegister(purgedCounter)
+	prometheus.MustRegister(purgeBlockedCounter)
+	prometheus.MustRegister(checksumMismatchCounter)
+	prometheus.MustRegister(eventsReplicaLagGauge)
+	prometheus.MustRegister(eventsReplicaFailoverCounter)
+	prometheus.MustRegister(eventsReconnectCounter)
+	prometheus.MustRegister(cursorHolderConflictCounter)
 }
@@ -0,0 +1,164 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+)
+
+// defaultNotificationsPollPeriod is the default period at which
+// subscriptions poll for notifications.
+const defaultNotificationsPollPeriod = 100 * time.Millisecond
+
+// NewNotificationsTable returns a new notifications table that provides a
+// PubSub for NewPubSubNotifier backed by the database, so streams of all
+// app instances wake on inserts of any instance without an additional
+// message broker. The table requires a varchar "channel" primary key and a
+// bigint "seq" column.
+//
+// Publishing increments the channel's sequence and subscriptions poll it.
+// Polling a single row by primary key is much cheaper than polling the
+// events table, so it can poll frequently, see
+// WithNotificationsPollPeriod. Message brokers like Redis pubsub or NATS
+// can be used instead by implementing PubSub.
+func NewNotificationsTable(name string, opts ...NotificationsOption) *NotificationsTable {
+	table := &NotificationsTable{
+		schema:     ntableSchema{name: name},
+		pollPeriod: defaultNotificationsPollPeriod,
+	}
+	for _, o := range opts {
+		o(table)
+	}
+	return table
+}
+
+// NotificationsOption defines a functional option to configure new
+// notifications tables.
+type NotificationsOption func(*NotificationsTable)
+
+// WithNotificationsDialect provides an option to set the SQL dialect of
+// the database. It defaults to DialectMySQL.
+func WithNotificationsDialect(d Dialect) NotificationsOption {
+	return func(table *NotificationsTable) {
+		table.schema.dialect = d
+	}
+}
+
+// WithNotificationsPollPeriod provides an option to set the period at
+// which subscriptions poll for notifications. It defaults to 100ms.
+func WithNotificationsPollPeriod(d time.Duration) NotificationsOption {
+	return func(table *NotificationsTable) {
+		table.pollPeriod = d
+	}
+}
+
+// NotificationsTable provides notifications stored in a sql db table,
+// see NewNotificationsTable.
+type NotificationsTable struct {
+	schema     ntableSchema
+	pollPeriod time.Duration
+}
+
+type ntableSchema struct {
+	name    string
+	dialect Dialect
+}
+
+// ToPubSub returns a PubSub of the channel, e.g. the events table name.
+func (t *NotificationsTable) ToPubSub(dbc *sql.DB, channel string) PubSub {
+	return &notificationsPubSub{
+		dbc:        dbc,
+		schema:     t.schema,
+		pollPeriod: t.pollPeriod,
+		channel:    channel,
+	}
+}
+
+type notificationsPubSub struct {
+	dbc        *sql.DB
+	schema     ntableSchema
+	pollPeriod time.Duration
+	channel    string
+}
+
+// Publish increments the sequence of the channel.
+func (p *notificationsPubSub) Publish(ctx context.Context) error {
+	s := p.schema
+
+	update := "seq=seq+1"
+	if s.dialect != DialectMySQL {
+		update = "seq=" + s.name + ".seq+1"
+	}
+
+	q := s.dialect.upsert(s.name, "channel", []string{"channel", "seq"},
+		[]string{"?", "1"}, []string{update})
+
+	_, err := p.dbc.ExecContext(ctx, q, p.channel)
+	if err != nil {
+		return errors.Wrap(err, "publish notification error", j.KS("channel", p.channel))
+	}
+
+	return nil
+}
+
+// Subscribe polls the sequence of the channel and sends a message
+// whenever it changes.
+func (p *notificationsPubSub) Subscribe(ctx context.Context) (<-chan struct{}, error) {
+	seq, err := p.getSeq(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+
+		t := time.NewTicker(p.pollPeriod)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			latest, err := p.getSeq(ctx)
+			if ctx.Err() != nil {
+				return
+			} else if err != nil {
+				log.Error(ctx, err)
+				return
+			} else if latest == seq {
+				continue
+			}
+			seq = latest
+
+			select {
+			case ch <- struct{}{}:
+			default:
+				// Message already pending.
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// getSeq returns the sequence of the channel or 0 if
+// nothing was published yet.
+func (p *notificationsPubSub) getSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	err := p.dbc.QueryRowContext(ctx, p.schema.dialect.rebind("select seq from "+
+		p.schema.name+" where channel=?"), p.channel).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrap(err, "get notification seq error", j.KS("channel", p.channel))
+	}
+	return seq, nil
+}
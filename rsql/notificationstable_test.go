@@ -0,0 +1,68 @@
+package rsql_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+const notificationsSchema = `
+create temporary table %s (
+  channel varchar(255) not null,
+  seq bigint not null,
+
+  primary key (channel)
+);
+`
+
+func TestNotificationsTable(t *testing.T) {
+	dbc := ConnectTestDB(t, eventsTable, "")
+	defer dbc.Close()
+
+	_, err := dbc.Exec(fmt.Sprintf(notificationsSchema, "notifications"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notifications := rsql.NewNotificationsTable("notifications",
+		rsql.WithNotificationsPollPeriod(time.Millisecond))
+
+	// Tables of two app instances sharing the notifications.
+	newTable := func() *rsql.EventsTable {
+		n := rsql.NewPubSubNotifier(ctx, notifications.ToPubSub(dbc, eventsTable))
+		return rsql.NewEventsTable(eventsTable, rsql.WithEventsNotifier(n),
+			rsql.WithEventsBackoff(time.Hour))
+	}
+	t1, t2 := newTable(), newTable()
+
+	sc := t2.Stream(ctx, dbc, "")
+	go func() {
+		// Insert after the second instance's stream waits.
+		time.Sleep(time.Millisecond * 100)
+		jtest.RequireNil(t, insertTestEvent(dbc, t1, i2s(1), testEventType(1)))
+	}()
+
+	t0 := time.Now()
+	e, err := sc.Recv()
+	jtest.RequireNil(t, err)
+	require.Equal(t, int64(1), e.ForeignIDInt())
+	require.True(t, time.Since(t0) < 5*time.Second, time.Since(t0))
+
+	// Publishing increments the channel sequence.
+	ps := notifications.ToPubSub(dbc, "other")
+	ch, err := ps.Subscribe(ctx)
+	jtest.RequireNil(t, err)
+	jtest.RequireNil(t, ps.Publish(ctx))
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		require.Fail(t, "notification timeout")
+	}
+}
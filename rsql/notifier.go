@@ -0,0 +1,107 @@
+package rsql
+
+import (
+	"context"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/log"
+)
+
+// defaultResubscribeBackoff is the backoff before retrying failed
+// pubsub subscriptions.
+const defaultResubscribeBackoff = time.Second
+
+// NewInMemNotifier returns an in-memory EventsNotifier that triggers the
+// stream clients waiting on it when Notify is called, see
+// WithEventsInMemNotifier. Custom wake-up sources can call Notify to
+// trigger the streams of tables configured with WithEventsNotifier.
+func NewInMemNotifier() EventsNotifier {
+	return &inmemNotifier{}
+}
+
+// PubSub is a "new events" message channel shared by multiple app
+// instances, e.g. a Redis pubsub channel.
+type PubSub interface {
+	// Publish publishes a "new events" message to all subscribers.
+	Publish(ctx context.Context) error
+
+	// Subscribe returns a channel that receives the published messages,
+	// including those published by this instance. The channel is closed
+	// when the subscription fails or the context is canceled.
+	Subscribe(ctx context.Context) (<-chan struct{}, error)
+}
+
+// NewPubSubNotifier returns an EventsNotifier that triggers the stream
+// clients of all app instances subscribed to the pubsub when events are
+// inserted by any instance, instead of only those of the inserting instance.
+// Inserts trigger local stream clients immediately and publish messages in
+// the background, coalescing concurrent inserts. Publish errors are logged
+// and failed subscriptions are retried. Stream clients still poll (see
+// WithEventsBackoff), so lost messages only delay streams. It publishes and
+// subscribes until the context is canceled.
+func NewPubSubNotifier(ctx context.Context, ps PubSub) EventsNotifier {
+	n := &pubsubNotifier{
+		inmemNotifier: &inmemNotifier{},
+		ps:            ps,
+		publish:       make(chan struct{}, 1),
+	}
+
+	go n.publishForever(ctx)
+	go n.subscribeForever(ctx)
+
+	return n
+}
+
+type pubsubNotifier struct {
+	*inmemNotifier
+	ps      PubSub
+	publish chan struct{}
+}
+
+func (n *pubsubNotifier) Notify() {
+	n.inmemNotifier.Notify()
+
+	select {
+	case n.publish <- struct{}{}:
+	default:
+		// Publish already pending.
+	}
+}
+
+func (n *pubsubNotifier) publishForever(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.publish:
+		}
+
+		if err := n.ps.Publish(ctx); err != nil && ctx.Err() == nil {
+			log.Error(ctx, errors.Wrap(err, "publish notification error"))
+		}
+	}
+}
+
+func (n *pubsubNotifier) subscribeForever(ctx context.Context) {
+	for {
+		ch, err := n.ps.Subscribe(ctx)
+		if err == nil {
+			for range ch {
+				n.inmemNotifier.Notify()
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		} else if err != nil {
+			log.Error(ctx, errors.Wrap(err, "subscribe notifications error"))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(defaultResubscribeBackoff):
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package rsql_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubSubNotifier(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ps := new(mockPubSub)
+	n1 := rsql.NewPubSubNotifier(ctx, ps)
+	n2 := rsql.NewPubSubNotifier(ctx, ps)
+
+	require.Eventually(t, func() bool {
+		return ps.Subscribers() == 2
+	}, time.Second, time.Millisecond)
+
+	c1, c2 := n1.C(), n2.C()
+	n1.Notify()
+
+	for _, c := range []<-chan struct{}{c1, c2} {
+		select {
+		case <-c:
+		case <-time.After(time.Second):
+			require.Fail(t, "notification timeout")
+		}
+	}
+}
+
+func TestNewInMemNotifier(t *testing.T) {
+	n := rsql.NewInMemNotifier()
+	c := n.C()
+
+	select {
+	case <-c:
+		require.Fail(t, "unexpected notification")
+	default:
+	}
+
+	n.Notify()
+	<-c
+}
+
+// mockPubSub is an in-memory PubSub.
+type mockPubSub struct {
+	mu   sync.Mutex
+	subs []chan struct{}
+}
+
+func (m *mockPubSub) Publish(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ch := range m.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (m *mockPubSub) Subscribe(context.Context) (<-chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	m.subs = append(m.subs, ch)
+	return ch, nil
+}
+
+func (m *mockPubSub) Subscribers() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.subs)
+}
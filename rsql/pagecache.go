@@ -0,0 +1,114 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/luno/reflex"
+)
+
+// NewPageCache returns a new in-memory cache of the event pages loaded by
+// streams, shared by the events tables configured with WithEventsPageCache.
+// Streams of co-located consumers loading the same page (the events after
+// the same cursor) within the ttl reuse the page instead of querying the DB,
+// and concurrent loads of the same page are coalesced into a single query.
+// Empty pages are not cached, so streams at the head still poll the DB.
+//
+// Pages are keyed by table name and cursor, so tables sharing a cache
+// should only have the same name if they are the same DB table with the
+// same schema options. Note that cached events are shared between
+// consumers, so they should not be modified.
+func NewPageCache(ttl time.Duration) *PageCache {
+	return &PageCache{
+		ttl:   ttl,
+		pages: make(map[pageKey]*page),
+	}
+}
+
+// PageCache provides an in-memory cache of event pages, see NewPageCache.
+type PageCache struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	pages map[pageKey]*page
+}
+
+type pageKey struct {
+	table string
+	prev  int64
+	lag   time.Duration
+}
+
+type page struct {
+	done   chan struct{} // Closed when loaded.
+	events []*reflex.Event
+	err    error
+	expiry time.Time
+}
+
+// wrap returns a loader that loads pages of the table via the cache.
+func (c *PageCache) wrap(loader loader, name string) loader {
+	return func(ctx context.Context, dbc *sql.DB, prev int64,
+		lag time.Duration) ([]*reflex.Event, error) {
+
+		key := pageKey{table: name, prev: prev, lag: lag}
+
+		c.mu.Lock()
+		c.expireUnsafe(time.Now())
+		p, ok := c.pages[key]
+		if !ok {
+			p = &page{done: make(chan struct{})}
+			c.pages[key] = p
+		}
+		c.mu.Unlock()
+
+		if !ok {
+			pageCacheMissCounter.WithLabelValues(name).Inc()
+			return c.load(ctx, dbc, loader, key, p)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-p.done:
+		}
+
+		if p.err != nil {
+			// The error may be specific to the loading stream, e.g. canceled.
+			return loader(ctx, dbc, prev, lag)
+		}
+
+		pageCacheHitsCounter.WithLabelValues(name).Inc()
+		return p.events, nil
+	}
+}
+
+// load loads the page and caches it if it isn't empty.
+func (c *PageCache) load(ctx context.Context, dbc *sql.DB, loader loader,
+	key pageKey, p *page) ([]*reflex.Event, error) {
+
+	p.events, p.err = loader(ctx, dbc, key.prev, key.lag)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p.expiry = time.Now().Add(c.ttl)
+	if p.err != nil || len(p.events) == 0 {
+		delete(c.pages, key)
+	}
+	close(p.done)
+
+	return p.events, p.err
+}
+
+// expireUnsafe deletes the expired pages.
+// Note it is unsafe, locks are managed outside.
+func (c *PageCache) expireUnsafe(now time.Time) {
+	for key, p := range c.pages {
+		if !p.expiry.IsZero() && now.After(p.expiry) {
+			delete(c.pages, key)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/reflex"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageCache(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	loader := func(ctx context.Context, dbc *sql.DB, prev int64,
+		lag time.Duration) ([]*reflex.Event, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		var el []*reflex.Event
+		for i := prev + 1; i <= prev+3; i++ {
+			el = append(el, &reflex.Event{ID: strconv.FormatInt(i, 10)})
+		}
+		return el, nil
+	}
+
+	cache := NewPageCache(time.Minute)
+	for i := 0; i < 3; i++ {
+		table := NewEventsTable("events", WithEventsLoader(loader),
+			WithoutEventsCache(), WithEventsPageCache(cache))
+
+		sc, err := table.ToStream(nil)(context.Background(), "")
+		require.NoError(t, err)
+
+		for j := 1; j <= 3; j++ {
+			e, err := sc.Recv()
+			require.NoError(t, err)
+			require.Equal(t, int64(j), e.IDInt())
+		}
+	}
+	require.Equal(t, 1, calls)
+
+	// Different tables don't share pages.
+	table := NewEventsTable("other", WithEventsLoader(loader),
+		WithoutEventsCache(), WithEventsPageCache(cache))
+	sc, err := table.ToStream(nil)(context.Background(), "")
+	require.NoError(t, err)
+	_, err = sc.Recv()
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+
+	// Pages expire after the ttl.
+	cache.mu.Lock()
+	cache.expireUnsafe(time.Now().Add(2 * time.Minute))
+	require.Empty(t, cache.pages)
+	cache.mu.Unlock()
+}
+
+func TestPageCacheEmpty(t *testing.T) {
+	var calls int
+	loader := func(ctx context.Context, dbc *sql.DB, prev int64,
+		lag time.Duration) ([]*reflex.Event, error) {
+		calls++
+		return nil, nil
+	}
+
+	load := NewPageCache(time.Minute).wrap(loader, "events")
+	for i := 1; i <= 3; i++ {
+		el, err := load(context.Background(), nil, 0, 0)
+		require.NoError(t, err)
+		require.Empty(t, el)
+		require.Equal(t, i, calls)
+	}
+}
+
+func TestPageCacheCoalesce(t *testing.T) {
+	var calls int
+	release := make(chan struct{})
+	loader := func(ctx context.Context, dbc *sql.DB, prev int64,
+		lag time.Duration) ([]*reflex.Event, error) {
+		calls++
+		<-release
+		return []*reflex.Event{{ID: strconv.FormatInt(prev+1, 10)}}, nil
+	}
+
+	cache := NewPageCache(time.Minute)
+	load := cache.wrap(loader, "events")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			el, err := load(context.Background(), nil, 0, 0)
+			require.NoError(t, err)
+			require.Len(t, el, 1)
+		}()
+	}
+
+	// Wait for the first load to start.
+	require.Eventually(t, func() bool {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return len(cache.pages) == 1
+	}, time.Second, time.Millisecond)
+
+	close(release)
+	wg.Wait()
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,82 @@
+package rsql
+
+import (
+	"sync"
+
+	"github.com/luno/reflex"
+)
+
+const defaultFetchLimit = 1000
+
+// fetchConfig defines the page size config of the base loader.
+type fetchConfig struct {
+	limit    int
+	adaptive bool
+	min      int
+	max      int
+	maxBytes int
+}
+
+// pager provides the page size (query limit) of the base loader. If adaptive,
+// the page size doubles (up to max) while full pages are returned, ie. while
+// catching up, and halves (down to min) when a page exceeds maxBytes.
+type pager struct {
+	mu  sync.Mutex
+	cfg fetchConfig
+	cur int
+}
+
+func newPager(cfg fetchConfig) *pager {
+	if cfg.limit <= 0 {
+		cfg.limit = defaultFetchLimit
+	}
+	if cfg.min <= 0 {
+		cfg.min = 1
+	}
+	if cfg.max < cfg.min {
+		cfg.max = cfg.min
+	}
+
+	cur := cfg.limit
+	if cfg.adaptive {
+		cur = cfg.min
+	}
+
+	return &pager{cfg: cfg, cur: cur}
+}
+
+// Limit returns the current page size.
+func (p *pager) Limit() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.cur
+}
+
+// Update adapts the page size given the events returned by a query
+// with the provided limit.
+func (p *pager) Update(el []*reflex.Event, limit int) {
+	if !p.cfg.adaptive {
+		return
+	}
+
+	var bytes int
+	for _, e := range el {
+		bytes += len(e.ID) + len(e.ForeignID) + len(e.MetaData)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cfg.maxBytes > 0 && bytes > p.cfg.maxBytes {
+		p.cur /= 2
+		if p.cur < p.cfg.min {
+			p.cur = p.cfg.min
+		}
+	} else if len(el) >= limit {
+		p.cur *= 2
+		if p.cur > p.cfg.max {
+			p.cur = p.cfg.max
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package rsql
+
+import (
+	"testing"
+
+	"github.com/luno/reflex"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPagerFixed(t *testing.T) {
+	p := newPager(fetchConfig{})
+	require.Equal(t, defaultFetchLimit, p.Limit())
+
+	p = newPager(fetchConfig{limit: 10})
+	p.Update(makePage(10, 0), 10)
+	require.Equal(t, 10, p.Limit())
+}
+
+func TestPagerAdaptive(t *testing.T) {
+	p := newPager(fetchConfig{adaptive: true, min: 10, max: 50, maxBytes: 1000})
+	require.Equal(t, 10, p.Limit())
+
+	// Full pages grow up to max.
+	for _, expect := range []int{20, 40, 50, 50} {
+		p.Update(makePage(p.Limit(), 0), p.Limit())
+		require.Equal(t, expect, p.Limit())
+	}
+
+	// Partial pages don't change size.
+	p.Update(makePage(1, 0), p.Limit())
+	require.Equal(t, 50, p.Limit())
+
+	// Wide pages shrink down to min.
+	for _, expect := range []int{25, 12, 10, 10} {
+		p.Update(makePage(p.Limit(), 200), p.Limit())
+		require.Equal(t, expect, p.Limit())
+	}
+}
+
+func makePage(n, width int) []*reflex.Event {
+	var res []*reflex.Event
+	for i := 0; i < n; i++ {
+		res = append(res, &reflex.Event{MetaData: make([]byte, width)})
+	}
+	return res
+}
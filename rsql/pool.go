@@ -0,0 +1,24 @@
+package rsql
+
+import (
+	"github.com/luno/reflex"
+)
+
+// newEvent returns a released event from the pool if
+// pooled (see WithEventsPool) or a new event.
+func (s etableSchema) newEvent() *reflex.Event {
+	if s.pool == nil {
+		return new(reflex.Event)
+	}
+	return s.pool.Get().(*reflex.Event)
+}
+
+// Release implements reflex.EventReleaser and returns the event
+// to the pool if pooled, see WithEventsPool.
+func (s *streamclient) Release(e *reflex.Event) {
+	if s.schema.pool == nil || e == nil {
+		return
+	}
+	*e = reflex.Event{}
+	s.schema.pool.Put(e)
+}
@@ -0,0 +1,90 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luno/reflex"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRow scans the values into pointer destinations.
+type fakeRow []interface{}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	for i, v := range r {
+		switch d := dest[i].(type) {
+		case *int64:
+			*d = v.(int64)
+		case *string:
+			*d = v.(string)
+		case *time.Time:
+			*d = v.(time.Time)
+		case *eventType:
+			*d = eventType(v.(int))
+		case *[]byte:
+			*d = v.([]byte)
+		case *sql.NullString:
+			*d = v.(sql.NullString)
+		}
+	}
+	return nil
+}
+
+func TestEventsPool(t *testing.T) {
+	table := NewEventsTable("events", WithEventsPool(),
+		WithEventForeignKeyFields("account_id"))
+	s := newEventScanner(table.schema)
+	sc := table.Stream(context.Background(), nil, "").(*streamclient)
+
+	ts := time.Now()
+	e, err := scan(fakeRow{int64(1), "f1", ts, 2, []byte("m1"),
+		sql.NullString{String: "a1", Valid: true}}, s)
+	require.NoError(t, err)
+	require.Equal(t, &reflex.Event{
+		ID:          "1",
+		ForeignID:   "f1",
+		Timestamp:   ts,
+		Type:        eventType(2),
+		MetaData:    []byte("m1"),
+		ForeignKeys: map[string]string{"account_id": "a1"},
+	}, e)
+
+	// Released events are reset.
+	sc.Release(e)
+	require.Equal(t, &reflex.Event{}, e)
+
+	e, err = scan(fakeRow{int64(2), "f2", ts, 3, []byte(nil),
+		sql.NullString{}}, s)
+	require.NoError(t, err)
+	require.Equal(t, &reflex.Event{
+		ID:        "2",
+		ForeignID: "f2",
+		Timestamp: ts,
+		Type:      eventType(3),
+	}, e)
+}
+
+func TestEventsPoolNoCache(t *testing.T) {
+	var calls int
+	loader := func(ctx context.Context, dbc *sql.DB, prev int64,
+		lag time.Duration) ([]*reflex.Event, error) {
+		calls++
+		return []*reflex.Event{{ID: strconv.FormatInt(prev+1, 10)}}, nil
+	}
+
+	table := NewEventsTable("events", WithEventsLoader(loader), WithEventsPool(),
+		WithEventsPageCache(NewPageCache(time.Minute)))
+
+	for i := 1; i <= 2; i++ {
+		sc, err := table.ToStream(nil)(context.Background(), "")
+		require.NoError(t, err)
+
+		_, err = sc.Recv()
+		require.NoError(t, err)
+		require.Equal(t, i, calls)
+	}
+}
@@ -0,0 +1,119 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+)
+
+// defaultPurgePeriod is the default period at which events are purged,
+// see Purger.PurgeForever.
+const defaultPurgePeriod = time.Minute
+
+// NewPurger returns a purger that deletes the events of the table that are
+// older than the retention period. It never deletes events after the minimum
+// cursor of the consumers in the cursors tables, so consumers that are behind
+// block purging instead of missing events. Note that consumers without cursors
+// in the tables are not protected and that cursors of other streams in the
+// tables also block purging.
+func NewPurger(table *EventsTable, retention time.Duration,
+	cursorsTables ...CursorsTable) *Purger {
+
+	return &Purger{
+		table:         table,
+		retention:     retention,
+		cursorsTables: cursorsTables,
+	}
+}
+
+// Purger deletes old events from an events table, see NewPurger.
+type Purger struct {
+	table         *EventsTable
+	retention     time.Duration
+	cursorsTables []CursorsTable
+}
+
+// PurgeOnce deletes the events older than the retention period up to the
+// minimum consumer cursor and returns the number of deleted events.
+func (p *Purger) PurgeOnce(ctx context.Context, dbc *sql.DB) (int64, error) {
+	schema := p.table.schema
+
+	aged, err := getCursorAtTime(ctx, dbc, schema, time.Now().Add(-p.retention))
+	if err != nil {
+		return 0, err
+	}
+
+	to := aged
+	for _, ct := range p.cursorsTables {
+		cursors, err := ct.ListCursors(ctx, dbc)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, c := range cursors {
+			cursor, err := strconv.ParseInt(c.Cursor, 10, 64)
+			if err != nil {
+				return 0, errors.Wrap(ErrInvalidIntID, "",
+					j.MKS{"consumer": c.ConsumerID, "cursor": c.Cursor})
+			}
+			if cursor < to {
+				to = cursor
+			}
+		}
+	}
+
+	if to < aged {
+		purgeBlockedCounter.WithLabelValues(schema.name).Inc()
+	}
+
+	var first sql.NullInt64
+	err = dbc.QueryRowContext(ctx, "select min(id) from "+schema.name).Scan(&first)
+	if err != nil {
+		return 0, err
+	}
+
+	// Delete in batches by id range.
+	var total int64
+	for from := first.Int64; first.Valid && from <= to; from += defaultFetchLimit {
+		res, err := dbc.ExecContext(ctx, schema.dialect.rebind("delete from "+
+			schema.name+" where id>=? and id<? and id<=?"), from, from+defaultFetchLimit, to)
+		if err != nil {
+			return total, errors.Wrap(err, "purge events error", j.KV("from", from))
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+		purgedCounter.WithLabelValues(schema.name).Add(float64(n))
+	}
+
+	return total, nil
+}
+
+// PurgeForever purges events every minute until the context is canceled,
+// see PurgeOnce. Errors are logged and retried. It always returns a non-nil error.
+func (p *Purger) PurgeForever(ctx context.Context, dbc *sql.DB) error {
+	for {
+		_, err := p.PurgeOnce(ctx, dbc)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			log.Error(ctx, errors.Wrap(err, "purge events error",
+				j.KS("table", p.table.schema.name)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(defaultPurgePeriod):
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package rsql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurger(t *testing.T) {
+	dbc := ConnectTestDB(t, eventsTable, cursorsTable)
+	defer dbc.Close()
+
+	ctx := context.Background()
+	table := rsql.NewEventsTable(eventsTable)
+	ctable := rsql.NewCursorsTable(cursorsTable, rsql.WithCursorAsyncDisabled())
+
+	for i := 1; i <= 10; i++ {
+		err := insertTestEvent(dbc, table, i2s(i), testEventType(i))
+		jtest.RequireNil(t, err)
+	}
+	_, err := dbc.Exec("update "+eventsTable+" set timestamp=? where id<=6",
+		time.Now().Add(-2*time.Hour))
+	jtest.RequireNil(t, err)
+
+	jtest.RequireNil(t, ctable.SetCursor(ctx, dbc, "c1", "3"))
+	jtest.RequireNil(t, ctable.SetCursor(ctx, dbc, "c2", "8"))
+
+	p := rsql.NewPurger(table, time.Hour, ctable)
+
+	// Purging is blocked by c1.
+	n, err := p.PurgeOnce(ctx, dbc)
+	jtest.RequireNil(t, err)
+	require.Equal(t, int64(3), n)
+
+	// Purging is limited by the retention.
+	jtest.RequireNil(t, ctable.SetCursor(ctx, dbc, "c1", "9"))
+	n, err = p.PurgeOnce(ctx, dbc)
+	jtest.RequireNil(t, err)
+	require.Equal(t, int64(3), n)
+
+	n, err = p.PurgeOnce(ctx, dbc)
+	jtest.RequireNil(t, err)
+	require.Equal(t, int64(0), n)
+
+	sc := table.Stream(ctx, dbc, "", reflex.WithStreamToHead())
+	for i := 7; i <= 10; i++ {
+		e, err := sc.Recv()
+		jtest.RequireNil(t, err)
+		require.Equal(t, int64(i), e.IDInt())
+	}
+}
@@ -0,0 +1,356 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+	"github.com/luno/reflex"
+)
+
+const (
+	defaultReadModelBatchSize   = 100
+	defaultReadModelFlushPeriod = time.Second
+
+	readModelCursorPrefix = "cursor:"
+)
+
+// ApplyFunc returns the next state of the read model of the event's foreign
+// ID by applying the event to the current state. The state is nil if the
+// foreign ID doesn't have a state yet. A nil next state deletes the state.
+type ApplyFunc func(state []byte, e *reflex.Event) ([]byte, error)
+
+// SnapshotFunc is called in the transaction that commits the cursor, so
+// snapshots are consistent with the read model at the cursor.
+type SnapshotFunc func(ctx context.Context, tx *sql.Tx, cursor string) error
+
+// ReadModelOption defines a functional option to configure read models.
+type ReadModelOption func(*ReadModel)
+
+// WithReadModelBatchSize provides an option to set the number of events
+// after which the batched states and cursor are committed. It defaults to 100.
+func WithReadModelBatchSize(n int) ReadModelOption {
+	return func(m *ReadModel) {
+		m.batchSize = n
+	}
+}
+
+// WithReadModelFlushPeriod provides an option to set the period of
+// background commits of batched states and cursor. Zero disables background
+// commits, in which case batches are only committed when full or when
+// reflex.Run returns. It defaults to 1s.
+func WithReadModelFlushPeriod(d time.Duration) ReadModelOption {
+	return func(m *ReadModel) {
+		m.period = d
+	}
+}
+
+// WithReadModelSnapshots provides an option to call fn in the first commit
+// transaction after every n events, e.g. to copy the read model to a
+// snapshots table used for auditing or bootstrapping new read models.
+func WithReadModelSnapshots(n int, fn SnapshotFunc) ReadModelOption {
+	return func(m *ReadModel) {
+		m.snapshotEvery = n
+		m.snapshot = fn
+	}
+}
+
+// WithReadModelConsumerOpts provides an option to set the reflex consumer options.
+func WithReadModelConsumerOpts(opts ...reflex.ConsumerOption) ReadModelOption {
+	return func(m *ReadModel) {
+		m.opts = append(m.opts, opts...)
+	}
+}
+
+// NewReadModel returns a new read model that materializes the states of
+// foreign IDs in the states table by applying events with the apply function.
+// Use Spec to run it.
+//
+// The states and the cursor are committed in batches in a single transaction,
+// so the read model is always consistent with the cursor and events are
+// applied exactly once. The cursor is stored in the states table with the
+// key "cursor:<name>".
+func NewReadModel(name string, dbc *sql.DB, table *StatesTable, apply ApplyFunc,
+	opts ...ReadModelOption) *ReadModel {
+
+	m := &ReadModel{
+		name:      name,
+		dbc:       dbc,
+		schema:    table.schema,
+		apply:     apply,
+		batchSize: defaultReadModelBatchSize,
+		period:    defaultReadModelFlushPeriod,
+		dirty:     make(map[string]*modelState),
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+// ReadModel is a materialized read model of an event stream.
+type ReadModel struct {
+	name          string
+	dbc           *sql.DB
+	schema        stableSchema
+	apply         ApplyFunc
+	batchSize     int
+	period        time.Duration
+	snapshotEvery int
+	snapshot      SnapshotFunc
+	opts          []reflex.ConsumerOption
+
+	mu        sync.Mutex
+	flushing  bool // Whether the background commits of the run started.
+	dirty     map[string]*modelState
+	cursor    modelState
+	pending   int // Events since the last commit.
+	snapshots int // Events since the last snapshot.
+
+	// staged is the state of the consumed event that is only added to the
+	// dirty states by SetCursor, so commits never include states of events
+	// after the cursor.
+	staged *stagedState
+}
+
+type modelState struct {
+	state   []byte
+	version int64
+}
+
+type stagedState struct {
+	foreignID string
+	modelState
+}
+
+// Load returns the committed state of the foreign ID or nil if it doesn't exist.
+func (m *ReadModel) Load(ctx context.Context, foreignID string) ([]byte, error) {
+	state, _, err := loadState(ctx, m.dbc, m.schema, foreignID)
+	return state, err
+}
+
+// Spec returns a reflex spec of the read model. Note that the read model is
+// also the cursor store of the spec.
+func (m *ReadModel) Spec(stream reflex.StreamFunc, opts ...reflex.StreamOption) reflex.Spec {
+	c := &readModelConsumer{
+		Consumer: reflex.NewConsumer(m.name, m.consume, m.opts...),
+		m:        m,
+	}
+	return reflex.NewSpec(stream, m, c, opts...)
+}
+
+// readModelConsumer resets the read model at the start of each run.
+type readModelConsumer struct {
+	reflex.Consumer
+	m *ReadModel
+}
+
+func (c *readModelConsumer) Reset() error {
+	return c.m.reset(context.Background())
+}
+
+// reset discards uncommitted states and reloads the committed cursor since
+// reflex.Run streams from the committed cursor on each run.
+func (m *ReadModel) reset(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, version, err := loadState(ctx, m.dbc, m.schema, readModelCursorPrefix+m.name)
+	if err != nil {
+		return err
+	}
+
+	m.dirty = make(map[string]*modelState)
+	m.staged = nil
+	m.cursor = modelState{state: state, version: version}
+	m.pending = 0
+	m.flushing = false
+	return nil
+}
+
+func (m *ReadModel) consume(ctx context.Context, _ fate.Fate, e *reflex.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Discard the state of any previous event without cursor.
+	m.staged = nil
+
+	s, ok := m.dirty[e.ForeignID]
+	if !ok {
+		state, version, err := loadState(ctx, m.dbc, m.schema, e.ForeignID)
+		if err != nil {
+			return err
+		}
+		s = &modelState{state: state, version: version}
+	}
+
+	next, err := m.apply(s.state, e)
+	if err != nil {
+		return errors.Wrap(err, "apply event error", j.KS("foreign_id", e.ForeignID))
+	}
+
+	m.staged = &stagedState{
+		foreignID:  e.ForeignID,
+		modelState: modelState{state: next, version: s.version},
+	}
+	return nil
+}
+
+// GetCursor implements reflex.CursorStore and returns the committed cursor.
+func (m *ReadModel) GetCursor(ctx context.Context, _ string) (string, error) {
+	state, _, err := loadState(ctx, m.dbc, m.schema, readModelCursorPrefix+m.name)
+	if err != nil {
+		return "", err
+	}
+	return string(state), nil
+}
+
+// SetCursor implements reflex.CursorStore and batches the cursor with
+// the state of the consumed event. It commits the batch if it is full.
+// Batches are also committed periodically until ctx is canceled, see
+// WithReadModelFlushPeriod.
+func (m *ReadModel) SetCursor(ctx context.Context, _ string, cursor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.period > 0 && !m.flushing {
+		m.flushing = true
+		go m.flushForever(ctx)
+	}
+
+	if m.staged != nil {
+		m.dirty[m.staged.foreignID] = &m.staged.modelState
+		m.staged = nil
+	}
+
+	m.cursor.state = []byte(cursor)
+	m.pending++
+	m.snapshots++
+	if m.pending < m.batchSize {
+		return nil
+	}
+
+	return m.commit(ctx)
+}
+
+// Flush implements reflex.CursorStore and commits the batched states and cursor.
+func (m *ReadModel) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.commit(ctx)
+}
+
+// commit stores the batched states and cursor in a single transaction.
+// It must be called with the mutex held.
+func (m *ReadModel) commit(ctx context.Context) error {
+	if m.pending == 0 {
+		return nil
+	}
+
+	tx, err := m.dbc.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for foreignID, s := range m.dirty {
+		if s.state == nil {
+			err = deleteState(ctx, tx, m.schema, foreignID, s.version)
+		} else {
+			err = storeState(ctx, tx, m.schema, foreignID, s.state, s.version)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	cursor := string(m.cursor.state)
+	err = storeState(ctx, tx, m.schema, readModelCursorPrefix+m.name,
+		m.cursor.state, m.cursor.version)
+	if err != nil {
+		return err
+	}
+
+	snapshot := m.snapshot != nil && m.snapshots >= m.snapshotEvery
+	if snapshot {
+		if err := m.snapshot(ctx, tx, cursor); err != nil {
+			return errors.Wrap(err, "snapshot error", j.KS("cursor", cursor))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// The staged state was applied to a committed dirty state.
+	if m.staged != nil {
+		if d, ok := m.dirty[m.staged.foreignID]; ok {
+			m.staged.version = 0
+			if d.state != nil {
+				m.staged.version = d.version + 1
+			}
+		}
+	}
+
+	m.dirty = make(map[string]*modelState)
+	m.cursor.version++
+	m.pending = 0
+	if snapshot {
+		m.snapshots = 0
+	}
+
+	return nil
+}
+
+// ConsumeForTesting applies the event to the read model without setting
+// the cursor, i.e. as if consumed by reflex.Run.
+func (m *ReadModel) ConsumeForTesting(t *testing.T, ctx context.Context, e *reflex.Event) error {
+	return m.consume(ctx, nil, e)
+}
+
+// flushForever commits the batched states and cursor every period
+// until the context is canceled.
+func (m *ReadModel) flushForever(ctx context.Context) {
+	t := time.NewTicker(m.period)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := m.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Error(ctx, errors.Wrap(err, "reflex: error flushing read model"))
+		}
+	}
+}
+
+func deleteState(ctx context.Context, dbc dbtx, s stableSchema, key string, version int64) error {
+	if version == 0 {
+		return nil
+	}
+
+	res, err := dbc.ExecContext(ctx, s.dialect.rebind("delete from "+s.name+" where "+
+		s.idField+"=? and "+s.versionField+"=?"), key, version)
+	if err != nil {
+		return errors.Wrap(err, "delete state error", j.KS("key", key))
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return errors.Wrap(reflex.ErrStateConflict, "", j.KS("key", key))
+	}
+
+	return nil
+}
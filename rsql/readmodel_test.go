@@ -0,0 +1,123 @@
+package rsql_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadModel(t *testing.T) {
+	dbc := ConnectTestDB(t, eventsTable, "")
+	defer dbc.Close()
+
+	_, err := dbc.Exec(fmt.Sprintf(statesSchema, "read_model"))
+	require.NoError(t, err)
+
+	events := rsql.NewEventsTable(eventsTable)
+	for _, foreignID := range []string{"u1", "u2", "u1", "u3", "u1"} {
+		require.NoError(t, insertTestEvent(dbc, events, foreignID, testEventType(1)))
+	}
+	// Deletes u3.
+	require.NoError(t, insertTestEvent(dbc, events, "u3", testEventType(2)))
+
+	// Counts the events per foreign ID.
+	apply := func(state []byte, e *reflex.Event) ([]byte, error) {
+		if reflex.IsType(e.Type, testEventType(2)) {
+			return nil, nil
+		}
+		n, _ := strconv.Atoi(string(state))
+		return []byte(strconv.Itoa(n + 1)), nil
+	}
+
+	var snapshots []string
+	snapshot := func(ctx context.Context, tx *sql.Tx, cursor string) error {
+		snapshots = append(snapshots, cursor)
+		return nil
+	}
+
+	ctx := context.Background()
+	m := rsql.NewReadModel("counts", dbc, rsql.NewStatesTable("read_model"), apply,
+		rsql.WithReadModelBatchSize(2),
+		rsql.WithReadModelFlushPeriod(0),
+		rsql.WithReadModelSnapshots(4, snapshot))
+
+	err = reflex.Run(ctx, m.Spec(events.ToStream(dbc), reflex.WithStreamToHead()))
+	jtest.Require(t, reflex.ErrHeadReached, err)
+
+	for foreignID, count := range map[string]string{"u1": "3", "u2": "1"} {
+		state, err := m.Load(ctx, foreignID)
+		jtest.RequireNil(t, err)
+		require.Equal(t, count, string(state))
+	}
+
+	state, err := m.Load(ctx, "u3")
+	jtest.RequireNil(t, err)
+	require.Nil(t, state)
+
+	cursor, err := m.GetCursor(ctx, "counts")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "6", cursor)
+	require.Equal(t, []string{"4"}, snapshots)
+
+	// Continue from the cursor.
+	require.NoError(t, insertTestEvent(dbc, events, "u2", testEventType(1)))
+	err = reflex.Run(ctx, m.Spec(events.ToStream(dbc), reflex.WithStreamToHead()))
+	jtest.Require(t, reflex.ErrHeadReached, err)
+
+	state, err = m.Load(ctx, "u2")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "2", string(state))
+}
+
+func TestReadModelFlushBeforeCursor(t *testing.T) {
+	dbc := ConnectTestDB(t, "", "")
+	defer dbc.Close()
+
+	_, err := dbc.Exec(fmt.Sprintf(statesSchema, "read_model_flush"))
+	require.NoError(t, err)
+
+	apply := func(state []byte, e *reflex.Event) ([]byte, error) {
+		return []byte(e.ID), nil
+	}
+
+	ctx := context.Background()
+	m := rsql.NewReadModel("flush", dbc, rsql.NewStatesTable("read_model_flush"), apply,
+		rsql.WithReadModelFlushPeriod(0))
+
+	_, err = m.GetCursor(ctx, "flush")
+	jtest.RequireNil(t, err)
+
+	requireState := func(state, cursor string) {
+		s, err := m.Load(ctx, "u1")
+		jtest.RequireNil(t, err)
+		require.Equal(t, state, string(s))
+
+		c, _, err := rsql.NewStatesTable("read_model_flush").Load(ctx, dbc, "cursor:flush")
+		jtest.RequireNil(t, err)
+		require.Equal(t, cursor, string(c))
+	}
+
+	jtest.RequireNil(t, m.ConsumeForTesting(t, ctx, &reflex.Event{ID: "1", ForeignID: "u1"}))
+	jtest.RequireNil(t, m.SetCursor(ctx, "flush", "1"))
+
+	// Getting the cursor doesn't discard the batch, e.g. drift checks.
+	cursor, err := m.GetCursor(ctx, "flush")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "", cursor)
+
+	// Flushing before the cursor is set only commits states up to the cursor.
+	jtest.RequireNil(t, m.ConsumeForTesting(t, ctx, &reflex.Event{ID: "2", ForeignID: "u1"}))
+	jtest.RequireNil(t, m.Flush(ctx))
+	requireState("1", "1")
+
+	jtest.RequireNil(t, m.SetCursor(ctx, "flush", "2"))
+	jtest.RequireNil(t, m.Flush(ctx))
+	requireState("2", "2")
+}
@@ -0,0 +1,122 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+)
+
+// replicaCheckPeriod is the period after which the lag of replicas is checked again.
+const replicaCheckPeriod = time.Second
+
+// WithEventsReplicas provides an option to stream events from the read
+// replicas instead of the primary DB provided to Stream or ToStream. The
+// replica lag is detected by comparing the timestamp of the latest event in
+// each replica with the primary every second. Streams fail over to the primary
+// if all replicas lag by more than maxLag or fail, e.g. due to access denied
+// errors, until the next check. Heads (e.g. for reflex.WithStreamToHead) are
+// always queried from the primary.
+func WithEventsReplicas(maxLag time.Duration, replicas ...*sql.DB) EventsOption {
+	return func(table *EventsTable) {
+		table.replicas = &replicaSet{
+			dbs:     replicas,
+			maxLag:  maxLag,
+			healthy: make(map[*sql.DB]bool),
+		}
+	}
+}
+
+// replicaSet selects the read replica to stream from.
+type replicaSet struct {
+	dbs    []*sql.DB
+	maxLag time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	healthy map[*sql.DB]bool
+}
+
+// pick returns the first healthy replica or the primary if none are healthy.
+func (r *replicaSet) pick(ctx context.Context, primary *sql.DB, schema etableSchema) *sql.DB {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= replicaCheckPeriod {
+		r.checkUnsafe(ctx, primary, schema)
+	}
+
+	for _, dbc := range r.dbs {
+		if r.healthy[dbc] {
+			return dbc
+		}
+	}
+
+	eventsReplicaFailoverCounter.WithLabelValues(schema.name).Inc()
+	return primary
+}
+
+// fail marks the replica unhealthy until the next check. The caller
+// should retry on the primary.
+func (r *replicaSet) fail(ctx context.Context, replica *sql.DB, schema etableSchema, err error) {
+	log.Error(ctx, errors.Wrap(err, "replica error, failing over",
+		j.KS("table", schema.name)))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.healthy[replica] = false
+	eventsReplicaFailoverCounter.WithLabelValues(schema.name).Inc()
+}
+
+// checkUnsafe updates the health of the replicas by comparing the latest event
+// timestamps with the primary's. It must be called with the mutex held.
+func (r *replicaSet) checkUnsafe(ctx context.Context, primary *sql.DB, schema etableSchema) {
+	r.checked = time.Now()
+
+	head, err := getLatestTime(ctx, primary, schema)
+	if err != nil {
+		// Can't determine lag, so don't use replicas.
+		log.Error(ctx, errors.Wrap(err, "primary latest event error",
+			j.KS("table", schema.name)))
+		r.healthy = make(map[*sql.DB]bool)
+		return
+	}
+
+	var maxLag time.Duration
+	for _, dbc := range r.dbs {
+		ts, err := getLatestTime(ctx, dbc, schema)
+		if err != nil {
+			log.Error(ctx, errors.Wrap(err, "replica latest event error",
+				j.KS("table", schema.name)))
+			r.healthy[dbc] = false
+			continue
+		}
+
+		lag := head.Sub(ts)
+		if lag > maxLag {
+			maxLag = lag
+		}
+		r.healthy[dbc] = lag <= r.maxLag
+	}
+
+	eventsReplicaLagGauge.WithLabelValues(schema.name).Set(maxLag.Seconds())
+}
+
+// getLatestTime returns the timestamp of the latest event or the zero time
+// if the table is empty.
+func getLatestTime(ctx context.Context, dbc *sql.DB, schema etableSchema) (time.Time, error) {
+	var ts time.Time
+	err := dbc.QueryRowContext(ctx, "select "+schema.timeField+" from "+
+		schema.name+" order by id desc limit 1").Scan(&ts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return ts, nil
+}
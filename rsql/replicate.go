@@ -0,0 +1,159 @@
+package rsql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+// NewReplicator returns a replicator that replicates the events of the source
+// stream (e.g. an EventsTable in another region or a gRPC stream) into the
+// destination events table preserving the event IDs and timestamps.
+func NewReplicator(src reflex.StreamFunc, dst *EventsTable) *Replicator {
+	return &Replicator{src: src, dst: dst}
+}
+
+// Replicator replicates events into a replica events table, see NewReplicator.
+type Replicator struct {
+	src reflex.StreamFunc
+	dst *EventsTable
+}
+
+// Run verifies the latest event of the destination table and then streams the
+// source events after it and inserts them with the source IDs until the context
+// is canceled or an error occurs. Skipped source IDs (noops are not streamed)
+// are inserted as noops, so the replica has consecutive IDs and can be streamed
+// like the source. It returns ErrReplicaConflict if an event with the same ID
+// but different content exists in the replica, e.g. if events were inserted
+// into the replica directly. Only a single replicator should run per replica.
+func (r *Replicator) Run(ctx context.Context, dbc *sql.DB) error {
+	schema := r.dst.schema
+
+	prev, err := getLatestID(ctx, dbc, schema)
+	if err != nil {
+		return err
+	}
+
+	// Stream from before the latest event to verify it.
+	verify := prev > 0
+	sc, err := r.src(ctx, strconv.FormatInt(prev-1, 10))
+	if err != nil {
+		return err
+	}
+
+	for {
+		e, err := sc.Recv()
+		if err != nil {
+			return err
+		} else if !e.IsIDInt() {
+			return ErrInvalidIntID
+		}
+
+		next := e.IDInt()
+		if verify {
+			verify = false
+			if next == prev {
+				if err := checkReplicated(ctx, dbc, schema, []*reflex.Event{e}); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// The latest replicated event must be a noop.
+			err := checkReplicated(ctx, dbc, schema, []*reflex.Event{makeNoop(prev, e)})
+			if err != nil {
+				return err
+			}
+		}
+
+		if next <= prev {
+			return errors.Wrap(ErrConsecEvent, "replicate error",
+				j.MKV{"prev": prev, "next": next})
+		}
+
+		events := []*reflex.Event{e}
+		if prev != 0 {
+			events = nil
+			for i := prev + 1; i < next; i++ {
+				events = append(events, makeNoop(i, e))
+			}
+			events = append(events, e)
+		}
+
+		err = ExecTx(ctx, dbc, schema.dialect, func(tx *sql.Tx) error {
+			return insertEventsWithIDs(ctx, tx, schema, events)
+		})
+		if schema.dialect.isErrDupEntry(err) {
+			err = checkReplicated(ctx, dbc, schema, events)
+		}
+		if err != nil {
+			return err
+		}
+
+		r.dst.notifier.Notify()
+		prev = next
+	}
+}
+
+// makeNoop returns a noop event with the id and
+// the timestamp of the next event.
+func makeNoop(id int64, next *reflex.Event) *reflex.Event {
+	return &reflex.Event{
+		ID:        strconv.FormatInt(id, 10),
+		ForeignID: "0",
+		Type:      eventType(0),
+		Timestamp: next.Timestamp,
+	}
+}
+
+// checkReplicated returns nil if the events exist in the replica or
+// ErrReplicaConflict if any existing event differs.
+func checkReplicated(ctx context.Context, dbc *sql.DB, schema etableSchema,
+	events []*reflex.Event) error {
+
+	first := events[0].IDInt()
+	el, err := getNextEvents(ctx, dbc, schema, first-1, 0, len(events))
+	if err != nil {
+		return err
+	}
+
+	if len(el) != len(events) {
+		return errors.Wrap(ErrReplicaConflict, "missing events",
+			j.MKV{"from": first, "count": len(events)})
+	}
+
+	for i, e := range events {
+		r := el[i]
+		conflict := r.ID != e.ID || r.ForeignID != e.ForeignID ||
+			r.Type.ReflexType() != e.Type.ReflexType() ||
+			!equalStringMaps(r.ForeignKeys, e.ForeignKeys) ||
+			!equalStringMaps(r.Headers, e.Headers) || r.TenantID != e.TenantID
+		if schema.metadataField != "" && !schema.lazyMetadata {
+			conflict = conflict || !bytes.Equal(r.MetaData, e.MetaData)
+		}
+		if conflict {
+			return errors.Wrap(ErrReplicaConflict, "", j.KS("id", e.ID))
+		}
+	}
+
+	return nil
+}
+
+// equalStringMaps returns true if the maps are equal,
+// nil and empty maps are equal.
+func equalStringMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
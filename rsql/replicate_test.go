@@ -0,0 +1,54 @@
+package rsql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicator(t *testing.T) {
+	const replicaTable = "replica"
+	dbc := ConnectTestDB(t, eventsTable, "")
+	defer dbc.Close()
+	createEventsTable(t, dbc, replicaTable, true)
+
+	ctx := context.Background()
+	src := rsql.NewEventsTable(eventsTable)
+	dst := rsql.NewEventsTable(replicaTable)
+
+	jtest.RequireNil(t, insertTestEvent(dbc, src, "1", testEventType(1)))
+	_, err := dbc.Exec("insert into " + eventsTable +
+		" set foreign_id='0', timestamp=now(), type=0")
+	jtest.RequireNil(t, err)
+	jtest.RequireNil(t, insertTestEvent(dbc, src, "3", testEventType(3)))
+
+	r := rsql.NewReplicator(src.ToStream(dbc, reflex.WithStreamToHead()), dst)
+	jtest.Require(t, reflex.ErrHeadReached, r.Run(ctx, dbc))
+
+	// Noops are replicated.
+	latest, err := rsql.GetLatestIDForTesting(t, ctx, dbc, replicaTable)
+	jtest.RequireNil(t, err)
+	require.Equal(t, int64(3), latest)
+
+	sc := dst.Stream(ctx, dbc, "", reflex.WithStreamToHead())
+	for _, id := range []int64{1, 3} {
+		e, err := sc.Recv()
+		jtest.RequireNil(t, err)
+		require.Equal(t, id, e.IDInt())
+		require.Equal(t, id, int64(e.Type.ReflexType()))
+	}
+	_, err = sc.Recv()
+	jtest.Require(t, reflex.ErrHeadReached, err)
+
+	// Replicating again is a noop.
+	jtest.Require(t, reflex.ErrHeadReached, r.Run(ctx, dbc))
+
+	// Events inserted into the replica conflict.
+	jtest.RequireNil(t, insertTestEvent(dbc, src, "4", testEventType(4)))
+	jtest.RequireNil(t, insertTestEvent(dbc, dst, "5", testEventType(5)))
+	jtest.Require(t, rsql.ErrReplicaConflict, r.Run(ctx, dbc))
+}
@@ -0,0 +1,219 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+)
+
+// scheduledAtField is the field of the scheduled events table defining
+// when the event is due, see WithEventsScheduledTable.
+const scheduledAtField = "available_at"
+
+// defaultScheduledPeriod is the default period at which due scheduled
+// events are forwarded, see ForwardScheduledForever.
+const defaultScheduledPeriod = time.Second
+
+// ForwardScheduled inserts the scheduled events that are due into the events
+// table and deletes them from the scheduled table in a single transaction.
+// It returns the number of forwarded events. Forwarded events get new event
+// ids and timestamps, so they are streamed after all existing events. It is
+// safe to call concurrently from multiple processes. It requires the
+// WithEventsScheduledTable option.
+func (t *EventsTable) ForwardScheduled(ctx context.Context, dbc *sql.DB) (int, error) {
+	if t.schema.scheduledTable == "" {
+		return 0, errors.New("scheduled table not enabled")
+	}
+
+	n, err := forwardScheduled(ctx, dbc, t.schema)
+	if err != nil {
+		return 0, err
+	}
+
+	if n > 0 {
+		t.notifier.Notify()
+	}
+
+	return n, nil
+}
+
+// ForwardScheduledForever forwards due scheduled events every second until
+// the context is canceled, see ForwardScheduled. Errors are logged and
+// retried. It always returns a non-nil error.
+func (t *EventsTable) ForwardScheduledForever(ctx context.Context, dbc *sql.DB) error {
+	for {
+		n, err := t.ForwardScheduled(ctx, dbc)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			log.Error(ctx, errors.Wrap(err, "forward scheduled events error",
+				j.KS("table", t.schema.scheduledTable)))
+		}
+
+		if n >= defaultFetchLimit {
+			// More due events.
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(defaultScheduledPeriod):
+		}
+	}
+}
+
+// insertScheduled inserts the events into the scheduled events table.
+// The metadata should already be encoded.
+func insertScheduled(ctx context.Context, tx *sql.Tx, schema etableSchema,
+	events []EventToInsert) error {
+
+	cols := []string{schema.foreignIDField, schema.typeField, scheduledAtField}
+	if schema.metadataField != "" {
+		cols = append(cols, schema.metadataField)
+	}
+
+	var (
+		rows [][]string
+		args []interface{}
+	)
+	for _, e := range events {
+		if e.DedupKey != "" {
+			return errors.New("dedup key not supported for scheduled events")
+		} else if len(e.ForeignKeys) > 0 {
+			return errors.New("foreign keys not supported for scheduled events")
+		} else if len(e.Headers) > 0 {
+			return errors.New("headers not supported for scheduled events")
+		} else if e.TenantID != "" {
+			return errors.New("tenancy not supported for scheduled events")
+		}
+
+		foreignID, err := schema.bindForeignID(e.ForeignID)
+		if err != nil {
+			return err
+		}
+
+		vals := []string{"?", "?", "?"}
+		args = append(args, foreignID, e.Type.ReflexType(), e.AvailableAt)
+
+		if schema.metadataField != "" {
+			vals = append(vals, "?")
+			args = append(args, e.MetaData)
+		} else if e.MetaData != nil {
+			return errors.New("metadata not enabled")
+		}
+
+		rows = append(rows, vals)
+	}
+
+	var q string
+	if len(rows) == 1 {
+		q = schema.dialect.insert(schema.scheduledTable, cols, rows[0])
+	} else {
+		q = schema.dialect.insertRows(schema.scheduledTable, cols, rows)
+	}
+
+	_, err := tx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return errors.Wrap(err, "insert scheduled error", j.KV("count", len(events)))
+	}
+
+	return nil
+}
+
+// forwardScheduled moves the due scheduled events to the events table and
+// returns the number of events moved. Events are only inserted if this
+// transaction deleted them, so concurrent forwarders don't duplicate events.
+func forwardScheduled(ctx context.Context, dbc *sql.DB, schema etableSchema) (int, error) {
+	due, err := getDueScheduled(ctx, dbc, schema)
+	if err != nil {
+		return 0, err
+	} else if len(due) == 0 {
+		return 0, nil
+	}
+
+	tx, err := dbc.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var forward []EventToInsert
+	for _, s := range due {
+		res, err := tx.ExecContext(ctx, schema.dialect.rebind("delete from "+
+			schema.scheduledTable+" where id=?"), s.id)
+		if err != nil {
+			return 0, errors.Wrap(err, "delete scheduled error", j.KV("id", s.id))
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		} else if n == 0 {
+			// Forwarded concurrently.
+			continue
+		}
+
+		forward = append(forward, EventToInsert{
+			ForeignID: s.foreignID,
+			Type:      s.typ,
+			MetaData:  s.metadata,
+		})
+	}
+
+	if len(forward) == 0 {
+		return 0, nil
+	}
+
+	if _, err := insertEvents(ctx, tx, schema, forward); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(forward), nil
+}
+
+type scheduledEvent struct {
+	id        int64
+	foreignID string
+	typ       eventType
+	metadata  []byte
+}
+
+// getDueScheduled returns the scheduled events that are due
+// ordered by available at time.
+func getDueScheduled(ctx context.Context, dbc *sql.DB, schema etableSchema) ([]scheduledEvent, error) {
+	q := "select id, " + schema.foreignIDField + ", " + schema.typeField
+	if schema.metadataField != "" {
+		q += ", " + schema.metadataField
+	} else {
+		q += ", null"
+	}
+	q += " from " + schema.scheduledTable + " where " + scheduledAtField + "<=" +
+		schema.dialect.nowMicros() + " order by " + scheduledAtField + " asc, id asc limit ?"
+
+	rows, err := dbc.QueryContext(ctx, schema.dialect.rebind(q), defaultFetchLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "select scheduled error")
+	}
+	defer rows.Close()
+
+	var res []scheduledEvent
+	for rows.Next() {
+		var s scheduledEvent
+		if err := rows.Scan(&s.id, &s.foreignID, &s.typ, &s.metadata); err != nil {
+			return nil, err
+		}
+		s.foreignID = schema.formatForeignID(s.foreignID)
+		res = append(res, s)
+	}
+
+	return res, rows.Err()
+}
@@ -0,0 +1,155 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// snapshotVersion is the version of the snapshot format.
+const snapshotVersion = 1
+
+// Snapshot is a checkpoint of the cursors and event heads of a service,
+// see Snapshotter.
+type Snapshot struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Heads are the latest event IDs by events table name.
+	Heads map[string]int64 `json:"heads"`
+
+	// Cursors are the consumer cursors by cursors table name and consumer ID.
+	Cursors map[string]map[string]string `json:"cursors"`
+}
+
+// ParseSnapshot returns the snapshot of the blob exported by Snapshotter.Export.
+func ParseSnapshot(b []byte) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, errors.Wrap(err, "invalid snapshot")
+	} else if s.Version != snapshotVersion {
+		return nil, errors.New("unsupported snapshot version", j.KV("version", s.Version))
+	}
+	return &s, nil
+}
+
+// NewSnapshotter returns a snapshotter that exports and imports the cursors
+// of the cursors tables and the heads of the events tables, e.g. for a
+// consistent cutover when migrating a service's database or promoting a
+// replica. Tables are identified by name, so imports must be for tables
+// with the same names.
+func NewSnapshotter(eventsTables []*EventsTable, cursorsTables ...CursorsTable) *Snapshotter {
+	return &Snapshotter{
+		eventsTables:  eventsTables,
+		cursorsTables: cursorsTables,
+	}
+}
+
+// Snapshotter exports and imports snapshots, see NewSnapshotter.
+type Snapshotter struct {
+	eventsTables  []*EventsTable
+	cursorsTables []CursorsTable
+}
+
+// Export returns a snapshot blob of the stored cursors and the event heads.
+// Cursors are listed before the heads are queried, so heads are never
+// behind cursors. Note that pending async cursors are not included, so
+// consumers should be stopped (or their cursors flushed) before exporting.
+func (s *Snapshotter) Export(ctx context.Context, dbc *sql.DB) ([]byte, error) {
+	snap := Snapshot{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now(),
+		Heads:     make(map[string]int64),
+		Cursors:   make(map[string]map[string]string),
+	}
+
+	for _, ct := range s.cursorsTables {
+		name, err := cursorsTableName(ct)
+		if err != nil {
+			return nil, err
+		}
+
+		cursors, err := ct.ListCursors(ctx, dbc)
+		if err != nil {
+			return nil, err
+		}
+
+		m := make(map[string]string)
+		for _, c := range cursors {
+			m[c.ConsumerID] = c.Cursor
+		}
+		snap.Cursors[name] = m
+	}
+
+	for _, et := range s.eventsTables {
+		head, err := getLatestID(ctx, dbc, et.schema)
+		if err != nil {
+			return nil, err
+		}
+		snap.Heads[et.schema.name] = head
+	}
+
+	return json.Marshal(snap)
+}
+
+// Import verifies that the events tables are not behind the snapshot heads
+// and then resets the cursors to the snapshot cursors. It returns
+// ErrSnapshotBehind if an events table (e.g. a replica being promoted) has
+// not caught up with the snapshot yet. Consumers should be stopped before
+// importing since cursors are reset, even if they are before the stored
+// cursors. Cursors not in the snapshot are not changed.
+func (s *Snapshotter) Import(ctx context.Context, dbc *sql.DB, b []byte) error {
+	snap, err := ParseSnapshot(b)
+	if err != nil {
+		return err
+	}
+
+	for _, et := range s.eventsTables {
+		name := et.schema.name
+		want, ok := snap.Heads[name]
+		if !ok {
+			return errors.New("events table not in snapshot", j.KS("table", name))
+		}
+
+		head, err := getLatestID(ctx, dbc, et.schema)
+		if err != nil {
+			return err
+		} else if head < want {
+			return errors.Wrap(ErrSnapshotBehind, "",
+				j.MKV{"table": name, "head": head, "snapshot": want})
+		}
+	}
+
+	for _, ct := range s.cursorsTables {
+		name, err := cursorsTableName(ct)
+		if err != nil {
+			return err
+		}
+
+		cursors, ok := snap.Cursors[name]
+		if !ok {
+			return errors.New("cursors table not in snapshot", j.KS("table", name))
+		}
+
+		for consumerID, cursor := range cursors {
+			if err := ct.ResetCursor(ctx, dbc, consumerID, cursor); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// cursorsTableName returns the DB table name of the cursors table.
+func cursorsTableName(ct CursorsTable) (string, error) {
+	t, ok := ct.(*ctable)
+	if !ok {
+		return "", errors.New("unsupported cursors table")
+	}
+	return t.schema.name, nil
+}
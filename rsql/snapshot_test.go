@@ -0,0 +1,47 @@
+package rsql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotter(t *testing.T) {
+	dbc := ConnectTestDB(t, eventsTable, cursorsTable)
+	defer dbc.Close()
+
+	ctx := context.Background()
+	et := rsql.NewEventsTable(eventsTable)
+	ct := rsql.NewCursorsTable(cursorsTable)
+
+	for i := 0; i < 3; i++ {
+		jtest.RequireNil(t, insertTestEvent(dbc, et, "1", testEventType(1)))
+	}
+	jtest.RequireNil(t, ct.SetCursor(ctx, dbc, "a", "2"))
+	jtest.RequireNil(t, ct.SetCursor(ctx, dbc, "b", "3"))
+
+	s := rsql.NewSnapshotter([]*rsql.EventsTable{et}, ct)
+	b, err := s.Export(ctx, dbc)
+	jtest.RequireNil(t, err)
+
+	snap, err := rsql.ParseSnapshot(b)
+	jtest.RequireNil(t, err)
+	require.Equal(t, map[string]int64{eventsTable: 3}, snap.Heads)
+	require.Equal(t, map[string]string{"a": "2", "b": "3"}, snap.Cursors[cursorsTable])
+
+	// Import resets cursors, even if before the stored cursors.
+	jtest.RequireNil(t, ct.SetCursor(ctx, dbc, "a", "3"))
+	jtest.RequireNil(t, s.Import(ctx, dbc, b))
+
+	c, err := ct.GetCursor(ctx, dbc, "a")
+	jtest.RequireNil(t, err)
+	require.Equal(t, "2", c)
+
+	// Events tables behind the snapshot heads are not imported.
+	_, err = dbc.Exec("delete from " + eventsTable + " where id=3")
+	jtest.RequireNil(t, err)
+	jtest.Require(t, rsql.ErrSnapshotBehind, s.Import(ctx, dbc, b))
+}
@@ -0,0 +1,159 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+const (
+	defaultStateStateField   = "state"
+	defaultStateVersionField = "version"
+)
+
+// NewStatesTable returns a new states table used to persist versioned states
+// with optimistic locking, for example rpatterns workflow state machines.
+// The table requires a varchar primary key "id", a blob "state" and a
+// bigint "version" column.
+func NewStatesTable(name string, opts ...StatesOption) *StatesTable {
+	table := &StatesTable{
+		schema: stableSchema{
+			name:         name,
+			idField:      "id",
+			stateField:   defaultStateStateField,
+			versionField: defaultStateVersionField,
+		},
+	}
+	for _, o := range opts {
+		o(table)
+	}
+	return table
+}
+
+// StatesOption defines a functional option to configure new states tables.
+type StatesOption func(*StatesTable)
+
+// WithStateStateField provides an option to set the state DB state field.
+// It defaults to 'state'.
+func WithStateStateField(field string) StatesOption {
+	return func(table *StatesTable) {
+		table.schema.stateField = field
+	}
+}
+
+// WithStateVersionField provides an option to set the state DB version field.
+// It defaults to 'version'.
+func WithStateVersionField(field string) StatesOption {
+	return func(table *StatesTable) {
+		table.schema.versionField = field
+	}
+}
+
+// WithStateDialect provides an option to set the SQL dialect of the
+// database. It defaults to DialectMySQL.
+func WithStateDialect(d Dialect) StatesOption {
+	return func(table *StatesTable) {
+		table.schema.dialect = d
+	}
+}
+
+// StatesTable provides versioned states stored in a sql db table.
+type StatesTable struct {
+	schema stableSchema
+}
+
+type stableSchema struct {
+	name         string
+	idField      string
+	stateField   string
+	versionField string
+	dialect      Dialect
+}
+
+// Load returns the state and version of the key. It returns a nil state
+// and zero version if the key doesn't exist.
+func (t *StatesTable) Load(ctx context.Context, dbc *sql.DB, key string) ([]byte, int64, error) {
+	return loadState(ctx, dbc, t.schema, key)
+}
+
+// Store stores the state of the key and increments its version if the
+// current version matches. It returns reflex.ErrStateConflict otherwise.
+func (t *StatesTable) Store(ctx context.Context, dbc *sql.DB, key string,
+	state []byte, version int64) error {
+	return storeState(ctx, dbc, t.schema, key, state, version)
+}
+
+// dbtx is implemented by both *sql.DB and *sql.Tx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func loadState(ctx context.Context, dbc dbtx, s stableSchema, key string) ([]byte, int64, error) {
+	var (
+		state   []byte
+		version int64
+	)
+	err := dbc.QueryRowContext(ctx, s.dialect.rebind("select "+s.stateField+", "+
+		s.versionField+" from "+s.name+" where "+s.idField+"=?"), key).Scan(&state, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, errors.Wrap(err, "load state error", j.KS("key", key))
+	}
+
+	return state, version, nil
+}
+
+func storeState(ctx context.Context, dbc dbtx, s stableSchema, key string,
+	state []byte, version int64) error {
+
+	if version == 0 {
+		_, err := dbc.ExecContext(ctx, s.dialect.insert(s.name,
+			[]string{s.idField, s.stateField, s.versionField},
+			[]string{"?", "?", "1"}), key, state)
+		if s.dialect.isErrDupEntry(err) {
+			return errors.Wrap(reflex.ErrStateConflict, "", j.KS("key", key))
+		} else if err != nil {
+			return errors.Wrap(err, "insert state error", j.KS("key", key))
+		}
+		return nil
+	}
+
+	res, err := dbc.ExecContext(ctx, s.dialect.rebind("update "+s.name+" set "+
+		s.stateField+"=?, "+s.versionField+"="+s.versionField+"+1 where "+
+		s.idField+"=? and "+s.versionField+"=?"), state, key, version)
+	if err != nil {
+		return errors.Wrap(err, "update state error", j.KS("key", key))
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return errors.Wrap(reflex.ErrStateConflict, "", j.KS("key", key))
+	}
+
+	return nil
+}
+
+// ToStore returns a reflex StateStore interface of this StatesTable.
+func (t *StatesTable) ToStore(dbc *sql.DB) reflex.StateStore {
+	return &stateStore{t: t, dbc: dbc}
+}
+
+type stateStore struct {
+	t   *StatesTable
+	dbc *sql.DB
+}
+
+func (s *stateStore) Load(ctx context.Context, key string) ([]byte, int64, error) {
+	return s.t.Load(ctx, s.dbc, key)
+}
+
+func (s *stateStore) Store(ctx context.Context, key string, state []byte, version int64) error {
+	return s.t.Store(ctx, s.dbc, key, state, version)
+}
@@ -0,0 +1,49 @@
+package rsql_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+const statesSchema = `
+create temporary table %s (
+  id varchar(255) not null,
+  state blob,
+  version bigint not null,
+
+  primary key (id)
+);
+`
+
+func TestStatesTable(t *testing.T) {
+	dbc := ConnectTestDB(t, "", "")
+	defer dbc.Close()
+
+	_, err := dbc.Exec(fmt.Sprintf(statesSchema, "states"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	ss := rsql.NewStatesTable("states").ToStore(dbc)
+
+	state, version, err := ss.Load(ctx, "key")
+	require.NoError(t, err)
+	require.Nil(t, state)
+	require.Equal(t, int64(0), version)
+
+	require.NoError(t, ss.Store(ctx, "key", []byte("a"), 0))
+	jtest.Require(t, reflex.ErrStateConflict, ss.Store(ctx, "key", []byte("b"), 0))
+
+	require.NoError(t, ss.Store(ctx, "key", []byte("b"), 1))
+	jtest.Require(t, reflex.ErrStateConflict, ss.Store(ctx, "key", []byte("c"), 1))
+
+	state, version, err = ss.Load(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("b"), state)
+	require.Equal(t, int64(2), version)
+}
@@ -0,0 +1,124 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/luno/jettison/errors"
+)
+
+// defaultStatsWindows are the default windows of event rates.
+var defaultStatsWindows = []time.Duration{time.Minute, time.Minute * 5, time.Hour}
+
+// Stats are the statistics of an events table.
+type Stats struct {
+	// HeadID is the latest event ID.
+	HeadID int64
+
+	// Rates are the average events per second over the recent windows.
+	Rates map[time.Duration]float64
+
+	// TypeCounts are the number of events by type over the largest window.
+	TypeCounts map[int]int64
+
+	// EstimatedRows is the estimated number of rows of the table. It is
+	// only supported by MySQL and is zero otherwise.
+	EstimatedRows int64
+
+	// EstimatedBytes is the estimated data and index size of the table in
+	// bytes. It is only supported by MySQL and is zero otherwise.
+	EstimatedBytes int64
+}
+
+// Stats returns the statistics of the events table over the recent windows
+// which default to 1m, 5m and 1h. Event counts are derived from event IDs,
+// so gaps due to rollbacks are included, and it assumes that event timestamps
+// increase with event IDs.
+func (t *EventsTable) Stats(ctx context.Context, dbc *sql.DB,
+	windows ...time.Duration) (*Stats, error) {
+
+	if len(windows) == 0 {
+		windows = defaultStatsWindows
+	}
+	windows = append([]time.Duration(nil), windows...)
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i] < windows[j]
+	})
+
+	head, err := getLatestID(ctx, dbc, t.schema)
+	if err != nil {
+		return nil, errors.Wrap(err, "get latest id error")
+	}
+
+	res := Stats{
+		HeadID: head,
+		Rates:  make(map[time.Duration]float64),
+	}
+
+	now := time.Now()
+	var from int64
+	for _, w := range windows {
+		from, err = getCursorAtTime(ctx, dbc, t.schema, now.Add(-w))
+		if err != nil {
+			return nil, err
+		}
+		res.Rates[w] = float64(head-from) / w.Seconds()
+	}
+
+	// Note from is the cursor of the largest window.
+	res.TypeCounts, err = getTypeCounts(ctx, dbc, t.schema, from)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.schema.dialect == DialectMySQL {
+		res.EstimatedRows, res.EstimatedBytes, err = getTableSize(ctx, dbc, t.schema)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &res, nil
+}
+
+// getTypeCounts returns the number of events by type after the cursor.
+func getTypeCounts(ctx context.Context, dbc *sql.DB, schema etableSchema,
+	after int64) (map[int]int64, error) {
+
+	rows, err := dbc.QueryContext(ctx, schema.dialect.rebind("select "+schema.typeField+
+		", count(*) from "+schema.name+" where id>? group by "+schema.typeField), after)
+	if err != nil {
+		return nil, errors.Wrap(err, "query type counts error")
+	}
+	defer rows.Close()
+
+	res := make(map[int]int64)
+	for rows.Next() {
+		var typ int
+		var n int64
+		if err := rows.Scan(&typ, &n); err != nil {
+			return nil, errors.Wrap(err, "scan type count error")
+		}
+		res[typ] = n
+	}
+
+	return res, rows.Err()
+}
+
+// getTableSize returns the estimated rows and bytes of the MySQL table.
+func getTableSize(ctx context.Context, dbc *sql.DB, schema etableSchema) (int64, int64, error) {
+	var rows, bytes sql.NullInt64
+	err := dbc.QueryRowContext(ctx, "select table_rows, data_length+index_length "+
+		"from information_schema.tables where table_schema=database() and table_name=?",
+		schema.name).Scan(&rows, &bytes)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Temporary tables are not listed.
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, errors.Wrap(err, "query table size error")
+	}
+
+	return rows.Int64, bytes.Int64, nil
+}
@@ -0,0 +1,27 @@
+package rsql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/rsql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	table := rsql.NewEventsTable(eventsTable)
+	for i := 1; i <= 6; i++ {
+		require.NoError(t, insertTestEvent(dbc, table, i2s(i), testEventType(i%2)))
+	}
+
+	stats, err := table.Stats(context.Background(), dbc, time.Minute)
+	jtest.RequireNil(t, err)
+	require.Equal(t, int64(6), stats.HeadID)
+	require.Equal(t, 6.0/60, stats.Rates[time.Minute])
+	require.Equal(t, map[int]int64{0: 3, 1: 3}, stats.TypeCounts)
+}
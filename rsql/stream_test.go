@@ -418,6 +418,158 @@ func TestStreamToHead(t *testing.T) {
 	assertCount(t, "30", 0, 0)
 }
 
+func TestStreamFromTime(t *testing.T) {
+	s := setupState(t, nil, nil)
+	defer s.stop()
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	total := 20
+	for i := 1; i <= total; i++ {
+		_, err := s.dbc.Exec("insert into "+eventsTable+
+			" set foreign_id=?, timestamp=?, type=?", i2s(i), t0.Add(time.Hour*time.Duration(i)), i)
+		require.NoError(t, err)
+	}
+
+	assertFrom := func(t *testing.T, from time.Time, first int) {
+		sc, err := s.client.StreamEvents(context.Background(), "",
+			reflex.WithStreamFromTime(from), reflex.WithStreamToHead())
+		require.NoError(t, err)
+
+		var results []*reflex.Event
+		for {
+			e, err := sc.Recv()
+			if reflex.IsHeadReachedErr(err) {
+				break
+			}
+			jtest.RequireNil(t, err)
+			results = append(results, e)
+		}
+
+		require.Len(t, results, total-first+1)
+		if len(results) > 0 {
+			require.Equal(t, int64(first), results[0].IDInt())
+		}
+	}
+
+	assertFrom(t, t0, 1)
+	assertFrom(t, t0.Add(time.Hour), 1)
+	assertFrom(t, t0.Add(time.Hour*5), 5)
+	assertFrom(t, t0.Add(time.Hour*5+time.Minute), 6)
+	assertFrom(t, t0.Add(time.Hour*20), 20)
+	assertFrom(t, t0.Add(time.Hour*21), 21)
+}
+
+func TestStreamUntil(t *testing.T) {
+	s := setupState(t, nil, nil)
+	defer s.stop()
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	insert := func(i int) {
+		_, err := s.dbc.Exec("insert into "+eventsTable+
+			" set foreign_id=?, timestamp=?, type=?", i2s(i), t0.Add(time.Hour*time.Duration(i)), i)
+		require.NoError(t, err)
+	}
+
+	total := 10
+	for i := 1; i <= total; i++ {
+		insert(i)
+	}
+
+	assertUntil := func(t *testing.T, last int, opts ...reflex.StreamOption) {
+		sc, err := s.client.StreamEvents(context.Background(), "", opts...)
+		require.NoError(t, err)
+
+		var results []*reflex.Event
+		for {
+			e, err := sc.Recv()
+			if reflex.IsHeadReachedErr(err) {
+				break
+			}
+			jtest.RequireNil(t, err)
+			results = append(results, e)
+
+			// Events inserted after the stream started are not streamed.
+			if len(results) == 1 {
+				total++
+				insert(total)
+			}
+		}
+
+		require.Len(t, results, last)
+		require.Equal(t, int64(last), results[len(results)-1].IDInt())
+	}
+
+	assertUntil(t, 10, reflex.WithStreamToHead())
+	assertUntil(t, 5, reflex.WithStreamUntil("5"))
+	assertUntil(t, 5, reflex.WithStreamUntil("5"), reflex.WithStreamToHead())
+	assertUntil(t, 4, reflex.WithStreamUntilTime(t0.Add(time.Hour*5)))
+}
+
+func TestStreamDescending(t *testing.T) {
+	s := setupState(t, nil, nil)
+	defer s.stop()
+
+	total := 10
+	for i := 1; i <= total; i++ {
+		err := insertTestEvent(s.dbc, s.etable, i2s(i), testEventType(i))
+		require.NoError(t, err)
+	}
+
+	assertDesc := func(t *testing.T, floor string, expect ...int) {
+		sc, err := s.client.StreamEvents(context.Background(), floor,
+			reflex.WithStreamDescending())
+		require.NoError(t, err)
+
+		var results []int
+		for {
+			e, err := sc.Recv()
+			if reflex.IsHeadReachedErr(err) {
+				break
+			}
+			jtest.RequireNil(t, err)
+			results = append(results, int(e.IDInt()))
+		}
+
+		require.Equal(t, expect, results)
+	}
+
+	assertDesc(t, "", 10, 9, 8, 7, 6, 5, 4, 3, 2, 1)
+	assertDesc(t, "7", 10, 9, 8)
+	assertDesc(t, "10")
+}
+
+func TestStreamFilter(t *testing.T) {
+	s := setupState(t, nil, nil)
+	defer s.stop()
+
+	for i := 1; i <= 10; i++ {
+		fid := "user:" + i2s(i)
+		if i > 5 {
+			fid = "order:" + i2s(i)
+		}
+		err := insertTestEvent(s.dbc, s.etable, fid, testEventType(i%2+1))
+		require.NoError(t, err)
+	}
+
+	sc, err := s.client.StreamEvents(context.Background(), "",
+		reflex.WithStreamToHead(),
+		reflex.WithStreamTypes(testEventType(2)),
+		reflex.WithStreamForeignIDPrefix("user:"))
+	jtest.RequireNil(t, err)
+
+	var ids []string
+	for {
+		e, err := sc.Recv()
+		if reflex.IsHeadReachedErr(err) {
+			break
+		}
+		jtest.RequireNil(t, err)
+		ids = append(ids, e.ID)
+	}
+
+	require.Equal(t, []string{"1", "3", "5"}, ids)
+}
+
 func TestStreamMetadata(t *testing.T) {
 	cache := eventsMetadataField
 	defer func() {
@@ -666,3 +818,30 @@ func setupState(t *testing.T, streamOptions []reflex.StreamOption,
 		stop:   stop,
 	}
 }
+
+func TestStreamReplicas(t *testing.T) {
+	dbc, close := ConnectAndCloseTestDB(t, eventsTable, "")
+	defer close()
+
+	replica, err := connect(1)
+	jtest.RequireNil(t, err)
+	defer replica.Close()
+
+	failed, err := connect(1)
+	jtest.RequireNil(t, err)
+	jtest.RequireNil(t, failed.Close())
+
+	for i := 1; i <= 3; i++ {
+		err := insertTestEvent(dbc, rsql.NewEventsTable(eventsTable), i2s(i), testEventType(i))
+		jtest.RequireNil(t, err)
+	}
+
+	for _, replicas := range [][]*sql.DB{{replica}, {failed}, {failed, replica}} {
+		table := rsql.NewEventsTable(eventsTable,
+			rsql.WithEventsReplicas(time.Minute, replicas...))
+
+		sc, err := table.ToStream(dbc)(context.Background(), "", reflex.WithStreamToHead())
+		jtest.RequireNil(t, err)
+		assertEvent(t, sc, 1, 2, 3)
+	}
+}
@@ -0,0 +1,45 @@
+package rsql
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+)
+
+// bindTenant returns the tenant of an event as a query argument, null for
+// events without a tenant, e.g. noops.
+func (s etableSchema) bindTenant(tenantID string) (interface{}, error) {
+	if s.tenantField == "" && tenantID != "" {
+		return nil, errors.New("tenancy not enabled")
+	}
+	return sql.NullString{String: tenantID, Valid: tenantID != ""}, nil
+}
+
+// key returns the cursor key of the consumer which is
+// prefixed by the tenant if the table is tenant scoped.
+func (s ctableSchema) key(consumerID string) string {
+	if s.tenant == "" {
+		return consumerID
+	}
+	return s.tenant + "/" + consumerID
+}
+
+// consumerID returns the consumer ID of the cursor key, see key.
+func (s ctableSchema) consumerID(key string) string {
+	return strings.TrimPrefix(key, s.tenant+"/")
+}
+
+// writes returns the holder and tenant columns, values and update
+// assignments to write with a cursor and the args for both the values
+// and updates.
+func (s ctableSchema) writes(d Dialect) (cols, vals, updates []string, args []interface{}) {
+	cols, vals, updates, args = s.holder.writes(d)
+	if s.tenant != "" {
+		cols = append(cols, s.tenantField)
+		vals = append(vals, "?")
+		updates = append(updates, s.tenantField+"=?")
+		args = append(args, s.tenant)
+	}
+	return cols, vals, updates, args
+}
@@ -0,0 +1,117 @@
+package rsql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+)
+
+// defaultVerifyPeriod is the default period at which events are verified,
+// see Verifier.VerifyForever.
+const defaultVerifyPeriod = time.Hour
+
+// NewVerifier returns a verifier that verifies the checksums of all the
+// events of the table, e.g. to detect corruption or manual tampering of
+// audit-sensitive streams. The table requires the WithEventChecksumField
+// option. Unlike streams, the verifier also verifies lazy metadata.
+func NewVerifier(table *EventsTable) *Verifier {
+	return &Verifier{table: table}
+}
+
+// Verifier verifies event checksums, see NewVerifier.
+type Verifier struct {
+	table *EventsTable
+}
+
+// VerifyOnce verifies the checksums of all the events in the table and
+// returns the IDs of the events with mismatching checksums. Events without
+// checksums are not verified.
+func (v *Verifier) VerifyOnce(ctx context.Context, dbc *sql.DB) ([]int64, error) {
+	schema := v.table.schema
+	if schema.checksumField == "" {
+		return nil, errors.New("checksums not enabled")
+	}
+	schema.lazyMetadata = false
+
+	var (
+		after    int64
+		mismatch []int64
+	)
+	for {
+		ids, last, err := verifyBatch(ctx, dbc, schema, after)
+		if err != nil {
+			return nil, err
+		}
+
+		mismatch = append(mismatch, ids...)
+		checksumMismatchCounter.WithLabelValues(schema.name).Add(float64(len(ids)))
+
+		if last == 0 {
+			return mismatch, nil
+		}
+		after = last
+	}
+}
+
+// verifyBatch verifies the next batch of events after the id and returns the
+// IDs of the events with mismatching checksums and the last event ID or
+// zero if no events are left.
+func verifyBatch(ctx context.Context, dbc *sql.DB, schema etableSchema,
+	after int64) ([]int64, int64, error) {
+
+	q := selectEventsQuery(schema) + " where id>? order by id asc limit ?"
+	rows, err := dbc.QueryContext(ctx, schema.dialect.rebind(q), after, defaultFetchLimit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var (
+		last     int64
+		mismatch []int64
+	)
+	for rows.Next() {
+		e, sum, err := scanEvent(rows, schema)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		last = e.IDInt()
+		err = schema.verifyChecksum(e, sum)
+		if errors.Is(err, ErrChecksumMismatch) {
+			mismatch = append(mismatch, last)
+		} else if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return mismatch, last, rows.Err()
+}
+
+// VerifyForever verifies the events every hour until the context is
+// canceled, see VerifyOnce. Mismatches and errors are logged. It always
+// returns a non-nil error.
+func (v *Verifier) VerifyForever(ctx context.Context, dbc *sql.DB) error {
+	for {
+		ids, err := v.VerifyOnce(ctx, dbc)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			log.Error(ctx, errors.Wrap(err, "verify events error",
+				j.KS("table", v.table.schema.name)))
+		} else if len(ids) > 0 {
+			log.Error(ctx, errors.Wrap(ErrChecksumMismatch, "verify events mismatch",
+				j.MKV{"table": v.table.schema.name, "count": len(ids), "first": ids[0]}))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(defaultVerifyPeriod):
+		}
+	}
+}
@@ -0,0 +1,14 @@
+// Package rsqs provides a reflex ack stream of events consumed from an AWS SQS
+// queue, optionally subscribed to an SNS topic (fan-out). Events are acked by
+// deleting their messages, see reflex.NewAckStreamSpec.
+//
+// Messages are mapped to events as follows:
+//   - ID is the message ID.
+//   - Type is parsed from the "type" message attribute.
+//   - ForeignID is the "foreign_id" message attribute.
+//   - Timestamp is the time the message was sent.
+//   - MetaData is the message body.
+//
+// rsqs provides at-least-once delivery semantics, messages that are not acked
+// before their visibility timeout are redelivered, possibly out of order.
+package rsqs
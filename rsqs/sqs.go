@@ -0,0 +1,279 @@
+package rsqs
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+const (
+	defaultTypeAttr      = "type"
+	defaultForeignIDAttr = "foreign_id"
+	sentTimestampAttr    = "SentTimestamp"
+)
+
+// Option is a functional option that configures a queue.
+type Option func(*Queue)
+
+// WithTypeAttribute returns an option to configure the message attribute
+// containing the event type. It defaults to "type".
+func WithTypeAttribute(name string) Option {
+	return func(q *Queue) {
+		q.typeAttr = name
+	}
+}
+
+// WithForeignIDAttribute returns an option to configure the message attribute
+// containing the event foreign id. It defaults to "foreign_id".
+func WithForeignIDAttribute(name string) Option {
+	return func(q *Queue) {
+		q.foreignIDAttr = name
+	}
+}
+
+// WithWaitTime returns an option to configure the long polling wait time
+// of each receive request. It defaults to 20 seconds (the maximum).
+func WithWaitTime(d time.Duration) Option {
+	return func(q *Queue) {
+		q.waitSeconds = int64(d.Seconds())
+	}
+}
+
+// WithVisibilityTimeout returns an option to override the queue's visibility
+// timeout of received messages; ie. the duration after which unacked events
+// are redelivered.
+func WithVisibilityTimeout(d time.Duration) Option {
+	return func(q *Queue) {
+		q.visibilitySeconds = int64(d.Seconds())
+	}
+}
+
+// WithSNSEnvelope returns an option to unwrap messages published to an SNS topic
+// subscribed to the queue without raw message delivery. The event is then
+// mapped from the SNS notification's message, attributes and timestamp.
+func WithSNSEnvelope() Option {
+	return func(q *Queue) {
+		q.snsEnvelope = true
+	}
+}
+
+// NewQueue returns a queue for the provided SQS queue url.
+func NewQueue(api sqsiface.SQSAPI, queueURL string, opts ...Option) *Queue {
+	q := &Queue{
+		api:           api,
+		url:           queueURL,
+		typeAttr:      defaultTypeAttr,
+		foreignIDAttr: defaultForeignIDAttr,
+		waitSeconds:   20,
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	return q
+}
+
+// Queue defines an SQS queue from which to stream messages as events.
+type Queue struct {
+	api               sqsiface.SQSAPI
+	url               string
+	typeAttr          string
+	foreignIDAttr     string
+	waitSeconds       int64
+	visibilitySeconds int64
+	snsEnvelope       bool
+}
+
+// Stream implements reflex.AckStreamFunc and returns an AckStreamClient that
+// streams messages from the queue. Only the StreamToHead option is supported,
+// in which case ErrHeadReached is returned when no messages are available.
+func (q *Queue) Stream(ctx context.Context, opts ...reflex.StreamOption) (reflex.AckStreamClient, error) {
+	var o reflex.StreamOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if !reflect.DeepEqual(o, reflex.StreamOptions{StreamToHead: o.StreamToHead}) {
+		return nil, errors.New("only the stream to head option is supported")
+	}
+
+	return &stream{
+		ctx:      ctx,
+		q:        q,
+		toHead:   o.StreamToHead,
+		receipts: make(map[string]string),
+	}, nil
+}
+
+type stream struct {
+	ctx    context.Context
+	q      *Queue
+	toHead bool
+	buf    []*sqs.Message
+
+	mu       sync.Mutex
+	receipts map[string]string
+}
+
+func (s *stream) Recv() (*reflex.Event, error) {
+	for len(s.buf) == 0 {
+		if err := s.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		in := &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(s.q.url),
+			MaxNumberOfMessages:   aws.Int64(10),
+			WaitTimeSeconds:       aws.Int64(s.q.waitSeconds),
+			AttributeNames:        aws.StringSlice([]string{sentTimestampAttr}),
+			MessageAttributeNames: aws.StringSlice([]string{s.q.typeAttr, s.q.foreignIDAttr}),
+		}
+		if s.q.visibilitySeconds > 0 {
+			in.VisibilityTimeout = aws.Int64(s.q.visibilitySeconds)
+		}
+
+		res, err := s.q.api.ReceiveMessageWithContext(s.ctx, in)
+		if err != nil {
+			return nil, errors.Wrap(err, "receive message error")
+		}
+
+		if len(res.Messages) == 0 && s.toHead {
+			return nil, reflex.ErrHeadReached
+		}
+
+		s.buf = res.Messages
+	}
+
+	m := s.buf[0]
+	s.buf = s.buf[1:]
+
+	e, err := s.q.toEvent(m)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.receipts[e.ID] = aws.StringValue(m.ReceiptHandle)
+	s.mu.Unlock()
+
+	return e, nil
+}
+
+// Ack deletes the event's message from the queue.
+func (s *stream) Ack(ctx context.Context, e *reflex.Event) error {
+	s.mu.Lock()
+	receipt, ok := s.receipts[e.ID]
+	delete(s.receipts, e.ID)
+	s.mu.Unlock()
+
+	if !ok {
+		return errors.New("unknown message", j.KS("message_id", e.ID))
+	}
+
+	_, err := s.q.api.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(s.q.url),
+		ReceiptHandle: aws.String(receipt),
+	})
+	if err != nil {
+		return errors.Wrap(err, "delete message error", j.KS("message_id", e.ID))
+	}
+
+	return nil
+}
+
+// snsNotification is the envelope of messages published to an SNS topic.
+type snsNotification struct {
+	MessageID         string    `json:"MessageId"`
+	Message           string    `json:"Message"`
+	Timestamp         time.Time `json:"Timestamp"`
+	MessageAttributes map[string]struct {
+		Type  string `json:"Type"`
+		Value string `json:"Value"`
+	} `json:"MessageAttributes"`
+}
+
+// toEvent maps the message to an event.
+func (q *Queue) toEvent(m *sqs.Message) (*reflex.Event, error) {
+	id := aws.StringValue(m.MessageId)
+
+	if q.snsEnvelope {
+		var n snsNotification
+		if err := json.Unmarshal([]byte(aws.StringValue(m.Body)), &n); err != nil {
+			return nil, errors.Wrap(err, "unmarshal sns notification error",
+				j.KS("message_id", id))
+		}
+
+		typ, err := parseType(n.MessageAttributes[q.typeAttr].Value)
+		if err != nil {
+			return nil, errors.Wrap(err, "", j.KS("message_id", id))
+		}
+
+		return &reflex.Event{
+			ID:        id,
+			Type:      typ,
+			ForeignID: n.MessageAttributes[q.foreignIDAttr].Value,
+			Timestamp: n.Timestamp,
+			MetaData:  []byte(n.Message),
+		}, nil
+	}
+
+	var ts time.Time
+	if v, ok := m.Attributes[sentTimestampAttr]; ok {
+		ms, err := strconv.ParseInt(aws.StringValue(v), 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid sent timestamp", j.KS("message_id", id))
+		}
+		ts = time.Unix(0, ms*int64(time.Millisecond))
+	}
+
+	typ, err := parseType(attrValue(m, q.typeAttr))
+	if err != nil {
+		return nil, errors.Wrap(err, "", j.KS("message_id", id))
+	}
+
+	return &reflex.Event{
+		ID:        id,
+		Type:      typ,
+		ForeignID: attrValue(m, q.foreignIDAttr),
+		Timestamp: ts,
+		MetaData:  []byte(aws.StringValue(m.Body)),
+	}, nil
+}
+
+func attrValue(m *sqs.Message, name string) string {
+	v, ok := m.MessageAttributes[name]
+	if !ok {
+		return ""
+	}
+	return aws.StringValue(v.StringValue)
+}
+
+// parseType returns the event type or zero if the attribute is empty.
+func parseType(v string) (eventType, error) {
+	if v == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid event type attribute")
+	}
+	return eventType(i), nil
+}
+
+// eventType is the rsqs internal implementation of EventType interface.
+type eventType int
+
+func (t eventType) ReflexType() int {
+	return int(t)
+}
@@ -0,0 +1,114 @@
+package rsqs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/luno/fate"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rsqs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	api := &mockSQS{
+		messages: []*sqs.Message{
+			{
+				MessageId:     aws.String("m1"),
+				ReceiptHandle: aws.String("r1"),
+				Body:          aws.String("body1"),
+				Attributes:    map[string]*string{"SentTimestamp": aws.String("1577836800000")},
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					"type":       {DataType: aws.String("Number"), StringValue: aws.String("2")},
+					"foreign_id": {DataType: aws.String("String"), StringValue: aws.String("f1")},
+				},
+			},
+			{
+				MessageId:     aws.String("m2"),
+				ReceiptHandle: aws.String("r2"),
+			},
+		},
+	}
+
+	q := rsqs.NewQueue(api, "url")
+
+	var events []*reflex.Event
+	consumer := reflex.NewConsumer("test_sqs", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+		events = append(events, e)
+		return nil
+	})
+
+	err := reflex.Run(context.Background(), reflex.NewAckStreamSpec(q.Stream, consumer,
+		reflex.WithStreamToHead()))
+	jtest.Require(t, reflex.ErrHeadReached, err)
+
+	require.Len(t, events, 2)
+	require.Equal(t, "m1", events[0].ID)
+	require.Equal(t, 2, events[0].Type.ReflexType())
+	require.Equal(t, "f1", events[0].ForeignID)
+	require.Equal(t, []byte("body1"), events[0].MetaData)
+	require.True(t, time.Unix(1577836800, 0).Equal(events[0].Timestamp))
+	require.Equal(t, []string{"r1", "r2"}, api.deleted)
+}
+
+func TestSNSEnvelope(t *testing.T) {
+	body := `{"Type":"Notification","MessageId":"n1","Message":"hello",` +
+		`"Timestamp":"2020-01-01T00:00:00.000Z","MessageAttributes":{` +
+		`"type":{"Type":"Number","Value":"3"},"foreign_id":{"Type":"String","Value":"f1"}}}`
+
+	api := &mockSQS{
+		messages: []*sqs.Message{{
+			MessageId:     aws.String("m1"),
+			ReceiptHandle: aws.String("r1"),
+			Body:          aws.String(body),
+		}},
+	}
+
+	sc, err := rsqs.NewQueue(api, "url", rsqs.WithSNSEnvelope()).
+		Stream(context.Background(), reflex.WithStreamToHead())
+	jtest.RequireNil(t, err)
+
+	e, err := sc.Recv()
+	jtest.RequireNil(t, err)
+	require.Equal(t, 3, e.Type.ReflexType())
+	require.Equal(t, "f1", e.ForeignID)
+	require.Equal(t, []byte("hello"), e.MetaData)
+	require.True(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Equal(e.Timestamp))
+
+	_, err = sc.Recv()
+	jtest.Require(t, reflex.ErrHeadReached, err)
+
+	jtest.RequireNil(t, sc.Ack(context.Background(), e))
+	require.Equal(t, []string{"r1"}, api.deleted)
+}
+
+type mockSQS struct {
+	sqsiface.SQSAPI
+	messages []*sqs.Message
+	deleted  []string
+}
+
+func (m *mockSQS) ReceiveMessageWithContext(_ aws.Context, in *sqs.ReceiveMessageInput,
+	_ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+
+	n := int(aws.Int64Value(in.MaxNumberOfMessages))
+	if n > len(m.messages) {
+		n = len(m.messages)
+	}
+	res := m.messages[:n]
+	m.messages = m.messages[n:]
+	return &sqs.ReceiveMessageOutput{Messages: res}, nil
+}
+
+func (m *mockSQS) DeleteMessageWithContext(_ aws.Context, in *sqs.DeleteMessageInput,
+	_ ...request.Option) (*sqs.DeleteMessageOutput, error) {
+
+	m.deleted = append(m.deleted, aws.StringValue(in.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
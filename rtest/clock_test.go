@@ -0,0 +1,113 @@
+package rtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClock(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := rtest.NewClock(t0)
+	require.Equal(t, t0, c.Now())
+
+	ch := c.After(time.Minute)
+	require.Equal(t, 1, c.Waiters())
+
+	c.Advance(time.Second * 59)
+	select {
+	case <-ch:
+		require.Fail(t, "fired early")
+	default:
+	}
+
+	c.Advance(time.Second)
+	require.Equal(t, t0.Add(time.Minute), <-ch)
+	require.Equal(t, 0, c.Waiters())
+}
+
+func TestClockConsumerLag(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := rtest.NewClock(t0)
+	m := new(lagMetrics)
+
+	c := reflex.NewConsumer("test_clock", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+		clock.Advance(time.Second)
+		return nil
+	}, reflex.WithConsumerClock(clock),
+		reflex.WithConsumerLagAlert(time.Minute),
+		reflex.WithConsumerMetrics(func(string, []reflex.EventType) reflex.Metrics {
+			return m
+		}))
+
+	ctx := context.Background()
+	require.NoError(t, c.Consume(ctx, fate.New(), &reflex.Event{ID: "1", Timestamp: t0}))
+	require.Equal(t, time.Duration(0), m.lag)
+	require.False(t, m.alert)
+	require.Equal(t, time.Second, m.latency)
+
+	clock.Advance(time.Minute)
+	require.NoError(t, c.Consume(ctx, fate.New(), &reflex.Event{ID: "2", Timestamp: t0}))
+	require.Equal(t, time.Minute+time.Second, m.lag)
+	require.True(t, m.alert)
+}
+
+func TestClockConsumerRetry(t *testing.T) {
+	clock := rtest.NewClock(time.Now())
+	errRetry := errors.New("retry")
+
+	var calls int
+	c := reflex.NewConsumer("test_clock_retry", func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+		calls++
+		if calls < 3 {
+			return errRetry
+		}
+		return nil
+	}, reflex.WithConsumerClock(clock),
+		reflex.WithRetryBackoff(time.Minute, time.Hour),
+		reflex.WithErrorPolicy(func(err error, e *reflex.Event) reflex.ErrorAction {
+			return reflex.ErrorActionRetry
+		}))
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Consume(context.Background(), fate.New(), &reflex.Event{ID: "1"})
+	}()
+
+	for _, backoff := range []time.Duration{time.Minute, 2 * time.Minute} {
+		require.Eventually(t, func() bool {
+			return clock.Waiters() == 1
+		}, time.Second, time.Millisecond)
+		clock.Advance(backoff)
+	}
+
+	require.NoError(t, <-errCh)
+	require.Equal(t, 3, calls)
+}
+
+type lagMetrics struct {
+	lag     time.Duration
+	alert   bool
+	latency time.Duration
+}
+
+func (m *lagMetrics) ConsumeObserved(e *reflex.Event, latency time.Duration) {
+	m.latency = latency
+}
+
+func (m *lagMetrics) ErrorInced(*reflex.Event) {}
+
+func (m *lagMetrics) EventsInced(*reflex.Event) {}
+
+func (m *lagMetrics) LagSet(e *reflex.Event, lag time.Duration, alert bool) {
+	m.lag = lag
+	m.alert = alert
+}
+
+func (m *lagMetrics) ActivitySet() {}
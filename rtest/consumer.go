@@ -0,0 +1,91 @@
+package rtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/stretchr/testify/require"
+)
+
+// NeverFate returns a fate that never tempts, ensuring deterministic tests.
+func NeverFate() fate.Fate {
+	return neverFate{}
+}
+
+type neverFate struct{}
+
+func (neverFate) Tempt() error {
+	return nil
+}
+
+// ConsumerResult is the result of RunConsumerTest.
+type ConsumerResult struct {
+	// Cursor is the ID of the last successfully consumed event.
+	Cursor string
+
+	// Err is the first error returned by the consumer.
+	Err error
+
+	// Consumed are the events successfully consumed.
+	Consumed []*reflex.Event
+}
+
+// RequireCursor asserts the terminal cursor.
+func (r ConsumerResult) RequireCursor(t *testing.T, cursor string) {
+	t.Helper()
+	require.Equal(t, cursor, r.Cursor, "unexpected terminal cursor")
+}
+
+// RequireErr asserts the terminal error; nil asserts that all events
+// were consumed successfully.
+func (r ConsumerResult) RequireErr(t *testing.T, err error) {
+	t.Helper()
+	jtest.Require(t, err, r.Err)
+}
+
+// RunConsumerTest feeds the fixed sequence of events through the consumer
+// using NeverFate. It stops at the first error. Stateful consumers are reset
+// before the first event, as reflex.Run does.
+func RunConsumerTest(t *testing.T, consumer reflex.Consumer,
+	events ...*reflex.Event) ConsumerResult {
+
+	t.Helper()
+
+	if r, ok := consumer.(interface{ Reset() error }); ok {
+		jtest.RequireNil(t, r.Reset(), "reset error")
+	}
+
+	var res ConsumerResult
+	for _, e := range events {
+		if err := consumer.Consume(context.Background(), NeverFate(), e); err != nil {
+			res.Err = err
+			return res
+		}
+		res.Cursor = e.ID
+		res.Consumed = append(res.Consumed, e)
+	}
+
+	return res
+}
+
+// Expected defines an expected event in an events table.
+type Expected struct {
+	ForeignID string
+	Type      reflex.EventType
+}
+
+// RequireEvents asserts that the events table contains exactly the expected
+// (side-effect) events in order. Event IDs and timestamps are ignored.
+func RequireEvents(t *testing.T, table *EventsTable, expected ...Expected) {
+	t.Helper()
+
+	events := table.Events()
+	require.Len(t, events, len(expected), "unexpected number of events")
+	for i, e := range events {
+		require.Equal(t, expected[i].ForeignID, e.ForeignID, "event %d foreign id", i)
+		require.True(t, reflex.IsType(expected[i].Type, e.Type), "event %d type", i)
+	}
+}
@@ -0,0 +1,72 @@
+package rtest_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rtest"
+)
+
+func TestRunConsumerTest(t *testing.T) {
+	errPoison := errors.New("poison event")
+
+	tests := []struct {
+		name   string
+		events []int
+		cursor string
+		err    error
+		emits  []rtest.Expected
+	}{
+		{
+			name:   "all events",
+			events: []int{1, 2, 3},
+			cursor: "3",
+			emits: []rtest.Expected{
+				{ForeignID: "1", Type: testEventType(10)},
+				{ForeignID: "2", Type: testEventType(20)},
+				{ForeignID: "3", Type: testEventType(30)},
+			},
+		}, {
+			name:   "poison event",
+			events: []int{1, 2, 99, 4},
+			cursor: "2",
+			err:    errPoison,
+			emits: []rtest.Expected{
+				{ForeignID: "1", Type: testEventType(10)},
+				{ForeignID: "2", Type: testEventType(20)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := rtest.NewEventsTable()
+			consumer := reflex.NewConsumer("golden_"+tt.name,
+				func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+					if e.Type.ReflexType() == 99 {
+						return errPoison
+					}
+					out.Insert(e.ForeignID, testEventType(e.Type.ReflexType()*10))
+					return f.Tempt()
+				})
+
+			var events []*reflex.Event
+			for _, i := range tt.events {
+				events = append(events, &reflex.Event{
+					ID:        strconv.Itoa(i),
+					ForeignID: strconv.Itoa(i),
+					Type:      testEventType(i),
+				})
+			}
+
+			res := rtest.RunConsumerTest(t, consumer, events...)
+			res.RequireCursor(t, tt.cursor)
+			res.RequireErr(t, tt.err)
+			rtest.RequireEvents(t, out, tt.emits...)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package rtest
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+var (
+	_ reflex.CursorStore    = (*CursorStore)(nil)
+	_ reflex.CursorResetter = (*CursorStore)(nil)
+)
+
+// ErrCursorNotIncreasing is returned when setting a cursor that is not
+// greater than the existing cursor, matching rsql cursor tables.
+var ErrCursorNotIncreasing = errors.New("attempted to set cursor <= existing cursor",
+	j.C("ERR_8d3a5f1c07e29b64"))
+
+// NewCursorStore returns a new in-memory cursor store.
+func NewCursorStore() *CursorStore {
+	return &CursorStore{cursors: make(map[string]string)}
+}
+
+// CursorStore is an in-memory cursor store that is safe for concurrent use.
+type CursorStore struct {
+	mu      sync.Mutex
+	cursors map[string]string
+	flushes int
+}
+
+func (s *CursorStore) GetCursor(_ context.Context, consumerName string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cursors[consumerName], nil
+}
+
+// SetCursor sets the consumer's cursor. Like rsql cursor tables, cursors
+// may only increase, it returns ErrCursorNotIncreasing otherwise.
+// Use ResetCursor to move a cursor backwards.
+func (s *CursorStore) SetCursor(_ context.Context, consumerName string, cursor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if prev, ok := s.cursors[consumerName]; ok && !cursorLess(prev, cursor) {
+		return errors.Wrap(ErrCursorNotIncreasing, "",
+			j.MKS{"consumer": consumerName, "cursor": cursor, "existing": prev})
+	}
+
+	s.cursors[consumerName] = cursor
+	return nil
+}
+
+// ResetCursor sets the consumer's cursor to any value, including
+// values before the existing cursor.
+func (s *CursorStore) ResetCursor(_ context.Context, consumerName string, cursor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursors[consumerName] = cursor
+	return nil
+}
+
+func (s *CursorStore) Flush(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushes++
+	return nil
+}
+
+// Cursor returns the current cursor of the consumer.
+func (s *CursorStore) Cursor(consumerName string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cursors[consumerName]
+}
+
+// FlushCount returns the number of times Flush was called.
+func (s *CursorStore) FlushCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flushes
+}
+
+// cursorLess returns true if cursor a is before b. Integer cursors are
+// compared numerically, other cursors lexicographically.
+func cursorLess(a, b string) bool {
+	ai, errA := strconv.ParseInt(a, 10, 64)
+	bi, errB := strconv.ParseInt(b, 10, 64)
+	if errA == nil && errB == nil {
+		return ai < bi
+	}
+	return a < b
+}
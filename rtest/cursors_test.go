@@ -0,0 +1,33 @@
+package rtest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorStore(t *testing.T) {
+	ctx := context.Background()
+	s := rtest.NewCursorStore()
+
+	jtest.RequireNil(t, s.SetCursor(ctx, "c", "9"))
+	jtest.RequireNil(t, s.SetCursor(ctx, "c", "10"))
+	require.Equal(t, "10", s.Cursor("c"))
+
+	// Cursors only increase.
+	jtest.Require(t, rtest.ErrCursorNotIncreasing, s.SetCursor(ctx, "c", "10"))
+	jtest.Require(t, rtest.ErrCursorNotIncreasing, s.SetCursor(ctx, "c", "2"))
+	require.Equal(t, "10", s.Cursor("c"))
+
+	// Unless explicitly reset.
+	jtest.RequireNil(t, s.ResetCursor(ctx, "c", "2"))
+	require.Equal(t, "2", s.Cursor("c"))
+
+	// String cursors are compared lexicographically.
+	jtest.RequireNil(t, s.SetCursor(ctx, "s", "a"))
+	jtest.RequireNil(t, s.SetCursor(ctx, "s", "b"))
+	jtest.Require(t, rtest.ErrCursorNotIncreasing, s.SetCursor(ctx, "s", "a"))
+}
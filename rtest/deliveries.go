@@ -0,0 +1,46 @@
+package rtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/luno/reflex"
+)
+
+var _ reflex.DeliveryStore = (*DeliveryStore)(nil)
+
+// NewDeliveryStore returns a new in-memory delivery store.
+func NewDeliveryStore() *DeliveryStore {
+	return &DeliveryStore{
+		deliveries: make(map[deliveryKey]reflex.Delivery),
+	}
+}
+
+// DeliveryStore is an in-memory delivery store that is safe for concurrent use.
+type DeliveryStore struct {
+	mu         sync.Mutex
+	deliveries map[deliveryKey]reflex.Delivery
+}
+
+type deliveryKey struct {
+	endpoint string
+	eventID  string
+}
+
+func (s *DeliveryStore) RecordDelivery(_ context.Context, d reflex.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliveries[deliveryKey{endpoint: d.Endpoint, eventID: d.EventID}] = d
+	return nil
+}
+
+// Delivery returns the recorded delivery of the event to the endpoint
+// or false if none was recorded.
+func (s *DeliveryStore) Delivery(endpoint, eventID string) (reflex.Delivery, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.deliveries[deliveryKey{endpoint: endpoint, eventID: eventID}]
+	return d, ok
+}
@@ -0,0 +1,30 @@
+package rtest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveryStore(t *testing.T) {
+	ctx := context.Background()
+	s := rtest.NewDeliveryStore()
+
+	_, ok := s.Delivery("hook", "1")
+	require.False(t, ok)
+
+	d := reflex.Delivery{Endpoint: "hook", EventID: "1", Status: reflex.DeliveryFailed, Attempts: 1}
+	jtest.RequireNil(t, s.RecordDelivery(ctx, d))
+
+	// Replaces the existing delivery.
+	d.Status, d.Attempts = reflex.DeliverySucceeded, 2
+	jtest.RequireNil(t, s.RecordDelivery(ctx, d))
+
+	res, ok := s.Delivery("hook", "1")
+	require.True(t, ok)
+	require.Equal(t, d, res)
+}
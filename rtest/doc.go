@@ -0,0 +1,3 @@
+// Package rtest provides in-memory reflex implementations for unit testing
+// consumers without a MySQL database.
+package rtest
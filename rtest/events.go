@@ -0,0 +1,266 @@
+package rtest
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+var ErrTxDone = errors.New("transaction has already been committed or rolled back",
+	j.C("ERR_6f2b1d0e8a4c9357"))
+
+// Option defines a functional option that configures an in-memory events table.
+type Option func(*EventsTable)
+
+// WithClock provides an option to set the clock used for event timestamps.
+// It defaults to time.Now. This is useful for deterministic tests.
+func WithClock(now func() time.Time) Option {
+	return func(t *EventsTable) {
+		t.now = now
+	}
+}
+
+// NewEventsTable returns a new in-memory events table.
+func NewEventsTable(opts ...Option) *EventsTable {
+	t := &EventsTable{
+		now:     time.Now,
+		changed: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// EventsTable is an in-memory events table that mirrors rsql.EventsTable.
+// Event IDs are monotonically incrementing integers starting at 1.
+// It is safe for concurrent use.
+type EventsTable struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	events  []*reflex.Event
+	changed chan struct{}
+}
+
+// Insert inserts and commits an event.
+func (t *EventsTable) Insert(foreignID string, typ reflex.EventType) *reflex.Event {
+	return t.InsertWithMetadata(foreignID, typ, nil)
+}
+
+// InsertWithMetadata inserts and commits an event with metadata.
+func (t *EventsTable) InsertWithMetadata(foreignID string, typ reflex.EventType,
+	metadata []byte) *reflex.Event {
+
+	return t.commit([]pending{{foreignID: foreignID, typ: typ, metadata: metadata}})[0]
+}
+
+// Begin returns a new simulated transaction. Events inserted via the transaction
+// are only streamed after it is committed.
+func (t *EventsTable) Begin() *Tx {
+	return &Tx{table: t}
+}
+
+// Events returns a copy of all committed events.
+func (t *EventsTable) Events() []*reflex.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]*reflex.Event(nil), t.events...)
+}
+
+// Stream implements reflex.StreamFunc and returns a StreamClient that
+// streams committed events after the provided cursor. It supports the
+// StreamFromHead, StreamFromTime, StreamToHead and StreamUntil options.
+func (t *EventsTable) Stream(ctx context.Context, after string,
+	opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+
+	var o reflex.StreamOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var prev int64
+	if o.StreamFromHead {
+		t.mu.Lock()
+		prev = int64(len(t.events))
+		t.mu.Unlock()
+	} else if !o.StreamFromTime.IsZero() {
+		t.mu.Lock()
+		for _, e := range t.events {
+			if !e.Timestamp.Before(o.StreamFromTime) {
+				break
+			}
+			prev = e.IDInt()
+		}
+		t.mu.Unlock()
+	} else if after != "" {
+		var err error
+		prev, err = strconv.ParseInt(after, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid cursor")
+		}
+	}
+
+	until := int64(-1)
+	if o.StreamUntilCursor != "" {
+		var err error
+		until, err = strconv.ParseInt(o.StreamUntilCursor, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid until cursor")
+		}
+	}
+	if o.StreamToHead {
+		t.mu.Lock()
+		head := int64(len(t.events))
+		t.mu.Unlock()
+		if until < 0 || head < until {
+			until = head
+		}
+	}
+
+	return &streamclient{
+		ctx:       ctx,
+		table:     t,
+		prev:      prev,
+		until:     until,
+		untilTime: o.StreamUntilTime,
+	}, nil
+}
+
+type pending struct {
+	foreignID string
+	typ       reflex.EventType
+	metadata  []byte
+}
+
+func (t *EventsTable) commit(pl []pending) []*reflex.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var res []*reflex.Event
+	for _, p := range pl {
+		e := &reflex.Event{
+			ID:        strconv.Itoa(len(t.events) + 1),
+			Type:      p.typ,
+			ForeignID: p.foreignID,
+			Timestamp: t.now(),
+			MetaData:  p.metadata,
+		}
+		t.events = append(t.events, e)
+		res = append(res, e)
+	}
+
+	if len(res) > 0 {
+		close(t.changed)
+		t.changed = make(chan struct{})
+	}
+
+	return res
+}
+
+// next returns the event after prev if available or a channel that is
+// closed when new events are committed.
+func (t *EventsTable) next(prev int64) (*reflex.Event, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if prev < int64(len(t.events)) {
+		return t.events[prev], nil
+	}
+	return nil, t.changed
+}
+
+// Tx simulates a sql transaction on an in-memory events table.
+type Tx struct {
+	table   *EventsTable
+	mu      sync.Mutex
+	pending []pending
+	done    bool
+}
+
+// Insert adds an event to the transaction.
+func (tx *Tx) Insert(foreignID string, typ reflex.EventType) error {
+	return tx.InsertWithMetadata(foreignID, typ, nil)
+}
+
+// InsertWithMetadata adds an event with metadata to the transaction.
+func (tx *Tx) InsertWithMetadata(foreignID string, typ reflex.EventType, metadata []byte) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.pending = append(tx.pending, pending{foreignID: foreignID, typ: typ, metadata: metadata})
+	return nil
+}
+
+// Commit commits the transaction's events to the table.
+func (tx *Tx) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.table.commit(tx.pending)
+	return nil
+}
+
+// Rollback discards the transaction's events. It returns ErrTxDone if the
+// transaction was already committed or rolled back.
+func (tx *Tx) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.pending = nil
+	return nil
+}
+
+type streamclient struct {
+	ctx       context.Context
+	table     *EventsTable
+	prev      int64
+	until     int64 // Inclusive upper bound cursor or -1 if unbounded.
+	untilTime time.Time
+}
+
+// Recv blocks until the next event is committed or returns ErrHeadReached
+// once the StreamToHead or StreamUntil bounds are reached.
+func (s *streamclient) Recv() (*reflex.Event, error) {
+	for {
+		if err := s.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if s.until >= 0 && s.prev >= s.until {
+			return nil, reflex.ErrHeadReached
+		}
+
+		e, changed := s.table.next(s.prev)
+		if e != nil {
+			if !s.untilTime.IsZero() && !e.Timestamp.Before(s.untilTime) {
+				return nil, reflex.ErrHeadReached
+			}
+			s.prev++
+			return e, nil
+		}
+
+		select {
+		case <-changed:
+		case <-s.ctx.Done():
+			return nil, s.ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package rtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+type testEventType int
+
+func (t testEventType) ReflexType() int {
+	return int(t)
+}
+
+func TestEventsTable(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	table := rtest.NewEventsTable(rtest.WithClock(func() time.Time {
+		return t0
+	}))
+
+	table.Insert("1", testEventType(1))
+
+	tx := table.Begin()
+	jtest.RequireNil(t, tx.Insert("2", testEventType(2)))
+	jtest.RequireNil(t, tx.InsertWithMetadata("3", testEventType(3), []byte("meta")))
+
+	// Uncommitted events not streamed.
+	ctx := context.Background()
+	sc, err := table.Stream(ctx, "", reflex.WithStreamToHead())
+	jtest.RequireNil(t, err)
+
+	e, err := sc.Recv()
+	jtest.RequireNil(t, err)
+	require.Equal(t, "1", e.ID)
+	require.Equal(t, t0, e.Timestamp)
+
+	_, err = sc.Recv()
+	jtest.Require(t, reflex.ErrHeadReached, err)
+
+	jtest.RequireNil(t, tx.Commit())
+	jtest.Require(t, rtest.ErrTxDone, tx.Rollback())
+
+	// Rolled back events never streamed.
+	tx = table.Begin()
+	jtest.RequireNil(t, tx.Insert("4", testEventType(4)))
+	jtest.RequireNil(t, tx.Rollback())
+
+	sc, err = table.Stream(ctx, "1", reflex.WithStreamToHead())
+	jtest.RequireNil(t, err)
+
+	e, err = sc.Recv()
+	jtest.RequireNil(t, err)
+	require.Equal(t, "2", e.ID)
+
+	e, err = sc.Recv()
+	jtest.RequireNil(t, err)
+	require.Equal(t, "3", e.ID)
+	require.Equal(t, []byte("meta"), e.MetaData)
+
+	_, err = sc.Recv()
+	jtest.Require(t, reflex.ErrHeadReached, err)
+
+	require.Len(t, table.Events(), 3)
+}
+
+func TestStreamFromHead(t *testing.T) {
+	table := rtest.NewEventsTable()
+	table.Insert("1", testEventType(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sc, err := table.Stream(ctx, "", reflex.WithStreamFromHead())
+	jtest.RequireNil(t, err)
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		table.Insert("2", testEventType(2))
+	}()
+
+	e, err := sc.Recv()
+	jtest.RequireNil(t, err)
+	require.Equal(t, "2", e.ID)
+
+	cancel()
+	_, err = sc.Recv()
+	jtest.Require(t, context.Canceled, err)
+}
+
+func TestStreamFromTime(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := t0
+	table := rtest.NewEventsTable(rtest.WithClock(func() time.Time {
+		clock = clock.Add(time.Hour)
+		return clock
+	}))
+
+	for i := 1; i <= 5; i++ {
+		table.Insert("foreign", testEventType(i))
+	}
+
+	sc, err := table.Stream(context.Background(), "",
+		reflex.WithStreamFromTime(t0.Add(time.Hour*3)), reflex.WithStreamToHead())
+	jtest.RequireNil(t, err)
+
+	e, err := sc.Recv()
+	jtest.RequireNil(t, err)
+	require.Equal(t, "3", e.ID)
+}
+
+func TestStreamUntil(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := t0
+	table := rtest.NewEventsTable(rtest.WithClock(func() time.Time {
+		clock = clock.Add(time.Hour)
+		return clock
+	}))
+
+	for i := 1; i <= 5; i++ {
+		table.Insert("foreign", testEventType(i))
+	}
+
+	assertUntil := func(t *testing.T, expect int, opts ...reflex.StreamOption) {
+		sc, err := table.Stream(context.Background(), "", opts...)
+		jtest.RequireNil(t, err)
+
+		// Events inserted after the stream starts are not streamed.
+		table.Insert("foreign", testEventType(0))
+
+		var n int
+		for {
+			_, err := sc.Recv()
+			if reflex.IsHeadReachedErr(err) {
+				break
+			}
+			jtest.RequireNil(t, err)
+			n++
+		}
+		require.Equal(t, expect, n)
+	}
+
+	assertUntil(t, 5, reflex.WithStreamToHead())
+	assertUntil(t, 3, reflex.WithStreamUntil("3"))
+	assertUntil(t, 3, reflex.WithStreamUntil("3"), reflex.WithStreamToHead())
+	assertUntil(t, 2, reflex.WithStreamUntilTime(t0.Add(time.Hour*3)))
+}
+
+func TestRunConsumer(t *testing.T) {
+	table := rtest.NewEventsTable()
+	cstore := rtest.NewCursorStore()
+
+	for i := 1; i <= 5; i++ {
+		table.Insert("foreign", testEventType(i))
+	}
+
+	var consumed []string
+	consumer := reflex.NewConsumer("rtest_consumer",
+		func(ctx context.Context, f fate.Fate, e *reflex.Event) error {
+			consumed = append(consumed, e.ID)
+			return nil
+		})
+
+	spec := reflex.NewSpec(table.Stream, cstore, consumer, reflex.WithStreamToHead())
+	err := reflex.Run(context.Background(), spec)
+	jtest.Require(t, reflex.ErrHeadReached, err)
+
+	require.Equal(t, []string{"1", "2", "3", "4", "5"}, consumed)
+	require.Equal(t, "5", cstore.Cursor("rtest_consumer"))
+	require.Equal(t, 1, cstore.FlushCount())
+}
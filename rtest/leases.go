@@ -0,0 +1,67 @@
+package rtest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/luno/reflex"
+)
+
+var _ reflex.LeaseStore = (*LeaseStore)(nil)
+
+// NewLeaseStore returns a new in-memory lease store.
+func NewLeaseStore() *LeaseStore {
+	return &LeaseStore{
+		now:    time.Now,
+		leases: make(map[string]lease),
+	}
+}
+
+// LeaseStore is an in-memory lease store that is safe for concurrent use.
+type LeaseStore struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	leases map[string]lease
+}
+
+type lease struct {
+	owner   string
+	expires time.Time
+}
+
+func (s *LeaseStore) Acquire(_ context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	l, ok := s.leases[key]
+	if ok && l.owner != owner && now.Before(l.expires) {
+		return false, nil
+	}
+
+	s.leases[key] = lease{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *LeaseStore) Release(_ context.Context, key, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.leases[key].owner == owner {
+		delete(s.leases, key)
+	}
+	return nil
+}
+
+// Owner returns the current owner of the key or an empty string if not leased.
+func (s *LeaseStore) Owner(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.leases[key]
+	if !ok || !s.now().Before(l.expires) {
+		return ""
+	}
+	return l.owner
+}
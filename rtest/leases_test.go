@@ -0,0 +1,42 @@
+package rtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaseStore(t *testing.T) {
+	ctx := context.Background()
+	s := rtest.NewLeaseStore()
+
+	ok, err := s.Acquire(ctx, "key", "a", time.Minute)
+	jtest.RequireNil(t, err)
+	require.True(t, ok)
+	require.Equal(t, "a", s.Owner("key"))
+
+	ok, err = s.Acquire(ctx, "key", "b", time.Minute)
+	jtest.RequireNil(t, err)
+	require.False(t, ok)
+
+	jtest.RequireNil(t, s.Release(ctx, "key", "b"))
+	require.Equal(t, "a", s.Owner("key"))
+
+	jtest.RequireNil(t, s.Release(ctx, "key", "a"))
+	require.Equal(t, "", s.Owner("key"))
+
+	ok, err = s.Acquire(ctx, "key", "b", time.Millisecond)
+	jtest.RequireNil(t, err)
+	require.True(t, ok)
+
+	time.Sleep(time.Millisecond * 5)
+	require.Equal(t, "", s.Owner("key"))
+
+	ok, err = s.Acquire(ctx, "key", "a", time.Minute)
+	jtest.RequireNil(t, err)
+	require.True(t, ok)
+}
@@ -0,0 +1,50 @@
+package rtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/reflex"
+)
+
+var _ reflex.StateStore = (*StateStore)(nil)
+
+// NewStateStore returns a new in-memory state store.
+func NewStateStore() *StateStore {
+	return &StateStore{
+		states: make(map[string]state),
+	}
+}
+
+// StateStore is an in-memory state store that is safe for concurrent use.
+type StateStore struct {
+	mu     sync.Mutex
+	states map[string]state
+}
+
+type state struct {
+	data    []byte
+	version int64
+}
+
+func (s *StateStore) Load(_ context.Context, key string) ([]byte, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.states[key]
+	return st.data, st.version, nil
+}
+
+func (s *StateStore) Store(_ context.Context, key string, data []byte, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.states[key].version != version {
+		return errors.Wrap(reflex.ErrStateConflict, "", j.KS("key", key))
+	}
+
+	s.states[key] = state{data: data, version: version + 1}
+	return nil
+}
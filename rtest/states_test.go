@@ -0,0 +1,30 @@
+package rtest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateStore(t *testing.T) {
+	ctx := context.Background()
+	s := rtest.NewStateStore()
+
+	state, version, err := s.Load(ctx, "key")
+	jtest.RequireNil(t, err)
+	require.Nil(t, state)
+	require.Equal(t, int64(0), version)
+
+	jtest.RequireNil(t, s.Store(ctx, "key", []byte("a"), 0))
+	jtest.Require(t, reflex.ErrStateConflict, s.Store(ctx, "key", []byte("b"), 0))
+	jtest.RequireNil(t, s.Store(ctx, "key", []byte("b"), 1))
+
+	state, version, err = s.Load(ctx, "key")
+	jtest.RequireNil(t, err)
+	require.Equal(t, []byte("b"), state)
+	require.Equal(t, int64(2), version)
+}
@@ -2,32 +2,221 @@ package reflex
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/luno/fate"
 	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
 )
 
+// RunOption defines a functional option that configures Run.
+type RunOption func(*runOptions)
+
+type runOptions struct {
+	windows  []DailyWindow
+	head     func(ctx context.Context) (int64, error)
+	failFast bool
+	drift    *driftWatch
+	metrics  Metrics
+	breaker  *circuitBreaker
+
+	prefetch      int
+	prefetchBytes int
+}
+
+// WithRunWindows provides an option to only consume events during the
+// provided daily time windows, e.g. off-peak hours. Outside of the windows
+// Run pauses before consuming the next event while keeping the consumer
+// lag metrics up to date.
+func WithRunWindows(windows ...DailyWindow) RunOption {
+	return func(o *runOptions) {
+		o.windows = append(o.windows, windows...)
+	}
+}
+
+// WithRunLagEvents provides an option to export the consumer lag measured in
+// number of events behind the head (head - cursor) by periodically calling
+// the head function, e.g. rsql.EventsTable.ToLatestID. Time based lag hides
+// backlogs on bursty tables. It requires int event IDs.
+func WithRunLagEvents(head func(ctx context.Context) (int64, error)) RunOption {
+	return func(o *runOptions) {
+		o.head = head
+	}
+}
+
+// WithoutRunPanicRecovery provides an option to not recover panics from the
+// consumer, crashing the process instead. By default panics are recovered
+// and returned as ErrPanic errors after incrementing the consumer error
+// metric and applying the consumer's error policy.
+func WithoutRunPanicRecovery() RunOption {
+	return func(o *runOptions) {
+		o.failFast = true
+	}
+}
+
+// WithRunMetrics provides an option to set the metrics of consumers not
+// created by NewConsumer, e.g. custom Consumer implementations, which
+// otherwise only increment the prometheus consumer error metric on
+// recovered panics. Consumers created by NewConsumer use their own
+// metrics, see WithConsumerMetrics.
+func WithRunMetrics(m Metrics) RunOption {
+	return func(o *runOptions) {
+		o.metrics = m
+	}
+}
+
+// WithRunCursorDrift provides an option to watch the drift between the head
+// and the stored cursor in number of events by periodically calling the head
+// function, e.g. rsql.EventsTable.ToLatestID. Unlike WithRunLagEvents,
+// the drift is based on the cursor store, so it is also updated if the
+// consumer is stuck or not receiving events. The drift is exported as a
+// gauge and the optional alert function is called with the drift on each
+// check that it exceeds the threshold. It requires int cursors.
+func WithRunCursorDrift(head func(ctx context.Context) (int64, error), threshold int64,
+	alert func(ctx context.Context, consumer string, drift int64)) RunOption {
+	return func(o *runOptions) {
+		o.drift = &driftWatch{
+			head:      head,
+			threshold: threshold,
+			alert:     alert,
+			period:    driftPeriod,
+		}
+	}
+}
+
+// WithRunCircuitBreaker provides an option to open a circuit breaker after n
+// consecutive consume errors of the spec, see ConsumerState.ErrorStreak which
+// is tracked across runs in this process. While open, Run pauses for the
+// cool-down before returning the consume error, protecting downstream systems
+// from retry storms of callers like rpatterns.RunForever. After the cool-down
+// the breaker is half-open, i.e. the next consume error opens it again, and a
+// consumed event closes it. Each opening increments the circuit open metric and
+// calls the optional notify function with the consume error.
+func WithRunCircuitBreaker(n int, coolDown time.Duration,
+	notify func(ctx context.Context, consumer string, err error)) RunOption {
+	return func(o *runOptions) {
+		o.breaker = &circuitBreaker{
+			threshold: n,
+			coolDown:  coolDown,
+			notify:    notify,
+		}
+	}
+}
+
+// DailyWindow defines a daily time window as offsets from midnight.
+type DailyWindow struct {
+	// Start is the offset from midnight when the window opens.
+	Start time.Duration
+
+	// End is the offset from midnight when the window closes. If End is
+	// before Start the window spans midnight.
+	End time.Duration
+
+	// Location of the window. It defaults to UTC.
+	Location *time.Location
+}
+
+// untilOpen returns the duration until the window opens or zero if it is open.
+func (w DailyWindow) untilOpen(t time.Time) time.Duration {
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	offset := t.Sub(midnight)
+
+	if w.Start <= w.End && offset >= w.Start && offset < w.End {
+		return 0
+	} else if w.Start > w.End && (offset >= w.Start || offset < w.End) {
+		return 0
+	}
+
+	if offset < w.Start {
+		return w.Start - offset
+	}
+	return 24*time.Hour - offset + w.Start
+}
+
 // Run executes the spec by streaming events from the current cursor,
 // feeding each into the consumer and updating the cursor on success.
 // It always returns a non-nil error. Cancel the context to return early.
-func Run(in context.Context, s Spec) error {
+// The status of the spec is available via Health. Reruns of the spec and
+// the class of the returned error are exported by the reflex_run_restarts_total
+// and reflex_run_last_error metrics, see RunBackoff.
+//
+// If the cursor store implements CursorFencer, each Run acquires a new epoch
+// and returns ErrCursorFenced when another Run of the same consumer acquires
+// a later epoch, so concurrent runs never interleave cursor writes.
+func Run(in context.Context, s Spec, ropts ...RunOption) error {
+	var o runOptions
+	for _, opt := range ropts {
+		opt(&o)
+	}
+
+	if _, ok := health.Inspect(s.Name()); ok {
+		runRestarts.WithLabelValues(s.Name()).Inc()
+	}
+
+	health.Started(s.Name())
+	class, err := run(in, s, o)
+	health.Stopped(s.Name(), err)
 
+	if errors.IsAny(err, context.Canceled, context.DeadlineExceeded) {
+		class = errClassCanceled
+	}
+	setRunErrorClass(s.Name(), class)
+
+	return err
+}
+
+// run executes the spec and returns the error and its class, see Run.
+func run(in context.Context, s Spec, o runOptions) (string, error) {
 	ctx, cancel := context.WithCancel(in)
 	defer cancel()
-	defer s.cstore.Flush(context.Background()) // best effort flush with new context
 
-	cursor, err := s.cstore.GetCursor(ctx, s.consumer.Name())
+	cstore := s.cstore
+	if fencer, ok := cstore.(CursorFencer); ok {
+		var err error
+		cstore, err = fencer.Fence(ctx, s.consumer.Name())
+		if err != nil {
+			return errClassCursor, errors.Wrap(err, "fence cursor error")
+		}
+	}
+	defer cstore.Flush(context.Background()) // best effort flush with new context
+
+	cursor, err := cstore.GetCursor(ctx, s.consumer.Name())
 	if err != nil {
-		return errors.Wrap(err, "get cursor error")
+		return errClassCursor, errors.Wrap(err, "get cursor error")
+	}
+
+	var lagCursor *int64
+	if o.head != nil {
+		lagCursor, err = startLagEvents(ctx, o.head, s.consumer.Name(), cursor)
+		if err != nil {
+			return errClassStream, err
+		}
+	}
+
+	if o.drift != nil {
+		go o.drift.WatchForever(ctx, cstore, s.consumer.Name())
+	}
+
+	metrics := o.metrics
+	if metrics == nil {
+		metrics = newPromErrorMetrics(s.consumer.Name())
 	}
 
 	// Check if the consumer requires reset.
 	if resetter, ok := s.consumer.(resetter); ok {
 		err := resetter.Reset()
 		if err != nil {
-			return errors.Wrap(err, "reset error")
+			return errClassConsume, errors.Wrap(err, "reset error")
 		}
 	}
 
@@ -49,7 +238,7 @@ func Run(in context.Context, s Spec) error {
 	// Start stream
 	sc, err := s.stream(ctx, cursor, opts...)
 	if err != nil {
-		return err
+		return errClassStream, err
 	}
 
 	// Check if the stream client is a closer.
@@ -57,10 +246,17 @@ func Run(in context.Context, s Spec) error {
 		defer closer.Close()
 	}
 
+	// Check if the stream client reuses events.
+	releaser, _ := sc.(EventReleaser)
+
+	if o.prefetch > 0 || o.prefetchBytes > 0 {
+		sc = newPrefetchStream(ctx, sc, o.prefetch, o.prefetchBytes)
+	}
+
 	for {
 		e, err := sc.Recv()
 		if err != nil {
-			return errors.Wrap(err, "recv error")
+			return errClassStream, errors.Wrap(err, "recv error")
 		}
 
 		// Delay events if lag specified.
@@ -69,23 +265,300 @@ func Run(in context.Context, s Spec) error {
 			select {
 			case <-ctx.Done():
 				t.Stop()
-				return ctx.Err()
+				return errClassCanceled, ctx.Err()
 			case <-t.C:
 			}
 		}
 
-		if err := s.consumer.Consume(ctx, fate.New(), e); err != nil {
-			return errors.Wrap(err, "consume error")
+		// Pause if outside run windows.
+		if err := awaitWindows(ctx, o.windows, s.consumer, e); err != nil {
+			return errClassCanceled, err
 		}
 
-		if err := s.cstore.SetCursor(ctx, s.consumer.Name(), e.ID); err != nil {
-			return errors.Wrap(err, "set cursor error")
+		t0 := now()
+		if err := consume(ctx, s.consumer, metrics, e, !o.failFast); err != nil {
+			health.ConsumeFailed(s.Name())
+			err = errors.Wrap(err, "consume error")
+			if o.breaker != nil {
+				o.breaker.Trip(ctx, s.Name(), err)
+			}
+			return errClassConsume, err
+		}
+		latency := since(t0)
+
+		if err := cstore.SetCursor(ctx, s.consumer.Name(), e.ID); err != nil {
+			return errClassCursor, errors.Wrap(err, "set cursor error")
+		}
+
+		health.Consumed(s.Name(), e, now(), latency)
+
+		if lagCursor != nil {
+			atomic.StoreInt64(lagCursor, e.IDInt())
+		}
+
+		if releaser != nil {
+			releaser.Release(e)
 		}
 	}
 }
 
+// consume consumes the event, recovering any panics if recoverPanics is true.
+// Recovered panics of consumers not created by NewConsumer are recorded
+// as errors in the metrics.
+func consume(ctx context.Context, c Consumer, m Metrics, e *Event, recoverPanics bool) error {
+	if l, ok := c.(*consumer); ok {
+		// Let the consumer apply its error policy to panics.
+		return l.consumeEvent(ctx, fate.New(), e, recoverPanics)
+	} else if !recoverPanics {
+		return c.Consume(ctx, fate.New(), e)
+	}
+
+	err := recoverPanic(func() error {
+		return c.Consume(ctx, fate.New(), e)
+	})
+	if errors.Is(err, ErrPanic) {
+		m.ErrorInced(e)
+	}
+	return err
+}
+
+// recoverPanic calls fn and returns any panic as an ErrPanic error.
+func recoverPanic(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Wrap(ErrPanic, "", j.KS("panic", fmt.Sprint(r)))
+		}
+	}()
+	return fn()
+}
+
+// lagEventsPeriod is the period at which the head is queried to update
+// the consumer events lag metric.
+var lagEventsPeriod = time.Second * 30
+
+// startLagEvents starts a goroutine that periodically sets the consumer events
+// lag metric until the context is canceled. It returns the cursor to update.
+func startLagEvents(ctx context.Context, head func(ctx context.Context) (int64, error),
+	name string, cursor string) (*int64, error) {
+
+	var c int64
+	if cursor != "" {
+		var err error
+		c, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "lag events requires int cursors")
+		}
+	}
+
+	g := consumerLagEvents.WithLabelValues(name)
+	period := lagEventsPeriod
+
+	go func() {
+		for {
+			h, err := head(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Error(ctx, errors.Wrap(err, "lag events head error"),
+					j.KS("consumer", name))
+			} else if err == nil {
+				g.Set(float64(h - atomic.LoadInt64(&c)))
+			}
+
+			t := time.NewTimer(period)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	return &c, nil
+}
+
+// driftPeriod is the period at which the stored cursor drift is checked.
+var driftPeriod = time.Minute
+
+type driftWatch struct {
+	head      func(ctx context.Context) (int64, error)
+	threshold int64
+	alert     func(ctx context.Context, consumer string, drift int64)
+	period    time.Duration
+}
+
+// WatchForever checks the drift of the consumer's stored cursor every
+// period until the context is canceled.
+func (w *driftWatch) WatchForever(ctx context.Context, cstore CursorStore, name string) {
+	g := consumerCursorDrift.WithLabelValues(name)
+
+	for {
+		drift, err := w.check(ctx, cstore, name)
+		if err != nil && ctx.Err() == nil {
+			log.Error(ctx, errors.Wrap(err, "cursor drift error"), j.KS("consumer", name))
+		} else if err == nil {
+			g.Set(float64(drift))
+			if drift > w.threshold && w.alert != nil {
+				w.alert(ctx, name, drift)
+			}
+		}
+
+		t := time.NewTimer(w.period)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// check returns the drift between the head and the stored cursor.
+func (w *driftWatch) check(ctx context.Context, cstore CursorStore, name string) (int64, error) {
+	cursor, err := cstore.GetCursor(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	var c int64
+	if cursor != "" {
+		c, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			return 0, errors.Wrap(err, "cursor drift requires int cursors")
+		}
+	}
+
+	h, err := w.head(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return h - c, nil
+}
+
+// windowLagPeriod is the period at which lag metrics are updated while
+// waiting for a run window to open.
+const windowLagPeriod = time.Minute
+
+// awaitWindows blocks until any of the windows are open, updating the consumer
+// lag metrics of the pending event while it waits.
+func awaitWindows(ctx context.Context, windows []DailyWindow, c Consumer, e *Event) error {
+	if len(windows) == 0 {
+		return nil
+	}
+
+	for {
+		var wait time.Duration
+		for i, w := range windows {
+			d := w.untilOpen(now())
+			if i == 0 || d < wait {
+				wait = d
+			}
+		}
+		if wait == 0 {
+			return nil
+		}
+
+		if l, ok := c.(*consumer); ok {
+			l.updateLag(e, now())
+		}
+
+		if wait > windowLagPeriod {
+			wait = windowLagPeriod
+		}
+
+		t := newTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// circuitBreaker pauses specs with consecutive consume errors,
+// see WithRunCircuitBreaker.
+type circuitBreaker struct {
+	threshold int
+	coolDown  time.Duration
+	notify    func(ctx context.Context, consumer string, err error)
+}
+
+// Trip blocks for the cool-down if the consumer's error streak reached the
+// threshold or until the context is canceled.
+func (b *circuitBreaker) Trip(ctx context.Context, name string, err error) {
+	state, ok := health.Inspect(name)
+	if !ok || state.ErrorStreak < b.threshold {
+		return
+	}
+
+	log.Error(ctx, errors.Wrap(err, "reflex: consumer circuit breaker open",
+		j.MKV{"consumer": name, "errors": state.ErrorStreak}))
+	consumerCircuitOpen.WithLabelValues(name).Inc()
+	if b.notify != nil {
+		b.notify(ctx, name, err)
+	}
+
+	runBackoff.WithLabelValues(name).Set(b.coolDown.Seconds())
+	defer runBackoff.WithLabelValues(name).Set(0)
+
+	t := newTimer(b.coolDown)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// Error classes of the run last error metric, see Run.
+const (
+	errClassCanceled = "canceled"
+	errClassStream   = "stream"
+	errClassCursor   = "cursor"
+	errClassConsume  = "consume"
+)
+
+var errClasses = []string{errClassCanceled, errClassStream,
+	errClassCursor, errClassConsume}
+
+// setRunErrorClass sets the run last error metric of the consumer
+// to the class, resetting the other classes.
+func setRunErrorClass(name, class string) {
+	for _, c := range errClasses {
+		v := 0.0
+		if c == class {
+			v = 1
+		}
+		runLastError.WithLabelValues(name, c).Set(v)
+	}
+}
+
+// RunBackoff sleeps for the duration before the spec is run again, e.g.
+// after Run returned an error, exporting the duration as the consumer's
+// reflex_run_backoff_seconds metric while sleeping. Together with the
+// reflex_run_restarts_total and reflex_run_last_error metrics this
+// distinguishes erroring and restarting consumers from healthy ones
+// without events. It returns the context error if canceled while sleeping.
+func RunBackoff(ctx context.Context, s Spec, d time.Duration) error {
+	runBackoff.WithLabelValues(s.Name()).Set(d.Seconds())
+	defer runBackoff.WithLabelValues(s.Name()).Set(0)
+
+	t := newTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
 // newTimer is aliased for testing.
 var newTimer = time.NewTimer
 
 // since is aliased for testing.
 var since = time.Since
+
+// now is aliased for testing.
+var now = time.Now
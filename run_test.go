@@ -8,6 +8,7 @@ import (
 	"github.com/luno/fate"
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/jtest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -92,6 +93,280 @@ func TestRunDelayLag(t *testing.T) {
 	}
 }
 
+func TestRunWindows(t *testing.T) {
+	errDone := errors.New("no more events to mock")
+	t0 := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		windows []DailyWindow
+		sleeps  []time.Duration
+	}{
+		{
+			name: "no windows",
+		}, {
+			name:    "open window",
+			windows: []DailyWindow{{Start: 9 * time.Hour, End: 11 * time.Hour}},
+		}, {
+			name:    "open window over midnight",
+			windows: []DailyWindow{{Start: 22 * time.Hour, End: 11 * time.Hour}},
+		}, {
+			name:    "window opens in 3 minutes",
+			windows: []DailyWindow{{Start: 10*time.Hour + 3*time.Minute, End: 11 * time.Hour}},
+			sleeps:  []time.Duration{time.Minute, time.Minute, time.Minute},
+		}, {
+			name: "nearest window",
+			windows: []DailyWindow{
+				{Start: 2 * time.Hour, End: 3 * time.Hour},
+				{Start: 10*time.Hour + 90*time.Second, End: 11 * time.Hour},
+			},
+			sleeps: []time.Duration{time.Minute, 30 * time.Second},
+		}, {
+			name:    "window opens tomorrow",
+			windows: []DailyWindow{{Start: 9*time.Hour + 59*time.Minute, End: 10 * time.Hour}},
+			sleeps:  fill(24*60-1, time.Minute),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := t0
+			now = func() time.Time {
+				return clock
+			}
+			var sleeps []time.Duration
+			newTimer = func(d time.Duration) *time.Timer {
+				sleeps = append(sleeps, d)
+				clock = clock.Add(d)
+				return time.NewTimer(0)
+			}
+			defer func() {
+				now = time.Now
+				newTimer = time.NewTimer
+			}()
+
+			var consumer mockconsumer
+			spec := NewSpec(func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+				return &mockstreamclient{[]*Event{{ID: "1", Timestamp: t0}}, errDone}, nil
+			}, mockcursor{}, &consumer)
+
+			err := Run(context.Background(), spec, WithRunWindows(tt.windows...))
+			jtest.Require(t, errDone, err)
+			require.Len(t, consumer.Events, 1)
+			require.Equal(t, tt.sleeps, sleeps)
+		})
+	}
+}
+
+func TestRunLagEvents(t *testing.T) {
+	cache := lagEventsPeriod
+	defer func() {
+		lagEventsPeriod = cache
+	}()
+	lagEventsPeriod = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sc := &mockstreamclient{
+		Events:   []*Event{{ID: "1"}, {ID: "2"}, {ID: "3"}},
+		EndError: context.Canceled,
+	}
+	spec := NewSpec(func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		return blockingstreamclient{ctx: ctx, sc: sc}, nil
+	}, mockcursor{}, new(mockconsumer))
+
+	head := func(ctx context.Context) (int64, error) {
+		return 10, nil
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Run(ctx, spec, WithRunLagEvents(head))
+	}()
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(consumerLagEvents.WithLabelValues("")) == 7
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	jtest.Require(t, context.Canceled, <-errCh)
+}
+
+func TestRunCursorDrift(t *testing.T) {
+	cache := driftPeriod
+	defer func() {
+		driftPeriod = cache
+	}()
+	driftPeriod = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stuck consumer not receiving any events.
+	sc := &mockstreamclient{EndError: context.Canceled}
+	spec := NewSpec(func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		return blockingstreamclient{ctx: ctx, sc: sc}, nil
+	}, &memcursor{cursor: "4"}, NewConsumer("drift_test", nil))
+
+	head := func(ctx context.Context) (int64, error) {
+		return 10, nil
+	}
+
+	alerts := make(chan int64, 1)
+	alert := func(ctx context.Context, consumer string, drift int64) {
+		require.Equal(t, "drift_test", consumer)
+		select {
+		case alerts <- drift:
+		default:
+		}
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Run(ctx, spec, WithRunCursorDrift(head, 5, alert))
+	}()
+
+	require.Equal(t, int64(6), <-alerts)
+	require.Equal(t, 6.0, testutil.ToFloat64(consumerCursorDrift.WithLabelValues("drift_test")))
+
+	cancel()
+	jtest.Require(t, context.Canceled, <-errCh)
+}
+
+func TestRunPanicRecovery(t *testing.T) {
+	errDone := errors.New("no more events to mock")
+
+	newSpec := func(c Consumer) Spec {
+		return NewSpec(func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+			return &mockstreamclient{[]*Event{{ID: "1"}, {ID: "2"}}, errDone}, nil
+		}, mockcursor{}, c)
+	}
+
+	panicFn := func(ctx context.Context, f fate.Fate, e *Event) error {
+		if e.ID == "1" {
+			panic("test panic")
+		}
+		return nil
+	}
+
+	// Panics are returned as errors by default.
+	err := Run(context.Background(), newSpec(NewConsumer("test_panic", panicFn)))
+	jtest.Require(t, ErrPanic, err)
+	require.Equal(t, 1.0, testutil.ToFloat64(consumerErrors.WithLabelValues("test_panic")))
+
+	// The error policy is applied to panics.
+	var skipped []string
+	c := NewConsumer("test_panic_skip", panicFn, WithErrorPolicy(func(err error, e *Event) ErrorAction {
+		jtest.Require(t, ErrPanic, err)
+		skipped = append(skipped, e.ID)
+		return ErrorActionSkip
+	}))
+	err = Run(context.Background(), newSpec(c))
+	jtest.Require(t, errDone, err)
+	require.Equal(t, []string{"1"}, skipped)
+
+	// Panics of custom consumers are recorded in the run metrics.
+	m := new(mockMetrics)
+	err = Run(context.Background(), newSpec(panicConsumer{}), WithRunMetrics(m))
+	jtest.Require(t, ErrPanic, err)
+	require.Equal(t, 1, m.errors)
+	require.Equal(t, 0.0, testutil.ToFloat64(consumerErrors.WithLabelValues("test_panic_custom")))
+
+	// Opting out panics.
+	require.Panics(t, func() {
+		_ = Run(context.Background(), newSpec(NewConsumer("test_panic_fail", panicFn)),
+			WithoutRunPanicRecovery())
+	})
+}
+
+func TestRunFencing(t *testing.T) {
+	errDone := errors.New("no more events to mock")
+	cs := &fencingcursor{memcursor: memcursor{cursor: "1"}}
+
+	var fenced bool
+	spec := NewSpec(func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		require.Equal(t, "1", after)
+		return &mockstreamclient{[]*Event{{ID: "2"}, {ID: "3"}}, errDone}, nil
+	}, cs, NewConsumer("test_fencing", func(ctx context.Context, f fate.Fate, e *Event) error {
+		if e.ID == "3" && !fenced {
+			// Another run starts.
+			fenced = true
+			cs.epoch++
+		}
+		return nil
+	}))
+
+	err := Run(context.Background(), spec)
+	jtest.Require(t, ErrCursorFenced, err)
+	require.Equal(t, "2", cs.cursor)
+	require.Equal(t, 2, cs.epoch)
+}
+
+// fencingcursor is a cursor store that fences cursor writes of stale epochs.
+type fencingcursor struct {
+	memcursor
+	epoch int
+}
+
+func (f *fencingcursor) Fence(ctx context.Context, consumerName string) (CursorStore, error) {
+	f.epoch++
+	return &fencedcursor{f: f, epoch: f.epoch}, nil
+}
+
+type fencedcursor struct {
+	f     *fencingcursor
+	epoch int
+}
+
+func (c *fencedcursor) GetCursor(ctx context.Context, consumerName string) (string, error) {
+	return c.f.GetCursor(ctx, consumerName)
+}
+
+func (c *fencedcursor) SetCursor(ctx context.Context, consumerName string, cursor string) error {
+	if c.epoch != c.f.epoch {
+		return ErrCursorFenced
+	}
+	return c.f.SetCursor(ctx, consumerName, cursor)
+}
+
+func (c *fencedcursor) Flush(ctx context.Context) error {
+	return nil
+}
+
+type panicConsumer struct{}
+
+func (panicConsumer) Name() string {
+	return "test_panic_custom"
+}
+
+func (panicConsumer) Consume(context.Context, fate.Fate, *Event) error {
+	panic("test panic")
+}
+
+// blockingstreamclient blocks once all events are streamed until the
+// context is canceled.
+type blockingstreamclient struct {
+	ctx context.Context
+	sc  *mockstreamclient
+}
+
+func (b blockingstreamclient) Recv() (*Event, error) {
+	if len(b.sc.Events) == 0 {
+		<-b.ctx.Done()
+		return nil, b.ctx.Err()
+	}
+	return b.sc.Recv()
+}
+
+func fill(n int, d time.Duration) []time.Duration {
+	var res []time.Duration
+	for i := 0; i < n; i++ {
+		res = append(res, d)
+	}
+	return res
+}
+
 type mockstreamclient struct {
 	Events   []*Event
 	EndError error
@@ -132,3 +407,133 @@ func (m mockcursor) SetCursor(ctx context.Context, consumerName string, cursor s
 func (m mockcursor) Flush(ctx context.Context) error {
 	return nil
 }
+
+func TestRunCircuitBreaker(t *testing.T) {
+	errConsume := errors.New("consume error")
+	spec := NewSpec(func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		return &mockstreamclient{[]*Event{{ID: "1"}}, context.Canceled}, nil
+	}, mockcursor{}, NewConsumer("test_breaker", func(context.Context, fate.Fate, *Event) error {
+		return errConsume
+	}))
+
+	var notified []string
+	opt := WithRunCircuitBreaker(2, time.Millisecond, func(ctx context.Context, consumer string, err error) {
+		jtest.Require(t, errConsume, err)
+		notified = append(notified, consumer)
+	})
+
+	jtest.Require(t, errConsume, Run(context.Background(), spec, opt))
+	require.Empty(t, notified)
+
+	// Opens after 2 consecutive errors and stays open.
+	jtest.Require(t, errConsume, Run(context.Background(), spec, opt))
+	jtest.Require(t, errConsume, Run(context.Background(), spec, opt))
+	require.Equal(t, []string{"test_breaker", "test_breaker"}, notified)
+	require.Equal(t, 2.0, testutil.ToFloat64(consumerCircuitOpen.WithLabelValues("test_breaker")))
+
+	// Canceled contexts don't wait for the cool-down.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Run(ctx, spec, WithRunCircuitBreaker(1, time.Hour, nil))
+	require.Error(t, err)
+}
+
+type releasingstreamclient struct {
+	*mockstreamclient
+	released []string
+}
+
+func (m *releasingstreamclient) Release(e *Event) {
+	m.released = append(m.released, e.ID)
+}
+
+func TestRunReleaseEvents(t *testing.T) {
+	errDone := errors.New("no more events to mock")
+	sc := &releasingstreamclient{
+		mockstreamclient: &mockstreamclient{[]*Event{{ID: "1"}, {ID: "2"}}, errDone},
+	}
+
+	var consumed []string
+	spec := NewSpec(func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		return sc, nil
+	}, mockcursor{}, NewConsumer("test_release", func(ctx context.Context, f fate.Fate, e *Event) error {
+		// Events are released after being consumed.
+		require.Equal(t, consumed, sc.released)
+		consumed = append(consumed, e.ID)
+		return nil
+	}))
+
+	jtest.Require(t, errDone, Run(context.Background(), spec))
+	require.Equal(t, []string{"1", "2"}, sc.released)
+}
+
+func TestRunMetrics(t *testing.T) {
+	errDone := errors.New("no more events to mock")
+	errConsume := errors.New("consume error")
+	name := "test_run_metrics"
+
+	newSpec := func(err error) Spec {
+		return NewSpec(func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+			return &mockstreamclient{[]*Event{{ID: "1"}}, errDone}, nil
+		}, mockcursor{}, NewConsumer(name, func(context.Context, fate.Fate, *Event) error {
+			return err
+		}))
+	}
+
+	assertClass := func(class string) {
+		for _, c := range errClasses {
+			exp := 0.0
+			if c == class {
+				exp = 1
+			}
+			require.Equal(t, exp, testutil.ToFloat64(runLastError.WithLabelValues(name, c)), c)
+		}
+	}
+
+	jtest.Require(t, errDone, Run(context.Background(), newSpec(nil)))
+	assertClass(errClassStream)
+	require.Equal(t, 0.0, testutil.ToFloat64(runRestarts.WithLabelValues(name)))
+
+	jtest.Require(t, errConsume, Run(context.Background(), newSpec(errConsume)))
+	assertClass(errClassConsume)
+	require.Equal(t, 1.0, testutil.ToFloat64(runRestarts.WithLabelValues(name)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	jtest.Require(t, context.Canceled, Run(ctx, newSpec(context.Canceled)))
+	assertClass(errClassCanceled)
+	require.Equal(t, 2.0, testutil.ToFloat64(runRestarts.WithLabelValues(name)))
+}
+
+func TestRunBackoff(t *testing.T) {
+	spec := NewSpec(nil, mockcursor{}, NewConsumer("test_run_backoff", nil))
+	backoff := runBackoff.WithLabelValues("test_run_backoff")
+
+	done := make(chan struct{})
+	go func() {
+		jtest.RequireNil(t, RunBackoff(context.Background(), spec, time.Hour/1000))
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(backoff) == 3.6
+	}, time.Second, time.Millisecond)
+
+	<-done
+	require.Equal(t, 0.0, testutil.ToFloat64(backoff))
+
+	// Canceling stops the backoff.
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- RunBackoff(ctx, spec, time.Hour)
+	}()
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(backoff) == 3600
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	jtest.Require(t, context.Canceled, <-errCh)
+	require.Equal(t, 0.0, testutil.ToFloat64(backoff))
+}
@@ -3,9 +3,12 @@ package reflex
 import (
 	"context"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/luno/jettison/errors"
 	"github.com/luno/reflex/reflexpb"
+	"google.golang.org/grpc/metadata"
 )
 
 type streamServerPB interface {
@@ -13,6 +16,11 @@ type streamServerPB interface {
 	Send(*reflexpb.Event) error
 }
 
+// headerServerPB is implemented by gRPC generated stream servers.
+type headerServerPB interface {
+	SendHeader(metadata.MD) error
+}
+
 // NewServer returns a new server.
 func NewServer() *Server {
 	return &Server{
@@ -46,11 +54,22 @@ func (s *Server) maybeErrStopped() error {
 // Note that back pressure is achieved by gRPC Streams' 64KB send and receive buffers.
 // Note that gRPC does not guarantee buffered messages being sent on the wire, see
 // https://github.com/grpc/grpc-go/issues/2159
+//
+// The negotiated protocol (see ProtocolVersion) is sent to the client
+// in the gRPC response headers before streaming. Heartbeats are sent if
+// negotiated, see WithStreamHeartbeat.
 func (s *Server) Stream(sFn StreamFunc, req *reflexpb.StreamRequest, sspb streamServerPB) error {
 	if err := s.maybeErrStopped(); err != nil {
 		return err
 	}
 
+	protocol := negotiate(req)
+	if hspb, ok := sspb.(headerServerPB); ok {
+		if err := hspb.SendHeader(protocolToMD(protocol)); err != nil {
+			return errors.Wrap(err, "send header error")
+		}
+	}
+
 	ctx, cancel := context.WithCancel(sspb.Context())
 	defer cancel()
 
@@ -59,11 +78,22 @@ func (s *Server) Stream(sFn StreamFunc, req *reflexpb.StreamRequest, sspb stream
 	}
 
 	streamer := func() error {
-		sc, err := sFn(ctx, req.After, optsFromProto(req.Options)...)
+		opts := optsFromProto(req.Options)
+		sc, err := sFn(ctx, req.After, opts...)
 		if err != nil {
 			return err
 		}
-		return serveStream(sspb, sc)
+
+		var heartbeat time.Duration
+		if protocol.Has(CapabilityHeartbeats) {
+			var o StreamOptions
+			for _, opt := range opts {
+				opt(&o)
+			}
+			heartbeat = o.StreamHeartbeat
+		}
+
+		return serveStream(sspb, sc, heartbeat, opts...)
 	}
 
 	var err error
@@ -75,11 +105,36 @@ func (s *Server) Stream(sFn StreamFunc, req *reflexpb.StreamRequest, sspb stream
 }
 
 // serveStream streams the events from StreamClient to streamServerPB.
+// Events not matching the stream filters are not sent, this supports stream
+// functions that do not filter events themselves. If the heartbeat interval
+// is positive, heartbeats are sent when no events are sent.
 // To stop, cancel the streamServerPB's context.
 // It always returns a non-nil error.
-func serveStream(ss streamServerPB, sc StreamClient) error {
+func serveStream(ss streamServerPB, sc StreamClient, heartbeat time.Duration,
+	opts ...StreamOption) error {
+
 	ctx := ss.Context()
 
+	var o StreamOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if heartbeat > 0 {
+		hs := &heartbeatServer{streamServerPB: ss}
+		ss = hs
+
+		ctx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hs.sendHeartbeats(ctx, heartbeat)
+		}()
+		defer wg.Wait()
+		defer cancel()
+	}
+
 	// Ensure close if stream client is a closer.
 	if closer, ok := sc.(io.Closer); ok {
 		defer closer.Close()
@@ -95,6 +150,10 @@ func serveStream(ss streamServerPB, sc StreamClient) error {
 			return errors.Wrap(err, "recv error 2")
 		}
 
+		if !o.Match(e) {
+			continue
+		}
+
 		pb, err := eventToProto(e)
 		if err != nil {
 			return errors.Wrap(err, "to proto error")
@@ -123,3 +182,42 @@ func awaitStop(ctx context.Context, stop <-chan struct{}) error {
 		return ErrStopped
 	}
 }
+
+// heartbeatServer is a streamServerPB that sends heartbeats
+// concurrently with events.
+type heartbeatServer struct {
+	streamServerPB
+
+	mu   sync.Mutex
+	sent bool
+}
+
+func (s *heartbeatServer) Send(e *reflexpb.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = true
+	return s.streamServerPB.Send(e)
+}
+
+// sendHeartbeats sends a heartbeat every interval in which no events were
+// sent until the context is canceled. Send errors are returned by the
+// next event send, so they are ignored.
+func (s *heartbeatServer) sendHeartbeats(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		s.mu.Lock()
+		if !s.sent {
+			_ = s.streamServerPB.Send(&reflexpb.Event{Heartbeat: true})
+		}
+		s.sent = false
+		s.mu.Unlock()
+	}
+}
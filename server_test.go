@@ -0,0 +1,95 @@
+package reflex
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex/reflexpb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerStreamFilter(t *testing.T) {
+	errDone := errors.New("no more events")
+	var el []*Event
+	for i, fid := range []string{"user:1", "user:2", "order:1", "user:3", "user:4"} {
+		el = append(el, &Event{
+			ID:        strconv.Itoa(i + 1),
+			ForeignID: fid,
+			Type:      eventType(i%2 + 1),
+			Timestamp: time.Now(),
+		})
+	}
+
+	sFn := func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		return &mockstreamclient{Events: el, EndError: errDone}, nil
+	}
+
+	pb, err := optsToProto([]StreamOption{
+		WithStreamTypes(eventType(1)),
+		WithStreamForeignIDPrefix("user:"),
+	})
+	jtest.RequireNil(t, err)
+
+	ss := &mockserverpb{ctx: context.Background()}
+	err = NewServer().Stream(sFn, &reflexpb.StreamRequest{Options: pb}, ss)
+	jtest.Require(t, errDone, err)
+
+	var ids []string
+	for _, e := range ss.sent {
+		ids = append(ids, e.Id)
+	}
+	require.Equal(t, []string{"1", "5"}, ids)
+}
+
+func TestServerStreamHeaders(t *testing.T) {
+	errDone := errors.New("no more events")
+	var el []*Event
+	for i, tenant := range []string{"a", "b", "a", ""} {
+		e := &Event{
+			ID:        strconv.Itoa(i + 1),
+			ForeignID: strconv.Itoa(i + 1),
+			Type:      eventType(1),
+			Timestamp: time.Now(),
+		}
+		if tenant != "" {
+			e.Headers = map[string]string{"tenant_id": tenant, "trace_id": e.ID}
+		}
+		el = append(el, e)
+	}
+
+	sFn := func(ctx context.Context, after string, opts ...StreamOption) (StreamClient, error) {
+		return &mockstreamclient{Events: el, EndError: errDone}, nil
+	}
+
+	pb, err := optsToProto([]StreamOption{WithStreamHeader("tenant_id", "a")})
+	jtest.RequireNil(t, err)
+
+	ss := &mockserverpb{ctx: context.Background()}
+	err = NewServer().Stream(sFn, &reflexpb.StreamRequest{Options: pb}, ss)
+	jtest.Require(t, errDone, err)
+
+	var ids []string
+	for _, e := range ss.sent {
+		ids = append(ids, e.Id)
+		require.Equal(t, e.Id, e.Headers["trace_id"])
+	}
+	require.Equal(t, []string{"1", "3"}, ids)
+}
+
+type mockserverpb struct {
+	ctx  context.Context
+	sent []*reflexpb.Event
+}
+
+func (m *mockserverpb) Context() context.Context {
+	return m.ctx
+}
+
+func (m *mockserverpb) Send(e *reflexpb.Event) error {
+	m.sent = append(m.sent, e)
+	return nil
+}
@@ -0,0 +1,206 @@
+package reflex
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	sloLabel = "objective"
+
+	sloLatency = "latency"
+	sloLag     = "lag"
+
+	// sloWindow is the number of last consumed events of SLOStatus.
+	sloWindow = 1000
+)
+
+// WithConsumerSLO provides an option to set the consumer's service level
+// objectives: the target p99 latency of consuming events and the maximum
+// lag of consumed events. Events consumed slower than the target latency or
+// with a lag above the maximum lag are counted as breaches per objective
+// ("latency" or "lag") by the reflex_consumer_slo_breach_total metric and
+// the objectives are exported by the reflex_consumer_slo_target_seconds
+// metric, so alerting rules can be shared by all consumers, e.g. on the
+// ratio of latency breaches to reflex_consumer_slo_events_total above 1%.
+// See SLOHandler for a summary. A zero duration disables the objective.
+func WithConsumerSLO(p99Latency, maxLag time.Duration) ConsumerOption {
+	return func(c *consumer) {
+		c.slo = &slo{latency: p99Latency, maxLag: maxLag}
+	}
+}
+
+// slo defines the service level objectives of a consumer.
+type slo struct {
+	latency time.Duration
+	maxLag  time.Duration
+}
+
+// SLOStatus is the service level status of a consumer
+// over its last 1000 consumed events.
+type SLOStatus struct {
+	// Name of the consumer.
+	Name string `json:"name"`
+
+	// TargetLatencySeconds is the target p99 latency, zero if disabled.
+	TargetLatencySeconds float64 `json:"target_latency_seconds"`
+
+	// MaxLagSeconds is the maximum lag, zero if disabled.
+	MaxLagSeconds float64 `json:"max_lag_seconds"`
+
+	// Events is the number of events in the window.
+	Events int `json:"events"`
+
+	// LatencyBreaches is the number of events in the window consumed
+	// slower than the target latency.
+	LatencyBreaches int `json:"latency_breaches"`
+
+	// LagBreaches is the number of events in the window consumed
+	// with a lag above the maximum lag.
+	LagBreaches int `json:"lag_breaches"`
+
+	// LagSeconds is the lag of the last consumed event.
+	LagSeconds float64 `json:"lag_seconds"`
+
+	// Breached is true if more than 1% of the events in the window breached
+	// the target latency, ie. the p99 latency is above target, or if the
+	// last consumed event's lag is above the maximum lag.
+	Breached bool `json:"breached"`
+}
+
+var slos = &sloRegistry{trackers: make(map[string]*sloTracker)}
+
+// SLOs returns the service level status of all consumers configured
+// with WithConsumerSLO in this process ordered by name.
+func SLOs() []SLOStatus {
+	return slos.List()
+}
+
+// SLOHandler returns a http.Handler that serves the SLOs statuses as JSON.
+func SLOHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(SLOs())
+	})
+}
+
+// sloRegistry tracks the service levels of consumers.
+type sloRegistry struct {
+	mu       sync.Mutex
+	trackers map[string]*sloTracker
+}
+
+// Register returns a new tracker of the consumer's service levels,
+// replacing any previous tracker of the consumer.
+func (r *sloRegistry) Register(name string, o slo) *sloTracker {
+	labels := prometheus.Labels{consumerLabel: name}
+	consumerSLOTarget.WithLabelValues(name, sloLatency).Set(o.latency.Seconds())
+	consumerSLOTarget.WithLabelValues(name, sloLag).Set(o.maxLag.Seconds())
+
+	t := &sloTracker{
+		name:     name,
+		slo:      o,
+		events:   consumerSLOEvents.With(labels),
+		breaches: consumerSLOBreaches.MustCurryWith(labels),
+		window:   make([]sloBreach, sloWindow),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.trackers[name] = t
+
+	return t
+}
+
+// List returns the statuses of all the trackers ordered by name.
+func (r *sloRegistry) List() []SLOStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make([]SLOStatus, 0, len(r.trackers))
+	for _, t := range r.trackers {
+		res = append(res, t.Status())
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// sloBreach is the objectives breached by a consumed event.
+type sloBreach struct {
+	latency bool
+	lag     bool
+}
+
+// sloTracker tracks the service levels of a consumer.
+type sloTracker struct {
+	name     string
+	slo      slo
+	events   prometheus.Counter
+	breaches *prometheus.CounterVec
+
+	mu     sync.Mutex
+	window []sloBreach // Ring buffer of the last consumed events.
+	next   int
+	count  int
+	lag    time.Duration
+}
+
+// Observe records the latency and lag of a consumed event.
+func (t *sloTracker) Observe(latency, lag time.Duration) {
+	b := sloBreach{
+		latency: t.slo.latency > 0 && latency > t.slo.latency,
+		lag:     t.slo.maxLag > 0 && lag > t.slo.maxLag,
+	}
+
+	t.events.Inc()
+	if b.latency {
+		t.breaches.WithLabelValues(sloLatency).Inc()
+	}
+	if b.lag {
+		t.breaches.WithLabelValues(sloLag).Inc()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.window[t.next] = b
+	t.next = (t.next + 1) % len(t.window)
+	if t.count < len(t.window) {
+		t.count++
+	}
+	t.lag = lag
+}
+
+// Status returns the status of the consumer over the window.
+func (t *sloTracker) Status() SLOStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := SLOStatus{
+		Name:                 t.name,
+		TargetLatencySeconds: t.slo.latency.Seconds(),
+		MaxLagSeconds:        t.slo.maxLag.Seconds(),
+		Events:               t.count,
+		LagSeconds:           t.lag.Seconds(),
+	}
+	for _, b := range t.window[:t.count] {
+		if b.latency {
+			s.LatencyBreaches++
+		}
+		if b.lag {
+			s.LagBreaches++
+		}
+	}
+
+	s.Breached = s.LatencyBreaches*100 > s.Events ||
+		(t.slo.maxLag > 0 && t.lag > t.slo.maxLag)
+
+	return s
+}
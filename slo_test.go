@@ -0,0 +1,81 @@
+package reflex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/luno/fate"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerSLO(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	latency := time.Millisecond
+
+	c := NewConsumer("slo_test", func(context.Context, fate.Fate, *Event) error {
+		clock.now = clock.now.Add(latency)
+		return nil
+	}, WithConsumerClock(clock), WithConsumerSLO(10*time.Millisecond, time.Minute))
+
+	consume := func(n int, lag time.Duration) {
+		for i := 0; i < n; i++ {
+			err := c.Consume(context.Background(), fate.New(), &Event{
+				ID:        "1",
+				Timestamp: clock.now.Add(-lag),
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	getStatus := func() SLOStatus {
+		for _, s := range SLOs() {
+			if s.Name == "slo_test" {
+				return s
+			}
+		}
+		return SLOStatus{}
+	}
+
+	consume(99, time.Second)
+	latency = time.Second
+	consume(1, time.Second)
+
+	// 1% of events breaching the latency target is within p99.
+	require.Equal(t, SLOStatus{
+		Name:                 "slo_test",
+		TargetLatencySeconds: 0.01,
+		MaxLagSeconds:        60,
+		Events:               100,
+		LatencyBreaches:      1,
+		LagSeconds:           1,
+	}, getStatus())
+
+	consume(1, time.Hour)
+	s := getStatus()
+	require.Equal(t, 2, s.LatencyBreaches)
+	require.Equal(t, 1, s.LagBreaches)
+	require.True(t, s.Breached)
+
+	require.Equal(t, 101.0, testutil.ToFloat64(consumerSLOEvents.WithLabelValues("slo_test")))
+	require.Equal(t, 2.0, testutil.ToFloat64(consumerSLOBreaches.WithLabelValues("slo_test", sloLatency)))
+	require.Equal(t, 1.0, testutil.ToFloat64(consumerSLOBreaches.WithLabelValues("slo_test", sloLag)))
+	require.Equal(t, 0.01, testutil.ToFloat64(consumerSLOTarget.WithLabelValues("slo_test", sloLatency)))
+
+	// Only the last events are included in the status.
+	latency = time.Millisecond
+	consume(sloWindow, 0)
+	s = getStatus()
+	require.Equal(t, sloWindow, s.Events)
+	require.False(t, s.Breached)
+
+	rec := httptest.NewRecorder()
+	SLOHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/slo", nil))
+
+	var sl []SLOStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sl))
+	require.Contains(t, sl, s)
+}
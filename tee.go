@@ -0,0 +1,166 @@
+package reflex
+
+import (
+	"sync"
+)
+
+// defaultTeeBuffer is the default number of events buffered per tee client.
+const defaultTeeBuffer = 1000
+
+// TeeOption defines a functional option that configures Tee.
+type TeeOption func(*tee)
+
+// WithTeeBuffer provides an option to set the number of events buffered
+// per client. It defaults to 1000.
+func WithTeeBuffer(size int) TeeOption {
+	return func(t *tee) {
+		t.size = size
+	}
+}
+
+// Tee returns n stream clients fed from the single underlying stream client,
+// so one DB or gRPC stream can feed multiple in-process consumers. Each
+// client receives all the events followed by the error of the underlying
+// stream. Clients are buffered independently, so slow clients don't block
+// other clients until their buffer is full, after which receiving from the
+// underlying stream blocks until the slow client catches up or is closed.
+//
+// Events are shared by all clients and must not be modified. The underlying
+// stream is closed when all the clients are closed. Note that the cursors
+// of the consumers of the clients should be consistent on restart, e.g. by
+// streaming from the minimum cursor.
+func Tee(sc StreamClient, n int, opts ...TeeOption) []StreamClient {
+	t := &tee{sc: sc, size: defaultTeeBuffer}
+	for _, o := range opts {
+		o(t)
+	}
+	if t.size < 1 {
+		t.size = 1
+	}
+
+	var res []StreamClient
+	for i := 0; i < n; i++ {
+		c := &teeClient{
+			tee:    t,
+			notify: make(chan struct{}, 1),
+			popped: make(chan struct{}, 1),
+		}
+		t.clients = append(t.clients, c)
+		res = append(res, c)
+	}
+
+	go t.recvForever()
+
+	return res
+}
+
+type tee struct {
+	sc      StreamClient
+	size    int
+	mu      sync.Mutex
+	clients []*teeClient
+	closed  int
+}
+
+// recvForever receives from the underlying stream until it errors,
+// pushing each result to all the clients. Note the clients are
+// immutable after Tee returns.
+func (t *tee) recvForever() {
+	for {
+		e, err := t.sc.Recv()
+
+		for _, c := range t.clients {
+			c.push(e, err, t.size)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *tee) close() error {
+	t.mu.Lock()
+	t.closed++
+	last := t.closed == len(t.clients)
+	t.mu.Unlock()
+
+	if !last {
+		return nil
+	}
+	return closeStream(t.sc)
+}
+
+type teeClient struct {
+	tee    *tee
+	notify chan struct{}
+	popped chan struct{}
+
+	mu     sync.Mutex
+	buf    []*Event
+	err    error
+	closed bool
+}
+
+// push adds the event or error to the buffer. It blocks while
+// the buffer is full and the client is not closed.
+func (c *teeClient) push(e *Event, err error, size int) {
+	c.mu.Lock()
+	for err == nil && !c.closed && len(c.buf) >= size {
+		c.mu.Unlock()
+		<-c.popped
+		c.mu.Lock()
+	}
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	if err != nil {
+		c.err = err
+	} else {
+		c.buf = append(c.buf, e)
+	}
+	c.mu.Unlock()
+
+	signal(c.notify)
+}
+
+func (c *teeClient) Recv() (*Event, error) {
+	for {
+		c.mu.Lock()
+		if len(c.buf) > 0 {
+			e := c.buf[0]
+			c.buf[0] = nil
+			c.buf = c.buf[1:]
+			c.mu.Unlock()
+			signal(c.popped)
+			return e, nil
+		} else if c.err != nil {
+			err := c.err
+			c.mu.Unlock()
+			return nil, err
+		}
+		c.mu.Unlock()
+
+		<-c.notify
+	}
+}
+
+// Close stops buffering events for the client and closes the
+// underlying stream if all clients are closed.
+func (c *teeClient) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.buf = nil
+	c.err = ErrStopped
+	c.mu.Unlock()
+
+	signal(c.notify)
+	signal(c.popped)
+
+	return c.tee.close()
+}
@@ -0,0 +1,87 @@
+package reflex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTee(t *testing.T) {
+	errDone := errors.New("no more events")
+	sc := &closerstreamclient{mockstreamclient: mockstreamclient{
+		Events:   []*Event{{ID: "1"}, {ID: "2"}, {ID: "3"}},
+		EndError: errDone,
+	}}
+
+	clients := Tee(sc, 2)
+	require.Len(t, clients, 2)
+
+	for _, c := range clients {
+		var ids []string
+		for {
+			e, err := c.Recv()
+			if err != nil {
+				jtest.Require(t, errDone, err)
+				break
+			}
+			ids = append(ids, e.ID)
+		}
+		require.Equal(t, []string{"1", "2", "3"}, ids)
+	}
+
+	jtest.RequireNil(t, closeStream(clients[0]))
+	require.False(t, sc.closed)
+	_, err := clients[0].Recv()
+	jtest.Require(t, ErrStopped, err)
+
+	jtest.RequireNil(t, closeStream(clients[1]))
+	require.True(t, sc.closed)
+}
+
+func TestTeeBackpressure(t *testing.T) {
+	errDone := errors.New("no more events")
+	sc := &closerstreamclient{mockstreamclient: mockstreamclient{
+		Events:   []*Event{{ID: "1"}, {ID: "2"}, {ID: "3"}, {ID: "4"}},
+		EndError: errDone,
+	}}
+
+	clients := Tee(sc, 2, WithTeeBuffer(1))
+
+	// The second client's buffer fills up after the first event, so the
+	// first client only receives one more event.
+	for _, id := range []string{"1", "2"} {
+		e, err := clients[0].Recv()
+		jtest.RequireNil(t, err)
+		require.Equal(t, id, e.ID)
+	}
+
+	next := make(chan *Event, 1)
+	go func() {
+		e, _ := clients[0].Recv()
+		next <- e
+	}()
+
+	select {
+	case <-next:
+		require.Fail(t, "received event despite full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Closing the slow client unblocks the other clients.
+	jtest.RequireNil(t, closeStream(clients[1]))
+	e := <-next
+	require.Equal(t, "3", e.ID)
+}
+
+type closerstreamclient struct {
+	mockstreamclient
+	closed bool
+}
+
+func (c *closerstreamclient) Close() error {
+	c.closed = true
+	return nil
+}